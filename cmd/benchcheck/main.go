@@ -0,0 +1,74 @@
+// Command benchcheck は標準コーパスのベンチマークを実行し、記録した基準と比較します
+//
+//	go run ./cmd/benchcheck            # 基準と比較し、悪化していれば終了コード1
+//	go run ./cmd/benchcheck -update    # 現在の結果で基準を書き換える
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/benchcheck"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+func main() {
+	var (
+		baselinePath = flag.String("baseline", "bench/baselines.json", "基準のファイル")
+		tolerance    = flag.Float64("tolerance", benchcheck.DefaultTolerance, "悪化として許容する割合（0.15 = 15%）")
+		update       = flag.Bool("update", false, "現在の結果で基準を書き換える")
+		quiet        = flag.Bool("q", false, "実行中の結果を表示しない")
+	)
+	flag.Parse()
+
+	var baseline benchcheck.Baselines
+	if !*update {
+		var err error
+		baseline, err = benchcheck.Load(*baselinePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Fatalf("基準のファイルがありません: %s（-update で作成してください）", *baselinePath)
+		}
+		if err != nil {
+			log.Fatalf("基準の読み込みエラー: %v", err)
+		}
+	}
+
+	progress := func(name string, r benchcheck.Result) {
+		if !*quiet {
+			fmt.Printf("%-24s %12d ns/op %8d allocs/op\n", name, r.NsPerOp, r.AllocsPerOp)
+		}
+	}
+	current, err := benchcheck.Run(common.Names(), progress)
+	if err != nil {
+		log.Fatalf("ベンチマークエラー: %v", err)
+	}
+
+	if *update {
+		if err := benchcheck.Save(*baselinePath, current); err != nil {
+			log.Fatalf("基準の書き込みエラー: %v", err)
+		}
+		fmt.Printf("✅ %d 件の基準を %s に書き込みました\n", len(current), *baselinePath)
+		return
+	}
+
+	if !*quiet {
+		fmt.Println()
+	}
+	report := benchcheck.Compare(baseline, current, *tolerance)
+	if err := report.Write(os.Stdout); err != nil {
+		log.Fatalf("出力エラー: %v", err)
+	}
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
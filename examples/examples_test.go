@@ -0,0 +1,22 @@
+package examples_test
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestExamplesBuild は examples のプログラムがライブラリの変更後もビルドできることを確認します
+// プログラムは実行しません（サーバーやファイルの書き込みを伴うため）。
+func TestExamplesBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build of examples in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	out, err := exec.Command(gobin, "build", "-o", t.TempDir(), "./filecompress", "./httpmiddleware").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,43 @@
+// filecompress は指定したファイルを .tzz コンテナに圧縮する、ライブラリの使用例です
+//
+//	go run ./examples/filecompress -algo lz77 examples/sample.txt
+//
+// 出力は入力のパスに .tzz を付けたファイルで、tinyzipzap -d で展開できます。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+
+	// 使用するアルゴリズムのパッケージを読み込むと common.New に登録されます
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+func main() {
+	algo := flag.String("algo", "lz77", "algorithm ("+fmt.Sprint(common.Names())+")")
+	force := flag.Bool("f", false, "overwrite existing output")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: filecompress [-algo name] [-f] file")
+		os.Exit(2)
+	}
+
+	c, err := common.New(*algo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src := flag.Arg(0)
+	stats, err := container.CompressFile(src, src+".tzz", c, container.FileOptions{Algorithm: *algo, Overwrite: *force})
+	if err != nil {
+		log.Fatal(err)
+	}
+	common.PrintCompressionStats(stats)
+}
@@ -0,0 +1,97 @@
+// httpmiddleware は HTTP のレスポンスを圧縮するミドルウェアの使用例です
+//
+//	go run ./examples/httpmiddleware -addr :8080
+//	curl -H 'Accept-Encoding: gzip' --compressed http://localhost:8080/
+//
+// レスポンスの本文をためてから common.CompressNoExpand で圧縮し、小さくならない
+// 本文（画像や乱数など）は Content-Encoding を付けずにそのまま（identity）送ります。
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+// bufferWriter はレスポンスの本文とステータスコードをためておきます
+type bufferWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (b *bufferWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+// compress は Accept-Encoding に encoding を含むリクエストのレスポンスを圧縮します
+// encoding は登録名で、HTTP の Content-Encoding としてもそのまま使います（gzip など）。
+func compress(encoding string, next http.Handler) (http.Handler, error) {
+	c, err := common.New(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !accepts(r, encoding) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+		body, compressed, err := common.CompressNoExpand(c, bw.buf.Bytes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if compressed {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(bw.status)
+		if _, err := w.Write(body); err != nil {
+			log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}), nil
+}
+
+// accepts は r の Accept-Encoding に encoding が含まれるかを返します
+func accepts(r *http.Request, encoding string) bool {
+	for _, field := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(field), ";")
+		if strings.EqualFold(name, encoding) {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "listen address")
+	flag.Parse()
+
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for i := range 100 {
+			fmt.Fprintf(w, "line %d: The quick brown fox jumps over the lazy dog.\n", i)
+		}
+	})
+	handler, err := compress("gzip", hello)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
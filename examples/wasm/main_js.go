@@ -0,0 +1,45 @@
+//go:build js && wasm
+
+package main
+
+import "syscall/js"
+
+// jsArg は js.Value を arg として扱います
+type jsArg struct{ v js.Value }
+
+func (a jsArg) IsString() bool { return a.v.Type() == js.TypeString }
+
+func (a jsArg) String() string { return a.v.String() }
+
+func (a jsArg) Bytes() ([]byte, bool) {
+	if a.v.Type() != js.TypeObject || !a.v.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, false
+	}
+	b := make([]byte, a.v.Length())
+	js.CopyBytesToGo(b, a.v)
+	return b, true
+}
+
+// export は handler を JS の関数にします（[]byte のプロパティは Uint8Array に変換します）
+func export(handler func([]arg) map[string]any) js.Func {
+	return js.FuncOf(func(this js.Value, values []js.Value) any {
+		args := make([]arg, len(values))
+		for i, v := range values {
+			args[i] = jsArg{v}
+		}
+		result := handler(args)
+		if data, ok := result["data"].([]byte); ok {
+			array := js.Global().Get("Uint8Array").New(len(data))
+			js.CopyBytesToJS(array, data)
+			result["data"] = array
+		}
+		return js.ValueOf(result)
+	})
+}
+
+func main() {
+	js.Global().Set("tinyzipzapCompress", export(compress))
+	js.Global().Set("tinyzipzapDecompress", export(decompress))
+	// 関数を呼び出せるようにプログラムを終了しない
+	select {}
+}
@@ -0,0 +1,13 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "build with GOOS=js GOARCH=wasm and load the output from a web page (see wrapper.go)")
+	os.Exit(2)
+}
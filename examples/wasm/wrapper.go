@@ -0,0 +1,85 @@
+// wasm はブラウザの JavaScript から圧縮と展開を呼び出せるようにする、WebAssembly の使用例です
+//
+//	GOOS=js GOARCH=wasm go build -o tinyzipzap.wasm ./examples/wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// 読み込むと、グローバルに次の2つの関数を定義します。
+//
+//	tinyzipzapCompress(algorithm, Uint8Array)   → {algorithm, data: Uint8Array} または {error}
+//	tinyzipzapDecompress(algorithm, Uint8Array) → {algorithm, data: Uint8Array} または {error}
+//
+// ファイルシステムを使わないパッケージ（rle、huffman、lz77、common）だけを読み込みます。
+// 引数の確認と結果のオブジェクトへの変換はこのファイルにあり、syscall/js を使う部分
+// （main_js.go）は js.Value とこれらの関数の間の受け渡しだけです。
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+
+	// 使用するアルゴリズムのパッケージを読み込むと common.New に登録されます
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// maxOutputSize は展開結果の最大サイズです（ブラウザのメモリを使い切らないため）
+const maxOutputSize = 64 << 20
+
+// arg は JS から渡された引数です（main_js.go が js.Value を包みます）
+type arg interface {
+	IsString() bool
+	String() string
+	// Bytes は引数が Uint8Array の場合に内容をコピーして返します
+	Bytes() ([]byte, bool)
+}
+
+// errArgs は引数の数や型が正しくない場合のエラーです
+var errArgs = errors.New("expected (algorithm: string, data: Uint8Array)")
+
+// parseArgs はアルゴリズム名と入力のデータを取り出します
+func parseArgs(args []arg) (algorithm string, data []byte, err error) {
+	if len(args) != 2 || !args[0].IsString() {
+		return "", nil, errArgs
+	}
+	data, ok := args[1].Bytes()
+	if !ok {
+		return "", nil, errArgs
+	}
+	return args[0].String(), data, nil
+}
+
+// call は引数を確認して op を呼び出し、JS に返すオブジェクトのプロパティを返します
+// 成功した場合は "algorithm" と "data"（[]byte、main_js.go で Uint8Array にします）を、
+// 失敗した場合は "error" だけを持ちます。
+func call(op func(c common.Compressor, data []byte) ([]byte, error), args []arg) map[string]any {
+	algorithm, data, err := parseArgs(args)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	c, err := common.New(algorithm)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	out, err := op(c, data)
+	if err != nil {
+		return map[string]any{"error": fmt.Sprintf("%s: %v", algorithm, err)}
+	}
+	return map[string]any{"algorithm": algorithm, "data": out}
+}
+
+// compress は tinyzipzapCompress の処理です
+func compress(args []arg) map[string]any {
+	return call(func(c common.Compressor, data []byte) ([]byte, error) {
+		return c.Compress(data)
+	}, args)
+}
+
+// decompress は tinyzipzapDecompress の処理です（展開結果は maxOutputSize まで）
+func decompress(args []arg) map[string]any {
+	return call(func(c common.Compressor, data []byte) ([]byte, error) {
+		return common.DecompressWithOptions(c, data, common.DecompressOptions{MaxOutputSize: maxOutputSize})
+	}, args)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// fakeArg は JS の引数の代わりです（bytes が nil でなければ Uint8Array）
+type fakeArg struct {
+	str   *string
+	bytes []byte
+}
+
+func (a fakeArg) IsString() bool { return a.str != nil }
+
+func (a fakeArg) String() string {
+	if a.str == nil {
+		return "[object Object]"
+	}
+	return *a.str
+}
+
+func (a fakeArg) Bytes() ([]byte, bool) {
+	if a.bytes == nil {
+		return nil, false
+	}
+	return bytes.Clone(a.bytes), true
+}
+
+func str(s string) arg { return fakeArg{str: &s} }
+func bin(b []byte) arg { return fakeArg{bytes: b} }
+func keys(m map[string]any) []string {
+	var k []string
+	for key := range m {
+		k = append(k, key)
+	}
+	return k
+}
+
+func TestCompressDecompress(t *testing.T) {
+	input := []byte(strings.Repeat("tinyzipzap in the browser. ", 20))
+	for _, algorithm := range []string{"rle", "huffman", "lz77"} {
+		compressed := compress([]arg{str(algorithm), bin(input)})
+		if compressed["algorithm"] != algorithm || len(compressed) != 2 {
+			t.Fatalf("%s: compress result = %v", algorithm, keys(compressed))
+		}
+		data, ok := compressed["data"].([]byte)
+		if !ok {
+			t.Fatalf("%s: data is %T, want []byte", algorithm, compressed["data"])
+		}
+
+		decompressed := decompress([]arg{str(algorithm), bin(data)})
+		if got, _ := decompressed["data"].([]byte); !bytes.Equal(got, input) {
+			t.Errorf("%s: round trip mismatch: %v", algorithm, decompressed["error"])
+		}
+	}
+}
+
+func TestCall_Errors(t *testing.T) {
+	rle, err := common.New("rle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 展開結果が maxOutputSize を超えるデータ
+	bomb, err := rle.Compress(make([]byte, maxOutputSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []arg
+		want string
+	}{
+		{"no arguments", nil, errArgs.Error()},
+		{"algorithm not a string", []arg{bin([]byte("rle")), bin([]byte("x"))}, errArgs.Error()},
+		{"data not a Uint8Array", []arg{str("rle"), str("x")}, errArgs.Error()},
+		{"unknown algorithm", []arg{str("zstd"), bin([]byte("x"))}, "unknown algorithm: zstd"},
+		{"invalid data", []arg{str("huffman"), bin([]byte{1})}, "huffman: "},
+		{"output too large", []arg{str("rle"), bin(bomb)}, common.ErrOutputTooLarge.Error()},
+	}
+	for _, tt := range tests {
+		result := decompress(tt.args)
+		msg, _ := result["error"].(string)
+		if !reflect.DeepEqual(keys(result), []string{"error"}) || !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: result = %v, want only an error containing %q", tt.name, result, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Command addcorrupt は壊れた入力を testdata/corrupt/ の回帰テストに追加します
+// ファイルを -algo のアルゴリズムで展開し、今の実装が返すエラーの分類を期待値として記録します。
+// パニックやタイムアウトになる入力は記録せず、デコーダーを直してから追加します。
+//
+//	go run ./internal/addcorrupt -algo lz77 -name short-match file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corrupt"
+)
+
+func main() {
+	dir := flag.String("dir", "testdata/corrupt", "壊れた入力のディレクトリ")
+	algo := flag.String("algo", "", "展開するアルゴリズムの登録名")
+	name := flag.String("name", "", "入力の名前（<名前>.bin として保存）")
+	expect := flag.String("expect", "", "期待する分類（省略時は今の実装の分類）")
+	flag.Parse()
+
+	if *algo == "" || *name == "" || flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "使い方: go run ./internal/addcorrupt -algo <登録名> -name <名前> [-expect <分類>] <ファイル>")
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("入力の読み込みエラー: %v", err)
+	}
+
+	res, err := corrupt.Run(*algo, data)
+	if err != nil {
+		log.Fatalf("展開エラー: %v", err)
+	}
+	fmt.Printf("%s/%s: %s（%v", *algo, *name, res.Category, res.Duration.Round(1e3))
+	if res.Err != nil {
+		fmt.Printf(", %v", res.Err)
+	}
+	fmt.Println("）")
+
+	category := res.Category
+	if *expect != "" {
+		category = corrupt.Category(*expect)
+	}
+	if _, err := corrupt.Add(*dir, *algo, *name, data, category); err != nil {
+		log.Fatalf("追加エラー: %v", err)
+	}
+	fmt.Printf("✅ %s/%s/%s.bin を %s として追加しました\n", *dir, *algo, *name, category)
+}
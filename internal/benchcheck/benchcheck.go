@@ -0,0 +1,253 @@
+// Package benchcheck compares benchmark results against recorded baselines.
+// 標準コーパスで各アルゴリズムの圧縮・展開のベンチマークを実行し、リポジトリに
+// 保存した基準（bench/baselines.json）と ns/op・allocs/op を比較して、許容範囲を
+// 超えて遅くなった、または割り当てが増えたベンチマークを報告します。
+package benchcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// DefaultTolerance は基準からの悪化として許容する割合です（15%）
+const DefaultTolerance = 0.15
+
+// Result は1つのベンチマークの結果です
+type Result struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+}
+
+// Baselines はベンチマーク名から結果への対応です（baselines.json の形式）
+type Baselines map[string]Result
+
+// Load は path から基準を読み込みます
+func Load(path string) (Baselines, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Baselines
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Save は基準を path に書き込みます（既存のファイルは上書きします）
+// キーは名前順に並ぶため、更新時の差分はレビューしやすい形になります
+func Save(path string, b Baselines) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(path, append(data, '\n'), fileutil.Options{MkdirAll: true, Overwrite: true})
+}
+
+// Run は登録名 names の各アルゴリズムで標準コーパスの圧縮と展開のベンチマークを実行します
+// 結果の名前は "Compress/lz77" のような形式です。progress が nil でなければ、
+// ベンチマークが終わるたびに呼び出します。
+func Run(names []string, progress func(name string, r Result)) (Baselines, error) {
+	var corpus []byte
+	for _, sample := range testcorpus.Samples() {
+		corpus = append(corpus, sample.Data...)
+	}
+
+	results := make(Baselines)
+	record := func(name string, fn func(b *testing.B)) {
+		br := testing.Benchmark(fn)
+		r := Result{NsPerOp: br.NsPerOp(), AllocsPerOp: br.AllocsPerOp()}
+		results[name] = r
+		if progress != nil {
+			progress(name, r)
+		}
+	}
+
+	for _, name := range names {
+		c, err := common.New(name)
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := c.Compress(corpus)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if decompressed, err := c.Decompress(compressed); err != nil || !bytes.Equal(decompressed, corpus) {
+			return nil, fmt.Errorf("%s: round trip failed: %v", name, err)
+		}
+
+		record("Compress/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.Compress(corpus)
+			}
+		})
+		record("Decompress/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.Decompress(compressed)
+			}
+		})
+	}
+	return results, nil
+}
+
+// Status はベンチマークの比較結果の種類です
+type Status int
+
+const (
+	// StatusOK は許容範囲内です
+	StatusOK Status = iota
+	// StatusRegressed は ns/op か allocs/op が許容範囲を超えて増えたことを表します
+	StatusRegressed
+	// StatusNew は基準がないベンチマークです（-update で追加します）
+	StatusNew
+	// StatusMissing は基準にあるが実行されなかったベンチマークです
+	StatusMissing
+)
+
+// Diff は1つのベンチマークの基準と現在の結果の比較です
+type Diff struct {
+	Name     string
+	Baseline Result
+	Current  Result
+	Status   Status
+
+	// NsRegressed と AllocsRegressed はそれぞれの指標が許容範囲を超えたかを表します
+	NsRegressed     bool
+	AllocsRegressed bool
+}
+
+// Report は基準との比較結果です
+type Report struct {
+	Tolerance float64
+	Diffs     []Diff // 名前順
+}
+
+// Compare は current を baseline と比較します
+// 現在の値が基準の (1+tolerance) 倍を超えた指標を悪化とみなします。速くなった場合や
+// 割り当てが減った場合は失敗にしません（-update で基準を更新できます）。
+func Compare(baseline, current Baselines, tolerance float64) Report {
+	names := make(map[string]bool)
+	for name := range baseline {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+
+	report := Report{Tolerance: tolerance}
+	for name := range names {
+		base, inBaseline := baseline[name]
+		cur, inCurrent := current[name]
+		d := Diff{Name: name, Baseline: base, Current: cur}
+
+		switch {
+		case !inBaseline:
+			d.Status = StatusNew
+		case !inCurrent:
+			d.Status = StatusMissing
+		default:
+			d.NsRegressed = exceeds(base.NsPerOp, cur.NsPerOp, tolerance)
+			d.AllocsRegressed = exceeds(base.AllocsPerOp, cur.AllocsPerOp, tolerance)
+			if d.NsRegressed || d.AllocsRegressed {
+				d.Status = StatusRegressed
+			}
+		}
+		report.Diffs = append(report.Diffs, d)
+	}
+
+	sort.Slice(report.Diffs, func(i, j int) bool { return report.Diffs[i].Name < report.Diffs[j].Name })
+	return report
+}
+
+// exceeds は current が baseline の (1+tolerance) 倍を超えるかを返します
+// 基準が0の場合は、現在の値が1以上なら超えたとみなします
+func exceeds(baseline, current int64, tolerance float64) bool {
+	return float64(current) > float64(baseline)*(1+tolerance)
+}
+
+// change は基準からの変化率を返します（基準が0の場合、現在の値も0なら0、そうでなければ +Inf）
+func change(baseline, current int64) float64 {
+	if baseline == 0 {
+		if current == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(current-baseline) / float64(baseline)
+}
+
+// Failed は悪化したベンチマーク、または実行されなかったベンチマークがあるかを返します
+func (r Report) Failed() bool {
+	for _, d := range r.Diffs {
+		if d.Status == StatusRegressed || d.Status == StatusMissing {
+			return true
+		}
+	}
+	return false
+}
+
+// Write は比較結果を w に書き込みます
+// 許容範囲を超えた指標には ✗ を付け、最後に悪化したベンチマークの数を表示します
+//
+//	  Compress/huffman  ns/op          1054094 ->      1084919     +2.9%
+//	                    allocs/op         1083 ->         1083     +0.0%
+//	✗ Compress/lz77     ns/op         19572296 ->     23620295    +20.7%
+//	                    allocs/op           27 ->           27     +0.0%
+//	+ Compress/lzp      基準なし（-update で追加してください）
+func (r Report) Write(w io.Writer) error {
+	width := 0
+	for _, d := range r.Diffs {
+		width = max(width, len(d.Name))
+	}
+
+	regressed, missing := 0, 0
+	for _, d := range r.Diffs {
+		var err error
+		switch d.Status {
+		case StatusNew:
+			_, err = fmt.Fprintf(w, "+ %-*s  基準なし（-update で追加してください）\n", width, d.Name)
+		case StatusMissing:
+			missing++
+			_, err = fmt.Fprintf(w, "- %-*s  実行されませんでした（削除した場合は -update で基準から除いてください）\n", width, d.Name)
+		default:
+			if d.Status == StatusRegressed {
+				regressed++
+			}
+			if err = writeMetric(w, d.Name, width, "ns/op", d.Baseline.NsPerOp, d.Current.NsPerOp, d.NsRegressed); err == nil {
+				err = writeMetric(w, "", width, "allocs/op", d.Baseline.AllocsPerOp, d.Current.AllocsPerOp, d.AllocsRegressed)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if regressed == 0 && missing == 0 {
+		_, err := fmt.Fprintf(w, "✅ %d 件すべて許容範囲内です（+%.0f%%）\n", len(r.Diffs), r.Tolerance*100)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "❌ %d 件が許容範囲（+%.0f%%）を超え、%d 件が実行されませんでした\n",
+		regressed, r.Tolerance*100, missing)
+	return err
+}
+
+// writeMetric は1つの指標の比較を1行で書き込みます
+func writeMetric(w io.Writer, name string, width int, metric string, baseline, current int64, regressed bool) error {
+	mark := " "
+	if regressed {
+		mark = "✗"
+	}
+	_, err := fmt.Fprintf(w, "%s %-*s  %-9s %12d -> %12d  %+7.1f%%\n",
+		mark, width, name, metric, baseline, current, change(baseline, current)*100)
+	return err
+}
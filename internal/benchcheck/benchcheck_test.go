@@ -0,0 +1,166 @@
+package benchcheck
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExceeds(t *testing.T) {
+	tests := []struct {
+		baseline, current int64
+		tolerance         float64
+		expected          bool
+	}{
+		{1000, 1000, 0.15, false},
+		{1000, 1150, 0.15, false}, // ちょうど許容範囲の上限
+		{1000, 1151, 0.15, true},
+		{1000, 500, 0.15, false}, // 速くなった場合は失敗にしない
+		{1000, 1001, 0, true},
+		{0, 0, 0.15, false},
+		{0, 1, 0.15, true}, // 割り当てが0から増えた
+		{10, 11, 0.15, false},
+		{10, 12, 0.15, true},
+	}
+	for _, tt := range tests {
+		if got := exceeds(tt.baseline, tt.current, tt.tolerance); got != tt.expected {
+			t.Errorf("exceeds(%d, %d, %.2f) = %v, expected %v", tt.baseline, tt.current, tt.tolerance, got, tt.expected)
+		}
+	}
+
+	if c := change(1000, 1250); math.Abs(c-0.25) > 1e-12 {
+		t.Errorf("Expected change +25%%, got %f", c)
+	}
+	if c := change(0, 0); c != 0 {
+		t.Errorf("Expected no change from 0 to 0, got %f", c)
+	}
+	if c := change(0, 3); !math.IsInf(c, 1) {
+		t.Errorf("Expected +Inf change from 0, got %f", c)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := Baselines{
+		"Compress/a":   {NsPerOp: 1000, AllocsPerOp: 10},
+		"Compress/b":   {NsPerOp: 1000, AllocsPerOp: 10},
+		"Compress/c":   {NsPerOp: 1000, AllocsPerOp: 0},
+		"Decompress/a": {NsPerOp: 1000, AllocsPerOp: 10},
+	}
+	current := Baselines{
+		"Compress/a": {NsPerOp: 1100, AllocsPerOp: 10}, // 許容範囲内
+		"Compress/b": {NsPerOp: 2000, AllocsPerOp: 10}, // 遅くなった
+		"Compress/c": {NsPerOp: 900, AllocsPerOp: 1},   // 割り当てが増えた
+		"Compress/d": {NsPerOp: 500, AllocsPerOp: 1},   // 基準なし
+		// Decompress/a は実行されなかった
+	}
+
+	report := Compare(baseline, current, 0.15)
+
+	var names []string
+	statuses := make(map[string]Status)
+	for _, d := range report.Diffs {
+		names = append(names, d.Name)
+		statuses[d.Name] = d.Status
+	}
+	expectedNames := []string{"Compress/a", "Compress/b", "Compress/c", "Compress/d", "Decompress/a"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected diffs in name order %v, got %v", expectedNames, names)
+	}
+	expectedStatuses := map[string]Status{
+		"Compress/a":   StatusOK,
+		"Compress/b":   StatusRegressed,
+		"Compress/c":   StatusRegressed,
+		"Compress/d":   StatusNew,
+		"Decompress/a": StatusMissing,
+	}
+	if !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("Expected statuses %v, got %v", expectedStatuses, statuses)
+	}
+	if d := report.Diffs[2]; d.NsRegressed || !d.AllocsRegressed {
+		t.Errorf("Expected only allocs/op to regress for Compress/c, got %+v", d)
+	}
+	if !report.Failed() {
+		t.Error("Expected report to fail")
+	}
+
+	// 新しいベンチマークだけなら失敗にしない
+	onlyNew := Compare(Baselines{}, Baselines{"Compress/a": {NsPerOp: 1}}, 0.15)
+	if onlyNew.Failed() {
+		t.Error("New benchmarks should not fail the check")
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	baseline := Baselines{
+		"Compress/fast": {NsPerOp: 1000, AllocsPerOp: 2},
+		"Compress/slow": {NsPerOp: 1000, AllocsPerOp: 2},
+		"Compress/gone": {NsPerOp: 1000, AllocsPerOp: 2},
+	}
+	current := Baselines{
+		"Compress/fast": {NsPerOp: 900, AllocsPerOp: 2},
+		"Compress/slow": {NsPerOp: 1250, AllocsPerOp: 2},
+		"Compress/new":  {NsPerOp: 100, AllocsPerOp: 0},
+	}
+
+	var buf bytes.Buffer
+	if err := Compare(baseline, current, 0.15).Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"✗ Compress/slow  ns/op",
+		"+25.0%",
+		"  Compress/fast  ns/op",
+		"-10.0%",
+		"+ Compress/new",
+		"- Compress/gone",
+		"1 件が許容範囲（+15%）を超え、1 件が実行されませんでした",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "✗") != 1 {
+		t.Errorf("Expected exactly one regressed metric:\n%s", out)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bench", "baselines.json")
+	b := Baselines{
+		"Compress/rle":   {NsPerOp: 64006, AllocsPerOp: 10},
+		"Decompress/rle": {NsPerOp: 41627, AllocsPerOp: 1},
+	}
+
+	if err := Save(path, b); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, b) {
+		t.Errorf("Expected %v, got %v", b, loaded)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"ns_per_op": 64006`) {
+		t.Errorf("Unexpected file format:\n%s", data)
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestRun_UnknownAlgorithm(t *testing.T) {
+	if _, err := Run([]string{"no-such-algorithm"}, nil); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
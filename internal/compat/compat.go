@@ -0,0 +1,261 @@
+// Package compat keeps compressed fixtures that detect format drift.
+// 各アルゴリズム、.tzz コンテナ、ブロックコンテナの形式バージョンごとに、小さな圧縮済み
+// データ（フィクスチャ）を testdata/compat/ に保存し、以後のビルドでも同じ内容に展開
+// できることをテストで確認します。形式を変更するときは互換性を保つか、形式バージョンを
+// 上げて新しいフィクスチャを追加します。既存のフィクスチャは書き換えません。
+package compat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+
+	// フィクスチャの生成と検証で、登録済みの全アルゴリズムを対象にする
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+// ManifestName はフィクスチャのディレクトリにあるマニフェストのファイル名です
+const ManifestName = "manifest.json"
+
+// blockSize はブロックコンテナのフィクスチャのブロックサイズです
+// 小さな入力でも複数のブロックと、圧縮・無圧縮の両方の格納方式が現れる大きさにします
+const blockSize = 128
+
+// Manifest はフィクスチャのパス（ディレクトリからの相対パス、/ 区切り）から
+// 展開結果の SHA-256（16進）への対応です
+//
+// パスは形式ごとに次の形で、v の後の数字は生成したときの形式バージョンです。
+//
+//	algo/<登録名>/v<形式バージョン>/<入力名>.bin
+//	container/v<コンテナのバージョン>/<登録名>.tzz
+//	blocks/v<ブロックコンテナのバージョン>/<登録名>.bin
+type Manifest map[string]string
+
+// Input はフィクスチャの元データの1つです
+type Input struct {
+	Name string
+	Data []byte
+}
+
+// Inputs はフィクスチャの元データを返します（それぞれ数百バイト以下）
+func Inputs() []Input {
+	return []Input{
+		{Name: "empty", Data: []byte{}},
+		{Name: "text", Data: bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 6)},
+		{Name: "runs", Data: append([]byte("aaaaabbbbccccddddAAAAAAAAAAAAAAAAAAAAzzzzzzzzzz"), bytes.Repeat([]byte{'x'}, 200)...)},
+		{Name: "binary", Data: testcorpus.Random(256, 1)},
+	}
+}
+
+// fixture は現在の形式で生成できるフィクスチャの1つです
+type fixture struct {
+	path     string
+	original []byte
+	encode   func() ([]byte, error)
+}
+
+// fixtures は登録済みの全アルゴリズムについて、現在の形式のフィクスチャを列挙します
+func fixtures() ([]fixture, error) {
+	inputs := Inputs()
+	text := inputs[1].Data
+	// ブロックコンテナには ModeZero になる0の領域も含める
+	mixed := append(append([]byte(nil), text...), make([]byte, blocks.MinZeroRun)...)
+	mixed = append(mixed, inputs[3].Data...)
+
+	var result []fixture
+	for _, name := range common.Names() {
+		c, err := common.New(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, input := range inputs {
+			result = append(result, fixture{
+				path:     fmt.Sprintf("algo/%s/v%d/%s.bin", name, common.FormatVersion(c), input.Name),
+				original: input.Data,
+				encode:   func() ([]byte, error) { return c.Compress(input.Data) },
+			})
+		}
+
+		// 空のメンバーも含める
+		result = append(result, fixture{
+			path:     fmt.Sprintf("container/v%d/%s.tzz", container.Version, name),
+			original: text,
+			encode: func() ([]byte, error) {
+				member, err := container.EncodeMember(name, c, text)
+				if err != nil {
+					return nil, err
+				}
+				empty, err := container.EncodeMember(name, c, nil)
+				if err != nil {
+					return nil, err
+				}
+				return append(member, empty...), nil
+			},
+		})
+
+		result = append(result, fixture{
+			path:     fmt.Sprintf("blocks/v%d/%s.bin", blocks.Version, name),
+			original: mixed,
+			encode:   func() ([]byte, error) { return blocks.CompressAdaptive(mixed, c, blockSize) },
+		})
+	}
+	return result, nil
+}
+
+// LoadManifest は dir のマニフェストを読み込みます
+func LoadManifest(dir string) (Manifest, error) {
+	path := filepath.Join(dir, ManifestName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Generate は dir のマニフェストにない現在の形式のフィクスチャを生成し、追加したパスを返します
+// マニフェストにあるフィクスチャはそのまま残し、マニフェストにないのにファイルが既に
+// ある場合はエラーにします（古い形式のフィクスチャを上書きしないため）。
+func Generate(dir string) ([]string, error) {
+	manifest, err := LoadManifest(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		manifest = make(Manifest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	list, err := fixtures()
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, f := range list {
+		if _, ok := manifest[f.path]; ok {
+			continue
+		}
+		if err = generate(dir, f); err != nil {
+			break
+		}
+		manifest[f.path] = digest(f.original)
+		added = append(added, f.path)
+	}
+
+	// 途中で失敗しても、書き込んだフィクスチャはマニフェストに記録する
+	if len(added) > 0 {
+		err = errors.Join(err, saveManifest(dir, manifest))
+	}
+	return added, err
+}
+
+// generate はフィクスチャを1つ生成して書き込みます
+func generate(dir string, f fixture) error {
+	data, err := f.encode()
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	// 生成したフィクスチャが今の実装で展開できなければ記録しない
+	if decoded, err := Decode(f.path, data); err != nil || !bytes.Equal(decoded, f.original) {
+		return fmt.Errorf("%s: round trip failed: %v", f.path, err)
+	}
+	return fileutil.WriteFile(filepath.Join(dir, filepath.FromSlash(f.path)), data, fileutil.Options{MkdirAll: true})
+}
+
+// saveManifest はマニフェストを書き込みます（キーは名前順に並びます）
+func saveManifest(dir string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(filepath.Join(dir, ManifestName), append(data, '\n'),
+		fileutil.Options{MkdirAll: true, Overwrite: true})
+}
+
+// Missing は現在の形式のフィクスチャのうち、マニフェストにないもののパスを返します
+// 形式バージョンを上げたのにフィクスチャを生成していない場合に空でなくなります。
+func Missing(m Manifest) ([]string, error) {
+	list, err := fixtures()
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, f := range list {
+		if _, ok := m[f.path]; !ok {
+			missing = append(missing, f.path)
+		}
+	}
+	return missing, nil
+}
+
+// Decode はフィクスチャをパスが表す形式で展開します
+func Decode(path string, data []byte) ([]byte, error) {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "algo":
+		c, err := common.New(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return c.Decompress(data)
+	case len(parts) == 3 && parts[0] == "container":
+		return container.Decompress(data, common.New, common.DecompressOptions{})
+	case len(parts) == 3 && parts[0] == "blocks":
+		c, err := common.New(strings.TrimSuffix(parts[2], ".bin"))
+		if err != nil {
+			return nil, err
+		}
+		return blocks.Decompress(data, c)
+	default:
+		return nil, fmt.Errorf("unknown fixture path: %s", path)
+	}
+}
+
+// Verify は dir のマニフェストにあるすべてのフィクスチャを展開し、SHA-256を確認します
+// 失敗したフィクスチャごとのエラーをまとめて返します。
+func Verify(dir string, m Manifest) error {
+	var errs []error
+	for path, expected := range m {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		decoded, err := Decode(path, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if got := digest(decoded); got != expected {
+			errs = append(errs, fmt.Errorf("%s: sha256 mismatch: expected %s, got %s", path, expected, got))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// digest は data の SHA-256 を16進で返します
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package compat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+)
+
+// fixtureDir はリポジトリに保存したフィクスチャのディレクトリです
+const fixtureDir = "../../testdata/compat"
+
+func TestFixtures_Decode(t *testing.T) {
+	manifest, err := LoadManifest(fixtureDir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if err := Verify(fixtureDir, manifest); err != nil {
+		t.Errorf("Fixtures produced by an earlier build no longer decode:\n%v", err)
+	}
+}
+
+func TestFixtures_CoverCurrentVersions(t *testing.T) {
+	manifest, err := LoadManifest(fixtureDir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	missing, err := Missing(manifest)
+	if err != nil {
+		t.Fatalf("Missing failed: %v", err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("No fixtures for the current format versions (run go run ./internal/genfixtures):\n%s",
+			strings.Join(missing, "\n"))
+	}
+}
+
+func TestGenerate_KeepsExistingFixtures(t *testing.T) {
+	dir := t.TempDir()
+
+	added, err := Generate(dir)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(added) == 0 {
+		t.Fatal("Expected fixtures to be added to an empty directory")
+	}
+
+	// 既存のフィクスチャは内容に関係なく書き換えない
+	path := filepath.Join(dir, filepath.FromSlash(added[0]))
+	if err := os.WriteFile(path, []byte("old format"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added, err = Generate(dir)
+	if err != nil || len(added) != 0 {
+		t.Errorf("Expected nothing to be added, got %v, %v", added, err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, []byte("old format")) {
+		t.Error("Generate overwrote an existing fixture")
+	}
+}
+
+func TestGenerate_RefusesUnlistedFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Generate(dir); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// マニフェストから消えていても、ファイルがあれば上書きしない
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	const path = "algo/rle/v0/text.bin"
+	delete(manifest, path)
+	if err := saveManifest(dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(dir); !errors.Is(err, fileutil.ErrExists) {
+		t.Errorf("Expected ErrExists, got %v", err)
+	}
+}
+
+func TestVerify_DetectsDrift(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Generate(dir); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if err := Verify(dir, manifest); err != nil {
+		t.Fatalf("Expected freshly generated fixtures to verify, got %v", err)
+	}
+
+	manifest["algo/rle/v0/text.bin"] = digest([]byte("something else"))
+	err = Verify(dir, manifest)
+	if err == nil || !strings.Contains(err.Error(), "algo/rle/v0/text.bin: sha256 mismatch") {
+		t.Errorf("Expected sha256 mismatch, got %v", err)
+	}
+}
+
+func TestDecode_UnknownPath(t *testing.T) {
+	if _, err := Decode("zip/v1/a.bin", nil); err == nil {
+		t.Error("Expected error for unknown fixture path")
+	}
+}
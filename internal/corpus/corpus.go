@@ -0,0 +1,305 @@
+// Package corpus downloads well-known compression corpora into a local cache.
+// Canterbury Corpus などの公開コーパスはリポジトリに含めず、必要になったときに
+// HTTPSでアーカイブをダウンロードし、固定したSHA-256と一致した場合だけキャッシュに
+// 保存して展開します。ネットワークを使うのは Cache.Fetch を呼んだときだけで、
+// キャッシュにあるアーカイブは使うたびにチェックサムを確認します。
+package corpus
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDownloadSize はダウンロードするアーカイブの最大サイズです
+// 既知のコーパスは最大でも数MBなので、異常に大きな応答はチェックサムを計算する前に止めます。
+const maxDownloadSize = 64 << 20
+
+// downloadTimeout は Client が nil の場合のダウンロードのタイムアウトです
+const downloadTimeout = 5 * time.Minute
+
+var (
+	// ErrUnknownCorpus は登録されていないコーパス名を表します
+	ErrUnknownCorpus = errors.New("corpus: unknown corpus")
+
+	// ErrNotPinned はチェックサムが固定されていないコーパスを表します（ダウンロードしません）
+	ErrNotPinned = errors.New("corpus: checksum not pinned")
+
+	// ErrNotCached はオフラインでキャッシュにないコーパスを表します
+	ErrNotCached = errors.New("corpus: not cached")
+
+	// ErrChecksumMismatch はダウンロードしたアーカイブのSHA-256が固定した値と異なることを表します
+	ErrChecksumMismatch = errors.New("corpus: checksum mismatch")
+)
+
+// Corpus は1つのアーカイブ（.tar.gz）で配布されているコーパスです
+type Corpus struct {
+	Name        string // コマンドラインで指定する名前（例: canterbury）
+	Description string // 一覧に表示する説明
+	URL         string // アーカイブのURL（https のみ）
+	SHA256      string // アーカイブのSHA-256（16進数、空の場合はダウンロードしない）
+}
+
+// File はコーパスに含まれる1つのファイルです
+type File struct {
+	Name string // アーカイブ内のファイル名（ディレクトリを除く）
+	Path string // キャッシュに展開したファイルのパス
+	Data []byte
+}
+
+//go:embed checksums.txt
+var checksums string
+
+// corpora は既知のコーパスです（SHA256 は checksums.txt から設定します）
+var corpora = pin([]Corpus{
+	{
+		Name:        "canterbury",
+		Description: "Canterbury Corpus（英文、HTML、ソースコード、表計算、実行ファイルなど11ファイル、約2.7MB）",
+		URL:         "https://corpus.canterbury.ac.nz/resources/cantrbry.tar.gz",
+	},
+	{
+		Name:        "large",
+		Description: "Canterbury Large Corpus（E.coli、聖書、世界年鑑の3ファイル、約11MB）",
+		URL:         "https://corpus.canterbury.ac.nz/resources/large.tar.gz",
+	},
+	{
+		Name:        "calgary",
+		Description: "Calgary Corpus（論文、書籍、プログラム、画像など18ファイル、約3.1MB）",
+		URL:         "https://corpus.canterbury.ac.nz/resources/calgary.tar.gz",
+	},
+}, checksums)
+
+// pin は sha256sum 形式の sums から、アーカイブのファイル名が一致するコーパスの SHA256 を設定します
+func pin(list []Corpus, sums string) []Corpus {
+	pinned := make(map[string]string)
+	for _, line := range strings.Split(sums, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) == 2 {
+			pinned[fields[1]] = strings.ToLower(fields[0])
+		}
+	}
+	for i := range list {
+		list[i].SHA256 = pinned[archiveName(list[i].URL)]
+	}
+	return list
+}
+
+// All は既知のコーパスを名前の順に返します
+func All() []Corpus {
+	list := append([]Corpus(nil), corpora...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup は名前（大文字小文字は区別しない）が一致する既知のコーパスを返します
+func Lookup(name string) (Corpus, error) {
+	return Find(corpora, name)
+}
+
+// Find は list から名前（大文字小文字は区別しない）が一致するコーパスを返します
+func Find(list []Corpus, name string) (Corpus, error) {
+	for _, c := range list {
+		if strings.EqualFold(c.Name, name) {
+			return c, nil
+		}
+	}
+	return Corpus{}, fmt.Errorf("%w: %s", ErrUnknownCorpus, name)
+}
+
+// DefaultDir はユーザーのキャッシュディレクトリ（os.UserCacheDir）内の保存先を返します
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tinyzipzap", "corpus"), nil
+}
+
+// Cache はコーパスのアーカイブとその展開結果を保存するディレクトリです
+// Dir/<コーパス名>/ にアーカイブと展開したファイルを置きます。
+type Cache struct {
+	Dir     string       // 保存先（空の場合は DefaultDir）
+	Client  *http.Client // ダウンロードに使うクライアント（nil の場合はタイムアウト付きの既定値）
+	Offline bool         // ダウンロードせず、キャッシュにあるものだけを使う
+}
+
+// Fetch は c のファイルを名前の順に返します
+// キャッシュにアーカイブがなければダウンロードし（Offline の場合は ErrNotCached）、
+// SHA-256 が固定した値と一致したものだけを保存します。キャッシュにあるアーカイブも
+// 毎回確認し、一致しなければ削除して ErrChecksumMismatch を返します。
+func (cache *Cache) Fetch(ctx context.Context, c Corpus) ([]File, error) {
+	if c.SHA256 == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotPinned, c.Name)
+	}
+	dir, err := cache.dir(c)
+	if err != nil {
+		return nil, err
+	}
+	archive := filepath.Join(dir, archiveName(c.URL))
+
+	data, err := os.ReadFile(archive)
+	switch {
+	case err == nil:
+		if err := checkSum(data, c); err != nil {
+			os.Remove(archive)
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	case cache.Offline:
+		return nil, fmt.Errorf("%w: %s", ErrNotCached, c.Name)
+	default:
+		if data, err = cache.download(ctx, c); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFile(archive, data); err != nil {
+			return nil, err
+		}
+	}
+	return extract(data, dir)
+}
+
+// dir はコーパスを保存するディレクトリを返します
+func (cache *Cache) dir(c Corpus) (string, error) {
+	root := cache.Dir
+	if root == "" {
+		var err error
+		if root, err = DefaultDir(); err != nil {
+			return "", fmt.Errorf("corpus: cache directory: %w", err)
+		}
+	}
+	return filepath.Join(root, c.Name), nil
+}
+
+// download は c のアーカイブをダウンロードし、チェックサムを確認します
+func (cache *Cache) download(ctx context.Context, c Corpus) ([]byte, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme != "https" {
+		return nil, fmt.Errorf("corpus: %s: only https URLs are allowed: %s", c.Name, c.URL)
+	}
+	client := cache.Client
+	if client == nil {
+		client = &http.Client{Timeout: downloadTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("corpus: %s: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("corpus: %s: %s", c.Name, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("corpus: %s: %w", c.Name, err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("corpus: %s: archive exceeds %d bytes", c.Name, maxDownloadSize)
+	}
+	if err := checkSum(data, c); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkSum は data のSHA-256が c の固定した値と一致するか確認します
+func checkSum(data []byte, c Corpus) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(c.SHA256) {
+		return fmt.Errorf("%w: %s: got %s, want %s", ErrChecksumMismatch, c.Name, got, c.SHA256)
+	}
+	return nil
+}
+
+// extract はアーカイブの通常のファイルを dir に展開し、名前の順に返します
+// 展開済みで同じサイズのファイルは書き込みません。
+func extract(archive []byte, dir string) ([]File, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("corpus: %w", err)
+	}
+	tr := tar.NewReader(bufio.NewReader(gz))
+	var files []File
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corpus: %w", err)
+		}
+		name := path.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("corpus: %s: %w", hdr.Name, err)
+		}
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err != nil || info.Size() != int64(len(data)) {
+			if err := writeFile(p, data); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, File{Name: name, Path: p, Data: data})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// writeFile は一時ファイルに書き込んでから置き換えます（途中で止まっても壊れたファイルを残しません）
+func writeFile(p string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// archiveName はURLのパスの最後の要素（アーカイブのファイル名）を返します
+func archiveName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
@@ -0,0 +1,177 @@
+package corpus
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeArchive は files を含む .tar.gz を作成します（ディレクトリのエントリも含めます）
+func fakeArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func sum(data []byte) string {
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+// newServer は archive を返すHTTPSのテストサーバーと、リクエストの回数を返します
+func newServer(t *testing.T, archive []byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/resources/fake.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCache_Fetch(t *testing.T) {
+	archive := fakeArchive(t, map[string]string{"alice.txt": "alice was beginning", "kennedy.xls": "\x00\x01\x02"})
+	srv, requests := newServer(t, archive)
+	c := Corpus{Name: "fake", URL: srv.URL + "/resources/fake.tar.gz", SHA256: sum(archive)}
+	cache := &Cache{Dir: t.TempDir(), Client: srv.Client()}
+
+	files, err := cache.Fetch(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "alice.txt" || files[1].Name != "kennedy.xls" {
+		t.Fatalf("Unexpected files %+v", files)
+	}
+	for _, f := range files {
+		onDisk, err := os.ReadFile(f.Path)
+		if err != nil || !bytes.Equal(onDisk, f.Data) {
+			t.Errorf("%s: expected the extracted file at %s (err %v)", f.Name, f.Path, err)
+		}
+	}
+
+	// 2回目以降はキャッシュを使い、オフラインでも読める
+	cache.Offline = true
+	again, err := cache.Fetch(context.Background(), c)
+	if err != nil || len(again) != 2 || string(again[0].Data) != "alice was beginning" {
+		t.Errorf("Expected the cached files offline, got %+v (err %v)", again, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 download, got %d", n)
+	}
+}
+
+func TestCache_FetchErrors(t *testing.T) {
+	archive := fakeArchive(t, map[string]string{"a.txt": "aaa"})
+	srv, requests := newServer(t, archive)
+	good := Corpus{Name: "fake", URL: srv.URL + "/resources/fake.tar.gz", SHA256: sum(archive)}
+
+	tests := []struct {
+		name    string
+		corpus  Corpus
+		offline bool
+		want    error
+	}{
+		{"not pinned", Corpus{Name: "fake", URL: good.URL}, false, ErrNotPinned},
+		{"offline", good, true, ErrNotCached},
+		{"mismatch", Corpus{Name: "fake", URL: good.URL, SHA256: sum([]byte("other"))}, false, ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		cache := &Cache{Dir: t.TempDir(), Client: srv.Client(), Offline: tt.offline}
+		_, err := cache.Fetch(context.Background(), tt.corpus)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		// 失敗したアーカイブはキャッシュに残さない
+		if entries, _ := os.ReadDir(filepath.Join(cache.Dir, "fake")); len(entries) != 0 {
+			t.Errorf("%s: expected nothing cached, got %d entries", tt.name, len(entries))
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected only the mismatch case to download, got %d requests", n)
+	}
+
+	// https 以外のURLと、エラーの応答
+	cache := &Cache{Dir: t.TempDir(), Client: srv.Client()}
+	plain := good
+	plain.URL = "http" + good.URL[len("https"):]
+	if _, err := cache.Fetch(context.Background(), plain); err == nil {
+		t.Error("Expected an error for a plain http URL")
+	}
+	missing := good
+	missing.URL = srv.URL + "/resources/missing.tar.gz"
+	if _, err := cache.Fetch(context.Background(), missing); err == nil {
+		t.Error("Expected an error for 404")
+	}
+}
+
+func TestCache_CorruptCache(t *testing.T) {
+	// キャッシュのアーカイブが書き換えられていたら使わずに削除する
+	archive := fakeArchive(t, map[string]string{"a.txt": "aaa"})
+	c := Corpus{Name: "fake", URL: "https://example.invalid/fake.tar.gz", SHA256: sum(archive)}
+	cache := &Cache{Dir: t.TempDir(), Offline: true}
+	path := filepath.Join(cache.Dir, "fake", "fake.tar.gz")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, append(archive, 0), 0644)
+
+	if _, err := cache.Fetch(context.Background(), c); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the corrupt archive to be removed")
+	}
+
+	os.WriteFile(path, archive, 0644)
+	if files, err := cache.Fetch(context.Background(), c); err != nil || len(files) != 1 {
+		t.Errorf("Expected the pre-cached archive to be used, got %v (err %v)", files, err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, err := Lookup("Canterbury")
+	if err != nil || c.Name != "canterbury" {
+		t.Fatalf("Lookup failed: %+v (err %v)", c, err)
+	}
+	if _, err := Lookup("nope"); !errors.Is(err, ErrUnknownCorpus) {
+		t.Errorf("Expected ErrUnknownCorpus, got %v", err)
+	}
+	for _, c := range All() {
+		if archiveName(c.URL) == "" || c.URL[:8] != "https://" {
+			t.Errorf("%s: unexpected URL %s", c.Name, c.URL)
+		}
+	}
+
+	list := pin([]Corpus{{Name: "x", URL: "https://example.invalid/r/x.tar.gz"}}, "# comment\nABCD  x.tar.gz\n")
+	if list[0].SHA256 != "abcd" {
+		t.Errorf("Expected the pinned checksum, got %q", list[0].SHA256)
+	}
+}
@@ -0,0 +1,273 @@
+// Package corrupt keeps malformed payloads that decoders must reject safely.
+// ファジングや不正なデータのテストで見つかった入力を、アルゴリズムごとに
+// testdata/corrupt/<登録名>/<名前>.bin に保存し、期待するエラーの分類を同じディレクトリの
+// expectations.json に記録します。共通のテストがすべての入力を展開し、パニックせず、
+// 期待した分類のエラーを、時間とメモリの上限内で返すことを確認します。
+// 保存した入力とは別に、正しい圧縮データを1バイトずつ書き換えた入力も同じ上限で展開します。
+// 入力の追加には go run ./internal/addcorrupt を使います。
+package corrupt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+
+	// 登録済みの全アルゴリズムの入力を展開する
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+// ExpectationsName はアルゴリズムのディレクトリにある期待値のファイル名です
+const ExpectationsName = "expectations.json"
+
+// 展開の上限
+// 数百バイトの壊れた入力で、これを超える時間やメモリを使う展開は不具合とみなします。
+const (
+	// MaxOutputSize は展開結果の最大サイズです（common.ErrOutputTooLarge になります）
+	MaxOutputSize = 16 << 20
+
+	// Timeout は1つの入力を展開する時間の上限です
+	Timeout = 5 * time.Second
+
+	// MaxAllocated は1つの入力の展開で確保してよいメモリの合計です
+	MaxAllocated = 64 << 20
+)
+
+// Category は展開の結果の分類です
+type Category string
+
+const (
+	Invalid            Category = "invalid-data"        // common.ErrInvalidData
+	Corrupted          Category = "corrupted"           // common.ErrCorrupted
+	OutputTooLarge     Category = "output-too-large"    // common.ErrOutputTooLarge
+	BudgetExceeded     Category = "budget-exceeded"     // common.ErrBudgetExceeded
+	UnsupportedVersion Category = "unsupported-version" // *common.ErrUnsupportedVersion
+	Other              Category = "other"               // 上のどれでもないエラー
+	Decoded            Category = "ok"                  // エラーにならずに展開できた
+
+	// 以下は期待値として記録できません（常に不具合です）
+	Panic     Category = "panic"
+	TimedOut  Category = "timeout"
+	TooHungry Category = "memory"
+)
+
+// Acceptable は c が期待値として記録できる分類かどうかを返します
+func (c Category) Acceptable() bool {
+	switch c {
+	case Invalid, Corrupted, OutputTooLarge, BudgetExceeded, UnsupportedVersion, Other, Decoded:
+		return true
+	}
+	return false
+}
+
+// Classify は展開のエラーを分類します
+func Classify(err error) Category {
+	var version *common.ErrUnsupportedVersion
+	switch {
+	case err == nil:
+		return Decoded
+	case errors.As(err, &version):
+		return UnsupportedVersion
+	case errors.Is(err, common.ErrOutputTooLarge):
+		return OutputTooLarge
+	case errors.Is(err, common.ErrBudgetExceeded):
+		return BudgetExceeded
+	case errors.Is(err, common.ErrCorrupted):
+		return Corrupted
+	case errors.Is(err, common.ErrInvalidData):
+		return Invalid
+	default:
+		return Other
+	}
+}
+
+// Result は1つの入力を展開した結果です
+type Result struct {
+	Category  Category
+	Err       error         // 展開のエラー（パニックの場合はその値）
+	Duration  time.Duration // 展開にかかった時間
+	Allocated uint64        // 展開で確保したメモリの合計（他のゴルーチンの確保も含みます）
+}
+
+// Run は登録名 algo のアルゴリズムで data を上限付きで展開し、結果を分類します
+// パニックは Panic に、Timeout を超えた場合は TimedOut に、MaxAllocated を超えて
+// 確保した場合は TooHungry になります。Timeout を超えた展開のゴルーチンは止められないため、
+// 終わるまで残ります。
+func Run(algo string, data []byte) (Result, error) {
+	c, err := common.New(algo)
+	if err != nil {
+		return Result{}, err
+	}
+	return run(c, data), nil
+}
+
+// run は c で data を展開した結果を分類します
+func run(c common.Compressor, data []byte) Result {
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	done := make(chan Result, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- Result{Category: Panic, Err: fmt.Errorf("panic: %v", v)}
+			}
+		}()
+		_, err := common.DecompressWithOptions(c, data, common.DecompressOptions{MaxOutputSize: MaxOutputSize})
+		done <- Result{Category: Classify(err), Err: err}
+	}()
+
+	var res Result
+	select {
+	case res = <-done:
+	case <-time.After(Timeout):
+		res = Result{Category: TimedOut, Err: fmt.Errorf("no result after %v", Timeout)}
+	}
+	res.Duration = time.Since(start)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	res.Allocated = after.TotalAlloc - before.TotalAlloc
+	if res.Category != Panic && res.Category != TimedOut && res.Allocated > MaxAllocated {
+		res.Err = fmt.Errorf("allocated %d bytes (limit %d), then: %v", res.Allocated, MaxAllocated, res.Err)
+		res.Category = TooHungry
+	}
+	return res
+}
+
+// Expectations は入力の名前（.bin を除く）から期待する分類への対応です
+type Expectations map[string]Category
+
+// Case は保存された1つの入力です
+type Case struct {
+	Algorithm string
+	Name      string
+	Path      string
+	Expected  Category // 期待値がない入力は空
+}
+
+// Load は dir のすべてのアルゴリズムの入力と期待値を読み込みます
+// 期待値のない入力は Expected が空の Case に、入力のない期待値はエラーになります。
+func Load(dir string) ([]Case, error) {
+	algos, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, a := range algos {
+		if !a.IsDir() {
+			continue
+		}
+		algoDir := filepath.Join(dir, a.Name())
+		expected, err := LoadExpectations(algoDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		files, err := filepath.Glob(filepath.Join(algoDir, "*.bin"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range files {
+			name := filepath.Base(path)
+			name = name[:len(name)-len(".bin")]
+			seen[name] = true
+			cases = append(cases, Case{Algorithm: a.Name(), Name: name, Path: path, Expected: expected[name]})
+		}
+		for name := range expected {
+			if !seen[name] {
+				return nil, fmt.Errorf("%s: %s.bin is missing", filepath.Join(algoDir, ExpectationsName), name)
+			}
+		}
+	}
+	return cases, nil
+}
+
+// LoadExpectations はアルゴリズムのディレクトリの期待値を読み込みます
+func LoadExpectations(algoDir string) (Expectations, error) {
+	path := filepath.Join(algoDir, ExpectationsName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Expectations
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Add は data を dir/<algo>/<name>.bin に保存し、期待値に category を記録します
+// category が空の場合は今の実装で展開した分類を記録します。既にある名前や、
+// 期待値として記録できない分類（パニックなど）はエラーにします。記録した分類を返します。
+func Add(dir, algo, name string, data []byte, category Category) (Category, error) {
+	if name == "" || filepath.Base(name) != name || filepath.Ext(name) != "" {
+		return "", fmt.Errorf("invalid case name %q (no directories or extensions)", name)
+	}
+	if category == "" {
+		res, err := Run(algo, data)
+		if err != nil {
+			return "", err
+		}
+		category = res.Category
+	} else if _, err := common.New(algo); err != nil {
+		return "", err
+	}
+	if !category.Acceptable() {
+		return category, fmt.Errorf("%s/%s: %s cannot be recorded as an expectation; fix the decoder or pass the expected category", algo, name, category)
+	}
+
+	algoDir := filepath.Join(dir, algo)
+	expected, err := LoadExpectations(algoDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		expected = make(Expectations)
+	} else if err != nil {
+		return "", err
+	}
+	if _, ok := expected[name]; ok {
+		return "", fmt.Errorf("%s/%s already exists", algo, name)
+	}
+	if err := fileutil.WriteFile(filepath.Join(algoDir, name+".bin"), data, fileutil.Options{MkdirAll: true}); err != nil {
+		return "", err
+	}
+	expected[name] = category
+	return category, saveExpectations(algoDir, expected)
+}
+
+// saveExpectations は期待値を書き込みます（キーは名前順に並びます）
+func saveExpectations(algoDir string, e Expectations) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(filepath.Join(algoDir, ExpectationsName), append(data, '\n'),
+		fileutil.Options{MkdirAll: true, Overwrite: true})
+}
+
+// Names は cases のアルゴリズム名を重複なく名前順に返します
+func Names(cases []Case) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, c := range cases {
+		if !seen[c.Algorithm] {
+			seen[c.Algorithm] = true
+			names = append(names, c.Algorithm)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
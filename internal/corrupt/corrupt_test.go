@@ -0,0 +1,165 @@
+package corrupt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// corruptDir はリポジトリに保存した壊れた入力のディレクトリです
+const corruptDir = "../../testdata/corrupt"
+
+func TestCorpus_Decode(t *testing.T) {
+	cases, err := Load(corruptDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("Expected cases in " + corruptDir)
+	}
+	for _, c := range cases {
+		t.Run(c.Algorithm+"/"+c.Name, func(t *testing.T) {
+			if c.Expected == "" {
+				t.Fatalf("No expectation for %s (add it with go run ./internal/addcorrupt)", c.Path)
+			}
+			data, err := os.ReadFile(c.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := Run(c.Algorithm, data)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if res.Category != c.Expected {
+				t.Errorf("Expected %s, got %s (%v)", c.Expected, res.Category, res.Err)
+			}
+		})
+	}
+}
+
+func TestCorpus_CoversAlgorithms(t *testing.T) {
+	cases, err := Load(corruptDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	covered := make(map[string]bool)
+	for _, name := range Names(cases) {
+		covered[name] = true
+		if _, err := common.New(name); err != nil {
+			t.Errorf("Directory %s is not a registered algorithm", name)
+		}
+	}
+	for _, name := range common.Names() {
+		if !covered[name] {
+			t.Errorf("No corrupt inputs for %s", name)
+		}
+	}
+}
+
+// mutationSamples は1バイト書き換えのテストで圧縮する入力です
+// 短い繰り返しのテキストと、ランや偏った頻度の文字を含むテキストです。
+var mutationSamples = []string{
+	"hello hello hello world",
+	"hello hello hello world\naaaaaaaaaaaaaaaa tiny zip zap 0123456789\n",
+}
+
+func TestRun_SingleByteMutations(t *testing.T) {
+	for _, name := range common.Names() {
+		t.Run(name, func(t *testing.T) {
+			c, err := common.New(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sample := range mutationSamples {
+				valid, err := c.Compress([]byte(sample))
+				if err != nil {
+					t.Fatalf("Compress failed: %v", err)
+				}
+				// 保存した壊れた入力は手で選んだものなので、すべての位置で1ビットの反転と
+				// 全ビットの反転を試し、どの入力もパニックやタイムアウトにならないことを確認する
+				for i := range valid {
+					for _, mask := range []byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0xFF} {
+						mutated := bytes.Clone(valid)
+						mutated[i] ^= mask
+						if res := run(c, mutated); !res.Category.Acceptable() {
+							t.Errorf("%q: byte %d ^ %#x: %s (%v)", sample, i, mask, res.Category, res.Err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_MissingPayload(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "rle"), 0755)
+	os.WriteFile(filepath.Join(dir, "rle", ExpectationsName), []byte(`{"gone": "invalid-data"}`), 0644)
+	if _, err := Load(dir); err == nil {
+		t.Error("Expected an error for an expectation without a payload")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	dir := t.TempDir()
+	got, err := Add(dir, "rle", "odd", []byte("a\x02b"), "")
+	if err != nil || got != Invalid {
+		t.Fatalf("Expected invalid-data, got %s (err %v)", got, err)
+	}
+	if _, err := Add(dir, "rle", "odd", []byte("a"), ""); err == nil {
+		t.Error("Expected an error for an existing name")
+	}
+	if _, err := Add(dir, "rle", "../escape", []byte("a"), ""); err == nil {
+		t.Error("Expected an error for a path in the name")
+	}
+	if _, err := Add(dir, "nope", "x", []byte("a"), ""); err == nil {
+		t.Error("Expected an error for an unknown algorithm")
+	}
+	if _, err := Add(dir, "rle", "bug", []byte("a"), Panic); err == nil {
+		t.Error("Expected panic to be rejected as an expectation")
+	}
+
+	cases, err := Load(dir)
+	if err != nil || len(cases) != 1 || cases[0].Expected != Invalid {
+		t.Errorf("Unexpected cases %+v (err %v)", cases, err)
+	}
+}
+
+// panicky はどの入力でもパニックするテスト用のアルゴリズムです
+type panicky struct{}
+
+func (panicky) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (panicky) Decompress(data []byte) ([]byte, error) { panic("index out of range") }
+func (panicky) Name() string                           { return "panicky" }
+
+func TestRun_Panic(t *testing.T) {
+	res := run(panicky{}, []byte("x"))
+	if res.Category != Panic || res.Category.Acceptable() {
+		t.Errorf("Expected an unacceptable panic result, got %s (%v)", res.Category, res.Err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Category
+	}{
+		{nil, Decoded},
+		{fmt.Errorf("x: %w", common.ErrInvalidData), Invalid},
+		{fmt.Errorf("x: %w", common.ErrCorrupted), Corrupted},
+		{fmt.Errorf("x: %w", common.ErrOutputTooLarge), OutputTooLarge},
+		{fmt.Errorf("x: %w", common.ErrBudgetExceeded), BudgetExceeded},
+		{&common.ErrUnsupportedVersion{Format: "x", Have: 9, Max: 1}, UnsupportedVersion},
+		{errors.New("x"), Other},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
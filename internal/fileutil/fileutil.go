@@ -0,0 +1,241 @@
+// Package fileutil centralizes how the CLI writes output files.
+// 出力先の確認（親ディレクトリの有無、ディレクトリの指定、既存ファイル）と
+// 親ディレクトリの作成をすべての出力で同じ方法で行い、原因ごとに区別できるエラーを返します。
+package fileutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrParentMissing は出力先の親ディレクトリが存在しない場合のエラーです
+	ErrParentMissing = errors.New("parent directory does not exist")
+
+	// ErrIsDirectory は出力先がディレクトリの場合のエラーです
+	ErrIsDirectory = errors.New("output path is a directory")
+
+	// ErrExists は上書きが許可されていないのに出力先が存在する場合のエラーです
+	ErrExists = errors.New("output file already exists")
+
+	// ErrSkipped は SkipExisting のため、既存の出力先に書き込まなかったことを表します
+	ErrSkipped = errors.New("output file already exists, skipped")
+
+	// ErrIdentical は VerifyExisting で既存の出力先が書き込む内容と同じだったため、
+	// 書き込まなかったことを表します。ErrSkipped としても判定できます
+	ErrIdentical = fmt.Errorf("%w: identical content", ErrSkipped)
+
+	// ErrDiffers は VerifyExisting で既存の出力先の内容が異なるため、書き込まなかったことを表します
+	// ErrExists としても判定できます
+	ErrDiffers = fmt.Errorf("%w: content differs", ErrExists)
+
+	// ErrPermission は出力先またはその親ディレクトリに書き込む権限がない場合のエラーです
+	// fs.ErrPermission としても判定できます
+	ErrPermission = fmt.Errorf("permission denied: %w", fs.ErrPermission)
+)
+
+const (
+	// FilePerm は出力ファイルのパーミッションです
+	FilePerm = 0644
+
+	// DirPerm は作成するディレクトリのパーミッションです
+	DirPerm = 0755
+)
+
+// Options は出力ファイルの書き込み方法です
+// 既存のファイルは、どれも指定しなければ ErrExists で拒否します。複数指定した場合は
+// Overwrite、VerifyExisting、SkipExisting の順に優先します。
+type Options struct {
+	// MkdirAll が true の場合、存在しない親ディレクトリを作成します
+	MkdirAll bool
+
+	// Overwrite が true の場合、既存のファイルを上書きします
+	Overwrite bool
+
+	// SkipExisting が true の場合、既存のファイルには書き込まずに ErrSkipped を返します
+	SkipExisting bool
+
+	// VerifyExisting が true の場合、既存のファイルと書き込む内容のチェックサムを比べ、
+	// 同じなら ErrIdentical、異なれば ErrDiffers を返します（どちらも書き込みません）
+	// 比べられるのは WriteFile と Commit だけで、Create では ErrExists になります。
+	VerifyExisting bool
+}
+
+// Prepare は path に書き込めるかを確認し、必要なら親ディレクトリを作成します
+// VerifyExisting の場合、既存のファイルは内容が分かってから WriteFile か Commit で比べます。
+func Prepare(path string, opts Options) error {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	case err == nil && !opts.VerifyExisting:
+		if err := existing(path, opts); err != nil {
+			return err
+		}
+	case err != nil && errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %s", ErrPermission, path)
+	}
+
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return fmt.Errorf("%w: %s is not a directory", ErrParentMissing, dir)
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %s", ErrPermission, dir)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	case !opts.MkdirAll:
+		return fmt.Errorf("%w: %s (use -mkdir to create it)", ErrParentMissing, dir)
+	}
+
+	if err := os.MkdirAll(dir, DirPerm); err != nil {
+		return classify(err, dir)
+	}
+	return nil
+}
+
+// existing は既存の path に書き込めない場合のエラーを返します（Overwrite なら nil）
+func existing(path string, opts Options) error {
+	switch {
+	case opts.Overwrite:
+		return nil
+	case opts.SkipExisting:
+		return fmt.Errorf("%w: %s", ErrSkipped, path)
+	default:
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	}
+}
+
+// verify は VerifyExisting で path が存在する場合に content と比べ、ErrIdentical か ErrDiffers を返します
+// 比べなかった場合（path が存在しない場合を含む）は nil を返します。
+func verify(path string, content io.Reader, opts Options) error {
+	if opts.Overwrite || !opts.VerifyExisting {
+		return nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return classify(err, path)
+	}
+	defer f.Close()
+
+	same, err := Identical(f, content)
+	switch {
+	case err != nil:
+		return err
+	case same:
+		return fmt.Errorf("%w: %s", ErrIdentical, path)
+	default:
+		return fmt.Errorf("%w: %s", ErrDiffers, path)
+	}
+}
+
+// Identical は a と b を最後まで読み、内容のチェックサム（SHA-256）が同じかを返します
+func Identical(a, b io.Reader) (bool, error) {
+	ha, hb := sha256.New(), sha256.New()
+	if _, err := io.Copy(ha, a); err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(hb, b); err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha.Sum(nil), hb.Sum(nil)), nil
+}
+
+// WriteFile は出力先を確認してから data を path に書き込みます
+func WriteFile(path string, data []byte, opts Options) error {
+	if err := Prepare(path, opts); err != nil {
+		return err
+	}
+	if err := verify(path, bytes.NewReader(data), opts); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, FilePerm); err != nil {
+		return classify(err, path)
+	}
+	return nil
+}
+
+// Create は出力先を確認してから path を書き込み用に作成します
+// CSVのように少しずつ書き込む出力に使用します。内容を比べられないため、
+// VerifyExisting の場合も既存のファイルは ErrExists で拒否します。
+func Create(path string, opts Options) (*os.File, error) {
+	opts.VerifyExisting = false
+	if err := Prepare(path, opts); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePerm)
+	if err != nil {
+		return nil, classify(err, path)
+	}
+	return f, nil
+}
+
+// Commit は書き込み終えた一時ファイル tmp で path を置き換えます
+// path が存在する場合は opts に従い、VerifyExisting なら tmp の内容と比べます。
+// 置き換えなかった場合、tmp は削除しないので呼び出し側で削除してください。
+func Commit(tmp, path string, opts Options) error {
+	if _, err := os.Stat(path); err == nil && !opts.VerifyExisting {
+		if err := existing(path, opts); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	err = verify(path, f, opts)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return classify(err, path)
+	}
+	return nil
+}
+
+// classify はOSのエラーを原因ごとのエラーに変換します
+func classify(err error, path string) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %s", ErrPermission, path)
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %s", ErrParentMissing, filepath.Dir(path))
+	default:
+		return err
+	}
+}
+
+// Append は出力先を確認してから data を path の末尾に追記し、ディスクに同期します
+// 既存のファイルへの追記なので Overwrite の設定は使いません。ファイルがなければ作成します。
+func Append(path string, data []byte, opts Options) error {
+	opts.Overwrite = true
+	if err := Prepare(path, opts); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, FilePerm)
+	if err != nil {
+		return classify(err, path)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,244 @@
+package fileutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_Matrix(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(dir string) string // 出力先のパスを返す
+		opts     Options
+		expected error
+	}{
+		{
+			name:     "parent missing",
+			setup:    func(dir string) string { return filepath.Join(dir, "results", "out.rle") },
+			opts:     Options{Overwrite: true},
+			expected: ErrParentMissing,
+		},
+		{
+			name:  "parent missing with mkdir",
+			setup: func(dir string) string { return filepath.Join(dir, "results", "nested", "out.rle") },
+			opts:  Options{MkdirAll: true},
+		},
+		{
+			name: "existing file without overwrite",
+			setup: func(dir string) string {
+				path := filepath.Join(dir, "out.rle")
+				os.WriteFile(path, []byte("old"), FilePerm)
+				return path
+			},
+			expected: ErrExists,
+		},
+		{
+			name: "existing file with overwrite",
+			setup: func(dir string) string {
+				path := filepath.Join(dir, "out.rle")
+				os.WriteFile(path, []byte("old"), FilePerm)
+				return path
+			},
+			opts: Options{Overwrite: true},
+		},
+		{
+			name: "output is a directory",
+			setup: func(dir string) string {
+				path := filepath.Join(dir, "out")
+				os.Mkdir(path, DirPerm)
+				return path
+			},
+			opts:     Options{Overwrite: true, MkdirAll: true},
+			expected: ErrIsDirectory,
+		},
+		{
+			name: "parent is a file",
+			setup: func(dir string) string {
+				parent := filepath.Join(dir, "file")
+				os.WriteFile(parent, nil, FilePerm)
+				return filepath.Join(parent, "out.rle")
+			},
+			opts:     Options{MkdirAll: true},
+			expected: ErrParentMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.setup(t.TempDir())
+			err := WriteFile(path, []byte("data"), tt.opts)
+
+			if tt.expected != nil {
+				if !errors.Is(err, tt.expected) {
+					t.Fatalf("Expected %v, got %v", tt.expected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil || string(got) != "data" {
+				t.Errorf("Unexpected content %q (err %v)", got, err)
+			}
+		})
+	}
+}
+
+func TestWriteFile_PermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+
+	dir := t.TempDir()
+	readOnly := filepath.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFile(filepath.Join(readOnly, "out.rle"), []byte("data"), Options{})
+	if !errors.Is(err, ErrPermission) || !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+	if errors.Is(err, ErrParentMissing) {
+		t.Error("Permission error must not be reported as missing parent")
+	}
+
+	err = WriteFile(filepath.Join(readOnly, "sub", "out.rle"), []byte("data"), Options{MkdirAll: true})
+	if !errors.Is(err, ErrPermission) {
+		t.Errorf("Expected permission error when creating directory, got %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "results.csv")
+
+	if _, err := Create(path, Options{}); !errors.Is(err, ErrParentMissing) {
+		t.Fatalf("Expected ErrParentMissing, got %v", err)
+	}
+
+	f, err := Create(path, Options{MkdirAll: true})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.WriteString("a,b\n")
+	f.Close()
+
+	got, _ := os.ReadFile(path)
+	if string(got) != "a,b\n" {
+		t.Errorf("Unexpected content %q", got)
+	}
+}
+
+func TestWriteFile_ExistingPolicies(t *testing.T) {
+	policies := []struct {
+		name string
+		opts Options
+		// 既存のファイルが同じ内容の場合と、異なる内容の場合の期待するエラー（nil は上書き）
+		identical, differs error
+	}{
+		{"refuse", Options{}, ErrExists, ErrExists},
+		{"overwrite", Options{Overwrite: true}, nil, nil},
+		{"skip", Options{SkipExisting: true}, ErrSkipped, ErrSkipped},
+		{"verify", Options{VerifyExisting: true}, ErrIdentical, ErrDiffers},
+		{"verify and skip", Options{VerifyExisting: true, SkipExisting: true}, ErrIdentical, ErrDiffers},
+	}
+
+	for _, p := range policies {
+		for _, existing := range []string{"data", "old"} {
+			expected := p.identical
+			if existing != "data" {
+				expected = p.differs
+			}
+			t.Run(p.name+"/"+existing, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "out.rle")
+				os.WriteFile(path, []byte(existing), FilePerm)
+
+				err := WriteFile(path, []byte("data"), p.opts)
+				got, _ := os.ReadFile(path)
+				if expected == nil {
+					if err != nil || string(got) != "data" {
+						t.Errorf("Expected overwrite, got %q (err %v)", got, err)
+					}
+					return
+				}
+				if !errors.Is(err, expected) {
+					t.Errorf("Expected %v, got %v", expected, err)
+				}
+				if string(got) != existing {
+					t.Errorf("Existing file was modified: %q", got)
+				}
+			})
+		}
+	}
+
+	// 既存のファイルがなければどの設定でも書き込む
+	path := filepath.Join(t.TempDir(), "new.rle")
+	if err := WriteFile(path, []byte("data"), Options{VerifyExisting: true}); err != nil {
+		t.Errorf("WriteFile to a new path failed: %v", err)
+	}
+	if errors.Is(ErrIdentical, ErrExists) || !errors.Is(ErrIdentical, ErrSkipped) || !errors.Is(ErrDiffers, ErrExists) {
+		t.Error("Unexpected error hierarchy for ErrIdentical / ErrDiffers")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // 空の場合は既存のファイルなし
+		opts     Options
+		expected error
+	}{
+		{name: "new file", opts: Options{}},
+		{name: "refuse", existing: "old", expected: ErrExists},
+		{name: "overwrite", existing: "old", opts: Options{Overwrite: true}},
+		{name: "skip", existing: "old", opts: Options{SkipExisting: true}, expected: ErrSkipped},
+		{name: "identical", existing: "data", opts: Options{VerifyExisting: true}, expected: ErrIdentical},
+		{name: "differs", existing: "old", opts: Options{VerifyExisting: true}, expected: ErrDiffers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "out.rle")
+			tmp := filepath.Join(dir, ".out.rle.tmp")
+			os.WriteFile(tmp, []byte("data"), FilePerm)
+			if tt.existing != "" {
+				os.WriteFile(path, []byte(tt.existing), FilePerm)
+			}
+
+			err := Commit(tmp, path, tt.opts)
+			got, _ := os.ReadFile(path)
+			if tt.expected == nil {
+				if err != nil || string(got) != "data" {
+					t.Errorf("Expected the temporary file to replace the output, got %q (err %v)", got, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if string(got) != tt.existing {
+				t.Errorf("Existing file was modified: %q", got)
+			}
+			if _, err := os.Stat(tmp); err != nil {
+				t.Errorf("Temporary file should be left for the caller: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreate_VerifyExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	os.WriteFile(path, []byte("a,b\n"), FilePerm)
+
+	// 少しずつ書き込む出力は内容を比べられないため拒否する
+	if _, err := Create(path, Options{VerifyExisting: true}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists, got %v", err)
+	}
+	if _, err := Create(path, Options{SkipExisting: true}); !errors.Is(err, ErrSkipped) {
+		t.Errorf("Expected ErrSkipped, got %v", err)
+	}
+}
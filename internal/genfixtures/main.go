@@ -0,0 +1,32 @@
+// Command genfixtures は互換性テスト用のフィクスチャを testdata/compat/ に生成します
+// 既存のフィクスチャは書き換えず、現在の形式バージョンでまだないものだけを追加します。
+// 形式バージョンを上げたときに実行し、追加されたファイルとマニフェストをコミットします。
+//
+//	go run ./internal/genfixtures
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/compat"
+)
+
+func main() {
+	dir := flag.String("dir", "testdata/compat", "フィクスチャのディレクトリ")
+	flag.Parse()
+
+	added, err := compat.Generate(*dir)
+	for _, path := range added {
+		fmt.Printf("+ %s\n", path)
+	}
+	if err != nil {
+		log.Fatalf("フィクスチャの生成エラー: %v", err)
+	}
+	if len(added) == 0 {
+		fmt.Println("✅ すべての形式バージョンのフィクスチャがあります")
+		return
+	}
+	fmt.Printf("✅ %d 件のフィクスチャを %s に追加しました\n", len(added), *dir)
+}
@@ -0,0 +1,87 @@
+// Command genprofiles は huffman.NewStaticCompressor の組み込みプロファイルの符号表を生成します
+// サンプル（<プロファイル名>.txt）ごとに huffman.BuildModel でモデルを作り、その
+// MarshalBinary の出力を Go のソースとして書き出します。サンプルを変更したら
+// pkg/huffman で go generate を実行し、生成されたファイルをコミットします。
+// プロファイルの符号を変えると既存の圧縮データを展開できなくなるため、公開後のサンプルは変更しないでください。
+//
+//	go generate ./pkg/huffman
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+)
+
+func main() {
+	dir := flag.String("dir", "testdata/profiles", "サンプルのディレクトリ")
+	out := flag.String("o", "profiles_gen.go", "出力するGoのファイル")
+	flag.Parse()
+
+	src, err := generate(*dir)
+	if err != nil {
+		log.Fatalf("プロファイルの生成エラー: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("ファイル書き込みエラー: %v", err)
+	}
+	fmt.Printf("✅ %s を生成しました\n", *out)
+}
+
+// generate は dir のサンプルからプロファイルのモデルの Go のソースを作成します
+// プロファイルは名前順に並べるため、同じサンプルからは同じソースになります。
+func generate(dir string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s にサンプルがありません", dir)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by genprofiles; DO NOT EDIT.\n\n")
+	buf.WriteString("package huffman\n\n")
+	buf.WriteString("// profileModels は組み込みのプロファイルのモデル（Model.MarshalBinary の形式）です\n")
+	buf.WriteString("// testdata/profiles/<プロファイル名>.txt のサンプルから作成しています。\n")
+	buf.WriteString("var profileModels = map[Profile][]byte{\n")
+	for _, path := range paths {
+		sample, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		model, err := huffman.BuildModel(sample)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		data, err := model.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		fmt.Fprintf(&buf, "\t// %d bytes のサンプル、%d 種類のバイト\n", len(sample), model.Symbols())
+		fmt.Fprintf(&buf, "\t%q: {\n", name)
+		for len(data) > 0 {
+			n := min(len(data), 12)
+			buf.WriteString("\t\t")
+			for _, b := range data[:n] {
+				fmt.Fprintf(&buf, "0x%02x, ", b)
+			}
+			buf.WriteString("\n")
+			data = data[n:]
+		}
+		buf.WriteString("\t},\n")
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGenerate_MatchesCommitted は生成したソースがコミット済みのファイルと一致することを確認します
+// 一致しない場合は、サンプルを変更したあとに go generate ./pkg/huffman を実行していません。
+func TestGenerate_MatchesCommitted(t *testing.T) {
+	got, err := generate("../../pkg/huffman/testdata/profiles")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	want, err := os.ReadFile("../../pkg/huffman/profiles_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pkg/huffman/profiles_gen.go is stale; run go generate ./pkg/huffman")
+	}
+}
+
+func TestGenerate_NoSamples(t *testing.T) {
+	if _, err := generate(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory without samples")
+	}
+}
@@ -0,0 +1,36 @@
+// Package golden はテストの出力を testdata の golden ファイルと比べます。
+// 表示用の関数（Fprint...）の出力を固定し、表示を変えたときに差分として確認できるようにします。
+// -update を付けてテストを実行すると、golden ファイルを今の出力で書き換えます。
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "testdata/*.golden を書き換える")
+
+// Check は got を testdata/<name>.golden の内容と比べます
+func Check(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v (run go test with -update)", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output differs from %s; run go test with -update and review the diff\n%s", name, path, got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package history records compression runs in an append-only JSON Lines log.
+// パラメータを変えながら圧縮を繰り返すときに、以前の結果と比べられるよう、圧縮・展開の
+// 1回ごとに入力のSHA-256、サイズ、アルゴリズムとパラメータ、圧縮率、処理時間、ツールの
+// バージョンを1行のJSONとしてファイルの末尾に追記します。同時に実行した複数のプロセスが
+// 同じログに書き込んでも行が混ざらないよう、追記と読み込みの間はファイルをロックします。
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// 記録する操作の名前です
+const (
+	OpCompress   = "compress"
+	OpDecompress = "decompress"
+)
+
+// RegressionTolerance は最良の圧縮率より悪化したとみなす差です（圧縮率の差、0.001 = 0.1ポイント）
+// 同じ設定でも圧縮率はほぼ変わらないため、わずかな差は悪化として扱いません。
+const RegressionTolerance = 0.001
+
+// maxLineSize は読み込む1行の最大のバイト数です（これより長い行は壊れた行として読み飛ばします）
+const maxLineSize = 1 << 20
+
+// Record は1回の圧縮または展開の記録です
+// JSONのキーはログの形式で、過去のログを読めるよう変更しないでください（追加のみ）。
+type Record struct {
+	Time           time.Time         `json:"time"`                 // 記録した時刻
+	Operation      string            `json:"operation"`            // OpCompress か OpDecompress
+	InputSHA256    string            `json:"input_sha256"`         // 入力のSHA-256（16進数）
+	Input          string            `json:"input"`                // 入力のパス（標準入力は "-"）
+	OriginalSize   int64             `json:"original_size"`        // 元のサイズ
+	CompressedSize int64             `json:"compressed_size"`      // 圧縮後のサイズ
+	Ratio          float64           `json:"ratio"`                // 圧縮率（圧縮後 / 元）
+	Algorithm      string            `json:"algorithm"`            // アルゴリズムの登録名
+	Params         map[string]string `json:"params,omitempty"`     // アルゴリズム以外の設定（-filter など）
+	Duration       time.Duration     `json:"duration_ns"`          // 処理時間
+	Timings        *common.Timings   `json:"timings_ns,omitempty"` // フェーズごとの処理時間
+	Version        string            `json:"version"`              // ツールのバージョン（common.Build.String）
+}
+
+// Setting はアルゴリズムとパラメータを "lz77 adaptive=true block_size=16384" の形式で返します
+func (r Record) Setting() string {
+	parts := []string{r.Algorithm}
+	for _, k := range slices.Sorted(maps.Keys(r.Params)) {
+		parts = append(parts, k+"="+r.Params[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// DefaultPath はホームディレクトリの ~/.tinyzipzap/history.jsonl を返します
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".tinyzipzap", "history.jsonl"), nil
+}
+
+// HashFile は path の内容のSHA-256を16進数で返します
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Append は rec を1行のJSONとして path の末尾に追記します
+// 親ディレクトリがなければ作成します。書き込みの間はファイルを排他的にロックし、
+// 1行を1回の書き込みで追記するため、同時に追記した行が混ざることはありません。
+func Append(path string, rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(f, true)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("history: lock %s: %w", path, err)
+	}
+	_, werr := f.Write(line)
+	return errors.Join(werr, unlock(), f.Close())
+}
+
+// Load は path のすべての記録を古い順に返し、読み飛ばした壊れた行の数も返します
+// ファイルがない場合は記録なしです。書き込み中に止まったプロセスの途中までの行などは
+// エラーにせず、壊れた行として数えます。読み込みの間は共有ロックをかけます。
+func Load(path string) ([]Record, int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	unlock, err := lockFile(f, false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("history: lock %s: %w", path, err)
+	}
+	defer unlock()
+
+	var records []Record
+	skipped := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxLineSize)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil || rec.Operation == "" {
+			skipped++
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, err
+	}
+	return records, skipped, nil
+}
+
+// Filter は Query で記録を選ぶ条件です（空のフィールドは条件にしません）
+type Filter struct {
+	InputSHA256 string // 入力のSHA-256（先頭の一部でもよい、大文字小文字は区別しない）
+	Operation   string // 操作
+	Algorithm   string // アルゴリズムの登録名
+}
+
+// Match は rec が f の条件をすべて満たすかを返します
+func (f Filter) Match(rec Record) bool {
+	return strings.HasPrefix(rec.InputSHA256, strings.ToLower(f.InputSHA256)) &&
+		(f.Operation == "" || rec.Operation == f.Operation) &&
+		(f.Algorithm == "" || strings.EqualFold(rec.Algorithm, f.Algorithm))
+}
+
+// Query は records のうち f に一致する記録を同じ順で返します
+func Query(records []Record, f Filter) []Record {
+	var matched []Record
+	for _, rec := range records {
+		if f.Match(rec) {
+			matched = append(matched, rec)
+		}
+	}
+	return matched
+}
+
+// Best は records の圧縮の記録のうち、圧縮率が最も小さいものを返します（ない場合は false）
+// 同じ圧縮率の場合は先に記録したものです。元のサイズが0の記録は比べません。
+func Best(records []Record) (Record, bool) {
+	var best Record
+	found := false
+	for _, rec := range records {
+		if rec.Operation != OpCompress || rec.OriginalSize == 0 {
+			continue
+		}
+		if !found || rec.Ratio < best.Ratio {
+			best, found = rec, true
+		}
+	}
+	return best, found
+}
+
+// Regressed は current の圧縮率が best より RegressionTolerance を超えて悪いかを返します
+func Regressed(current, best Record) bool {
+	return current.Ratio > best.Ratio+RegressionTolerance
+}
@@ -0,0 +1,178 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record はテスト用の圧縮の記録を作成します
+func record(hash, algo string, ratio float64, params map[string]string) Record {
+	return Record{
+		Time:           time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Operation:      OpCompress,
+		InputSHA256:    hash,
+		Input:          "sample.txt",
+		OriginalSize:   1000,
+		CompressedSize: int64(ratio * 1000),
+		Ratio:          ratio,
+		Algorithm:      algo,
+		Params:         params,
+		Duration:       time.Millisecond,
+		Version:        "(devel)",
+	}
+}
+
+func TestAppendLoad_Query(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "history.jsonl")
+	hashA := strings.Repeat("ab", 32)
+	hashB := strings.Repeat("cd", 32)
+	records := []Record{
+		record(hashA, "rle", 0.80, nil),
+		record(hashA, "lz77", 0.31, map[string]string{"window": "16384"}),
+		record(hashB, "lz77", 0.10, nil),
+		record(hashA, "lz77", 0.45, nil),
+	}
+	decompress := record(hashA, "lz77", 0.31, nil)
+	decompress.Operation = OpDecompress
+	records = append(records, decompress)
+	for _, rec := range records {
+		if err := Append(path, rec); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	loaded, skipped, err := Load(path)
+	if err != nil || skipped != 0 || len(loaded) != len(records) {
+		t.Fatalf("Load = %d records, %d skipped, %v", len(loaded), skipped, err)
+	}
+	if got := loaded[1].Setting(); got != "lz77 window=16384" {
+		t.Errorf("Setting = %q", got)
+	}
+
+	forA := Query(loaded, Filter{InputSHA256: strings.ToUpper(hashA[:8])})
+	if len(forA) != 4 {
+		t.Fatalf("Query by hash prefix = %d records, want 4", len(forA))
+	}
+	if got := Query(loaded, Filter{InputSHA256: hashA, Algorithm: "LZ77", Operation: OpCompress}); len(got) != 2 {
+		t.Errorf("Query by algorithm and operation = %d records, want 2", len(got))
+	}
+
+	// 最良の圧縮率は同じ入力の圧縮の記録だけから選ぶ（展開や別の入力は比べない）
+	best, ok := Best(forA)
+	if !ok || best.Ratio != 0.31 || best.Setting() != "lz77 window=16384" {
+		t.Errorf("Best = %+v, %v, want lz77 window=16384 at 0.31", best, ok)
+	}
+	if !Regressed(loaded[3], best) {
+		t.Error("Expected 0.45 to be a regression from 0.31")
+	}
+	if Regressed(record(hashA, "lz77", 0.3105, nil), best) {
+		t.Error("A difference within RegressionTolerance should not be a regression")
+	}
+	if _, ok := Best(nil); ok {
+		t.Error("Best of no records should report false")
+	}
+}
+
+func TestLoad_SkipsBrokenLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if _, _, err := Load(path); err != nil {
+		t.Errorf("Load of a missing log failed: %v", err)
+	}
+	if err := Append(path, record("aa", "rle", 0.5, nil)); err != nil {
+		t.Fatal(err)
+	}
+	// 書き込み中に止まったプロセスの途中までの行
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"time\":\"2026-10-16T12:00:00Z\",\"operation\":\"comp\n\n")
+	f.Close()
+	if err := Append(path, record("bb", "lz77", 0.4, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, skipped, err := Load(path)
+	if err != nil || len(loaded) != 2 || skipped != 1 {
+		t.Errorf("Load = %d records, %d skipped, %v; want 2 records and 1 skipped line", len(loaded), skipped, err)
+	}
+}
+
+func TestAppend_ConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	const perWriter = 200
+	// 1行を大きくして、ロックがなければ行が混ざりやすくする
+	params := map[string]string{"note": strings.Repeat("x", 16<<10)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for w := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				rec := record(fmt.Sprintf("%02x", w), "rle", float64(i)/perWriter, params)
+				if err := Append(path, rec); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	loaded, skipped, err := Load(path)
+	if err != nil || skipped != 0 || len(loaded) != 2*perWriter {
+		t.Errorf("Load = %d records, %d skipped, %v; want %d intact records", len(loaded), skipped, err, 2*perWriter)
+	}
+}
+
+func TestAppend_WaitsForLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := Append(path, record("aa", "rle", 0.5, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 別のプロセスが読み込み中（共有ロック）の間は追記を待つ
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	unlock, err := lockFile(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- Append(path, record("bb", "lz77", 0.4, nil)) }()
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("Append finished while the log was locked (err %v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Append did not finish after the lock was released")
+	}
+	if loaded, _, err := Load(path); err != nil || len(loaded) != 2 {
+		t.Errorf("Load = %d records, %v; want 2", len(loaded), err)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !unix
+
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockRetry はロックファイルを作成できなかった場合に再び試すまでの間隔です
+const lockRetry = 10 * time.Millisecond
+
+// lockTimeout はロックファイルを待つ最大の時間です
+// 異常終了したプロセスが残したロックファイルで、以降の実行が止まり続けないようにします。
+const lockTimeout = 10 * time.Second
+
+// lockFile は f の隣にロックファイル（f の名前 + ".lock"）を作成してロックし、ロックを外す関数を返します
+// flock のないOSの代わりで、共有ロックも排他的なロックとして扱います。ほかのプロセスが
+// ロックしている間は lockTimeout まで待ちます。
+func lockFile(f *os.File, _ bool) (func() error, error) {
+	path := f.Name() + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		lock, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			lock.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s (remove it if no other tinyzipzap is running)", path)
+		}
+		time.Sleep(lockRetry)
+	}
+}
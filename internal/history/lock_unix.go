@@ -0,0 +1,27 @@
+//go:build unix
+
+package history
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile は f を flock でロックし（exclusive でなければ共有ロック）、ロックを外す関数を返します
+// ほかのプロセスがロックしている間は待ちます。ロックはファイルを閉じても外れます。
+func lockFile(f *os.File, exclusive bool) (func() error, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return func() error { return syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }, nil
+	}
+}
@@ -0,0 +1,138 @@
+// Package progress tracks the progress of a long-running operation.
+// 圧縮・展開の進捗（処理したバイト数）をゴルーチン安全に記録し、途中経過の1行表示と
+// 完了時のまとめに使います。SIGUSR1（BSD/macOSでは SIGINFO も）を受け取ると、
+// 処理を止めずに現在の状態を表示できます。
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// Tracker は処理したバイト数を記録します
+// Update は処理中のゴルーチンから、Status はシグナルを処理するゴルーチンから同時に呼び出せます
+type Tracker struct {
+	total     int64 // 全体のバイト数（不明な場合は0）
+	start     time.Time
+	processed atomic.Int64
+	now       func() time.Time
+}
+
+// New は全体が total バイトの処理の Tracker を作成します（全体が不明な場合は0）
+func New(total int64) *Tracker {
+	return newTracker(total, time.Now)
+}
+
+func newTracker(total int64, now func() time.Time) *Tracker {
+	return &Tracker{total: total, start: now(), now: now}
+}
+
+// Update はそれまでに処理したバイト数を記録します
+// container.FileOptions.Progress にそのまま渡せる形です
+func (t *Tracker) Update(processed int64) {
+	t.processed.Store(processed)
+}
+
+// Status は現在の状態を返します
+func (t *Tracker) Status() Status {
+	return Status{
+		Processed: t.processed.Load(),
+		Total:     t.total,
+		Elapsed:   t.now().Sub(t.start),
+	}
+}
+
+// Report は interval ごとに現在の状態を1行で w に書き込みます
+// 速度を制限した処理のように、意図して時間がかかる場合に進んでいることを示すために使います。
+// 返された関数を呼ぶと表示を止めます。
+func (t *Tracker) Report(w io.Writer, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintln(w, t.Status())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Status はある時点の進捗です
+type Status struct {
+	Processed int64         // 処理したバイト数
+	Total     int64         // 全体のバイト数（不明な場合は0）
+	Elapsed   time.Duration // 開始からの経過時間
+}
+
+// Percent は処理した割合（0〜100）を返します。全体が不明な場合は false を返します
+func (s Status) Percent() (float64, bool) {
+	if s.Total <= 0 {
+		return 0, false
+	}
+	return float64(s.Processed) / float64(s.Total) * 100, true
+}
+
+// Throughput は開始からの平均の処理速度（バイト/秒）を返します
+func (s Status) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Processed) / s.Elapsed.Seconds()
+}
+
+// ETA は今の速度が続いた場合の残り時間を返します
+// 全体が不明な場合や、まだ何も処理していない場合は false を返します
+func (s Status) ETA() (time.Duration, bool) {
+	rate := s.Throughput()
+	if s.Total <= 0 || rate <= 0 {
+		return 0, false
+	}
+	remaining := max(s.Total-s.Processed, 0)
+	return time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second), true
+}
+
+// String は途中経過を1行で返します
+//
+//	処理中: 12.0 MB / 48.0 MB (25.0%), 3.0 MB/s, 残り 12s
+//	処理中: 12.0 MB, 3.0 MB/s
+func (s Status) String() string {
+	line := "処理中: " + common.FormatBytes(s.Processed)
+	if percent, ok := s.Percent(); ok {
+		line += fmt.Sprintf(" / %s (%.1f%%)", common.FormatBytes(s.Total), percent)
+	}
+	line += ", " + formatRate(s.Throughput())
+	if eta, ok := s.ETA(); ok {
+		line += fmt.Sprintf(", 残り %v", eta)
+	}
+	return line
+}
+
+// Summary は完了時のまとめを1行で返します
+//
+//	処理: 48.0 MB (16s, 3.0 MB/s)
+func (s Status) Summary() string {
+	return fmt.Sprintf("処理: %s (%v, %s)", common.FormatBytes(s.Processed),
+		s.Elapsed.Round(time.Millisecond), formatRate(s.Throughput()))
+}
+
+// formatRate は処理速度を "3.0 MB/s" の形にします
+func formatRate(bytesPerSec float64) string {
+	return common.FormatBytes(int64(bytesPerSec)) + "/s"
+}
@@ -0,0 +1,144 @@
+package progress
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock はテストで経過時間を指定するための時計です
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestStatus_String(t *testing.T) {
+	tests := map[string]struct {
+		status   Status
+		expected string
+	}{
+		"known total": {
+			Status{Processed: 12 << 20, Total: 48 << 20, Elapsed: 4 * time.Second},
+			"処理中: 12.0 MB / 48.0 MB (25.0%), 3.0 MB/s, 残り 12s",
+		},
+		"unknown total": {
+			Status{Processed: 12 << 20, Elapsed: 4 * time.Second},
+			"処理中: 12.0 MB, 3.0 MB/s",
+		},
+		"not started": {
+			Status{Total: 1 << 20},
+			"処理中: 0 B / 1.0 MB (0.0%), 0 B/s",
+		},
+	}
+	for name, tt := range tests {
+		if got := tt.status.String(); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", name, tt.expected, got)
+		}
+	}
+}
+
+func TestStatus_Summary(t *testing.T) {
+	s := Status{Processed: 48 << 20, Total: 48 << 20, Elapsed: 16 * time.Second}
+	if got, expected := s.Summary(), "処理: 48.0 MB (16s, 3.0 MB/s)"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestStatus_ETA(t *testing.T) {
+	if _, ok := (Status{Processed: 10, Elapsed: time.Second}).ETA(); ok {
+		t.Error("Expected no ETA without a total")
+	}
+	if _, ok := (Status{Total: 10, Elapsed: time.Second}).ETA(); ok {
+		t.Error("Expected no ETA before anything is processed")
+	}
+	// 入力が途中で増えた場合などに、処理済みが全体を超えても負にならない
+	if eta, ok := (Status{Processed: 20, Total: 10, Elapsed: time.Second}).ETA(); !ok || eta != 0 {
+		t.Errorf("Expected ETA 0, got %v, %v", eta, ok)
+	}
+}
+
+func TestTracker_ConcurrentUpdate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tracker := newTracker(1000, clock.Now)
+
+	// 処理中のゴルーチンが更新し、別のゴルーチンが状態を読む（go test -race で確認）
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := int64(1); i <= 1000; i++ {
+			tracker.Update(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if s := tracker.Status(); s.Processed < 0 || s.Processed > 1000 {
+				t.Errorf("Unexpected processed bytes %d", s.Processed)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	clock.Advance(2 * time.Second)
+	s := tracker.Status()
+	if s.Processed != 1000 || s.Total != 1000 || s.Elapsed != 2*time.Second {
+		t.Errorf("Unexpected final status %+v", s)
+	}
+	if percent, ok := s.Percent(); !ok || percent != 100 {
+		t.Errorf("Expected 100%%, got %v, %v", percent, ok)
+	}
+	if rate := s.Throughput(); rate != 500 {
+		t.Errorf("Expected 500 B/s, got %v", rate)
+	}
+}
+
+// chanWriter は書き込まれた内容をチャネルに送ります
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestTracker_Report(t *testing.T) {
+	tracker := New(100)
+	tracker.Update(40)
+
+	lines := make(chanWriter, 16)
+	stop := tracker.Report(lines, 10*time.Millisecond)
+	for range 2 {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "処理中: 40 B / 100 B (40.0%)") {
+				t.Errorf("Unexpected status line %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No periodic status line")
+		}
+	}
+	stop()
+
+	// 止めた後は表示しない
+	for len(lines) > 0 {
+		<-lines
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(lines) != 0 {
+		t.Errorf("Status lines after stop: %q", <-lines)
+	}
+}
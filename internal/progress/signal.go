@@ -0,0 +1,41 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// WatchSignals は状態表示のシグナルを受け取るたびに、現在の状態を1行で w に書き込みます
+// シグナルは SIGUSR1 で、BSD/macOSでは Ctrl+T で送られる SIGINFO も受け取ります。
+// 返された関数を呼ぶと監視を止めます。シグナルに対応していないOSでは何もしません。
+func (t *Tracker) WatchSignals(w io.Writer) (stop func()) {
+	if len(statusSignals) == 0 {
+		return func() {}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, statusSignals...)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ch:
+				fmt.Fprintln(w, t.Status())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		wg.Wait()
+	}
+}
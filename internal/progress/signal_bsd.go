@@ -0,0 +1,11 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package progress
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals は状態を表示するシグナルです（SIGINFO は端末の Ctrl+T で送られます）
+var statusSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGINFO}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package progress
+
+import "os"
+
+// statusSignals は状態を表示するシグナルです（このOSでは対応していません）
+var statusSignals []os.Signal
@@ -0,0 +1,54 @@
+//go:build unix
+
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// syncBuffer は複数のゴルーチンから使える bytes.Buffer です
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchSignals_SIGUSR1(t *testing.T) {
+	tracker := New(100)
+	tracker.Update(25)
+
+	var out syncBuffer
+	stop := tracker.WatchSignals(&out)
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "\n") {
+		if time.Now().After(deadline) {
+			t.Fatal("No status line after SIGUSR1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if line := out.String(); !strings.HasPrefix(line, "処理中: 25 B / 100 B (25.0%)") {
+		t.Errorf("Unexpected status line %q", line)
+	}
+}
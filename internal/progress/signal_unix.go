@@ -0,0 +1,11 @@
+//go:build unix && !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package progress
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals は状態を表示するシグナルです
+var statusSignals = []os.Signal{syscall.SIGUSR1}
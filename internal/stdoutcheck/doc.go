@@ -0,0 +1,5 @@
+// Package stdoutcheck holds the test that keeps library packages off the global stdout.
+// 表示はすべて io.Writer を受け取る Fprint... の関数で行い、標準出力を選ぶのは
+// main パッケージと pkg/cli（Runner の Out）だけにします。JSON の出力やパイプのときの
+// 標準エラーへの切り替え、テストでの出力の確認は、この約束に依存しています。
+package stdoutcheck
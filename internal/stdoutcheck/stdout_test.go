@@ -0,0 +1,139 @@
+package stdoutcheck
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// moduleRoot は go.mod のあるディレクトリを返します
+func moduleRoot(t *testing.T) string {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatal("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// allowedDirs は標準出力を使ってよいディレクトリです（main パッケージは常に許可します）
+var allowedDirs = []string{"cmd", "pkg/cli"}
+
+// isPrintWrapper は、decl が互換性のための Print... の関数で、本体が
+// Fprint...(os.Stdout, ...) の呼び出しだけかを返します
+func isPrintWrapper(decl *ast.FuncDecl, osName string) bool {
+	if decl == nil || !strings.HasPrefix(decl.Name.Name, "Print") || decl.Body == nil || len(decl.Body.List) != 1 {
+		return false
+	}
+	stmt, ok := decl.Body.List[0].(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 || !isStdout(call.Args[0], osName) {
+		return false
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return strings.HasPrefix(fun.Name, "Fprint")
+	case *ast.SelectorExpr:
+		return strings.HasPrefix(fun.Sel.Name, "Fprint")
+	}
+	return false
+}
+
+// isStdout は expr が os.Stdout かを返します（osName は os パッケージのインポート名）
+func isStdout(expr ast.Expr, osName string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Stdout" {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == osName
+}
+
+// osImportName は file が os パッケージをインポートしている名前を返します（していなければ空）
+func osImportName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == "os" {
+			if spec.Name != nil {
+				return spec.Name.Name
+			}
+			return "os"
+		}
+	}
+	return ""
+}
+
+func TestNoStdoutOutsideMainAndCLI(t *testing.T) {
+	root := moduleRoot(t)
+	fset := token.NewFileSet()
+	checked := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			name := d.Name()
+			if name == "testdata" || (strings.HasPrefix(name, ".") && rel != ".") {
+				return filepath.SkipDir
+			}
+			for _, dir := range allowedDirs {
+				if rel == dir {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		checked++
+		osName := osImportName(file)
+		if file.Name.Name == "main" || osName == "" || osName == "_" {
+			return nil
+		}
+
+		for _, decl := range file.Decls {
+			fn, _ := decl.(*ast.FuncDecl)
+			ast.Inspect(decl, func(n ast.Node) bool {
+				expr, ok := n.(ast.Expr)
+				if !ok || !isStdout(expr, osName) || isPrintWrapper(fn, osName) {
+					return true
+				}
+				t.Errorf("%s: os.Stdout outside main and pkg/cli; take an io.Writer (Fprint...) instead", fset.Position(expr.Pos()))
+				return true
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("no Go files were checked")
+	}
+}
@@ -0,0 +1,48 @@
+// Package testcorpus はテストで共通して使う標準コーパスを提供します。
+// 各アルゴリズムのテストは同じ入力セットで往復（圧縮→展開）を確認します。
+package testcorpus
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// Sample はコーパス内の1つの入力データです
+type Sample struct {
+	Name string
+	Data []byte
+}
+
+// Samples は標準コーパスを返します（毎回新しいスライスを生成します）
+func Samples() []Sample {
+	return []Sample{
+		{Name: "empty", Data: []byte{}},
+		{Name: "single", Data: []byte("a")},
+		{Name: "short-text", Data: []byte("hello world")},
+		{Name: "alphabet", Data: []byte("abcdefghijklmnopqrstuvwxyz")},
+		{Name: "pangram", Data: bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20)},
+		{Name: "runs", Data: []byte("aaaaabbbbccccddddAAAAAAAAAAAAAAAAAAAAzzzzzzzzzz")},
+		{Name: "long-run", Data: bytes.Repeat([]byte{'x'}, 1000)},
+		{Name: "periodic", Data: bytes.Repeat([]byte("abcd"), 300)},
+		{Name: "binary", Data: []byte{0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0xFF, 0xFE, 0x00, 0x00}},
+		{Name: "alphabet-cycle", Data: Cycle(5000)},
+		{Name: "random", Data: Random(2048, 1)},
+	}
+}
+
+// Cycle は a-z を繰り返すn バイトのデータを生成します
+func Cycle(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i%26 + 'a')
+	}
+	return data
+}
+
+// Random はシードから決定的に生成したnバイトの乱数データを返します
+func Random(n int, seed int64) []byte {
+	r := rand.New(rand.NewSource(seed))
+	data := make([]byte, n)
+	r.Read(data)
+	return data
+}
@@ -0,0 +1,6 @@
+// Package wasmcheck holds the test that keeps the core library buildable for WebAssembly.
+// ブラウザのデモのために、rle、huffman、lz77、common、bitio、filter を GOOS=js GOARCH=wasm で
+// ビルドでき、ファイルシステムやネットワークのパッケージに依存しないことを確認します。
+// 表示の互換用の Print...（os.Stdout）以外でファイルを扱う処理を追加する場合は、
+// container のような別のパッケージに置いてください。
+package wasmcheck
@@ -0,0 +1,128 @@
+package wasmcheck
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// modulePath はこのモジュールのパスです
+const modulePath = "github.com/sasakihasuto/tinyzipzap"
+
+// wasmPackages は WebAssembly 向けにビルドできる必要があるパッケージです（依存するパッケージも含めて確認します）
+var wasmPackages = []string{
+	"./pkg/rle",
+	"./pkg/huffman",
+	"./pkg/lz77",
+	"./pkg/common",
+	"./pkg/bitio",
+	"./pkg/filter",
+	"./examples/wasm",
+}
+
+// forbiddenImports はファイルシステム、プロセス、ネットワークなど、ブラウザで使えないか
+// バイナリを大きくするパッケージです
+var forbiddenImports = []string{
+	"io/fs", "io/ioutil", "path/filepath",
+	"os/exec", "os/signal",
+	"net", "net/http",
+	"text/template", "html/template",
+	"runtime/metrics",
+}
+
+// osFiles は os を直接インポートしてよいファイルです（ファイルは開きません）
+var osFiles = map[string]string{
+	"pkg/common/print.go":  "Print... の os.Stdout",
+	"pkg/common/safety.go": "os.ErrDeadlineExceeded",
+	"pkg/rle/print.go":     "PrintAnalysis の os.Stdout",
+}
+
+// moduleRoot は go.mod のあるディレクトリを返します
+func moduleRoot(t *testing.T) string {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatal("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// wasmGo は GOOS=js GOARCH=wasm で go を実行するコマンドを返します
+func wasmGo(gobin, root string, args ...string) *exec.Cmd {
+	cmd := exec.Command(gobin, args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm", "CGO_ENABLED=0")
+	return cmd
+}
+
+func TestBuildWASM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping WebAssembly build in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	platforms, err := exec.Command(gobin, "tool", "dist", "list").Output()
+	if err != nil || !strings.Contains(string(platforms), "js/wasm") {
+		t.Skip("toolchain does not support js/wasm")
+	}
+	root := moduleRoot(t)
+
+	args := append([]string{"build", "-o", os.DevNull}, wasmPackages...)
+	if out, err := wasmGo(gobin, root, args...).CombinedOutput(); err != nil {
+		t.Fatalf("GOOS=js GOARCH=wasm go build failed: %v\n%s", err, out)
+	}
+
+	// 依存するこのモジュールのパッケージの、WebAssembly でビルドされるファイルのインポートを確認する
+	args = append([]string{"list", "-deps", "-f", `{{.ImportPath}}{{range .GoFiles}} {{$.Dir}}/{{.}}{{end}}`}, wasmPackages...)
+	out, err := wasmGo(gobin, root, args...).Output()
+	if err != nil {
+		t.Fatalf("go list failed: %v", err)
+	}
+	fset := token.NewFileSet()
+	checked := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], modulePath+"/") {
+			continue
+		}
+		for _, path := range fields[1:] {
+			file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked++
+			rel, _ := filepath.Rel(root, path)
+			rel = filepath.ToSlash(rel)
+			for _, spec := range file.Imports {
+				imp, _ := strconv.Unquote(spec.Path.Value)
+				for _, forbidden := range forbiddenImports {
+					if imp == forbidden {
+						t.Errorf("%s imports %s, which is not available or too large for WebAssembly", rel, imp)
+					}
+				}
+				if _, ok := osFiles[rel]; imp == "os" && !ok {
+					t.Errorf("%s imports os; keep file and process helpers out of the WebAssembly packages", rel)
+				}
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no Go files were checked")
+	}
+}
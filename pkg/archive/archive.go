@@ -0,0 +1,669 @@
+// Package archive builds and reads in-memory bundles of named, compressed files.
+// ビルド時に画像やテキストなどのアセットを1つのバンドルにまとめ、go:embed で
+// プログラムに埋め込んで、実行時にディスクを使わずに読み出すためのパッケージです。
+// エントリごとに別のアルゴリズムを選べ、読み出し時にはCRC32を確認します。
+// 同じ内容のファイルは1回だけ格納し、2つ目以降は最初のエントリへのリンクにします。
+// シンボリックリンクはリンク先のパスだけを記録します。
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// フォーマット
+//
+//	ヘッダー:   マジック "TZA" + バージョン(1バイト) + フラグ(1バイト、バージョン4以降)
+//	            + エントリ数(uvarint)
+//	名前の表:   エントリごとに 名前の長さ(uvarint) + 名前 + リンク(uvarint)
+//	            + シンボリックリンク先の長さ(uvarint) + シンボリックリンク先（バージョン3以降）
+//	エントリ:   .tzz コンテナのメンバーを、内容を格納したエントリの順に1つずつ
+//	            （アルゴリズム名、サイズ、CRC32を含む）
+//
+// リンクは0ならそのエントリが内容を格納していることを、k（1以上）なら k-1 番目の
+// エントリと同じ内容で、メンバーを持たないことを表します。リンク先は前にある、
+// 内容を格納したエントリです。バージョン1にはリンクがなく、すべてのエントリがメンバーを持ちます。
+//
+// シンボリックリンク先の長さが0でないエントリはシンボリックリンクで、リンクは0、メンバーを
+// 持ちません。シンボリックリンクを含まないバンドルは、これまでの読み手でも開けるように
+// バージョン2で書き込みます。
+//
+// フラグは flagReproducible（WithReproducible で書き込んだ）の組み合わせで、知らないビットが
+// 立っていれば開けません。フラグを立てないバンドルは、フラグのないバージョンで書き込みます。
+const (
+	magic = "TZA"
+
+	// Version は現在のフォーマットのバージョンです
+	Version = 4
+
+	// versionNoLinks はリンク（重複の除去）のないフォーマットのバージョンです
+	versionNoLinks = 1
+
+	// versionNoSymlinks はシンボリックリンクのないフォーマットのバージョンです
+	versionNoSymlinks = 2
+
+	// versionNoFlags はヘッダーにフラグのないフォーマットのバージョンです
+	versionNoFlags = 3
+
+	// flagReproducible は再現可能なバンドル（エントリが名前順）であることを表すフラグです
+	flagReproducible = 1 << 0
+)
+
+// hashContent は重複を探すための内容のハッシュです
+// ハッシュが一致しても、リンクにする前に内容全体を比較します。
+var hashContent = sha256.Sum256
+
+// Builder はバンドルをメモリ上で組み立てます
+// 同じ内容のファイルは最初に追加したエントリへのリンクとして、内容を1回だけ格納します。
+// 同時に使用することはできません
+type Builder struct {
+	entries []builtEntry
+	byHash  map[[sha256.Size]byte][]int // 内容のハッシュ -> 内容を格納した entries の位置
+	names   nameSet
+
+	reproducible bool // Bytes でエントリを名前順に並べ、flagReproducible を記録する
+}
+
+// builtEntry は Builder に追加したエントリです
+type builtEntry struct {
+	name    string
+	symlink string // シンボリックリンク先（ファイルの場合は空）
+	link    int    // 同じ内容を格納したエントリの位置（内容を格納している場合とシンボリックリンクは -1）
+	size    int64  // 元のサイズ
+	member  []byte // .tzz のメンバー（リンクとシンボリックリンクの場合は nil）
+	body    int64  // メンバーの圧縮データのサイズ
+}
+
+// NewBuilder は空のバンドルの Builder を作成します
+func NewBuilder() *Builder {
+	return &Builder{
+		byHash: make(map[[sha256.Size]byte][]int),
+		names:  newNameSet(),
+	}
+}
+
+// AddFile は data を登録名 algo のアルゴリズムで圧縮し、name のエントリとして追加します
+// 圧縮しても小さくならない場合は圧縮せずに格納します（Entry.Algorithm は common.StoredAlgorithm）。
+// name は fs.ValidPath を満たす "/" 区切りのパス（例: "css/site.css"）で、同じ名前や、
+// ほかのエントリのディレクトリと同じ名前は追加できません。
+// 既に同じ内容のエントリがある場合は圧縮せず、そのエントリへのリンクにします
+// （リンクしたエントリは、最初のエントリのアルゴリズムで格納されたものになります）。
+func (b *Builder) AddFile(name string, data []byte, algo string) error {
+	if err := b.names.check(name); err != nil {
+		return err
+	}
+	c, err := common.New(algo)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", name, err)
+	}
+	if b.reproducible {
+		if err := checkDeterministic(algo); err != nil {
+			return fmt.Errorf("archive: %s: %w", name, err)
+		}
+	}
+
+	hash := hashContent(data)
+	link, err := b.findSame(hash, data)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", name, err)
+	}
+	if link >= 0 {
+		b.add(builtEntry{name: name, link: link, size: int64(len(data))})
+		return nil
+	}
+
+	e, err := encodeEntry(name, data, algo, c)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", name, err)
+	}
+	b.byHash[hash] = append(b.byHash[hash], len(b.entries))
+	b.add(e)
+	return nil
+}
+
+// AddSymlink は target を指すシンボリックリンクを name のエントリとして追加します
+// target はリンク先のパスをそのまま記録し（"/" で始まるパスや ".." を含むパスも記録します）、
+// 展開するかどうかは ExtractOptions.Symlinks で決めます。空の target は追加できません。
+func (b *Builder) AddSymlink(name, target string) error {
+	if err := b.names.check(name); err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("archive: %s: empty symlink target", name)
+	}
+	b.add(builtEntry{name: name, symlink: target, link: -1})
+	return nil
+}
+
+// encodeEntry は data を圧縮した、内容を格納するエントリを作成します
+// 圧縮しても小さくならないデータは、common.StoredAlgorithm のメンバーとしてそのまま格納します。
+// Builder を使わないため、複数のゴルーチンから同時に呼び出せます。
+func encodeEntry(name string, data []byte, algo string, c common.Compressor) (builtEntry, error) {
+	compressed, ok, err := common.CompressNoExpand(c, data)
+	if err != nil {
+		return builtEntry{}, err
+	}
+	if !ok && len(data) > 0 {
+		algo, c = common.StoredAlgorithm, common.NewStored()
+	}
+	member, err := container.EncodeCompressedMember(algo, c, data, compressed)
+	if err != nil {
+		return builtEntry{}, err
+	}
+	parsed, err := container.Parse(member)
+	if err != nil {
+		return builtEntry{}, err
+	}
+	return builtEntry{name: name, link: -1, size: int64(len(data)), member: member, body: int64(len(parsed[0].Body()))}, nil
+}
+
+// addEncoded は encodeEntry で圧縮したエントリ e（内容は data）を追加します
+// AddFile と同じく、既に同じ内容のエントリがある場合は e を使わずにリンクにします。
+func (b *Builder) addEncoded(e builtEntry, data []byte) error {
+	if err := b.names.check(e.name); err != nil {
+		return err
+	}
+	hash := hashContent(data)
+	link, err := b.findSame(hash, data)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", e.name, err)
+	}
+	if link >= 0 {
+		b.add(builtEntry{name: e.name, link: link, size: e.size})
+		return nil
+	}
+	b.byHash[hash] = append(b.byHash[hash], len(b.entries))
+	b.add(e)
+	return nil
+}
+
+// findSame は data と同じ内容を格納したエントリの位置を返します（なければ -1）
+func (b *Builder) findSame(hash [sha256.Size]byte, data []byte) (int, error) {
+	for _, i := range b.byHash[hash] {
+		same, err := b.sameContent(i, data)
+		if err != nil {
+			return -1, err
+		}
+		if same {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// AddFS は fsys のすべての通常ファイルを、fsys 内のパスを名前として追加します
+// ファイルは fs.WalkDir の順（名前順）に追加するため、同じ内容のファイルは
+// 名前順で最初のものに格納され、残りはリンクになります。
+func (b *Builder) AddFS(fsys fs.FS, algo string) error {
+	return walkFiles(fsys, func(name string, data []byte) error {
+		return b.AddFile(name, data, algo)
+	})
+}
+
+// walkFiles は fsys のすべての通常ファイルを fs.WalkDir の順に読み込んで add に渡します
+func walkFiles(fsys fs.FS, add func(name string, data []byte) error) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return add(name, data)
+	})
+}
+
+// sameContent は i 番目のエントリの内容が data と同じかを、展開して比較します
+// byHash にはシンボリックリンクを登録しないため、i は内容を格納したエントリです。
+func (b *Builder) sameContent(i int, data []byte) (bool, error) {
+	e := b.entries[i]
+	if e.size != int64(len(data)) {
+		return false, nil
+	}
+	members, err := container.Parse(e.member)
+	if err != nil {
+		return false, err
+	}
+	stored, err := members[0].Decompress(common.New, common.DecompressOptions{})
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(stored, data), nil
+}
+
+// add はエントリを追加し、その名前を記録します
+func (b *Builder) add(e builtEntry) {
+	b.entries = append(b.entries, e)
+	b.names.add(e.name)
+}
+
+// ErrInvalidName はエントリの名前が fs.ValidPath を満たさないことを表します
+// "../" や "/" で始まる名前は、展開したときにディレクトリの外に書き込むため（zip-slip）拒否します。
+var ErrInvalidName = errors.New("archive: invalid entry name")
+
+// nameSet はエントリの名前と、その名前から決まるディレクトリを記録します
+// 書き込みと読み出しで同じ規則を使い、ファイルとディレクトリの衝突を防ぎます。
+type nameSet struct {
+	files map[string]bool // ファイルの名前
+	dirs  map[string]bool // ファイルの名前から決まるディレクトリ
+}
+
+func newNameSet() nameSet {
+	return nameSet{files: make(map[string]bool), dirs: make(map[string]bool)}
+}
+
+// check は name を新しいエントリの名前として使えるかを確認します
+func (s nameSet) check(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	if s.files[name] || s.dirs[name] {
+		return fmt.Errorf("archive: duplicate entry name: %q", name)
+	}
+	for dir := parentDir(name); dir != "."; dir = parentDir(dir) {
+		if s.files[dir] {
+			return fmt.Errorf("archive: entry %q is inside file %q", name, dir)
+		}
+	}
+	return nil
+}
+
+// add は name とその親ディレクトリを記録します
+func (s nameSet) add(name string) {
+	s.files[name] = true
+	for dir := parentDir(name); dir != "."; dir = parentDir(dir) {
+		s.dirs[dir] = true
+	}
+}
+
+// SetReproducible は Bytes で、追加した順によらず同じバイト列を返すかどうかを設定します
+// true の場合、エントリを名前順に並べ（同じ内容のエントリは名前順で最初のものが内容を持ちます）、
+// ヘッダーに再現可能なことを記録します（Reader.Reproducible）。以降の AddFile では
+// CapDeterministic を持たないアルゴリズムを使えません（ErrNondeterministic）。
+func (b *Builder) SetReproducible(reproducible bool) {
+	b.reproducible = reproducible
+}
+
+// Bytes はバンドルを返します
+// エントリは追加した順（SetReproducible の場合は名前順）に並び、同じ内容を同じ順に追加すれば
+// 同じバイト列になります。シンボリックリンクがなければバージョン2、SetReproducible でなければ
+// バージョン3以下で書き込みます。
+func (b *Builder) Bytes() []byte {
+	entries := b.entries
+	version, flags := byte(versionNoSymlinks), byte(0)
+	for _, e := range entries {
+		if e.symlink != "" {
+			version = versionNoFlags
+		}
+	}
+	if b.reproducible {
+		entries = sortedEntries(entries)
+		version, flags = Version, flagReproducible
+	}
+
+	result := append([]byte(magic), version)
+	if version > versionNoFlags {
+		result = append(result, flags)
+	}
+	result = binary.AppendUvarint(result, uint64(len(entries)))
+	for _, e := range entries {
+		result = binary.AppendUvarint(result, uint64(len(e.name)))
+		result = append(result, e.name...)
+		result = binary.AppendUvarint(result, uint64(e.link+1))
+		if version > versionNoSymlinks {
+			result = binary.AppendUvarint(result, uint64(len(e.symlink)))
+			result = append(result, e.symlink...)
+		}
+	}
+	for _, e := range entries {
+		result = append(result, e.member...)
+	}
+	return result
+}
+
+// Stats は追加したエントリの統計を返します
+func (b *Builder) Stats() Stats {
+	var s Stats
+	for _, e := range b.entries {
+		if e.symlink != "" {
+			s.addSymlink()
+		} else if e.link >= 0 {
+			s.addLink(e.size, b.entries[e.link].body)
+		} else {
+			s.addStored(e.size, e.body)
+		}
+	}
+	return s
+}
+
+// Stats はバンドルの統計です
+type Stats struct {
+	Entries        int   // エントリ数
+	Links          int   // 同じ内容のエントリへのリンクにしたエントリ数
+	Symlinks       int   // シンボリックリンクのエントリ数
+	Size           int64 // 全エントリの元のサイズの合計
+	CompressedSize int64 // 格納した圧縮データのサイズの合計
+	DedupSaved     int64 // リンクにしたことで格納せずに済んだ圧縮データのサイズの合計
+}
+
+// addStored は内容を格納したエントリを統計に加えます
+func (s *Stats) addStored(size, compressed int64) {
+	s.Entries++
+	s.Size += size
+	s.CompressedSize += compressed
+}
+
+// addLink はリンクにしたエントリを統計に加えます（saved はリンク先の圧縮データのサイズ）
+func (s *Stats) addLink(size, saved int64) {
+	s.Entries++
+	s.Links++
+	s.Size += size
+	s.DedupSaved += saved
+}
+
+// addSymlink はシンボリックリンクのエントリを統計に加えます（サイズは数えません）
+func (s *Stats) addSymlink() {
+	s.Entries++
+	s.Symlinks++
+}
+
+// ErrSymlink はシンボリックリンクのエントリの内容を読み出そうとしたことを表します
+// リンク先は Entry.Symlink にあり、ReadFile や fs.FS の Open ではたどりません。
+var ErrSymlink = errors.New("archive: entry is a symlink")
+
+// Entry はバンドルの1つのエントリです
+type Entry struct {
+	Name           string // "/" 区切りのパス
+	Algorithm      string // 圧縮アルゴリズムの登録名（zip では格納方式の "store" または "deflate"、シンボリックリンクは空）
+	Size           int64  // 元のサイズ（シンボリックリンクの場合は0）
+	CompressedSize int64  // 格納した圧縮データのサイズ（リンクとシンボリックリンクの場合は0）
+	CRC            uint32 // 元のデータのCRC32
+	Link           string // 同じ内容を格納したエントリの名前（内容を格納している場合は空）
+	Symlink        string // シンボリックリンクの場合のリンク先（ファイルの場合は空）
+
+	member container.Member // 内容を格納したメンバー（リンクの場合はリンク先のもの）
+}
+
+// Reader はバンドルからエントリを読み出します
+// 読み出しのたびに展開するため、複数のゴルーチンから同時に使用できます
+type Reader struct {
+	entries []Entry
+	index   map[string]int      // 名前 -> entries の位置
+	dirs    map[string][]string // ディレクトリ -> 直下の名前（名前順）
+
+	reproducible bool // ヘッダーの flagReproducible
+}
+
+// OpenBytes は b のバンドルを開きます
+// エントリのデータは b を参照するため、b を変更してはいけません（go:embed の []byte はそのまま渡せます）。
+// リンクのエントリはリンク先の内容を読み出します。バージョン1から3のバンドルも開けます。
+func OpenBytes(b []byte) (*Reader, error) {
+	if !bytes.HasPrefix(b, []byte(magic)) || len(b) < len(magic)+1 {
+		return nil, errors.New("archive: invalid magic")
+	}
+	version := b[len(magic)]
+	if err := checkVersion(version); err != nil {
+		return nil, err
+	}
+	start, flags := len(magic)+1, byte(0)
+	if version > versionNoFlags {
+		if len(b) <= start {
+			return nil, errors.New("archive: truncated header")
+		}
+		flags = b[start]
+		start++
+		if err := checkFlags(flags); err != nil {
+			return nil, err
+		}
+	}
+	table := bytes.NewReader(b[start:])
+	names, links, symlinks, stored, err := readNameTable(table, version, uint64(table.Len()))
+	if err != nil {
+		return nil, err
+	}
+	rest := b[len(b)-table.Len():]
+
+	members, err := container.Parse(rest)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	if len(members) != stored {
+		return nil, fmt.Errorf("archive: %d stored entries but %d members", stored, len(members))
+	}
+
+	r := &Reader{
+		entries:      make([]Entry, len(names)),
+		index:        make(map[string]int, len(names)),
+		reproducible: flags&flagReproducible != 0,
+	}
+	// Builder と同じ規則で名前を確認し、ディレクトリの一覧を作る
+	check := newNameSet()
+	for i, name := range names {
+		if err := check.check(name); err != nil {
+			return nil, err
+		}
+		check.add(name)
+
+		if symlinks[i] != "" {
+			r.entries[i] = Entry{Name: name, Symlink: symlinks[i]}
+		} else if link := links[i]; link >= 0 {
+			r.entries[i] = r.entries[link]
+			r.entries[i].Name = name
+			r.entries[i].CompressedSize = 0
+			r.entries[i].Link = names[link]
+		} else {
+			m := members[0]
+			members = members[1:]
+			r.entries[i] = Entry{
+				Name:           name,
+				Algorithm:      m.Algorithm,
+				Size:           int64(m.OriginalSize),
+				CompressedSize: int64(len(m.Body())),
+				CRC:            m.CRC,
+				member:         m,
+			}
+		}
+		r.index[name] = i
+	}
+	r.dirs = check.listDirs()
+	return r, nil
+}
+
+// checkVersion はバンドルのバージョンに対応しているかを確認します
+func checkVersion(version byte) error {
+	if version > Version {
+		return &common.ErrUnsupportedVersion{Format: "archive", Have: version, Max: Version}
+	} else if version < versionNoLinks {
+		return fmt.Errorf("archive: unsupported version: %d", version)
+	}
+	return nil
+}
+
+// checkFlags はバンドルのヘッダーのフラグに、知らないビットがないかを確認します
+func checkFlags(flags byte) error {
+	if flags&^flagReproducible != 0 {
+		return fmt.Errorf("archive: unsupported flags: %#02x", flags)
+	}
+	return nil
+}
+
+// tableReader は名前の表を読み込む入力です（bytes.Reader と bufio.Reader）
+type tableReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readNameTable はヘッダーのエントリ数と名前の表を読み込みます
+// remaining は r の残りのバイト数で、エントリ数の確認に使います。links はリンク先の
+// エントリの番号（内容を格納したエントリは -1）、symlinks はシンボリックリンク先
+// （ファイルは空）、stored は内容を格納したエントリの数です。
+func readNameTable(r tableReader, version byte, remaining uint64) (names []string, links []int, symlinks []string, stored int, err error) {
+	count, err := binary.ReadUvarint(r)
+	// 名前は1バイト以上なので、エントリ数は残りのバイト数を超えない
+	if err != nil || count > remaining {
+		return nil, nil, nil, 0, errors.New("archive: invalid entry count")
+	}
+
+	names = make([]string, count)
+	links = make([]int, count)
+	symlinks = make([]string, count)
+	for i := range names {
+		name, err := readString(r, remaining)
+		if err != nil || name == "" {
+			return nil, nil, nil, 0, fmt.Errorf("archive: entry %d: invalid name", i)
+		}
+		names[i] = name
+
+		links[i] = -1
+		if version > versionNoLinks {
+			link, err := binary.ReadUvarint(r)
+			// シンボリックリンクもリンク先にできない（links が -1 でも symlinks が空でない）
+			if err != nil || link > uint64(i) || link > 0 && (links[link-1] >= 0 || symlinks[link-1] != "") {
+				return nil, nil, nil, 0, fmt.Errorf("archive: entry %d: invalid link", i)
+			}
+			links[i] = int(link) - 1
+		}
+		if version > versionNoSymlinks {
+			if symlinks[i], err = readString(r, remaining); err != nil || symlinks[i] != "" && links[i] >= 0 {
+				return nil, nil, nil, 0, fmt.Errorf("archive: entry %d: invalid symlink", i)
+			}
+		}
+		if links[i] < 0 && symlinks[i] == "" {
+			stored++
+		}
+	}
+	return names, links, symlinks, stored, nil
+}
+
+// readString は長さ(uvarint) + 内容の文字列を読み込みます（長さは remaining まで）
+func readString(r tableReader, remaining uint64) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil || length > remaining {
+		return "", errors.New("invalid length")
+	}
+	// 壊れた長さで大きな領域を確保しないように、読み込めた分だけ確保する
+	b, err := io.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil || uint64(len(b)) != length {
+		return "", errors.New("truncated")
+	}
+	return string(b), nil
+}
+
+// listDirs はディレクトリごとの直下の名前の一覧（名前順）を返します（最上位は "."）
+func (s nameSet) listDirs() map[string][]string {
+	dirs := map[string][]string{".": nil}
+	for _, set := range []map[string]bool{s.files, s.dirs} {
+		for name := range set {
+			parent := parentDir(name)
+			dirs[parent] = append(dirs[parent], name)
+		}
+	}
+	for dir := range dirs {
+		slices.Sort(dirs[dir])
+	}
+	return dirs
+}
+
+// Entries はエントリの一覧をバンドル内の順に返します
+func (r *Reader) Entries() []Entry {
+	return append([]Entry(nil), r.entries...)
+}
+
+// Stats はバンドルの統計を返します
+func (r *Reader) Stats() Stats {
+	var s Stats
+	for _, e := range r.entries {
+		if e.Symlink != "" {
+			s.addSymlink()
+		} else if e.Link != "" {
+			s.addLink(e.Size, r.entries[r.index[e.Link]].CompressedSize)
+		} else {
+			s.addStored(e.Size, e.CompressedSize)
+		}
+	}
+	return s
+}
+
+// Reproducible はバンドルを WithReproducible（Builder.SetReproducible）で書き込んだかを返します
+func (r *Reader) Reproducible() bool {
+	return r.reproducible
+}
+
+// PrintEntries はエントリの一覧と、重複の除去で節約したサイズを表示します
+func PrintEntries(r ArchiveReader) {
+	FprintEntries(os.Stdout, r)
+}
+
+// FprintEntries は PrintEntries と同じ内容を w に書き込みます
+// リンクのエントリは圧縮後の欄に "= リンク先の名前" を表示します。
+// zip のエントリはアルゴリズムの欄に格納方式（store または deflate）を表示します。
+// シンボリックリンクはアルゴリズムの欄に symlink と、名前の後に "-> リンク先" を表示します。
+func FprintEntries(w io.Writer, r ArchiveReader) {
+	fmt.Fprintf(w, "=== エントリ一覧 ===\n")
+	fmt.Fprintf(w, "%-12s %12s %12s  %-8s  %s\n", "アルゴリズム", "元サイズ", "圧縮後", "CRC32", "名前")
+	for _, e := range r.Entries() {
+		if e.Symlink != "" {
+			fmt.Fprintf(w, "%-12s %12s %12s  %-8s  %s -> %s\n", "symlink", "-", "-", "-", e.Name, e.Symlink)
+			continue
+		}
+		compressed := strconv.FormatInt(e.CompressedSize, 10)
+		if e.Link != "" {
+			compressed = "-"
+		}
+		fmt.Fprintf(w, "%-12s %12d %12s  %08x  %s", e.Algorithm, e.Size, compressed, e.CRC, e.Name)
+		if e.Link != "" {
+			fmt.Fprintf(w, " (= %s)", e.Link)
+		}
+		fmt.Fprintln(w)
+	}
+
+	s := r.Stats()
+	fmt.Fprintf(w, "合計: %d エントリ, %s -> %s\n", s.Entries,
+		common.FormatBytes(s.Size), common.FormatBytes(s.CompressedSize))
+	if s.Links > 0 {
+		fmt.Fprintf(w, "重複: %d エントリ（%s を節約）\n", s.Links, common.FormatBytes(s.DedupSaved))
+	}
+	if s.Symlinks > 0 {
+		fmt.Fprintf(w, "シンボリックリンク: %d エントリ\n", s.Symlinks)
+	}
+}
+
+// ReadFile はエントリ name を展開して返します
+// 展開結果のサイズとCRC32が記録と一致しない場合はエラーを返します。
+// name のエントリがない場合のエラーは fs.ErrNotExist を、シンボリックリンクの場合は ErrSymlink を含みます。
+func (r *Reader) ReadFile(name string) ([]byte, error) {
+	i, ok := r.index[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if r.entries[i].Symlink != "" {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrSymlink}
+	}
+	data, err := r.entries[i].member.Decompress(common.New, common.DecompressOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("archive: %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// parentDir は "/" 区切りのパスの親ディレクトリを返します（最上位は "."）
+func parentDir(name string) string {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return "."
+	}
+	return name[:i]
+}
@@ -0,0 +1,921 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+var update = flag.Bool("update", false, "testdata/assets.tza を書き換える")
+
+// assetsBundle は testAssets から作ったバンドルです（go test ./pkg/archive -update で再生成）
+//
+//go:embed testdata/assets.tza
+var assetsBundle []byte
+
+// testAsset はテスト用のバンドルのエントリです
+type testAsset struct {
+	name string
+	algo string
+	data []byte
+}
+
+// testAssets はアルゴリズムの異なる3つのエントリを返します
+func testAssets() []testAsset {
+	return []testAsset{
+		{"css/site.css", "lz77", bytes.Repeat([]byte("body { margin: 0; padding: 0; }\n.nav { margin: 0 auto; }\n"), 8)},
+		{"img/bar.pbm", "rle", append([]byte("P1 64 4\n"), bytes.Repeat([]byte{'0'}, 256)...)},
+		{"data/words.txt", "huffman", bytes.Repeat([]byte("tiny zip zap: a small collection of toy compressors\n"), 8)},
+	}
+}
+
+// buildAssets は testAssets のバンドルを作ります
+func buildAssets(t *testing.T) []byte {
+	t.Helper()
+	b := NewBuilder()
+	for _, a := range testAssets() {
+		if err := b.AddFile(a.name, a.data, a.algo); err != nil {
+			t.Fatalf("AddFile(%s) failed: %v", a.name, err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestEmbeddedBundle(t *testing.T) {
+	built := buildAssets(t)
+	if *update {
+		if err := os.WriteFile("testdata/assets.tza", built, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	// 埋め込んだバンドルは今の Builder の出力と一致する
+	if !bytes.Equal(assetsBundle, built) {
+		t.Fatal("testdata/assets.tza is stale; run go test ./pkg/archive -update")
+	}
+
+	r, err := OpenBytes(assetsBundle)
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	entries := r.Entries()
+	if len(entries) != len(testAssets()) {
+		t.Fatalf("Expected %d entries, got %d", len(testAssets()), len(entries))
+	}
+	for i, a := range testAssets() {
+		e := entries[i]
+		if e.Name != a.name || e.Algorithm != a.algo || e.Size != int64(len(a.data)) {
+			t.Errorf("entry %d: expected %s (%s, %d bytes), got %+v", i, a.name, a.algo, len(a.data), e)
+		}
+		data, err := r.ReadFile(a.name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) failed: %v", a.name, err)
+		}
+		if !bytes.Equal(data, a.data) {
+			t.Errorf("ReadFile(%s): content mismatch", a.name)
+		}
+	}
+
+	if _, err := r.ReadFile("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestEmbeddedBundle_FS(t *testing.T) {
+	r, err := OpenBytes(assetsBundle)
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	fsys := r.FS()
+
+	var names []string
+	for _, a := range testAssets() {
+		names = append(names, a.name)
+		data, err := fs.ReadFile(fsys, a.name)
+		if err != nil {
+			t.Fatalf("fs.ReadFile(%s) failed: %v", a.name, err)
+		}
+		if !bytes.Equal(data, a.data) {
+			t.Errorf("fs.ReadFile(%s): content mismatch", a.name)
+		}
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Error(err)
+	}
+
+	root, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var got []string
+	for _, e := range root {
+		if !e.IsDir() {
+			t.Errorf("Expected %s to be a directory", e.Name())
+		}
+		got = append(got, e.Name())
+	}
+	if want := []string{"css", "data", "img"}; !slices.Equal(got, want) {
+		t.Errorf("Expected root %v, got %v", want, got)
+	}
+}
+
+func TestBuilder_AddFileErrors(t *testing.T) {
+	b := NewBuilder()
+	if err := b.AddFile("a/b.txt", []byte("x"), "rle"); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+
+	tests := map[string]struct {
+		name string
+		algo string
+	}{
+		"不明なアルゴリズム":   {"c.txt", "unknown"},
+		"空の名前":        {"", "rle"},
+		"ルート":         {".", "rle"},
+		"先頭のスラッシュ":    {"/c.txt", "rle"},
+		"親ディレクトリ":     {"../c.txt", "rle"},
+		"同じ名前":        {"a/b.txt", "rle"},
+		"ディレクトリと同じ名前": {"a", "rle"},
+		"ファイルの中のエントリ": {"a/b.txt/c", "rle"},
+	}
+	for name, tt := range tests {
+		if err := b.AddFile(tt.name, []byte("x"), tt.algo); err == nil {
+			t.Errorf("%s: expected an error for %q", name, tt.name)
+		}
+	}
+	if r, err := OpenBytes(b.Bytes()); err != nil || len(r.Entries()) != 1 {
+		t.Errorf("Expected failed AddFile calls to leave one entry, got %v", err)
+	}
+}
+
+// TestBuilder_StoresIncompressible は圧縮しても小さくならないエントリをそのまま格納することを確認します
+func TestBuilder_StoresIncompressible(t *testing.T) {
+	random, zeros := testcorpus.Random(2048, 9), make([]byte, 2048)
+	b := NewBuilder()
+	for name, data := range map[string][]byte{"random.bin": random, "zeros.bin": zeros} {
+		if err := b.AddFile(name, data, "rle"); err != nil {
+			t.Fatalf("AddFile(%s) failed: %v", name, err)
+		}
+	}
+
+	r, err := OpenBytes(b.Bytes())
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	want := map[string]struct {
+		algo string
+		data []byte
+	}{
+		"random.bin": {common.StoredAlgorithm, random},
+		"zeros.bin":  {"rle", zeros},
+	}
+	for _, e := range r.Entries() {
+		w := want[e.Name]
+		if e.Algorithm != w.algo {
+			t.Errorf("%s: Expected algorithm %s, got %s", e.Name, w.algo, e.Algorithm)
+		}
+		if e.Algorithm == common.StoredAlgorithm && e.CompressedSize != e.Size {
+			t.Errorf("%s: Expected %d stored bytes, got %d", e.Name, e.Size, e.CompressedSize)
+		}
+		data, err := r.ReadFile(e.Name)
+		if err != nil || !bytes.Equal(data, w.data) {
+			t.Errorf("ReadFile(%s) failed: %v", e.Name, err)
+		}
+	}
+}
+
+func TestOpenBytes_Empty(t *testing.T) {
+	r, err := OpenBytes(NewBuilder().Bytes())
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	if len(r.Entries()) != 0 {
+		t.Errorf("Expected no entries, got %d", len(r.Entries()))
+	}
+	if err := fstest.TestFS(r.FS()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenBytes_Invalid(t *testing.T) {
+	valid := buildAssets(t)
+
+	newer := append([]byte(nil), valid...)
+	newer[len(magic)] = Version + 1
+	var versionErr *common.ErrUnsupportedVersion
+	if _, err := OpenBytes(newer); !errors.As(err, &versionErr) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	// 名前の表の直後（最初のメンバー）を指す位置
+	members := len(magic) + 2
+	for _, a := range testAssets() {
+		members += 1 + len(a.name) + 1
+	}
+
+	tests := map[string][]byte{
+		"空":           {},
+		"マジックが違う":     append([]byte("TZZ"), valid[3:]...),
+		"名前が途中で終わる":   valid[:len(magic)+4],
+		"エントリが足りない":   valid[:members],
+		"メンバーが途中で終わる": valid[:len(valid)-1],
+	}
+	for name, data := range tests {
+		if _, err := OpenBytes(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// 圧縮データが壊れていれば ReadFile がエラーを返す
+	corrupted := append([]byte(nil), valid...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	r, err := OpenBytes(corrupted)
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	last := testAssets()[len(testAssets())-1].name
+	if _, err := r.ReadFile(last); err == nil {
+		t.Error("Expected an error for corrupted entry data")
+	}
+}
+
+func TestBuilder_DedupTree(t *testing.T) {
+	const size = 1 << 20
+	dir := t.TempDir()
+	content := testcorpus.Random(size, 3)
+	files := map[string][]byte{
+		"a/lib.js":     content,
+		"b/lib.js":     content,
+		"c/d/lib.js":   content,
+		"c/readme.txt": []byte("not a duplicate\n"),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewBuilder()
+	if err := b.AddFS(os.DirFS(dir), "huffman"); err != nil {
+		t.Fatalf("AddFS failed: %v", err)
+	}
+	bundle := b.Bytes()
+	if len(bundle) > size+size/100 {
+		t.Errorf("Expected about %d bytes, got %d", size, len(bundle))
+	}
+
+	r, err := OpenBytes(bundle)
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	for name, data := range files {
+		got, err := r.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) failed: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("ReadFile(%s): content mismatch", name)
+		}
+	}
+
+	// 名前順で最初の a/lib.js が内容を持ち、残りはリンクになる
+	var links []string
+	for _, e := range r.Entries() {
+		if e.Link != "" {
+			if e.Link != "a/lib.js" || e.CompressedSize != 0 || e.Size != size {
+				t.Errorf("Unexpected link entry %+v", e)
+			}
+			links = append(links, e.Name)
+		}
+	}
+	if want := []string{"b/lib.js", "c/d/lib.js"}; !slices.Equal(links, want) {
+		t.Errorf("Expected links %v, got %v", want, links)
+	}
+
+	stats := r.Stats()
+	if stats != b.Stats() {
+		t.Errorf("Reader stats %+v differ from Builder stats %+v", stats, b.Stats())
+	}
+	original := r.Entries()[0].CompressedSize
+	if stats.Entries != 4 || stats.Links != 2 || stats.DedupSaved != 2*original || stats.Size != 3*size+16 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	var out bytes.Buffer
+	FprintEntries(&out, r)
+	for _, want := range []string{"b/lib.js (= a/lib.js)\n", "合計: 4 エントリ", "重複: 2 エントリ（"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected listing to contain %q\n%s", want, out.String())
+		}
+	}
+}
+
+func TestBuilder_DedupHashCollision(t *testing.T) {
+	// すべての内容が同じハッシュになっても、内容の違うエントリはリンクにしない
+	defer func(h func([]byte) [sha256.Size]byte) { hashContent = h }(hashContent)
+	hashContent = func([]byte) [sha256.Size]byte { return [sha256.Size]byte{} }
+
+	b := NewBuilder()
+	for _, f := range []struct{ name, data string }{
+		{"a.txt", "apple"}, {"b.txt", "lemon"}, {"c.txt", "apple"}, {"d.txt", "lemon"},
+	} {
+		if err := b.AddFile(f.name, []byte(f.data), "rle"); err != nil {
+			t.Fatalf("AddFile(%s) failed: %v", f.name, err)
+		}
+	}
+	r, err := OpenBytes(b.Bytes())
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	var links []string
+	for _, e := range r.Entries() {
+		links = append(links, e.Link)
+	}
+	if want := []string{"", "", "a.txt", "b.txt"}; !slices.Equal(links, want) {
+		t.Errorf("Expected links %q, got %q", want, links)
+	}
+	if data, _ := r.ReadFile("d.txt"); string(data) != "lemon" {
+		t.Errorf("Expected d.txt to read %q, got %q", "lemon", data)
+	}
+}
+
+func TestOpenBytes_Version1(t *testing.T) {
+	// バージョン1のバンドル（リンクなし）も開ける
+	v1 := append([]byte(magic), versionNoLinks, 2)
+	var members []byte
+	for _, name := range []string{"a.txt", "b/c.txt"} {
+		v1 = binary.AppendUvarint(v1, uint64(len(name)))
+		v1 = append(v1, name...)
+		member, err := container.EncodeMember("rle", rle.NewCompressor(), []byte("same"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, member...)
+	}
+	r, err := OpenBytes(append(v1, members...))
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	for _, e := range r.Entries() {
+		data, err := r.ReadFile(e.Name)
+		if err != nil || string(data) != "same" || e.Link != "" {
+			t.Errorf("%s: expected an entry with its own content, got %+v %q (err %v)", e.Name, e, data, err)
+		}
+	}
+}
+
+func TestOpenBytes_InvalidLinks(t *testing.T) {
+	bundle := func(links ...uint64) []byte {
+		data := append([]byte(magic), versionNoSymlinks, byte(len(links)))
+		stored := 0
+		for i, link := range links {
+			data = append(data, 1, byte('a'+i))
+			data = binary.AppendUvarint(data, link)
+			if link == 0 {
+				stored++
+			}
+		}
+		for range stored {
+			member, _ := container.EncodeMember("rle", rle.NewCompressor(), []byte("x"))
+			data = append(data, member...)
+		}
+		return data
+	}
+
+	if _, err := OpenBytes(bundle(0, 1, 1)); err != nil {
+		t.Fatalf("Expected valid links to open, got %v", err)
+	}
+	tests := map[string][]byte{
+		"自分へのリンク":   bundle(1),
+		"後ろへのリンク":   bundle(2, 0),
+		"リンクへのリンク":  bundle(0, 1, 2),
+		"メンバーの数が違う": append(bundle(0, 1), bundle(0)[len(magic)+5:]...), // 余分なメンバー
+	}
+	for name, data := range tests {
+		if _, err := OpenBytes(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// zipTree は ZipWriter のテスト用のディレクトリです（圧縮できるファイルと乱数のファイル）
+func zipTree() fstest.MapFS {
+	text := bytes.Repeat([]byte("tiny zip zap: a small collection of toy compressors\n"), 20)
+	return fstest.MapFS{
+		"README.txt":      {Data: text},
+		"img/noise.bin":   {Data: testcorpus.Random(4096, 1)},
+		"src/a/b.go":      {Data: []byte("package a\n\nfunc B() {}\n")},
+		"src/a/empty.txt": {Data: []byte{}},
+	}
+}
+
+func TestZipWriter_ReadBackWithArchiveZip(t *testing.T) {
+	tree := zipTree()
+	var buf bytes.Buffer
+	w := NewZipWriter(&buf)
+	if err := WriteFS(w, tree); err != nil {
+		t.Fatalf("WriteFS failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("archive/zip cannot read the output: %v", err)
+	}
+	if len(zr.File) != len(tree) {
+		t.Fatalf("Expected %d files, got %d", len(tree), len(zr.File))
+	}
+	var want Stats
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(data, tree[f.Name].Data) {
+			t.Errorf("%s: content mismatch (err %v)", f.Name, err)
+		}
+		// 乱数や小さなファイルは deflate で小さくならないので格納する
+		wantMethod := zip.Store
+		if f.Name == "README.txt" {
+			wantMethod = zip.Deflate
+		}
+		if f.Method != wantMethod {
+			t.Errorf("%s: expected method %d, got %d", f.Name, wantMethod, f.Method)
+		}
+		want.addStored(int64(f.UncompressedSize64), int64(f.CompressedSize64))
+	}
+	if got := w.Stats(); got != want {
+		t.Errorf("Expected stats %+v, got %+v", want, got)
+	}
+
+	if err := w.AddFile("../evil", nil); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tree := zipTree()
+	for _, format := range []string{"tza", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			var w ArchiveWriter = NewZipWriter(&buf)
+			if format == "tza" {
+				w = NewWriter(&buf, "lz77")
+			}
+			if err := WriteFS(w, tree); err != nil {
+				t.Fatalf("WriteFS failed: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			if r.Stats() != w.Stats() {
+				t.Errorf("Expected reader stats %+v to match writer stats %+v", r.Stats(), w.Stats())
+			}
+			dir := filepath.Join(t.TempDir(), "out")
+			if err := Extract(r, dir); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			for name, f := range tree {
+				got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil || !bytes.Equal(got, f.Data) {
+					t.Errorf("%s: content mismatch (err %v)", name, err)
+				}
+			}
+
+			var out bytes.Buffer
+			FprintEntries(&out, r)
+			if !strings.Contains(out.String(), "合計: 4 エントリ") {
+				t.Errorf("Unexpected listing:\n%s", out.String())
+			}
+		})
+	}
+
+	if _, err := Open([]byte("TZZ\x01")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestZip_Unsafe(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"ok.txt", "../evil.txt"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(name))
+	}
+	zw.Close()
+
+	if _, err := OpenZip(buf.Bytes()); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Expected ErrInvalidName for a zip-slip entry, got %v", err)
+	}
+
+	// 開くときの確認を経ない ArchiveReader でも、何も書き込まない
+	zr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	r := &ZipReader{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		r.entries = append(r.entries, Entry{Name: f.Name})
+		r.files[f.Name] = f
+	}
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "out")
+	if err := Extract(r, dir); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Expected ErrInvalidName, got %v", err)
+	}
+	for _, path := range []string{filepath.Join(dir, "ok.txt"), filepath.Join(parent, "evil.txt")} {
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected %s not to be written, got %v", path, err)
+		}
+	}
+}
+
+func TestExtractWithOptions_Existing(t *testing.T) {
+	tree := zipTree()
+	var buf bytes.Buffer
+	w := NewZipWriter(&buf)
+	if err := WriteFS(w, tree); err != nil {
+		t.Fatalf("WriteFS failed: %v", err)
+	}
+	w.Close()
+	r, err := Open(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// setup は README.txt を同じ内容で、src/a/b.go を異なる内容で置いた展開先を作ります
+	setup := func(t *testing.T, differs bool) string {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "README.txt"), tree["README.txt"].Data, 0644)
+		if differs {
+			os.MkdirAll(filepath.Join(dir, "src", "a"), 0755)
+			os.WriteFile(filepath.Join(dir, "src", "a", "b.go"), []byte("package old\n"), 0644)
+		}
+		return dir
+	}
+	// written は展開で新しく書き込まれたかを img/noise.bin で確認します
+	written := func(dir string) bool {
+		_, err := os.Stat(filepath.Join(dir, "img", "noise.bin"))
+		return err == nil
+	}
+
+	tests := []struct {
+		name     string
+		opts     ExtractOptions
+		differs  bool
+		expected error
+		result   ExtractResult
+	}{
+		{"refuse", ExtractOptions{}, false, fileutil.ErrExists, ExtractResult{}},
+		{"overwrite", ExtractOptions{Overwrite: true}, true, nil, ExtractResult{Written: 4}},
+		{"skip", ExtractOptions{SkipExisting: true}, true, nil, ExtractResult{Written: 2, Skipped: 2}},
+		{"verify identical", ExtractOptions{VerifyExisting: true}, false, nil, ExtractResult{Written: 3, Identical: 1}},
+		{"verify differs", ExtractOptions{VerifyExisting: true}, true, fileutil.ErrDiffers, ExtractResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t, tt.differs)
+			result, err := ExtractWithOptions(r, dir, tt.opts)
+			if tt.expected != nil {
+				if !errors.Is(err, tt.expected) {
+					t.Fatalf("Expected %v, got %v", tt.expected, err)
+				}
+				if written(dir) {
+					t.Error("Expected nothing to be written after a refused entry")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractWithOptions failed: %v", err)
+			}
+			if result != tt.result {
+				t.Errorf("Expected %+v, got %+v", tt.result, result)
+			}
+			if !written(dir) {
+				t.Error("Expected new entries to be written")
+			}
+			got, _ := os.ReadFile(filepath.Join(dir, "src", "a", "b.go"))
+			if overwritten := bytes.Equal(got, tree["src/a/b.go"].Data); overwritten == (tt.opts.SkipExisting && tt.differs) {
+				t.Errorf("Unexpected src/a/b.go content %q", got)
+			}
+		})
+	}
+}
+
+// syntheticTree は n 個のファイルを階層に分けて並べた木を作成します
+// 同じ内容のファイル（リンクになる）や空のファイルも含めます。
+func syntheticTree(n int) fstest.MapFS {
+	tree := fstest.MapFS{}
+	for i := range n {
+		var data []byte
+		switch i % 5 {
+		case 0:
+			data = bytes.Repeat([]byte(fmt.Sprintf("file %d: tiny zip zap\n", i)), 1+i%40)
+		case 1:
+			data = testcorpus.Random(512+i, int64(i))
+		case 2:
+			data = []byte("shared content\n") // 同じ内容
+		case 3:
+			data = testcorpus.Cycle(100 + i)
+		}
+		tree[fmt.Sprintf("d%02d/s%d/f%03d.dat", i%17, i%3, i)] = &fstest.MapFile{Data: data}
+	}
+	return tree
+}
+
+// writeTree は fsys を WriteFSParallel で format（tza か zip）のアーカイブにします
+func writeTree(t *testing.T, format string, fsys fs.FS, opts ...WriteOption) ([]byte, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := ArchiveWriter(NewZipWriter(&buf))
+	if format == "tza" {
+		w = NewWriter(&buf, "lz77")
+	}
+	err := WriteFSParallel(w, fsys, opts...)
+	if cerr := w.Close(); cerr != nil {
+		t.Fatal(cerr)
+	}
+	return buf.Bytes(), err
+}
+
+func TestWriteFSParallel_Deterministic(t *testing.T) {
+	tree := syntheticTree(500)
+	for _, format := range []string{"tza", "zip"} {
+		// 1つずつ追加する WriteFS と同じ出力になる
+		var buf bytes.Buffer
+		w := ArchiveWriter(NewZipWriter(&buf))
+		if format == "tza" {
+			w = NewWriter(&buf, "lz77")
+		}
+		if err := WriteFS(w, tree); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		serial, err := writeTree(t, format, tree, WithWorkers(1))
+		if err != nil {
+			t.Fatalf("%s: -p 1 failed: %v", format, err)
+		}
+		parallel, err := writeTree(t, format, tree, WithWorkers(8))
+		if err != nil {
+			t.Fatalf("%s: -p 8 failed: %v", format, err)
+		}
+		if !bytes.Equal(serial, parallel) || !bytes.Equal(serial, buf.Bytes()) {
+			t.Fatalf("%s: archives differ between 1 and 8 workers", format)
+		}
+
+		ar, err := Open(parallel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(ar.Entries()); n != 500 {
+			t.Errorf("%s: expected 500 entries, got %d", format, n)
+		}
+		for _, name := range []string{"d05/s2/f005.dat", "d16/s1/f424.dat"} {
+			if got, err := ar.ReadFile(name); err != nil || !bytes.Equal(got, tree[name].Data) {
+				t.Errorf("%s: %s differs (err %v)", format, name, err)
+			}
+		}
+	}
+}
+
+// faultyFS は names のファイルの読み込みを失敗させ、読み込んだファイルを数えます
+type faultyFS struct {
+	fs.FS
+	names map[string]bool
+	reads atomic.Int32
+}
+
+var errFault = errors.New("injected read failure")
+
+func (f *faultyFS) Open(name string) (fs.File, error) {
+	if f.names[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errFault}
+	}
+	if strings.HasSuffix(name, ".dat") {
+		f.reads.Add(1)
+	}
+	return f.FS.Open(name)
+}
+
+func TestWriteFSParallel_Errors(t *testing.T) {
+	tree := syntheticTree(500)
+	bad := map[string]bool{"d03/s2/f020.dat": true, "d15/s1/f100.dat": true, "d10/s2/f299.dat": true}
+
+	for _, workers := range []int{1, 8} {
+		fsys := &faultyFS{FS: tree, names: bad}
+		data, err := writeTree(t, "zip", fsys, WithWorkers(workers))
+		var failed FileErrors
+		if !errors.As(err, &failed) || len(failed) != len(bad) || !errors.Is(err, errFault) {
+			t.Fatalf("p=%d: expected %d file errors, got %v", workers, len(bad), err)
+		}
+		// walk の順に並び、残りのファイルはすべて追加されている
+		if failed[0].Name != "d03/s2/f020.dat" || failed[2].Name != "d15/s1/f100.dat" {
+			t.Errorf("p=%d: unexpected order %v", workers, err)
+		}
+		ar, err := Open(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(ar.Entries()); n != 500-len(bad) {
+			t.Errorf("p=%d: expected %d entries, got %d", workers, 500-len(bad), n)
+		}
+
+		// -fail-fast: 最初のエラーで止め、残りのファイルは読み込まない
+		fsys = &faultyFS{FS: tree, names: bad}
+		_, err = writeTree(t, "zip", fsys, WithWorkers(workers), WithFailFast(true))
+		var fe *FileError
+		if !errors.As(err, &fe) || fe.Name != "d03/s2/f020.dat" || errors.As(err, &failed) {
+			t.Errorf("p=%d: expected the first file error, got %v", workers, err)
+		}
+		if n := int(fsys.reads.Load()); n >= 500-len(bad) {
+			t.Errorf("p=%d: expected fail-fast to stop reading, read %d files", workers, n)
+		}
+	}
+}
+
+func TestWriteFSParallel_Filter(t *testing.T) {
+	tree := fstest.MapFS{
+		"a.txt":               {Data: []byte("a")},
+		"big.bin":             {Data: make([]byte, 2000)},
+		"debug.log":           {Data: []byte("log")},
+		"src/main.go":         {Data: []byte("package main")},
+		"src/gen/x.log":       {Data: []byte("log")},
+		"node_modules/m.js":   {Data: []byte("js")},
+		"node_modules/n/o.js": {Data: []byte("js")},
+		"pipe":                {Mode: fs.ModeNamedPipe},
+		"dev/null":            {Mode: fs.ModeDevice | fs.ModeCharDevice},
+	}
+	filter := Filter{Exclude: []string{"*.log", "node_modules"}, MaxFileSize: 1000}
+
+	for _, workers := range []int{1, 4} {
+		skipped := map[string]SkipReason{}
+		data, err := writeTree(t, "zip", tree, WithWorkers(workers), WithFilter(filter),
+			WithSkipped(func(name string, reason SkipReason) { skipped[name] = reason }))
+		if err != nil {
+			t.Fatalf("p=%d: %v", workers, err)
+		}
+		ar, err := Open(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range ar.Entries() {
+			names = append(names, e.Name)
+		}
+		if want := []string{"a.txt", "src/main.go"}; !slices.Equal(names, want) {
+			t.Errorf("p=%d: expected entries %v, got %v", workers, want, names)
+		}
+		// 除外したディレクトリは1つとして報告し、中はたどらない
+		want := map[string]SkipReason{
+			"big.bin": SkipTooLarge, "debug.log": SkipExcluded, "src/gen/x.log": SkipExcluded,
+			"node_modules": SkipExcluded, "pipe": SkipSpecial, "dev/null": SkipSpecial,
+		}
+		if !reflect.DeepEqual(skipped, want) {
+			t.Errorf("p=%d: expected skipped %v, got %v", workers, want, skipped)
+		}
+	}
+
+	// Include は一致しないファイルを SkipNotIncluded にする
+	var notIncluded []string
+	data, err := writeTree(t, "tza", tree, WithFilter(Filter{Include: []string{"src/**"}}),
+		WithSkipped(func(name string, reason SkipReason) {
+			if reason == SkipNotIncluded {
+				notIncluded = append(notIncluded, name)
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar, err := Open(data); err != nil || len(ar.Entries()) != 2 {
+		t.Errorf("Expected the 2 files under src, got %v (err %v)", ar, err)
+	}
+	if len(notIncluded) != 5 {
+		t.Errorf("Expected 5 files not included, got %v", notIncluded)
+	}
+
+	// WithRejectSpecial: 特殊なファイルは読み込まずに失敗したファイルとして報告する
+	_, err = writeTree(t, "zip", tree, WithRejectSpecial(true))
+	var failed FileErrors
+	if !errors.As(err, &failed) || len(failed) != 2 || failed[0].Name != "dev/null" || !errors.Is(err, ErrSpecialFile) {
+		t.Errorf("Expected 2 special file errors, got %v", err)
+	}
+
+	if _, err := writeTree(t, "zip", tree, WithFilter(Filter{Exclude: []string{"["}})); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Expected ErrBadPattern, got %v", err)
+	}
+}
+
+// slowWriter は AddFile の間、圧縮を終えて追加を待っているファイルの最大数を記録します
+type slowWriter struct {
+	ArchiveWriter
+	prepared, added atomic.Int32
+	maxWaiting      int32
+}
+
+func (s *slowWriter) prepare(name string, data []byte) (func() error, error) {
+	s.prepared.Add(1)
+	return func() error {
+		time.Sleep(100 * time.Microsecond)
+		s.maxWaiting = max(s.maxWaiting, s.prepared.Load()-s.added.Load())
+		s.added.Add(1)
+		return s.ArchiveWriter.AddFile(name, data)
+	}, nil
+}
+
+func TestWriteFSParallel_Backpressure(t *testing.T) {
+	// 追加が遅くても、圧縮を終えて待っているファイルは並列数程度に収まる
+	w := &slowWriter{ArchiveWriter: NewZipWriter(io.Discard)}
+	if err := WriteFSParallel(w, syntheticTree(200), WithWorkers(4)); err != nil {
+		t.Fatal(err)
+	}
+	if w.maxWaiting > 4 {
+		t.Errorf("Expected at most 4 prepared files waiting, got %d", w.maxWaiting)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	b := NewBuilder()
+	for _, a := range testAssets() {
+		b.AddFile(a.name, a.data, a.algo)
+	}
+	b.AddFile("copy/site.css", testAssets()[0].data, "rle")
+	bundle := b.Bytes()
+
+	info, err := container.Inspect(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	r, _ := OpenBytes(bundle)
+	want := make([]container.EntryInfo, 0, len(r.Entries()))
+	for _, e := range r.Entries() {
+		want = append(want, container.EntryInfo{Name: e.Name, Algorithm: e.Algorithm, Size: e.Size,
+			CompressedSize: e.CompressedSize, CRC: e.CRC, Link: e.Link})
+	}
+	if info.Format != FormatTza || info.Version != versionNoSymlinks || len(info.Members) != 3 || !slices.Equal(info.Entries, want) {
+		t.Errorf("Unexpected info %+v, expected entries %+v", info, want)
+	}
+	if s := r.Stats(); info.OriginalSize != s.Size || info.CompressedSize != s.CompressedSize {
+		t.Errorf("Expected sizes %d -> %d, got %d -> %d", s.Size, s.CompressedSize, info.OriginalSize, info.CompressedSize)
+	}
+	var out bytes.Buffer
+	container.FprintInfo(&out, info)
+	if !strings.Contains(out.String(), "copy/site.css (= css/site.css)") {
+		t.Errorf("Expected the link in the output:\n%s", out.String())
+	}
+
+	// 最後のメンバーが途中で切れたバンドルは、読めたエントリまでを報告する
+	info, err = container.Inspect(bytes.NewReader(bundle[:len(bundle)-2]))
+	if err != nil || !info.Truncated || len(info.Entries) != 2 {
+		t.Errorf("Expected 2 entries before the truncated member, got %+v (err %v)", info, err)
+	}
+	// 名前の表が壊れたバンドルはエラーにする
+	if _, err := container.Inspect(bytes.NewReader(bundle[:6])); err == nil {
+		t.Error("Expected an error for a truncated name table")
+	}
+
+	var zipped bytes.Buffer
+	w := NewZipWriter(&zipped)
+	WriteFS(w, zipTree())
+	w.Close()
+	zr, _ := OpenZip(zipped.Bytes())
+	info, err = container.Inspect(bytes.NewReader(zipped.Bytes()))
+	if err != nil || info.Format != FormatZip || len(info.Entries) != len(zr.Entries()) || info.OriginalSize != zr.Stats().Size {
+		t.Errorf("Unexpected zip info %+v (err %v)", info, err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package archive
+
+import "io/fs"
+
+// fileID はファイルを識別する (dev, inode) です
+type fileID struct {
+	dev, ino uint64
+}
+
+// idOf は (dev, inode) を取得できないOSの代わりで、常に false を返します
+// WithFollowSymlinks の循環は maxFollowDepth の上限だけで止めます。
+func idOf(fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
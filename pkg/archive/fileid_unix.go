@@ -0,0 +1,22 @@
+//go:build unix
+
+package archive
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID はファイルを識別する (dev, inode) です
+type fileID struct {
+	dev, ino uint64
+}
+
+// idOf は info のファイルの (dev, inode) を返します（取得できない場合は false）
+func idOf(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
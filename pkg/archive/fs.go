@@ -0,0 +1,144 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// FS は Reader のエントリを fs.FS として見せます
+// ディレクトリはエントリの名前から作られ、http.FS や template.ParseFS などにそのまま渡せます。
+// ファイルは Open のたびに展開されます。シンボリックリンクは ReadDir で fs.ModeSymlink として
+// 見えますが、たどらないため Open と ReadFile は ErrSymlink を返します。
+func (r *Reader) FS() fs.FS {
+	return archiveFS{r}
+}
+
+// archiveFS は Reader の fs.FS です
+type archiveFS struct {
+	r *Reader
+}
+
+// Open は name のファイルまたはディレクトリを開きます
+func (f archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if i, ok := f.r.index[name]; ok {
+		data, err := f.r.ReadFile(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &file{info: fileInfo{entry: &f.r.entries[i]}, Reader: bytes.NewReader(data)}, nil
+	}
+	if _, ok := f.r.dirs[name]; ok {
+		return &dir{fs: f, name: name}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadFile は name のファイルを展開して返します（fs.ReadFileFS）
+func (f archiveFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.r.ReadFile(name)
+}
+
+// ReadDir は name のディレクトリの内容を名前順に返します（fs.ReadDirFS）
+func (f archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	children, ok := f.r.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = fs.FileInfoToDirEntry(f.stat(child))
+	}
+	return entries, nil
+}
+
+// stat は存在するファイルまたはディレクトリ name の情報を返します
+func (f archiveFS) stat(name string) fileInfo {
+	if i, ok := f.r.index[name]; ok {
+		return fileInfo{entry: &f.r.entries[i]}
+	}
+	return fileInfo{dir: name}
+}
+
+// fileInfo はエントリまたはディレクトリの fs.FileInfo です
+// 更新時刻は記録していないため、ゼロ値を返します
+type fileInfo struct {
+	entry *Entry // ファイルの場合
+	dir   string // ディレクトリの場合の名前
+}
+
+func (i fileInfo) Name() string {
+	if i.entry != nil {
+		return path.Base(i.entry.Name)
+	}
+	return path.Base(i.dir)
+}
+
+func (i fileInfo) Size() int64 {
+	if i.entry != nil {
+		return i.entry.Size
+	}
+	return 0
+}
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.entry != nil && i.entry.Symlink != "" {
+		return fs.ModeSymlink | 0777
+	}
+	if i.entry != nil {
+		return 0444
+	}
+	return fs.ModeDir | 0555
+}
+
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.entry == nil }
+func (i fileInfo) Sys() any           { return nil }
+
+// file は展開済みのエントリを読み出す fs.File です
+type file struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir はディレクトリの fs.ReadDirFile です
+type dir struct {
+	fs     archiveFS
+	name   string
+	offset int // ReadDir で返した数
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return fileInfo{dir: d.name}, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir はディレクトリの内容を n 個ずつ返します（fs.ReadDirFile の規則に従います）
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, _ := d.fs.ReadDir(d.name)
+	entries = entries[d.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
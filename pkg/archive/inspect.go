@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// container.Inspect でのアーカイブの形式の名前
+const (
+	FormatTza = "tza"
+	FormatZip = "zip"
+)
+
+func init() {
+	container.RegisterFormat(magic, inspectBundle)
+	container.RegisterFormat("PK\x03\x04", inspectZip)
+	container.RegisterFormat("PK\x05\x06", inspectZip)
+	common.RegisterFeature(common.Feature{
+		Name:        "tza",
+		Description: ".tza バンドル",
+		Versions:    []int{versionNoLinks, versionNoSymlinks, versionNoFlags, Version},
+	})
+}
+
+// inspectBundle はバンドルの名前の表とメンバーのヘッダーだけを読み込みます（container.InspectFunc）
+func inspectBundle(r io.ReaderAt, size int64) (container.Info, error) {
+	header := make([]byte, len(magic)+1)
+	if n, err := r.ReadAt(header, 0); n < len(header) {
+		return container.Info{}, fmt.Errorf("archive: invalid magic: %w", err)
+	}
+	version := header[len(magic)]
+	if err := checkVersion(version); err != nil {
+		return container.Info{}, err
+	}
+	start, flags := int64(len(header)), byte(0)
+	if version > versionNoFlags {
+		b := make([]byte, 1)
+		if n, err := r.ReadAt(b, start); n < len(b) {
+			return container.Info{}, fmt.Errorf("archive: truncated header: %w", err)
+		}
+		flags = b[0]
+		start++
+		if err := checkFlags(flags); err != nil {
+			return container.Info{}, err
+		}
+	}
+
+	section := io.NewSectionReader(r, start, size-start)
+	table := bufio.NewReader(section)
+	names, links, symlinks, stored, err := readNameTable(table, version, uint64(size-start))
+	if err != nil {
+		return container.Info{}, err
+	}
+	read, _ := section.Seek(0, io.SeekCurrent)
+	start += read - int64(table.Buffered())
+
+	info, err := container.InspectMembers(r, start, size)
+	if err != nil {
+		return info, fmt.Errorf("archive: %w", err)
+	}
+	if len(info.Members) != stored && !info.Truncated {
+		return info, fmt.Errorf("archive: %d stored entries but %d members", stored, len(info.Members))
+	}
+
+	info.Format, info.Version, info.OriginalSize, info.CompressedSize = FormatTza, version, 0, 0
+	info.Reproducible = flags&flagReproducible != 0
+	members := info.Members
+	for i, name := range names {
+		var e container.EntryInfo
+		if symlinks[i] != "" {
+			e = container.EntryInfo{Name: name, Symlink: symlinks[i]}
+		} else if link := links[i]; link >= 0 {
+			e = info.Entries[link]
+			e.Name, e.CompressedSize, e.Link = name, 0, names[link]
+		} else if len(members) > 0 {
+			m := members[0]
+			members = members[1:]
+			e = container.EntryInfo{
+				Name:           name,
+				Algorithm:      m.Algorithm,
+				Size:           int64(m.OriginalSize),
+				CompressedSize: int64(m.PayloadSize),
+				CRC:            m.CRC,
+			}
+			// Entry と同じく、ペイロードの形式バージョンの1バイトは含めない
+			if m.Version > 1 && m.PayloadSize > 0 {
+				e.CompressedSize--
+			}
+		} else {
+			// 不完全なメンバーより後のエントリは内容がない
+			break
+		}
+		info.Entries = append(info.Entries, e)
+		info.OriginalSize += e.Size
+		info.CompressedSize += e.CompressedSize
+	}
+	return info, nil
+}
+
+// inspectZip は zip の中央ディレクトリだけを読み込みます（container.InspectFunc）
+// ディレクトリのエントリは ZipReader と同じく含めません。シンボリックリンクはリンク先を読み込みます。
+func inspectZip(r io.ReaderAt, size int64) (container.Info, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return container.Info{}, fmt.Errorf("archive: %w", err)
+	}
+
+	info := container.Info{Format: FormatZip, Size: size, Reproducible: zr.Comment == zipReproducibleComment}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			target, err := readZipSymlink(f)
+			if err != nil {
+				return info, err
+			}
+			info.Entries = append(info.Entries, container.EntryInfo{Name: f.Name, Symlink: target})
+			continue
+		}
+		info.Entries = append(info.Entries, container.EntryInfo{
+			Name:           f.Name,
+			Algorithm:      zipMethodName(f.Method),
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			CRC:            f.CRC32,
+		})
+		info.OriginalSize += int64(f.UncompressedSize64)
+		info.CompressedSize += int64(f.CompressedSize64)
+	}
+	return info, nil
+}
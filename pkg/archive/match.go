@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Match は fsys 内のパス name がパターンに一致するかを返します
+// パターンは "/" 区切りで、各要素は path.Match の規則で name の要素と比べます。
+// 要素全体が "**" の場合は0個以上の要素に一致します（"a/**/b" は "a/b" にも "a/x/y/b" にも一致）。
+// "/" を含まないパターンは、どのディレクトリの名前にも一致します（"**/" を前に付けたのと同じ）。
+// パターンが正しくない場合は path.ErrBadPattern を返します。
+func Match(pattern, name string) (bool, error) {
+	if err := validPattern(pattern); err != nil {
+		return false, err
+	}
+	return matchSegments(patternSegments(pattern), strings.Split(name, "/")), nil
+}
+
+// validPattern はパターンの各要素が path.Match で使えるかを確認します
+func validPattern(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("%w: %q", err, pattern)
+		}
+	}
+	return nil
+}
+
+// patternSegments はパターンを要素に分けます（"/" を含まない場合は先頭に "**" を付けます）
+func patternSegments(pattern string) []string {
+	if !strings.Contains(pattern, "/") {
+		return []string{"**", pattern}
+	}
+	return strings.Split(strings.Trim(pattern, "/"), "/")
+}
+
+// matchSegments はパターンの要素 pat が名前の要素 name のすべてに一致するかを返します
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// 続く "**" は1つと同じ
+			for len(pat) > 0 && pat[0] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := range len(name) + 1 {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// SkipReason は WriteFSParallel がファイルを追加しなかった理由です
+type SkipReason int
+
+const (
+	SkipExcluded        SkipReason = iota // Filter.Exclude に一致した（ディレクトリの場合は中のファイルごと）
+	SkipNotIncluded                       // Filter.Include のどれにも一致しなかった
+	SkipTooLarge                          // Filter.MaxFileSize より大きい
+	SkipSpecial                           // 名前付きパイプ、デバイス、ソケットなどの通常のファイルでないもの
+	SkipSymlinkCycle                      // WithFollowSymlinks でたどると循環する（またはリンクが続きすぎる）シンボリックリンク
+	SkipExternalSymlink                   // WithFollowSymlinks で fsys の外を指すシンボリックリンク
+)
+
+func (r SkipReason) String() string {
+	switch r {
+	case SkipExcluded:
+		return "excluded"
+	case SkipNotIncluded:
+		return "not included"
+	case SkipTooLarge:
+		return "too large"
+	case SkipSpecial:
+		return "special file"
+	case SkipSymlinkCycle:
+		return "symlink cycle"
+	case SkipExternalSymlink:
+		return "external symlink"
+	}
+	return fmt.Sprintf("SkipReason(%d)", int(r))
+}
+
+// Filter はディレクトリから追加するファイルを選ぶ条件です（パターンの規則は Match）
+// ゼロ値はすべての通常のファイルを追加します。
+type Filter struct {
+	Include     []string // 空でない場合は、いずれかに一致するファイルだけを追加する
+	Exclude     []string // 一致するファイルと、一致するディレクトリの中のファイルを追加しない
+	MaxFileSize int64    // 0より大きい場合は、これより大きいファイルを追加しない
+}
+
+// Validate はすべてのパターンが正しいかを確認します
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if err := validPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip は fs.WalkDir で見つけた name を追加しないかどうかと、その理由を返します
+// パターンは Validate で確認済みとします。ルート（"."）は除外しません。
+func (f Filter) skip(name string, d fs.DirEntry) (SkipReason, bool) {
+	if name == "." {
+		return 0, false
+	}
+	if matchAny(f.Exclude, name) {
+		return SkipExcluded, true
+	}
+	if !d.Type().IsRegular() {
+		return 0, false
+	}
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return SkipNotIncluded, true
+	}
+	if f.MaxFileSize > 0 {
+		// 情報を読めない場合は追加を試み、読み込みのエラーとして報告する
+		if info, err := d.Info(); err == nil && info.Size() > f.MaxFileSize {
+			return SkipTooLarge, true
+		}
+	}
+	return 0, false
+}
+
+// matchAny は name が patterns のいずれかに一致するかを返します
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchSegments(patternSegments(pattern), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
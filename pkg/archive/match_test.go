@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		// "/" を含まないパターンはどのディレクトリの名前にも一致する
+		{"*.log", "a.log", true},
+		{"*.log", "x/y/a.log", true},
+		{"*.log", "a.log/b.txt", false},
+		{"tmp", "src/tmp", true},
+		{"a?c", "abc", true},
+
+		// "/" を含むパターンはルートからのパス
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "x/src/main.go", false},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"/build", "build", true},
+		{"/build", "x/build", false},
+
+		// "**" は0個以上の要素
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/c/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"**/testdata/**", "pkg/x/testdata/a/b.bin", true},
+		{"**/testdata/**", "testdata", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "b/c", false},
+		{"**/**/*.c", "x.c", true},
+		{"**", "anything/at/all", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/y/z/c", false},
+
+		// "**" でない "*" は区切りをまたがない
+		{"a/*", "a/b/c", false},
+		{"a**b", "axxb", true},
+		{"a**b", "ax/xb", false},
+	}
+	for _, tt := range tests {
+		got, err := Match(tt.pattern, tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, %v; want %v", tt.pattern, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatch_BadPattern(t *testing.T) {
+	for _, pattern := range []string{"[", "a/[x", "**/b[-]"} {
+		if _, err := Match(pattern, "a"); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Match(%q): expected ErrBadPattern, got %v", pattern, err)
+		}
+		if err := (Filter{Exclude: []string{pattern}}).Validate(); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Validate(%q): expected ErrBadPattern, got %v", pattern, err)
+		}
+	}
+	if err := (Filter{Include: []string{"**/*.go"}, Exclude: []string{"vendor"}}).Validate(); err != nil {
+		t.Errorf("Expected valid patterns, got %v", err)
+	}
+}
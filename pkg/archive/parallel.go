@@ -0,0 +1,415 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// errStopped は書き込み側が止まったため、ファイルを処理しなかったことを表します
+var errStopped = errors.New("archive: stopped")
+
+// ErrSpecialFile は WithRejectSpecial で、通常のファイルでないもの（名前付きパイプ、デバイス、ソケットなど）を見つけたことを表します
+var ErrSpecialFile = errors.New("archive: not a regular file")
+
+// WriteOption は WriteFSParallel の設定です
+type WriteOption func(*writeConfig)
+
+type writeConfig struct {
+	workers         int
+	failFast        bool
+	filter          Filter
+	rejectSpecial   bool
+	followSymlinks  bool
+	externalTargets bool
+	skipped         func(name string, reason SkipReason)
+}
+
+// WithWorkers は同時に読み込み・圧縮するファイルの数を設定します（1以下の場合は1）
+// 並列数によらず、エントリは fs.WalkDir の順に追加するため、同じ内容からは同じアーカイブになります。
+func WithWorkers(n int) WriteOption {
+	return func(c *writeConfig) {
+		c.workers = max(n, 1)
+	}
+}
+
+// WithFailFast は最初に失敗したファイルで処理を止めるかどうかを設定します
+// false（デフォルト）の場合は失敗したファイルを飛ばして残りを追加し、最後に FileErrors を返します。
+func WithFailFast(failFast bool) WriteOption {
+	return func(c *writeConfig) {
+		c.failFast = failFast
+	}
+}
+
+// WithFilter は追加するファイルを f で選びます
+// 除外したディレクトリの中はたどりません。パターンが正しくない場合、WriteFSParallel は何も追加せずにエラーを返します。
+func WithFilter(f Filter) WriteOption {
+	return func(c *writeConfig) {
+		c.filter = f
+	}
+}
+
+// WithRejectSpecial は通常のファイルでないもの（名前付きパイプ、デバイス、ソケットなど）の扱いを設定します
+// false（デフォルト）の場合は読み込まずに飛ばし（SkipSpecial）、true の場合は ErrSpecialFile の
+// *FileError として失敗したファイルに数えます。どちらの場合も読み込まないため、名前付きパイプで止まりません。
+// シンボリックリンクは WithFollowSymlinks の設定に従います。
+func WithRejectSpecial(reject bool) WriteOption {
+	return func(c *writeConfig) {
+		c.rejectSpecial = reject
+	}
+}
+
+// WithFollowSymlinks はシンボリックリンクをたどるかどうかを設定します
+// false（デフォルト）の場合はたどらず、fsys が DirFS ならリンク先を ArchiveWriter.AddSymlink で
+// 記録します（ReadLink のない fs.FS では何も報告せずに飛ばします）。true の場合はリンク先の
+// ファイルやディレクトリをリンクの名前で追加します。たどっているディレクトリ自身やその親を指す
+// リンク（(dev, inode) で判定）と、続くリンクや入れ子が多すぎるリンクは SkipSymlinkCycle として、
+// fsys の外を指すリンクは WithExternalTargets を指定しなければ SkipExternalSymlink として飛ばします。
+// fsys が DirFS でない場合はたどれないため、false と同じです。
+func WithFollowSymlinks(follow bool) WriteOption {
+	return func(c *writeConfig) {
+		c.followSymlinks = follow
+	}
+}
+
+// WithExternalTargets は WithFollowSymlinks で fsys の外を指すシンボリックリンクもたどるかどうかを設定します
+// "/etc" などを意図せずアーカイブに含めないよう、デフォルトではたどりません。
+func WithExternalTargets(allow bool) WriteOption {
+	return func(c *writeConfig) {
+		c.externalTargets = allow
+	}
+}
+
+// WithSkipped は追加しなかったファイル（除外したディレクトリを含む）ごとに fn を呼び出します
+// fn はディレクトリをたどるゴルーチンから、fs.WalkDir の順に1つずつ呼び出します。
+func WithSkipped(fn func(name string, reason SkipReason)) WriteOption {
+	return func(c *writeConfig) {
+		c.skipped = fn
+	}
+}
+
+// skip は name を追加しないかどうかを判定し、追加しない場合は WithSkipped の関数に知らせます
+func (c *writeConfig) skip(name string, d fs.DirEntry) bool {
+	reason, skip := c.filter.skip(name, d)
+	if !skip && isSpecial(d.Type()) && !c.rejectSpecial {
+		reason, skip = SkipSpecial, true
+	}
+	if skip {
+		c.report(name, reason)
+	}
+	return skip
+}
+
+// report は name を reason で追加しなかったことを WithSkipped の関数に知らせます
+func (c *writeConfig) report(name string, reason SkipReason) {
+	if c.skipped != nil {
+		c.skipped(name, reason)
+	}
+}
+
+// isSpecial は mode が通常のファイル、ディレクトリ、シンボリックリンクのどれでもないかを返します
+func isSpecial(mode fs.FileMode) bool {
+	return !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0
+}
+
+// FileError は1つのファイル（またはディレクトリ）を読み込めなかった、または圧縮できなかったエラーです
+type FileError struct {
+	Name string // fsys 内のパス
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("archive: %s: %v", e.Name, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileErrors は WriteFSParallel で追加できなかったファイルのエラーを、fs.WalkDir の順に並べたものです
+// 残りのファイルはアーカイブに追加済みです。
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	names := make([]string, len(e))
+	for i, fe := range e {
+		names[i] = fe.Name
+	}
+	return fmt.Sprintf("archive: %d files failed: %s", len(e), strings.Join(names, ", "))
+}
+
+func (e FileErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// preparer は圧縮とエントリの追加を分けられる ArchiveWriter です
+// prepare は複数のゴルーチンから同時に呼び出せ、返した関数はエントリを追加する順に1つずつ呼び出します。
+type preparer interface {
+	prepare(name string, data []byte) (add func() error, err error)
+}
+
+// fileTask は walk で見つけた1つのファイルと、その圧縮結果を受け取るチャネルです
+type fileTask struct {
+	name   string
+	result chan fileResult
+}
+
+type fileResult struct {
+	add func() error
+	err error
+}
+
+// WriteFSParallel は WriteFS と同じく fsys のすべての通常ファイルを w に追加します
+// ファイルの読み込みと圧縮は WithWorkers の数のゴルーチンで並行に行い、エントリの追加は
+// 並べ替えて fs.WalkDir の順に行うため、出力は並列数によらず WriteFS と同じになります。
+// 圧縮を終えて追加を待つファイルは最大で並列数までで、追加が遅れている間は次のファイルを
+// 読み込まないため、メモリ使用量はファイルの数によりません。
+// 読み込みや圧縮に失敗したファイルは飛ばして残りを追加し、最後に FileErrors を返します
+// （WithFailFast の場合は最初の *FileError で止めます）。w への追加に失敗した場合は、その時点で止めます。
+// WithFilter と WithRejectSpecial で追加するファイルを選べます。シンボリックリンクの扱いは
+// WithFollowSymlinks と WithExternalTargets で設定します。
+func WriteFSParallel(w ArchiveWriter, fsys fs.FS, opts ...WriteOption) error {
+	cfg := writeConfig{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.filter.Validate(); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	prepare := func(name string, data []byte) (func() error, error) {
+		return func() error { return w.AddFile(name, data) }, nil
+	}
+	if p, ok := w.(preparer); ok {
+		prepare = p.prepare
+	}
+
+	// pending は walk の順のファイルで、容量を超えると walk を待たせる
+	jobs := make(chan *fileTask)
+	pending := make(chan *fileTask, cfg.workers-1)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range jobs {
+				task.result <- prepareFile(fsys, task.name, prepare, done)
+			}
+		}()
+	}
+
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		walkErr <- newWalker(fsys, &cfg, w, pending, jobs, done).walk()
+	}()
+
+	var (
+		failed FileErrors
+		err    error
+	)
+	for task := range pending {
+		res := <-task.result
+		if res.err != nil {
+			fe := &FileError{Name: task.name, Err: res.err}
+			if cfg.failFast {
+				err = fe
+				break
+			}
+			failed = append(failed, fe)
+			continue
+		}
+		if err = res.add(); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		// walk と圧縮を止め、残りのファイルを捨てる
+		close(done)
+		for task := range pending {
+			<-task.result
+		}
+	}
+	wg.Wait()
+	if werr := <-walkErr; err == nil && werr != nil {
+		err = werr
+	}
+	if err == nil && len(failed) > 0 {
+		err = failed
+	}
+	return err
+}
+
+// walker は WriteFSParallel で fsys をたどり、見つけたファイルを walk の順に pending に並べます
+// 読み込みと圧縮が必要なファイルは jobs にも送り、それ以外（エラー、シンボリックリンク）は結果を直接設定します。
+// 1つのゴルーチンから使います。
+type walker struct {
+	fsys    fs.FS
+	links   linkFS // シンボリックリンクを読めない fsys の場合は nil
+	cfg     *writeConfig
+	w       ArchiveWriter
+	pending chan<- *fileTask
+	jobs    chan<- *fileTask
+	done    <-chan struct{}
+
+	dirs     map[string]fileID // WithFollowSymlinks でたどったディレクトリの (dev, inode)
+	followed map[string]bool   // たどったディレクトリのシンボリックリンク
+}
+
+func newWalker(fsys fs.FS, cfg *writeConfig, w ArchiveWriter, pending, jobs chan<- *fileTask, done <-chan struct{}) *walker {
+	links, _ := fsys.(linkFS)
+	return &walker{
+		fsys: fsys, links: links, cfg: cfg, w: w, pending: pending, jobs: jobs, done: done,
+		dirs: make(map[string]fileID), followed: make(map[string]bool),
+	}
+}
+
+// walk は fsys 全体をたどります
+func (wk *walker) walk() error {
+	return fs.WalkDir(wk.fsys, ".", wk.visit)
+}
+
+// visit は fs.WalkDir で見つけた name を処理します（fs.WalkDirFunc）
+func (wk *walker) visit(name string, d fs.DirEntry, err error) error {
+	if err == nil && wk.cfg.skip(name, d) {
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	}
+	if err == nil && d.IsDir() && wk.cfg.followSymlinks {
+		if info, err := d.Info(); err == nil {
+			if id, ok := idOf(info); ok {
+				wk.dirs[name] = id
+			}
+		}
+	}
+	symlink := err == nil && d.Type()&fs.ModeSymlink != 0
+	if symlink && wk.links != nil && wk.cfg.followSymlinks {
+		return wk.follow(name)
+	}
+	special := err == nil && isSpecial(d.Type())
+	if err == nil && !d.Type().IsRegular() && !special && (!symlink || wk.links == nil) {
+		return nil
+	}
+
+	task, err2 := wk.enqueue(name)
+	if err2 != nil {
+		return err2
+	}
+	switch {
+	case err != nil:
+		// 読めないディレクトリは報告して中を飛ばす（ルートなら walk が終わる）
+		task.result <- fileResult{err: err}
+		if d != nil && d.IsDir() {
+			return fs.SkipDir
+		}
+	case special:
+		// WithRejectSpecial: 読み込むと名前付きパイプで止まるため、読まずに失敗とする
+		task.result <- fileResult{err: ErrSpecialFile}
+	case symlink:
+		target, err := wk.links.ReadLink(name)
+		task.result <- fileResult{add: func() error { return wk.w.AddSymlink(name, target) }, err: err}
+	default:
+		select {
+		case wk.jobs <- task:
+		case <-wk.done:
+			task.result <- fileResult{err: errStopped}
+		}
+	}
+	return nil
+}
+
+// follow は WithFollowSymlinks でシンボリックリンク name のリンク先を、name の名前で追加します
+func (wk *walker) follow(name string) error {
+	external, err := wk.links.resolve(name)
+	switch {
+	case errors.Is(err, ErrSymlinkLoop):
+		wk.cfg.report(name, SkipSymlinkCycle)
+		return nil
+	case err == nil && external && !wk.cfg.externalTargets:
+		wk.cfg.report(name, SkipExternalSymlink)
+		return nil
+	}
+	var info fs.FileInfo
+	if err == nil {
+		info, err = fs.Stat(wk.fsys, name)
+	}
+	if err != nil {
+		// リンク先がないなど、たどれないリンクは読めないファイルとして報告する
+		task, err2 := wk.enqueue(name)
+		if err2 != nil {
+			return err2
+		}
+		task.result <- fileResult{err: err}
+		return nil
+	}
+
+	if !info.IsDir() {
+		return wk.visit(name, fs.FileInfoToDirEntry(info), nil)
+	}
+	if wk.cycle(name, info) {
+		wk.cfg.report(name, SkipSymlinkCycle)
+		return nil
+	}
+	wk.followed[name] = true
+	return fs.WalkDir(wk.fsys, name, wk.visit)
+}
+
+// cycle はディレクトリのシンボリックリンク name をたどると循環するかどうかを返します
+// リンク先 info が name の親のどれかと同じディレクトリの場合と、name の親でたどったリンクが
+// maxFollowDepth に達している場合は循環とします。
+func (wk *walker) cycle(name string, info fs.FileInfo) bool {
+	id, ok := idOf(info)
+	depth := 0
+	for dir := name; dir != "."; {
+		dir = parentDir(dir)
+		if seen, recorded := wk.dirs[dir]; ok && recorded && seen == id {
+			return true
+		}
+		if wk.followed[dir] {
+			depth++
+		}
+	}
+	return depth >= maxFollowDepth
+}
+
+// enqueue は name のタスクを walk の順に pending に並べます（書き込み側が止まっていれば errStopped）
+func (wk *walker) enqueue(name string) (*fileTask, error) {
+	task := &fileTask{name: name, result: make(chan fileResult, 1)}
+	select {
+	case wk.pending <- task:
+		return task, nil
+	case <-wk.done:
+		return nil, errStopped
+	}
+}
+
+// prepareFile は name を読み込んで圧縮します（done が閉じていれば何もしません）
+func prepareFile(fsys fs.FS, name string, prepare func(string, []byte) (func() error, error), done <-chan struct{}) fileResult {
+	select {
+	case <-done:
+		return fileResult{err: errStopped}
+	default:
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fileResult{err: err}
+	}
+	add, err := prepare(name, data)
+	return fileResult{add: add, err: err}
+}
+
+var (
+	_ preparer = (*bundleWriter)(nil)
+	_ preparer = (*ZipWriter)(nil)
+)
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// WriterOption は NewWriter と NewZipWriter の設定です
+type WriterOption func(*writerConfig)
+
+type writerConfig struct {
+	reproducible bool
+	epoch        time.Time
+}
+
+// WithReproducible は同じ内容のファイルから、追加した順やファイルシステムの更新日時によらず
+// 同じバイト列のアーカイブを書き込みます（再現可能なビルド用）
+// エントリは Close で名前順（バイト列の辞書順）に並べ替え、アーカイブのヘッダーに再現可能な
+// ことを記録します（inspect で確認できます）。.tza は更新日時や権限を記録しないため epoch は
+// 使いません。zip はすべてのエントリの更新日時を epoch（zip で表せる 1980〜2107 年に丸めた UTC、
+// ゼロ値の場合は 1980-01-01 00:00）にし、権限はファイルを 0644、シンボリックリンクを 0777 にします。
+// .tza は CapDeterministic を持たないアルゴリズムで圧縮できません（ErrNondeterministic）。
+func WithReproducible(epoch time.Time) WriterOption {
+	return func(c *writerConfig) {
+		c.reproducible = true
+		c.epoch = epoch
+	}
+}
+
+// ErrNondeterministic は再現可能なアーカイブに、同じ入力から同じ圧縮データを出力するとは
+// 限らない（common.CapDeterministic を持たない）アルゴリズムを使おうとしたことを表します
+var ErrNondeterministic = errors.New("archive: algorithm is not deterministic")
+
+// checkDeterministic は登録名 algo のアルゴリズムが CapDeterministic を持つかを確認します
+func checkDeterministic(algo string) error {
+	if d, ok := common.Describe(algo); ok && !d.Has(common.CapDeterministic) {
+		return fmt.Errorf("%w: %s", ErrNondeterministic, algo)
+	}
+	return nil
+}
+
+// sortedEntries は entries を名前順に並べ替えたものを返します
+// 同じ内容のエントリは、名前順で最初のものが内容を持ち、残りがそのエントリへのリンクに
+// なるように付け替えるため、追加した順によらず同じ並びになります。entries は変更しません。
+func sortedEntries(entries []builtEntry) []builtEntry {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return cmp.Compare(entries[a].name, entries[b].name)
+	})
+
+	sorted := make([]builtEntry, len(entries))
+	holder := make(map[int]int) // 内容を格納した元の位置 -> 並べ替えた後に内容を持つ位置
+	for i, j := range order {
+		e := entries[j]
+		if e.symlink != "" {
+			sorted[i] = e
+			continue
+		}
+		stored := j
+		if e.link >= 0 {
+			stored = e.link
+		}
+		if h, ok := holder[stored]; ok {
+			sorted[i] = builtEntry{name: e.name, link: h, size: e.size}
+			continue
+		}
+		holder[stored] = i
+		s := entries[stored]
+		sorted[i] = builtEntry{name: e.name, link: -1, size: s.size, member: s.member, body: s.body}
+	}
+	return sorted
+}
+
+// zipEpoch は zip で表せる範囲に丸めた t の MS-DOS 形式の更新日と時刻を返します
+// ゼロ値は zipModifiedDate（1980-01-01 00:00）です。MS-DOS 形式は2秒単位のため、秒は切り捨てます。
+func zipEpoch(t time.Time) (date, clock uint16) {
+	if t.IsZero() {
+		return zipModifiedDate, 0
+	}
+	t = t.UTC()
+	if minTime := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC); t.Before(minTime) {
+		t = minTime
+	}
+	if maxTime := time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC); t.After(maxTime) {
+		t = maxTime
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
@@ -0,0 +1,208 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// reproducibleFiles は再現可能なアーカイブのテスト用のファイルです
+// 同じ内容のファイル（リンクになる）と、fs.WalkDir の順と名前順が異なる名前（"a-b" と "a/b"）を含みます。
+var reproducibleFiles = map[string]string{
+	"a/b":          "nested\n",
+	"a-b":          "dash\n",
+	"z/last.txt":   strings.Repeat("tiny zip zap\n", 20),
+	"b/shared.txt": "shared content\n",
+	"a/shared.txt": "shared content\n",
+	"empty":        "",
+}
+
+// reproducibleTree は reproducibleFiles を dir に names の順で作成し、更新日時を mtime、権限を perm にします
+func reproducibleTree(t *testing.T, names []string, mtime time.Time, perm os.FileMode) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(reproducibleFiles[name]), perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// writeReproducible は dir を WithReproducible で format（tza か zip）のアーカイブにします
+func writeReproducible(t *testing.T, format, dir string, epoch time.Time) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := ArchiveWriter(NewZipWriter(&buf, WithReproducible(epoch)))
+	if format == "tza" {
+		w = NewWriter(&buf, "lz77", WithReproducible(epoch))
+	}
+	if err := WriteFSParallel(w, DirFS(dir), WithWorkers(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWithReproducible_SameTree(t *testing.T) {
+	names := make([]string, 0, len(reproducibleFiles))
+	for name := range reproducibleFiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	reversed := slices.Clone(names)
+	slices.Reverse(reversed)
+
+	first := reproducibleTree(t, names, time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC), 0644)
+	second := reproducibleTree(t, reversed, time.Now(), 0600)
+	epoch := time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+
+	for _, format := range []string{"tza", "zip"} {
+		a := writeReproducible(t, format, first, epoch)
+		b := writeReproducible(t, format, second, epoch)
+		if !bytes.Equal(a, b) {
+			t.Fatalf("%s: archives of the same tree differ", format)
+		}
+
+		ar, err := Open(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range ar.Entries() {
+			got = append(got, e.Name)
+			if data, err := ar.ReadFile(e.Name); err != nil || string(data) != reproducibleFiles[e.Name] {
+				t.Errorf("%s: %s differs (err %v)", format, e.Name, err)
+			}
+		}
+		if !slices.Equal(got, names) {
+			t.Errorf("%s: expected entries in name order %q, got %q", format, names, got)
+		}
+		if r, ok := ar.(interface{ Reproducible() bool }); !ok || !r.Reproducible() {
+			t.Errorf("%s: expected the reader to report a reproducible archive", format)
+		}
+
+		info, err := container.Inspect(bytes.NewReader(a))
+		if err != nil || !info.Reproducible {
+			t.Errorf("%s: expected inspect to report a reproducible archive, got %+v (err %v)", format, info, err)
+		}
+		var out bytes.Buffer
+		container.FprintInfo(&out, info)
+		if !strings.Contains(out.String(), "再現可能") {
+			t.Errorf("%s: expected the flag in the output:\n%s", format, out.String())
+		}
+	}
+}
+
+func TestWithReproducible_AddOrder(t *testing.T) {
+	build := func(names []string) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, "huffman", WithReproducible(time.Time{}))
+		for _, name := range names {
+			if err := w.AddFile(name, []byte(reproducibleFiles[name])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.AddSymlink("link", "a/b"); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// b/shared.txt を先に追加しても、名前順で最初の a/shared.txt が内容を持つ
+	a := build([]string{"z/last.txt", "b/shared.txt", "a-b", "a/shared.txt", "empty", "a/b"})
+	b := build([]string{"a/b", "a/shared.txt", "empty", "a-b", "b/shared.txt", "z/last.txt"})
+	if !bytes.Equal(a, b) {
+		t.Fatal("Expected the same bundle regardless of the order of AddFile")
+	}
+
+	r, err := OpenBytes(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Reproducible() || a[len(magic)] != Version || a[len(magic)+1] != flagReproducible {
+		t.Errorf("Expected version %d with the reproducible flag, got % x", Version, a[:len(magic)+2])
+	}
+	for _, e := range r.Entries() {
+		if e.Name == "b/shared.txt" && e.Link != "a/shared.txt" {
+			t.Errorf("Expected b/shared.txt to link to a/shared.txt, got %+v", e)
+		}
+	}
+	for name, want := range reproducibleFiles {
+		if data, err := r.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s differs (err %v)", name, err)
+		}
+	}
+
+	// フラグに知らないビットがあるバンドルは開けない
+	unknown := append([]byte(nil), a...)
+	unknown[len(magic)+1] |= 0x80
+	if _, err := OpenBytes(unknown); err == nil {
+		t.Error("Expected an error for unknown flags")
+	}
+	if _, err := container.Inspect(bytes.NewReader(unknown)); err == nil {
+		t.Error("Expected inspect to fail for unknown flags")
+	}
+}
+
+func TestWithReproducible_ZipEpoch(t *testing.T) {
+	tests := map[string]struct {
+		epoch time.Time
+		want  time.Time
+	}{
+		"ゼロ値は1980年":    {time.Time{}, time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"秒は2秒単位":       {time.Date(2024, 5, 6, 7, 8, 11, 0, time.UTC), time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)},
+		"UTC にする":      {time.Date(2024, 5, 6, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60)), time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)},
+		"1980年より前は丸める": {time.Unix(0, 0), time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"2107年より後は丸める": {time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)},
+	}
+	for name, tt := range tests {
+		var buf bytes.Buffer
+		w := NewZipWriter(&buf, WithReproducible(tt.epoch))
+		w.AddFile("file.txt", []byte("data"))
+		w.AddSymlink("link", "file.txt")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if zr.Comment != zipReproducibleComment {
+			t.Errorf("%s: expected comment %q, got %q", name, zipReproducibleComment, zr.Comment)
+		}
+		for _, f := range zr.File {
+			if got := f.FileHeader.ModTime(); !got.Equal(tt.want) {
+				t.Errorf("%s: %s: expected %v, got %v", name, f.Name, tt.want, got)
+			}
+		}
+	}
+
+	// WithReproducible でない zip はフラグを記録しない
+	var buf bytes.Buffer
+	w := NewZipWriter(&buf)
+	w.AddFile("file.txt", []byte("data"))
+	w.Close()
+	if zr, err := OpenZip(buf.Bytes()); err != nil || zr.Reproducible() {
+		t.Errorf("Expected a non-reproducible zip (err %v)", err)
+	}
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkHops はシンボリックリンクをたどるときに続けてたどるリンクの最大数です（Linux の ELOOP と同じ）
+const maxLinkHops = 40
+
+// maxFollowDepth は WithFollowSymlinks でたどるディレクトリのシンボリックリンクの入れ子の最大数です
+// (dev, inode) で循環を検出できないOSでも、ディレクトリをたどり続けないための上限です。
+const maxFollowDepth = 16
+
+// ErrSymlinkLoop はシンボリックリンクが maxLinkHops より多く続き、たどれなかったことを表します
+var ErrSymlinkLoop = errors.New("archive: too many levels of symbolic links")
+
+// DirFS は dir のディレクトリの fs.FS を返します
+// os.DirFS と同じですが、ReadLink でシンボリックリンクのリンク先を読めるため、WriteFSParallel で
+// シンボリックリンクをエントリとして記録したり、WithFollowSymlinks でたどったりできます
+// （os.DirFS などの ReadLink を持たない fs.FS では、シンボリックリンクは何も報告せずに飛ばします）。
+func DirFS(dir string) fs.FS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// dirFS は ReadLink を持つ os.DirFS です
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// linkFS はシンボリックリンクを読める fs.FS です（DirFS）
+type linkFS interface {
+	fs.FS
+	// ReadLink は name のシンボリックリンクのリンク先をそのまま返します
+	ReadLink(name string) (string, error)
+	// resolve は name のシンボリックリンクをすべてたどったパスが、ルートの外かどうかを返します
+	resolve(name string) (external bool, err error)
+}
+
+// ReadLink は name のシンボリックリンクのリンク先をそのまま返します
+func (f *dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(f.path(name))
+}
+
+// path は "/" 区切りの name の OS のパスを返します
+func (f *dirFS) path(name string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(name))
+}
+
+// resolve は name の各要素のシンボリックリンクを順にたどり、ルートの外に出るかどうかを返します
+// "/" で始まるリンク先と、".." でルートより上に出るリンク先は外とし、それ以上たどりません。
+// リンクが maxLinkHops より多く続く場合は ErrSymlinkLoop を返します。
+func (f *dirFS) resolve(name string) (bool, error) {
+	pending := strings.Split(name, "/")
+	var resolved []string // たどり終えた、シンボリックリンクを含まない要素
+	for hops := 0; len(pending) > 0; {
+		elem := pending[0]
+		pending = pending[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return true, nil
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, elem)
+		p := path.Join(resolved...)
+		info, err := os.Lstat(f.path(p))
+		if err != nil {
+			return false, err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if hops++; hops > maxLinkHops {
+			return false, &fs.PathError{Op: "resolve", Path: name, Err: ErrSymlinkLoop}
+		}
+		target, err := os.Readlink(f.path(p))
+		if err != nil {
+			return false, err
+		}
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+			return true, nil
+		}
+		resolved = resolved[:len(resolved)-1]
+		pending = append(strings.Split(filepath.ToSlash(target), "/"), pending...)
+	}
+	return false, nil
+}
+
+var _ linkFS = (*dirFS)(nil)
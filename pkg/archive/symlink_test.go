@@ -0,0 +1,276 @@
+//go:build unix
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// symlinkTree はシンボリックリンクを含むディレクトリを作成し、そのパスと外のディレクトリのパスを返します
+//
+//	file.txt, sub/x.txt
+//	link.txt -> file.txt      （ルートの中のファイル）
+//	sublink -> sub            （ルートの中のディレクトリ）
+//	a/to_b -> ../b, b/to_a -> ../a  （a → b → a の循環）
+//	loop1 -> loop2, loop2 -> loop1  （リンクだけの循環）
+//	ext -> 外のディレクトリ（secret.txt を含む）
+func symlinkTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root, outside = filepath.Join(base, "root"), filepath.Join(base, "outside")
+	files := map[string]string{
+		"root/file.txt":      "file",
+		"root/sub/x.txt":     "x",
+		"root/a/a.txt":       "a",
+		"root/b/b.txt":       "b",
+		"outside/secret.txt": "secret",
+	}
+	for name, data := range files {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"link.txt": "file.txt",
+		"sublink":  "sub",
+		"a/to_b":   "../b",
+		"b/to_a":   "../a",
+		"loop1":    "loop2",
+		"loop2":    "loop1",
+		"ext":      outside,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return root, outside
+}
+
+// entryMap はエントリの名前から、ファイルの内容またはシンボリックリンク先（"-> " を付ける）への対応を返します
+func entryMap(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	ar, err := Open(data)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	m := make(map[string]string)
+	for _, e := range ar.Entries() {
+		if e.Symlink != "" {
+			m[e.Name] = "-> " + e.Symlink
+			if _, err := ar.ReadFile(e.Name); !errors.Is(err, ErrSymlink) {
+				t.Errorf("%s: expected ErrSymlink, got %v", e.Name, err)
+			}
+			continue
+		}
+		content, err := ar.ReadFile(e.Name)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Name, err)
+		}
+		m[e.Name] = string(content)
+	}
+	return m
+}
+
+func TestWriteFSParallel_Symlinks(t *testing.T) {
+	root, outside := symlinkTree(t)
+
+	for _, format := range []string{"tza", "zip"} {
+		// デフォルトはたどらず、リンク先のパスを記録する
+		data, err := writeTree(t, format, DirFS(root), WithWorkers(4))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want := map[string]string{
+			"file.txt": "file", "sub/x.txt": "x", "a/a.txt": "a", "b/b.txt": "b",
+			"link.txt": "-> file.txt", "sublink": "-> sub", "a/to_b": "-> ../b", "b/to_a": "-> ../a",
+			"loop1": "-> loop2", "loop2": "-> loop1", "ext": "-> " + outside,
+		}
+		if got := entryMap(t, data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: default entries\n got %v\nwant %v", format, got, want)
+		}
+
+		// -follow-symlinks: 循環と外を指すリンクは飛ばす
+		skipped := map[string]SkipReason{}
+		data, err = writeTree(t, format, DirFS(root), WithWorkers(4), WithFollowSymlinks(true),
+			WithSkipped(func(name string, reason SkipReason) { skipped[name] = reason }))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want = map[string]string{
+			"file.txt": "file", "sub/x.txt": "x", "a/a.txt": "a", "b/b.txt": "b",
+			"link.txt": "file", "sublink/x.txt": "x", "a/to_b/b.txt": "b", "b/to_a/a.txt": "a",
+		}
+		if got := entryMap(t, data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: followed entries\n got %v\nwant %v", format, got, want)
+		}
+		wantSkipped := map[string]SkipReason{
+			"a/to_b/to_a": SkipSymlinkCycle, "b/to_a/to_b": SkipSymlinkCycle,
+			"loop1": SkipSymlinkCycle, "loop2": SkipSymlinkCycle, "ext": SkipExternalSymlink,
+		}
+		if !reflect.DeepEqual(skipped, wantSkipped) {
+			t.Errorf("%s: expected skipped %v, got %v", format, wantSkipped, skipped)
+		}
+
+		// WithExternalTargets: 外を指すリンクもたどる
+		data, err = writeTree(t, format, DirFS(root), WithFollowSymlinks(true), WithExternalTargets(true))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got := entryMap(t, data); got["ext/secret.txt"] != "secret" {
+			t.Errorf("%s: expected the external target to be added, got %v", format, got)
+		}
+	}
+
+	// ReadLink のない fs.FS では、これまでどおりシンボリックリンクを飛ばす
+	data, err := writeTree(t, "tza", os.DirFS(root), WithFollowSymlinks(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entryMap(t, data); len(got) != 4 {
+		t.Errorf("Expected only the 4 regular files, got %v", got)
+	}
+}
+
+// symlinkBundle はファイル1つと、中・外・絶対パスを指すシンボリックリンクのバンドルを作成します
+func symlinkBundle(t *testing.T) []byte {
+	t.Helper()
+	b := NewBuilder()
+	if err := b.AddFile("dir/file.txt", []byte("content"), "rle"); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range [][2]string{
+		{"dir/internal", "file.txt"},
+		{"up", "../victim"},
+		{"abs", "/etc/passwd"},
+	} {
+		if err := b.AddSymlink(link[0], link[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.AddSymlink("dir/internal/x", "y"); err == nil {
+		t.Error("Expected an error for an entry inside a symlink")
+	}
+	return b.Bytes()
+}
+
+func TestExtractWithOptions_Symlinks(t *testing.T) {
+	bundle := symlinkBundle(t)
+	r, err := OpenBytes(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Stats(); s.Entries != 4 || s.Symlinks != 3 || s.Size != 7 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	tests := []struct {
+		policy  SymlinkPolicy
+		created []string
+	}{
+		{SymlinkSkip, nil},
+		{SymlinkInternal, []string{"dir/internal"}},
+		{SymlinkAll, []string{"abs", "dir/internal", "up"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "out")
+			res, err := ExtractWithOptions(r, dir, ExtractOptions{Symlinks: tt.policy})
+			if err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if res.Written != 1 || res.Symlinks != len(tt.created) || res.SkippedSymlinks != 3-len(tt.created) {
+				t.Errorf("Unexpected result %+v", res)
+			}
+			var created []string
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && d.Type()&fs.ModeSymlink != 0 {
+					rel, _ := filepath.Rel(dir, path)
+					created = append(created, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if !reflect.DeepEqual(created, tt.created) {
+				t.Errorf("Expected symlinks %v, got %v", tt.created, created)
+			}
+			if tt.policy != SymlinkSkip {
+				if data, err := os.ReadFile(filepath.Join(dir, "dir", "internal")); err != nil || string(data) != "content" {
+					t.Errorf("Expected the internal link to resolve, got %q (err %v)", data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractWithOptions_DoesNotWriteThroughSymlinks(t *testing.T) {
+	parent := t.TempDir()
+	victim := filepath.Join(parent, "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(parent, "out")
+	if err := os.MkdirAll(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 展開先に外を指すシンボリックリンクが既にあっても、たどらずに置き換える
+	if err := os.Symlink(victim, filepath.Join(dir, "dir", "file.txt")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	r, err := OpenBytes(symlinkBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractWithOptions(r, dir, ExtractOptions{Overwrite: true, Symlinks: SymlinkAll}); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if data, _ := os.ReadFile(victim); string(data) != "keep" {
+		t.Errorf("Expected the link target to be untouched, got %q", data)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "dir", "file.txt"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected a regular file to replace the symlink, got %v (err %v)", info, err)
+	}
+
+	// 既存のシンボリックリンクとリンク先が同じなら同じ内容とする
+	res, err := ExtractWithOptions(r, dir, ExtractOptions{VerifyExisting: true, Symlinks: SymlinkAll})
+	if err != nil || res.Identical != 4 {
+		t.Errorf("Expected 4 identical entries, got %+v (err %v)", res, err)
+	}
+}
+
+func TestInspect_Symlinks(t *testing.T) {
+	bundle := symlinkBundle(t)
+	info, err := container.Inspect(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Version != versionNoFlags || len(info.Members) != 1 || len(info.Entries) != 4 || info.Entries[1].Symlink != "file.txt" {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	var out bytes.Buffer
+	container.FprintInfo(&out, info)
+	if !strings.Contains(out.String(), "dir/internal -> file.txt") {
+		t.Errorf("Expected the symlink in the output:\n%s", out.String())
+	}
+
+	r, _ := OpenBytes(bundle)
+	out.Reset()
+	FprintEntries(&out, r)
+	if !strings.Contains(out.String(), "abs -> /etc/passwd") || !strings.Contains(out.String(), "シンボリックリンク: 3 エントリ") {
+		t.Errorf("Unexpected listing:\n%s", out.String())
+	}
+}
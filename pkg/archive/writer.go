@@ -0,0 +1,381 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// ArchiveWriter はファイルを1つずつアーカイブに追加するインターフェースです
+// .tza（NewWriter）と .zip（NewZipWriter）のどちらにも同じ手順で書き込めます。
+type ArchiveWriter interface {
+	// AddFile は data を name のエントリとして追加します（name の規則は Builder.AddFile と同じ）
+	AddFile(name string, data []byte) error
+	// AddSymlink は target を指すシンボリックリンクを name のエントリとして追加します
+	AddSymlink(name, target string) error
+	// Stats は追加したエントリの統計を返します
+	Stats() Stats
+	// Close はアーカイブを書き終えます（出力先の io.Writer は閉じません）
+	Close() error
+}
+
+// ArchiveReader はアーカイブのエントリを読み出すインターフェースです
+// Reader（.tza）と ZipReader（.zip）が実装し、一覧の表示や Extract に使います。
+type ArchiveReader interface {
+	// Entries はエントリの一覧をアーカイブ内の順に返します
+	Entries() []Entry
+	// ReadFile はエントリ name を展開して返します
+	ReadFile(name string) ([]byte, error)
+	// Stats はアーカイブの統計を返します
+	Stats() Stats
+}
+
+// WriteFS は fsys のすべての通常ファイルを、fsys 内のパスを名前として w に追加します
+// ファイルは fs.WalkDir の順（名前順）に追加します。
+func WriteFS(w ArchiveWriter, fsys fs.FS) error {
+	return walkFiles(fsys, w.AddFile)
+}
+
+// bundleWriter は Builder で組み立てたバンドルを Close で書き込む ArchiveWriter です
+type bundleWriter struct {
+	b    *Builder
+	algo string
+	w    io.Writer
+}
+
+// NewWriter はすべてのエントリを登録名 algo のアルゴリズムで圧縮し、Close で
+// バンドル（.tza）を w に書き込む ArchiveWriter を作成します
+// WithReproducible を指定すると、エントリを名前順に並べて書き込みます。
+func NewWriter(w io.Writer, algo string, opts ...WriterOption) ArchiveWriter {
+	var cfg writerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	b := NewBuilder()
+	b.SetReproducible(cfg.reproducible)
+	return &bundleWriter{b: b, algo: algo, w: w}
+}
+
+func (bw *bundleWriter) AddFile(name string, data []byte) error {
+	return bw.b.AddFile(name, data, bw.algo)
+}
+
+func (bw *bundleWriter) AddSymlink(name, target string) error {
+	return bw.b.AddSymlink(name, target)
+}
+
+// prepare は data を圧縮し、エントリを追加する関数を返します（preparer）
+func (bw *bundleWriter) prepare(name string, data []byte) (func() error, error) {
+	c, err := common.New(bw.algo)
+	if err != nil {
+		return nil, err
+	}
+	if bw.b.reproducible {
+		if err := checkDeterministic(bw.algo); err != nil {
+			return nil, err
+		}
+	}
+	e, err := encodeEntry(name, data, bw.algo, c)
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return bw.b.addEncoded(e, data) }, nil
+}
+
+func (bw *bundleWriter) Stats() Stats {
+	return bw.b.Stats()
+}
+
+func (bw *bundleWriter) Close() error {
+	_, err := bw.w.Write(bw.b.Bytes())
+	return err
+}
+
+// IsArchive は header がバンドル（.tza）か zip のマジックで始まるかを返します
+func IsArchive(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(magic)) || isZip(header)
+}
+
+// Open は b のバンドル（.tza）または zip を開きます
+// どちらのマジックでも始まらない場合は ErrUnknownFormat を返します。
+func Open(b []byte) (ArchiveReader, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte(magic)):
+		return OpenBytes(b)
+	case isZip(b):
+		return OpenZip(b)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ErrUnknownFormat は Open に渡したデータがバンドルでも zip でもないことを表します
+var ErrUnknownFormat = errors.New("archive: unknown format")
+
+// Extract は r のすべてのエントリを dir の下に展開します（dir がなければ作成します）
+// "../" で始まるなど dir の外を指す名前があれば、何も書き込まずに ErrInvalidName を返します。
+// 書き込みは os.Root の中で行うため、dir 内のシンボリックリンクをたどって外に書き込むことも
+// ありません。既存のファイルは上書きします。シンボリックリンクのエントリは作成しません。
+func Extract(r ArchiveReader, dir string) error {
+	_, err := ExtractWithOptions(r, dir, ExtractOptions{Overwrite: true})
+	return err
+}
+
+// ExtractOptions は展開先に同じ名前のファイルがある場合と、シンボリックリンクのエントリの扱いです
+// Overwrite などをどれも指定しなければ、何も書き込まずに fileutil.ErrExists を返します。複数指定した場合は
+// Overwrite、VerifyExisting、SkipExisting の順に優先します。
+type ExtractOptions struct {
+	Overwrite      bool          // 上書きする
+	SkipExisting   bool          // 書き込まずに ExtractResult.Skipped に数える
+	VerifyExisting bool          // 内容が同じなら ExtractResult.Identical に数え、異なれば何も書き込まずに fileutil.ErrDiffers を返す
+	Symlinks       SymlinkPolicy // シンボリックリンクのエントリを作成するかどうか（ゼロ値は作成しない）
+}
+
+// SymlinkPolicy は展開でシンボリックリンクのエントリを作成するかどうかです
+type SymlinkPolicy int
+
+const (
+	SymlinkSkip     SymlinkPolicy = iota // 作成せずに ExtractResult.SkippedSymlinks に数える
+	SymlinkInternal                      // 展開先のディレクトリの中を指すものだけを作成する
+	SymlinkAll                           // "/" で始まるものや展開先の外を指すものも作成する
+)
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkSkip:
+		return "skip"
+	case SymlinkInternal:
+		return "internal"
+	case SymlinkAll:
+		return "all"
+	}
+	return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+}
+
+// creates は name から target へのシンボリックリンクを作成するかどうかを返します
+func (p SymlinkPolicy) creates(name, target string) bool {
+	switch p {
+	case SymlinkAll:
+		return true
+	case SymlinkInternal:
+		return isInternalTarget(name, target)
+	}
+	return false
+}
+
+// isInternalTarget は name のシンボリックリンクの target が、展開先のディレクトリの中を指すかを返します
+// "/" で始まる target や、".." で展開先の外に出る target は外を指すとします。
+func isInternalTarget(name, target string) bool {
+	t := filepath.FromSlash(target)
+	return !filepath.IsAbs(t) && filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(name)), t))
+}
+
+// ExtractResult は展開で書き込んだファイルと、既存のファイルのため書き込まなかったファイルの数です
+type ExtractResult struct {
+	Written         int
+	Skipped         int // SkipExisting で書き込まなかった
+	Identical       int // VerifyExisting で同じ内容だったため書き込まなかった
+	Symlinks        int // 作成したシンボリックリンク（Written には含めない）
+	SkippedSymlinks int // Symlinks の設定で作成しなかったシンボリックリンク
+}
+
+// ExtractWithOptions は opts に従って r のすべてのエントリを dir の下に展開します
+// 名前と既存のファイルをすべて確認してから書き込むため、エラーの場合は何も書き込みません。
+// シンボリックリンクはすべてのファイルを書き込んだ後に作成するため、作成したシンボリックリンクを
+// たどって書き込むことはありません。既存のシンボリックリンクに上書きする場合も、たどらずに
+// 置き換えます。
+func ExtractWithOptions(r ArchiveReader, dir string, opts ExtractOptions) (ExtractResult, error) {
+	var result ExtractResult
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return result, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return result, err
+	}
+	defer root.Close()
+
+	// 不正な名前があれば何も書き込まない
+	entries := r.Entries()
+	for _, e := range entries {
+		if !fs.ValidPath(e.Name) || !filepath.IsLocal(filepath.FromSlash(e.Name)) || strings.Contains(e.Name, `\`) {
+			return result, fmt.Errorf("%w: %q", ErrInvalidName, e.Name)
+		}
+	}
+
+	// 作成しないシンボリックリンクは既存のファイルも確認しない
+	skip := make(map[string]bool)
+	for _, e := range entries {
+		if e.Symlink != "" && !opts.Symlinks.creates(e.Name, e.Symlink) {
+			result.SkippedSymlinks++
+			skip[e.Name] = true
+		}
+	}
+
+	// 既存のファイルを書き込めない場合も何も書き込まない
+	for _, e := range entries {
+		if skip[e.Name] {
+			continue
+		}
+		skipped, identical, err := checkExisting(root, r, e, opts)
+		switch {
+		case err != nil:
+			return result, err
+		case identical:
+			result.Identical++
+		case skipped:
+			result.Skipped++
+		}
+		skip[e.Name] = skipped
+	}
+
+	for _, e := range entries {
+		if skip[e.Name] || e.Symlink != "" {
+			continue
+		}
+		name := filepath.FromSlash(e.Name)
+		data, err := r.ReadFile(e.Name)
+		if err != nil {
+			return result, err
+		}
+		if err := mkdirAll(root, path.Dir(e.Name)); err != nil {
+			return result, err
+		}
+		if err := removeSymlink(root, name); err != nil {
+			return result, err
+		}
+		f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return result, err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Written++
+	}
+
+	for _, e := range entries {
+		if skip[e.Name] || e.Symlink == "" {
+			continue
+		}
+		if err := createSymlink(root, e.Name, e.Symlink); err != nil {
+			return result, err
+		}
+		result.Symlinks++
+	}
+	return result, nil
+}
+
+// removeSymlink は root の中の name がシンボリックリンクなら削除します
+// 既存のシンボリックリンクをたどってリンク先に書き込まないように、書き込む前に呼び出します。
+func removeSymlink(root *os.Root, name string) error {
+	info, err := root.Lstat(name)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return nil
+	}
+	return root.Remove(name)
+}
+
+// createSymlink は root の中に target を指すシンボリックリンク name を作成します
+// 既存のファイルやシンボリックリンクは置き換えます。os.Root の外で作成するため、親の
+// ディレクトリにシンボリックリンクがあれば作成しません（リンクをたどって外に作成しないため）。
+func createSymlink(root *os.Root, name, target string) error {
+	if err := mkdirAll(root, path.Dir(name)); err != nil {
+		return err
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		info, err := root.Lstat(filepath.FromSlash(dir))
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("archive: %s: parent %s is not a directory", name, dir)
+		}
+	}
+	if err := root.Remove(filepath.FromSlash(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(target), filepath.Join(root.Name(), filepath.FromSlash(name)))
+}
+
+// checkExisting は root の中にエントリ e と同じ名前のファイルがあれば opts に従って確認し、
+// 書き込まないかどうか（VerifyExisting で同じ内容だった場合は identical も true）を返します
+// シンボリックリンクのエントリは、既存のシンボリックリンクのリンク先が同じ場合を同じ内容とします。
+func checkExisting(root *os.Root, r ArchiveReader, e Entry, opts ExtractOptions) (skipped, identical bool, err error) {
+	name := e.Name
+	info, err := root.Lstat(filepath.FromSlash(name))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, false, nil
+	case err != nil:
+		return false, false, err
+	case info.IsDir():
+		return false, false, fmt.Errorf("%w: %s", fileutil.ErrIsDirectory, name)
+	case opts.Overwrite:
+		return false, false, nil
+	case opts.VerifyExisting && (e.Symlink != "") != (info.Mode()&fs.ModeSymlink != 0):
+		return false, false, fmt.Errorf("%w: %s", fileutil.ErrDiffers, name)
+	case opts.VerifyExisting && e.Symlink != "":
+		target, err := os.Readlink(filepath.Join(root.Name(), filepath.FromSlash(name)))
+		if err != nil {
+			return false, false, err
+		}
+		if target != filepath.FromSlash(e.Symlink) {
+			return false, false, fmt.Errorf("%w: %s", fileutil.ErrDiffers, name)
+		}
+		return true, true, nil
+	case opts.VerifyExisting:
+		data, err := r.ReadFile(name)
+		if err != nil {
+			return false, false, err
+		}
+		f, err := root.Open(filepath.FromSlash(name))
+		if err != nil {
+			return false, false, err
+		}
+		defer f.Close()
+		same, err := fileutil.Identical(f, bytes.NewReader(data))
+		if err != nil {
+			return false, false, err
+		}
+		if !same {
+			return false, false, fmt.Errorf("%w: %s", fileutil.ErrDiffers, name)
+		}
+		return true, true, nil
+	case opts.SkipExisting:
+		return true, false, nil
+	default:
+		return false, false, fmt.Errorf("%w: %s", fileutil.ErrExists, name)
+	}
+}
+
+// mkdirAll は root の中に "/" 区切りのディレクトリ dir と、その親をすべて作成します
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := mkdirAll(root, path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(filepath.FromSlash(dir), 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+var (
+	_ ArchiveWriter = (*bundleWriter)(nil)
+	_ ArchiveReader = (*Reader)(nil)
+)
@@ -0,0 +1,329 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// zipModifiedDate は ZipWriter がすべてのエントリに記録するMS-DOS形式の更新日です
+// 同じ内容から同じ zip を作るため、実際の更新日時は使わず、zip で表せる最も古い
+// 1980-01-01 00:00 にします。CreateRaw は Modified から日時を設定しないため、直接指定します。
+const zipModifiedDate = 1<<5 | 1 // (年-1980)<<9 | 月<<5 | 日
+
+// zipReproducibleComment は WithReproducible で書き込んだ zip の終端レコードのコメントです
+const zipReproducibleComment = "tinyzipzap:reproducible"
+
+// ZipWriter は標準的な zip ファイルを書き込む ArchiveWriter です
+// エントリごとに deflate で圧縮し、元のサイズより小さくならない（圧縮済みの画像など）場合は
+// 圧縮せずに格納（store）します。unzip など一般的なツールで展開できます。
+// 同じ内容のファイルのリンクはなく、すべてのエントリが内容を持ちます。シンボリックリンクは
+// unzip と同じく、fs.ModeSymlink のモードでリンク先を内容として格納します。
+type ZipWriter struct {
+	zw    *zip.Writer
+	names nameSet
+	stats Stats
+
+	reproducible bool       // エントリを Close まで pending にためて、名前順に書き込む
+	date, clock  uint16     // すべてのエントリの更新日と時刻（MS-DOS 形式）
+	pending      []zipEntry // WithReproducible で書き込みを待つエントリ
+}
+
+// zipEntry は圧縮済みのエントリのヘッダーと内容です
+type zipEntry struct {
+	header *zip.FileHeader
+	body   []byte
+}
+
+// NewZipWriter は w に zip を書き込む ZipWriter を作成します
+// WithReproducible を指定すると、エントリを Close で名前順に並べ、更新日時を epoch にして書き込みます。
+func NewZipWriter(w io.Writer, opts ...WriterOption) *ZipWriter {
+	var cfg writerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	z := &ZipWriter{zw: zip.NewWriter(w), names: newNameSet(), reproducible: cfg.reproducible, date: zipModifiedDate}
+	if cfg.reproducible {
+		z.date, z.clock = zipEpoch(cfg.epoch)
+	}
+	return z
+}
+
+// AddFile は data を name のエントリとして追加します
+func (z *ZipWriter) AddFile(name string, data []byte) error {
+	if err := z.names.check(name); err != nil {
+		return err
+	}
+	header, body, err := deflateEntry(data)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", name, err)
+	}
+	header.Name = name
+	return z.addRaw(header, body, int64(len(data)))
+}
+
+// prepare は data を圧縮し、エントリを追加する関数を返します（preparer）
+func (z *ZipWriter) prepare(name string, data []byte) (func() error, error) {
+	header, body, err := deflateEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	return func() error {
+		if err := z.names.check(name); err != nil {
+			return err
+		}
+		return z.addRaw(header, body, int64(len(data)))
+	}, nil
+}
+
+// AddSymlink は target を指すシンボリックリンクを name のエントリとして追加します
+func (z *ZipWriter) AddSymlink(name, target string) error {
+	if err := z.names.check(name); err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("archive: %s: empty symlink target", name)
+	}
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(target)),
+		CompressedSize64:   uint64(len(target)),
+		UncompressedSize64: uint64(len(target)),
+	}
+	header.SetMode(fs.ModeSymlink | 0777)
+	if err := z.add(header, []byte(target)); err != nil {
+		return err
+	}
+	z.stats.addSymlink()
+	return nil
+}
+
+// deflateEntry は data を deflate で圧縮したエントリのヘッダー（名前を除く）と内容を作成します
+// 元のサイズより小さくならない場合は圧縮せずに格納します。ZipWriter を使わないため、
+// 複数のゴルーチンから同時に呼び出せます。
+func deflateEntry(data []byte) (*zip.FileHeader, []byte, error) {
+	var deflated bytes.Buffer
+	fw, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return nil, nil, err
+	}
+	fw.Write(data)
+	if err := fw.Close(); err != nil {
+		return nil, nil, err
+	}
+	method, body := zip.Deflate, deflated.Bytes()
+	if len(body) >= len(data) {
+		method, body = zip.Store, data
+	}
+
+	header := &zip.FileHeader{
+		Method:             method,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	header.SetMode(0644)
+	return header, body, nil
+}
+
+// addRaw は圧縮済みのエントリを追加します（名前は確認済みであること）
+func (z *ZipWriter) addRaw(header *zip.FileHeader, body []byte, size int64) error {
+	if err := z.add(header, body); err != nil {
+		return err
+	}
+	z.stats.addStored(size, int64(len(body)))
+	return nil
+}
+
+// add はエントリに更新日時を設定して書き込みます（WithReproducible の場合は Close まで待たせます）
+func (z *ZipWriter) add(header *zip.FileHeader, body []byte) error {
+	header.ModifiedDate, header.ModifiedTime = z.date, z.clock
+	if z.reproducible {
+		z.pending = append(z.pending, zipEntry{header: header, body: body})
+	} else if err := z.write(header, body); err != nil {
+		return err
+	}
+	z.names.add(header.Name)
+	return nil
+}
+
+// write はエントリを zip に書き込みます
+func (z *ZipWriter) write(header *zip.FileHeader, body []byte) error {
+	w, err := z.zw.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %w", header.Name, err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("archive: %s: %w", header.Name, err)
+	}
+	return nil
+}
+
+// Stats は追加したエントリの統計を返します
+func (z *ZipWriter) Stats() Stats {
+	return z.stats
+}
+
+// Close は zip の中央ディレクトリを書き込みます
+// WithReproducible の場合は、待たせていたエントリを名前順に書き込み、終端レコードのコメントに
+// 再現可能なことを記録します。
+func (z *ZipWriter) Close() error {
+	if z.reproducible {
+		slices.SortFunc(z.pending, func(a, b zipEntry) int {
+			return cmp.Compare(a.header.Name, b.header.Name)
+		})
+		for _, e := range z.pending {
+			if err := z.write(e.header, e.body); err != nil {
+				return err
+			}
+		}
+		z.pending = nil
+		if err := z.zw.SetComment(zipReproducibleComment); err != nil {
+			return err
+		}
+	}
+	return z.zw.Close()
+}
+
+// isZip は b が zip のマジック（ローカルファイルヘッダー、または空の zip の終端レコード）で始まるかを返します
+func isZip(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("PK\x03\x04")) || bytes.HasPrefix(b, []byte("PK\x05\x06"))
+}
+
+// ZipReader は zip のエントリを読み出す ArchiveReader です
+// 名前はバンドルと同じ規則で確認するため、"../" で始まる名前（zip-slip）や重複した
+// 名前のエントリを含む zip は開けません。ディレクトリのエントリは読み飛ばします。
+// fs.ModeSymlink のモードのエントリは、内容をリンク先とするシンボリックリンクとして扱います。
+type ZipReader struct {
+	entries      []Entry
+	files        map[string]*zip.File
+	reproducible bool // 終端レコードのコメントが zipReproducibleComment
+}
+
+// OpenZip は b の zip を開きます
+func OpenZip(b []byte) (*ZipReader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	r := &ZipReader{files: make(map[string]*zip.File, len(zr.File)), reproducible: zr.Comment == zipReproducibleComment}
+	check := newNameSet()
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if err := check.check(f.Name); err != nil {
+			return nil, err
+		}
+		check.add(f.Name)
+		if f.Mode()&fs.ModeSymlink != 0 {
+			target, err := readZipSymlink(f)
+			if err != nil {
+				return nil, err
+			}
+			r.entries = append(r.entries, Entry{Name: f.Name, Symlink: target})
+			r.files[f.Name] = f
+			continue
+		}
+		r.entries = append(r.entries, Entry{
+			Name:           f.Name,
+			Algorithm:      zipMethodName(f.Method),
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			CRC:            f.CRC32,
+		})
+		r.files[f.Name] = f
+	}
+	return r, nil
+}
+
+// maxZipSymlink はシンボリックリンクのエントリのリンク先の最大の長さです（PATH_MAX 程度）
+const maxZipSymlink = 4096
+
+// readZipSymlink はシンボリックリンクのエントリ f のリンク先を読み込みます
+func readZipSymlink(f *zip.File) (string, error) {
+	if f.UncompressedSize64 == 0 || f.UncompressedSize64 > maxZipSymlink {
+		return "", fmt.Errorf("archive: %s: invalid symlink", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("archive: %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, maxZipSymlink))
+	if err != nil {
+		return "", fmt.Errorf("archive: %s: %w", f.Name, err)
+	}
+	return string(target), nil
+}
+
+// zipMethodName は zip の圧縮方式の名前を返します
+func zipMethodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	}
+	return fmt.Sprintf("method-%d", method)
+}
+
+// Entries はエントリの一覧を zip 内の順に返します
+func (r *ZipReader) Entries() []Entry {
+	return append([]Entry(nil), r.entries...)
+}
+
+// ReadFile はエントリ name を展開して返します
+// 展開結果のCRC32が記録と一致しない場合は zip.ErrChecksum を含むエラーを返します。
+// name のエントリがない場合のエラーは fs.ErrNotExist を、シンボリックリンクの場合は ErrSymlink を含みます。
+func (r *ZipReader) ReadFile(name string) ([]byte, error) {
+	f, ok := r.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.Mode()&fs.ModeSymlink != 0 {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrSymlink}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("archive: %s: %w", name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// Stats は zip の統計を返します
+func (r *ZipReader) Stats() Stats {
+	var s Stats
+	for _, e := range r.entries {
+		if e.Symlink != "" {
+			s.addSymlink()
+		} else {
+			s.addStored(e.Size, e.CompressedSize)
+		}
+	}
+	return s
+}
+
+// Reproducible は zip を WithReproducible で書き込んだかを返します
+func (r *ZipReader) Reproducible() bool {
+	return r.reproducible
+}
+
+var (
+	_ ArchiveWriter = (*ZipWriter)(nil)
+	_ ArchiveReader = (*ZipReader)(nil)
+)
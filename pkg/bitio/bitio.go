@@ -0,0 +1,108 @@
+// Package bitio implements bit-level readers and writers.
+// Huffman符号や整数符号のように、バイト境界にそろわない可変長の符号を
+// 読み書きするための共通部品です。ビットは各バイトの上位ビットから順に詰めます。
+package bitio
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer はビット単位でデータを書き込むバッファです
+type Writer struct {
+	buf   []byte
+	nbits int // 書き込まれた総ビット数
+}
+
+// NewWriter は新しいWriterを作成します
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// WriteBit は1ビットを書き込みます（0以外は1として扱います）
+func (w *Writer) WriteBit(bit uint) {
+	if w.nbits%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit != 0 {
+		w.buf[len(w.buf)-1] |= 1 << (7 - uint(w.nbits%8))
+	}
+	w.nbits++
+}
+
+// WriteBits は value の下位 n ビットを上位ビットから順に書き込みます
+func (w *Writer) WriteBits(value uint64, n int) {
+	if n < 0 || n > 64 {
+		panic(fmt.Sprintf("bitio: invalid bit count %d", n))
+	}
+	for i := n - 1; i >= 0; i-- {
+		w.WriteBit(uint(value>>uint(i)) & 1)
+	}
+}
+
+// BitLen は書き込まれた総ビット数を返します
+func (w *Writer) BitLen() int {
+	return w.nbits
+}
+
+// Bytes は書き込まれたデータを返します（最後のバイトの余りビットは0で埋められます）
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// Reader はバイト列からビット単位でデータを読み込みます
+type Reader struct {
+	data  []byte
+	pos   int // 次に読むビット位置
+	limit int // 読み込み可能な総ビット数
+}
+
+// NewReader は data 全体を読み込むReaderを作成します
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data, limit: len(data) * 8}
+}
+
+// NewReaderBits は data の先頭 nbits ビットだけを読み込むReaderを作成します
+func NewReaderBits(data []byte, nbits int) *Reader {
+	if nbits < 0 || nbits > len(data)*8 {
+		nbits = len(data) * 8
+	}
+	return &Reader{data: data, limit: nbits}
+}
+
+// ReadBit は1ビットを読み込みます
+// データの終端に達した場合は io.ErrUnexpectedEOF を返します
+func (r *Reader) ReadBit() (uint, error) {
+	if r.pos >= r.limit {
+		return 0, io.ErrUnexpectedEOF
+	}
+	bit := uint(r.data[r.pos/8]>>(7-uint(r.pos%8))) & 1
+	r.pos++
+	return bit, nil
+}
+
+// ReadBits は n ビットを読み込み、上位ビットから順に並べた値を返します
+func (r *Reader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		return 0, fmt.Errorf("bitio: invalid bit count %d", n)
+	}
+	if r.Remaining() < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var value uint64
+	for i := 0; i < n; i++ {
+		bit, _ := r.ReadBit()
+		value = value<<1 | uint64(bit)
+	}
+	return value, nil
+}
+
+// Remaining はまだ読み込んでいないビット数を返します
+func (r *Reader) Remaining() int {
+	return r.limit - r.pos
+}
+
+// Position は読み込み済みのビット数を返します
+func (r *Reader) Position() int {
+	return r.pos
+}
@@ -0,0 +1,64 @@
+package bitio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriter_BitOrder(t *testing.T) {
+	w := NewWriter()
+	w.WriteBit(1)
+	w.WriteBits(0b0110, 4)
+	w.WriteBits(0b111, 3)
+	w.WriteBit(1)
+
+	expected := []byte{0b10110111, 0b10000000}
+	if !bytes.Equal(w.Bytes(), expected) {
+		t.Errorf("Expected %08b, got %08b", expected, w.Bytes())
+	}
+	if w.BitLen() != 9 {
+		t.Errorf("Expected 9 bits, got %d", w.BitLen())
+	}
+}
+
+func TestReadWrite_RoundTrip(t *testing.T) {
+	values := []struct {
+		value uint64
+		bits  int
+	}{
+		{0, 1}, {1, 1}, {5, 3}, {0xAB, 8}, {0x1234, 13}, {1<<63 | 1, 64}, {0, 0},
+	}
+
+	w := NewWriter()
+	for _, v := range values {
+		w.WriteBits(v.value, v.bits)
+	}
+
+	r := NewReaderBits(w.Bytes(), w.BitLen())
+	for _, v := range values {
+		got, err := r.ReadBits(v.bits)
+		if err != nil {
+			t.Fatalf("ReadBits failed: %v", err)
+		}
+		if got != v.value {
+			t.Errorf("Expected %d, got %d", v.value, got)
+		}
+	}
+	if r.Remaining() != 0 {
+		t.Errorf("Expected no remaining bits, got %d", r.Remaining())
+	}
+}
+
+func TestReader_EOF(t *testing.T) {
+	r := NewReaderBits([]byte{0xFF}, 3)
+	if _, err := r.ReadBits(4); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := r.ReadBits(3); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := r.ReadBit(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,546 @@
+// Package blocks implements a block container for compressed data.
+// データを固定サイズのブロックに分割し、ブロックごとに圧縮または無圧縮（stored）を
+// 選んで記録します。テキストと圧縮済みデータが混在するファイルで、圧縮できない
+// 領域に時間と容量を浪費しないための仕組みです。ディスクイメージなどの大きな0の
+// 領域は、圧縮せずに長さだけを記録します。
+package blocks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// フォーマット
+//
+//	ヘッダー:   マジック "TZB" + バージョン(1バイト)
+//	各ブロック: モード(1バイト) + 元サイズ(uvarint) + ペイロードサイズ(uvarint) + ペイロード
+//
+// バージョン2で0の領域（ModeZero）を追加しました。バージョン1のデータもそのまま展開できます。
+//
+// 同期マーカーは元サイズもペイロードサイズも0の ModeStored のブロック（0x00 0x00 0x00）で、
+// Writer.Flush がそれまでのデータをすべてブロックにした位置に置きます。Compress は空の
+// ブロックを作らないため、ほかのブロックと区別でき、展開や Inspect では読み飛ばします
+// （ブロック番号も数えません）。空のstoredブロックとして読めるため、バージョン2のままです。
+const (
+	magic = "TZB"
+
+	// Version は現在のフォーマットのバージョンです
+	Version = 2
+
+	// versionNoZero は ModeZero がないバージョンです
+	versionNoZero = 1
+
+	headerSize = len(magic) + 1
+
+	// DefaultBlockSize はデフォルトのブロックサイズです
+	DefaultBlockSize = 64 * 1024
+
+	// MinZeroRun は ModeZero として記録する0の領域の最小の長さです
+	// これより短い0の領域は前後のデータと一緒にブロックとして圧縮します
+	MinZeroRun = 512
+
+	// maxZeroRun は1つの ModeZero の最大の長さです（これより長い領域は分割します）
+	// 小さな入力から巨大な出力を確保させないよう、展開時にも確認します
+	maxZeroRun = 1 << 30
+)
+
+func init() {
+	common.RegisterFeature(common.Feature{
+		Name:        "blocks",
+		Description: "-adaptive のブロックコンテナ",
+		Versions:    []int{versionNoZero, Version},
+	})
+}
+
+// Mode はブロックの格納方式です
+type Mode byte
+
+const (
+	ModeStored     Mode = 0 // 無圧縮
+	ModeCompressed Mode = 1 // 指定アルゴリズムで圧縮
+	ModeZero       Mode = 2 // 元サイズ分の0（ペイロードなし）
+)
+
+// String はモード名を返します
+func (m Mode) String() string {
+	switch m {
+	case ModeStored:
+		return "stored"
+	case ModeCompressed:
+		return "compressed"
+	case ModeZero:
+		return "zero"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(m))
+	}
+}
+
+// BlockInfo は1ブロック分のヘッダー情報です
+type BlockInfo struct {
+	Index        int   // ブロック番号
+	Offset       int64 // 元データ内の開始位置
+	OriginalSize int   // 元のサイズ
+	PayloadSize  int   // 格納されたペイロードのサイズ
+	Mode         Mode  // 格納方式
+}
+
+// Compress はデータをブロックに分割し、すべてのブロックを圧縮して格納します
+// MinZeroRun バイト以上の0の領域はブロックサイズによらず1つの ModeZero として記録します
+func Compress(data []byte, c common.Compressor, blockSize int) ([]byte, error) {
+	return compress(data, c, blockSize, false, common.Policy{})
+}
+
+// CompressAdaptive はブロックごとに圧縮するかどうかを判断して格納します
+// 圧縮済みと判定されたブロック（common.DetectDataType）は圧縮を試さずにstoredとし、圧縮してもサイズが
+// 減らなかったブロックもstoredにフォールバックします。
+func CompressAdaptive(data []byte, primary common.Compressor, blockSize int) ([]byte, error) {
+	return compress(data, primary, blockSize, true, common.Policy{})
+}
+
+func compress(data []byte, c common.Compressor, blockSize int, adaptive bool, policy common.Policy) ([]byte, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("blocks: invalid block size: %d", blockSize)
+	}
+
+	result := make([]byte, 0, headerSize+len(data)/2)
+	result = append(result, magic...)
+	result = append(result, Version)
+	result, _, err := appendBlocks(result, data, 0, c, blockSize, adaptive, policy)
+	return result, err
+}
+
+// appendBlocks は data をブロックにして dst に追加し、次のブロック番号を返します
+// index は data の最初のブロックの番号です（エラーの表示に使います）。
+func appendBlocks(dst, data []byte, index int, c common.Compressor, blockSize int, adaptive bool, policy common.Policy) ([]byte, int, error) {
+	result, next, _, err := appendBlocksUntil(context.Background(), dst, data, index, c, blockSize, adaptive, policy)
+	return result, next, err
+}
+
+// appendBlocksUntil は appendBlocks と同じですが、ctx が終わった後のブロックは圧縮せずに
+// storedとして格納し、ctx が終わるまでに処理した data のバイト数も返します
+func appendBlocksUntil(ctx context.Context, dst, data []byte, index int, c common.Compressor, blockSize int, adaptive bool, policy common.Policy) ([]byte, int, int, error) {
+	result := dst
+	done := len(data)
+	for start := 0; start < len(data); index++ {
+		// 0の領域は圧縮器を通さずに長さだけを記録する
+		if zeros := common.ZeroPrefixLen(data[start:min(start+maxZeroRun, len(data))]); zeros >= MinZeroRun {
+			result = append(result, byte(ModeZero))
+			result = binary.AppendUvarint(result, uint64(zeros))
+			result = binary.AppendUvarint(result, 0)
+			start += zeros
+			continue
+		}
+
+		// ブロックは次の0の領域の手前で区切る
+		end := min(start+blockSize, len(data))
+		if zeroStart, _ := common.FindZeroRun(data[start:min(end+MinZeroRun, len(data))], MinZeroRun); start+zeroStart < end {
+			end = start + zeroStart
+		}
+		block := data[start:end]
+
+		if done == len(data) && ctx.Err() != nil {
+			done = start
+		}
+		mode, payload := ModeStored, block
+		if done == len(data) {
+			var err error
+			if mode, payload, err = encodeBlock(block, c, adaptive, policy); err != nil {
+				return nil, index, 0, fmt.Errorf("blocks: block %d: %w", index, err)
+			}
+		}
+
+		result = append(result, byte(mode))
+		result = binary.AppendUvarint(result, uint64(len(block)))
+		result = binary.AppendUvarint(result, uint64(len(payload)))
+		result = append(result, payload...)
+		start = end
+	}
+
+	return result, index, done, nil
+}
+
+// encodeBlock は1ブロックの格納方式を決めてペイロードを返します
+// policy が Strict の場合は、データの種類の推定で圧縮を省かず、すべてのブロックで圧縮を試します。
+func encodeBlock(block []byte, c common.Compressor, adaptive bool, policy common.Policy) (Mode, []byte, error) {
+	if adaptive && !policy.Strict && common.DetectDataType(block).Kind == common.KindCompressed {
+		return ModeStored, block, nil
+	}
+
+	compressed, err := c.Compress(block)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if adaptive && len(compressed) >= len(block) {
+		return ModeStored, block, nil
+	}
+	return ModeCompressed, compressed, nil
+}
+
+// Decompress はブロックコンテナを展開します
+// c は圧縮時に使用したアルゴリズムでなければなりません
+func Decompress(data []byte, c common.Compressor) ([]byte, error) {
+	return DecompressWithOptions(data, c, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながらブロックコンテナを展開します
+// 各ブロックの元サイズを出力として確保してから展開し、内側のアルゴリズムにも
+// 同じ予算を渡します。ブロック単位の一時バッファは結果に追加した後に返却します。
+// opts.OnDamage を指定した場合は、展開できないブロックを元のサイズ分の opts.Fill で埋めて
+// 続けます（salvage）。
+func DecompressWithOptions(data []byte, c common.Compressor, opts common.DecompressOptions) ([]byte, error) {
+	var result []byte
+
+	err := walk(data, func(info BlockInfo, payload []byte) error {
+		total := int64(len(result)) + int64(info.OriginalSize)
+		if err := opts.ReserveOutput(int64(info.OriginalSize), total); err != nil {
+			return fmt.Errorf("blocks: block %d: %w", info.Index, err)
+		}
+
+		switch info.Mode {
+		case ModeStored, ModeCompressed:
+			block, err := decodeBlock(info, payload, c, opts.Budget)
+			if err != nil {
+				if err := reportDamage(info, err, opts); err != nil {
+					return err
+				}
+				result = common.AppendFill(result, opts.Fill, info.OriginalSize)
+				return nil
+			}
+			result = append(result, block...)
+			if info.Mode == ModeCompressed {
+				opts.Budget.Release(int64(len(block)))
+			}
+		case ModeZero:
+			n := len(result)
+			result = slices.Grow(result, info.OriginalSize)[:n+info.OriginalSize]
+			clear(result[n:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		result = []byte{}
+	}
+	return result, nil
+}
+
+// Inspect はペイロードを展開せずに各ブロックのヘッダー情報を返します
+func Inspect(data []byte) ([]BlockInfo, error) {
+	var infos []BlockInfo
+	err := walk(data, func(info BlockInfo, _ []byte) error {
+		infos = append(infos, info)
+		return nil
+	})
+	return infos, err
+}
+
+// IsBlocks は header がブロックコンテナのマジックで始まるかを返します
+func IsBlocks(header []byte) bool {
+	return len(header) >= len(magic) && string(header[:len(magic)]) == magic
+}
+
+// InspectAt は r の先頭から size バイトのブロックコンテナの各ブロックのヘッダー情報を返します
+// Inspect と同じ確認をしますが、ペイロードは読み込まずに読み飛ばすため、大きなファイルでも
+// ブロックヘッダーの分だけ読み込みます。
+func InspectAt(r io.ReaderAt, size int64) ([]BlockInfo, error) {
+	v, err := readStreamHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []BlockInfo
+	var offset int64
+	var header [1 + 2*binary.MaxVarintLen64]byte
+	for pos, index := int64(headerSize), 0; pos < size; {
+		buf := header[:min(int64(len(header)), size-pos)]
+		if n, err := r.ReadAt(buf, pos); n < len(buf) {
+			return nil, err
+		}
+
+		mode := Mode(buf[0])
+		if err := checkMode(index, v, mode); err != nil {
+			return nil, err
+		}
+		originalSize, n := binary.Uvarint(buf[1:])
+		if n <= 0 {
+			return nil, fmt.Errorf("blocks: block %d: invalid original size", index)
+		}
+		payloadSize, m := binary.Uvarint(buf[1+n:])
+		if m <= 0 {
+			return nil, fmt.Errorf("blocks: block %d: invalid payload size", index)
+		}
+		pos += int64(1 + n + m)
+
+		if payloadSize > uint64(size-pos) {
+			return nil, fmt.Errorf("blocks: block %d: truncated payload", index)
+		}
+		if err := checkBlock(index, mode, originalSize, payloadSize); err != nil {
+			return nil, err
+		}
+		if isSync(mode, originalSize, payloadSize) {
+			continue
+		}
+
+		infos = append(infos, BlockInfo{
+			Index:        index,
+			Offset:       offset,
+			OriginalSize: int(originalSize),
+			PayloadSize:  int(payloadSize),
+			Mode:         mode,
+		})
+		pos += int64(payloadSize)
+		offset += int64(originalSize)
+		index++
+	}
+	return infos, nil
+}
+
+// walk はブロックヘッダーを順に読み取り、ブロックごとに fn を呼び出します
+func walk(data []byte, fn func(info BlockInfo, payload []byte) error) error {
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return fmt.Errorf("blocks: invalid header")
+	}
+	v := data[len(magic)]
+	if v > Version {
+		return &common.ErrUnsupportedVersion{Format: "blocks", Have: v, Max: Version}
+	} else if v < versionNoZero {
+		return fmt.Errorf("blocks: unsupported Version: %d", v)
+	}
+
+	pos := headerSize
+	var offset int64
+
+	for index := 0; pos < len(data); {
+		mode := Mode(data[pos])
+		if err := checkMode(index, v, mode); err != nil {
+			return err
+		}
+		pos++
+
+		originalSize, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return fmt.Errorf("blocks: block %d: invalid original size", index)
+		}
+		pos += n
+
+		payloadSize, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return fmt.Errorf("blocks: block %d: invalid payload size", index)
+		}
+		pos += n
+
+		if payloadSize > uint64(len(data)-pos) {
+			return fmt.Errorf("blocks: block %d: truncated payload", index)
+		}
+		if err := checkBlock(index, mode, originalSize, payloadSize); err != nil {
+			return err
+		}
+		if isSync(mode, originalSize, payloadSize) {
+			continue
+		}
+
+		info := BlockInfo{
+			Index:        index,
+			Offset:       offset,
+			OriginalSize: int(originalSize),
+			PayloadSize:  int(payloadSize),
+			Mode:         mode,
+		}
+		if err := fn(info, data[pos:pos+int(payloadSize)]); err != nil {
+			return err
+		}
+
+		pos += int(payloadSize)
+		offset += int64(originalSize)
+		index++
+	}
+
+	return nil
+}
+
+// syncMarker は同期マーカーのブロックヘッダーです
+var syncMarker = []byte{byte(ModeStored), 0, 0}
+
+// isSync はブロックヘッダーが同期マーカーかを返します
+func isSync(mode Mode, originalSize, payloadSize uint64) bool {
+	return mode == ModeStored && originalSize == 0 && payloadSize == 0
+}
+
+// checkMode はバージョン v のデータで mode が使えるかを確認します
+func checkMode(index int, v byte, mode Mode) error {
+	if mode != ModeStored && mode != ModeCompressed && (mode != ModeZero || v == versionNoZero) {
+		return fmt.Errorf("blocks: block %d: unknown mode %d", index, byte(mode))
+	}
+	return nil
+}
+
+// checkBlock はブロックヘッダーの元サイズとペイロードサイズが格納方式と矛盾しないかを確認します
+func checkBlock(index int, mode Mode, originalSize, payloadSize uint64) error {
+	if mode == ModeStored && payloadSize != originalSize {
+		return fmt.Errorf("blocks: block %d: stored size mismatch", index)
+	}
+	if mode == ModeZero && (payloadSize != 0 || originalSize > maxZeroRun) {
+		return fmt.Errorf("blocks: block %d: invalid zero block", index)
+	}
+	if originalSize > math.MaxInt || payloadSize > math.MaxInt {
+		return fmt.Errorf("blocks: block %d: size out of range", index)
+	}
+	return nil
+}
+
+// decodeBlock は1ブロックを展開します（ModeZero の場合は nil を返します）
+// ModeCompressed の展開結果は予算から確保されるため、呼び出し側が使い終わった後に返却します。
+func decodeBlock(info BlockInfo, payload []byte, c common.Compressor, budget *common.Budget) ([]byte, error) {
+	switch info.Mode {
+	case ModeStored:
+		return payload, nil
+	case ModeCompressed:
+		inner := common.DecompressOptions{Budget: budget, MaxOutputSize: int64(info.OriginalSize)}
+		block, err := common.DecompressWithOptions(c, payload, inner)
+		if err != nil {
+			return nil, fmt.Errorf("blocks: block %d: %w", info.Index, err)
+		}
+		if len(block) != info.OriginalSize {
+			budget.Release(int64(len(block)))
+			return nil, fmt.Errorf("blocks: block %d: size mismatch: expected %d, got %d",
+				info.Index, info.OriginalSize, len(block))
+		}
+		return block, nil
+	default:
+		return nil, nil
+	}
+}
+
+// reportDamage は展開できなかったブロックを opts.OnDamage に報告します
+// OnDamage がない場合や、予算を超えたことによる（データの破損でない）エラーの場合は err を
+// そのまま返します。nil を返した場合、呼び出し側はブロックを opts.Fill で埋めて続けます。
+func reportDamage(info BlockInfo, err error, opts common.DecompressOptions) error {
+	if opts.OnDamage == nil || errors.Is(err, common.ErrBudgetExceeded) {
+		return err
+	}
+	return opts.OnDamage(common.DamagedBlock{
+		Block:  info.Index,
+		Offset: info.Offset,
+		Length: int64(info.OriginalSize),
+		Reason: err.Error(),
+	})
+}
+
+// Compressor はブロックコンテナを common.Compressor として扱うアダプターです
+type Compressor struct {
+	primary   common.Compressor
+	blockSize int
+	adaptive  bool
+	policy    common.Policy
+}
+
+// NewCompressor は primary でブロックごとに圧縮するCompressorを作成します
+// adaptive が true の場合、圧縮できないブロックはstoredとして格納します
+func NewCompressor(primary common.Compressor, blockSize int, adaptive bool) *Compressor {
+	return &Compressor{
+		primary:   primary,
+		blockSize: blockSize,
+		adaptive:  adaptive,
+	}
+}
+
+// Name はアルゴリズム名を返します
+func (b *Compressor) Name() string {
+	if b.adaptive {
+		return b.primary.Name() + " (adaptive blocks)"
+	}
+	return b.primary.Name() + " (blocks)"
+}
+
+// Compress はデータをブロックコンテナとして圧縮します
+func (b *Compressor) Compress(data []byte) ([]byte, error) {
+	return compress(data, b.primary, b.blockSize, b.adaptive, b.policy)
+}
+
+// CompressDeadline は ctx が終わるまでブロックを圧縮し、残りのブロックをstoredとして
+// 格納したブロックコンテナと、圧縮を終えた入力のバイト数を返します（common.Deadlined）
+// 出力は Compress と同じ形式で、Decompress でそのまま展開できます。0の領域は期限の後も
+// ModeZero として記録します。
+func (b *Compressor) CompressDeadline(ctx context.Context, data []byte) ([]byte, int, error) {
+	if b.blockSize <= 0 {
+		return nil, 0, fmt.Errorf("blocks: invalid block size: %d", b.blockSize)
+	}
+
+	result := make([]byte, 0, headerSize+len(data)/2)
+	result = append(result, magic...)
+	result = append(result, Version)
+	result, _, done, err := appendBlocksUntil(ctx, result, data, 0, b.primary, b.blockSize, b.adaptive, b.policy)
+	return result, done, err
+}
+
+// WithPolicy は p に従う Compressor を返します（common.PolicyAware）
+// Strict の場合、adaptive でもデータの種類の推定で圧縮を省かず、圧縮して小さくならなかった
+// ブロックだけをstoredにします（adaptive を指定したことによる明示的な選択です）。
+// primary にも同じ Policy を設定します。
+func (b *Compressor) WithPolicy(p common.Policy) common.Compressor {
+	c := *b
+	c.policy = p
+	c.primary = common.WithPolicy(b.primary, p)
+	return &c
+}
+
+// Decompress はブロックコンテナを展開します
+func (b *Compressor) Decompress(data []byte) ([]byte, error) {
+	return Decompress(data, b.primary)
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+func (b *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	return DecompressWithOptions(data, b.primary, opts)
+}
+
+// DecompressToWriter はブロックコンテナを読みながら展開し、ブロックの順に dst に書き込みます
+// 展開は GOMAXPROCS 個のゴルーチンで並行に行います。
+func (b *Compressor) DecompressToWriter(src io.Reader, dst io.Writer, opts common.DecompressOptions) error {
+	_, err := DecompressToWriter(src, dst, b.primary, WithWorkers(runtime.GOMAXPROCS(0)), WithLimits(opts))
+	return err
+}
+
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+	_ common.WriterDecompressor  = (*Compressor)(nil)
+	_ common.PolicyAware         = (*Compressor)(nil)
+	_ common.Deadlined           = (*Compressor)(nil)
+)
+
+// PrintBlockInfo はブロックごとの格納方式を見やすく表示します
+func PrintBlockInfo(infos []BlockInfo) {
+	FprintBlockInfo(os.Stdout, infos)
+}
+
+// FprintBlockInfo は PrintBlockInfo と同じ内容を w に書き込みます
+func FprintBlockInfo(w io.Writer, infos []BlockInfo) {
+	counts := make(map[Mode]int)
+	for _, info := range infos {
+		counts[info.Mode]++
+	}
+
+	fmt.Fprintf(w, "=== ブロック情報 ===\n")
+	fmt.Fprintf(w, "ブロック数: %d (圧縮: %d, stored: %d, zero: %d)\n",
+		len(infos), counts[ModeCompressed], counts[ModeStored], counts[ModeZero])
+	for _, info := range infos {
+		fmt.Fprintf(w, "  #%-4d offset=%-10d %-10s %s -> %s\n",
+			info.Index, info.Offset, info.Mode,
+			common.FormatBytes(int64(info.OriginalSize)),
+			common.FormatBytes(int64(info.PayloadSize)))
+	}
+}
@@ -0,0 +1,872 @@
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/golden"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// mixedData は前半がテキスト、後半が乱数のデータを作成します
+func mixedData(half int) []byte {
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), half/45+1)[:half]
+	return append(text, testcorpus.Random(half, 42)...)
+}
+
+func TestCompress_RoundTripCorpus(t *testing.T) {
+	compressor := rle.NewCompressor()
+
+	for _, sample := range testcorpus.Samples() {
+		for _, adaptive := range []bool{false, true} {
+			c := NewCompressor(compressor, 100, adaptive)
+
+			compressed, err := c.Compress(sample.Data)
+			if err != nil {
+				t.Fatalf("%s: Compress failed: %v", sample.Name, err)
+			}
+
+			decompressed, err := c.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("%s: Decompress failed: %v", sample.Name, err)
+			}
+
+			if !bytes.Equal(sample.Data, decompressed) {
+				t.Errorf("%s (adaptive=%v): data mismatch", sample.Name, adaptive)
+			}
+		}
+	}
+}
+
+func TestCompressAdaptive_MixedData(t *testing.T) {
+	const half = 32 * 1024
+	const blockSize = 4096
+	primary := lz77.NewCompressor()
+	data := mixedData(half)
+
+	start := time.Now()
+	whole, err := primary.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	wholeTime := time.Since(start)
+
+	start = time.Now()
+	adaptive, err := CompressAdaptive(data, primary, blockSize)
+	if err != nil {
+		t.Fatalf("CompressAdaptive failed: %v", err)
+	}
+	adaptiveTime := time.Since(start)
+
+	t.Logf("whole: %d bytes in %v, adaptive: %d bytes in %v", len(whole), wholeTime, len(adaptive), adaptiveTime)
+
+	// LZ77はリテラル列で乱数をほとんど膨張させないため、差はブロックごとのヘッダーと
+	// ブロック境界で履歴が途切れる分だけになる
+	if len(adaptive) > len(whole)*101/100 {
+		t.Errorf("Adaptive output (%d) is more than 1%% larger than whole-file output (%d)", len(adaptive), len(whole))
+	}
+	if adaptiveTime >= wholeTime {
+		t.Errorf("Adaptive compression (%v) was not faster than whole-file compression (%v)", adaptiveTime, wholeTime)
+	}
+
+	decompressed, err := Decompress(adaptive, primary)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Fatal("Data mismatch")
+	}
+
+	// 前半のテキストは圧縮、後半の乱数はstoredとして記録される
+	infos, err := Inspect(adaptive)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(infos) != 2*half/blockSize {
+		t.Fatalf("Expected %d blocks, got %d", 2*half/blockSize, len(infos))
+	}
+	for _, info := range infos {
+		expected := ModeCompressed
+		if info.Offset >= half {
+			expected = ModeStored
+		}
+		if info.Mode != expected {
+			t.Errorf("Block %d at offset %d: expected %s, got %s", info.Index, info.Offset, expected, info.Mode)
+		}
+	}
+}
+
+func TestCompressAdaptive_FallbackWhenExpanded(t *testing.T) {
+	// RLEは繰り返しのないテキストを2倍に膨らませるのでstoredになる
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+
+	compressed, err := CompressAdaptive(data, rle.NewCompressor(), 1024)
+	if err != nil {
+		t.Fatalf("CompressAdaptive failed: %v", err)
+	}
+
+	infos, err := Inspect(compressed)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Mode != ModeStored {
+		t.Errorf("Expected a single stored block, got %+v", infos)
+	}
+}
+
+func TestDecompress_InvalidData(t *testing.T) {
+	compressor := rle.NewCompressor()
+	valid, err := Compress([]byte("aaaabbbb"), compressor, 4)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	cases := map[string][]byte{
+		"empty":         {},
+		"bad magic":     []byte("XYZ\x01"),
+		"bad Version":   []byte("TZB\x09"),
+		"unknown mode":  append([]byte("TZB\x01"), 7, 1, 1, 'a'),
+		"truncated":     valid[:len(valid)-1],
+		"stored length": append([]byte("TZB\x01"), 0, 2, 1, 'a'),
+		"zero in v1":    append([]byte("TZB\x01"), byte(ModeZero), 4, 0),
+		"zero payload":  append([]byte("TZB\x02"), byte(ModeZero), 4, 1, 0),
+		"zero too long": append([]byte("TZB\x02"), byte(ModeZero), 0x80, 0x80, 0x80, 0x80, 0x10, 0),
+	}
+
+	for name, data := range cases {
+		if _, err := Decompress(data, compressor); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// 新しいバージョンは破損ではなく、対応していないバージョンとして報告する
+	var unsupported *common.ErrUnsupportedVersion
+	if _, err := Decompress([]byte("TZB\x09"), compressor); !errors.As(err, &unsupported) || unsupported.Have != 9 || unsupported.Max != Version {
+		t.Errorf("Expected ErrUnsupportedVersion{9, %d}, got %v", Version, err)
+	}
+}
+
+func TestInspectAt_MatchesInspect(t *testing.T) {
+	data := append(mixedData(8192), make([]byte, 2*MinZeroRun)...)
+	compressed, err := CompressAdaptive(data, lz77.NewCompressor(), 1024)
+	if err != nil {
+		t.Fatalf("CompressAdaptive failed: %v", err)
+	}
+	want, _ := Inspect(compressed)
+
+	// ペイロードは読み込まないため、ReadAt の回数はブロック数 + ヘッダーの分だけ
+	r := &countingReaderAt{r: bytes.NewReader(compressed)}
+	got, err := InspectAt(r, int64(len(compressed)))
+	if err != nil {
+		t.Fatalf("InspectAt failed: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if r.bytes >= int64(len(compressed))/2 {
+		t.Errorf("Expected the payloads to be skipped, read %d of %d bytes", r.bytes, len(compressed))
+	}
+	if !IsBlocks(compressed) || IsBlocks([]byte("TZ")) {
+		t.Error("IsBlocks did not recognize the magic")
+	}
+
+	valid, _ := Compress([]byte("aaaabbbb"), rle.NewCompressor(), 4)
+	for name, data := range map[string][]byte{
+		"bad magic":      []byte("XYZ\x01"),
+		"truncated":      valid[:len(valid)-1],
+		"partial header": append([]byte("TZB\x02"), byte(ModeCompressed), 0x80),
+		"stored length":  append([]byte("TZB\x01"), 0, 2, 1, 'a'),
+		"unknown mode":   append([]byte("TZB\x01"), 7, 1, 1, 'a'),
+	} {
+		if _, err := InspectAt(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// countingReaderAt は ReadAt で読み込んだバイト数を数えます
+type countingReaderAt struct {
+	r     io.ReaderAt
+	bytes int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func TestCompress_InvalidBlockSize(t *testing.T) {
+	if _, err := Compress([]byte("abc"), rle.NewCompressor(), 0); err == nil {
+		t.Error("Expected error for zero block size")
+	}
+}
+
+func TestDecompressWithOptions_Budget(t *testing.T) {
+	compressor := rle.NewCompressor()
+	data := bytes.Repeat([]byte{'z'}, 64*1024)
+
+	compressed, err := Compress(data, compressor, 4096)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// 出力(64KB) + ブロックの一時バッファ(4KB) が予算内なら成功する
+	budget := common.NewBudget(72 * 1024)
+	decompressed, err := DecompressWithOptions(compressed, compressor, common.DecompressOptions{Budget: budget})
+	if err != nil {
+		t.Fatalf("DecompressWithOptions failed: %v", err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Error("Data mismatch")
+	}
+
+	// 出力全体が予算を超える場合は途中で止まる
+	_, err = DecompressWithOptions(compressed, compressor, common.DecompressOptions{Budget: common.NewBudget(32 * 1024)})
+	if !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestCompressAdaptive_StoresDetectedCompressedBlock(t *testing.T) {
+	// gzipのマジックで始まるブロックは、中身が圧縮できてもstoredになる
+	text := bytes.Repeat([]byte("aaaaaaaabbbbbbbb"), 64)
+	gzipped := append([]byte{0x1F, 0x8B}, text...)
+
+	compressed, err := CompressAdaptive(append(text, gzipped...), rle.NewCompressor(), len(text))
+	if err != nil {
+		t.Fatalf("CompressAdaptive failed: %v", err)
+	}
+
+	infos, err := Inspect(compressed)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(infos) < 2 || infos[0].Mode != ModeCompressed || infos[1].Mode != ModeStored {
+		t.Errorf("Expected compressed then stored blocks, got %+v", infos)
+	}
+}
+
+func TestCompressor_StrictTriesDetectedBlocks(t *testing.T) {
+	// Strict では種類の推定で省かず、圧縮できたブロックは圧縮して格納する
+	text := bytes.Repeat([]byte("aaaaaaaabbbbbbbb"), 64)
+	gzipped := append([]byte{0x1F, 0x8B}, text...)
+
+	c := NewCompressor(rle.NewCompressor(), len(gzipped), true).WithPolicy(common.Policy{Strict: true})
+	compressed, err := c.Compress(gzipped)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	infos, err := Inspect(compressed)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Mode != ModeCompressed {
+		t.Errorf("Expected one compressed block, got %+v", infos)
+	}
+	if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, gzipped) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+}
+
+// sparseData は大半が0で、ところどころにテキストがあるデータを作成します
+func sparseData(size int) []byte {
+	data := make([]byte, size)
+	text := []byte("header: tinyzipzap sparse test data\n")
+	for offset := 0; offset < size; offset += 1 << 20 {
+		copy(data[offset:], text)
+	}
+	return data
+}
+
+func TestCompress_ZeroRuns(t *testing.T) {
+	compressor := rle.NewCompressor()
+	text := []byte("abcdefghijklmnopqrstuvwxyz")
+
+	// 短い0の領域はブロックの一部、MinZeroRun 以上の領域は ModeZero になる
+	var data []byte
+	data = append(data, text...)
+	data = append(data, make([]byte, 100)...)
+	data = append(data, text...)
+	data = append(data, make([]byte, 3*MinZeroRun+5)...)
+	data = append(data, text...)
+	data = append(data, make([]byte, MinZeroRun)...)
+
+	for _, adaptive := range []bool{false, true} {
+		compressed, err := compress(data, compressor, 4096, adaptive, common.Policy{})
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		decompressed, err := Decompress(compressed, compressor)
+		if err != nil {
+			t.Fatalf("Decompress failed: %v", err)
+		}
+		if !bytes.Equal(data, decompressed) {
+			t.Fatal("Data mismatch")
+		}
+
+		infos, err := Inspect(compressed)
+		if err != nil {
+			t.Fatalf("Inspect failed: %v", err)
+		}
+		var modes []Mode
+		var sizes []int
+		for _, info := range infos {
+			modes = append(modes, info.Mode)
+			sizes = append(sizes, info.OriginalSize)
+		}
+		if len(infos) != 4 || modes[1] != ModeZero || modes[3] != ModeZero || modes[0] == ModeZero || modes[2] == ModeZero {
+			t.Fatalf("adaptive=%v: expected block, zero, block, zero; got %v", adaptive, modes)
+		}
+		if sizes[0] != 2*len(text)+100 || sizes[1] != 3*MinZeroRun+5 || sizes[3] != MinZeroRun {
+			t.Errorf("adaptive=%v: unexpected block sizes %v", adaptive, sizes)
+		}
+		if infos[1].PayloadSize != 0 {
+			t.Errorf("Expected no payload for a zero block, got %d", infos[1].PayloadSize)
+		}
+	}
+}
+
+func TestCompress_MostlyZero(t *testing.T) {
+	if testing.Short() {
+		t.Skip("100MBのデータを使うため -short では省略")
+	}
+	compressor := rle.NewCompressor()
+	data := sparseData(100 << 20)
+
+	plain, err := compressor.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	compressed, err := Compress(data, compressor, DefaultBlockSize)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// 0の領域はペイロードを持たないため、RLEの連長より大幅に小さくなる（速度は BenchmarkCompress_MostlyZero）
+	t.Logf("rle: %d bytes, blocks: %d bytes", len(plain), len(compressed))
+	if len(compressed)*10 > len(plain) {
+		t.Errorf("Zero-run compression (%d bytes) was not much smaller than plain RLE (%d bytes)", len(compressed), len(plain))
+	}
+
+	decompressed, err := Decompress(compressed, compressor)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Fatal("Data mismatch")
+	}
+}
+
+// BenchmarkCompress_MostlyZero はほとんど0の100MBのデータで、RLEだけの圧縮と0の領域を使う圧縮を比べます
+func BenchmarkCompress_MostlyZero(b *testing.B) {
+	compressor := rle.NewCompressor()
+	data := sparseData(100 << 20)
+	b.Run("rle", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for range b.N {
+			if _, err := compressor.Compress(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("blocks", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for range b.N {
+			if _, err := Compress(data, compressor, DefaultBlockSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDecompress_Version1(t *testing.T) {
+	// ModeZero のないバージョン1のデータも展開できる
+	compressor := rle.NewCompressor()
+	data := append([]byte("TZB\x01"), 0, 3, 3, 'a', 'b', 'c')
+	data = append(data, 0, 2, 2, 'd', 'e')
+
+	decompressed, err := Decompress(data, compressor)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if string(decompressed) != "abcde" {
+		t.Errorf("Expected \"abcde\", got %q", decompressed)
+	}
+}
+
+func TestDecompressToWriter_MatchesInMemory(t *testing.T) {
+	compressor := lz77.NewCompressor()
+	data := append(mixedData(96*1024), sparseData(3<<20)...)
+	compressed, err := CompressAdaptive(data, compressor, 8192)
+	if err != nil {
+		t.Fatalf("CompressAdaptive failed: %v", err)
+	}
+	want, err := Decompress(compressed, compressor)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+
+	for _, workers := range []int{1, 4} {
+		var out bytes.Buffer
+		n, err := DecompressToWriter(iotest.HalfReader(bytes.NewReader(compressed)), &out, compressor, WithWorkers(workers))
+		if err != nil {
+			t.Fatalf("workers=%d: DecompressToWriter failed: %v", workers, err)
+		}
+		if n != int64(len(want)) || !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("workers=%d: output differs from Decompress (%d bytes, want %d)", workers, n, len(want))
+		}
+	}
+}
+
+func TestDecompressToWriter_Errors(t *testing.T) {
+	compressor := rle.NewCompressor()
+	data := bytes.Repeat([]byte("abcabcabd"), 4096)
+	compressed, err := Compress(data, compressor, 1024)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// 途中で切れた入力はエラーになり、それまでのブロックは書き込み済み
+	var out bytes.Buffer
+	n, err := DecompressToWriter(bytes.NewReader(compressed[:len(compressed)/2]), &out, compressor, WithWorkers(3))
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected truncated error, got %v", err)
+	}
+	if n == 0 || !bytes.Equal(out.Bytes(), data[:n]) {
+		t.Errorf("Expected a correct prefix before the error, got %d bytes", n)
+	}
+
+	if _, err := DecompressToWriter(bytes.NewReader([]byte("XYZ\x02")), io.Discard, compressor); err == nil {
+		t.Error("Expected error for invalid header")
+	}
+
+	limits := common.DecompressOptions{MaxOutputSize: 10000, Budget: common.NewBudget(1 << 20)}
+	_, err = DecompressToWriter(bytes.NewReader(compressed), io.Discard, compressor, WithWorkers(2), WithLimits(limits))
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if used := limits.Budget.Used(); used != 0 {
+		t.Errorf("Expected the budget to be released, %d bytes still used", used)
+	}
+
+	// 書き込みのエラーで止まり、展開中のブロックの予算も返却する
+	budget := common.NewBudget(1 << 20)
+	failing := &failingWriter{limit: 5000}
+	_, err = DecompressToWriter(bytes.NewReader(compressed), failing, compressor, WithWorkers(4), WithLimits(common.DecompressOptions{Budget: budget}))
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the write error, got %v", err)
+	}
+	if used := budget.Used(); used != 0 {
+		t.Errorf("Expected the budget to be released after a write error, %d bytes still used", used)
+	}
+}
+
+func TestDecompress_Salvage(t *testing.T) {
+	const blockSize = 1024
+	compressor := rle.NewCompressor()
+	data := bytes.Repeat([]byte("aaaabbbbbbccd The quick brown fox. "), 300)
+	compressed, err := Compress(data, compressor, blockSize)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	// 離れた2つのブロックのペイロードを壊す（ヘッダーは壊さない）
+	damaged := map[int]bool{2: true, 6: true}
+	walk(compressed, func(info BlockInfo, payload []byte) error {
+		if damaged[info.Index] {
+			for i := range payload {
+				payload[i] = 0xff
+			}
+		}
+		return nil
+	})
+	if _, err := Decompress(compressed, compressor); err == nil {
+		t.Fatal("Expected the damaged blocks to fail without salvage")
+	}
+
+	check := func(name string, got []byte, reported []common.DamagedBlock, fill byte) {
+		t.Helper()
+		if len(got) != len(data) {
+			t.Fatalf("%s: output is %d bytes, want %d", name, len(got), len(data))
+		}
+		if len(reported) != len(damaged) {
+			t.Fatalf("%s: reported %v, want blocks 2 and 6", name, reported)
+		}
+		for i, index := range []int{2, 6} {
+			d := reported[i]
+			if d.Block != index || d.Offset != int64(index*blockSize) || d.Length != blockSize || d.Reason == "" {
+				t.Errorf("%s: damage %d = %+v, want block %d at [%d, %d)", name, i, d, index, index*blockSize, (index+1)*blockSize)
+			}
+		}
+		for start := 0; start < len(data); start += blockSize {
+			end := min(start+blockSize, len(data))
+			want := data[start:end]
+			if damaged[start/blockSize] {
+				want = bytes.Repeat([]byte{fill}, end-start)
+			}
+			if !bytes.Equal(got[start:end], want) {
+				t.Errorf("%s: block %d differs", name, start/blockSize)
+			}
+		}
+	}
+
+	var reported []common.DamagedBlock
+	opts := common.DecompressOptions{
+		Budget:   common.NewBudget(1 << 20),
+		OnDamage: func(d common.DamagedBlock) error { reported = append(reported, d); return nil },
+	}
+	got, err := DecompressWithOptions(compressed, compressor, opts)
+	if err != nil {
+		t.Fatalf("DecompressWithOptions failed: %v", err)
+	}
+	check("in memory", got, reported, 0)
+
+	for _, workers := range []int{1, 4} {
+		reported = nil
+		opts.Fill, opts.Budget = []byte{0xee}, common.NewBudget(1<<20)
+		var out bytes.Buffer
+		n, err := DecompressToWriter(bytes.NewReader(compressed), &out, compressor, WithWorkers(workers), WithLimits(opts))
+		if err != nil || n != int64(out.Len()) {
+			t.Fatalf("workers=%d: DecompressToWriter = %d, %v", workers, n, err)
+		}
+		check("stream", out.Bytes(), reported, 0xee)
+		if used := opts.Budget.Used(); used != 0 {
+			t.Errorf("workers=%d: %d bytes of the budget still used", workers, used)
+		}
+	}
+
+	// OnDamage がエラーを返せば、そのエラーで止める
+	stop := errors.New("too many damaged blocks")
+	opts.OnDamage = func(common.DamagedBlock) error { return stop }
+	if _, err := DecompressToWriter(bytes.NewReader(compressed), io.Discard, compressor, WithWorkers(2), WithLimits(opts)); !errors.Is(err, stop) {
+		t.Errorf("Expected the OnDamage error, got %v", err)
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// failingWriter は limit バイトを超える書き込みで失敗します
+type failingWriter struct {
+	limit, n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n+len(p) > f.limit {
+		return 0, errWriteFailed
+	}
+	f.n += len(p)
+	return len(p), nil
+}
+
+// repeatedContainer は同じ圧縮ブロックを count 回並べたブロックコンテナを、メモリに保持せずに読み込ませます
+func repeatedContainer(block []byte, c common.Compressor, count int) (io.Reader, error) {
+	payload, err := c.Compress(block)
+	if err != nil {
+		return nil, err
+	}
+	record := append([]byte{byte(ModeCompressed)}, binary.AppendUvarint(nil, uint64(len(block)))...)
+	record = binary.AppendUvarint(record, uint64(len(payload)))
+	record = append(record, payload...)
+
+	readers := []io.Reader{bytes.NewReader(append([]byte(magic), Version))}
+	for range count {
+		readers = append(readers, bytes.NewReader(record))
+	}
+	return io.MultiReader(readers...), nil
+}
+
+// heapProbe は書き込まれたバイト数を数え、一定量ごとにGCの後のヒープの使用量を記録します
+type heapProbe struct {
+	n, next, interval int64
+	peak              uint64
+}
+
+func (h *heapProbe) Write(p []byte) (int, error) {
+	h.n += int64(len(p))
+	if h.n >= h.next {
+		h.next += h.interval
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		h.peak = max(h.peak, m.HeapAlloc)
+	}
+	return len(p), nil
+}
+
+func TestDecompressToWriter_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("256MBを展開するため -short では省略")
+	}
+	const size = 256 << 20
+	const workers = 4
+	compressor := lz77.NewCompressor()
+	block := bytes.Repeat([]byte("bounded memory for large outputs. "), DefaultBlockSize/34+1)[:DefaultBlockSize]
+	src, err := repeatedContainer(block, compressor, size/DefaultBlockSize)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	probe := &heapProbe{interval: 16 << 20}
+	n, err := DecompressToWriter(src, probe, compressor, WithWorkers(workers))
+	if err != nil || n != size {
+		t.Fatalf("DecompressToWriter returned %d bytes (err %v)", n, err)
+	}
+
+	// 展開結果全体（256MB）ではなく、処理中のブロックの分だけ増える
+	growth := int64(probe.peak) - int64(before.HeapAlloc)
+	limit := int64(8 * workers * DefaultBlockSize)
+	t.Logf("heap growth %s for %s of output", common.FormatBytes(growth), common.FormatBytes(n))
+	if growth > limit {
+		t.Errorf("Heap grew by %d bytes, expected at most %d", growth, limit)
+	}
+}
+
+func TestFprintBlockInfo_Golden(t *testing.T) {
+	var out bytes.Buffer
+	FprintBlockInfo(&out, []BlockInfo{
+		{Index: 0, Offset: 0, OriginalSize: DefaultBlockSize, PayloadSize: 20 << 10, Mode: ModeCompressed},
+		{Index: 1, Offset: DefaultBlockSize, OriginalSize: 4096, PayloadSize: 4096, Mode: ModeStored},
+		{Index: 2, Offset: DefaultBlockSize + 4096, OriginalSize: 1 << 20, Mode: ModeZero},
+	})
+	golden.Check(t, "block_info", out.Bytes())
+}
+
+func TestWriter_MatchesCompress(t *testing.T) {
+	compressor := lz77.NewCompressor()
+	data := mixedData(40 * 1024)
+	want, err := CompressAdaptive(data, compressor, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewCompressor(compressor, 4096, true).NewWriter(&buf)
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 1000)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Writer output differs from CompressAdaptive (%d vs %d bytes)", buf.Len(), len(want))
+	}
+	if _, err := w.Write([]byte("a")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+
+	// 何も書き込まない場合はヘッダーだけ
+	buf.Reset()
+	if err := NewCompressor(compressor, 4096, false).NewWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Decompress(buf.Bytes(), compressor); err != nil || len(got) != 0 || buf.Len() != headerSize {
+		t.Errorf("Empty writer: %x decoded as %q, %v", buf.Bytes(), got, err)
+	}
+}
+
+func TestWriter_FlushOverPipe(t *testing.T) {
+	compressor := rle.NewCompressor()
+	requests := [][]byte{
+		[]byte("GET /metrics HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		bytes.Repeat([]byte("cpu=0.25 mem=512 disk=0.75\n"), 400),
+		[]byte("ok"),
+	}
+
+	pr, pw := io.Pipe()
+	decoded, decodedW := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := DecompressToWriter(pr, decodedW, compressor)
+		decodedW.CloseWithError(err)
+		errc <- err
+	}()
+
+	// 次のリクエストは、相手が前のリクエストを展開し終えてから書き込む
+	w := NewCompressor(compressor, 4096, true).NewWriter(pw)
+	for i, req := range requests {
+		if _, err := w.Write(req); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		got := make([]byte, len(req))
+		done := make(chan error, 1)
+		go func() {
+			_, err := io.ReadFull(decoded, got)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil || !bytes.Equal(got, req) {
+				t.Fatalf("Request %d decoded as %q (err %v)", i, got, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Request %d was not decoded after Flush", i)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	pw.Close()
+	if rest, err := io.ReadAll(decoded); err != nil || len(rest) > 0 {
+		t.Errorf("Unexpected data after the last request: %q, %v", rest, err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("DecompressToWriter failed: %v", err)
+	}
+}
+
+func TestWriter_SyncMarkersAreTransparent(t *testing.T) {
+	compressor := rle.NewCompressor()
+	var buf bytes.Buffer
+	w := NewCompressor(compressor, 1024, false).NewWriter(&buf)
+	var want []byte
+	for i := range 5 {
+		chunk := bytes.Repeat([]byte{byte('a' + i)}, 700*i)
+		want = append(want, chunk...)
+		w.Write(chunk)
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), syncMarker); n < 5 {
+		t.Errorf("Expected 5 sync markers, found %d", n)
+	}
+
+	got, err := Decompress(buf.Bytes(), compressor)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Decompress of flushed stream failed (err %v)", err)
+	}
+	infos, err := Inspect(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := InspectAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || !slices.Equal(infos, at) {
+		t.Errorf("InspectAt = %v, %v, want %v", at, err, infos)
+	}
+	var offset int64
+	for i, info := range infos {
+		if info.Index != i || info.Offset != offset || info.OriginalSize == 0 {
+			t.Errorf("Block %d: %+v, expected consecutive non-empty blocks without the sync markers", i, info)
+		}
+		offset += int64(info.OriginalSize)
+	}
+}
+
+// cancelingCompressor は after 回目の Compress の後に cancel を呼ぶCompressorです
+type cancelingCompressor struct {
+	common.Compressor
+	after  int
+	cancel context.CancelFunc
+}
+
+func (c *cancelingCompressor) Compress(data []byte) ([]byte, error) {
+	if c.after--; c.after == 0 {
+		c.cancel()
+	}
+	return c.Compressor.Compress(data)
+}
+
+func TestCompressDeadline_StoredTail(t *testing.T) {
+	const blockSize = 4096
+	data := testcorpus.Cycle(64 * blockSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary := &cancelingCompressor{Compressor: lz77.NewCompressor(), after: 3, cancel: cancel}
+	c := NewCompressor(primary, blockSize, false)
+
+	compressed, stats, err := common.CompressDeadline(ctx, c, data)
+	if err != nil {
+		t.Fatalf("CompressDeadline failed: %v", err)
+	}
+	if !stats.DeadlineExceeded || stats.CompressedFraction != 3.0/64 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	infos, err := Inspect(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if want := info.Index >= 3; (info.Mode == ModeStored) != want {
+			t.Errorf("Block %d: mode %s", info.Index, info.Mode)
+		}
+	}
+
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Error("Data mismatch")
+	}
+}
+
+func TestCompressDeadline_TinyDeadline(t *testing.T) {
+	data := testcorpus.Cycle(4 << 20)
+	c := NewCompressor(lz77.NewCompressor(), 4096, true)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	compressed, stats, err := common.CompressDeadline(ctx, c, data)
+	if err != nil {
+		t.Fatalf("CompressDeadline failed: %v", err)
+	}
+	if !stats.DeadlineExceeded || stats.CompressedFraction >= 1 {
+		t.Errorf("Expected a stored tail: %+v", stats)
+	}
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Error("Data mismatch")
+	}
+}
+
+func TestCompressDeadline_GenerousDeadline(t *testing.T) {
+	data := mixedData(32 * 1024)
+	c := NewCompressor(lz77.NewCompressor(), 4096, true)
+	want, err := c.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	got, stats, err := common.CompressDeadline(ctx, c, data)
+	if err != nil {
+		t.Fatalf("CompressDeadline failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("Output differs from Compress")
+	}
+	if stats.DeadlineExceeded || stats.CompressedFraction != 1 || stats.Algorithm != c.Name() {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
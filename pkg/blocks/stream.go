@@ -0,0 +1,280 @@
+package blocks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// payloadPrealloc はペイロードを読み込む前に確保する最大のバイト数です
+// 壊れたヘッダーの巨大なペイロードサイズで大きな確保をしないよう、これを超える分は
+// 実際に読み込めた分だけ確保します。
+const payloadPrealloc = 1 << 20
+
+// zeroChunk は ModeZero のブロックを書き込むための0の列です
+var zeroChunk [32 * 1024]byte
+
+// errStopped は書き込み側が止まったため、読み込みを中断したことを表します
+var errStopped = errors.New("blocks: stopped")
+
+// DecompressOption は DecompressToWriter の設定です
+type DecompressOption func(*decompressConfig)
+
+type decompressConfig struct {
+	workers int
+	limits  common.DecompressOptions
+}
+
+// WithWorkers は同時に展開するブロックの数を設定します（1以下の場合は1）
+// 展開の順序によらず、出力はブロックの順に書き込みます。
+func WithWorkers(n int) DecompressOption {
+	return func(c *decompressConfig) {
+		c.workers = max(n, 1)
+	}
+}
+
+// WithLimits は出力サイズの上限とメモリ予算を設定します
+// 予算はブロックを展開してから書き込み終わるまでの間だけ確保します。
+func WithLimits(opts common.DecompressOptions) DecompressOption {
+	return func(c *decompressConfig) {
+		c.limits = opts
+	}
+}
+
+// blockJob は読み込んだ1ブロックと、その展開結果を受け取るチャネルです
+type blockJob struct {
+	info     BlockInfo
+	payload  []byte
+	reserved int64 // ReserveOutput で確保したバイト数
+	result   chan blockResult
+}
+
+type blockResult struct {
+	data   []byte
+	err    error
+	filled bool // 展開できなかったため data を Fill で埋めた（予算から確保していない）
+}
+
+// DecompressToWriter は r からブロックコンテナを読みながら展開し、ブロックの順に w に書き込みます
+// 入力全体も展開結果全体もメモリに保持しないため、メモリより大きな展開結果も扱えます。
+// ブロックの読み込み、展開（WithWorkers の数のゴルーチン）、書き込みを並行に行い、
+// 読み込んでから書き込み終わるまでのブロックは最大で展開の並列数 + 2 個です。書き込みが
+// 遅い場合は読み込みを待たせるため、メモリ使用量はブロックサイズ × 並列数 に比例し、
+// 展開結果のサイズによりません。c は圧縮時に使用したアルゴリズムでなければなりません。
+// 書き込んだバイト数を返します。エラーの場合も、それまでのブロックは書き込み済みです。
+// WithLimits の OnDamage を指定した場合は、展開できないブロックを Fill で埋めて続けます
+// （OnDamage はブロックの順に、書き込むゴルーチンから呼び出します）。
+func DecompressToWriter(r io.Reader, w io.Writer, c common.Compressor, opts ...DecompressOption) (int64, error) {
+	cfg := decompressConfig{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	br := bufio.NewReader(r)
+	version, err := readStreamHeader(br)
+	if err != nil {
+		return 0, err
+	}
+
+	// pending は読み込んだ順のブロックで、容量を超えると読み込みを待たせる
+	jobs := make(chan *blockJob)
+	pending := make(chan *blockJob, cfg.workers)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for range cfg.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				data, err := decodeBlock(job.info, job.payload, c, cfg.limits.Budget)
+				job.result <- blockResult{data: data, err: err}
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		readErr <- readBlocks(br, version, func(info BlockInfo, payload []byte) error {
+			job := &blockJob{info: info, payload: payload, result: make(chan blockResult, 1)}
+			if info.Mode != ModeZero {
+				job.reserved = int64(info.OriginalSize)
+			}
+			total := info.Offset + int64(info.OriginalSize)
+			if err := cfg.limits.ReserveOutput(job.reserved, total); err != nil {
+				return fmt.Errorf("blocks: block %d: %w", info.Index, err)
+			}
+			select {
+			case pending <- job:
+			case <-done:
+				cfg.limits.Budget.Release(job.reserved)
+				return errStopped
+			}
+			if info.Mode == ModeZero {
+				job.result <- blockResult{}
+				return nil
+			}
+			select {
+			case jobs <- job:
+			case <-done:
+				job.result <- blockResult{err: errStopped}
+			}
+			return nil
+		})
+	}()
+
+	var written int64
+	for job := range pending {
+		res := <-job.result
+		if res.err != nil && res.err != errStopped {
+			if err := reportDamage(job.info, res.err, cfg.limits); err != nil {
+				res.err = err
+			} else {
+				res = blockResult{data: common.AppendFill(nil, cfg.limits.Fill, job.info.OriginalSize), filled: true}
+			}
+		}
+		if err = res.err; err == nil {
+			var n int64
+			n, err = writeBlock(w, job.info, res.data)
+			written += n
+		}
+		release(job, res, cfg.limits.Budget)
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		// 読み込みと展開を止め、展開済みのブロックの予算を返却する
+		close(done)
+		for job := range pending {
+			release(job, <-job.result, cfg.limits.Budget)
+		}
+	}
+	wg.Wait()
+	if rerr := <-readErr; err == nil && rerr != nil {
+		err = rerr
+	}
+	return written, err
+}
+
+// release はブロックを書き込み終えた（または捨てた）後に、確保した予算を返却します
+func release(job *blockJob, res blockResult, budget *common.Budget) {
+	budget.Release(job.reserved)
+	if job.info.Mode == ModeCompressed && res.err == nil && !res.filled {
+		budget.Release(int64(len(res.data)))
+	}
+}
+
+// writeBlock は展開した1ブロックを w に書き込みます（ModeZero は元サイズ分の0）
+func writeBlock(w io.Writer, info BlockInfo, data []byte) (int64, error) {
+	if info.Mode != ModeZero {
+		n, err := w.Write(data)
+		return int64(n), err
+	}
+	var written int64
+	for remaining := info.OriginalSize; remaining > 0; {
+		n, err := w.Write(zeroChunk[:min(remaining, len(zeroChunk))])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		remaining -= n
+	}
+	return written, nil
+}
+
+// readStreamHeader はヘッダーを読み込み、形式のバージョンを返します
+func readStreamHeader(r io.Reader) (byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:len(magic)]) != magic {
+		return 0, fmt.Errorf("blocks: invalid header")
+	}
+	v := header[len(magic)]
+	if v > Version {
+		return 0, &common.ErrUnsupportedVersion{Format: "blocks", Have: v, Max: Version}
+	} else if v < versionNoZero {
+		return 0, fmt.Errorf("blocks: unsupported Version: %d", v)
+	}
+	return v, nil
+}
+
+// readBlocks は walk と同じ確認をしながら r からブロックを順に読み込み、ブロックごとに fn を呼び出します
+// ブロックの区切りで入力が終わった場合は nil を返します。同期マーカーは読み飛ばします。
+func readBlocks(r *bufio.Reader, v byte, fn func(info BlockInfo, payload []byte) error) error {
+	var offset int64
+
+	for index := 0; ; {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		mode := Mode(b)
+		if err := checkMode(index, v, mode); err != nil {
+			return err
+		}
+
+		originalSize, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("blocks: block %d: invalid original size", index)
+		}
+		payloadSize, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("blocks: block %d: invalid payload size", index)
+		}
+		if err := checkBlock(index, mode, originalSize, payloadSize); err != nil {
+			return err
+		}
+		if isSync(mode, originalSize, payloadSize) {
+			continue
+		}
+
+		payload, err := readPayload(r, int64(payloadSize))
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("blocks: block %d: truncated payload", index)
+		} else if err != nil {
+			return err
+		}
+
+		info := BlockInfo{
+			Index:        index,
+			Offset:       offset,
+			OriginalSize: int(originalSize),
+			PayloadSize:  int(payloadSize),
+			Mode:         mode,
+		}
+		if err := fn(info, payload); err != nil {
+			return err
+		}
+		offset += int64(originalSize)
+		index++
+	}
+}
+
+// readPayload は r から size バイトを読み込みます
+// payloadPrealloc を超えるペイロードは読み込めた分だけ確保を増やします。
+func readPayload(r io.Reader, size int64) ([]byte, error) {
+	if size <= payloadPrealloc {
+		payload := make([]byte, size)
+		_, err := io.ReadFull(r, payload)
+		return payload, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, payloadPrealloc))
+	if n, err := io.CopyN(buf, r, size); err != nil {
+		if n < size && err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,130 @@
+package blocks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrClosed は Close した Writer に書き込んだことを表します
+var ErrClosed = errors.New("blocks: writer is closed")
+
+// Writer は書き込まれたデータをブロックに分けて圧縮し、ブロックコンテナとして w に書き込みます
+// ブロックサイズ分のデータがたまるごとに1ブロックを書き込むため、保持するデータは1ブロック
+// 分です。出力は Compress と同じ形式で、DecompressToWriter や Decompress で展開できます
+// （0の領域がブロックの境界をまたぐ場合は、Compress と区切り方が異なることがあります）。
+//
+// 通信のように相手がすぐに展開する必要がある場合は、区切りごとに Flush を呼びます。
+// 同時に使用することはできません。
+type Writer struct {
+	w      io.Writer
+	b      *Compressor
+	buf    []byte // まだブロックにしていないデータ
+	index  int    // 次のブロックの番号
+	header bool   // ヘッダーを書き込んだ
+	closed bool
+	err    error
+}
+
+// NewWriter は b の設定（アルゴリズム、ブロックサイズ、adaptive、Policy）で w に書き込む Writer を作成します
+// ヘッダーは最初にブロックか同期マーカーを書き込むときに書き込みます。
+func (b *Compressor) NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, b: b}
+}
+
+// Write は p をバッファに追加し、ブロックサイズに達した分を w に書き込みます
+func (z *Writer) Write(p []byte) (int, error) {
+	if err := z.check(); err != nil {
+		return 0, err
+	}
+	z.buf = append(z.buf, p...)
+	if full := len(z.buf) - len(z.buf)%max(z.b.blockSize, 1); full > 0 {
+		if err := z.emit(z.buf[:full], false); err != nil {
+			return 0, err
+		}
+		z.buf = append(z.buf[:0], z.buf[full:]...)
+	}
+	return len(p), nil
+}
+
+// Flush はバッファのデータをブロックサイズに満たなくても1ブロックにし、同期マーカーを付けて w に書き込みます
+// Flush までに書き込んだデータは、DecompressToWriter が続きのブロックを待たずにすべて
+// 展開できます（compress/flate の Flush と同じ使い方です）。ストリームは続けて書き込めますが、
+// 短いブロックは圧縮率が下がり、同期マーカーの3バイトが増えます。w への書き込みは Flush ごとに1回です。
+func (z *Writer) Flush() error {
+	if err := z.check(); err != nil {
+		return err
+	}
+	if err := z.emit(z.buf, true); err != nil {
+		return err
+	}
+	z.buf = z.buf[:0]
+	return nil
+}
+
+// Close は残りのデータをブロックにしてストリームを終えます（w は閉じません）
+// 何も書き込まなかった場合は、ヘッダーだけ（空のデータのブロックコンテナ）を書き込みます。
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	if err := z.check(); err != nil {
+		return err
+	}
+	if err := z.emit(z.buf, false); err != nil {
+		return err
+	}
+	z.buf = nil
+	z.closed = true
+	if !z.header {
+		if _, err := z.w.Write(append([]byte(magic), Version)); err != nil {
+			z.err = err
+			return err
+		}
+		z.header = true
+	}
+	return nil
+}
+
+// check は書き込めるかを確認します
+func (z *Writer) check() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// emit は data をブロックにして（sync の場合は同期マーカーを付けて）1回で w に書き込みます
+func (z *Writer) emit(data []byte, sync bool) error {
+	if len(data) == 0 && !sync {
+		return nil
+	}
+	if z.b.blockSize <= 0 {
+		z.err = fmt.Errorf("blocks: invalid block size: %d", z.b.blockSize)
+		return z.err
+	}
+
+	var out []byte
+	if !z.header {
+		out = append(out, magic...)
+		out = append(out, Version)
+	}
+	out, next, err := appendBlocks(out, data, z.index, z.b.primary, z.b.blockSize, z.b.adaptive, z.b.policy)
+	if err != nil {
+		z.err = err
+		return err
+	}
+	if sync {
+		out = append(out, syncMarker...)
+	}
+	if _, err := z.w.Write(out); err != nil {
+		z.err = err
+		return err
+	}
+	z.index = next
+	z.header = true
+	return nil
+}
@@ -0,0 +1,312 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/compare"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/report"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// maxDOTInput はトライ木をDOT形式で出力できる入力の最大サイズです
+// 辞書のフレーズは入力のバイト数近くまで増えるため、図として読める大きさに制限します
+const maxDOTInput = 4 << 10
+
+// Analyze は入力を分析し、Algorithm で実際に圧縮・展開して検証した結果を表示します
+// 展開結果が元のデータと一致しない場合は終了コード1の ExitError を返します。
+func (r *Runner) Analyze(input string) error {
+	compressor, err := r.compressor()
+	if err != nil {
+		return err
+	}
+	data, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+	r.printInputInfo(input, data)
+
+	fmt.Fprintf(r.Out, "=== データ分析結果 ===\n")
+	fmt.Fprintf(r.Out, "アルゴリズム: %s\n", compressor.Name())
+	fmt.Fprintf(r.Out, "データサイズ: %s (%d bytes)\n", common.FormatBytes(int64(len(data))), len(data))
+
+	if len(data) > 0 {
+		entropy := common.CalculateEntropy(data)
+		fmt.Fprintf(r.Out, "エントロピー: %.3f bits/byte\n", entropy)
+		// 0次のエントロピーはバイトの出現頻度だけを見るため、RLE や LZ77 の下限ではない
+		fmt.Fprintf(r.Out, "理論的最小サイズ（0次）: %.1f bytes\n", common.OrderZeroFloor(data))
+	}
+
+	fmt.Fprintln(r.Out)
+	common.FprintDataType(r.Out, common.DetectDataType(data))
+	fmt.Fprintln(r.Out)
+
+	// アルゴリズム固有の分析
+	switch c := compressor.(type) {
+	case *rle.Compressor:
+		rle.FprintAnalysis(r.Out, rle.Analyze(data))
+		fmt.Fprintln(r.Out)
+	case *lz77.Compressor:
+		lz77.FprintMatchStats(r.Out, c.AnalyzeMatches(data))
+		fmt.Fprintln(r.Out)
+	}
+	if len(data) > 0 {
+		if err := r.printSavingsMap(data); err != nil {
+			return err
+		}
+	}
+	if r.DOTPath != "" {
+		if err := r.writeDOT(compressor, data); err != nil {
+			return err
+		}
+	}
+	if r.ExportStats != "" {
+		if err := r.exportStats(compressor, data); err != nil {
+			return err
+		}
+	}
+
+	// 実際に圧縮・展開して検証する
+	fmt.Fprintln(r.Out, "=== 圧縮テスト ===")
+	results := compare.RunCompressors(data, []common.Compressor{compressor}, compare.Options{NoVerify: r.NoVerify})
+	result := results.Results[0]
+	if result.Err != nil {
+		return fmt.Errorf("圧縮テストエラー: %w", result.Err)
+	}
+	common.FprintCompressionStats(r.Out, result.Stats)
+	if e := result.Efficiency(); e >= 0 {
+		fmt.Fprintf(r.Out, "アルゴリズムのモデルでの下限: %.1f bytes (効率 %.1f%%)\n", result.Floor, e*100)
+	}
+	if result.MismatchOffset >= 0 {
+		return &ExitError{Code: 1, Msg: fmt.Sprintf("✗ 検証エラー: 展開結果が元データと一致しません (offset %d)", result.MismatchOffset)}
+	}
+	return nil
+}
+
+// printSavingsMap は入力の DefaultSliceSize ごとに、各アルゴリズムが出力したバイト数を帯で表示します
+// 位置ごとの出力を通知できる（common.CostMapped）登録済みのアルゴリズムを既定の設定で比べます。
+func (r *Runner) printSavingsMap(data []byte) error {
+	var names []string
+	var algos []common.Compressor
+	for _, name := range common.Names() {
+		c, err := common.New(name)
+		if err != nil {
+			return fmt.Errorf("アルゴリズムエラー: %w", err)
+		}
+		if _, ok := c.(common.CostMapped); ok {
+			names = append(names, name)
+			algos = append(algos, c)
+		}
+	}
+	rows := compare.SavingsMap(data, algos, compare.DefaultSliceSize)
+	compare.FprintSavingsMap(r.Out, names, rows, len(data), compare.DefaultSliceSize)
+	fmt.Fprintln(r.Out)
+	return nil
+}
+
+// writeDOT はLZWの辞書のトライ木をDOT形式で DOTPath に書き込みます
+func (r *Runner) writeDOT(compressor common.Compressor, data []byte) error {
+	if _, ok := compressor.(*lzw.Compressor); !ok {
+		return errors.New("-dot は -algo lzw でのみ使用できます")
+	}
+	if len(data) > maxDOTInput {
+		return fmt.Errorf("-dot の入力は %s までです (%s)", common.FormatBytes(maxDOTInput), common.FormatBytes(int64(len(data))))
+	}
+	d := lzw.BuildDictionary(data)
+	var buf bytes.Buffer
+	if err := d.WriteDOT(&buf); err != nil {
+		return fmt.Errorf("DOT出力エラー: %w", err)
+	}
+	if err := fileutil.WriteFile(r.DOTPath, buf.Bytes(), r.writeOptions()); r.reportSkipped(err, r.DOTPath) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	fmt.Fprintf(r.Out, "=== LZW辞書 ===\n")
+	fmt.Fprintf(r.Out, "追加されたフレーズ: %d\n", len(d.Snapshot()))
+	fmt.Fprintf(r.Out, "トライ木: %s\n\n", r.DOTPath)
+	return nil
+}
+
+// statsExporter はCSVにも出力できる、アルゴリズム固有の統計データです
+type statsExporter interface {
+	WriteCSV(w io.Writer) error
+}
+
+// exportStats はアルゴリズム固有の統計データを ExportStats に書き込みます
+// 拡張子が .csv の場合はCSV、それ以外はJSONで出力します。
+func (r *Runner) exportStats(compressor common.Compressor, data []byte) error {
+	var stats statsExporter
+	switch c := compressor.(type) {
+	case *rle.Compressor:
+		stats = rle.Analyze(data)
+	case *lz77.Compressor:
+		stats = c.AnalyzeMatches(data)
+	case *huffman.Compressor:
+		if c.Width() == 1 {
+			stats = huffman.AnalyzeCodes(data)
+		}
+	}
+	if stats == nil {
+		return errors.New("-export-stats は -algo rle, lz77, huffman でのみ使用できます")
+	}
+
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(r.ExportStats), ".csv") {
+		if err := stats.WriteCSV(&buf); err != nil {
+			return fmt.Errorf("CSV出力エラー: %w", err)
+		}
+	} else {
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON出力エラー: %w", err)
+		}
+		buf.Write(append(out, '\n'))
+	}
+	if err := fileutil.WriteFile(r.ExportStats, buf.Bytes(), r.writeOptions()); r.reportSkipped(err, r.ExportStats) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	fmt.Fprintf(r.Out, "統計データ: %s\n\n", r.ExportStats)
+	return nil
+}
+
+// Report は登録済みの全アルゴリズムでレポートを作成し、reportPath に書き込みます
+// TemplatePath が空の場合は既定のMarkdownのテンプレートを使います。
+func (r *Runner) Report(input, reportPath string) error {
+	data, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+
+	var tmpl *template.Template
+	if r.TemplatePath != "" {
+		tmpl, err = template.New(filepath.Base(r.TemplatePath)).Funcs(report.Funcs()).ParseFiles(r.TemplatePath)
+		if err != nil {
+			return fmt.Errorf("テンプレートエラー: %w", err)
+		}
+	}
+
+	var algos []common.Compressor
+	for _, name := range common.Names() {
+		c, err := common.New(name)
+		if err != nil {
+			return fmt.Errorf("アルゴリズムエラー: %w", err)
+		}
+		algos = append(algos, c)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Generate(data, algos, tmpl, &buf); err != nil {
+		return fmt.Errorf("レポート作成エラー: %w", err)
+	}
+	if err := fileutil.WriteFile(reportPath, buf.Bytes(), r.writeOptions()); r.reportSkipped(err, reportPath) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	fmt.Fprintf(r.Out, "✅ レポート作成完了: %s -> %s\n", input, reportPath)
+	return nil
+}
+
+// Compare は登録済みの全アルゴリズムで各入力を圧縮・展開・検証し、結果を表示します
+// 複数の入力を指定した場合は、最後にアルゴリズムごとの合計を表示します。
+// 検証に失敗したアルゴリズムがあった場合は、すべての入力を処理してから ExitError を返します。
+func (r *Runner) Compare(inputs []string) error {
+	return r.compare(inputs, r.readInput, compare.Options{NoVerify: r.NoVerify, Policy: r.policy()})
+}
+
+// compare は read で読み込んだ各入力を比較します（Compare と Bench で共通）
+// inputs は表示とCSVに使う名前で、read はその名前からデータを返します。opts は比較の設定です。
+func (r *Runner) compare(inputs []string, read func(string) ([]byte, error), opts compare.Options) error {
+	var writers []*compare.CSVWriter
+	if r.CSV {
+		writers = append(writers, compare.NewCSVWriter(r.Out))
+	}
+	if r.CSVFile != "" {
+		f, err := fileutil.Create(r.CSVFile, r.writeOptions())
+		switch {
+		case r.reportSkipped(err, r.CSVFile):
+		case err != nil:
+			return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+		default:
+			defer f.Close()
+			writers = append(writers, compare.NewCSVWriter(f))
+		}
+	}
+
+	// 複数ファイルの場合はアルゴリズムごとに集計する
+	var algorithms []string
+	aggregates := make(map[string]*common.StatsAggregate)
+
+	exitCode := 0
+	for _, input := range inputs {
+		data, err := read(input)
+		if err != nil {
+			return err
+		}
+
+		result, err := compare.Run(data, nil, opts)
+		if err != nil {
+			return fmt.Errorf("比較エラー: %w", err)
+		}
+
+		// -csv の場合は出力をCSVだけにする
+		if !r.CSV {
+			if len(inputs) > 1 {
+				fmt.Fprintf(r.Out, "\n%s\n", input)
+			}
+			compare.FprintReport(r.Out, result)
+		}
+		for _, w := range writers {
+			if err := w.Write(input, result); err != nil {
+				return fmt.Errorf("CSV書き込みエラー: %w", err)
+			}
+		}
+		if code := result.ExitCode(); code != 0 {
+			exitCode = code
+		}
+
+		for _, res := range result.Results {
+			if res.Failed() {
+				continue
+			}
+			if aggregates[res.Algorithm] == nil {
+				algorithms = append(algorithms, res.Algorithm)
+				aggregates[res.Algorithm] = &common.StatsAggregate{}
+			}
+			stats := res.Stats
+			stats.Source = input
+			aggregates[res.Algorithm].Add(stats)
+		}
+	}
+
+	if !r.CSV && len(inputs) > 1 {
+		fmt.Fprintf(r.Out, "\n=== 合計 (%d ファイル) ===\n", len(inputs))
+		for _, name := range algorithms {
+			fmt.Fprintf(r.Out, "%-45s %s\n", name, aggregates[name].Summary())
+		}
+	}
+
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("CSV書き込みエラー: %w", err)
+		}
+	}
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode, Msg: "検証に失敗したアルゴリズムがあります"}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/archive"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// 圧縮の出力形式（-format）
+const (
+	formatTzz = "tzz" // 1つのファイルの.tzzコンテナ（デフォルト）
+	formatTza = "tza" // ディレクトリのバンドル（pkg/archive）
+	formatZip = "zip" // ディレクトリの zip
+)
+
+// 通常のファイルでない入力の扱い（-special）
+const (
+	specialSkip  = "skip"  // 警告を表示して飛ばす（デフォルト）
+	specialError = "error" // エラーにする
+)
+
+// アーカイブの展開でのシンボリックリンクの扱い（-symlinks）
+const (
+	symlinksSkip     = "skip"     // 作成しない
+	symlinksInternal = "internal" // 展開先の中を指すものだけを作成する（デフォルト）
+	symlinksAll      = "all"      // すべて作成する
+)
+
+// sourceDateEpoch は環境変数 SOURCE_DATE_EPOCH の値（UNIX 時刻の秒）を返します（空は0）
+// https://reproducible-builds.org/specs/source-date-epoch/ に従い、整数でない値はエラーにします。
+func sourceDateEpoch(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || sec < 0 {
+		return 0, fmt.Errorf("環境変数 SOURCE_DATE_EPOCH は0以上の整数（UNIX 時刻の秒）を指定してください: %q", value)
+	}
+	return sec, nil
+}
+
+// isArchiveFormat はディレクトリをまとめる出力形式かどうかを返します
+func isArchiveFormat(format string) bool {
+	return format == formatTza || format == formatZip
+}
+
+// compressArchive は input のディレクトリ（またはファイル1つ）を Format のアーカイブに圧縮します
+// output が空の場合は input に ".zip" または ".tza" を付けたファイルに出力します。
+// zip はエントリごとに deflate か無圧縮を選び、tza は -algo のアルゴリズムで圧縮します。
+func (r *Runner) compressArchive(input, output string) error {
+	if r.TargetRatio != 0 || r.TracePath != "" || r.FilterSpec != "" || r.Adaptive || r.DictPath != "" {
+		return fmt.Errorf("-format %s は -target-ratio, -trace, -filter, -adaptive, -dict とは併用できません", r.Format)
+	}
+	if output == "" {
+		output = filepath.Clean(input) + "." + r.Format
+	}
+
+	var writerOpts []archive.WriterOption
+	if r.Reproducible {
+		// 1980年より前（0を含む）は zip で表せないため、WithReproducible が1980年に丸める
+		writerOpts = append(writerOpts, archive.WithReproducible(time.Unix(r.SourceDateEpoch, 0)))
+	}
+	var buf bytes.Buffer
+	w := archive.ArchiveWriter(archive.NewZipWriter(&buf, writerOpts...))
+	algorithm := formatZip
+	if r.Format == formatTza {
+		algorithm = r.algorithmName()
+		if _, err := common.New(algorithm); err != nil {
+			return fmt.Errorf("未対応のアルゴリズム: %s", r.Algorithm)
+		}
+		w = archive.NewWriter(&buf, algorithm, writerOpts...)
+	}
+
+	filter, err := r.archiveFilter()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	info, err := os.Stat(input)
+	if err != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	var failed archive.FileErrors
+	skipped := make(map[archive.SkipReason]int)
+	if info.IsDir() {
+		workers := r.Parallel
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		err = archive.WriteFSParallel(w, archive.DirFS(input), archive.WithWorkers(workers), archive.WithFailFast(r.FailFast),
+			archive.WithFilter(filter), archive.WithRejectSpecial(r.Special == specialError),
+			archive.WithFollowSymlinks(r.FollowSymlinks), archive.WithExternalTargets(r.AllowExternal),
+			archive.WithSkipped(func(name string, reason archive.SkipReason) {
+				skipped[reason]++
+				switch reason {
+				case archive.SkipSpecial:
+					fmt.Fprintf(r.Err, "⚠️  スキップ: %s は通常のファイルではありません\n", name)
+				case archive.SkipSymlinkCycle:
+					fmt.Fprintf(r.Err, "⚠️  スキップ: %s はたどると循環するシンボリックリンクです\n", name)
+				case archive.SkipExternalSymlink:
+					fmt.Fprintf(r.Err, "⚠️  スキップ: %s は %s の外を指すシンボリックリンクです（-allow-external-targets でたどる）\n", name, input)
+				}
+			}))
+		// 読み込めなかったファイルは飛ばして、残りのアーカイブを書き込んでから報告する
+		if errors.As(err, &failed) {
+			err = nil
+		}
+	} else {
+		var data []byte
+		if data, err = os.ReadFile(input); err == nil {
+			err = w.AddFile(filepath.Base(input), data)
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("圧縮エラー: %w", err)
+	}
+	if err := fileutil.WriteFile(output, buf.Bytes(), r.writeOptions()); r.reportSkipped(err, output) {
+		return r.reportFailedFiles(failed)
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+
+	s := w.Stats()
+	stats := common.CompressionStats{
+		OriginalSize:   s.Size,
+		CompressedSize: int64(buf.Len()),
+		Algorithm:      algorithm,
+		Duration:       time.Since(start),
+		Source:         input,
+	}
+	stats.CalculateRatio()
+	if r.JSON {
+		if err := r.printStatsJSON(stats); err != nil {
+			return err
+		}
+		r.printSkipSummary(r.Err, skipped)
+		return r.reportFailedFiles(failed)
+	}
+
+	fmt.Fprintf(r.Out, "✅ 圧縮完了: %s -> %s\n", input, output)
+	if r.Verbose {
+		ar, err := archive.Open(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("アーカイブ読み込みエラー: %w", err)
+		}
+		archive.FprintEntries(r.Out, ar)
+	} else {
+		fmt.Fprintf(r.Out, "%d エントリ, 圧縮率: %.2f%% (%s -> %s)\n", s.Entries,
+			stats.Ratio*100, common.FormatBytes(stats.OriginalSize), common.FormatBytes(stats.CompressedSize))
+	}
+	r.printSkipSummary(r.Out, skipped)
+	return r.reportFailedFiles(failed)
+}
+
+// archiveFilter は Include、Exclude、MaxFileSize からディレクトリの圧縮で追加するファイルの条件を作成します
+func (r *Runner) archiveFilter() (archive.Filter, error) {
+	var filter archive.Filter
+	if r.Include != "" {
+		filter.Include = strings.Split(r.Include, ",")
+	}
+	if r.Exclude != "" {
+		filter.Exclude = strings.Split(r.Exclude, ",")
+	}
+	if r.MaxFileSize != "" {
+		size, err := common.ParseBytes(r.MaxFileSize)
+		if err != nil {
+			return filter, fmt.Errorf("オプションエラー: %w", err)
+		}
+		filter.MaxFileSize = size
+	}
+	if err := filter.Validate(); err != nil {
+		return filter, fmt.Errorf("オプションエラー: %w", err)
+	}
+	return filter, nil
+}
+
+// printSkipSummary はディレクトリの圧縮で追加しなかったファイルの数を理由ごとに w に表示します（なければ何もしません）
+func (r *Runner) printSkipSummary(w io.Writer, skipped map[archive.SkipReason]int) {
+	var parts []string
+	for _, s := range []struct {
+		reason archive.SkipReason
+		label  string
+	}{
+		{archive.SkipExcluded, "除外"},
+		{archive.SkipNotIncluded, "対象外"},
+		{archive.SkipTooLarge, "サイズ超過"},
+		{archive.SkipSpecial, "特殊なファイル"},
+		{archive.SkipSymlinkCycle, "循環するリンク"},
+		{archive.SkipExternalSymlink, "外を指すリンク"},
+	} {
+		if n := skipped[s.reason]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", s.label, n))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "スキップ: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// checkSpecial は input が名前付きパイプ、デバイス、ソケットなどの通常のファイルでないかを確認します
+// 読み込むと止まったり意味のないデータになったりするため、Special が error の場合はエラーを返し、
+// それ以外は警告を Err に表示して true を返します（呼び出し側は何もせずに終わります）。
+// "-"（標準入力）とディレクトリ、存在しないパスは確認しません（存在しない場合は各モードの読み込みで報告します）。
+func (r *Runner) checkSpecial(input string) (bool, error) {
+	if input == "-" {
+		return false, nil
+	}
+	info, err := os.Stat(input)
+	if err != nil || info.Mode().IsRegular() || info.IsDir() {
+		return false, nil
+	}
+	if r.Special == specialError {
+		return false, fmt.Errorf("%s は通常のファイルではありません（%s）", input, fileKind(info.Mode()))
+	}
+	fmt.Fprintf(r.Err, "⚠️  スキップ: %s は通常のファイルではありません（%s）\n", input, fileKind(info.Mode()))
+	return true, nil
+}
+
+// fileKind は通常のファイルでない mode の種類の表示名を返します
+func fileKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "名前付きパイプ"
+	case mode&fs.ModeSocket != 0:
+		return "ソケット"
+	case mode&fs.ModeCharDevice != 0:
+		return "キャラクターデバイス"
+	case mode&fs.ModeDevice != 0:
+		return "デバイス"
+	}
+	return "特殊なファイル"
+}
+
+// reportFailedFiles はアーカイブに追加できなかったファイルを Err に表示し、あれば ExitError を返します
+func (r *Runner) reportFailedFiles(failed archive.FileErrors) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	for _, fe := range failed {
+		fmt.Fprintf(r.Err, "❌ %s: %v\n", fe.Name, fe.Err)
+	}
+	return &ExitError{Code: 1, Msg: fmt.Sprintf("%d 個のファイルを追加できませんでした（残りのファイルは書き込み済み）", len(failed))}
+}
+
+// openArchive は input がバンドル（.tza）か zip なら開いて返します
+// どちらでもない場合は nil を返します（.tzzコンテナなどはそれぞれのモードで扱います）。
+func openArchive(input string) (archive.ArchiveReader, error) {
+	if input == "-" {
+		return nil, nil
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	defer f.Close()
+	header := make([]byte, 4)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	if !archive.IsArchive(header[:n]) {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	ar, err := archive.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("アーカイブ読み込みエラー: %w%s", err, newerVersionHint(err))
+	}
+	return ar, nil
+}
+
+// extractArchive は ar のすべてのエントリを output のディレクトリに展開します
+// output が空の場合は input から拡張子を除いた（なければ ".extracted" を付けた）ディレクトリです。
+// 既存のファイルの扱いは他の出力と同じで、-skip-existing などでスキップした数も表示します。
+// シンボリックリンクは Symlinks に従って作成し、作成しなかった数を表示します。
+func (r *Runner) extractArchive(ar archive.ArchiveReader, input, output string) error {
+	if output == "" {
+		if ext := filepath.Ext(input); ext != "" {
+			output = strings.TrimSuffix(input, ext)
+		} else {
+			output = input + ".extracted"
+		}
+	}
+	writeOpts := r.writeOptions()
+	res, err := archive.ExtractWithOptions(ar, output, archive.ExtractOptions{
+		Overwrite:      writeOpts.Overwrite,
+		SkipExisting:   writeOpts.SkipExisting,
+		VerifyExisting: writeOpts.VerifyExisting,
+		Symlinks:       r.symlinkPolicy(),
+	})
+	if err != nil {
+		return fmt.Errorf("展開エラー: %w%s", err, existingHint(err))
+	}
+
+	s := ar.Stats()
+	fmt.Fprintf(r.Out, "✅ 展開完了: %s -> %s%c\n", input, output, filepath.Separator)
+	fmt.Fprintf(r.Out, "%d エントリ, %s\n", s.Entries, common.FormatBytes(s.Size))
+	if skipped := res.Skipped + res.Identical; skipped > 0 {
+		fmt.Fprintf(r.Out, "書き込み: %d エントリ, スキップ: %d エントリ（既存 %d, 同じ内容 %d）\n",
+			res.Written, skipped, res.Skipped, res.Identical)
+	}
+	if res.Symlinks > 0 || res.SkippedSymlinks > 0 {
+		fmt.Fprintf(r.Out, "シンボリックリンク: 作成 %d, 作成しなかった %d（-symlinks %s）\n",
+			res.Symlinks, res.SkippedSymlinks, r.symlinkPolicy())
+	}
+	return nil
+}
+
+// symlinkPolicy は Symlinks（-symlinks）の展開でのシンボリックリンクの扱いを返します（空は internal）
+func (r *Runner) symlinkPolicy() archive.SymlinkPolicy {
+	switch r.Symlinks {
+	case symlinksSkip:
+		return archive.SymlinkSkip
+	case symlinksAll:
+		return archive.SymlinkAll
+	}
+	return archive.SymlinkInternal
+}
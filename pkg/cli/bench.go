@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/compare"
+)
+
+// Bench は -corpus で指定した公開コーパスの各ファイルを、比較モードと同じく
+// 登録済みの全アルゴリズムで圧縮・展開・検証し、結果とメモリの目安を表示します
+// コーパスはキャッシュ（os.UserCacheDir）になければダウンロードします。Offline の場合や
+// ダウンロードできない場合は、そのコーパスをスキップして Err に理由を表示し、
+// キャッシュにあるものだけで比較します。1つも使えない場合はエラーを返します。
+func (r *Runner) Bench(names string) error {
+	var cache corpus.Cache
+	if r.corpusCache != nil {
+		cache = *r.corpusCache
+	}
+	cache.Offline = r.Offline
+	known := r.corpora
+	if known == nil {
+		known = corpus.All()
+	}
+
+	var inputs []string
+	files := make(map[string][]byte)
+	for _, name := range strings.Split(names, ",") {
+		c, err := corpus.Find(known, strings.TrimSpace(name))
+		if err != nil {
+			return fmt.Errorf("未対応のコーパス: %s（%s）", name, corpusNames(known))
+		}
+		fetched, err := cache.Fetch(context.Background(), c)
+		if err != nil {
+			fmt.Fprintf(r.Err, "⚠️  スキップ: %s（%s）\n", c.Name, corpusSkipReason(err))
+			continue
+		}
+		for _, f := range fetched {
+			input := c.Name + "/" + f.Name
+			inputs = append(inputs, input)
+			files[input] = f.Data
+		}
+	}
+	if len(inputs) == 0 {
+		return errors.New("使用できるコーパスがありません")
+	}
+	// 組み込み向けの比較のため、圧縮・展開で増えたメモリの目安も表示する
+	return r.compare(inputs, func(input string) ([]byte, error) {
+		return files[input], nil
+	}, compare.Options{NoVerify: r.NoVerify, MeasureMemory: true, Policy: r.policy()})
+}
+
+// corpusSkipReason はコーパスをスキップした理由を表示用に変換します
+func corpusSkipReason(err error) string {
+	switch {
+	case errors.Is(err, corpus.ErrNotCached):
+		return "キャッシュにありません。-offline を外すとダウンロードします"
+	case errors.Is(err, corpus.ErrNotPinned):
+		return "チェックサムが固定されていないためダウンロードしません"
+	case errors.Is(err, corpus.ErrChecksumMismatch):
+		return "チェックサムが一致しません"
+	default:
+		return fmt.Sprintf("ダウンロードできません: %v", err)
+	}
+}
+
+// corpusNames はコーパス名を表示用につなげます
+func corpusNames(list []corpus.Corpus) string {
+	var names []string
+	for _, c := range list {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
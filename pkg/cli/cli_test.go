@@ -0,0 +1,1880 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corpus"
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+	"github.com/sasakihasuto/tinyzipzap/pkg/delta"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+)
+
+var sample = []byte(strings.Repeat("aaaaabbbbbcccccdddddeeeee hello world\n", 64))
+
+// newTestRunner はメモリ上のバッファを入出力に使う Runner を作成します
+func newTestRunner(stdin []byte, opts Options) (*Runner, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Runner{In: bytes.NewReader(stdin), Out: out, Err: &bytes.Buffer{}, Options: opts}, out
+}
+
+// writeSample は一時ディレクトリに data を書き込み、そのパスを返します
+func writeSample(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunner_CompressDecompress(t *testing.T) {
+	for _, algo := range common.Names() {
+		t.Run(algo, func(t *testing.T) {
+			input := writeSample(t, "sample.txt", sample)
+			// 展開は元の入力ファイルに上書きする
+			r, out := newTestRunner(nil, Options{Algorithm: algo, Force: true})
+
+			if err := r.Compress(input, ""); err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			compressed := input + common.Extension(algo)
+			if !strings.Contains(out.String(), "✅ 圧縮完了: "+input+" -> "+compressed) {
+				t.Errorf("Unexpected output:\n%s", out)
+			}
+
+			out.Reset()
+			if err := r.Decompress(compressed, ""); err != nil {
+				t.Fatalf("Decompress failed: %v", err)
+			}
+			if !strings.Contains(out.String(), "✅ 展開完了") {
+				t.Errorf("Unexpected output:\n%s", out)
+			}
+			got, err := os.ReadFile(input)
+			if err != nil || !bytes.Equal(got, sample) {
+				t.Errorf("Round trip mismatch (err %v)", err)
+			}
+		})
+	}
+}
+
+func TestRunner_DefaultExtensions(t *testing.T) {
+	tests := []struct {
+		algo string
+		want string
+	}{
+		{"rle", ".rle"},
+		{"rle-gamma", ".rleg"},
+		{"huffman", ".huf"},
+		{"huffman16", ".huf16"},
+		{"lz77", ".lz77"},
+		{"lz77-optimal", ".lz77"},
+		{"lz77h", ".lz77h"},
+		{"lzw", ".lzw"},
+		{"lzp", ".lzp"},
+		{"gzip", ".tzz"},
+		{"best", ".tzz"},
+		{"auto", ".tzz"},
+	}
+	for _, tt := range tests {
+		r, _ := newTestRunner(nil, Options{Algorithm: strings.ToUpper(tt.algo)})
+		if got := r.defaultCompressOutput("dir/a.txt"); got != "dir/a.txt"+tt.want {
+			t.Errorf("%s: expected dir/a.txt%s, got %s", tt.algo, tt.want, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		input, want string
+		ok          bool
+	}{
+		{"a.txt.lz77", "a.txt", true},
+		{"dir/a.txt.huf", "dir/a.txt", true},
+		{"a.tzz", "a", true},
+		{"a.txt.compressed", "a.txt", true},
+		{"a.txt", "", false},
+		{"a.LZ77", "", false},
+		{"noext", "", false},
+		{"dir/.rle", "", false},
+	} {
+		if got, ok := trimExtension(tt.input); got != tt.want || ok != tt.ok {
+			t.Errorf("%s: expected (%q, %v), got (%q, %v)", tt.input, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestRunner_DecompressUnknownExtension(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	r, _ := newTestRunner(nil, Options{Algorithm: "huffman"})
+	if err := r.Compress(input, ""); err != nil {
+		t.Fatal(err)
+	}
+	renamed := input + ".bak"
+	if err := os.Rename(input+".huf", renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	err := r.Decompress(renamed, "")
+	if err == nil || !strings.Contains(err.Error(), "-o で指定してください") {
+		t.Fatalf("Expected a refusal to guess the output name, got %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(input)); len(entries) != 2 {
+		t.Errorf("Expected no output file to be created, got %d entries", len(entries))
+	}
+
+	// -o を指定すれば拡張子によらず展開できる
+	output := filepath.Join(t.TempDir(), "out.txt")
+	if err := r.Decompress(renamed, output); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, sample) {
+		t.Error("Round trip mismatch")
+	}
+}
+
+func TestRunner_CompressStdinJSON(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "sub", "out.tzz")
+	r, out := newTestRunner(sample, Options{Algorithm: "LZ77", JSON: true, Mkdir: true})
+	if err := r.Compress("-", output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	var stats common.CompressionStats
+	if err := json.Unmarshal(out.Bytes(), &stats); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", out, err)
+	}
+	if stats.OriginalSize != int64(len(sample)) {
+		t.Errorf("Expected original size %d, got %d", len(sample), stats.OriginalSize)
+	}
+	for _, phase := range []string{common.PhaseRead, common.PhaseCompress, common.PhaseWrite, lz77.PhaseMatch, lz77.PhaseSerialize} {
+		if !slices.Contains(stats.Timings.Phases(), phase) {
+			t.Errorf("Expected phase %q in timings, got %v", phase, stats.Timings.Phases())
+		}
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := container.Decompress(data, common.New, common.DecompressOptions{})
+	if err != nil || !bytes.Equal(got, sample) {
+		t.Errorf("Expected a valid container (err %v)", err)
+	}
+}
+
+func TestRunner_CompressTarget(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	output := filepath.Join(t.TempDir(), "out.tzz")
+
+	r, out := newTestRunner(nil, Options{Algorithm: "auto", TargetRatio: 0.5})
+	if err := r.Compress(input, output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "✅ 圧縮完了") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	// 乱数に近いデータは目標を満たさず、そのまま書き込まれる
+	noise := make([]byte, 256)
+	for i := range noise {
+		noise[i] = byte(i * 167)
+	}
+	r, out = newTestRunner(noise, Options{Algorithm: "auto", TargetRatio: 0.1, Force: true})
+	if err := r.Compress("-", output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, noise) || !strings.Contains(out.String(), "目標未達") {
+		t.Errorf("Expected the input stored as-is, got output:\n%s", out)
+	}
+}
+
+func TestRunner_CompressTargetOversized(t *testing.T) {
+	defer common.SetMaxOneShotSize(common.SetMaxOneShotSize(1024))
+	noise := make([]byte, 1025)
+	for i := range noise {
+		noise[i] = byte(i * 167)
+	}
+	// 上限ちょうどの入力はこれまでどおり全体を読み込んで圧縮する
+	atLimit := writeSample(t, "limit.txt", sample[:1024])
+	tests := []struct {
+		name     string
+		input    string
+		stdin    []byte
+		opts     Options
+		want     []byte
+		routed   bool
+		notMet   bool
+		wantAlgo string
+	}{
+		{"file", writeSample(t, "sample.txt", sample[:1025]), nil, Options{Algorithm: "lz77", TargetRatio: 0.5}, sample[:1025], true, false, "lz77"},
+		{"stdin auto", "-", sample[:1025], Options{Algorithm: "auto", TargetRatio: 0.5}, sample[:1025], true, false, ""},
+		{"not met", writeSample(t, "noise.bin", noise), nil, Options{Algorithm: "lz77", TargetRatio: 0.1}, noise, true, true, "lz77"},
+		{"at limit", atLimit, nil, Options{Algorithm: "lz77", TargetRatio: 0.5}, sample[:1024], false, false, "lz77"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.tzz")
+			r, out := newTestRunner(tt.stdin, tt.opts)
+			if err := r.Compress(tt.input, output); err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			if routed := strings.Contains(r.Err.(*bytes.Buffer).String(), "ストリームで圧縮します"); routed != tt.routed {
+				t.Errorf("Routed to streaming = %v, want %v (stderr %q)", routed, tt.routed, r.Err)
+			}
+			if notMet := strings.Contains(out.String(), "目標未達"); notMet != tt.notMet {
+				t.Errorf("Target not met = %v, want %v:\n%s", notMet, tt.notMet, out)
+			}
+
+			// 目標を満たさなくても、ストリームで圧縮した場合はコンテナとして書き込む
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scan, err := container.Scan(bytes.NewReader(data))
+			if err != nil || len(scan.Members) == 0 {
+				t.Fatalf("Expected a valid container: %v", err)
+			}
+			if tt.wantAlgo != "" && scan.Members[0].Algorithm != tt.wantAlgo {
+				t.Errorf("Member algorithm = %q, want %q", scan.Members[0].Algorithm, tt.wantAlgo)
+			}
+			got, err := container.Decompress(data, common.New, common.DecompressOptions{})
+			if err != nil || !bytes.Equal(got, tt.want) {
+				t.Errorf("Round trip failed (err %v)", err)
+			}
+		})
+	}
+
+	// 上限を超える入力をストリームで圧縮することは暗黙の選択なので、Strict ではエラーにする
+	r, _ := newTestRunner(nil, Options{Algorithm: "rle", TargetRatio: 0.5, Strict: true})
+	err := r.Compress(writeSample(t, "strict.txt", sample[:1025]), filepath.Join(t.TempDir(), "out.tzz"))
+	if !errors.Is(err, common.ErrStrict) || !strings.Contains(err.Error(), "one-shot limit") {
+		t.Errorf("Expected a strict error, got %v", err)
+	}
+
+	// -append は入力全体を1メンバーにするため、上限を超える入力はエラーにして案内する
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle"})
+	err = r.Append(writeSample(t, "append.txt", sample[:1025]), filepath.Join(t.TempDir(), "out.tzz"))
+	if !errors.Is(err, common.ErrInputTooLarge) || !strings.Contains(err.Error(), "-append を付けずに") {
+		t.Errorf("Expected ErrInputTooLarge with a hint, got %v", err)
+	}
+}
+
+func TestRunner_CompressNested(t *testing.T) {
+	dir := t.TempDir()
+	input := writeSample(t, "sample.txt", sample)
+	once := filepath.Join(dir, "sample.txt.tzz")
+	r, _ := newTestRunner(nil, Options{Algorithm: "lz77"})
+	if err := r.Compress(input, once); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	compressed, _ := os.ReadFile(once)
+
+	// 誤って .tzz を圧縮すると、警告して圧縮せずに入れ子のメンバーとして格納する
+	// -target-ratio で全体を読み込む場合も同じ
+	for _, opts := range []Options{{Algorithm: "lz77"}, {Algorithm: "auto", TargetRatio: 0.5}} {
+		twice := filepath.Join(t.TempDir(), "twice.tzz")
+		r, _ := newTestRunner(nil, opts)
+		if err := r.Compress(once, twice); err != nil {
+			t.Fatalf("%+v: Compress failed: %v", opts, err)
+		}
+		if stderr := r.Err.(*bytes.Buffer).String(); !strings.Contains(stderr, "既に .tzz コンテナ") || !strings.Contains(stderr, "-allow-recompress") {
+			t.Errorf("%+v: expected a warning, got %q", opts, stderr)
+		}
+		data, _ := os.ReadFile(twice)
+		scan, err := container.Scan(bytes.NewReader(data))
+		if err != nil || len(scan.Members) != 1 || scan.Members[0].Algorithm != container.NestedAlgorithm {
+			t.Errorf("%+v: expected a single nested member, got %+v, %v", opts, scan.Members, err)
+		}
+		got, err := container.Decompress(data, common.New, common.DecompressOptions{})
+		if err != nil || !bytes.Equal(got, compressed) {
+			t.Errorf("%+v: expected the container to be stored as is (err %v)", opts, err)
+		}
+	}
+
+	// -allow-recompress では指定したアルゴリズムで圧縮する
+	recompressed := filepath.Join(dir, "recompressed.tzz")
+	r, _ = newTestRunner(nil, Options{Algorithm: "huffman", AllowRecompress: true})
+	if err := r.Compress(once, recompressed); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	data, _ := os.ReadFile(recompressed)
+	if scan, _ := container.Scan(bytes.NewReader(data)); len(scan.Members) == 0 || scan.Members[0].Algorithm != "huffman" || r.Err.(*bytes.Buffer).Len() != 0 {
+		t.Errorf("Expected the container to be compressed without a warning, got %+v (stderr %q)", scan.Members, r.Err)
+	}
+
+	// そのまま格納することは暗黙の選択なので、Strict ではエラーにして何も書き込まない
+	strict := filepath.Join(dir, "strict.tzz")
+	r, _ = newTestRunner(nil, Options{Algorithm: "lz77", Strict: true})
+	if err := r.Compress(once, strict); !errors.Is(err, common.ErrStrict) || !strings.Contains(err.Error(), "-allow-recompress") {
+		t.Errorf("Expected a strict error, got %v", err)
+	}
+	if _, err := os.Stat(strict); !os.IsNotExist(err) {
+		t.Errorf("Expected no output in strict mode, got %v", err)
+	}
+}
+
+func TestRunner_DecompressRecursive(t *testing.T) {
+	// 3層の入れ子: lz77 で圧縮したものを huffman、さらに rle で圧縮する
+	path := writeSample(t, "sample.txt", sample)
+	for _, algo := range []string{"lz77", "huffman", "rle"} {
+		r, _ := newTestRunner(nil, Options{Algorithm: algo, AllowRecompress: true})
+		if err := r.Compress(path, path+".tzz"); err != nil {
+			t.Fatalf("%s: Compress failed: %v", algo, err)
+		}
+		path += ".tzz"
+	}
+
+	// -recursive を指定しない場合は1層だけ展開し、まだコンテナであることを知らせる
+	output := filepath.Join(t.TempDir(), "out")
+	r, out := newTestRunner(nil, Options{Algorithm: "rle"})
+	if err := r.Decompress(path, output); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if stderr := r.Err.(*bytes.Buffer).String(); !strings.Contains(stderr, "-recursive") {
+		t.Errorf("Expected a hint about -recursive, got %q\n%s", stderr, out)
+	}
+
+	// -recursive ではすべての層を展開する
+	r, out = newTestRunner(nil, Options{Algorithm: "rle", Recursive: true, Force: true})
+	if err := r.Decompress(path, output); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, sample) {
+		t.Error("Expected the original data after unwrapping all layers")
+	}
+	if !strings.Contains(out.String(), "3 層を展開しました") || r.Err.(*bytes.Buffer).Len() != 0 {
+		t.Errorf("Expected 3 layers without a warning, got %q (stderr %q)", out, r.Err)
+	}
+
+	// 最大の深さに達した場合は、残りの層があることを知らせる
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle", Recursive: true, MaxDepth: 2, Force: true})
+	if err := r.Decompress(path, output); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if stderr := r.Err.(*bytes.Buffer).String(); !strings.Contains(stderr, "-max-depth") {
+		t.Errorf("Expected a hint about -max-depth, got %q", stderr)
+	}
+}
+
+func TestRunner_CompressErrors(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	tests := []struct {
+		name  string
+		input string
+		opts  Options
+		want  string
+	}{
+		{"unknown algorithm", input, Options{Algorithm: "zip"}, "未対応のアルゴリズム: zip"},
+		{"missing input", filepath.Join(t.TempDir(), "missing"), Options{}, "圧縮エラー"},
+		{"dict with rle", input, Options{Algorithm: "rle", DictPath: input}, "辞書は lz77 でのみ使用できます"},
+		{"bad filter", input, Options{FilterSpec: "nope"}, "フィルタ指定エラー"},
+		{"auto without target", input, Options{Algorithm: "auto"}, "-algo auto は -target-ratio と指定してください"},
+		{"negative target", input, Options{TargetRatio: -1}, "-target-ratio は正の値"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRunner(nil, tt.opts)
+			err := r.Compress(tt.input, filepath.Join(t.TempDir(), "out"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRunner_Strict(t *testing.T) {
+	noise := make([]byte, 256)
+	for i := range noise {
+		noise[i] = byte(i * 167)
+	}
+	dir := t.TempDir()
+	input := writeSample(t, "sample.txt", sample)
+	noisy := writeSample(t, "noise.bin", noise)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), sample, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 通常はそれぞれ代わりの方法で処理し、Strict では指定を示したエラーにする
+	compressTests := []struct {
+		name  string
+		input string
+		opts  Options
+		want  string
+	}{
+		{"auto", input, Options{Algorithm: "auto", TargetRatio: 0.5}, "-algo <name>"},
+		{"target stored", noisy, Options{Algorithm: "rle", TargetRatio: 0.1}, "target ratio"},
+		{"best stored", noisy, Options{Algorithm: "best"}, "output would expand"},
+		{"archive", dir, Options{Format: formatZip}, "-format tzz"},
+	}
+	for _, tt := range compressTests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out")
+			r, _ := newTestRunner(nil, tt.opts)
+			if err := r.Compress(tt.input, output); err != nil {
+				t.Fatalf("Compress failed without -strict: %v", err)
+			}
+
+			tt.opts.Strict = true
+			output = filepath.Join(t.TempDir(), "out")
+			r, _ = newTestRunner(nil, tt.opts)
+			err := r.Compress(tt.input, output)
+			if !errors.Is(err, common.ErrStrict) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected a strict error containing %q, got %v", tt.want, err)
+			}
+			if _, statErr := os.Stat(output); !errors.Is(statErr, os.ErrNotExist) {
+				t.Errorf("Expected no output in strict mode, got %v", statErr)
+			}
+		})
+	}
+
+	t.Run("member algorithm", func(t *testing.T) {
+		compressed := filepath.Join(t.TempDir(), "sample.tzz")
+		r, _ := newTestRunner(nil, Options{Algorithm: "lz77"})
+		if err := r.Compress(input, compressed); err != nil {
+			t.Fatal(err)
+		}
+		r, _ = newTestRunner(nil, Options{Algorithm: "rle"})
+		if err := r.Decompress(compressed, filepath.Join(t.TempDir(), "out")); err != nil {
+			t.Fatalf("Decompress failed without -strict: %v", err)
+		}
+		r, _ = newTestRunner(nil, Options{Algorithm: "rle", Strict: true})
+		err := r.Decompress(compressed, filepath.Join(t.TempDir(), "out"))
+		if !errors.Is(err, common.ErrStrict) || !strings.Contains(err.Error(), "specify -algo lz77") {
+			t.Errorf("Expected a strict error naming -algo lz77, got %v", err)
+		}
+		r, _ = newTestRunner(nil, Options{Algorithm: "lz77", Strict: true})
+		if err := r.Decompress(compressed, filepath.Join(t.TempDir(), "out")); err != nil {
+			t.Errorf("Decompress with the recorded algorithm failed: %v", err)
+		}
+	})
+
+	t.Run("archive detection", func(t *testing.T) {
+		zipped := filepath.Join(t.TempDir(), "dir.zip")
+		r, _ := newTestRunner(nil, Options{Format: formatZip})
+		if err := r.Compress(dir, zipped); err != nil {
+			t.Fatal(err)
+		}
+		r, _ = newTestRunner(nil, Options{Strict: true})
+		if err := r.Decompress(zipped, filepath.Join(t.TempDir(), "out")); !errors.Is(err, common.ErrStrict) {
+			t.Errorf("Expected a strict error for the detected archive, got %v", err)
+		}
+	})
+
+	cmd, err := Parse("tinyzipzap", []string{"-c", "-strict", "-i", input}, io.Discard)
+	if err != nil || !cmd.Strict {
+		t.Errorf("Expected -strict to be parsed, got %+v (err %v)", cmd, err)
+	}
+}
+
+func TestRunner_DecompressErrors(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	r, _ := newTestRunner(nil, Options{Algorithm: "lz77"})
+	if err := r.Compress(input, ""); err != nil {
+		t.Fatal(err)
+	}
+	compressed := input + ".lz77"
+	data, _ := os.ReadFile(compressed)
+
+	t.Run("corrupt", func(t *testing.T) {
+		corrupt := append([]byte(nil), data...)
+		corrupt[len(corrupt)-1] ^= 0xFF
+		path := writeSample(t, "corrupt.tzz", corrupt)
+		out := filepath.Join(t.TempDir(), "out")
+		err := r.Decompress(path, out)
+		if err == nil || !strings.HasPrefix(err.Error(), "展開エラー: ") {
+			t.Errorf("Expected a decompression error, got %v", err)
+		}
+		if _, statErr := os.Stat(out); !errors.Is(statErr, os.ErrNotExist) {
+			t.Errorf("Expected no output file, got %v", statErr)
+		}
+		if !errors.Is(err, container.ErrChecksum) || !strings.Contains(err.Error(), "検証に失敗したため "+out+" は書き込まれていません") {
+			t.Errorf("Expected a note about the rejected output, got %v", err)
+		}
+	})
+
+	t.Run("max output", func(t *testing.T) {
+		r, _ := newTestRunner(nil, Options{Algorithm: "lz77", MaxOutput: "1K"})
+		err := r.Decompress(compressed, filepath.Join(t.TempDir(), "out"))
+		if !errors.Is(err, common.ErrOutputTooLarge) {
+			t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		// 元のサイズより32バイト短いデータのメンバーに、元のサイズを記録する
+		name := "lz77"
+		member, err := container.EncodeMember(name, lz77.NewCompressor(), sample[:len(sample)-32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := len(container.Magic) + 2 + len(name)
+		_, n := binary.Uvarint(member[at:])
+		declared := binary.AppendUvarint(nil, uint64(len(sample)))
+		if len(declared) != n {
+			t.Fatalf("Size needs %d bytes, header has %d", len(declared), n)
+		}
+		copy(member[at:], declared)
+		path := writeSample(t, "short.tzz", member)
+		out := filepath.Join(t.TempDir(), "out")
+
+		err = r.Decompress(path, out)
+		var sizeErr *common.SizeError
+		if !errors.As(err, &sizeErr) || !strings.Contains(err.Error(), "-tolerate-size-mismatch") {
+			t.Fatalf("Expected a size error with a hint, got %v", err)
+		}
+
+		tolerant, _ := newTestRunner(nil, Options{Algorithm: name, TolerateSize: true})
+		err = tolerant.Decompress(path, out)
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Code != ExitRecovered {
+			t.Fatalf("Expected ExitError with code %d, got %v", ExitRecovered, err)
+		}
+		if got, _ := os.ReadFile(out); !bytes.Equal(got, sample[:len(sample)-32]) {
+			t.Error("Expected the recovered data to be written")
+		}
+		if msg := tolerant.Err.(*bytes.Buffer).String(); !strings.Contains(msg, fmt.Sprintf("元のサイズ %d bytes に対して %d bytes を展開しました（-32 bytes）", len(sample), len(sample)-32)) {
+			t.Errorf("Expected the delta on stderr, got %q", msg)
+		}
+	})
+
+	t.Run("bad limit", func(t *testing.T) {
+		r, _ := newTestRunner(nil, Options{MemLimit: "lots"})
+		err := r.Decompress(compressed, filepath.Join(t.TempDir(), "out"))
+		if err == nil || !strings.HasPrefix(err.Error(), "オプションエラー: ") {
+			t.Errorf("Expected an option error, got %v", err)
+		}
+	})
+}
+
+func TestRunner_Salvage(t *testing.T) {
+	const blockSize = 512
+	input := writeSample(t, "sample.txt", sample)
+	compressed := input + ".tzz"
+	r, _ := newTestRunner(nil, Options{Algorithm: "rle", Adaptive: true, BlockSize: blockSize})
+	if err := r.Compress(input, compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1番目と3番目のブロックのペイロードを 0xff で壊す
+	data, err := os.ReadFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := container.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := members[0].Body()
+	infos, err := blocks.Inspect(body)
+	if err != nil || len(infos) < 4 {
+		t.Fatalf("Expected at least 4 blocks, got %d (err %v)", len(infos), err)
+	}
+	pos := bytes.Index(data, body) + 4 // ブロックコンテナのヘッダー
+	for _, info := range infos[:4] {
+		pos += 1 + len(binary.AppendUvarint(nil, uint64(info.OriginalSize))) + len(binary.AppendUvarint(nil, uint64(info.PayloadSize)))
+		if info.Mode != blocks.ModeCompressed {
+			t.Fatalf("Block %d is %s", info.Index, info.Mode)
+		}
+		if info.Index == 1 || info.Index == 3 {
+			copy(data[pos:], bytes.Repeat([]byte{0xff}, info.PayloadSize))
+		}
+		pos += info.PayloadSize
+	}
+	damaged := writeSample(t, "damaged.tzz", data)
+	out := filepath.Join(t.TempDir(), "out")
+
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle", Adaptive: true})
+	if err := r.Decompress(damaged, out); err == nil {
+		t.Fatal("Expected the damaged blocks to fail without -salvage")
+	}
+	if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no output without -salvage, got %v", err)
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "damage.json")
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle", Adaptive: true, Salvage: true, SalvageFill: "0x2a", SalvageReport: reportPath})
+	err = r.Decompress(damaged, out)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitRecovered || !strings.Contains(exitErr.Msg, "2 個の壊れたブロック") {
+		t.Fatalf("Expected ExitError with code %d, got %v", ExitRecovered, err)
+	}
+	got, _ := os.ReadFile(out)
+	if len(got) != len(sample) {
+		t.Fatalf("Output is %d bytes, want %d", len(got), len(sample))
+	}
+	for i := range len(sample) {
+		want := sample[i]
+		if block := i / blockSize; block == 1 || block == 3 {
+			want = '*'
+		}
+		if got[i] != want {
+			t.Fatalf("Output differs at %d: %q, want %q", i, got[i], want)
+		}
+	}
+	if msg := r.Err.(*bytes.Buffer).String(); strings.Count(msg, "を埋めました") != 2 {
+		t.Errorf("Expected the damaged ranges on stderr, got %q", msg)
+	}
+
+	var report salvageReport
+	if raw, err := os.ReadFile(reportPath); err != nil || json.Unmarshal(raw, &report) != nil {
+		t.Fatalf("Invalid report (err %v)", err)
+	}
+	if report.OutputSize != int64(len(sample)) || report.DamagedBytes != 2*blockSize || len(report.Damaged) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for i, block := range []int{1, 3} {
+		if d := report.Damaged[i]; d.Block != block || d.Offset != int64(block*blockSize) || d.End() != int64((block+1)*blockSize) {
+			t.Errorf("Damage %d = %+v, want block %d", i, d, block)
+		}
+	}
+
+	r, _ = newTestRunner(nil, Options{Salvage: true, SalvageFill: "xyz", Force: true})
+	if err := r.Decompress(damaged, out); err == nil || !strings.HasPrefix(err.Error(), "オプションエラー: ") {
+		t.Errorf("Expected an option error for a bad fill, got %v", err)
+	}
+}
+
+func TestRunner_Analyze(t *testing.T) {
+	r, out := newTestRunner(sample, Options{Algorithm: "rle", Verbose: true})
+	if err := r.Analyze("-"); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	for _, want := range []string{"入力ファイル: -", "=== データ分析結果 ===", "エントロピー:", "理論的最小サイズ（0次）:", "=== 位置ごとの出力（4.0 KB ごと） ===", "=== 圧縮テスト ===", "アルゴリズムのモデルでの下限:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q\n%s", want, out)
+		}
+	}
+	// 位置ごとの出力は、通知できる登録済みのアルゴリズムを1行ずつ表示する
+	var strips []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if name, _, ok := strings.Cut(line, " |"); ok {
+			strips = append(strips, strings.TrimSpace(name))
+		}
+	}
+	if !slices.Contains(strips, "rle") || !slices.Contains(strips, "lz77") || !slices.Contains(strips, "huffman") || slices.Contains(strips, "lzw") {
+		t.Errorf("Unexpected savings map rows %v\n%s", strips, out)
+	}
+
+	dotPath := filepath.Join(t.TempDir(), "trie.dot")
+	r, out = newTestRunner([]byte("TOBEORNOTTOBEORTOBEORNOT"), Options{Algorithm: "lzw", DOTPath: dotPath})
+	if err := r.Analyze("-"); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if dot, err := os.ReadFile(dotPath); err != nil || !bytes.HasPrefix(dot, []byte("digraph")) {
+		t.Errorf("Expected a DOT file, got %q (err %v)", dot, err)
+	}
+
+	r, _ = newTestRunner(sample, Options{Algorithm: "rle", DOTPath: dotPath})
+	if err := r.Analyze("-"); err == nil || !strings.Contains(err.Error(), "-dot は -algo lzw でのみ使用できます") {
+		t.Errorf("Expected a -dot error, got %v", err)
+	}
+	r, _ = newTestRunner(nil, Options{})
+	if err := r.Analyze(filepath.Join(t.TempDir(), "missing")); err == nil || !strings.HasPrefix(err.Error(), "ファイル読み込みエラー: ") {
+		t.Errorf("Expected a read error, got %v", err)
+	}
+}
+
+func TestAnalyze_ExportStats(t *testing.T) {
+	dir := t.TempDir()
+	input := []byte("abcdefabcdef")
+
+	jsonPath := filepath.Join(dir, "matches.json")
+	r, out := newTestRunner(input, Options{Algorithm: "lz77", ExportStats: jsonPath})
+	if err := r.Analyze("-"); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "統計データ: "+jsonPath) {
+		t.Errorf("Expected the export path in the output\n%s", out)
+	}
+	var stats lz77.MatchStats
+	if data, err := os.ReadFile(jsonPath); err != nil || json.Unmarshal(data, &stats) != nil {
+		t.Fatalf("Expected a JSON file, got %q (err %v)", data, err)
+	}
+	if stats.Matches != 1 || stats.LengthCounts[5] != 1 {
+		t.Errorf("Unexpected exported stats: %+v", stats)
+	}
+
+	// 拡張子が .csv ならCSV
+	csvPath := filepath.Join(dir, "codes.CSV")
+	r, _ = newTestRunner(input, Options{Algorithm: "huffman", ExportStats: csvPath})
+	if err := r.Analyze("-"); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if data, _ := os.ReadFile(csvPath); !bytes.HasPrefix(data, []byte("symbol,frequency,code_length\n")) {
+		t.Errorf("Expected a CSV file, got %q", data)
+	}
+
+	for _, algo := range []string{"lzw", "huffman16"} {
+		r, _ = newTestRunner(input, Options{Algorithm: algo, ExportStats: jsonPath})
+		if err := r.Analyze("-"); err == nil || !strings.Contains(err.Error(), "-export-stats は -algo rle, lz77, huffman でのみ使用できます") {
+			t.Errorf("%s: expected an -export-stats error, got %v", algo, err)
+		}
+	}
+}
+
+func TestRunner_Compare(t *testing.T) {
+	a := writeSample(t, "a.txt", sample)
+	b := writeSample(t, "b.txt", []byte("hello"))
+
+	r, out := newTestRunner(nil, Options{})
+	if err := r.Compare([]string{a, b}); err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "=== 合計 (2 ファイル) ===") {
+		t.Errorf("Expected a summary for two files\n%s", out)
+	}
+
+	r, out = newTestRunner(nil, Options{CSV: true})
+	if err := r.Compare([]string{a}); err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != len(common.Names())+1 {
+		t.Errorf("Expected a header and one CSV row per algorithm, got:\n%s", out)
+	}
+}
+
+func TestRunner_ListRepair(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "log.tzz")
+	for _, line := range []string{"first\n", "second\n"} {
+		r, _ := newTestRunner([]byte(line), Options{Algorithm: "lz77"})
+		if err := r.Append("-", archive); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	r, out := newTestRunner(nil, Options{})
+	if err := r.List(archive); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if strings.Contains(out.String(), "不完全なメンバー") {
+		t.Errorf("Unexpected truncation warning\n%s", out)
+	}
+
+	// 末尾を切り詰めて不完全なメンバーを作る
+	data, _ := os.ReadFile(archive)
+	if err := os.WriteFile(archive, data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := r.List(archive); err != nil || !strings.Contains(out.String(), "不完全なメンバー") {
+		t.Errorf("Expected a truncation warning (err %v)\n%s", err, out)
+	}
+	out.Reset()
+	if err := r.Repair(archive); err != nil || !strings.Contains(out.String(), "✅ 修復完了") || !strings.Contains(out.String(), "1 メンバーが残っています") {
+		t.Errorf("Expected one member left after repair (err %v)\n%s", err, out)
+	}
+
+	if err := r.List(filepath.Join(dir, "missing.tzz")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestRunner_Report(t *testing.T) {
+	reportPath := filepath.Join(t.TempDir(), "report.md")
+	r, _ := newTestRunner(sample, Options{})
+	if err := r.Report("-", reportPath); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if data, err := os.ReadFile(reportPath); err != nil || !bytes.HasPrefix(data, []byte("# 圧縮レポート")) {
+		t.Errorf("Expected a Markdown report (err %v)", err)
+	}
+
+	r.TemplatePath = filepath.Join(t.TempDir(), "missing.tmpl")
+	if err := r.Report("-", reportPath); err == nil || !strings.HasPrefix(err.Error(), "テンプレートエラー: ") {
+		t.Errorf("Expected a template error, got %v", err)
+	}
+}
+
+func TestRunner_CompressTrace(t *testing.T) {
+	dir := t.TempDir()
+	input := writeSample(t, "small.txt", []byte("aaaabbcd"))
+	tracePath := filepath.Join(dir, "steps.jsonl")
+
+	r, out := newTestRunner(nil, Options{Algorithm: "huffman", TracePath: tracePath})
+	if err := r.Compress(input, filepath.Join(dir, "small.tzz")); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "トレース: "+tracePath+" (3 イベント)") {
+		t.Errorf("Expected the trace summary, got\n%s", out)
+	}
+	trace, _ := os.ReadFile(tracePath)
+	lines := strings.Split(strings.TrimSpace(string(trace)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 merge events, got\n%s", trace)
+	}
+	for _, line := range lines {
+		var event struct{ Type string }
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type != "huffman.MergeEvent" {
+			t.Errorf("Unexpected trace line %s (err %v)", line, err)
+		}
+	}
+
+	for _, opts := range []Options{
+		{Algorithm: "lzw", TracePath: tracePath, Force: true},
+		{Algorithm: "rle", FilterSpec: "delta", TracePath: tracePath, Force: true},
+	} {
+		r, _ := newTestRunner(nil, opts)
+		err := r.Compress(input, filepath.Join(dir, "unsupported.tzz"))
+		if err == nil || !strings.HasPrefix(err.Error(), "-trace は -algo rle, lz77") {
+			t.Errorf("%+v: expected an unsupported -trace error, got %v", opts, err)
+		}
+	}
+}
+
+func TestRunner_ArchiveFormats(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := map[string][]byte{
+		"README.txt":  []byte(strings.Repeat("tiny zip zap\n", 50)),
+		"lib/util.go": []byte("package lib\n"),
+		"lib/a/b.txt": sample,
+	}
+	for name, data := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{"zip", "tza"} {
+		t.Run(format, func(t *testing.T) {
+			r, out := newTestRunner(nil, Options{Algorithm: "lz77", Format: format})
+			if err := r.Compress(src, ""); err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			archivePath := src + "." + format
+			if !strings.Contains(out.String(), "✅ 圧縮完了: "+src+" -> "+archivePath) || !strings.Contains(out.String(), "3 エントリ") {
+				t.Errorf("Unexpected output:\n%s", out)
+			}
+
+			out.Reset()
+			if err := r.List(archivePath); err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if !strings.Contains(out.String(), "lib/a/b.txt") || !strings.Contains(out.String(), "合計: 3 エントリ") {
+				t.Errorf("Unexpected listing:\n%s", out)
+			}
+
+			extracted := filepath.Join(dir, "extracted-"+format)
+			if err := r.Decompress(archivePath, extracted); err != nil {
+				t.Fatalf("Decompress failed: %v", err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+				if err != nil || !bytes.Equal(got, want) {
+					t.Errorf("%s: content mismatch (err %v)", name, err)
+				}
+			}
+		})
+	}
+
+	r, _ := newTestRunner(nil, Options{Format: "zip", TargetRatio: 0.5})
+	if err := r.Compress(src, ""); err == nil || !strings.Contains(err.Error(), "-format zip は -target-ratio") {
+		t.Errorf("Expected an incompatible option error, got %v", err)
+	}
+
+	// 並列数によらず同じアーカイブになる
+	for _, format := range []string{"zip", "tza"} {
+		var outputs [][]byte
+		for _, p := range []int{1, 8} {
+			output := filepath.Join(dir, fmt.Sprintf("p%d.%s", p, format))
+			r, _ := newTestRunner(nil, Options{Algorithm: "huffman", Format: format, Parallel: p, FailFast: true})
+			if err := r.Compress(src, output); err != nil {
+				t.Fatalf("-p %d: Compress failed: %v", p, err)
+			}
+			data, _ := os.ReadFile(output)
+			outputs = append(outputs, data)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%s: expected identical archives for -p 1 and -p 8", format)
+		}
+	}
+}
+
+// TestRunner_Reproducible は更新日時と作成した順の異なる同じ内容のディレクトリを -reproducible で圧縮します
+func TestRunner_Reproducible(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a.txt", "b/c.txt", "b/d.txt", "e.txt"}
+	trees := map[string]time.Time{
+		"old": time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC),
+		"new": time.Now(),
+	}
+	for tree, mtime := range trees {
+		order := slices.Clone(names)
+		if tree == "new" {
+			slices.Reverse(order)
+		}
+		for _, name := range order {
+			path := filepath.Join(dir, tree, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, []byte(strings.Repeat(name, 10)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(path, mtime, mtime)
+		}
+	}
+
+	for _, format := range []string{"zip", "tza"} {
+		var outputs [][]byte
+		for tree := range trees {
+			output := filepath.Join(dir, tree+"."+format)
+			r, _ := newTestRunner(nil, Options{Algorithm: "lz77", Format: format, Reproducible: true, SourceDateEpoch: 1700000000})
+			if err := r.Compress(filepath.Join(dir, tree), output); err != nil {
+				t.Fatalf("%s: Compress failed: %v", format, err)
+			}
+			data, _ := os.ReadFile(output)
+			outputs = append(outputs, data)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%s: expected identical archives for the same tree", format)
+		}
+
+		r, out := newTestRunner(nil, Options{})
+		if err := r.Info(filepath.Join(dir, "old."+format)); err != nil {
+			t.Fatalf("%s: Info failed: %v", format, err)
+		}
+		if !strings.Contains(out.String(), "再現可能:") {
+			t.Errorf("%s: expected the reproducible flag in the info:\n%s", format, out)
+		}
+	}
+}
+
+func TestParse_SourceDateEpoch(t *testing.T) {
+	args := []string{"-c", "-format", "zip", "-reproducible", "-i", "dir"}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	cmd, err := Parse("tinyzipzap", args, io.Discard)
+	if err != nil || !cmd.Reproducible || cmd.SourceDateEpoch != 1700000000 {
+		t.Errorf("Expected SOURCE_DATE_EPOCH to be read, got %+v (err %v)", cmd, err)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	var stderr bytes.Buffer
+	if _, err := Parse("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) || !strings.Contains(stderr.String(), "SOURCE_DATE_EPOCH") {
+		t.Errorf("Expected a usage error for an invalid SOURCE_DATE_EPOCH, got %v\n%s", err, stderr.String())
+	}
+	// -reproducible を指定しなければ読まない
+	if _, err := Parse("tinyzipzap", []string{"-c", "-format", "zip", "-i", "dir"}, io.Discard); err != nil {
+		t.Errorf("Expected SOURCE_DATE_EPOCH to be ignored without -reproducible, got %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args []string
+		mode Mode
+		err  error
+	}{
+		{[]string{"-version"}, ModeVersion, nil},
+		{[]string{"-c", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-c", "-append", "-i", "a", "-o", "b"}, ModeAppend, nil},
+		{[]string{"-d", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-compare", "a", "b"}, ModeCompare, nil},
+		{[]string{"-report", "r.md", "-template", "t.tmpl", "-i", "a"}, ModeReport, nil},
+		{[]string{"-h"}, 0, flag.ErrHelp},
+		{[]string{"-c"}, 0, ErrUsage},
+		{[]string{"-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-d", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-append", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-a", "-template", "t.tmpl", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-target-ratio", "0.5", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-trace", "t.jsonl", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-d", "-trace", "t.jsonl", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "zip", "-i", "dir"}, ModeCompress, nil},
+		{[]string{"-c", "-format", "rar", "-i", "dir"}, 0, ErrUsage},
+		{[]string{"-d", "-format", "zip", "-i", "a.zip"}, 0, ErrUsage},
+		{[]string{"-d", "-f", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-d", "-n", "-verify-existing", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-d", "-verify-existing", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-f", "-skip-existing", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-f", "-n", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-delta", "-ref", "old", "-i", "new"}, ModeDelta, nil},
+		{[]string{"-apply", "-ref", "old", "-i", "new.patch"}, ModeApply, nil},
+		{[]string{"-delta", "-i", "new"}, 0, ErrUsage},
+		{[]string{"-c", "-ref", "old", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-limit-rate", "10M", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-d", "-limit-rate", "10M", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-a", "-limit-rate", "10M", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-append", "-limit-rate", "10M", "-i", "a", "-o", "b"}, 0, ErrUsage},
+		{[]string{"-d", "-tolerate-size-mismatch", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-c", "-tolerate-size-mismatch", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-demo", "-algo", "lz77", "-i", "a"}, ModeDemo, nil},
+		{[]string{"-demo", "-c", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-bench", "-corpus", "canterbury"}, ModeBench, nil},
+		{[]string{"-bench", "-offline", "-corpus", "canterbury,large"}, ModeBench, nil},
+		{[]string{"-bench"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "zip", "-p", "4", "-fail-fast", "-i", "dir"}, ModeCompress, nil},
+		{[]string{"-c", "-format", "zip", "-p", "0", "-i", "dir"}, 0, ErrUsage},
+		{[]string{"-c", "-fail-fast", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "tza", "-include", "**/*.go", "-exclude", "vendor,*.log", "-max-file-size", "1M", "-i", "dir"}, ModeCompress, nil},
+		{[]string{"-c", "-exclude", "*.log", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-special", "error", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-c", "-special", "ignore", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "tza", "-follow-symlinks", "-allow-external-targets", "-i", "dir"}, ModeCompress, nil},
+		{[]string{"-c", "-follow-symlinks", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "zip", "-allow-external-targets", "-i", "dir"}, 0, ErrUsage},
+		{[]string{"-d", "-symlinks", "all", "-i", "a.tza"}, ModeDecompress, nil},
+		{[]string{"-c", "-format", "tza", "-reproducible", "-i", "dir"}, ModeCompress, nil},
+		{[]string{"-c", "-reproducible", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-reproducible", "-i", "a.zip"}, 0, ErrUsage},
+		{[]string{"-d", "-symlinks", "follow", "-i", "a.tza"}, 0, ErrUsage},
+		{[]string{"-bench", "-corpus", "canterbury", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-compare", "-corpus", "canterbury", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-stats-log", "h.jsonl", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-d", "-stats-log", "h.jsonl", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-a", "-stats-log", "h.jsonl", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-format", "zip", "-stats-log", "h.jsonl", "-i", "dir"}, 0, ErrUsage},
+		{[]string{"-d", "-salvage", "-salvage-fill", "ff", "-salvage-report", "r.json", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-c", "-salvage", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-c", "-allow-recompress", "-i", "a"}, ModeCompress, nil},
+		{[]string{"-d", "-allow-recompress", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-recursive", "-max-depth", "2", "-i", "a"}, ModeDecompress, nil},
+		{[]string{"-c", "-recursive", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-recursive", "-max-depth", "0", "-i", "a"}, 0, ErrUsage},
+		{[]string{"-d", "-salvage-report", "r.json", "-i", "a"}, 0, ErrUsage},
+	}
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		cmd, err := Parse("tinyzipzap", tt.args, &stderr)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: expected error %v, got %v", tt.args, tt.err, err)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(stderr.String(), "使用方法:") {
+				t.Errorf("%v: expected usage on stderr, got %q", tt.args, stderr.String())
+			}
+			continue
+		}
+		if cmd.Mode != tt.mode {
+			t.Errorf("%v: expected mode %d, got %d", tt.args, tt.mode, cmd.Mode)
+		}
+	}
+
+	cmd, err := Parse("tinyzipzap", []string{"-compare", "-i", "a", "b", "c"}, &bytes.Buffer{})
+	if err != nil || len(cmd.Inputs) != 3 || cmd.Algorithm != "rle" {
+		t.Errorf("Expected three inputs and the default algorithm, got %+v (err %v)", cmd, err)
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	cmd, err := Parse("tinyzipzap", []string{"-c", "-algo", "huffman", "-i", input, "-o", input + ".tzz"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, out := newTestRunner(nil, Options{})
+	if err := cmd.Run(r); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if r.Algorithm != "huffman" || !strings.Contains(out.String(), "✅ 圧縮完了") {
+		t.Errorf("Expected the command's options to be used\n%s", out)
+	}
+
+	cmd, _ = Parse("tinyzipzap", []string{"-version"}, &bytes.Buffer{})
+	out.Reset()
+	if err := cmd.Run(r); err != nil || !strings.HasPrefix(out.String(), "TinyZipZap ") {
+		t.Errorf("Unexpected version output %q (err %v)", out, err)
+	}
+}
+
+func TestRunner_Version(t *testing.T) {
+	r, out := newTestRunner(nil, Options{})
+	if err := r.Version(); err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	for _, name := range append(common.Names(), "tzz", "tza", "blocks", "webui") {
+		if !regexp.MustCompile(`(?m)^  ` + regexp.QuoteMeta(name) + ` `).MatchString(out.String()) {
+			t.Errorf("Version output does not list %q\n%s", name, out)
+		}
+	}
+
+	// アルゴリズムの一覧は登録した Descriptor から表示し、使用方法（-h）も同じ一覧を含む
+	var usage bytes.Buffer
+	Parse("tinyzipzap", []string{"-h"}, &usage)
+	for _, d := range common.DescribeAll() {
+		if d.Capabilities == 0 || d.Description == "" || d.UseCase == "" {
+			t.Errorf("%s: incomplete descriptor %+v", d.Name, d)
+		}
+		for _, text := range []string{out.String(), usage.String()} {
+			if !strings.Contains(text, d.Description) || !strings.Contains(text, "能力: "+d.Capabilities.String()+"／用途: "+d.UseCase) {
+				t.Errorf("%s: description is missing from\n%s", d.Name, text)
+			}
+		}
+	}
+
+	r, out = newTestRunner(nil, Options{JSON: true})
+	if err := r.Version(); err != nil {
+		t.Fatalf("Version -json failed: %v", err)
+	}
+	var b common.Build
+	if err := json.Unmarshal(out.Bytes(), &b); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", out, err)
+	}
+	if len(b.Algorithms) != len(common.Names()) {
+		t.Errorf("JSON lists %d algorithms, want %d", len(b.Algorithms), len(common.Names()))
+	}
+	if !strings.HasSuffix(out.String(), "}\n") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected one line of JSON, got %q", out)
+	}
+}
+
+func TestRunner_ExistingOutput(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	compressed := input + ".tzz"
+	if r, _ := newTestRunner(nil, Options{Algorithm: "lz77"}); r.Compress(input, compressed) != nil {
+		t.Fatal("Compress failed")
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		existing []byte // 展開先に置いておく内容
+		expected error  // nil の場合は成功
+		message  string // 成功した場合の出力、またはエラーメッセージに含まれる文字列
+		replaced bool
+	}{
+		{"refuse identical", Options{}, sample, fileutil.ErrExists, "-f を", false},
+		{"refuse differs", Options{}, []byte("old"), fileutil.ErrExists, "-skip-existing を", false},
+		{"force", Options{Force: true}, []byte("old"), nil, "✅ 展開完了", true},
+		{"skip", Options{SkipExisting: true}, []byte("old"), nil, "⏭️  スキップ: ", false},
+		{"verify identical", Options{NoClobber: true, VerifyExisting: true}, sample, nil, "identical, skipped", false},
+		{"verify differs", Options{NoClobber: true, VerifyExisting: true}, []byte("old"), fileutil.ErrDiffers, "differs, refused", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.txt")
+			os.WriteFile(output, tt.existing, 0644)
+			tt.opts.Algorithm = "lz77"
+			r, out := newTestRunner(nil, tt.opts)
+
+			err := r.Decompress(compressed, output)
+			if tt.expected != nil {
+				if !errors.Is(err, tt.expected) || !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("Expected %v with %q, got %v", tt.expected, tt.message, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Decompress failed: %v", err)
+			} else if !strings.Contains(out.String(), tt.message) {
+				t.Errorf("Expected %q in output, got\n%s", tt.message, out)
+			}
+
+			got, _ := os.ReadFile(output)
+			want := tt.existing
+			if tt.replaced {
+				want = sample
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Unexpected output content %q", got)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(output)); len(entries) != 1 {
+				t.Errorf("Expected only the output file, got %d entries", len(entries))
+			}
+		})
+	}
+
+	// 圧縮の出力も同じ内容なら -verify-existing でスキップする
+	r, out := newTestRunner(nil, Options{Algorithm: "lz77", NoClobber: true, VerifyExisting: true})
+	if err := r.Compress(input, compressed); err != nil || !strings.Contains(out.String(), "identical, skipped") {
+		t.Errorf("Expected the identical compressed output to be skipped, got %v\n%s", err, out)
+	}
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle", NoClobber: true, VerifyExisting: true})
+	if err := r.Compress(input, compressed); !errors.Is(err, fileutil.ErrDiffers) {
+		t.Errorf("Expected ErrDiffers for a different algorithm, got %v", err)
+	}
+}
+
+func TestRunner_ExtractSkipExisting(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "docs"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), sample, 0644)
+	os.WriteFile(filepath.Join(src, "docs", "b.txt"), []byte("b"), 0644)
+	archivePath := filepath.Join(dir, "src.zip")
+	if r, _ := newTestRunner(nil, Options{Format: formatZip}); r.Compress(src, archivePath) != nil {
+		t.Fatal("Compress failed")
+	}
+
+	extracted := filepath.Join(dir, "out")
+	os.MkdirAll(extracted, 0755)
+	os.WriteFile(filepath.Join(extracted, "a.txt"), []byte("local edit"), 0644)
+
+	r, _ := newTestRunner(nil, Options{})
+	if err := r.Decompress(archivePath, extracted); !errors.Is(err, fileutil.ErrExists) {
+		t.Fatalf("Expected ErrExists, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(extracted, "docs", "b.txt")); err == nil {
+		t.Error("Expected nothing to be extracted after a refused entry")
+	}
+
+	r, out := newTestRunner(nil, Options{SkipExisting: true})
+	if err := r.Decompress(archivePath, extracted); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "書き込み: 1 エントリ, スキップ: 1 エントリ（既存 1, 同じ内容 0）") {
+		t.Errorf("Expected the skip count in the summary, got\n%s", out)
+	}
+	if got, _ := os.ReadFile(filepath.Join(extracted, "a.txt")); string(got) != "local edit" {
+		t.Errorf("Skipped file was modified: %q", got)
+	}
+}
+
+func TestRunner_DeltaApply(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "v1.txt")
+	newPath := filepath.Join(dir, "v2.txt")
+	patchPath := filepath.Join(dir, "v2.txt.patch")
+	old := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog.\n"), 200)
+	new := bytes.Replace(old, []byte("lazy"), []byte("sleepy"), 1)
+	os.WriteFile(oldPath, old, 0644)
+	os.WriteFile(newPath, new, 0644)
+
+	r, out := newTestRunner(nil, Options{Verbose: true})
+	if err := r.Delta(oldPath, newPath, ""); err != nil {
+		t.Fatalf("Delta failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "✅ パッチ作成") || !strings.Contains(out.String(), "コピー:") {
+		t.Errorf("Unexpected output\n%s", out)
+	}
+	if info, err := os.Stat(patchPath); err != nil || info.Size() > 100 {
+		t.Fatalf("Expected a small patch at %s (err %v)", patchPath, err)
+	}
+
+	// 出力先を省略すると .patch を取り除いた名前になり、既存の v2.txt は上書きしない
+	if err := r.ApplyPatch(oldPath, patchPath, ""); !errors.Is(err, fileutil.ErrExists) {
+		t.Errorf("Expected ErrExists for the existing output, got %v", err)
+	}
+	output := filepath.Join(dir, "restored.txt")
+	if err := r.ApplyPatch(oldPath, patchPath, output); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, new) {
+		t.Error("Restored file differs from the new file")
+	}
+
+	// 違う古いファイルには適用しない
+	err := r.ApplyPatch(newPath, patchPath, filepath.Join(dir, "wrong.txt"))
+	if !errors.Is(err, delta.ErrBaseMismatch) || !strings.Contains(err.Error(), "-ref には") {
+		t.Errorf("Expected ErrBaseMismatch with a hint, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "wrong.txt")); err == nil {
+		t.Error("Output was written for a wrong base")
+	}
+}
+
+func TestRunner_LimitRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping rate limited compression in short mode")
+	}
+	data := bytes.Repeat(sample, 80) // 約190KB
+	input := writeSample(t, "in.txt", data)
+	compressed := filepath.Join(filepath.Dir(input), "in.tzz")
+	output := filepath.Join(filepath.Dir(input), "out.txt")
+
+	// 1秒あたり 1MB なので、圧縮と展開で約0.2秒ずつ
+	r, out := newTestRunner(nil, Options{Algorithm: "rle", LimitRate: "1M"})
+	start := time.Now()
+	if err := r.Compress(input, compressed); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Compression of %d bytes at 1MB/s took only %v", len(data), elapsed)
+	}
+	if err := r.Decompress(compressed, output); err != nil {
+		t.Fatalf("Decompress failed: %v\n%s", err, out)
+	}
+	if got, _ := os.ReadFile(output); !bytes.Equal(got, data) {
+		t.Error("Round trip with -limit-rate changed the data")
+	}
+
+	r, _ = newTestRunner(nil, Options{Algorithm: "rle", LimitRate: "fast", Force: true})
+	if err := r.Compress(input, compressed); err == nil || !strings.Contains(err.Error(), "-limit-rate") {
+		t.Errorf("Expected an option error for an invalid rate, got %v", err)
+	}
+}
+
+func TestRunner_Demo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "small.txt")
+	os.WriteFile(path, []byte("abcabcabcx"), 0644)
+
+	// スペースで1ステップ進めてから q で終了する
+	r, out := newTestRunner([]byte(" q"), Options{Algorithm: "lz77"})
+	if err := r.Demo(path); err != nil {
+		t.Fatalf("Demo failed: %v", err)
+	}
+	if got := strings.Count(out.String(), "TinyZipZap デモ: LZ77"); got != 2 {
+		t.Errorf("Expected 2 frames, got %d\n%s", got, out)
+	}
+
+	r, _ = newTestRunner(nil, Options{Algorithm: "huffman"})
+	if err := r.Demo(path); err == nil || !strings.Contains(err.Error(), "-algo rle, lz77") {
+		t.Errorf("Expected an unsupported algorithm error, got %v", err)
+	}
+	large := filepath.Join(t.TempDir(), "large.txt")
+	os.WriteFile(large, bytes.Repeat([]byte("a"), maxDemoInput+1), 0644)
+	if err := r.Demo(large); err == nil {
+		t.Error("Expected error for a large input")
+	}
+}
+
+// corpusArchive は files を含む .tar.gz とそのSHA-256を返します
+func corpusArchive(t *testing.T, files map[string][]byte) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.Close()
+	gz.Close()
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func TestRunner_Bench(t *testing.T) {
+	archive, sum := corpusArchive(t, map[string][]byte{"alice.txt": sample, "zeros.bin": make([]byte, 4096)})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/small.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	cache := &corpus.Cache{Dir: t.TempDir(), Client: srv.Client()}
+	corpora := []corpus.Corpus{
+		{Name: "small", URL: srv.URL + "/small.tar.gz", SHA256: sum},
+		{Name: "unpinned", URL: srv.URL + "/unpinned.tar.gz"},
+	}
+	bench := func(opts Options, names string) (string, string, error) {
+		r, out := newTestRunner(nil, opts)
+		r.corpora, r.corpusCache = corpora, cache
+		err := r.Bench(names)
+		return out.String(), r.Err.(*bytes.Buffer).String(), err
+	}
+
+	// オフラインでキャッシュが空なら、使えるコーパスがない
+	if _, stderr, err := bench(Options{Offline: true}, "small"); err == nil || !strings.Contains(stderr, "スキップ: small") {
+		t.Errorf("Expected small to be skipped offline, got %v\n%s", err, stderr)
+	}
+
+	out, stderr, err := bench(Options{}, "small,unpinned")
+	if err != nil {
+		t.Fatalf("Bench failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(out, "small/alice.txt") || !strings.Contains(out, "small/zeros.bin") || !strings.Contains(out, "合計 (2 ファイル)") {
+		t.Errorf("Expected the comparison over the corpus files, got:\n%s", out)
+	}
+	if !strings.Contains(stderr, "スキップ: unpinned（チェックサムが固定されていない") {
+		t.Errorf("Expected the unpinned corpus to be skipped, got %q", stderr)
+	}
+
+	// ダウンロードしたものはオフラインでも使える
+	srv.Close()
+	if out, _, err := bench(Options{Offline: true, CSV: true}, "small"); err != nil || !strings.Contains(out, "small/zeros.bin") {
+		t.Errorf("Expected the cached corpus to be used offline, got %v\n%s", err, out)
+	}
+	if _, _, err := bench(Options{}, "nope"); err == nil || !strings.Contains(err.Error(), "small, unpinned") {
+		t.Errorf("Expected an unknown corpus error, got %v", err)
+	}
+}
+
+func TestParseCopy(t *testing.T) {
+	tests := []struct {
+		args []string
+		mode Mode
+		err  error
+	}{
+		{[]string{"-c", "src", "dst"}, ModeCopy, nil},
+		{[]string{"-d", "-suffix", ".lz", "-p", "2", "src", "dst"}, ModeCopyDecompress, nil},
+		{[]string{"-h"}, 0, flag.ErrHelp},
+		{[]string{"src", "dst"}, 0, ErrUsage},
+		{[]string{"-c", "-d", "src", "dst"}, 0, ErrUsage},
+		{[]string{"-c", "src"}, 0, ErrUsage},
+		{[]string{"-c", "-suffix", "", "src", "dst"}, 0, ErrUsage},
+		{[]string{"-c", "-suffix", "x/y", "src", "dst"}, 0, ErrUsage},
+		{[]string{"-c", "-f", "-n", "src", "dst"}, 0, ErrUsage},
+		{[]string{"-c", "-p", "0", "src", "dst"}, 0, ErrUsage},
+	}
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		cmd, err := ParseCopy("tinyzipzap", tt.args, &stderr)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: expected error %v, got %v", tt.args, tt.err, err)
+			continue
+		}
+		if err == nil && (cmd.Mode != tt.mode || cmd.Inputs[0] != "src" || cmd.Output != "dst") {
+			t.Errorf("%v: unexpected command %+v", tt.args, cmd)
+		}
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd, err := ParseInfo("tinyzipzap", []string{"-json", "big.tzz"}, &stderr)
+	if err != nil || cmd.Mode != ModeInfo || !cmd.JSON || cmd.Inputs[0] != "big.tzz" {
+		t.Errorf("Unexpected command %+v (err %v)", cmd, err)
+	}
+	for _, args := range [][]string{nil, {"a.tzz", "b.tzz"}} {
+		if _, err := ParseInfo("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) {
+			t.Errorf("%v: expected ErrUsage, got %v", args, err)
+		}
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd, err := ParseHistory("tinyzipzap", []string{"-log", "h.jsonl", "-algo", "lz77", "-n", "5", "data.bin"}, &stderr)
+	if err != nil || cmd.Mode != ModeHistory || cmd.StatsLog != "h.jsonl" || cmd.Algorithm != "lz77" || cmd.HistoryLimit != 5 || cmd.Inputs[0] != "data.bin" {
+		t.Errorf("Unexpected command %+v (err %v)", cmd, err)
+	}
+	for _, args := range [][]string{nil, {"a", "b"}, {"-n", "-1", "a"}} {
+		if _, err := ParseHistory("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) {
+			t.Errorf("%v: expected ErrUsage, got %v", args, err)
+		}
+	}
+}
+
+func TestParseDict(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd, err := ParseDict("tinyzipzap", []string{"train", "-i", "samples", "-o", "app.dict", "-size", "1024", "-mkdir"}, &stderr)
+	if err != nil || cmd.Mode != ModeDictTrain || cmd.Inputs[0] != "samples" || cmd.Output != "app.dict" || cmd.DictSize != 1024 || !cmd.Mkdir {
+		t.Errorf("Unexpected command %+v (err %v)", cmd, err)
+	}
+	for _, args := range [][]string{{"inspect", "app.dict"}, {"inspect", "-i", "app.dict"}} {
+		cmd, err := ParseDict("tinyzipzap", args, &stderr)
+		if err != nil || cmd.Mode != ModeDictInspect || cmd.Inputs[0] != "app.dict" {
+			t.Errorf("%v: unexpected command %+v (err %v)", args, cmd, err)
+		}
+	}
+	for _, args := range [][]string{
+		nil, {"build"}, {"train", "-i", "samples"}, {"train", "-i", "samples", "-o", "a.dict", "-size", "0"},
+		{"inspect"}, {"inspect", "a.dict", "b.dict"}, {"inspect", "-i", "a.dict", "b.dict"},
+	} {
+		stderr.Reset()
+		if _, err := ParseDict("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) || !strings.Contains(stderr.String(), "使用方法:") {
+			t.Errorf("%v: expected ErrUsage with usage, got %v", args, err)
+		}
+	}
+	if _, err := ParseDict("tinyzipzap", []string{"-h"}, &stderr); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestRunner_Dict(t *testing.T) {
+	dir := t.TempDir()
+	samples := filepath.Join(dir, "samples")
+	os.MkdirAll(samples, 0755)
+	for i := range 5 {
+		data := fmt.Sprintf(`{"id": %d, "status": "active", "message": "tiny zip zap sample"}`, i)
+		if err := os.WriteFile(filepath.Join(samples, fmt.Sprintf("%d.json", i)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(dir, "out", "app.dict")
+	r, out := newTestRunner(nil, Options{DictSize: 256, Mkdir: true})
+	if err := r.DictTrain(samples, output); err != nil {
+		t.Fatalf("DictTrain failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "✅ 辞書作成完了: 5 サンプル -> "+output) {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	out.Reset()
+	if err := r.DictInspect(output); err != nil {
+		t.Fatalf("DictInspect failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "=== 辞書情報 ===") || !strings.Contains(out.String(), "ハッシュ:") {
+		t.Errorf("Unexpected inspect output:\n%s", out)
+	}
+
+	// 学習した辞書で圧縮・展開できる
+	input := writeSample(t, "record.json", []byte(`{"id": 9, "status": "active", "message": "tiny zip zap sample"}`))
+	r, _ = newTestRunner(nil, Options{Algorithm: "lz77", DictPath: output})
+	if err := r.Compress(input, input+".tzz"); err != nil {
+		t.Fatalf("Compress with the dictionary failed: %v", err)
+	}
+	if err := r.Decompress(input+".tzz", input+".out"); err != nil {
+		t.Fatalf("Decompress with the dictionary failed: %v", err)
+	}
+
+	// サンプルのないディレクトリ、ない辞書、辞書でないファイルはエラーを返す
+	r, _ = newTestRunner(nil, Options{})
+	if err := r.DictTrain(t.TempDir(), filepath.Join(dir, "empty.dict")); err == nil || !strings.HasPrefix(err.Error(), "辞書学習エラー: ") {
+		t.Errorf("Expected a training error, got %v", err)
+	}
+	if err := r.DictInspect(filepath.Join(dir, "missing.dict")); err == nil || !strings.HasPrefix(err.Error(), "辞書読み込みエラー: ") {
+		t.Errorf("Expected a load error, got %v", err)
+	}
+	if err := r.DictInspect(input); err == nil {
+		t.Error("Expected an error for a file that is not a dictionary")
+	}
+}
+
+func TestRunner_StatsLogHistory(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	logPath := filepath.Join(t.TempDir(), "stats", "history.jsonl")
+	compress := func(opts Options) string {
+		t.Helper()
+		opts.StatsLog, opts.Force = logPath, true
+		r, _ := newTestRunner(nil, opts)
+		var stderr bytes.Buffer
+		r.Err = &stderr
+		if err := r.Compress(input, input+".tzz"); err != nil {
+			t.Fatalf("Compress %+v failed: %v", opts, err)
+		}
+		return stderr.String()
+	}
+
+	compress(Options{Algorithm: "huffman"})
+	compress(Options{Algorithm: "lz77", Adaptive: true, BlockSize: 512})
+	// 以前の最良の圧縮率より悪い設定は記録し、警告する
+	if warning := compress(Options{Algorithm: "rle"}); !strings.Contains(warning, "⚠️  同じ入力の最良の圧縮率") ||
+		!strings.Contains(warning, "lz77 adaptive=true block_size=512") {
+		t.Errorf("Expected a regression warning naming the best setting, got %q", warning)
+	}
+	r, _ := newTestRunner(nil, Options{Algorithm: "lz77", StatsLog: logPath, Force: true})
+	if err := r.Decompress(input+".tzz", input+".out"); err != nil {
+		t.Fatal(err)
+	}
+	// 標準入力の圧縮も内容のSHA-256で同じ入力として記録する
+	r, _ = newTestRunner(sample, Options{Algorithm: "lz77", StatsLog: logPath, Force: true})
+	if err := r.Compress("-", filepath.Join(t.TempDir(), "stdin.tzz")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, out := newTestRunner(nil, Options{StatsLog: logPath, JSON: true})
+	if err := r.History(input); err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	var summary historySummary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", out, err)
+	}
+	want := sha256.Sum256(sample)
+	if summary.InputSHA256 != hex.EncodeToString(want[:]) || summary.Matched != 4 {
+		t.Fatalf("Expected the 4 compress records of the input, got %+v", summary)
+	}
+	rec := summary.Records[1]
+	if rec.Operation != "compress" || rec.Algorithm != "lz77" || rec.Params["block_size"] != "512" ||
+		rec.OriginalSize != int64(len(sample)) || rec.Version == "" || rec.Timings == nil {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+	if summary.Best == nil || summary.Best.Input != "-" || summary.Best.Setting() != "lz77" || summary.Regressed {
+		t.Errorf("Expected the latest lz77 run from stdin as the best, got %+v", summary)
+	}
+
+	// 展開の記録は圧縮ファイルのSHA-256で探す
+	r, out = newTestRunner(nil, Options{StatsLog: logPath})
+	if err := r.History(input + ".tzz"); err != nil || !strings.Contains(out.String(), "decompress") {
+		t.Errorf("Expected the decompress record\n%s (err %v)", out, err)
+	}
+
+	// -algo で絞り込み、SHA-256 の先頭でも指定できる（最新の圧縮が最良より悪ければ表示する）
+	r, out = newTestRunner(nil, Options{StatsLog: logPath, Algorithm: "RLE", HistoryLimit: 1})
+	if err := r.History(strings.ToUpper(summary.InputSHA256[:8])); err != nil {
+		t.Fatal(err)
+	}
+	if text := out.String(); !strings.Contains(text, "記録: 1 件") || !strings.Contains(text, "最良の圧縮率") || strings.Contains(text, "悪化") {
+		t.Errorf("Unexpected history output\n%s", text)
+	}
+	r, out = newTestRunner(nil, Options{StatsLog: logPath})
+	if err := r.History(input); err != nil || strings.Contains(out.String(), "悪化") {
+		t.Errorf("Unexpected regression in\n%s (err %v)", out, err)
+	}
+	compress(Options{Algorithm: "rle"})
+	r, out = newTestRunner(nil, Options{StatsLog: logPath})
+	if err := r.History(input); err != nil || !strings.Contains(out.String(), "⚠️  最新の圧縮") {
+		t.Errorf("Expected the latest rle run to be flagged\n%s (err %v)", out, err)
+	}
+
+	r, out = newTestRunner(nil, Options{StatsLog: logPath})
+	if err := r.History("0123456789"); err != nil || !strings.Contains(out.String(), "記録はありません") {
+		t.Errorf("Expected no records\n%s (err %v)", out, err)
+	}
+	if err := r.History("no-such-file"); err == nil {
+		t.Error("Expected an error for a missing file that is not a hash")
+	}
+}
+
+func TestParseServe(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd, err := ParseServe("tinyzipzap", []string{"-p", "9000", "-max-upload", "4M"}, &stderr)
+	if err != nil || cmd.Mode != ModeServe || cmd.Addr != "localhost:9000" || cmd.MaxUpload != "4M" {
+		t.Errorf("Unexpected command %+v (err %v)", cmd, err)
+	}
+	if cmd, err := ParseServe("tinyzipzap", nil, &stderr); err != nil || cmd.Addr != "localhost:8080" {
+		t.Errorf("Expected the default address, got %+v (err %v)", cmd, err)
+	}
+	for _, args := range [][]string{{"extra"}, {"-p", "70000"}, {"-max-upload", "lots"}} {
+		if _, err := ParseServe("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) {
+			t.Errorf("%v: expected ErrUsage, got %v", args, err)
+		}
+	}
+}
+
+func TestParseCompletion(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd, err := ParseCompletion("./bin/tinyzipzap", []string{"zsh"}, &stderr)
+	if err != nil || cmd.Mode != ModeCompletion || cmd.Shell != "zsh" || cmd.Program != "tinyzipzap" {
+		t.Errorf("Unexpected command %+v (err %v)", cmd, err)
+	}
+	for _, args := range [][]string{nil, {"powershell"}, {"bash", "zsh"}} {
+		if _, err := ParseCompletion("tinyzipzap", args, &stderr); !errors.Is(err, ErrUsage) {
+			t.Errorf("%v: expected ErrUsage, got %v", args, err)
+		}
+	}
+}
+
+func TestRunner_Completion(t *testing.T) {
+	generate := func(shell string) string {
+		t.Helper()
+		r, out := newTestRunner(nil, Options{})
+		if err := r.Completion(shell, "tinyzipzap"); err != nil {
+			t.Fatalf("Completion(%s) failed: %v", shell, err)
+		}
+		return out.String()
+	}
+
+	bash := generate("bash")
+	for _, name := range common.Names() {
+		if !regexp.MustCompile(`[" ]` + regexp.QuoteMeta(name) + `[" ]`).MatchString(bash) {
+			t.Errorf("bash script does not complete algorithm %q", name)
+		}
+	}
+	var cmd Command
+	defines := map[string]func(*flag.FlagSet){
+		"main":  func(fs *flag.FlagSet) { defineMainFlags(fs, &cmd) },
+		"copy":  func(fs *flag.FlagSet) { defineCopyFlags(fs, &cmd) },
+		"info":  func(fs *flag.FlagSet) { defineInfoFlags(fs, &cmd) },
+		"serve": func(fs *flag.FlagSet) { defineServeFlags(fs, &cmd) },
+	}
+	for sub, define := range defines {
+		fs := flag.NewFlagSet(sub, flag.ContinueOnError)
+		define(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			if !strings.Contains(bash, "-"+f.Name+" ") && !strings.Contains(bash, "-"+f.Name+"\"") {
+				t.Errorf("bash script does not complete %s flag -%s", sub, f.Name)
+			}
+		})
+	}
+	for _, sub := range []string{"copy", "info", "serve", "dict", "completion"} {
+		if !strings.Contains(bash, sub) {
+			t.Errorf("bash script does not complete subcommand %s", sub)
+		}
+	}
+
+	// 同じ登録内容からは同じスクリプトを生成する
+	for _, shell := range completionShells {
+		if first, second := generate(shell), generate(shell); first != second {
+			t.Errorf("%s script is not deterministic", shell)
+		}
+	}
+	if r, _ := newTestRunner(nil, Options{}); r.Completion("powershell", "tinyzipzap") == nil {
+		t.Error("Expected an error for an unknown shell")
+	}
+}
+
+func TestRunner_Info(t *testing.T) {
+	input := writeSample(t, "sample.txt", sample)
+	output := filepath.Join(t.TempDir(), "sample.tzz")
+	r, out := newTestRunner(nil, Options{Algorithm: "lz77"})
+	if err := r.Compress(input, output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	out.Reset()
+	if err := r.Info(output); err != nil || !strings.Contains(out.String(), "形式:       tzz") || !strings.Contains(out.String(), "lz77") {
+		t.Errorf("Unexpected info (err %v)\n%s", err, out)
+	}
+
+	r, out = newTestRunner(nil, Options{JSON: true})
+	if err := r.Info(output); err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+	var info container.Info
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, out)
+	}
+	if info.Format != container.FormatTzz || info.OriginalSize != int64(len(sample)) || len(info.Members) == 0 || info.Members[0].Algorithm != "lz77" {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	// 標準入力からも読め、ヘッダーのないデータは判別できない形式として表示する
+	r, out = newTestRunner([]byte("plain text"), Options{})
+	if err := r.Info("-"); err != nil || out.String() != "unknown format, 10 bytes\n" {
+		t.Errorf("Unexpected output %q (err %v)", out, err)
+	}
+}
+
+// copyTree は copy のテスト用のディレクトリを作成し、そのパスを返します
+func copyTree(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	files := map[string]string{
+		"a.txt":            string(sample),
+		"sub/b.log":        strings.Repeat("log line\n", 100),
+		"sub/deeper/c.bin": "\x00\x01\x02\x03",
+		"empty":            "",
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+	}
+	os.Chmod(filepath.Join(src, "sub", "b.log"), 0600)
+	return src
+}
+
+func runCopy(t *testing.T, src, dst string, decompress bool, opts Options) string {
+	t.Helper()
+	r, out := newTestRunner(nil, opts)
+	if err := r.Copy(src, dst, decompress); err != nil {
+		t.Fatalf("Copy failed: %v\n%s", err, r.Err)
+	}
+	return out.String()
+}
+
+func TestRunner_Copy(t *testing.T) {
+	src := copyTree(t)
+	dst := filepath.Join(t.TempDir(), "backup")
+	opts := Options{Algorithm: "lz77", Parallel: 2, Verbose: true}
+
+	if out := runCopy(t, src, dst, false, opts); !strings.Contains(out, "コピー: 4, スキップ: 0, 失敗: 0") {
+		t.Fatalf("Expected all files to be copied\n%s", out)
+	}
+	srcInfo, _ := os.Stat(filepath.Join(src, "sub", "b.log"))
+	dstInfo, err := os.Stat(filepath.Join(dst, "sub", "b.log.lz77"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstInfo.Mode().Perm() != 0600 || !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		t.Errorf("Expected mode 0600 and mtime %v, got %v and %v", srcInfo.ModTime(), dstInfo.Mode(), dstInfo.ModTime())
+	}
+
+	// 2回目は何も変わっていないので処理しない
+	if out := runCopy(t, src, dst, false, opts); !strings.Contains(out, "コピー: 0, スキップ: 4, 失敗: 0") || strings.Contains(out, " -> "+dst+"/") {
+		t.Errorf("Expected the second sync to be a no-op\n%s", out)
+	}
+
+	// 更新したファイルだけを処理し直す
+	changed := filepath.Join(src, "sub", "deeper", "c.bin")
+	os.WriteFile(changed, []byte("changed content"), 0644)
+	out := runCopy(t, src, dst, false, opts)
+	if !strings.Contains(out, "コピー: 1, スキップ: 3, 失敗: 0") || !strings.Contains(out, changed+" -> ") {
+		t.Errorf("Expected only %s to be reprocessed\n%s", changed, out)
+	}
+
+	// -f はすべて、-n は古い出力先も書き換えない
+	force := opts
+	force.Force = true
+	if out := runCopy(t, src, dst, false, force); !strings.Contains(out, "コピー: 4, スキップ: 0") {
+		t.Errorf("Expected -f to reprocess everything\n%s", out)
+	}
+	os.Chtimes(changed, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	noClobber := opts
+	noClobber.NoClobber = true
+	if out := runCopy(t, src, dst, false, noClobber); !strings.Contains(out, "コピー: 0, スキップ: 4") {
+		t.Errorf("Expected -n to keep existing outputs\n%s", out)
+	}
+
+	// -d で元の内容、パーミッション、更新日時に戻す
+	restored := filepath.Join(t.TempDir(), "restored")
+	if out := runCopy(t, dst, restored, true, Options{}); !strings.Contains(out, "コピー: 4, スキップ: 0, 失敗: 0") {
+		t.Fatalf("Expected all files to be restored\n%s", out)
+	}
+	filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		want, _ := os.ReadFile(path)
+		got, err := os.ReadFile(filepath.Join(restored, rel))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: restored content differs (err %v)", rel, err)
+		}
+		return nil
+	})
+	if info, _ := os.Stat(filepath.Join(restored, "sub", "b.log")); info == nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the restored file to keep mode 0600, got %v", info)
+	}
+	if out := runCopy(t, dst, restored, true, Options{}); !strings.Contains(out, "コピー: 0, スキップ: 4") {
+		t.Errorf("Expected the second restore to be a no-op\n%s", out)
+	}
+}
+
+func TestRunner_CopySuffix(t *testing.T) {
+	src := copyTree(t)
+	dst := filepath.Join(t.TempDir(), "backup")
+	if out := runCopy(t, src, dst, false, Options{Algorithm: "rle", Suffix: ".bak"}); !strings.Contains(out, "コピー: 4,") {
+		t.Fatalf("Expected all files to be copied\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt.bak")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 既知の拡張子でないファイルは -suffix を指定しないと展開しない
+	restored := filepath.Join(t.TempDir(), "restored")
+	if out := runCopy(t, dst, restored, true, Options{}); !strings.Contains(out, "コピー: 0, スキップ: 0, 失敗: 0") {
+		t.Errorf("Expected files with an unknown extension to be ignored\n%s", out)
+	}
+	if out := runCopy(t, dst, restored, true, Options{Suffix: ".bak"}); !strings.Contains(out, "コピー: 4,") {
+		t.Errorf("Expected -suffix to select the files to restore\n%s", out)
+	}
+}
+
+func TestRunner_CopyErrors(t *testing.T) {
+	src := copyTree(t)
+	r, _ := newTestRunner(nil, Options{})
+	if err := r.Copy(src, filepath.Join(src, "backup"), false); err == nil {
+		t.Error("Expected an error for a destination inside the source")
+	}
+	if err := r.Copy(filepath.Join(src, "a.txt"), t.TempDir(), false); err == nil {
+		t.Error("Expected an error for a source that is not a directory")
+	}
+
+	// 展開できないファイルは飛ばして残りを処理し、失敗を終了コードで知らせる
+	dst := t.TempDir()
+	runCopy(t, src, dst, false, Options{})
+	os.WriteFile(filepath.Join(dst, "broken.tzz"), []byte("not a container"), 0644)
+	r, out := newTestRunner(nil, Options{})
+	err := r.Copy(dst, filepath.Join(t.TempDir(), "restored"), true)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("Expected ExitError with code 1, got %v", err)
+	}
+	if !strings.Contains(out.String(), "コピー: 4, スキップ: 0, 失敗: 1") || !strings.Contains(r.Err.(*bytes.Buffer).String(), "broken.tzz") {
+		t.Errorf("Expected the broken file to be reported\n%s%s", out, r.Err)
+	}
+}
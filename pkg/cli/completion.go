@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// completionShells は completion で補完スクリプトを生成できるシェルです
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// ParseCompletion は completion サブコマンドの引数を解釈します（args には "completion" を含めません）
+// 引数はシェルの名前（bash, zsh, fish）です。エラーの扱いは Parse と同じです。
+func ParseCompletion(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name+" completion", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s completion <%s>\n\n", name, strings.Join(completionShells, "|"))
+		fmt.Fprintf(stderr, "例:\n")
+		fmt.Fprintf(stderr, "  source <(%s completion bash)\n", name)
+		fmt.Fprintf(stderr, "  %s completion zsh > \"${fpath[1]}/_%s\"\n", name, filepath.Base(name))
+		fmt.Fprintf(stderr, "  %s completion fish > ~/.config/fish/completions/%s.fish\n", name, filepath.Base(name))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 || !slices.Contains(completionShells, fs.Arg(0)) {
+		fmt.Fprintf(stderr, "エラー: シェルを1つ指定してください（%s）\n\n", strings.Join(completionShells, ", "))
+		fs.Usage()
+		return nil, ErrUsage
+	}
+	return &Command{Mode: ModeCompletion, Shell: fs.Arg(0), Program: filepath.Base(name)}, nil
+}
+
+// Completion は program の shell 用の補完スクリプトを r.Out に出力します
+// フラグは各サブコマンドの Parse と同じ定義から、-algo の候補は登録済みのアルゴリズムから
+// 作るため、フラグやアルゴリズムを追加すればスクリプトにも含まれます。
+func (r *Runner) Completion(shell, program string) error {
+	commands := completionModel()
+	switch shell {
+	case "bash":
+		writeBashCompletion(r.Out, program, commands)
+	case "zsh":
+		writeZshCompletion(r.Out, program, commands)
+	case "fish":
+		writeFishCompletion(r.Out, program, commands)
+	default:
+		return fmt.Errorf("cli: unknown shell: %s", shell)
+	}
+	return nil
+}
+
+// completionFlag は補完するフラグです
+type completionFlag struct {
+	name   string
+	usage  string   // 説明（最初の区切りまで）
+	isBool bool     // 値を取らない
+	values []string // 値の候補
+	files  bool     // 値がファイルのパス
+}
+
+// completionCommand は補完するサブコマンドです
+type completionCommand struct {
+	name  string   // サブコマンド名（"" はサブコマンドを指定しない場合）
+	usage string   // 説明
+	words []string // 下位のコマンド（dict の train など）
+	flags []completionFlag
+	files bool // 引数がファイルのパス
+}
+
+// completionFileFlags は値がファイルやディレクトリのパスのフラグです
+var completionFileFlags = map[string]bool{
+	"i": true, "o": true, "dict": true, "csv-file": true, "ref": true, "report": true,
+	"template": true, "dot": true, "trace": true, "export-stats": true, "stats-log": true, "log": true,
+	"salvage-report": true,
+}
+
+// completionModel は補完するサブコマンドとフラグの一覧を返します
+// dict は train と inspect でフラグが異なるため、下位のコマンドだけを補完します。
+func completionModel() []completionCommand {
+	var cmd Command
+	return []completionCommand{
+		{usage: "ファイルの圧縮・展開・分析", files: true,
+			flags: completionFlags(func(fs *flag.FlagSet) { defineMainFlags(fs, &cmd) }, true)},
+		{name: "copy", usage: "ディレクトリを圧縮・展開しながらコピー", files: true,
+			flags: completionFlags(func(fs *flag.FlagSet) { defineCopyFlags(fs, &cmd) }, false)},
+		{name: "info", usage: "圧縮ファイルのヘッダーを表示", files: true,
+			flags: completionFlags(func(fs *flag.FlagSet) { defineInfoFlags(fs, &cmd) }, false)},
+		{name: "history", usage: "-stats-log の記録と最良の圧縮率を表示", files: true,
+			flags: completionFlags(func(fs *flag.FlagSet) { defineHistoryFlags(fs, &cmd) }, false)},
+		{name: "serve", usage: "Web UIを起動",
+			flags: completionFlags(func(fs *flag.FlagSet) { defineServeFlags(fs, &cmd) }, false)},
+		{name: "dict", usage: "LZ77のプリセット辞書の学習・表示", words: []string{"train", "inspect"}, files: true},
+		{name: "completion", usage: "シェルの補完スクリプトを出力", words: completionShells},
+	}
+}
+
+// completionFlags は define で定義したフラグを名前順に返します
+// auto は -algo に "auto"（-target-ratio で推奨順に試す）を候補に加えるかどうかです。
+func completionFlags(define func(fs *flag.FlagSet), auto bool) []completionFlag {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	define(fs)
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{name: f.Name, usage: shortUsage(f.Usage), files: completionFileFlags[f.Name]}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.isBool = true
+		}
+		switch f.Name {
+		case "algo":
+			cf.values = common.Names()
+			if auto {
+				cf.values = append(cf.values, autoAlgorithm)
+			}
+		case "format":
+			cf.values = []string{formatTzz, formatTza, formatZip}
+		case "special":
+			cf.values = []string{specialSkip, specialError}
+		case "symlinks":
+			cf.values = []string{symlinksSkip, symlinksInternal, symlinksAll}
+		case "corpus":
+			for _, c := range corpus.All() {
+				cf.values = append(cf.values, c.Name)
+			}
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+// shortUsage はフラグの説明の最初の区切り（括弧や句点）までを返します
+func shortUsage(usage string) string {
+	for _, sep := range []string{"（", " (", "。"} {
+		if i := strings.Index(usage, sep); i > 0 {
+			usage = usage[:i]
+		}
+	}
+	return usage
+}
+
+// completionFunctionName は program から補完の関数名を作ります（英数字以外は _ にします）
+func completionFunctionName(program string) string {
+	return "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, program)
+}
+
+// subcommandNames はサブコマンド名を返します
+func subcommandNames(commands []completionCommand) []string {
+	var names []string
+	for _, c := range commands {
+		if c.name != "" {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// flagWords はフラグを - を付けた名前で返します
+func flagWords(flags []completionFlag) string {
+	var words []string
+	for _, f := range flags {
+		words = append(words, "-"+f.name)
+	}
+	return strings.Join(words, " ")
+}
+
+func writeBashCompletion(w io.Writer, program string, commands []completionCommand) {
+	fn := completionFunctionName(program)
+	fmt.Fprintf(w, "# bash completion for %s（%s completion bash で生成）\n", program, program)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" sub=\"\"\n")
+	fmt.Fprintf(w, "    if [[ ${COMP_CWORD} -gt 1 ]]; then\n")
+	fmt.Fprintf(w, "        case \"${COMP_WORDS[1]}\" in\n")
+	fmt.Fprintf(w, "            %s) sub=\"${COMP_WORDS[1]}\" ;;\n", strings.Join(subcommandNames(commands), "|"))
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    case \"${sub}\" in\n")
+	for _, c := range commands {
+		label := c.name
+		if label == "" {
+			label = `""`
+		}
+		fmt.Fprintf(w, "    %s)\n", label)
+		var files, free []string
+		for _, f := range c.flags {
+			switch {
+			case len(f.values) > 0:
+				fmt.Fprintf(w, "        if [[ \"${prev}\" == -%s ]]; then\n", f.name)
+				fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(f.values, " "))
+				fmt.Fprintf(w, "            return\n")
+				fmt.Fprintf(w, "        fi\n")
+			case f.files:
+				files = append(files, "-"+f.name)
+			case !f.isBool:
+				free = append(free, "-"+f.name)
+			}
+		}
+		if len(files) > 0 {
+			fmt.Fprintf(w, "        case \"${prev}\" in\n")
+			fmt.Fprintf(w, "            %s) COMPREPLY=($(compgen -f -- \"${cur}\")); return ;;\n", strings.Join(files, "|"))
+			fmt.Fprintf(w, "        esac\n")
+		}
+		if len(free) > 0 {
+			// 値を自由に指定するフラグの後は補完しない
+			fmt.Fprintf(w, "        case \"${prev}\" in\n")
+			fmt.Fprintf(w, "            %s) return ;;\n", strings.Join(free, "|"))
+			fmt.Fprintf(w, "        esac\n")
+		}
+		if len(c.flags) > 0 {
+			fmt.Fprintf(w, "        if [[ \"${cur}\" == -* ]]; then\n")
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", flagWords(c.flags))
+			fmt.Fprintf(w, "            return\n")
+			fmt.Fprintf(w, "        fi\n")
+		}
+		switch {
+		case c.name == "":
+			fmt.Fprintf(w, "        if [[ ${COMP_CWORD} -eq 1 ]]; then\n")
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(subcommandNames(commands), " "))
+			fmt.Fprintf(w, "        fi\n")
+			fmt.Fprintf(w, "        COMPREPLY+=($(compgen -f -- \"${cur}\"))\n")
+		case len(c.words) > 0:
+			fmt.Fprintf(w, "        if [[ ${COMP_CWORD} -eq 2 ]]; then\n")
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(c.words, " "))
+			if c.files {
+				fmt.Fprintf(w, "        else\n")
+				fmt.Fprintf(w, "            COMPREPLY=($(compgen -f -- \"${cur}\"))\n")
+			}
+			fmt.Fprintf(w, "        fi\n")
+		case c.files:
+			fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"${cur}\"))\n")
+		}
+		fmt.Fprintf(w, "        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, program)
+}
+
+// zshQuote は s を zsh の _arguments の説明に使えるようにします（単一引用符の中に置きます）
+func zshQuote(s string) string {
+	return strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(s)
+}
+
+func writeZshCompletion(w io.Writer, program string, commands []completionCommand) {
+	fn := completionFunctionName(program)
+	fmt.Fprintf(w, "#compdef %s\n", program)
+	fmt.Fprintf(w, "# zsh completion for %s（%s completion zsh で生成）\n\n", program, program)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "    local -a subcommands\n")
+	fmt.Fprintf(w, "    subcommands=(\n")
+	for _, c := range commands {
+		if c.name != "" {
+			fmt.Fprintf(w, "        '%s:%s'\n", c.name, zshQuote(c.usage))
+		}
+	}
+	fmt.Fprintf(w, "    )\n")
+	fmt.Fprintf(w, "    case \"${words[2]}\" in\n")
+	// サブコマンドを指定しない場合は * で受けるため、最後に置く
+	ordered := append(slices.Clone(commands[1:]), commands[0])
+	for _, c := range ordered {
+		if c.name != "" {
+			fmt.Fprintf(w, "    %s)\n", c.name)
+			fmt.Fprintf(w, "        shift words\n")
+			fmt.Fprintf(w, "        (( CURRENT-- ))\n")
+		} else {
+			fmt.Fprintf(w, "    *)\n")
+			fmt.Fprintf(w, "        if (( CURRENT == 2 )) && [[ \"${words[CURRENT]}\" != -* ]]; then\n")
+			fmt.Fprintf(w, "            _describe -t commands 'subcommand' subcommands\n")
+			fmt.Fprintf(w, "        fi\n")
+		}
+		fmt.Fprintf(w, "        _arguments -S")
+		for _, f := range c.flags {
+			spec := fmt.Sprintf("-%s[%s]", f.name, zshQuote(f.usage))
+			switch {
+			case len(f.values) > 0:
+				spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+			case f.files:
+				spec += ":file:_files"
+			case !f.isBool:
+				spec += ":" + f.name + ": "
+			}
+			fmt.Fprintf(w, " \\\n            '%s'", spec)
+		}
+		if len(c.words) > 0 {
+			fmt.Fprintf(w, " \\\n            '1:command:(%s)'", strings.Join(c.words, " "))
+		}
+		if c.files {
+			fmt.Fprintf(w, " \\\n            '*:file:_files'")
+		}
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w, "        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "if [[ \"${funcstack[1]}\" == \"%s\" ]]; then\n", fn)
+	fmt.Fprintf(w, "    %s \"$@\"\n", fn)
+	fmt.Fprintf(w, "else\n")
+	fmt.Fprintf(w, "    compdef %s %s\n", fn, program)
+	fmt.Fprintf(w, "fi\n")
+}
+
+// fishQuote は s を fish の単一引用符で囲みます
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, program string, commands []completionCommand) {
+	fmt.Fprintf(w, "# fish completion for %s（%s completion fish で生成）\n", program, program)
+	names := strings.Join(subcommandNames(commands), " ")
+	for _, c := range commands {
+		condition := "not __fish_seen_subcommand_from " + names
+		if c.name != "" {
+			// サブコマンドを指定しない場合もファイルを引数に取るため、-f は付けない
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s -d %s\n",
+				program, fishQuote("__fish_use_subcommand"), c.name, fishQuote(c.usage))
+			condition = "__fish_seen_subcommand_from " + c.name
+		}
+		for _, word := range c.words {
+			fmt.Fprintf(w, "complete -c %s -n %s -f -a %s\n", program,
+				fishQuote(condition+"; and not __fish_seen_subcommand_from "+strings.Join(c.words, " ")), word)
+		}
+		for _, f := range c.flags {
+			line := fmt.Sprintf("complete -c %s -n %s -o %s", program, fishQuote(condition), f.name)
+			switch {
+			case len(f.values) > 0:
+				line += " -x -a " + fishQuote(strings.Join(f.values, " "))
+			case f.files:
+				line += " -r -F"
+			case !f.isBool:
+				line += " -x"
+			}
+			fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(f.usage))
+		}
+		if !c.files {
+			fmt.Fprintf(w, "complete -c %s -n %s -f\n", program, fishQuote(condition))
+		}
+	}
+}
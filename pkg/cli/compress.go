@@ -0,0 +1,395 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/history"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// Compress は入力ファイルを.tzzコンテナに圧縮します
+// StatsLog を指定した場合は、圧縮の結果を統計ログに追記します（recordStats）。
+// output が空の場合は input にアルゴリズムの拡張子（common.Extension、例: .lz77）を付けたファイルに出力します。
+// TargetRatio が正の場合は、圧縮率がその値以下になる場合だけ圧縮します。
+// TracePath を指定した場合は、エンコーダーの各ステップを JSON Lines で書き込みます。
+// Format が tza か zip の場合は、input のディレクトリをアーカイブにまとめます（compressArchive）。
+// input が名前付きパイプなどの通常のファイルでない場合は、Special に従って飛ばすかエラーにします（checkSpecial）。
+func (r *Runner) Compress(input, output string) (err error) {
+	if skip, err := r.checkSpecial(input); skip || err != nil {
+		return err
+	}
+	if isArchiveFormat(r.Format) {
+		if err := r.policy().Refuse("-format "+r.Format+" stores entries that would expand uncompressed", "use -format tzz, or omit -strict"); err != nil {
+			return err
+		}
+		return r.compressArchive(input, output)
+	}
+	if output == "" {
+		output = r.defaultCompressOutput(input)
+	}
+	if r.TargetRatio < 0 {
+		return errors.New("-target-ratio は正の値で指定してください")
+	}
+	if r.algorithmName() == autoAlgorithm {
+		if r.TargetRatio == 0 || r.DictPath != "" || r.FilterSpec != "" || r.Adaptive || r.TracePath != "" {
+			return errors.New("-algo auto は -target-ratio と指定してください（-dict, -filter, -adaptive, -trace とは併用できません）")
+		}
+		if err := r.policy().Refuse("-algo auto chooses the algorithm from the data", "specify -algo <name>"); err != nil {
+			return err
+		}
+		return r.compressTarget(nil, input, output)
+	}
+
+	compressor, err := r.compressor()
+	if err != nil {
+		return err
+	}
+	if r.TracePath != "" {
+		var finish func() error
+		if compressor, finish, err = r.traceCompressor(compressor); err != nil {
+			return err
+		}
+		defer func() {
+			if ferr := finish(); err == nil && ferr != nil {
+				err = fmt.Errorf("トレース書き込みエラー: %w", ferr)
+			}
+		}()
+	}
+	if r.TargetRatio > 0 {
+		return r.compressTarget(compressor, input, output)
+	}
+
+	return r.compressFile(compressor, r.algorithmName(), input, output, r.In)
+}
+
+// compressFile は入力をストリームで（container.CompressFile）.tzzコンテナに圧縮します
+// algorithm はメンバーに記録する登録名、stdin は input が "-" の場合に読み込む標準入力です。
+// TargetRatio が正の場合は（一度に圧縮できない大きな入力）、圧縮後に目標を確認し、
+// 満たさなくても圧縮したまま書き込んで統計の TargetNotMet で知らせます。
+// 入力が既に .tzz コンテナの場合は、圧縮せずに入れ子のメンバーとして格納して Err に警告します
+// （-allow-recompress では圧縮し、Strict の場合はエラーにします）。
+func (r *Runner) compressFile(compressor common.Compressor, algorithm, input, output string, stdin io.Reader) error {
+	hasher, err := r.newStatsHasher(input)
+	if err != nil {
+		return err
+	}
+	opts := r.fileOptions()
+	opts.Algorithm = algorithm
+	opts.Stdin = hasher.wrap(stdin)
+	if opts.RateLimit, err = r.rateLimit(); err != nil {
+		return err
+	}
+	tracker, stop := r.startProgress(input, &opts)
+	stats, err := container.CompressFile(input, output, compressor, opts)
+	stop()
+	if r.reportSkipped(err, output) {
+		return nil
+	} else if errors.Is(err, container.ErrNested) {
+		return r.policy().Refuse("input is already a .tzz container and would be stored without compressing", "-allow-recompress to compress it again, or omit -strict")
+	} else if err != nil {
+		return fmt.Errorf("圧縮エラー: %w%s", err, existingHint(err))
+	}
+	if stats.Nested {
+		fmt.Fprintf(r.Err, "⚠️  %s は既に .tzz コンテナのため、圧縮せずにそのまま格納しました（入れ子）。圧縮する場合は -allow-recompress を指定してください\n", input)
+	}
+	if r.TargetRatio > 0 && !stats.Nested {
+		stats.TargetRatio = r.TargetRatio
+		stats.TargetNotMet = stats.Ratio > r.TargetRatio
+	}
+	r.recordStats(history.OpCompress, input, hasher.Sum(), algorithm, stats)
+	if r.JSON {
+		return r.printStatsJSON(stats)
+	}
+
+	fmt.Fprintf(r.Out, "✅ 圧縮完了: %s -> %s\n", input, output)
+	fmt.Fprintln(r.Out, tracker.Status().Summary())
+
+	if r.Verbose {
+		fmt.Fprintln(r.Out)
+		common.FprintCompressionStats(r.Out, stats)
+		if _, ok := compressor.(*blocks.Compressor); ok {
+			r.printBlockInfo(output)
+		}
+	} else {
+		fmt.Fprintf(r.Out, "圧縮率: %.2f%% (%s -> %s)\n",
+			stats.Ratio*100,
+			common.FormatBytes(stats.OriginalSize),
+			common.FormatBytes(stats.CompressedSize))
+	}
+	if stats.TargetNotMet {
+		fmt.Fprintf(r.Out, "⚠️  目標未達: 圧縮率 %.2f%% が目標 %.2f%% を超えましたが、ストリームで圧縮したため圧縮したまま書き込みました\n",
+			stats.Ratio*100, r.TargetRatio*100)
+	}
+	return nil
+}
+
+// traceCompressor は TracePath にステップを書き込む Compressor を返します
+// 返す関数はファイルを閉じ、トレースの書き込みエラーを返します。成功した場合は
+// イベントの数を表示します（-json の場合は表示しません）。
+func (r *Runner) traceCompressor(c common.Compressor) (common.Compressor, func() error, error) {
+	f, err := fileutil.Create(r.TracePath, r.writeOptions())
+	if r.reportSkipped(err, r.TracePath) {
+		return c, func() error { return nil }, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	w := bufio.NewWriter(f)
+	tracer := common.NewJSONLTracer(w)
+	traced, ok := common.WithTracer(c, tracer)
+	if !ok {
+		f.Close()
+		os.Remove(r.TracePath)
+		return nil, nil, errors.New("-trace は -algo rle, lz77, lz77-optimal, huffman, huffman16 でのみ使用できます（-dict 以外のオプションとは併用できません）")
+	}
+
+	finish := func() error {
+		err := errors.Join(tracer.Err(), w.Flush(), f.Close())
+		if err == nil && !r.JSON {
+			fmt.Fprintf(r.Out, "トレース: %s (%d イベント)\n", r.TracePath, tracer.Count())
+		}
+		return err
+	}
+	return traced, finish, nil
+}
+
+// compressTarget は圧縮率が TargetRatio 以下になる場合だけ、入力を.tzzコンテナに圧縮します
+// compressor が nil の場合（-algo auto）は、データの種類から推奨される順に登録済みの
+// アルゴリズムを試し、目標を満たした最初のものを使います。どれも満たさない場合は
+// 入力をそのまま出力し、統計の TargetNotMet（JSONでは target_not_met）で知らせます。
+// 目標を満たさないことはエラーではありません（Strict の場合は元のデータを書き込まずにエラーにします）。
+// 入力が一度に圧縮できる上限（common.MaxOneShotSize）を超える場合は、ストリームで圧縮します（compressOversized）。
+// 入力が既に .tzz コンテナの場合は、目標によらず compressFile と同じく入れ子のメンバーとして格納します。
+func (r *Runner) compressTarget(compressor common.Compressor, input, output string) error {
+	timings := common.NewTimings()
+	start := time.Now()
+	data, oversized, err := r.readOneShotInput(input)
+	if err != nil {
+		return err
+	}
+	if oversized != nil {
+		return r.compressOversized(compressor, input, output, oversized)
+	}
+	if r.nestedMode() != container.NestedCompress && container.LooksLikeContainer(data) {
+		// 目標によらず、ストリームの場合と同じく入れ子のメンバーとして格納する
+		return r.compressFile(common.NewStored(), common.StoredAlgorithm, input, output, bytes.NewReader(data))
+	}
+	phase := timings.Since(common.PhaseRead, start)
+
+	// 試す候補と、その登録名（メンバーに記録する名前）
+	candidates := []common.Compressor{compressor}
+	names := []string{r.algorithmName()}
+	if compressor == nil {
+		candidates, names = nil, common.RecommendedOrder(data)
+		for _, name := range names {
+			c, err := common.New(name)
+			if err != nil {
+				return fmt.Errorf("未対応のアルゴリズム: %s", name)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+
+	for i, c := range candidates {
+		candidates[i], _ = common.WithTimings(c, timings)
+	}
+	result, used, met, err := r.policy().CompressWithTarget(data, r.TargetRatio, candidates...)
+	if err != nil {
+		return fmt.Errorf("圧縮エラー: %w", err)
+	}
+
+	out, algorithm := result, common.StoredAlgorithm
+	if used != common.StoredAlgorithm {
+		i := slices.IndexFunc(candidates, func(c common.Compressor) bool { return c.Name() == used })
+		if out, err = container.EncodeCompressedMember(names[i], candidates[i], data, result); err != nil {
+			return fmt.Errorf("圧縮エラー: %w", err)
+		}
+		algorithm = names[i]
+	}
+	phase = timings.Since(common.PhaseCompress, phase)
+	if err := fileutil.WriteFile(output, out, r.writeOptions()); r.reportSkipped(err, output) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	timings.Since(common.PhaseWrite, phase)
+
+	stats := common.CompressionStats{
+		OriginalSize:   int64(len(data)),
+		CompressedSize: int64(len(out)),
+		Algorithm:      used,
+		Duration:       time.Since(start),
+		Source:         input,
+		TargetRatio:    r.TargetRatio,
+		TargetNotMet:   !met,
+		Timings:        timings,
+	}
+	stats.CalculateRatio()
+	if r.StatsLog != "" {
+		sum := sha256.Sum256(data)
+		r.recordStats(history.OpCompress, input, hex.EncodeToString(sum[:]), algorithm, stats)
+	}
+
+	switch {
+	case r.JSON:
+		return r.printStatsJSON(stats)
+	case r.Verbose:
+		common.FprintCompressionStats(r.Out, stats)
+	case used == common.StoredAlgorithm:
+		fmt.Fprintf(r.Out, "⚠️  目標未達: 圧縮率 %.2f%% 以下にならないため、元のデータをそのまま書き込みました: %s -> %s\n",
+			r.TargetRatio*100, input, output)
+	default:
+		fmt.Fprintf(r.Out, "✅ 圧縮完了: %s -> %s (%s)\n", input, output, used)
+		fmt.Fprintf(r.Out, "圧縮率: %.2f%% (目標 %.2f%%)\n", stats.Ratio*100, r.TargetRatio*100)
+	}
+	return nil
+}
+
+// oversizedSampleSize は大きな入力で -algo auto のアルゴリズムを選ぶときに調べる先頭のバイト数です
+const oversizedSampleSize = 1 << 20
+
+// oversizedInput は一度に圧縮できる上限を超えるため、ストリームで圧縮する入力です
+type oversizedInput struct {
+	head  []byte    // 入力の先頭（最大 oversizedSampleSize バイト、アルゴリズムの自動選択に使う）
+	stdin io.Reader // 標準入力の場合に、読み込んだ分を先頭に戻した Reader（ファイルの場合は In）
+}
+
+// readOneShotInput は入力全体を読み込みます
+// 入力が common.MaxOneShotSize を超える場合は、全体を読み込まずに oversizedInput を返します。
+// 標準入力は大きさが分からないため、上限の1バイト先まで読み込んで確かめます。
+func (r *Runner) readOneShotInput(input string) ([]byte, *oversizedInput, error) {
+	limit := common.MaxOneShotSize()
+	if limit <= 0 {
+		data, err := r.readInput(input)
+		return data, nil, err
+	}
+
+	if input != "-" {
+		info, err := os.Stat(input)
+		if err != nil || info.Size() <= limit {
+			data, err := r.readInput(input)
+			return data, nil, err
+		}
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		defer f.Close()
+		head, err := io.ReadAll(io.LimitReader(f, oversizedSampleSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		return nil, &oversizedInput{head: head, stdin: r.In}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.In, limit+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	if int64(len(data)) <= limit {
+		return data, nil, nil
+	}
+	return nil, &oversizedInput{
+		head:  data[:min(len(data), oversizedSampleSize)],
+		stdin: io.MultiReader(bytes.NewReader(data), r.In),
+	}, nil
+}
+
+// compressOversized は一度に圧縮できる上限を超える入力を、-target-ratio の代わりにストリームで圧縮します
+// 元のデータをそのまま格納するかは圧縮する前に決められないため、目標は圧縮後に確認するだけです。
+// compressor が nil の場合（-algo auto）は、入力の先頭から推奨されるアルゴリズムを使います。
+// 暗黙の選択のため、Strict の場合はエラーにします。
+func (r *Runner) compressOversized(compressor common.Compressor, input, output string, in *oversizedInput) error {
+	limit := common.FormatBytes(common.MaxOneShotSize())
+	if err := r.policy().Refuse("input exceeds the one-shot limit of "+limit+" and would be compressed as a stream without -target-ratio", "compress without -target-ratio"); err != nil {
+		return err
+	}
+	algorithm := r.algorithmName()
+	if compressor == nil {
+		algorithm = common.RecommendedOrder(in.head)[0]
+		c, err := common.New(algorithm)
+		if err != nil {
+			return fmt.Errorf("未対応のアルゴリズム: %s", algorithm)
+		}
+		compressor = c
+	}
+	fmt.Fprintf(r.Err, "⚠️  入力が一度に圧縮できる上限（%s）を超えるため、%s でストリームで圧縮します（-target-ratio は圧縮後に確認します）: %s\n",
+		limit, algorithm, input)
+	return r.compressFile(compressor, algorithm, input, output, in.stdin)
+}
+
+// Append は入力を圧縮し、.tzzコンテナのメンバーとして出力ファイルに追記します
+func (r *Runner) Append(input, output string) error {
+	if output == "" {
+		return errors.New("-append は -o を指定して使用してください")
+	}
+	compressor, err := r.compressor()
+	if err != nil {
+		return err
+	}
+	data, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+	r.printInputInfo(input, data)
+
+	member, err := container.EncodeMember(r.algorithmName(), compressor, data)
+	if errors.Is(err, common.ErrInputTooLarge) {
+		return fmt.Errorf("圧縮エラー: %w\n-append は入力全体を1つのメンバーにするため、大きな入力は -append を付けずに圧縮してください", err)
+	} else if err != nil {
+		return fmt.Errorf("圧縮エラー: %w", err)
+	}
+	if err := container.AppendFile(output, member, r.writeOptions()); err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w", err)
+	}
+
+	fmt.Fprintf(r.Out, "✅ 追記完了: %s -> %s (%s -> %s)\n", input, output,
+		common.FormatBytes(int64(len(data))), common.FormatBytes(int64(len(member))))
+	if r.Verbose {
+		fmt.Fprintf(r.Out, "アルゴリズム: %s\n", compressor.Name())
+	}
+	return nil
+}
+
+// printStatsJSON は統計を1行のJSONで Out に書き込みます
+func (r *Runner) printStatsJSON(stats common.CompressionStats) error {
+	if err := json.NewEncoder(r.Out).Encode(stats); err != nil {
+		return fmt.Errorf("出力エラー: %w", err)
+	}
+	return nil
+}
+
+// printBlockInfo は出力ファイルの各メンバーのブロック構成を表示します
+func (r *Runner) printBlockInfo(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	members, err := container.Parse(data)
+	if err != nil {
+		return
+	}
+	for i, m := range members {
+		infos, err := blocks.Inspect(m.Body())
+		if err != nil {
+			continue
+		}
+		fmt.Fprintln(r.Out)
+		if len(members) > 1 {
+			fmt.Fprintf(r.Out, "メンバー %d:\n", i)
+		}
+		blocks.FprintBlockInfo(r.Out, infos)
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/archive"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// List は.tzzコンテナのメンバー、またはアーカイブ（.tza、.zip）のエントリを表示します
+func (r *Runner) List(input string) error {
+	ar, err := openArchive(input)
+	if err != nil {
+		return err
+	}
+	if ar != nil {
+		archive.FprintEntries(r.Out, ar)
+		return nil
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	defer f.Close()
+
+	result, err := container.Scan(f)
+	if err != nil {
+		return fmt.Errorf("コンテナ読み込みエラー: %w%s", err, newerVersionHint(err))
+	}
+	container.FprintMembers(r.Out, result.Members)
+	if result.Truncated {
+		fmt.Fprintf(r.Out, "⚠️  オフセット %d 以降に不完全なメンバーがあります（-repair で切り詰められます）\n", result.ValidSize)
+	}
+	return nil
+}
+
+// Repair は.tzzコンテナの末尾の不完全なメンバーを切り詰めます
+func (r *Runner) Repair(input string) error {
+	result, removed, err := container.RepairFile(input)
+	if err != nil {
+		return fmt.Errorf("修復エラー: %w", err)
+	}
+	if removed == 0 {
+		fmt.Fprintf(r.Out, "✅ 修復不要: %d メンバーはすべて完全です\n", len(result.Members))
+		return nil
+	}
+	fmt.Fprintf(r.Out, "✅ 修復完了: 不完全なメンバー (%d bytes) を切り詰めました。%d メンバーが残っています\n",
+		removed, len(result.Members))
+	return nil
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// ParseCopy は copy サブコマンドの引数（"copy" を除く）を解釈します
+// copy -c <元のディレクトリ> <出力先> は各ファイルを.tzzコンテナに圧縮し、
+// copy -d は逆に展開します。エラーの扱いは Parse と同じです。
+func ParseCopy(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name+" copy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	compress, decompress := defineCopyFlags(fs, &cmd)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s copy -c [オプション] <元のディレクトリ> <出力先>\n", name)
+		fmt.Fprintf(stderr, "  %s copy -d [オプション] <元のディレクトリ> <出力先>\n\n", name)
+		fmt.Fprintf(stderr, "オプション:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	suffixSet := false
+	fs.Visit(func(f *flag.Flag) { suffixSet = suffixSet || f.Name == "suffix" })
+	usageError := func(msg string) (*Command, error) {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", msg)
+		fs.Usage()
+		return nil, ErrUsage
+	}
+
+	switch {
+	case *compress == *decompress:
+		return usageError("-c か -d のどちらかを指定してください")
+	case fs.NArg() != 2:
+		return usageError("元のディレクトリと出力先を指定してください")
+	case suffixSet && (cmd.Suffix == "" || strings.ContainsAny(cmd.Suffix, `/\`)):
+		return usageError("-suffix にはディレクトリの区切りを含まない拡張子を指定してください")
+	case cmd.Parallel < 1:
+		return usageError("-p は1以上を指定してください")
+	case cmd.Force && cmd.NoClobber:
+		return usageError("-f と -n は併用できません")
+	}
+	cmd.Mode = ModeCopy
+	if *decompress {
+		cmd.Mode = ModeCopyDecompress
+	}
+	cmd.Inputs = []string{fs.Arg(0)}
+	cmd.Output = fs.Arg(1)
+	return &cmd, nil
+}
+
+// defineCopyFlags は ParseCopy のフラグを fs に定義し、-c と -d のフラグを返します
+func defineCopyFlags(fs *flag.FlagSet, cmd *Command) (compress, decompress *bool) {
+	compress = fs.Bool("c", false, "各ファイルを圧縮してコピー")
+	decompress = fs.Bool("d", false, "圧縮ファイルの拡張子（-suffix）の付いた各ファイルを展開してコピー")
+	fs.StringVar(&cmd.Algorithm, "algo", "rle", "圧縮アルゴリズム ("+strings.Join(common.Names(), ", ")+")")
+	fs.StringVar(&cmd.Suffix, "suffix", "", "圧縮したファイルの拡張子（-c で付け、-d で除く）。省略時は -c でアルゴリズムの拡張子を付け、-d で既知の拡張子を除く")
+	fs.IntVar(&cmd.Parallel, "p", runtime.GOMAXPROCS(0), "同時に処理するファイルの数")
+	fs.BoolVar(&cmd.Force, "f", false, "出力先が新しいファイルも含めてすべて処理し直す")
+	fs.BoolVar(&cmd.NoClobber, "n", false, "出力先に既にあるファイルは古くても書き換えない")
+	fs.StringVar(&cmd.MemLimit, "mem-limit", "", "-d の各ファイルのメモリ予算 (例: 256M)")
+	fs.StringVar(&cmd.MaxOutput, "max-output", "", "-d の各ファイルの最大サイズ (例: 1G)")
+	fs.BoolVar(&cmd.Verbose, "v", false, "処理したファイルを表示")
+	return compress, decompress
+}
+
+// copyTask は copy で処理する1つのファイルです
+type copyTask struct {
+	rel  string      // 元のディレクトリからの相対パス
+	src  string      // 元のファイル
+	dst  string      // 出力先のファイル
+	info fs.FileInfo // 元のファイルの情報
+}
+
+// copyResult は1つのファイルを処理した結果です
+type copyResult struct {
+	copied  bool // 圧縮（展開）して書き込んだ
+	skipped bool // 出力先が最新のため書き込まなかった
+	err     error
+}
+
+// Copy は src のディレクトリのファイルを、同じ構成で dst のディレクトリにコピーします
+// decompress が false の場合は各ファイルを.tzzコンテナに圧縮して Suffix を付け、true の場合は
+// Suffix の付いたファイルを展開して Suffix を除きます（付いていないファイルは無視します）。
+// Suffix が空の場合は Compress や Decompress で -o を省略した場合と同じく、圧縮ではアルゴリズムの
+// 拡張子（common.Extension）を付け、展開では既知の拡張子の付いたファイルから拡張子を除きます。
+// 出力先にはパーミッションと更新日時を元のファイルから写すため、出力先が既にあり、
+// 更新日時が元のファイル以降でサイズも一致する（.tzzコンテナのヘッダーの元のサイズで比べます）
+// ファイルは処理しません。-f の場合はすべて処理し、-n の場合は既にある出力先を書き換えません。
+// ファイルは Parallel の数だけ同時に処理し、一時ファイルに書き込んでから置き換えます。
+// 失敗したファイルは飛ばして残りを処理し、最後に数を表示して ExitError を返します。
+func (r *Runner) Copy(src, dst string, decompress bool) error {
+	// target は元のファイルの相対パスから出力先の相対パスを返します（対象外のファイルは false）
+	target := func(rel string) (string, bool) {
+		switch {
+		case !decompress && r.Suffix == "":
+			return r.defaultCompressOutput(rel), true
+		case !decompress:
+			return rel + r.Suffix, true
+		case r.Suffix == "":
+			return trimExtension(rel)
+		case !strings.HasSuffix(rel, r.Suffix) || rel == r.Suffix:
+			return "", false
+		}
+		return strings.TrimSuffix(rel, r.Suffix), true
+	}
+	if info, err := os.Stat(src); err != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s はディレクトリではありません", src)
+	}
+	if inside(src, dst) {
+		return fmt.Errorf("出力先 %s は %s の中には指定できません", dst, src)
+	}
+
+	process, err := r.copyFunc(decompress)
+	if err != nil {
+		return err
+	}
+
+	var tasks []copyTask
+	walkErr := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		out, ok := target(rel)
+		if !ok {
+			return nil
+		}
+		out = filepath.Join(dst, out)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, copyTask{rel: rel, src: path, dst: out, info: info})
+		return nil
+	})
+	if walkErr != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", walkErr)
+	}
+
+	workers := r.Parallel
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]copyResult, len(tasks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, max(len(tasks), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = r.copyFile(tasks[i], decompress, process)
+			}
+		}()
+	}
+	for i := range tasks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// 表示は walk の順にする
+	var copied, skipped, failed int
+	for i, res := range results {
+		switch {
+		case res.err != nil:
+			failed++
+			fmt.Fprintf(r.Err, "❌ %s: %v\n", tasks[i].rel, res.err)
+		case res.copied:
+			copied++
+			if r.Verbose {
+				fmt.Fprintf(r.Out, "  %s -> %s\n", tasks[i].src, tasks[i].dst)
+			}
+		case res.skipped:
+			skipped++
+		}
+	}
+	fmt.Fprintf(r.Out, "✅ コピー完了: %s -> %s\n", src, dst)
+	fmt.Fprintf(r.Out, "コピー: %d, スキップ: %d, 失敗: %d\n", copied, skipped, failed)
+	if failed > 0 {
+		return &ExitError{Code: 1, Msg: fmt.Sprintf("%d 個のファイルをコピーできませんでした（残りのファイルはコピー済み）", failed)}
+	}
+	return nil
+}
+
+// copyFunc は1つのファイルを圧縮（展開）して書き込む関数を作成します
+func (r *Runner) copyFunc(decompress bool) (func(src, dst string, opts container.FileOptions) error, error) {
+	if decompress {
+		limits, err := r.decompressOptions()
+		if err != nil {
+			return nil, err
+		}
+		return func(src, dst string, opts container.FileOptions) error {
+			opts.Decompress = limits
+			_, err := container.DecompressFile(src, dst, common.New, opts)
+			return err
+		}, nil
+	}
+	compressor, err := r.compressor()
+	if err != nil {
+		return nil, err
+	}
+	return func(src, dst string, opts container.FileOptions) error {
+		_, err := container.CompressFile(src, dst, compressor, opts)
+		return err
+	}, nil
+}
+
+// copyFile は出力先が最新でなければ t を処理し、パーミッションと更新日時を写します
+func (r *Runner) copyFile(t copyTask, decompress bool, process func(src, dst string, opts container.FileOptions) error) copyResult {
+	out, err := os.Stat(t.dst)
+	switch {
+	case err == nil && out.IsDir():
+		return copyResult{err: fmt.Errorf("%w: %s", fileutil.ErrIsDirectory, t.dst)}
+	case err == nil && r.NoClobber:
+		return copyResult{skipped: true}
+	case err == nil && !r.Force && upToDate(t, out, decompress):
+		return copyResult{skipped: true}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return copyResult{err: err}
+	}
+
+	opts := container.FileOptions{Algorithm: r.algorithmName(), MkdirAll: true, Overwrite: true}
+	if err := process(t.src, t.dst, opts); err != nil {
+		return copyResult{err: err}
+	}
+	if err := os.Chmod(t.dst, t.info.Mode().Perm()); err != nil {
+		return copyResult{err: err}
+	}
+	if err := os.Chtimes(t.dst, t.info.ModTime(), t.info.ModTime()); err != nil {
+		return copyResult{err: err}
+	}
+	return copyResult{copied: true}
+}
+
+// upToDate は出力先 out が t の元のファイル以降に更新され、サイズも一致するかを返します
+// サイズは.tzzコンテナ（-c では出力先、-d では元のファイル）のヘッダーに記録した元のサイズで比べます。
+func upToDate(t copyTask, out fs.FileInfo, decompress bool) bool {
+	if out.ModTime().Before(t.info.ModTime()) {
+		return false
+	}
+	if decompress {
+		size, ok := containerSize(t.src)
+		return ok && size == out.Size()
+	}
+	size, ok := containerSize(t.dst)
+	return ok && size == t.info.Size()
+}
+
+// containerSize は path の.tzzコンテナの全メンバーの元のサイズの合計を返します
+// コンテナでない場合や、末尾のメンバーが不完全な場合は false を返します。
+func containerSize(path string) (int64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	res, err := container.Scan(f)
+	if err != nil || res.Truncated {
+		return 0, false
+	}
+	var size int64
+	for _, h := range res.Members {
+		size += int64(h.OriginalSize)
+	}
+	return size, true
+}
+
+// inside は dst が src と同じか、その中のパスかを返します
+func inside(src, dst string) bool {
+	s, err1 := filepath.Abs(src)
+	d, err2 := filepath.Abs(dst)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(s, d)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
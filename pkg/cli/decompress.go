@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/history"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// Decompress は入力ファイルを展開します
+// .tzzコンテナのメンバーは記録されたアルゴリズムで、それ以外の入力は Algorithm で展開します。
+// output が空の場合は input から既知の圧縮ファイルの拡張子（.rle、.lz77、.tzz など）を除いた
+// ファイルに出力し、拡張子が既知でない場合は出力ファイル名を推測せずにエラーを返します。アーカイブ（.tza、.zip）の場合は output のディレクトリに展開します。
+// メンバーの展開結果のサイズが元のサイズと異なる場合はエラーですが、TolerateSize の場合は
+// 展開できた分を出力して差を Err に表示し、終了コード ExitRecovered の ExitError を返します。
+// StatsLog を指定した場合は、展開の結果（入力は圧縮ファイル）を統計ログに追記します。
+// Salvage の場合は、ブロックコンテナの展開できないブロックを SalvageFill で埋めて続け、
+// 埋めた範囲を Err に表示して（SalvageReport にはJSONで書き込み）、ExitRecovered の ExitError を返します。
+// 展開結果がまた .tzz コンテナの場合は、Recursive なら MaxDepth 層まで続けて展開し、
+// それでもコンテナのままなら Err に警告します。
+func (r *Runner) Decompress(input, output string) error {
+	ar, err := openArchive(input)
+	if err != nil {
+		return err
+	}
+	if ar != nil {
+		if err := r.policy().Refuse("the archive format was detected from the input", "omit -strict to extract .tza / .zip"); err != nil {
+			return err
+		}
+		if r.LimitRate != "" {
+			return errors.New("-limit-rate は .tza / .zip の展開には使えません")
+		}
+		if r.TolerateSize {
+			return errors.New("-tolerate-size-mismatch は .tza / .zip の展開には使えません")
+		}
+		if r.StatsLog != "" {
+			return errors.New("-stats-log は .tza / .zip の展開には使えません")
+		}
+		if r.Salvage {
+			return errors.New("-salvage は .tza / .zip の展開には使えません")
+		}
+		return r.extractArchive(ar, input, output)
+	}
+
+	if output == "" {
+		if output, err = defaultDecompressOutput(input); err != nil {
+			return err
+		}
+	}
+
+	compressor, err := r.compressor()
+	if err != nil {
+		return err
+	}
+	hasher, err := r.newStatsHasher(input)
+	if err != nil {
+		return err
+	}
+	opts := r.fileOptions()
+	opts.Stdin = hasher.wrap(opts.Stdin)
+	if opts.Decompress, err = r.decompressOptions(); err != nil {
+		return err
+	}
+	if opts.RateLimit, err = r.rateLimit(); err != nil {
+		return err
+	}
+	if r.Salvage {
+		if opts.Decompress.Fill, err = r.salvageFill(); err != nil {
+			return err
+		}
+		opts.Decompress.OnDamage = func(d common.DamagedBlock) error {
+			fmt.Fprintf(r.Err, "⚠️  メンバー %d ブロック %d: %d-%d bytes（%s）を埋めました: %s\n",
+				d.Member, d.Block, d.Offset, d.End(), common.FormatBytes(d.Length), d.Reason)
+			return nil
+		}
+	}
+
+	// Algorithm と同じアルゴリズムのメンバーには Dict や Filter などの設定も適用する
+	// Strict の場合は、メンバーに記録されたアルゴリズムが -algo と異なればエラーにする
+	resolve := func(name string) (common.Compressor, error) {
+		if name == opts.Algorithm {
+			return compressor, nil
+		}
+		if err := r.policy().Refuse("member was compressed with "+name+", not -algo "+opts.Algorithm, "specify -algo "+name); err != nil {
+			return nil, err
+		}
+		return common.New(name)
+	}
+
+	tracker, stop := r.startProgress(input, &opts)
+	stats, err := container.DecompressFile(input, output, resolve, opts)
+	stop()
+	if r.reportSkipped(err, output) {
+		return nil
+	}
+	if err != nil {
+		// -v では不正な箇所の周辺のバイトを16進数で表示する
+		var decodeErr *common.DecodeError
+		if r.Verbose && errors.As(err, &decodeErr) {
+			_, dump, _ := strings.Cut(decodeErr.String(), "\n")
+			return fmt.Errorf("展開エラー: %w\n%s", err, dump)
+		}
+		return fmt.Errorf("展開エラー: %w%s%s%s%s", err, newerVersionHint(err), rejectedOutputNote(err, output), sizeMismatchHint(err), existingHint(err))
+	}
+	if r.SalvageReport != "" {
+		if err := r.writeSalvageReport(input, output, stats); err != nil {
+			return err
+		}
+	}
+	r.recordStats(history.OpDecompress, input, hasher.Sum(), stats.Algorithm, stats)
+
+	fmt.Fprintf(r.Out, "✅ 展開完了: %s -> %s\n", input, output)
+	fmt.Fprintln(r.Out, tracker.Status().Summary())
+	if stats.Layers > 1 {
+		fmt.Fprintf(r.Out, "入れ子のコンテナ: %d 層を展開しました\n", stats.Layers)
+	}
+	switch {
+	case stats.Nested && r.Recursive:
+		fmt.Fprintf(r.Err, "⚠️  %d 層を展開しましたが、%s はまだ .tzz コンテナです（-max-depth で層の数を増やせます）\n", stats.Layers, output)
+	case stats.Nested:
+		fmt.Fprintf(r.Err, "⚠️  %s も .tzz コンテナです（2重に圧縮したファイル）。-recursive を指定すると続けて展開できます\n", output)
+	}
+
+	if r.Verbose {
+		fmt.Fprintf(r.Out, "アルゴリズム: %s\n", stats.Algorithm)
+		fmt.Fprintf(r.Out, "圧縮サイズ: %s (%d bytes)\n",
+			common.FormatBytes(stats.CompressedSize), stats.CompressedSize)
+		fmt.Fprintf(r.Out, "展開サイズ: %s (%d bytes)\n",
+			common.FormatBytes(stats.OriginalSize), stats.OriginalSize)
+		fmt.Fprintf(r.Out, "処理時間:   %v\n", stats.Duration.Round(time.Microsecond))
+	}
+	return r.reportRecovered(stats)
+}
+
+// sizeMismatchHint は展開結果のサイズが元のサイズと異なった場合に、それでも出力する方法を返します
+func sizeMismatchHint(err error) string {
+	var sizeErr *common.SizeError
+	if errors.As(err, &sizeErr) {
+		return "\n展開できた分を出力する場合は -tolerate-size-mismatch を指定してください"
+	}
+	return ""
+}
+
+// reportRecovered は -tolerate-size-mismatch で元のサイズと異なったメンバーを Err に表示し、
+// それらか -salvage で埋めたブロックがあれば ExitRecovered の ExitError を返します
+// （埋めたブロックは展開中に表示済みです）。
+func (r *Runner) reportRecovered(stats common.CompressionStats) error {
+	if !stats.Recovered() {
+		return nil
+	}
+	for _, m := range stats.SizeMismatches {
+		fmt.Fprintf(r.Err, "⚠️  メンバー %d: 元のサイズ %d bytes に対して %d bytes を展開しました（%+d bytes）\n",
+			m.Member, m.Expected, m.Actual, m.Delta())
+	}
+	var msgs []string
+	if n := len(stats.SizeMismatches); n > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d 個のメンバーが元のサイズと異なるまま出力しました（データの一部が欠けているか余分です）", n))
+	}
+	if n := len(stats.Damaged); n > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d 個の壊れたブロック（%s）を埋めて出力しました", n, common.FormatBytes(damagedBytes(stats.Damaged))))
+	}
+	return &ExitError{Code: ExitRecovered, Msg: "⚠️  " + strings.Join(msgs, "、")}
+}
+
+// salvageFill は SalvageFill の16進数を壊れたブロックを埋めるパターンに変換します（空は0）
+func (r *Runner) salvageFill() ([]byte, error) {
+	fill, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(r.SalvageFill), "0x"))
+	if err != nil || r.SalvageFill != "" && len(fill) == 0 {
+		return nil, fmt.Errorf("オプションエラー: -salvage-fill は16進数で指定してください（例: ff, deadbeef）: %q", r.SalvageFill)
+	}
+	return fill, nil
+}
+
+// salvageReport は -salvage-report に書き込む、埋めたブロックの一覧です
+type salvageReport struct {
+	Input        string                `json:"input"`
+	Output       string                `json:"output"`
+	OutputSize   int64                 `json:"output_size"`   // 出力した展開結果のサイズ
+	DamagedBytes int64                 `json:"damaged_bytes"` // 埋めたバイト数の合計
+	Damaged      []common.DamagedBlock `json:"damaged"`       // 埋めたブロック（展開結果の中での位置の順）
+}
+
+// writeSalvageReport は埋めたブロックの一覧を SalvageReport にJSONで書き込みます（なければ空の一覧）
+func (r *Runner) writeSalvageReport(input, output string, stats common.CompressionStats) error {
+	report := salvageReport{
+		Input:        input,
+		Output:       output,
+		OutputSize:   stats.OriginalSize,
+		DamagedBytes: damagedBytes(stats.Damaged),
+		Damaged:      stats.Damaged,
+	}
+	if report.Damaged == nil {
+		report.Damaged = []common.DamagedBlock{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON出力エラー: %w", err)
+	}
+	if err := fileutil.WriteFile(r.SalvageReport, append(data, '\n'), r.writeOptions()); r.reportSkipped(err, r.SalvageReport) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+	return nil
+}
+
+// damagedBytes は埋めたバイト数の合計を返します
+func damagedBytes(damaged []common.DamagedBlock) int64 {
+	var n int64
+	for _, d := range damaged {
+		n += d.Length
+	}
+	return n
+}
+
+// rejectedOutputNote はチェックサムやサイズの確認に失敗した場合に、出力ファイルを
+// 書き込まなかったことを伝える一文を返します
+func rejectedOutputNote(err error, output string) string {
+	if errors.Is(err, container.ErrChecksum) || errors.Is(err, common.ErrCorrupted) {
+		return fmt.Sprintf("\n検証に失敗したため %s は書き込まれていません", output)
+	}
+	return ""
+}
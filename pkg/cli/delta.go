@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/delta"
+)
+
+// Delta は古いファイル ref から input への差分（パッチ）を output に書き込みます
+func (r *Runner) Delta(ref, input, output string) error {
+	if output == "" {
+		output = input + ".patch"
+	}
+	old, err := os.ReadFile(ref)
+	if err != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	data, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+
+	patch, err := delta.Diff(old, data)
+	if err != nil {
+		return fmt.Errorf("差分エラー: %w", err)
+	}
+	err = fileutil.WriteFile(output, patch, r.writeOptions())
+	if r.reportSkipped(err, output) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+
+	fmt.Fprintf(r.Out, "✅ パッチ作成: %s -> %s (%s)\n", input, output, common.FormatBytes(int64(len(patch))))
+	if r.Verbose {
+		stats, _ := delta.Inspect(patch)
+		fmt.Fprintf(r.Out, "コピー: %d 回 (%d bytes)\n", stats.Copies, stats.CopiedBytes)
+		fmt.Fprintf(r.Out, "挿入:   %d 回 (%d bytes)\n", stats.Inserts, stats.InsertedBytes)
+	}
+	return nil
+}
+
+// ApplyPatch は古いファイル ref に input のパッチを適用し、新しいファイルを output に書き込みます
+func (r *Runner) ApplyPatch(ref, input, output string) error {
+	if output == "" {
+		if ext := filepath.Ext(input); ext == ".patch" {
+			output = strings.TrimSuffix(input, ext)
+		} else {
+			output = input + ".patched"
+		}
+	}
+	old, err := os.ReadFile(ref)
+	if err != nil {
+		return fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	patch, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+
+	data, err := delta.Apply(old, patch)
+	if errors.Is(err, delta.ErrBaseMismatch) {
+		return fmt.Errorf("パッチ適用エラー: %w\n-ref にはパッチを作成したときの古いファイルを指定してください", err)
+	} else if err != nil {
+		return fmt.Errorf("パッチ適用エラー: %w%s", err, newerVersionHint(err))
+	}
+	err = fileutil.WriteFile(output, data, r.writeOptions())
+	if r.reportSkipped(err, output) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w%s", err, existingHint(err))
+	}
+
+	fmt.Fprintf(r.Out, "✅ パッチ適用: %s + %s -> %s (%s)\n", ref, input, output, common.FormatBytes(int64(len(data))))
+	return nil
+}
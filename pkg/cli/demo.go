@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/demo"
+)
+
+const (
+	// maxDemoInput はデモモードの入力の最大サイズです
+	// 1ステップずつ見る用途なので、授業で扱う小さな入力だけを受け付けます。
+	maxDemoInput = 4096
+
+	// demoInterval はデモモードの自動再生でステップを進める間隔です
+	demoInterval = 500 * time.Millisecond
+)
+
+// Demo は入力を Algorithm で圧縮する様子を、端末に1ステップずつ表示します
+// 圧縮のトレース（common.Tracer）のイベントを集めてから、demo.Play で In から読んだ
+// キーに合わせて表示します。In が端末の場合は stty で1文字ずつ読めるようにします。
+func (r *Runner) Demo(input string) error {
+	data, err := r.readInput(input)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxDemoInput {
+		return fmt.Errorf("-demo の入力は %s までです（%s）", common.FormatBytes(maxDemoInput), common.FormatBytes(int64(len(data))))
+	}
+
+	compressor, err := common.New(r.algorithmName())
+	if err != nil {
+		return fmt.Errorf("未対応のアルゴリズム: %s", r.Algorithm)
+	}
+	var events []any
+	traced, ok := common.WithTracer(compressor, common.TracerFunc(func(event any) {
+		events = append(events, event)
+	}))
+	if !ok {
+		return errDemoAlgorithm
+	}
+	if _, err := traced.Compress(data); err != nil {
+		return fmt.Errorf("圧縮エラー: %w", err)
+	}
+	if len(events) == 0 {
+		return errors.New("-demo の入力が空です")
+	}
+	if !demo.Supports(events[0]) {
+		return errDemoAlgorithm
+	}
+
+	if f, ok := r.In.(*os.File); ok {
+		defer cbreak(f)()
+	}
+	return demo.Play(r.In, r.Out, demo.NewRenderer(data, 0), events, demoInterval)
+}
+
+var errDemoAlgorithm = errors.New("-demo は -algo rle, lz77 でのみ使用できます")
+
+// cbreak は f が端末なら stty でキーを Enter なしで1文字ずつ読めるようにし（エコーなし）、
+// 元の設定に戻す関数を返します。端末でない場合や stty がない場合は何もしません。
+func cbreak(f *os.File) func() {
+	noop := func() {}
+	if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return noop
+	}
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return noop
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return noop
+	}
+	return func() { stty(saved) }
+}
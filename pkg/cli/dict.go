@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/dict"
+)
+
+// defaultDictSize は dict train で作成する辞書のデフォルトの最大サイズです
+const defaultDictSize = 4096
+
+// ParseDict は dict サブコマンドの引数（"dict" を除く）を解釈します
+// dict train -i <サンプルのディレクトリ> -o <辞書> [-size N] はサンプルから LZ77 のプリセット辞書を学習し、
+// dict inspect <辞書>（または -i <辞書>）は辞書の統計を表示します。エラーの扱いは Parse と同じです。
+func ParseDict(name string, args []string, stderr io.Writer) (*Command, error) {
+	usage := func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s dict train -i <サンプルのディレクトリ> -o <辞書> [オプション]\n", name)
+		fmt.Fprintf(stderr, "  %s dict inspect <辞書>\n", name)
+	}
+	if len(args) == 0 || (args[0] != "train" && args[0] != "inspect") {
+		switch {
+		case len(args) == 0:
+			fmt.Fprintf(stderr, "エラー: %s\n\n", "train か inspect を指定してください")
+		case args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+			usage()
+			return nil, flag.ErrHelp
+		default:
+			fmt.Fprintf(stderr, "エラー: 不明な dict サブコマンドです: %s\n\n", args[0])
+		}
+		usage()
+		return nil, ErrUsage
+	}
+
+	sub := args[0]
+	fs := flag.NewFlagSet(name+" dict "+sub, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	var input *string
+	if sub == "train" {
+		input = defineDictTrainFlags(fs, &cmd)
+	} else {
+		input = defineDictInspectFlags(fs)
+	}
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(stderr, "\nオプション:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	usageError := func(msg string) (*Command, error) {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", msg)
+		fs.Usage()
+		return nil, ErrUsage
+	}
+
+	if sub == "train" {
+		switch {
+		case *input == "" || cmd.Output == "" || fs.NArg() > 0:
+			return usageError("-i と -o を指定してください")
+		case cmd.DictSize < 1:
+			return usageError("-size は1以上を指定してください")
+		}
+		cmd.Mode = ModeDictTrain
+		cmd.Inputs = []string{*input}
+		return &cmd, nil
+	}
+
+	path := *input
+	if path == "" && fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+	if path == "" || fs.NArg() > 1 || (*input != "" && fs.NArg() > 0) {
+		return usageError("辞書ファイルを1つ指定してください")
+	}
+	cmd.Mode = ModeDictInspect
+	cmd.Inputs = []string{path}
+	return &cmd, nil
+}
+
+// defineDictTrainFlags は dict train のフラグを fs に定義し、-i のフラグを返します
+func defineDictTrainFlags(fs *flag.FlagSet, cmd *Command) (input *string) {
+	input = fs.String("i", "", "サンプルファイルのディレクトリ")
+	fs.StringVar(&cmd.Output, "o", "", "出力する辞書ファイル")
+	fs.IntVar(&cmd.DictSize, "size", defaultDictSize, "辞書の最大サイズ (bytes)")
+	fs.BoolVar(&cmd.Mkdir, "mkdir", false, "出力先の親ディレクトリが存在しない場合に作成")
+	return input
+}
+
+// defineDictInspectFlags は dict inspect のフラグを fs に定義し、-i のフラグを返します
+func defineDictInspectFlags(fs *flag.FlagSet) (input *string) {
+	return fs.String("i", "", "辞書ファイル（引数でも指定できる）")
+}
+
+// DictTrain は input のディレクトリの通常ファイルをサンプルとして、最大 DictSize バイトの
+// LZ77 のプリセット辞書を学習し、output に書き込みます（既存のファイルは上書きします）
+func (r *Runner) DictTrain(input, output string) error {
+	samples, err := readSamples(input)
+	if err != nil {
+		return fmt.Errorf("サンプル読み込みエラー: %w", err)
+	}
+	size := r.DictSize
+	if size <= 0 {
+		size = defaultDictSize
+	}
+	content, err := dict.Train(samples, size)
+	if err != nil {
+		return fmt.Errorf("辞書学習エラー: %w", err)
+	}
+	encoded, err := dict.New(content).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("辞書作成エラー: %w", err)
+	}
+	if err := fileutil.WriteFile(output, encoded, fileutil.Options{MkdirAll: r.Mkdir, Overwrite: true}); err != nil {
+		return fmt.Errorf("ファイル書き込みエラー: %w", err)
+	}
+
+	fmt.Fprintf(r.Out, "✅ 辞書作成完了: %d サンプル -> %s (%s)\n",
+		len(samples), output, common.FormatBytes(int64(len(content))))
+	return nil
+}
+
+// DictInspect は path の辞書の統計を表示します
+func (r *Runner) DictInspect(path string) error {
+	d, err := dict.Load(path)
+	if err != nil {
+		return fmt.Errorf("辞書読み込みエラー: %w", err)
+	}
+	dict.FprintStats(r.Out, d.Inspect())
+	return nil
+}
+
+// readSamples はディレクトリ内の通常ファイルをすべて読み込みます
+func readSamples(dir string) ([][]byte, error) {
+	var samples [][]byte
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, data)
+		return nil
+	})
+	return samples, err
+}
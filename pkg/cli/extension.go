@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// legacyExtension は以前のバージョンが -o を省略した圧縮の出力に付けていた拡張子です
+// 既存のファイルを展開できるよう、展開では引き続き既知の拡張子として除きます。
+const legacyExtension = ".compressed"
+
+// defaultCompressOutput は -o を省略した圧縮の出力ファイル名（input にアルゴリズムの拡張子を付けたもの）を返します
+// 拡張子は common.Extension で、拡張子を宣言していないアルゴリズムや -algo auto は .tzz です。
+func (r *Runner) defaultCompressOutput(input string) string {
+	return input + common.Extension(r.algorithmName())
+}
+
+// trimExtension は path から既知の圧縮ファイルの拡張子（common.Extensions と legacyExtension）を除きます
+// 拡張子がない場合や既知でない場合、拡張子だけの名前（".lz77" など）の場合は false を返します。
+func trimExtension(path string) (string, bool) {
+	ext := filepath.Ext(path)
+	if ext == "" || ext == filepath.Base(path) {
+		return "", false
+	}
+	if ext != legacyExtension && !slices.Contains(common.Extensions(), ext) {
+		return "", false
+	}
+	return strings.TrimSuffix(path, ext), true
+}
+
+// defaultDecompressOutput は -o を省略した展開の出力ファイル名（input から既知の拡張子を除いたもの）を返します
+// 拡張子から出力ファイル名を決められない場合は、推測せずにエラーを返します。
+func defaultDecompressOutput(input string) (string, error) {
+	output, ok := trimExtension(input)
+	if !ok {
+		return "", fmt.Errorf("%s の拡張子は圧縮ファイルの拡張子（%s）ではないため、出力ファイル名を決められません。-o で指定してください",
+			input, strings.Join(append(common.Extensions(), legacyExtension), ", "))
+	}
+	return output, nil
+}
@@ -0,0 +1,392 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// Mode はコマンドラインで指定されたモードです
+type Mode int
+
+const (
+	ModeVersion        Mode = iota // -version
+	ModeCompress                   // -c
+	ModeAppend                     // -c -append
+	ModeDecompress                 // -d
+	ModeAnalyze                    // -a
+	ModeCompare                    // -compare
+	ModeList                       // -list
+	ModeRepair                     // -repair
+	ModeReport                     // -report
+	ModeDelta                      // -delta
+	ModeApply                      // -apply
+	ModeDemo                       // -demo
+	ModeBench                      // -bench
+	ModeCopy                       // copy -c（ParseCopy）
+	ModeCopyDecompress             // copy -d（ParseCopy）
+	ModeInfo                       // info（ParseInfo）
+	ModeServe                      // serve（ParseServe）
+	ModeCompletion                 // completion（ParseCompletion）
+	ModeHistory                    // history（ParseHistory）
+	ModeDictTrain                  // dict train（ParseDict）
+	ModeDictInspect                // dict inspect（ParseDict）
+)
+
+// Command は解釈したコマンドライン引数です
+type Command struct {
+	Mode       Mode
+	Inputs     []string // 入力ファイル（-compare 以外は1つ、-bench では使わない、copy では元のディレクトリ）
+	Output     string   // 出力ファイル（-o、copy では出力先のディレクトリ）
+	ReportPath string   // レポートの出力ファイル（-report）
+	RefPath    string   // 差分の古いファイル（-ref）
+	Corpus     string   // ベンチマークのコーパス名（-corpus、カンマ区切り）
+	Addr       string   // Web UIの待ち受けアドレス（serve の -host と -p）
+	Shell      string   // 補完スクリプトのシェル（completion）
+	Program    string   // 補完するコマンド名（completion）
+	Options
+}
+
+// ErrUsage はコマンドライン引数が正しくないことを表します
+// Parse はエラーの内容と使用方法を表示してから返します。
+var ErrUsage = errors.New("cli: invalid usage")
+
+// Parse はコマンドライン引数を解釈します
+// name はコマンド名（使用方法の表示に使用）で、args には name を含めません。
+// -h の場合は flag.ErrHelp を、引数が正しくない場合は ErrUsage（フラグの解析エラーは
+// そのエラー）を返します。どちらの場合も使用方法を stderr に表示します。
+func Parse(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	f := defineMainFlags(fs, &cmd)
+	fs.Usage = func() { printUsage(stderr, name, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	usageError := func(msg string) (*Command, error) {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", msg)
+		fs.Usage()
+		return nil, ErrUsage
+	}
+
+	if *f.showVersion {
+		cmd.Mode = ModeVersion
+		return &cmd, nil
+	}
+
+	// 比較モードでは -i に加えて引数で複数のファイルを指定できる
+	if *f.input != "" {
+		cmd.Inputs = append(cmd.Inputs, *f.input)
+	}
+	if *f.compareAll {
+		cmd.Inputs = append(cmd.Inputs, fs.Args()...)
+	}
+	switch {
+	case *f.bench && (cmd.Corpus == "" || len(cmd.Inputs) > 0):
+		return usageError("-bench は -corpus でコーパスを指定してください（-i は使用できません）")
+	case !*f.bench && (cmd.Corpus != "" || cmd.Offline):
+		return usageError("-corpus と -offline は -bench と指定してください")
+	case !*f.bench && len(cmd.Inputs) == 0:
+		return usageError("入力ファイルが指定されていません")
+	}
+
+	// モードの確認
+	modes := 0
+	for _, m := range []struct {
+		set  bool
+		mode Mode
+	}{
+		{*f.compress, ModeCompress},
+		{*f.decompress, ModeDecompress},
+		{*f.analyze, ModeAnalyze},
+		{*f.compareAll, ModeCompare},
+		{*f.list, ModeList},
+		{*f.repair, ModeRepair},
+		{cmd.ReportPath != "", ModeReport},
+		{*f.deltaMode, ModeDelta},
+		{*f.applyMode, ModeApply},
+		{*f.demoMode, ModeDemo},
+		{*f.bench, ModeBench},
+	} {
+		if m.set {
+			cmd.Mode = m.mode
+			modes++
+		}
+	}
+	switch {
+	case modes == 0:
+		return usageError("モード(-c, -d, -a, -compare, -list, -repair, -report, -delta, -apply, -demo, -bench)を指定してください")
+	case modes > 1:
+		return usageError("複数のモードは同時に指定できません")
+	case *f.appendMode && (!*f.compress || cmd.Output == ""):
+		return usageError("-append は -c と -o を指定して使用してください")
+	case cmd.TemplatePath != "" && cmd.Mode != ModeReport:
+		return usageError("-template は -report と指定してください")
+	case cmd.TargetRatio != 0 && (!*f.compress || *f.appendMode || cmd.TargetRatio < 0):
+		return usageError("-target-ratio は -c と正の値で指定してください（-append とは併用できません）")
+	case cmd.Format != formatTzz && !isArchiveFormat(cmd.Format):
+		return usageError("-format は tzz, tza, zip のいずれかを指定してください")
+	case isArchiveFormat(cmd.Format) && (!*f.compress || *f.appendMode):
+		return usageError("-format " + cmd.Format + " は -c と指定してください（-append とは併用できません）")
+	case cmd.Parallel < 1:
+		return usageError("-p は1以上を指定してください")
+	case cmd.FailFast && !isArchiveFormat(cmd.Format):
+		return usageError("-fail-fast は -c -format tza / zip と指定してください")
+	case (cmd.Include != "" || cmd.Exclude != "" || cmd.MaxFileSize != "") && !isArchiveFormat(cmd.Format):
+		return usageError("-include, -exclude, -max-file-size は -c -format tza / zip と指定してください")
+	case cmd.Special != specialSkip && cmd.Special != specialError:
+		return usageError("-special は skip か error を指定してください")
+	case (cmd.FollowSymlinks || cmd.AllowExternal) && !isArchiveFormat(cmd.Format):
+		return usageError("-follow-symlinks と -allow-external-targets は -c -format tza / zip と指定してください")
+	case cmd.AllowExternal && !cmd.FollowSymlinks:
+		return usageError("-allow-external-targets は -follow-symlinks と指定してください")
+	case cmd.Symlinks != symlinksSkip && cmd.Symlinks != symlinksInternal && cmd.Symlinks != symlinksAll:
+		return usageError("-symlinks は skip, internal, all のいずれかを指定してください")
+	case cmd.Reproducible && !isArchiveFormat(cmd.Format):
+		return usageError("-reproducible は -c -format tza / zip と指定してください")
+	case cmd.TracePath != "" && (!*f.compress || *f.appendMode):
+		return usageError("-trace は -c と指定してください（-append とは併用できません）")
+	case (cmd.Mode == ModeDelta || cmd.Mode == ModeApply) != (cmd.RefPath != ""):
+		return usageError("-delta と -apply は -ref で古いファイルを指定してください（-ref はこの2つのモード専用です）")
+	case cmd.LimitRate != "" && (!(*f.compress || *f.decompress) || *f.appendMode || cmd.TargetRatio != 0 || isArchiveFormat(cmd.Format)):
+		return usageError("-limit-rate は -c か -d と指定してください（-append, -target-ratio, -format tza / zip とは併用できません）")
+	case cmd.Force && (cmd.NoClobber || cmd.SkipExisting):
+		return usageError("-f は -n, -skip-existing とは併用できません")
+	case cmd.VerifyExisting && !cmd.NoClobber:
+		return usageError("-verify-existing は -n と指定してください")
+	case cmd.TolerateSize && !*f.decompress:
+		return usageError("-tolerate-size-mismatch は -d と指定してください")
+	case cmd.Salvage && !*f.decompress:
+		return usageError("-salvage は -d と指定してください")
+	case (cmd.SalvageFill != "" || cmd.SalvageReport != "") && !cmd.Salvage:
+		return usageError("-salvage-fill と -salvage-report は -salvage と指定してください")
+	case cmd.AllowRecompress && (!*f.compress || *f.appendMode || isArchiveFormat(cmd.Format)):
+		return usageError("-allow-recompress は -c と指定してください（-append, -format tza / zip とは併用できません）")
+	case cmd.Recursive && !*f.decompress:
+		return usageError("-recursive は -d と指定してください")
+	case cmd.MaxDepth < 1:
+		return usageError("-max-depth は1以上を指定してください")
+	case cmd.StatsLog != "" && (!(*f.compress || *f.decompress) || *f.appendMode || isArchiveFormat(cmd.Format)):
+		return usageError("-stats-log は -c か -d と指定してください（-append, -format tza / zip とは併用できません）")
+	}
+	if cmd.Reproducible {
+		epoch, err := sourceDateEpoch(os.Getenv("SOURCE_DATE_EPOCH"))
+		if err != nil {
+			return usageError(err.Error())
+		}
+		cmd.SourceDateEpoch = epoch
+	}
+	if *f.appendMode {
+		cmd.Mode = ModeAppend
+	}
+	return &cmd, nil
+}
+
+// mainFlags は Parse のモードと入力のフラグです（ほかのフラグの値は Command に格納します）
+type mainFlags struct {
+	compress    *bool
+	decompress  *bool
+	analyze     *bool
+	list        *bool
+	repair      *bool
+	appendMode  *bool
+	compareAll  *bool
+	deltaMode   *bool
+	applyMode   *bool
+	demoMode    *bool
+	bench       *bool
+	input       *string
+	showVersion *bool
+}
+
+// defineMainFlags は Parse のフラグを fs に定義し、値を cmd に格納するようにします
+// 補完スクリプトの生成（completionModel）も同じ定義からフラグの一覧を作ります。
+func defineMainFlags(fs *flag.FlagSet, cmd *Command) *mainFlags {
+	f := &mainFlags{
+		compress:    fs.Bool("c", false, "圧縮モード"),
+		decompress:  fs.Bool("d", false, "展開モード"),
+		analyze:     fs.Bool("a", false, "分析モード"),
+		list:        fs.Bool("list", false, "一覧モード（.tzzコンテナのメンバー、.tza / .zip のエントリを表示）"),
+		repair:      fs.Bool("repair", false, "修復モード（.tzzコンテナの末尾の不完全なメンバーを切り詰める）"),
+		appendMode:  fs.Bool("append", false, "圧縮結果を.tzzコンテナのメンバーとして出力ファイルに追記"),
+		compareAll:  fs.Bool("compare", false, "比較モード（登録済みの全アルゴリズムで圧縮・展開・検証）"),
+		deltaMode:   fs.Bool("delta", false, "差分モード（-ref の古いファイルから入力ファイルへのパッチを作成）"),
+		applyMode:   fs.Bool("apply", false, "パッチ適用モード（-ref の古いファイルに入力ファイルのパッチを適用）"),
+		demoMode:    fs.Bool("demo", false, "デモモード（圧縮の様子を端末に1ステップずつ表示、-algo rle, lz77、入力は4KBまで）"),
+		bench:       fs.Bool("bench", false, "ベンチマークモード（-corpus の公開コーパスを全アルゴリズムで比較）"),
+		input:       fs.String("i", "", "入力ファイル（- で標準入力）"),
+		showVersion: fs.Bool("version", false, "バージョン、アルゴリズムと組み込まれている機能を表示（-json でJSON）"),
+	}
+	fs.StringVar(&cmd.Algorithm, "algo", "rle", "圧縮アルゴリズム ("+strings.Join(common.Names(), ", ")+")")
+	fs.BoolVar(&cmd.CSV, "csv", false, "比較モードの結果をCSVで標準出力に出力")
+	fs.StringVar(&cmd.CSVFile, "csv-file", "", "比較モードの結果をCSVファイルに出力")
+	fs.BoolVar(&cmd.NoVerify, "no-verify", false, "分析・比較モードで展開結果の検証を省略")
+	fs.StringVar(&cmd.Output, "o", "", "出力ファイル")
+	fs.BoolVar(&cmd.Verbose, "v", false, "詳細出力")
+	fs.BoolVar(&cmd.Adaptive, "adaptive", false, "ブロックごとに圧縮/無圧縮を選択するブロックコンテナを使用（展開時も指定）")
+	fs.StringVar(&cmd.DictPath, "dict", "", "LZ77のプリセット辞書ファイル（圧縮・展開で同じものを指定）")
+	fs.StringVar(&cmd.MemLimit, "mem-limit", "", "展開時のメモリ予算 (例: 256M)")
+	fs.StringVar(&cmd.MaxOutput, "max-output", "", "展開結果の最大サイズ (例: 1G)")
+	fs.StringVar(&cmd.LimitRate, "limit-rate", "", "圧縮・展開で入力を読み込む速度の上限（1秒あたり、例: 10M）。制限中は途中経過を定期的に表示")
+	fs.StringVar(&cmd.FilterSpec, "filter", "", "圧縮前に適用するフィルタ（例: transpose:4,delta）。展開時も同じものを指定")
+	fs.BoolVar(&cmd.Mkdir, "mkdir", false, "出力先の親ディレクトリが存在しない場合に作成")
+	fs.BoolVar(&cmd.Force, "f", false, "既存の出力ファイルを上書き（指定しない場合はエラー）")
+	fs.BoolVar(&cmd.NoClobber, "n", false, "既存の出力ファイルを上書きしない（-verify-existing と指定）")
+	fs.BoolVar(&cmd.SkipExisting, "skip-existing", false, "既存の出力ファイルには書き込まずにスキップ（展開するアーカイブのエントリはスキップした数を表示）")
+	fs.BoolVar(&cmd.VerifyExisting, "verify-existing", false, "-n と指定し、既存の出力ファイルが同じ内容ならスキップ、異なればエラー")
+	fs.IntVar(&cmd.BlockSize, "block-size", blocks.DefaultBlockSize, "-adaptive 使用時のブロックサイズ (bytes)")
+	fs.BoolVar(&cmd.Sparse, "sparse", false, "展開時に0の領域を書き込まず、スパースファイルとして出力")
+	fs.BoolVar(&cmd.TolerateSize, "tolerate-size-mismatch", false, "展開結果のサイズが.tzzコンテナの元のサイズと異なるメンバーも展開できた分を出力し、差を表示して終了コード3で終わる（一部が壊れたファイルの復旧用）")
+	fs.BoolVar(&cmd.Salvage, "salvage", false, "-adaptive などのブロックコンテナで展開できないブロックを元のサイズ分埋めて続け、壊れた範囲を表示して終了コード3で終わる（大きなバックアップの復旧用）")
+	fs.StringVar(&cmd.SalvageFill, "salvage-fill", "", "-salvage で壊れたブロックを埋めるパターン（16進数、例: ff, deadbeef。省略時は0）")
+	fs.StringVar(&cmd.SalvageReport, "salvage-report", "", "-salvage で埋めたブロックの一覧（位置、長さ、ブロック番号）をJSONで書き込むファイル")
+	fs.BoolVar(&cmd.AllowRecompress, "allow-recompress", false, "-c で入力が既に.tzzコンテナでも圧縮する（指定しない場合は警告して圧縮せずに格納、-strict ではエラー）")
+	fs.BoolVar(&cmd.Recursive, "recursive", false, "-d で展開結果がまた.tzzコンテナ（2重に圧縮したファイル）の間、続けて展開する")
+	fs.IntVar(&cmd.MaxDepth, "max-depth", container.DefaultMaxDepth, "-recursive で展開するコンテナの最大の層の数")
+	fs.Float64Var(&cmd.TargetRatio, "target-ratio", 0, "圧縮率がこの値以下にならない場合は元のデータをそのまま出力（例: 0.7、-algo auto で推奨順に試す）")
+	fs.BoolVar(&cmd.JSON, "json", false, "圧縮モードの統計（-version ではビルドの情報）をJSONで標準出力に出力")
+	fs.StringVar(&cmd.Corpus, "corpus", "", "-bench で使うコーパス（"+corpusNames(corpus.All())+"、カンマ区切り）。キャッシュになければHTTPSでダウンロード")
+	fs.BoolVar(&cmd.Offline, "offline", false, "-bench でダウンロードせず、キャッシュにあるコーパスだけを使用")
+	fs.StringVar(&cmd.RefPath, "ref", "", "-delta / -apply の古いファイル")
+	fs.StringVar(&cmd.ReportPath, "report", "", "レポートモード（全アルゴリズムの分析・圧縮結果をテンプレートで出力するファイル）")
+	fs.StringVar(&cmd.TemplatePath, "template", "", "-report で使うtext/templateのファイル（省略時はMarkdown）")
+	fs.StringVar(&cmd.DOTPath, "dot", "", "分析モードでLZWの辞書のトライ木をDOT形式で出力するファイル（-algo lzw、入力は4KBまで）")
+	fs.IntVar(&cmd.Parallel, "p", runtime.GOMAXPROCS(0), "-format tza / zip でディレクトリを圧縮するときに同時に圧縮するファイルの数（出力は並列数によらず同じ）")
+	fs.BoolVar(&cmd.FailFast, "fail-fast", false, "-format tza / zip で読み込めないファイルがあれば、残りを圧縮せずに止める（指定しない場合は飛ばして最後に報告）")
+	fs.StringVar(&cmd.Include, "include", "", "-format tza / zip でディレクトリから追加するファイルのパターン（カンマ区切り、** は0個以上のディレクトリ、/ を含まなければどの階層の名前にも一致）")
+	fs.StringVar(&cmd.Exclude, "exclude", "", "-format tza / zip でディレクトリから追加しないファイルやディレクトリのパターン（カンマ区切り、規則は -include と同じ）")
+	fs.StringVar(&cmd.MaxFileSize, "max-file-size", "", "-format tza / zip でこれより大きいファイルを追加しない (例: 10M)")
+	fs.StringVar(&cmd.Special, "special", specialSkip, "-c で名前付きパイプ、デバイス、ソケットなど通常のファイルでない入力の扱い（skip: 警告して飛ばす、error: エラー）")
+	fs.BoolVar(&cmd.FollowSymlinks, "follow-symlinks", false, "-format tza / zip でシンボリックリンクをたどってリンク先を追加する（循環するリンクは飛ばす。指定しない場合はリンク先のパスだけを記録）")
+	fs.BoolVar(&cmd.AllowExternal, "allow-external-targets", false, "-follow-symlinks で入力のディレクトリの外を指すリンクもたどる（指定しない場合は警告して飛ばす）")
+	fs.BoolVar(&cmd.Reproducible, "reproducible", false, "-format tza / zip で、同じ内容のディレクトリから更新日時や追加した順によらず同じバイト列のアーカイブを書き込む（エントリを名前順に並べ、zip の更新日時は環境変数 SOURCE_DATE_EPOCH か1980年）")
+	fs.StringVar(&cmd.Symlinks, "symlinks", symlinksInternal, "-d でアーカイブのシンボリックリンクを作成するか（skip: 作成しない、internal: 展開先の中を指すものだけ、all: すべて）")
+	fs.StringVar(&cmd.Format, "format", formatTzz, "圧縮の出力形式（tzz: ファイル1つ、tza / zip: ディレクトリをまとめる）。-d と -list は形式を自動で判別")
+	fs.StringVar(&cmd.TracePath, "trace", "", "圧縮でエンコーダーの各ステップをJSON Lines形式で出力するファイル（-algo rle, lz77, huffman など、授業用）")
+	fs.BoolVar(&cmd.Strict, "strict", false, "指定していない選択（元のデータの格納、-algo auto、形式やアルゴリズムの自動判別など）をせずにエラーにする（ベンチマーク用）")
+	fs.StringVar(&cmd.StatsLog, "stats-log", "", "圧縮・展開ごとに入力のSHA-256、アルゴリズムと設定、圧縮率、処理時間を1行のJSONで追記するファイル（history で比較、同じ入力の最良の圧縮率より悪化すると警告）")
+	fs.StringVar(&cmd.ExportStats, "export-stats", "", "分析モードでヒストグラムなどの統計データを出力するファイル（-algo rle, lz77, huffman、.csv ならCSV、それ以外はJSON）")
+	return f
+}
+
+// Run は c のモードを r で実行します（r の Options は c の Options で置き換えます）
+func (c *Command) Run(r *Runner) error {
+	r.Options = c.Options
+	switch c.Mode {
+	case ModeVersion:
+		return r.Version()
+	case ModeCompress:
+		return r.Compress(c.Inputs[0], c.Output)
+	case ModeAppend:
+		return r.Append(c.Inputs[0], c.Output)
+	case ModeDecompress:
+		return r.Decompress(c.Inputs[0], c.Output)
+	case ModeAnalyze:
+		return r.Analyze(c.Inputs[0])
+	case ModeCompare:
+		return r.Compare(c.Inputs)
+	case ModeList:
+		return r.List(c.Inputs[0])
+	case ModeRepair:
+		return r.Repair(c.Inputs[0])
+	case ModeReport:
+		return r.Report(c.Inputs[0], c.ReportPath)
+	case ModeDelta:
+		return r.Delta(c.RefPath, c.Inputs[0], c.Output)
+	case ModeApply:
+		return r.ApplyPatch(c.RefPath, c.Inputs[0], c.Output)
+	case ModeDemo:
+		return r.Demo(c.Inputs[0])
+	case ModeBench:
+		return r.Bench(c.Corpus)
+	case ModeCopy, ModeCopyDecompress:
+		return r.Copy(c.Inputs[0], c.Output, c.Mode == ModeCopyDecompress)
+	case ModeInfo:
+		return r.Info(c.Inputs[0])
+	case ModeServe:
+		return r.Serve(c.Addr)
+	case ModeCompletion:
+		return r.Completion(c.Shell, c.Program)
+	case ModeHistory:
+		return r.History(c.Inputs[0])
+	case ModeDictTrain:
+		return r.DictTrain(c.Inputs[0], c.Output)
+	case ModeDictInspect:
+		return r.DictInspect(c.Inputs[0])
+	}
+	return fmt.Errorf("cli: unknown mode %d", c.Mode)
+}
+
+// printUsage は使用方法と例を w に表示します
+func printUsage(w io.Writer, name string, fs *flag.FlagSet) {
+	b := common.BuildInfo()
+	fmt.Fprintf(w, "TinyZipZap - 圧縮アルゴリズム学習ツール %s\n\n", b)
+	fmt.Fprintf(w, "使用方法:\n")
+	fmt.Fprintf(w, "  %s [オプション]\n\n", name)
+	fmt.Fprintf(w, "オプション:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nアルゴリズム（-algo、形式バージョン）:\n")
+	fprintAlgorithms(w, b.Algorithms)
+	fmt.Fprintf(w, "\n例:\n")
+	fmt.Fprintf(w, "  # ファイルをRLEで圧縮\n")
+	fmt.Fprintf(w, "  %s -c -algo rle -i sample.txt -o sample.rle\n\n", name)
+	fmt.Fprintf(w, "  # 圧縮ファイルを展開\n")
+	fmt.Fprintf(w, "  %s -d -algo rle -i sample.rle -o output.txt\n\n", name)
+	fmt.Fprintf(w, "  # ファイルを分析\n")
+	fmt.Fprintf(w, "  %s -a -algo rle -i sample.txt\n\n", name)
+	fmt.Fprintf(w, "  # LZWの辞書のトライ木をGraphvizで表示\n")
+	fmt.Fprintf(w, "  %s -a -algo lzw -i small.txt -dot trie.dot && dot -Tsvg trie.dot -o trie.svg\n\n", name)
+	fmt.Fprintf(w, "  # LZ77のマッチ長・距離の分布をJSONで出力（グラフ用）\n")
+	fmt.Fprintf(w, "  %s -a -algo lz77 -i sample.txt -export-stats matches.json\n\n", name)
+	fmt.Fprintf(w, "  # サンプルからLZ77用の辞書を学習して使用\n")
+	fmt.Fprintf(w, "  %s dict train -i samples/ -o app.dict -size 4096\n", name)
+	fmt.Fprintf(w, "  %s -c -algo lz77 -dict app.dict -i msg.json\n\n", name)
+	fmt.Fprintf(w, "  # ログを.tzzコンテナに追記し、まとめて展開\n")
+	fmt.Fprintf(w, "  %s -c -append -algo lz77 -i - -o app.log.tzz\n", name)
+	fmt.Fprintf(w, "  %s -d -algo lz77 -i app.log.tzz -o app.log\n\n", name)
+	fmt.Fprintf(w, "  # 30%%以上小さくなる場合だけ圧縮（推奨順にアルゴリズムを試す）\n")
+	fmt.Fprintf(w, "  %s -c -algo auto -target-ratio 0.7 -json -i data.bin -o data.tzz\n\n", name)
+	fmt.Fprintf(w, "  # LZ77の圧縮を1ステップずつ表示（スペースで次へ、a で自動再生、q で終了）\n")
+	fmt.Fprintf(w, "  %s -demo -algo lz77 -i small.txt\n\n", name)
+	fmt.Fprintf(w, "  # Huffman木の結合の順序を記録（授業用）\n")
+	fmt.Fprintf(w, "  %s -c -algo huffman -i small.txt -trace steps.jsonl\n\n", name)
+	fmt.Fprintf(w, "  # ディレクトリを zip にまとめ、一覧を表示して展開（unzip でも展開できます）\n")
+	fmt.Fprintf(w, "  %s -c -format zip -i src -o src.zip\n", name)
+	fmt.Fprintf(w, "  %s -list -i src.zip\n", name)
+	fmt.Fprintf(w, "  %s -d -i src.zip -o extracted\n\n", name)
+	fmt.Fprintf(w, "  # 圧縮ファイルのヘッダーだけを読んで形式・サイズ・チェックサムなどを表示\n")
+	fmt.Fprintf(w, "  %s info big.tzz\n\n", name)
+	fmt.Fprintf(w, "  # 圧縮の結果を記録し、同じ入力の過去の結果と最良の圧縮率を表示\n")
+	fmt.Fprintf(w, "  %s -c -algo lz77 -adaptive -stats-log ~/.tinyzipzap/history.jsonl -i data.bin -o data.tzz\n", name)
+	fmt.Fprintf(w, "  %s history data.bin\n\n", name)
+	fmt.Fprintf(w, "  # ブラウザで分析・比較するWeb UIを起動（http://localhost:8080/）\n")
+	fmt.Fprintf(w, "  %s serve -p 8080\n\n", name)
+	fmt.Fprintf(w, "  # bashでフラグやアルゴリズム名を補完（zsh, fish も指定できます）\n")
+	fmt.Fprintf(w, "  source <(%s completion bash)\n\n", name)
+	fmt.Fprintf(w, "  # 古いファイルからの差分（パッチ）を作成し、古いファイルに適用\n")
+	fmt.Fprintf(w, "  %s -delta -ref old.bin -i new.bin -o new.patch\n", name)
+	fmt.Fprintf(w, "  %s -apply -ref old.bin -i new.patch -o new.bin\n\n", name)
+	fmt.Fprintf(w, "  # ディレクトリを圧縮しながらコピー（2回目以降は変更されたファイルだけ）し、展開して戻す\n")
+	fmt.Fprintf(w, "  %s copy -c -algo lz77 src/ backup/\n", name)
+	fmt.Fprintf(w, "  %s copy -d backup/ restored/\n\n", name)
+	fmt.Fprintf(w, "  # 全アルゴリズムを比較\n")
+	fmt.Fprintf(w, "  %s -compare -i sample.txt\n\n", name)
+	fmt.Fprintf(w, "  # Canterbury Corpus で全アルゴリズムを比較（初回はダウンロードしてキャッシュ）\n")
+	fmt.Fprintf(w, "  %s -bench -corpus canterbury\n\n", name)
+	fmt.Fprintf(w, "  # 授業の配布資料用のレポートをMarkdownで出力\n")
+	fmt.Fprintf(w, "  %s -report handout.md -i sample.txt\n\n", name)
+	fmt.Fprintf(w, "  # 複数ファイルの比較結果をCSVで出力\n")
+	fmt.Fprintf(w, "  %s -compare -csv a.txt b.json c.bin > results.csv\n\n", name)
+}
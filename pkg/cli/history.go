@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/history"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// minHashPrefix は history で入力を SHA-256 の先頭で指定する場合の最小の桁数です
+const minHashPrefix = 6
+
+// ParseHistory は history サブコマンドの引数（"history" を除く）を解釈します
+// history [-log ファイル] [-algo 名前] [-n 件数] [-json] <ファイル | SHA-256> は、-stats-log で
+// 記録した同じ入力の過去の結果と最良の圧縮率を表示します。エラーの扱いは Parse と同じです。
+func ParseHistory(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name+" history", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	defineHistoryFlags(fs, &cmd)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s history [オプション] <ファイル | SHA-256>\n\n", name)
+		fmt.Fprintf(stderr, "オプション:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\n例:\n")
+		fmt.Fprintf(stderr, "  %s -c -algo lz77 -stats-log ~/.tinyzipzap/history.jsonl -i data.bin -o data.tzz\n", name)
+		fmt.Fprintf(stderr, "  %s history data.bin\n", name)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	usageError := func(msg string) (*Command, error) {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", msg)
+		fs.Usage()
+		return nil, ErrUsage
+	}
+	switch {
+	case fs.NArg() != 1:
+		return usageError("ファイルか入力の SHA-256 を1つ指定してください")
+	case cmd.HistoryLimit < 0:
+		return usageError("-n は0以上を指定してください")
+	}
+	cmd.Mode = ModeHistory
+	cmd.Inputs = []string{fs.Arg(0)}
+	return &cmd, nil
+}
+
+// defineHistoryFlags は ParseHistory のフラグを fs に定義します
+func defineHistoryFlags(fs *flag.FlagSet, cmd *Command) {
+	fs.StringVar(&cmd.StatsLog, "log", "", "読み込む統計ログ（-stats-log で指定したファイル、省略時は ~/.tinyzipzap/history.jsonl）")
+	fs.StringVar(&cmd.Algorithm, "algo", "", "このアルゴリズムの記録だけを表示")
+	fs.IntVar(&cmd.HistoryLimit, "n", 20, "表示する最新の記録の数（0ですべて、最良の圧縮率はすべての記録から選ぶ）")
+	fs.BoolVar(&cmd.JSON, "json", false, "結果をJSONで出力")
+}
+
+// historySummary は history の -json の出力です
+type historySummary struct {
+	Log         string           `json:"log"`
+	InputSHA256 string           `json:"input_sha256"`
+	Matched     int              `json:"matched"`          // 条件に一致した記録の数
+	Records     []history.Record `json:"records"`          // 表示した最新の記録（古い順）
+	Best        *history.Record  `json:"best,omitempty"`   // 最良の圧縮率の記録
+	Latest      *history.Record  `json:"latest,omitempty"` // 最新の圧縮の記録
+	Regressed   bool             `json:"regressed"`        // Latest が Best より悪化した
+	Skipped     int              `json:"skipped_lines"`    // 読み飛ばした壊れた行の数
+}
+
+// History は統計ログから target の入力の記録を読み込み、最良の圧縮率と最新の圧縮の悪化を表示します
+// target はファイル（内容のSHA-256で探す）、"-"（標準入力）、または SHA-256 の先頭
+// （minHashPrefix 桁以上の16進数）です。Algorithm を指定した場合はそのアルゴリズムの記録だけを
+// 対象にします。StatsLog が空の場合は history.DefaultPath のログを読み込みます。
+func (r *Runner) History(target string) error {
+	path := r.StatsLog
+	if path == "" {
+		var err error
+		if path, err = history.DefaultPath(); err != nil {
+			return fmt.Errorf("統計ログの場所がわかりません（-log で指定してください）: %w", err)
+		}
+	}
+	sum, err := r.historyTarget(target)
+	if err != nil {
+		return err
+	}
+	records, skipped, err := history.Load(path)
+	if err != nil {
+		return fmt.Errorf("統計ログ読み込みエラー: %w", err)
+	}
+
+	matched := history.Query(records, history.Filter{InputSHA256: sum, Algorithm: r.Algorithm})
+	summary := historySummary{Log: path, InputSHA256: sum, Matched: len(matched), Records: matched, Skipped: skipped}
+	if r.HistoryLimit > 0 && len(matched) > r.HistoryLimit {
+		summary.Records = matched[len(matched)-r.HistoryLimit:]
+	}
+	if best, ok := history.Best(matched); ok {
+		summary.Best = &best
+	}
+	for i := len(matched) - 1; i >= 0; i-- {
+		if matched[i].Operation == history.OpCompress {
+			summary.Latest = &matched[i]
+			break
+		}
+	}
+	summary.Regressed = summary.Best != nil && summary.Latest != nil && history.Regressed(*summary.Latest, *summary.Best)
+
+	if r.JSON {
+		if summary.Records == nil {
+			summary.Records = []history.Record{}
+		}
+		if err := json.NewEncoder(r.Out).Encode(summary); err != nil {
+			return fmt.Errorf("出力エラー: %w", err)
+		}
+		return nil
+	}
+	r.printHistory(summary)
+	return nil
+}
+
+// historyTarget は History の target を検索する SHA-256（または先頭）に変換します
+func (r *Runner) historyTarget(target string) (string, error) {
+	if target == "-" {
+		h := sha256.New()
+		if _, err := io.Copy(h, r.In); err != nil {
+			return "", fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	info, err := os.Stat(target)
+	if err == nil && info.Mode().IsRegular() {
+		sum, err := history.HashFile(target)
+		if err != nil {
+			return "", fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		return sum, nil
+	}
+	if len(target) >= minHashPrefix && len(target) <= sha256.Size*2 && isHex(target) {
+		return strings.ToLower(target), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ファイルが見つからず、SHA-256（%d桁以上の16進数）でもありません: %s", minHashPrefix, target)
+	}
+	return "", fmt.Errorf("通常のファイルではありません: %s", target)
+}
+
+// isHex は s がすべて16進数の文字かを返します
+func isHex(s string) bool {
+	return strings.Trim(strings.ToLower(s), "0123456789abcdef") == ""
+}
+
+// printHistory は History の結果を表形式で Out に表示します
+func (r *Runner) printHistory(s historySummary) {
+	if s.Skipped > 0 {
+		fmt.Fprintf(r.Err, "⚠️  統計ログの壊れた行を %d 行読み飛ばしました\n", s.Skipped)
+	}
+	short := s.InputSHA256[:min(len(s.InputSHA256), 12)]
+	if s.Matched == 0 {
+		fmt.Fprintf(r.Out, "%s の記録はありません（%s）\n", short, s.Log)
+		return
+	}
+	fmt.Fprintf(r.Out, "%s（%s）の記録: %d 件（%s）\n", short, s.Records[len(s.Records)-1].Input, s.Matched, s.Log)
+	if len(s.Records) < s.Matched {
+		fmt.Fprintf(r.Out, "最新の %d 件を表示します\n", len(s.Records))
+	}
+	fmt.Fprintln(r.Out)
+	fmt.Fprintf(r.Out, "%-19s  %-10s  %8s  %10s  %10s  %s\n", "時刻", "操作", "圧縮率", "元のサイズ", "処理時間", "設定")
+	for _, rec := range s.Records {
+		fmt.Fprintf(r.Out, "%-19s  %-10s  %7.2f%%  %10s  %10v  %s\n",
+			rec.Time.Local().Format(time.DateTime), rec.Operation, rec.Ratio*100,
+			common.FormatBytes(rec.OriginalSize), rec.Duration.Round(time.Microsecond), rec.Setting())
+	}
+
+	if s.Best == nil {
+		return
+	}
+	fmt.Fprintln(r.Out)
+	fmt.Fprintf(r.Out, "最良の圧縮率: %.2f%%（%s、%s）\n", s.Best.Ratio*100, s.Best.Setting(), s.Best.Time.Local().Format(time.DateTime))
+	if s.Regressed {
+		fmt.Fprintf(r.Out, "⚠️  最新の圧縮 %.2f%%（%s）は最良の圧縮率より悪化しています\n", s.Latest.Ratio*100, s.Latest.Setting())
+	}
+}
+
+// statsHasher は StatsLog に記録する入力のSHA-256を計算します
+// ファイルは先に読み込んで計算し、"-" の場合は wrap した標準入力から読み込んだデータで
+// 計算します。StatsLog を指定しない場合は何もしません。
+type statsHasher struct {
+	sum string
+	h   hash.Hash
+}
+
+// newStatsHasher は input の statsHasher を作成します
+func (r *Runner) newStatsHasher(input string) (*statsHasher, error) {
+	s := &statsHasher{}
+	switch {
+	case r.StatsLog == "":
+	case input == "-":
+		s.h = sha256.New()
+	default:
+		sum, err := history.HashFile(input)
+		if err != nil {
+			return nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		s.sum = sum
+	}
+	return s, nil
+}
+
+// wrap は標準入力 in を読み込みながらSHA-256を計算する Reader を返します
+func (s *statsHasher) wrap(in io.Reader) io.Reader {
+	if s.h == nil {
+		return in
+	}
+	return io.TeeReader(in, s.h)
+}
+
+// Sum は入力のSHA-256を16進数で返します（標準入力の場合は読み込んだ分）
+func (s *statsHasher) Sum() string {
+	if s.h != nil {
+		return hex.EncodeToString(s.h.Sum(nil))
+	}
+	return s.sum
+}
+
+// recordStats は StatsLog に1回の圧縮・展開を記録します
+// 圧縮の場合は、同じ入力の過去の最良の圧縮率より悪化していれば Err に警告します。
+// 記録に失敗しても処理は完了しているため、エラーにせず Err に警告します。
+func (r *Runner) recordStats(op, input, sum, algorithm string, stats common.CompressionStats) {
+	if r.StatsLog == "" {
+		return
+	}
+	rec := history.Record{
+		Time:           time.Now().UTC(),
+		Operation:      op,
+		InputSHA256:    sum,
+		Input:          input,
+		OriginalSize:   stats.OriginalSize,
+		CompressedSize: stats.CompressedSize,
+		Ratio:          stats.Ratio,
+		Algorithm:      algorithm,
+		Params:         r.statsParams(),
+		Duration:       stats.Duration,
+		Timings:        stats.Timings,
+		Version:        common.BuildInfo().String(),
+	}
+
+	if op == history.OpCompress {
+		past, _, err := history.Load(r.StatsLog)
+		if err == nil {
+			if best, ok := history.Best(history.Query(past, history.Filter{InputSHA256: sum})); ok && history.Regressed(rec, best) {
+				fmt.Fprintf(r.Err, "⚠️  同じ入力の最良の圧縮率 %.2f%%（%s）より悪化しました: %.2f%%（%s）\n",
+					best.Ratio*100, best.Setting(), rec.Ratio*100, rec.Setting())
+			}
+		}
+	}
+	if err := history.Append(r.StatsLog, rec); err != nil {
+		fmt.Fprintf(r.Err, "⚠️  統計ログに記録できませんでした: %v\n", err)
+	}
+}
+
+// statsParams は StatsLog に記録するアルゴリズム以外の設定を返します（指定していないものは含めません）
+func (r *Runner) statsParams() map[string]string {
+	params := make(map[string]string)
+	if r.FilterSpec != "" {
+		params["filter"] = r.FilterSpec
+	}
+	if r.DictPath != "" {
+		params["dict"] = filepath.Base(r.DictPath)
+	}
+	if r.Adaptive {
+		blockSize := r.BlockSize
+		if blockSize <= 0 {
+			blockSize = blocks.DefaultBlockSize
+		}
+		params["adaptive"] = "true"
+		params["block_size"] = strconv.Itoa(blockSize)
+	}
+	if r.TargetRatio > 0 {
+		params["target_ratio"] = strconv.FormatFloat(r.TargetRatio, 'g', -1, 64)
+	}
+	if r.Strict {
+		params["strict"] = "true"
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
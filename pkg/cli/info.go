@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+)
+
+// ParseInfo は info サブコマンドの引数（"info" を除く）を解釈します
+// info [-json] <ファイル> は圧縮ファイルのヘッダーだけを読み込み、形式と構成を表示します。
+// エラーの扱いは Parse と同じです。
+func ParseInfo(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name+" info", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	defineInfoFlags(fs, &cmd)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s info [オプション] <ファイル>\n\n", name)
+		fmt.Fprintf(stderr, "オプション:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", "ファイルを1つ指定してください")
+		fs.Usage()
+		return nil, ErrUsage
+	}
+	cmd.Mode = ModeInfo
+	cmd.Inputs = []string{fs.Arg(0)}
+	return &cmd, nil
+}
+
+// defineInfoFlags は ParseInfo のフラグを fs に定義します
+func defineInfoFlags(fs *flag.FlagSet, cmd *Command) {
+	fs.BoolVar(&cmd.JSON, "json", false, "結果をJSONで出力")
+}
+
+// Info は圧縮ファイルのヘッダーを読み込み、形式・サイズ・チェックサム・ブロック・
+// メンバー・エントリの情報を表示します（JSON の場合は container.Info を1行で出力）
+// ペイロードは展開しないため、大きなファイルでもすぐに終わります。
+// input が "-" の場合は標準入力をすべて読み込みます。
+func (r *Runner) Info(input string) error {
+	var src io.ReaderAt
+	if input == "-" {
+		data, err := io.ReadAll(r.In)
+		if err != nil {
+			return fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		src = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("ファイル読み込みエラー: %w", err)
+		}
+		defer f.Close()
+		src = f
+	}
+
+	info, err := container.Inspect(src)
+	if err != nil {
+		return fmt.Errorf("ヘッダー読み込みエラー: %w%s", err, newerVersionHint(err))
+	}
+	if r.JSON {
+		if err := json.NewEncoder(r.Out).Encode(info); err != nil {
+			return fmt.Errorf("出力エラー: %w", err)
+		}
+		return nil
+	}
+	container.FprintInfo(r.Out, info)
+	return nil
+}
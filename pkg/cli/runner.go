@@ -0,0 +1,382 @@
+// Package cli implements the tinyzipzap command as a reusable API.
+// 圧縮・展開・分析などの各モードを Runner のメソッドとして提供します。入出力は
+// Runner の In/Out/Err で差し替えられ、エラーは終了せずに返すため、他のプログラムから
+// 呼び出したり、メモリ上のバッファと一時ディレクトリでテストしたりできます。
+// cmd/tinyzipzap はコマンドライン引数を Parse で解釈し、Run を呼び出すだけです。
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/corpus"
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/internal/progress"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/container"
+	"github.com/sasakihasuto/tinyzipzap/pkg/dict"
+	"github.com/sasakihasuto/tinyzipzap/pkg/filter"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+// progressInterval は -limit-rate で速度を制限した場合に途中経過を表示する間隔です
+const progressInterval = 2 * time.Second
+
+// Options は各モードに共通する設定です（コマンドラインのフラグに対応します）
+type Options struct {
+	Algorithm       string  // 圧縮アルゴリズムの登録名（-algo、大文字小文字は区別しない）
+	Verbose         bool    // 詳細出力（-v）
+	Adaptive        bool    // ブロックごとに圧縮/無圧縮を選択する（-adaptive）
+	BlockSize       int     // Adaptive のブロックサイズ（0以下の場合は blocks.DefaultBlockSize）
+	DictPath        string  // LZ77のプリセット辞書ファイル（-dict）
+	FilterSpec      string  // 圧縮前に適用するフィルタ（-filter）
+	MemLimit        string  // 展開時のメモリ予算（-mem-limit、例: 256M）
+	MaxOutput       string  // 展開結果の最大サイズ（-max-output、例: 1G）
+	LimitRate       string  // 圧縮・展開で入力を読み込む速度の上限（-limit-rate、1秒あたり、例: 10M）
+	Mkdir           bool    // 出力先の親ディレクトリがなければ作成する（-mkdir）
+	Force           bool    // 既存の出力ファイルを上書きする（-f）
+	NoClobber       bool    // 既存の出力ファイルを上書きしない（-n、-verify-existing と指定）
+	SkipExisting    bool    // 既存の出力ファイルには書き込まずに続ける（-skip-existing）
+	VerifyExisting  bool    // 既存の出力ファイルと内容を比べ、同じならスキップする（-verify-existing）
+	Sparse          bool    // 展開結果をスパースファイルとして出力する（-sparse）
+	TolerateSize    bool    // 展開結果のサイズが元のサイズと異なっても出力する（-tolerate-size-mismatch）
+	Salvage         bool    // 展開できないブロックを埋めて続ける（-salvage）
+	SalvageFill     string  // -salvage で壊れたブロックを埋めるパターン（-salvage-fill、16進数。空は0）
+	SalvageReport   string  // -salvage で埋めたブロックの一覧を書き込むJSONファイル（-salvage-report）
+	AllowRecompress bool    // 既に .tzz コンテナの入力もそのまま格納せずに圧縮する（-allow-recompress）
+	Recursive       bool    // 展開結果がまた .tzz コンテナの間、続けて展開する（-recursive）
+	MaxDepth        int     // -recursive で展開する最大の層の数（-max-depth、0以下は container.DefaultMaxDepth）
+	TargetRatio     float64 // この圧縮率以下にならない場合は元のデータをそのまま出力する（-target-ratio）
+	TracePath       string  // 圧縮でエンコーダーの各ステップを JSON Lines で出力するファイル（-trace）
+	Format          string  // 圧縮の出力形式（-format、tzz, tza, zip。空は tzz）
+	JSON            bool    // 圧縮の統計をJSONで Out に出力する（-json）
+	NoVerify        bool    // 分析・比較で展開結果の検証を省略する（-no-verify）
+	DOTPath         string  // 分析でLZWの辞書のトライ木を出力するファイル（-dot）
+	ExportStats     string  // 分析でヒストグラムなどの統計データを出力するファイル（-export-stats）
+	TemplatePath    string  // レポートのテンプレートファイル（-template）
+	CSV             bool    // 比較結果をCSVで Out に出力する（-csv）
+	CSVFile         string  // 比較結果を出力するCSVファイル（-csv-file）
+	Offline         bool    // ベンチマークでコーパスをダウンロードせず、キャッシュだけを使う（-offline）
+	Parallel        int     // ディレクトリの圧縮で同時に圧縮するファイルの数（-p、0以下の場合は GOMAXPROCS）
+	FailFast        bool    // ディレクトリの圧縮で最初に失敗したファイルで止める（-fail-fast）
+	Include         string  // ディレクトリの圧縮で追加するファイルのパターン（-include、カンマ区切り）
+	Exclude         string  // ディレクトリの圧縮で追加しないファイルのパターン（-exclude、カンマ区切り）
+	MaxFileSize     string  // ディレクトリの圧縮で追加するファイルの最大サイズ（-max-file-size、例: 10M）
+	Special         string  // 通常のファイルでない入力の扱い（-special、skip か error。空は skip）
+	FollowSymlinks  bool    // ディレクトリの圧縮でシンボリックリンクをたどる（-follow-symlinks）
+	AllowExternal   bool    // -follow-symlinks で入力のディレクトリの外を指すリンクもたどる（-allow-external-targets）
+	Symlinks        string  // アーカイブの展開でシンボリックリンクを作成するか（-symlinks、skip, internal, all。空は internal）
+	Reproducible    bool    // ディレクトリの圧縮で、同じ内容から同じバイト列のアーカイブを書き込む（-reproducible）
+	SourceDateEpoch int64   // -reproducible で zip のエントリの更新日時にするUNIX時刻の秒（環境変数 SOURCE_DATE_EPOCH、0以下は1980年）
+	Suffix          string  // copy で圧縮したファイルの拡張子（-suffix、空はアルゴリズムの拡張子）
+	MaxUpload       string  // serve でアップロードできるデータの最大サイズ（-max-upload、例: 1M）
+	Strict          bool    // 指定していない選択（フォールバック）をせずにエラーにする（-strict）
+	StatsLog        string  // 圧縮・展開の結果を1行ずつ追記する統計ログ（-stats-log、history では読み込むログ）
+	HistoryLimit    int     // history で表示する最新の記録の数（-n、0以下はすべて）
+	DictSize        int     // dict train で作成する辞書の最大サイズ（-size、0以下は4096）
+}
+
+// Runner は各モードを実行します
+// ゼロ値の In/Out/Err は使えないため、NewRunner で作成するか、すべて設定してください。
+type Runner struct {
+	In  io.Reader // 入力のパスが "-" の場合に読み込む標準入力
+	Out io.Writer // 結果の出力先
+	Err io.Writer // 進捗などの出力先
+
+	Options
+
+	// ベンチマークのコーパスとそのキャッシュ（テスト用、nil の場合は既知のコーパスと既定の場所）
+	corpora     []corpus.Corpus
+	corpusCache *corpus.Cache
+}
+
+// NewRunner は標準入出力を使う Runner を作成します
+func NewRunner(opts Options) *Runner {
+	return &Runner{In: os.Stdin, Out: os.Stdout, Err: os.Stderr, Options: opts}
+}
+
+// ExitError は処理は完了したが、失敗を終了コードで知らせる必要がある場合のエラーです
+// 比較モードで検証に失敗したアルゴリズムがあった場合などに返します。
+type ExitError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ExitError) Error() string {
+	return e.Msg
+}
+
+// ExitRecovered は -tolerate-size-mismatch で、元のサイズと異なる展開結果を含むまま出力した場合の終了コードです
+// 出力は完了していますが、一部のデータが欠けているか余分なことを終了コードで知らせます。
+const ExitRecovered = 3
+
+// autoAlgorithm は -target-ratio で推奨順に全アルゴリズムを試すときの -algo の値です
+const autoAlgorithm = "auto"
+
+// bestCandidates は -algo best で試すアルゴリズムの登録名です
+// 出力には候補の番号を記録するため、既存の候補の順序は変えずに末尾にだけ追加してください。
+var bestCandidates = []string{"rle", "lz77", "huffman", "lzw", "lzp"}
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         common.BestOfAlgorithm,
+		Capabilities: common.CapDeterministic,
+		Description:  "候補（" + strings.Join(bestCandidates, ", ") + "）で圧縮し、最も小さい結果を選ぶ",
+		UseCase:      "どのアルゴリズムが向いているか分からないデータ",
+		NewFunc:      newBestOf,
+	})
+}
+
+// newBestOf は bestCandidates を並列に試す -algo best の Compressor を作成します
+func newBestOf() common.Compressor {
+	candidates := make([]common.Compressor, len(bestCandidates))
+	for i, name := range bestCandidates {
+		c, err := common.New(name)
+		if err != nil {
+			panic(fmt.Sprintf("cli: best candidate %q is not registered", name))
+		}
+		candidates[i] = c
+	}
+	return common.NewParallelBestOf(candidates...)
+}
+
+// algorithmName は Algorithm を登録名に正規化します（空の場合は rle）
+func (r *Runner) algorithmName() string {
+	if r.Algorithm == "" {
+		return "rle"
+	}
+	return strings.ToLower(r.Algorithm)
+}
+
+// policy は Strict に対応する common.Policy を返します
+func (r *Runner) policy() common.Policy {
+	return common.Policy{Strict: r.Strict}
+}
+
+// compressor は Algorithm に Dict、Filter、Adaptive の設定を適用した圧縮器を作成します
+// 圧縮器には policy を設定するため、Strict の場合は暗黙の選択をせずにエラーを返します。
+func (r *Runner) compressor() (common.Compressor, error) {
+	compressor, err := common.New(r.algorithmName())
+	if err != nil {
+		return nil, fmt.Errorf("未対応のアルゴリズム: %s", r.Algorithm)
+	}
+	compressor = common.WithPolicy(compressor, r.policy())
+	if r.DictPath != "" {
+		c, ok := compressor.(*lz77.Compressor)
+		if !ok {
+			return nil, errors.New("辞書は lz77 でのみ使用できます")
+		}
+		d, err := dict.Load(r.DictPath)
+		if err != nil {
+			return nil, fmt.Errorf("辞書読み込みエラー: %w%s", err, newerVersionHint(err))
+		}
+		compressor = c.WithDict(d.Content)
+	}
+	if r.FilterSpec != "" {
+		filters, err := filter.Parse(r.FilterSpec)
+		if err != nil {
+			return nil, fmt.Errorf("フィルタ指定エラー: %w", err)
+		}
+		compressor = filter.NewCompressor(compressor, filters...)
+	}
+	if r.Adaptive {
+		blockSize := r.BlockSize
+		if blockSize <= 0 {
+			blockSize = blocks.DefaultBlockSize
+		}
+		compressor = common.WithPolicy(blocks.NewCompressor(compressor, blockSize, true), r.policy())
+	}
+	return compressor, nil
+}
+
+// readInput は入力ファイルを読み込みます（"-" の場合は In）
+func (r *Runner) readInput(path string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(r.In)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ファイル読み込みエラー: %w", err)
+	}
+	return data, nil
+}
+
+// printInputInfo は -v のときに入力の概要を表示します
+func (r *Runner) printInputInfo(input string, data []byte) {
+	if !r.Verbose {
+		return
+	}
+	fmt.Fprintf(r.Out, "入力ファイル: %s (%s)\n", input, common.FormatBytes(int64(len(data))))
+	fmt.Fprintf(r.Out, "アルゴリズム: %s\n", strings.ToUpper(r.algorithmName()))
+	fmt.Fprintf(r.Out, "データサイズ: %d bytes\n", len(data))
+	if len(data) > 0 {
+		fmt.Fprintf(r.Out, "エントロピー: %.3f bits/byte\n", common.CalculateEntropy(data))
+	}
+	fmt.Fprintln(r.Out)
+}
+
+// startProgress は opts で入力の進捗を記録し、SIGUSR1（BSD/macOSでは SIGINFO も）を
+// 受け取るたびに途中経過を Err に表示します。opts.RateLimit で速度を制限する場合は
+// progressInterval ごとにも表示します。返された関数で表示を止めます。
+// 割合と残り時間は入力ファイルのサイズから計算します（標準入力の場合は表示しません）。
+func (r *Runner) startProgress(inputFile string, opts *container.FileOptions) (*progress.Tracker, func()) {
+	total := int64(0)
+	if inputFile != "-" {
+		if info, err := os.Stat(inputFile); err == nil && info.Mode().IsRegular() {
+			total = info.Size()
+		}
+	}
+	tracker := progress.New(total)
+	opts.Progress = tracker.Update
+	stopSignals := tracker.WatchSignals(r.Err)
+	if opts.RateLimit <= 0 {
+		return tracker, stopSignals
+	}
+
+	// 速度を制限した場合は、意図して遅いことが分かるよう定期的に表示する
+	stopReport := tracker.Report(r.Err, progressInterval)
+	return tracker, func() {
+		stopReport()
+		stopSignals()
+	}
+}
+
+// rateLimit は LimitRate から入力を読み込む速度の上限（1秒あたりのバイト数）を返します
+// 指定しない場合は0（制限なし）です。
+func (r *Runner) rateLimit() (int64, error) {
+	if r.LimitRate == "" {
+		return 0, nil
+	}
+	limit, err := common.ParseBytes(r.LimitRate)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("オプションエラー: -limit-rate には正のサイズを指定してください（例: 10M）: %q", r.LimitRate)
+	}
+	return limit, nil
+}
+
+// writeOptions は出力ファイルの書き込み方法を作成します
+// すべての出力で共通で、既存のファイルは -f の場合だけ上書きします。-skip-existing では
+// 書き込まずにスキップし、-verify-existing では内容が同じ場合だけスキップします。
+func (r *Runner) writeOptions() fileutil.Options {
+	return fileutil.Options{
+		MkdirAll:       r.Mkdir,
+		Overwrite:      r.Force && !r.NoClobber,
+		SkipExisting:   r.SkipExisting,
+		VerifyExisting: r.VerifyExisting,
+	}
+}
+
+// fileOptions はファイル単位の圧縮・展開の設定を作成します
+func (r *Runner) fileOptions() container.FileOptions {
+	writeOpts := r.writeOptions()
+	return container.FileOptions{
+		Algorithm:      r.algorithmName(),
+		MkdirAll:       writeOpts.MkdirAll,
+		Overwrite:      writeOpts.Overwrite,
+		SkipExisting:   writeOpts.SkipExisting,
+		VerifyExisting: writeOpts.VerifyExisting,
+		Sparse:         r.Sparse,
+		Stdin:          r.In,
+		Nested:         r.nestedMode(),
+		MaxDepth:       r.maxDepth(),
+
+		TolerateSizeMismatch: r.TolerateSize,
+	}
+}
+
+// nestedMode は圧縮する入力が既に .tzz コンテナの場合の扱いを返します
+// 既定では圧縮せずに格納し、-allow-recompress では圧縮、Strict の場合はエラーにします。
+func (r *Runner) nestedMode() container.NestedMode {
+	switch {
+	case r.AllowRecompress:
+		return container.NestedCompress
+	case r.Strict:
+		return container.NestedReject
+	}
+	return container.NestedStore
+}
+
+// maxDepth は展開する .tzz コンテナの最大の層の数を返します（-recursive でなければ1）
+func (r *Runner) maxDepth() int {
+	switch {
+	case !r.Recursive:
+		return 1
+	case r.MaxDepth <= 0:
+		return container.DefaultMaxDepth
+	}
+	return r.MaxDepth
+}
+
+// reportSkipped は err が既存の出力ファイルのため書き込まなかったこと（-skip-existing、
+// または -verify-existing で同じ内容）を表す場合に、その旨を表示して true を返します
+// -json の場合は Out のJSONを壊さないよう Err に表示します。
+func (r *Runner) reportSkipped(err error, output string) bool {
+	w := r.Out
+	if r.JSON {
+		w = r.Err
+	}
+	switch {
+	case errors.Is(err, fileutil.ErrIdentical):
+		fmt.Fprintf(w, "⏭️  スキップ: %s は同じ内容で既に存在します（identical, skipped）\n", output)
+	case errors.Is(err, fileutil.ErrSkipped):
+		fmt.Fprintf(w, "⏭️  スキップ: %s は既に存在します\n", output)
+	default:
+		return false
+	}
+	return true
+}
+
+// existingHint は既存の出力ファイルのため書き込めなかったエラーに付ける案内を返します
+func existingHint(err error) string {
+	switch {
+	case errors.Is(err, fileutil.ErrDiffers):
+		return "\n既存のファイルと内容が異なるため書き込みません（differs, refused）"
+	case errors.Is(err, fileutil.ErrExists):
+		return "\n上書きする場合は -f を、既存のファイルを飛ばす場合は -skip-existing を指定してください"
+	}
+	return ""
+}
+
+// decompressOptions は MemLimit と MaxOutput から展開時の制限を作成します
+func (r *Runner) decompressOptions() (common.DecompressOptions, error) {
+	var opts common.DecompressOptions
+	if r.MemLimit != "" {
+		limit, err := common.ParseBytes(r.MemLimit)
+		if err != nil {
+			return opts, fmt.Errorf("オプションエラー: %w", err)
+		}
+		opts.Budget = common.NewBudget(limit)
+	}
+	if r.MaxOutput != "" {
+		limit, err := common.ParseBytes(r.MaxOutput)
+		if err != nil {
+			return opts, fmt.Errorf("オプションエラー: %w", err)
+		}
+		opts.MaxOutputSize = limit
+	}
+	return opts, nil
+}
+
+// newerVersionHint は新しい形式のファイルを読み込めなかったエラーに付ける案内を返します
+func newerVersionHint(err error) string {
+	var unsupported *common.ErrUnsupportedVersion
+	if errors.As(err, &unsupported) {
+		return "\nthis file requires a newer tinyzipzap"
+	}
+	return ""
+}
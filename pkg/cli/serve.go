@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// ParseServe は serve サブコマンドの引数（"serve" を除く）を解釈します
+// serve [-p ポート] [-host ホスト] [-max-upload サイズ] はローカルのWeb UIを起動します。
+// エラーの扱いは Parse と同じです。
+func ParseServe(name string, args []string, stderr io.Writer) (*Command, error) {
+	fs := flag.NewFlagSet(name+" serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var cmd Command
+	port, host := defineServeFlags(fs, &cmd)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "使用方法:\n")
+		fmt.Fprintf(stderr, "  %s serve [オプション]\n\n", name)
+		fmt.Fprintf(stderr, "オプション:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	usageError := func(msg string) (*Command, error) {
+		fmt.Fprintf(stderr, "エラー: %s\n\n", msg)
+		fs.Usage()
+		return nil, ErrUsage
+	}
+	switch {
+	case fs.NArg() != 0:
+		return usageError("serve は引数を受け付けません")
+	case *port < 0 || *port > 65535:
+		return usageError("-p は0〜65535を指定してください")
+	}
+	if _, err := common.ParseBytes(cmd.MaxUpload); err != nil {
+		return usageError("-max-upload: " + err.Error())
+	}
+	cmd.Mode = ModeServe
+	cmd.Addr = net.JoinHostPort(*host, strconv.Itoa(*port))
+	return &cmd, nil
+}
+
+// defineServeFlags は ParseServe のフラグを fs に定義し、-p と -host のフラグを返します
+func defineServeFlags(fs *flag.FlagSet, cmd *Command) (port *int, host *string) {
+	port = fs.Int("p", 8080, "待ち受けるポート")
+	host = fs.String("host", "localhost", "待ち受けるホスト（他のコンピューターから使う場合は 0.0.0.0）")
+	fs.StringVar(&cmd.MaxUpload, "max-upload", "1M", "アップロードまたは貼り付けるデータの最大サイズ (例: 4M)")
+	return port, host
+}
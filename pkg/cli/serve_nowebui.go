@@ -0,0 +1,11 @@
+//go:build nowebui
+
+package cli
+
+import "errors"
+
+// Serve は -tags nowebui でビルドした場合、Web UIが組み込まれていないためエラーを返します
+// 組み込まれている機能は -version で確認できます。
+func (r *Runner) Serve(addr string) error {
+	return errors.New("このビルドにはWeb UIが組み込まれていません（-tags nowebui）")
+}
@@ -0,0 +1,41 @@
+//go:build !nowebui
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/webui"
+)
+
+// serveReadTimeout はWeb UIのサーバーがリクエスト全体を読み込むまでの時間の上限です
+const serveReadTimeout = 30 * time.Second
+
+// Serve は addr でWeb UI（webui.NewHandler）を起動し、サーバーが止まるまで戻りません
+// アップロードの最大サイズは MaxUpload（空の場合は webui.DefaultMaxUpload）です。
+func (r *Runner) Serve(addr string) error {
+	var opts webui.Options
+	if r.MaxUpload != "" {
+		limit, err := common.ParseBytes(r.MaxUpload)
+		if err != nil {
+			return fmt.Errorf("-max-upload: %w", err)
+		}
+		opts.MaxUpload = limit
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("待ち受けエラー: %w", err)
+	}
+	fmt.Fprintf(r.Out, "✅ Web UI: http://%s/ （Ctrl+C で終了）\n", l.Addr())
+	srv := &http.Server{
+		Handler:           webui.NewHandler(opts),
+		ReadHeaderTimeout: serveReadTimeout,
+		ReadTimeout:       serveReadTimeout,
+	}
+	return srv.Serve(l)
+}
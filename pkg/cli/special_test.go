@@ -0,0 +1,157 @@
+//go:build unix
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/archive"
+)
+
+// TestCompress_SpecialFiles は名前付きパイプを含むディレクトリを、フィルタを指定して圧縮します
+// 名前付きパイプを読み込むと書き込み側が現れるまで止まるため、止まらずに終わることも確認します。
+func TestCompress_SpecialFiles(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"README.md":             "readme",
+		"src/main.go":           "package main",
+		"src/util/util.go":      "package util",
+		"src/util/util_test.go": "package util",
+		"build/out.bin":         "binary",
+		"logs/today.log":        "log",
+		"big.dat":               strings.Repeat("x", 4096),
+		"notes.txt":             "notes",
+	}
+	for name, data := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fifo := filepath.Join(src, "src", "pipe")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skipf("mkfifo is not supported: %v", err)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	r, out := newTestRunner(nil, Options{Format: "zip", Exclude: "build,*.log,**/*_test.go", MaxFileSize: "1K"})
+	if err := r.Compress(src, output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar, err := archive.Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ar.Entries() {
+		names = append(names, e.Name)
+	}
+	if want := []string{"README.md", "notes.txt", "src/main.go", "src/util/util.go"}; !slices.Equal(names, want) {
+		t.Errorf("Expected entries %v, got %v", want, names)
+	}
+	// build（ディレクトリ1つ）、today.log、util_test.go が除外、big.dat がサイズ超過、pipe が特殊なファイル
+	if !strings.Contains(out.String(), "スキップ: 除外 3, サイズ超過 1, 特殊なファイル 1") {
+		t.Errorf("Expected the skip summary in:\n%s", out)
+	}
+	if stderr := r.Err.(*bytes.Buffer).String(); !strings.Contains(stderr, "src/pipe は通常のファイルではありません") {
+		t.Errorf("Expected a warning for the FIFO, got %q", stderr)
+	}
+
+	// -include で選んだファイルだけを追加する
+	r, out = newTestRunner(nil, Options{Format: "tza", Algorithm: "lz77", Include: "src/**/*.go", Exclude: "*_test.go", Force: true})
+	if err := r.Compress(src, output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	data, _ = os.ReadFile(output)
+	if ar, err := archive.Open(data); err != nil || len(ar.Entries()) != 2 {
+		t.Errorf("Expected 2 entries, got %v (err %v)", ar, err)
+	}
+	if !strings.Contains(out.String(), "除外 1, 対象外 5") {
+		t.Errorf("Expected the skip summary in:\n%s", out)
+	}
+
+	// -special error: 名前付きパイプは失敗したファイルとして報告し、残りは書き込む
+	r, _ = newTestRunner(nil, Options{Format: "zip", Special: specialError, Force: true})
+	var exitErr *ExitError
+	if err := r.Compress(src, output); !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Errorf("Expected an exit error for the FIFO, got %v", err)
+	}
+	if stderr := r.Err.(*bytes.Buffer).String(); !strings.Contains(stderr, "src/pipe: "+archive.ErrSpecialFile.Error()) {
+		t.Errorf("Expected the FIFO in the failed files, got %q", stderr)
+	}
+
+	// -i に名前付きパイプを直接指定した場合
+	r, out = newTestRunner(nil, Options{})
+	if err := r.Compress(fifo, filepath.Join(t.TempDir(), "pipe.tzz")); err != nil || out.Len() != 0 {
+		t.Errorf("Expected the FIFO to be skipped, got %v\n%s", err, out)
+	}
+	r, _ = newTestRunner(nil, Options{Special: specialError})
+	if err := r.Compress(fifo, filepath.Join(t.TempDir(), "pipe.tzz")); err == nil || !strings.Contains(err.Error(), "名前付きパイプ") {
+		t.Errorf("Expected a special file error, got %v", err)
+	}
+}
+
+// TestCompress_Symlinks はシンボリックリンクを含むディレクトリを、デフォルトと -follow-symlinks で圧縮して展開します
+func TestCompress_Symlinks(t *testing.T) {
+	base := t.TempDir()
+	src := filepath.Join(base, "src")
+	if err := os.MkdirAll(filepath.Join(src, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "dir", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{"link": "dir/a.txt", "dir/loop": "..", "etc": "/etc"} {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	// デフォルト: リンク先を記録し、展開では中を指すリンクだけを作成する
+	output := filepath.Join(base, "src.tza")
+	r, _ := newTestRunner(nil, Options{Format: "tza", Algorithm: "lz77"})
+	if err := r.Compress(src, output); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	extracted := filepath.Join(base, "extracted")
+	r, out := newTestRunner(nil, Options{})
+	if err := r.Decompress(output, extracted); err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "シンボリックリンク: 作成 2, 作成しなかった 1（-symlinks internal）") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if target, err := os.Readlink(filepath.Join(extracted, "link")); err != nil || target != "dir/a.txt" {
+		t.Errorf("Expected the link to be restored, got %q (err %v)", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(extracted, "etc")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the external link not to be created, got %v", err)
+	}
+
+	// -follow-symlinks: 循環するリンクと外を指すリンクは警告して飛ばす
+	r, out = newTestRunner(nil, Options{Format: "zip", FollowSymlinks: true})
+	if err := r.Compress(src, filepath.Join(base, "src.zip")); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "2 エントリ") || !strings.Contains(out.String(), "スキップ: 循環するリンク 1, 外を指すリンク 1") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	stderr := r.Err.(*bytes.Buffer).String()
+	if !strings.Contains(stderr, "dir/loop はたどると循環する") || !strings.Contains(stderr, "etc は "+src+" の外を指す") {
+		t.Errorf("Expected warnings for the cycle and the external link, got %q", stderr)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// Version はビルドの情報と、組み込まれているアルゴリズムと機能を表示します（-version）
+// 情報は common.BuildInfo で、JSON の場合は common.Build を1行で出力します。
+func (r *Runner) Version() error {
+	b := common.BuildInfo()
+	if r.JSON {
+		if err := json.NewEncoder(r.Out).Encode(b); err != nil {
+			return fmt.Errorf("出力エラー: %w", err)
+		}
+		return nil
+	}
+	fprintBuild(r.Out, b)
+	return nil
+}
+
+// fprintAlgorithms は登録済みのアルゴリズムの説明を w に表示します（-version と使用方法）
+// 1行目は名前・展開できる形式バージョンの範囲・説明、2行目は能力と向いているデータです。
+func fprintAlgorithms(w io.Writer, algos []common.Algorithm) {
+	for _, a := range algos {
+		versions := strconv.Itoa(a.FormatVersion)
+		if a.MinFormatVersion != a.FormatVersion {
+			versions = fmt.Sprintf("%d-%d", a.MinFormatVersion, a.FormatVersion)
+		}
+		capabilities := "-"
+		if len(a.Capabilities) > 0 {
+			capabilities = strings.Join(a.Capabilities, ", ")
+		}
+		fmt.Fprintf(w, "  %-14s %-4s %s\n", a.Name, versions, a.Description)
+		fmt.Fprintf(w, "  %-14s %-4s 能力: %s／用途: %s\n", "", "", capabilities, a.UseCase)
+	}
+}
+
+// fprintBuild は b を人が読む形式で w に表示します
+func fprintBuild(w io.Writer, b common.Build) {
+	fmt.Fprintf(w, "TinyZipZap %s\n", b)
+	if b.Module != "" {
+		fmt.Fprintf(w, "モジュール: %s\n", b.Module)
+	}
+	if b.CommitTime != "" {
+		fmt.Fprintf(w, "コミット:   %s\n", b.CommitTime)
+	}
+	fmt.Fprintf(w, "Go:         %s %s/%s\n", b.GoVersion, b.OS, b.Arch)
+
+	fmt.Fprintf(w, "\nアルゴリズム（形式バージョン）:\n")
+	fprintAlgorithms(w, b.Algorithms)
+
+	fmt.Fprintf(w, "\n機能:\n")
+	for _, f := range b.Features {
+		fmt.Fprintf(w, "  %-14s %s", f.Name, f.Description)
+		if len(f.Versions) > 0 {
+			versions := make([]string, len(f.Versions))
+			for i, v := range f.Versions {
+				versions[i] = strconv.Itoa(v)
+			}
+			fmt.Fprintf(w, "（バージョン %s）", strings.Join(versions, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StatsAggregate は複数の圧縮結果の集計です
+// 全体の圧縮率は各結果の圧縮率の平均ではなく、圧縮後の合計サイズ / 元の合計サイズです。
+// ゼロ値は空の集計としてそのまま使用できます。
+type StatsAggregate struct {
+	Count           int               `json:"count"`                 // 集計した結果の数
+	TotalOriginal   int64             `json:"total_original_size"`   // 元のサイズの合計
+	TotalCompressed int64             `json:"total_compressed_size"` // 圧縮後のサイズの合計
+	TotalDuration   time.Duration     `json:"total_duration_ns"`     // 処理時間の合計
+	Best            *CompressionStats `json:"best"`                  // 圧縮率が最も小さい結果（空の入力は除く）
+	Worst           *CompressionStats `json:"worst"`                 // 圧縮率が最も大きい結果（空の入力は除く）
+}
+
+// Add は1つの圧縮結果を集計に加えます
+// 圧縮率が同じ結果では、先に加えたものを最良・最悪として残します
+func (a *StatsAggregate) Add(s CompressionStats) {
+	a.Count++
+	a.TotalOriginal += s.OriginalSize
+	a.TotalCompressed += s.CompressedSize
+	a.TotalDuration += s.Duration
+
+	// 空の入力は圧縮率が定義できないため、最良・最悪の候補にしない
+	if s.OriginalSize <= 0 {
+		return
+	}
+	if a.Best == nil || ratioOf(s) < ratioOf(*a.Best) {
+		best := s
+		a.Best = &best
+	}
+	if a.Worst == nil || ratioOf(s) > ratioOf(*a.Worst) {
+		worst := s
+		a.Worst = &worst
+	}
+}
+
+// Merge は別の集計を加えます
+// 結果は、a に加えた結果の後に other に加えた結果をすべて Add した場合と同じです
+func (a *StatsAggregate) Merge(other StatsAggregate) {
+	a.Count += other.Count
+	a.TotalOriginal += other.TotalOriginal
+	a.TotalCompressed += other.TotalCompressed
+	a.TotalDuration += other.TotalDuration
+
+	if other.Best != nil && (a.Best == nil || ratioOf(*other.Best) < ratioOf(*a.Best)) {
+		best := *other.Best
+		a.Best = &best
+	}
+	if other.Worst != nil && (a.Worst == nil || ratioOf(*other.Worst) > ratioOf(*a.Worst)) {
+		worst := *other.Worst
+		a.Worst = &worst
+	}
+}
+
+// Ratio は全体の圧縮率を返します（元の合計サイズが0の場合は0）
+func (a StatsAggregate) Ratio() float64 {
+	if a.TotalOriginal <= 0 {
+		return 0
+	}
+	return float64(a.TotalCompressed) / float64(a.TotalOriginal)
+}
+
+// Summary は集計を1行で返します
+func (a StatsAggregate) Summary() string {
+	return fmt.Sprintf("%d 件: %s -> %s (%.2f%%), 処理時間 %v",
+		a.Count, FormatBytes(a.TotalOriginal), FormatBytes(a.TotalCompressed),
+		a.Ratio()*100, a.TotalDuration.Round(time.Microsecond))
+}
+
+// MarshalJSON は集計を全体の圧縮率 "ratio" を含めてJSONに変換します（json.Marshaler）
+func (a StatsAggregate) MarshalJSON() ([]byte, error) {
+	// 別の型にして MarshalJSON の再帰呼び出しを避ける
+	type aggregate StatsAggregate
+	return json.Marshal(struct {
+		aggregate
+		Ratio float64 `json:"ratio"`
+	}{aggregate(a), a.Ratio()})
+}
+
+// ratioOf はサイズから圧縮率を計算します（CalculateRatio を呼んでいない結果にも使えるように）
+func ratioOf(s CompressionStats) float64 {
+	return float64(s.CompressedSize) / float64(s.OriginalSize)
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// aggregateEntries は集計のテストに使う3つの結果です（c は圧縮で大きくなる）
+func aggregateEntries() []CompressionStats {
+	entries := []CompressionStats{
+		{OriginalSize: 1000, CompressedSize: 250, Duration: 10 * time.Millisecond, Source: "a.txt"},
+		{OriginalSize: 2000, CompressedSize: 1000, Duration: 20 * time.Millisecond, Source: "b.log"},
+		{OriginalSize: 500, CompressedSize: 520, Duration: 5 * time.Millisecond, Source: "c.png"},
+	}
+	for i := range entries {
+		entries[i].Algorithm = "LZ77"
+		entries[i].CalculateRatio()
+	}
+	return entries
+}
+
+func TestStatsAggregate_Add(t *testing.T) {
+	var agg StatsAggregate
+	for _, s := range aggregateEntries() {
+		agg.Add(s)
+	}
+
+	if agg.Count != 3 || agg.TotalOriginal != 3500 || agg.TotalCompressed != 1770 {
+		t.Errorf("Unexpected totals: %+v", agg)
+	}
+	if agg.TotalDuration != 35*time.Millisecond {
+		t.Errorf("Expected total duration 35ms, got %v", agg.TotalDuration)
+	}
+
+	// 1770 / 3500 = 0.5057...（圧縮率の平均 (0.25+0.5+1.04)/3 = 0.5967 ではない）
+	if math.Abs(agg.Ratio()-1770.0/3500.0) > 1e-12 {
+		t.Errorf("Expected overall ratio %f, got %f", 1770.0/3500.0, agg.Ratio())
+	}
+	if agg.Best == nil || agg.Best.Source != "a.txt" {
+		t.Errorf("Expected a.txt as best, got %+v", agg.Best)
+	}
+	if agg.Worst == nil || agg.Worst.Source != "c.png" {
+		t.Errorf("Expected c.png as worst, got %+v", agg.Worst)
+	}
+
+	// 空の入力は件数にだけ数え、最良・最悪の候補にしない
+	agg.Add(CompressionStats{Source: "empty"})
+	if agg.Count != 4 || agg.Best.Source != "a.txt" || agg.Worst.Source != "c.png" {
+		t.Errorf("Empty entry changed best/worst: %+v", agg)
+	}
+}
+
+func TestStatsAggregate_Merge(t *testing.T) {
+	entries := append(aggregateEntries(),
+		CompressionStats{OriginalSize: 100, CompressedSize: 10, Source: "d.bin"},
+		CompressionStats{Source: "empty"},
+	)
+
+	var all StatsAggregate
+	for _, s := range entries {
+		all.Add(s)
+	}
+
+	for split := 0; split <= len(entries); split++ {
+		var first, second StatsAggregate
+		for _, s := range entries[:split] {
+			first.Add(s)
+		}
+		for _, s := range entries[split:] {
+			second.Add(s)
+		}
+		first.Merge(second)
+
+		if !reflect.DeepEqual(first, all) {
+			t.Errorf("split %d: Merge result %+v differs from %+v", split, first, all)
+		}
+	}
+}
+
+func TestStatsAggregate_Empty(t *testing.T) {
+	var agg StatsAggregate
+	if agg.Ratio() != 0 || agg.Best != nil || agg.Worst != nil {
+		t.Errorf("Unexpected zero aggregate: %+v", agg)
+	}
+	if !strings.HasPrefix(agg.Summary(), "0 件") {
+		t.Errorf("Unexpected summary %q", agg.Summary())
+	}
+}
+
+func TestStatsAggregate_SummaryAndJSON(t *testing.T) {
+	var agg StatsAggregate
+	for _, s := range aggregateEntries() {
+		agg.Add(s)
+	}
+
+	summary := agg.Summary()
+	for _, want := range []string{"3 件", "3.4 KB", "1.7 KB", "50.57%", "35ms"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary %q does not contain %q", summary, want)
+		}
+	}
+
+	data, err := json.Marshal(agg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded struct {
+		Count           int              `json:"count"`
+		TotalOriginal   int64            `json:"total_original_size"`
+		TotalCompressed int64            `json:"total_compressed_size"`
+		TotalDuration   int64            `json:"total_duration_ns"`
+		Ratio           float64          `json:"ratio"`
+		Best            CompressionStats `json:"best"`
+		Worst           CompressionStats `json:"worst"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Count != 3 || decoded.TotalOriginal != 3500 || decoded.TotalCompressed != 1770 ||
+		decoded.TotalDuration != int64(35*time.Millisecond) {
+		t.Errorf("Unexpected JSON totals: %s", data)
+	}
+	if math.Abs(decoded.Ratio-agg.Ratio()) > 1e-12 {
+		t.Errorf("Expected ratio %f in JSON, got %f", agg.Ratio(), decoded.Ratio)
+	}
+	if decoded.Best.Source != "a.txt" || decoded.Worst.Source != "c.png" || decoded.Worst.OriginalSize != 500 {
+		t.Errorf("Unexpected best/worst in JSON: %s", data)
+	}
+}
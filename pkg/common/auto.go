@@ -0,0 +1,57 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat は DecompressAuto に渡したデータが登録済みのどの形式でもない場合のエラーです
+var ErrUnknownFormat = errors.New("unknown self-describing format")
+
+// AutoFormat は構成を先頭に記録した（自己記述的な）圧縮データの形式です
+// pipeline のように、展開に使う Compressor を圧縮データだけから組み立てられる形式を
+// 各パッケージの init() から RegisterAutoFormat で登録します。
+type AutoFormat struct {
+	Name       string                                                    // 形式の名前（"pipeline" など）
+	Magic      string                                                    // 圧縮データの先頭のマジック
+	Decompress func(data []byte, opts DecompressOptions) ([]byte, error) // 構成を読み込んで展開する関数
+}
+
+var (
+	autoFormatsMu sync.RWMutex
+	autoFormats   []AutoFormat
+)
+
+// RegisterAutoFormat は自己記述的な形式を登録します
+// 名前かマジックが空の場合と、ほかの形式のマジックと前方一致する場合はpanicします。
+func RegisterAutoFormat(f AutoFormat) {
+	autoFormatsMu.Lock()
+	defer autoFormatsMu.Unlock()
+
+	if f.Name == "" || f.Magic == "" || f.Decompress == nil {
+		panic("common: RegisterAutoFormat requires a name, magic and decompress function")
+	}
+	for _, other := range autoFormats {
+		if strings.HasPrefix(f.Magic, other.Magic) || strings.HasPrefix(other.Magic, f.Magic) {
+			panic(fmt.Sprintf("common: RegisterAutoFormat magic of %q conflicts with %q", f.Name, other.Name))
+		}
+	}
+	autoFormats = append(autoFormats, f)
+}
+
+// DecompressAuto は data の先頭のマジックから形式を判別し、記録された構成で展開します
+// どの登録済みの形式でもない場合は ErrUnknownFormat を返します。
+func DecompressAuto(data []byte, opts DecompressOptions) ([]byte, error) {
+	autoFormatsMu.RLock()
+	formats := autoFormats
+	autoFormatsMu.RUnlock()
+
+	for _, f := range formats {
+		if strings.HasPrefix(string(data[:min(len(data), len(f.Magic))]), f.Magic) {
+			return f.Decompress(data, opts)
+		}
+	}
+	return nil, ErrUnknownFormat
+}
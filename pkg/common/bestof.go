@@ -0,0 +1,231 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// BestOfAlgorithm は NewBestOf の Compressor の名前です
+const BestOfAlgorithm = "best"
+
+// MaxBestOfCandidates は NewBestOf に渡せる候補の最大数です
+const MaxBestOfCandidates = 255
+
+// bestOf は候補のうち最も小さくなった結果を選ぶ Compressor です
+//
+// 出力の形式
+//
+//	候補の番号(1バイト) + 本体
+//
+// 番号が0なら本体は元のデータそのまま（stored）、k (1〜255) なら candidates[k-1] で
+// 圧縮したデータです。
+type bestOf struct {
+	candidates []Compressor
+	parallel   bool
+	policy     Policy // Strict の場合は元のデータをそのまま格納せずにエラーにする
+}
+
+// NewBestOf は candidates をすべて試し、最も小さくなった結果を使う Compressor を作成します
+// 出力の先頭の1バイトに使った候補の番号を記録するため、展開は同じ順序の candidates で
+// 作成した Compressor で行います。どの候補でも元のサイズより小さくならない場合は元の
+// データをそのまま格納するため、出力は最大でも元のサイズ + 1バイトです。サイズが同じ
+// 結果では先の候補を使います。candidates が MaxBestOfCandidates を超える場合は panic します。
+func NewBestOf(candidates ...Compressor) Compressor {
+	return newBestOf(candidates, false)
+}
+
+// NewParallelBestOf は NewBestOf と同じですが、候補ごとにゴルーチンで同時に圧縮します
+// 出力は NewBestOf と同じです。それまでの最小のサイズ以上になった結果はすぐに捨てるため、
+// 同時に保持する結果は圧縮中のものと最小のものだけです。
+func NewParallelBestOf(candidates ...Compressor) Compressor {
+	return newBestOf(candidates, true)
+}
+
+func newBestOf(candidates []Compressor, parallel bool) *bestOf {
+	if len(candidates) > MaxBestOfCandidates {
+		panic(fmt.Sprintf("common: too many candidates for NewBestOf: %d (max %d)", len(candidates), MaxBestOfCandidates))
+	}
+	return &bestOf{candidates: append([]Compressor(nil), candidates...), parallel: parallel}
+}
+
+// Name はアルゴリズム名を返します
+func (b *bestOf) Name() string {
+	return BestOfAlgorithm
+}
+
+// Compress は最も小さくなった候補の結果に、その番号を付けて返します
+func (b *bestOf) Compress(data []byte) ([]byte, error) {
+	var (
+		best      []byte
+		bestIndex int
+		err       error
+	)
+	if len(data) > 0 {
+		if b.parallel {
+			best, bestIndex, err = b.compressParallel(data)
+		} else {
+			best, bestIndex, err = b.compressSequential(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if best == nil {
+		if len(data) > 0 {
+			if err := b.policy.RefuseStored(); err != nil {
+				return nil, err
+			}
+		}
+		best, bestIndex = data, -1
+	}
+
+	out := make([]byte, 0, 1+len(best))
+	out = append(out, byte(bestIndex+1))
+	return append(out, best...), nil
+}
+
+// compressSequential は候補を順に試し、元のサイズより小さくなった最小の結果とその番号を返します
+// そのような結果がない場合は nil を返します。
+func (b *bestOf) compressSequential(data []byte) ([]byte, int, error) {
+	var best []byte
+	bestIndex := -1
+	for i, c := range b.candidates {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", c.Name(), err)
+		}
+		if len(compressed) < len(data) && (best == nil || len(compressed) < len(best)) {
+			best, bestIndex = compressed, i
+		}
+	}
+	return best, bestIndex, nil
+}
+
+// compressParallel は compressSequential と同じ結果を、候補ごとのゴルーチンで求めます
+// 各ゴルーチンは圧縮が終わるとすぐにそれまでの最小の結果と比べ、小さくなければ
+// 結果を捨てます。小さければ、それまでの最小の結果を捨てて置き換えます。
+func (b *bestOf) compressParallel(data []byte) ([]byte, int, error) {
+	var (
+		mu        sync.Mutex
+		best      []byte
+		bestIndex = -1
+		errs      = make([]error, len(b.candidates))
+		wg        sync.WaitGroup
+	)
+	for i, c := range b.candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			compressed, err := c.Compress(data)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", c.Name(), err)
+				return
+			}
+			if len(compressed) >= len(data) {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// サイズが同じなら番号の小さい候補を選び、順に試した場合と同じ結果にする
+			if best == nil || len(compressed) < len(best) || (len(compressed) == len(best) && i < bestIndex) {
+				best, bestIndex = compressed, i
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 順に試した場合と同じく、番号の最も小さい候補のエラーを返す
+	for _, err := range errs {
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return best, bestIndex, nil
+}
+
+// WithPolicy は p に従う bestOf を返します（PolicyAware）
+// Strict の場合、どの候補でも小さくならないデータは元のまま格納せずに *StrictError を返します。
+// 候補にも同じ Policy を設定します。
+func (b *bestOf) WithPolicy(p Policy) Compressor {
+	c := *b
+	c.policy = p
+	c.candidates = make([]Compressor, len(b.candidates))
+	for i, candidate := range b.candidates {
+		c.candidates[i] = WithPolicy(candidate, p)
+	}
+	return &c
+}
+
+// Decompress は先頭のバイトが表す候補で展開します
+func (b *bestOf) Decompress(data []byte) ([]byte, error) {
+	return b.DecompressWithOptions(data, DecompressOptions{})
+}
+
+// DecompressWithOptions は先頭のバイトが表す候補で、制限付きで展開します
+func (b *bestOf) DecompressWithOptions(data []byte, opts DecompressOptions) ([]byte, error) {
+	index, err := b.index(data)
+	if err != nil {
+		return nil, err
+	}
+	body := data[1:]
+	if index < 0 {
+		if err := opts.ReserveOutput(int64(len(body)), int64(len(body))); err != nil {
+			return nil, err
+		}
+		return append([]byte{}, body...), nil
+	}
+	return DecompressWithOptions(b.candidates[index], body, opts)
+}
+
+// index は出力 data の先頭のバイトが表す候補の番号を返します（格納した場合は-1）
+func (b *bestOf) index(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, NewDecodeError("best", data, 0, "候補の番号がありません")
+	}
+	index := int(data[0]) - 1
+	if index >= len(b.candidates) {
+		return 0, NewDecodeError("best", data, 0, "候補 %d がありません（%d 個）", index+1, len(b.candidates))
+	}
+	return index, nil
+}
+
+// BestOfCandidate は NewBestOf（NewParallelBestOf）で作成した c の出力 data で
+// 使われた候補の名前を返します
+// 元のデータをそのまま格納した場合は StoredAlgorithm を、c が NewBestOf で作成した
+// Compressor でない場合はエラーを返します。
+func BestOfCandidate(c Compressor, data []byte) (string, error) {
+	b, ok := c.(*bestOf)
+	if !ok {
+		return "", fmt.Errorf("%s is not a best-of compressor", c.Name())
+	}
+	index, err := b.index(data)
+	if err != nil {
+		return "", err
+	}
+	if index < 0 {
+		return StoredAlgorithm, nil
+	}
+	return b.candidates[index].Name(), nil
+}
+
+// WorkingMemory は候補の作業領域と結果の目安を返します（MemoryReporter）
+// 並列の場合は候補ごとに1つのワーカー、順に試す場合は最も大きい候補の1つのワーカーです。
+// 結果は元のサイズ以上になると捨てるため、結果の分は n バイトとします。目安のない候補の
+// 作業領域は0とします。
+func (b *bestOf) WorkingMemory(n int) []int64 {
+	workers := make([]int64, len(b.candidates))
+	for i, c := range b.candidates {
+		workers[i] = int64(n)
+		if memory, ok := WorkingMemory(c, n); ok {
+			for _, m := range memory {
+				workers[i] += m
+			}
+		}
+	}
+	if b.parallel || len(workers) == 0 {
+		return workers
+	}
+	return []int64{slices.Max(workers)}
+}
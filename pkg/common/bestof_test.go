@@ -0,0 +1,120 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// bestOfCandidates は NewBestOf のテストで使う候補です
+func bestOfCandidates() []common.Compressor {
+	return []common.Compressor{rle.NewCompressor(), lz77.NewCompressor(), huffman.NewCompressor()}
+}
+
+// runHeavy は長さの異なるランが続くデータです
+func runHeavy() []byte {
+	var data []byte
+	for i := range 64 {
+		data = append(data, bytes.Repeat([]byte{byte('a' + i%26)}, 40+i%7)...)
+	}
+	return data
+}
+
+const englishText = `It was the best of times, it was the worst of times, it was the age of wisdom,
+it was the age of foolishness, it was the epoch of belief, it was the epoch of incredulity,
+it was the season of Light, it was the season of Darkness, it was the spring of hope,
+it was the winter of despair, we had everything before us, we had nothing before us,
+we were all going direct to Heaven, we were all going direct the other way.`
+
+func TestBestOf_Choice(t *testing.T) {
+	rleName, lz77Name, huffmanName := rle.NewCompressor().Name(), lz77.NewCompressor().Name(), huffman.NewCompressor().Name()
+	tests := map[string]struct {
+		data []byte
+		want []string // 選ばれるべき候補の名前のいずれか
+	}{
+		"runs":    {runHeavy(), []string{rleName}},
+		"english": {[]byte(englishText), []string{lz77Name, huffmanName}},
+		"random":  {testcorpus.Random(2048, 7), []string{common.StoredAlgorithm}},
+	}
+	for name, tt := range tests {
+		for _, parallel := range []bool{false, true} {
+			c := common.NewBestOf(bestOfCandidates()...)
+			if parallel {
+				c = common.NewParallelBestOf(bestOfCandidates()...)
+			}
+			compressed, err := c.Compress(tt.data)
+			if err != nil {
+				t.Fatalf("%s: Compress failed: %v", name, err)
+			}
+			used, err := common.BestOfCandidate(c, compressed)
+			if err != nil {
+				t.Fatalf("%s: BestOfCandidate failed: %v", name, err)
+			}
+			if !slices.Contains(tt.want, used) {
+				t.Errorf("%s (parallel=%v): Expected one of %v, got %s", name, parallel, tt.want, used)
+			}
+			if len(compressed) > len(tt.data)+1 {
+				t.Errorf("%s: Expected at most %d bytes, got %d", name, len(tt.data)+1, len(compressed))
+			}
+
+			got, err := c.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("%s: Decompress failed: %v", name, err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("%s: Round trip mismatch", name)
+			}
+		}
+	}
+}
+
+// TestBestOf_ParallelMatchesSequential は並列に試しても順に試した場合と同じ出力になることを確認します
+func TestBestOf_ParallelMatchesSequential(t *testing.T) {
+	sequential := common.NewBestOf(bestOfCandidates()...)
+	parallel := common.NewParallelBestOf(bestOfCandidates()...)
+	for _, s := range testcorpus.Samples() {
+		want, err := sequential.Compress(s.Data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", s.Name, err)
+		}
+		got, err := parallel.Compress(s.Data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", s.Name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: Expected the same output as sequential", s.Name)
+		}
+		decompressed, err := parallel.Decompress(got)
+		if err != nil || !bytes.Equal(decompressed, s.Data) {
+			t.Errorf("%s: Round trip failed: %v", s.Name, err)
+		}
+	}
+}
+
+func TestBestOf_Invalid(t *testing.T) {
+	c := common.NewBestOf(bestOfCandidates()...)
+	for name, data := range map[string][]byte{
+		"empty":        {},
+		"no candidate": {4, 'x'},
+		"bad body":     {1, 0xff},
+	} {
+		if _, err := c.Decompress(data); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: Expected ErrInvalidData, got %v", name, err)
+		}
+	}
+
+	stored := append([]byte{0}, make([]byte, 100)...)
+	if _, err := c.(common.OptionsDecompressor).DecompressWithOptions(stored, common.DecompressOptions{MaxOutputSize: 10}); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if _, err := common.BestOfCandidate(rle.NewCompressor(), stored); err == nil {
+		t.Error("Expected an error for a compressor not created by NewBestOf")
+	}
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+var (
+	// ErrBudgetExceeded はメモリ予算を超えた場合のエラーです
+	ErrBudgetExceeded = errors.New("memory budget exceeded")
+
+	// ErrOutputTooLarge は展開結果が出力サイズの上限を超える場合のエラーです
+	ErrOutputTooLarge = errors.New("decompressed output too large")
+)
+
+// Budget は展開処理で使用するメモリの予算です
+// 出力バッファだけでなく、Huffman木やトークン列などの内部構造も含めて
+// 各デコーダーが確保する前に Reserve で申告します。
+// nil の Budget は無制限として扱われます。複数のゴルーチンから同時に使用できます。
+type Budget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// NewBudget は limit バイトまでの予算を作成します（0以下は無制限）
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Reserve は n バイトの使用を申告します
+// 予算を超える場合は ErrBudgetExceeded を返し、使用量は変わりません
+func (b *Budget) Reserve(n int64) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+
+	used := b.used.Add(n)
+	if b.limit > 0 && used > b.limit {
+		b.used.Add(-n)
+		return fmt.Errorf("%w: requested %d bytes, used %d of %d bytes",
+			ErrBudgetExceeded, n, used-n, b.limit)
+	}
+	return nil
+}
+
+// Release は Reserve した n バイトを返却します（一時的なバッファを解放した後に呼び出します）
+func (b *Budget) Release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.used.Add(-n)
+}
+
+// Used は現在の使用量を返します
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// Limit は予算の上限を返します（0は無制限）
+func (b *Budget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// DecompressOptions は信頼できない入力を展開するときの制限です
+type DecompressOptions struct {
+	// MaxOutputSize は展開結果の最大サイズです（0は無制限）
+	MaxOutputSize int64
+
+	// Budget は出力と内部構造を合わせたメモリ予算です（nilは無制限）
+	Budget *Budget
+
+	// OnDamage は壊れたブロックを読み飛ばして展開を続ける場合に、ブロックごとに呼び出す関数です
+	// nil の場合は最初のエラーで止めます。対応する形式（blocks）は、展開できないブロックの
+	// 代わりに元のサイズ分の Fill を出力し、ブロックの順に OnDamage を呼び出します。
+	// OnDamage がエラーを返した場合はそのエラーで止めます。ヘッダーが壊れてブロックの
+	// 大きさがわからない場合や、予算を超えた場合は、OnDamage を指定してもエラーです。
+	OnDamage func(DamagedBlock) error
+
+	// Fill は OnDamage を指定した場合に、壊れたブロックの代わりに繰り返して出力するパターンです（空は0）
+	Fill []byte
+}
+
+// ReserveOutput は n バイトの出力を確保する前に、出力サイズの上限と予算を確認します
+// total は確保後の出力全体のサイズです
+func (o DecompressOptions) ReserveOutput(n, total int64) error {
+	if o.MaxOutputSize > 0 && total > o.MaxOutputSize {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", ErrOutputTooLarge, total, o.MaxOutputSize)
+	}
+	return o.Budget.Reserve(n)
+}
+
+// OptionsDecompressor は DecompressOptions を受け付ける展開のインターフェースです
+// 実装したデコーダーは、大きな確保を行う前に予算を確認します
+type OptionsDecompressor interface {
+	DecompressWithOptions(data []byte, opts DecompressOptions) ([]byte, error)
+}
+
+// WriterDecompressor は圧縮データを読みながら展開結果を書き込む展開のインターフェースです
+// 入力全体や展開結果全体をメモリに保持しないため、メモリより大きな展開結果も扱えます。
+// 実装は opts の出力サイズの上限とメモリ予算を OptionsDecompressor と同じように確認します。
+type WriterDecompressor interface {
+	DecompressToWriter(src io.Reader, dst io.Writer, opts DecompressOptions) error
+}
+
+// DecompressWithOptions は制限付きで展開します
+// c が OptionsDecompressor を実装していない場合は、展開後に結果のサイズだけを確認します
+func DecompressWithOptions(c Compressor, data []byte, opts DecompressOptions) ([]byte, error) {
+	if od, ok := c.(OptionsDecompressor); ok {
+		return od.DecompressWithOptions(data, opts)
+	}
+
+	result, err := c.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.ReserveOutput(int64(len(result)), int64(len(result))); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
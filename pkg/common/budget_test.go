@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBudget_ReserveRelease(t *testing.T) {
+	b := NewBudget(100)
+
+	if err := b.Reserve(60); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	if err := b.Reserve(50); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if b.Used() != 60 {
+		t.Errorf("Failed reservation must not change usage, got %d", b.Used())
+	}
+
+	b.Release(30)
+	if err := b.Reserve(50); err != nil {
+		t.Errorf("Reserve after release failed: %v", err)
+	}
+	if b.Used() != 80 {
+		t.Errorf("Expected 80 bytes used, got %d", b.Used())
+	}
+}
+
+func TestBudget_NilAndUnlimited(t *testing.T) {
+	var b *Budget
+	if err := b.Reserve(1 << 40); err != nil {
+		t.Errorf("nil budget should be unlimited: %v", err)
+	}
+	b.Release(10)
+
+	if err := NewBudget(0).Reserve(1 << 40); err != nil {
+		t.Errorf("zero limit should be unlimited: %v", err)
+	}
+}
+
+func TestDecompressOptions_ReserveOutput(t *testing.T) {
+	opts := DecompressOptions{MaxOutputSize: 10}
+	if err := opts.ReserveOutput(5, 10); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := opts.ReserveOutput(5, 11); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+
+	opts = DecompressOptions{Budget: NewBudget(4)}
+	if err := opts.ReserveOutput(5, 5); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+// plainCompressor は OptionsDecompressor を実装しないCompressorです
+type plainCompressor struct{}
+
+func (plainCompressor) Name() string                           { return "plain" }
+func (plainCompressor) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (plainCompressor) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+func TestDecompressWithOptions_Fallback(t *testing.T) {
+	data := make([]byte, 100)
+
+	if _, err := DecompressWithOptions(plainCompressor{}, data, DecompressOptions{MaxOutputSize: 50}); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if _, err := DecompressWithOptions(plainCompressor{}, data, DecompressOptions{Budget: NewBudget(50)}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if out, err := DecompressWithOptions(plainCompressor{}, data, DecompressOptions{}); err != nil || len(out) != 100 {
+		t.Errorf("Unexpected result: %d bytes, %v", len(out), err)
+	}
+}
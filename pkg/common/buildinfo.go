@@ -0,0 +1,143 @@
+package common
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Feature は機能（コンテナの形式や、ビルドタグで外せるWeb UIなど）の説明です
+// 各機能のパッケージが init() から RegisterFeature で登録するため、BuildInfo の
+// 機能の一覧は実際にリンクされたパッケージを表します（ビルドタグで外した機能は含まれません）。
+type Feature struct {
+	Name        string `json:"name"`        // 機能の名前（"tzz"、"webui" など）
+	Description string `json:"description"` // 説明
+	Versions    []int  `json:"versions"`    // 読み込みに対応している形式のバージョン（形式を持たない機能は空）
+}
+
+// Algorithm は BuildInfo の登録済みのアルゴリズムです（Descriptor から作成します）
+type Algorithm struct {
+	Name             string   `json:"name"`               // 登録名
+	FormatVersion    int      `json:"format_version"`     // Compress が出力する形式のバージョン（common.Versioned、ない場合は0）
+	MinFormatVersion int      `json:"min_format_version"` // 展開できる最も古い形式のバージョン
+	Capabilities     []string `json:"capabilities"`       // 能力の名前（Capability.Strings）
+	Description      string   `json:"description"`        // 説明
+	UseCase          string   `json:"use_case"`           // 向いているデータや用途
+}
+
+// Build はビルドの情報と、組み込まれているアルゴリズムと機能の一覧です
+// JSONのキーは -version -json の出力の形式で、変更しないでください（追加のみ）。
+type Build struct {
+	Module     string      `json:"module"`      // メインモジュールのパス（分からない場合は空）
+	Version    string      `json:"version"`     // メインモジュールのバージョン（go install @v... 以外は "(devel)"）
+	Revision   string      `json:"revision"`    // VCSのリビジョン（記録されていない場合は空）
+	CommitTime string      `json:"commit_time"` // リビジョンのコミット時刻（RFC 3339、記録されていない場合は空）
+	Dirty      bool        `json:"dirty"`       // コミットしていない変更のある作業ツリーからビルドしたか
+	GoVersion  string      `json:"go_version"`  // ビルドに使ったGoのバージョン
+	OS         string      `json:"os"`          // 実行ファイルの対象のOS（クロスコンパイルではビルドしたマシンと異なる）
+	Arch       string      `json:"arch"`        // 実行ファイルの対象のアーキテクチャ
+	Algorithms []Algorithm `json:"algorithms"`  // 登録済みのアルゴリズム（名前順）
+	Features   []Feature   `json:"features"`    // 登録済みの機能（名前順）
+}
+
+// develVersion はモジュールのバージョンが記録されていない場合の Build.Version です
+const develVersion = "(devel)"
+
+var (
+	featuresMu sync.RWMutex
+	features   = make(map[string]Feature)
+)
+
+// RegisterFeature は機能の説明を登録します
+// Register と同じく各パッケージの init() から呼び出し、同じ名前を二重に登録するとpanicします。
+func RegisterFeature(f Feature) {
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+
+	if f.Name == "" {
+		panic("common: RegisterFeature name is empty")
+	}
+	if _, exists := features[f.Name]; exists {
+		panic(fmt.Sprintf("common: RegisterFeature called twice for feature %q", f.Name))
+	}
+	f.Versions = append([]int{}, f.Versions...)
+	features[f.Name] = f
+}
+
+// Features は登録済みの機能を名前順に返します
+func Features() []Feature {
+	featuresMu.RLock()
+	defer featuresMu.RUnlock()
+
+	list := make([]Feature, 0, len(features))
+	for _, f := range features {
+		f.Versions = append([]int{}, f.Versions...)
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// BuildInfo は実行中のプログラムのビルドの情報を返します
+// バージョンとVCSの情報は runtime/debug.ReadBuildInfo から読み込むため、ソースに
+// バージョンを書く必要はなく、-ldflags なしのクロスコンパイルでも正しい値になります。
+// アルゴリズムと機能は呼び出した時点で登録されているものです。
+func BuildInfo() Build {
+	b := Build{
+		Version:   develVersion,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Features:  Features(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.Module = info.Main.Path
+		if info.Main.Version != "" {
+			b.Version = info.Main.Version
+		}
+		if info.GoVersion != "" {
+			b.GoVersion = info.GoVersion
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.CommitTime = s.Value
+			case "vcs.modified":
+				b.Dirty = s.Value == "true"
+			}
+		}
+	}
+
+	b.Algorithms = []Algorithm{}
+	for _, d := range DescribeAll() {
+		b.Algorithms = append(b.Algorithms, Algorithm{
+			Name:             d.Name,
+			FormatVersion:    int(d.MaxVersion),
+			MinFormatVersion: int(d.MinVersion),
+			Capabilities:     d.Capabilities.Strings(),
+			Description:      d.Description,
+			UseCase:          d.UseCase,
+		})
+	}
+	return b
+}
+
+// String は "v1.2.0 (abc1234, dirty)" のようにバージョンとリビジョンを返します
+func (b Build) String() string {
+	s := b.Version
+	if b.Revision == "" {
+		return s
+	}
+	rev := b.Revision
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if b.Dirty {
+		rev += ", dirty"
+	}
+	return fmt.Sprintf("%s (%s)", s, rev)
+}
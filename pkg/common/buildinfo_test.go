@@ -0,0 +1,94 @@
+package common_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+func TestBuildInfo_Algorithms(t *testing.T) {
+	b := common.BuildInfo()
+	var names []string
+	for _, a := range b.Algorithms {
+		names = append(names, a.Name)
+	}
+	if want := common.Names(); !reflect.DeepEqual(names, want) {
+		t.Errorf("Algorithms = %v, want every registered algorithm %v", names, want)
+	}
+	for _, a := range b.Algorithms {
+		if a.Name == "lz77" && a.FormatVersion == 0 {
+			t.Errorf("lz77 format version = 0, want the version from common.Versioned")
+		}
+	}
+	if b.Version == "" || b.GoVersion == "" || b.OS == "" || b.Arch == "" {
+		t.Errorf("Missing build fields: %+v", b)
+	}
+}
+
+// jsonKeys は v をJSONにしたオブジェクトのキーをソートして返します
+func jsonKeys(t *testing.T, v any) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// -version -json の形式は外部のスクリプトが読むため、キーを変えたらこのテストで気付くようにします
+func TestBuildInfo_JSONSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want []string
+	}{
+		{"build", common.Build{}, []string{"algorithms", "arch", "commit_time", "dirty", "features", "go_version", "module", "os", "revision", "version"}},
+		{"algorithm", common.Algorithm{}, []string{"capabilities", "description", "format_version", "min_format_version", "name", "use_case"}},
+		{"feature", common.Feature{}, []string{"description", "name", "versions"}},
+	}
+	for _, tt := range tests {
+		if got := jsonKeys(t, tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s JSON keys = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterFeature(t *testing.T) {
+	common.RegisterFeature(common.Feature{Name: "test-feature-b", Versions: []int{1, 2}})
+	common.RegisterFeature(common.Feature{Name: "test-feature-a"})
+
+	features := common.Features()
+	i := slices.IndexFunc(features, func(f common.Feature) bool { return f.Name == "test-feature-a" })
+	j := slices.IndexFunc(features, func(f common.Feature) bool { return f.Name == "test-feature-b" })
+	if i < 0 || j != i+1 {
+		t.Fatalf("Features = %+v, want both test features in name order", features)
+	}
+	if !reflect.DeepEqual(features[j].Versions, []int{1, 2}) {
+		t.Errorf("Versions = %v, want [1 2]", features[j].Versions)
+	}
+	// 返した一覧を変更しても登録済みの機能は変わらない
+	features[j].Versions[0] = 9
+	if got := common.Features()[j].Versions[0]; got != 1 {
+		t.Errorf("Registered versions were modified through Features: %d", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for duplicate feature")
+		}
+	}()
+	common.RegisterFeature(common.Feature{Name: "test-feature-a"})
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrCorrupted は展開結果などのデータが記録された内容と一致しない場合のエラーです
+var ErrCorrupted = errors.New("corrupted data")
+
+// SizeError は通過したバイト数が期待したバイト数と一致しない場合のエラーです
+// errors.Is(err, ErrCorrupted) で判定できます。
+type SizeError struct {
+	Expected int64 // 期待したバイト数
+	Actual   int64 // 通過した（多すぎる場合は通過しようとした）バイト数
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%v: expected %d bytes, got %d", ErrCorrupted, e.Expected, e.Actual)
+}
+
+// Unwrap は ErrCorrupted を返します
+func (e *SizeError) Unwrap() error {
+	return ErrCorrupted
+}
+
+// SizeMismatch は展開結果のサイズが記録された元のサイズと異なったことの記録です
+// サイズの不一致を許容する設定（SafetyPolicy.TolerateSizeMismatch など）で展開した場合に、
+// エラーの代わりに CompressionStats.SizeMismatches に記録します。
+type SizeMismatch struct {
+	Member   int   `json:"member"`   // コンテナのメンバーの番号
+	Expected int64 `json:"expected"` // 記録された元のサイズ
+	Actual   int64 `json:"actual"`   // 展開できたバイト数
+}
+
+// Delta は展開結果のサイズと元のサイズの差を返します（足りない場合は負）
+func (m SizeMismatch) Delta() int64 {
+	return m.Actual - m.Expected
+}
+
+func (m SizeMismatch) String() string {
+	return fmt.Sprintf("member %d: expected %d bytes, got %d (%+d)", m.Member, m.Expected, m.Actual, m.Delta())
+}
+
+// DamagedBlock は展開できずに DecompressOptions.Fill で埋めたブロックの記録です
+// DecompressOptions.OnDamage に渡し、ファイルの展開では CompressionStats.Damaged に記録します。
+type DamagedBlock struct {
+	Member int    `json:"member"` // コンテナのメンバーの番号（コンテナでない場合は0）
+	Block  int    `json:"block"`  // メンバーの中でのブロック番号
+	Offset int64  `json:"offset"` // 展開結果の中での開始位置
+	Length int64  `json:"length"` // 埋めたバイト数（ブロックの元のサイズ）
+	Reason string `json:"reason"` // 展開できなかった理由
+}
+
+// End は埋めた範囲の終わり（含まない）の位置を返します
+func (d DamagedBlock) End() int64 {
+	return d.Offset + d.Length
+}
+
+func (d DamagedBlock) String() string {
+	return fmt.Sprintf("member %d block %d: bytes [%d, %d): %s", d.Member, d.Block, d.Offset, d.End(), d.Reason)
+}
+
+// AppendFill は pattern を n バイト分繰り返して dst に追加します（pattern が空の場合は0）
+func AppendFill(dst, pattern []byte, n int) []byte {
+	start := len(dst)
+	dst = slices.Grow(dst, n)[:start+n]
+	if len(pattern) == 0 {
+		clear(dst[start:])
+		return dst
+	}
+	for i := start; i < len(dst); {
+		i += copy(dst[i:], pattern)
+	}
+	return dst
+}
+
+// ExpectedSizeWriter は書き込まれたバイト数がちょうど n になることを確認する Writer です
+type ExpectedSizeWriter struct {
+	w        io.Writer
+	expected int64
+	n        int64
+}
+
+// NewExpectedSizeWriter は w に書き込み、合計が n バイトを超える書き込みを拒否する Writer を作成します
+// 超える書き込みは1バイトも w に書き込まずに *SizeError を返します。n バイトに
+// 足りないことは Close で確認します（Close は w を閉じません）。
+func NewExpectedSizeWriter(w io.Writer, n int64) *ExpectedSizeWriter {
+	return &ExpectedSizeWriter{w: w, expected: n}
+}
+
+// Write は p を書き込みます
+func (w *ExpectedSizeWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.expected-w.n {
+		return 0, &SizeError{Expected: w.expected, Actual: w.n + int64(len(p))}
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Written はこれまでに書き込んだバイト数を返します
+func (w *ExpectedSizeWriter) Written() int64 {
+	return w.n
+}
+
+// Close は書き込んだバイト数が n でなければ *SizeError を返します
+func (w *ExpectedSizeWriter) Close() error {
+	if w.n != w.expected {
+		return &SizeError{Expected: w.expected, Actual: w.n}
+	}
+	return nil
+}
+
+// ExpectedSizeReader は読み込んだバイト数がちょうど n になることを確認する Reader です
+type ExpectedSizeReader struct {
+	r        io.Reader
+	expected int64
+	n        int64
+}
+
+// NewExpectedSizeReader は r から読み込み、r が n バイトちょうどで終わることを確認する Reader を作成します
+// n バイトより前に r が終わった場合は io.EOF の代わりに、n バイトを超えるデータがあった
+// 場合は超えた分を返さずに *SizeError を返します。途中で読むのをやめた場合も Close で
+// 確認できます（Close は r を閉じません）。
+func NewExpectedSizeReader(r io.Reader, n int64) *ExpectedSizeReader {
+	return &ExpectedSizeReader{r: r, expected: n}
+}
+
+// Read は r から読み込みます
+func (r *ExpectedSizeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if over := r.n - r.expected; over > 0 {
+		return max(n-int(over), 0), &SizeError{Expected: r.expected, Actual: r.n}
+	}
+	if err == io.EOF && r.n < r.expected {
+		return n, &SizeError{Expected: r.expected, Actual: r.n}
+	}
+	return n, err
+}
+
+// Close は読み込んだバイト数が n でなければ *SizeError を返します
+func (r *ExpectedSizeReader) Close() error {
+	if r.n != r.expected {
+		return &SizeError{Expected: r.expected, Actual: r.n}
+	}
+	return nil
+}
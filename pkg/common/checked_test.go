@@ -0,0 +1,145 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// assertSizeError は err が期待したバイト数と実際のバイト数の *SizeError であることを確認します
+func assertSizeError(t *testing.T, err error, expected, actual int64) {
+	t.Helper()
+	var sizeErr *common.SizeError
+	if !errors.As(err, &sizeErr) || !errors.Is(err, common.ErrCorrupted) {
+		t.Fatalf("Expected a SizeError, got %v", err)
+	}
+	if sizeErr.Expected != expected || sizeErr.Actual != actual {
+		t.Errorf("Expected %d vs %d bytes, got %+v", expected, actual, *sizeErr)
+	}
+}
+
+func TestExpectedSizeWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := common.NewExpectedSizeWriter(&buf, 10)
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	assertSizeError(t, w.Close(), 10, 5)
+
+	// 超える書き込みは何も書き込まずに拒否する
+	_, err := w.Write([]byte("world!"))
+	assertSizeError(t, err, 10, 11)
+	if buf.String() != "hello" || w.Written() != 5 {
+		t.Errorf("Expected only %q written, got %q (%d)", "hello", buf.String(), w.Written())
+	}
+
+	if _, err := w.Write([]byte("world")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Expected exactly 10 bytes to pass, got %v", err)
+	}
+}
+
+func TestExpectedSizeReader(t *testing.T) {
+	data := []byte("0123456789")
+	tests := []struct {
+		name   string
+		n      int64
+		want   string
+		actual int64 // 0 は成功
+	}{
+		{"exact", 10, "0123456789", 0},
+		{"short source", 12, "0123456789", 10},
+		{"long source", 8, "01234567", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 1バイトずつ返す Reader でも、まとめて返す Reader でも同じ結果になる
+			for _, src := range []io.Reader{bytes.NewReader(data), iotest.OneByteReader(bytes.NewReader(data))} {
+				r := common.NewExpectedSizeReader(src, tt.n)
+				got, err := io.ReadAll(r)
+				if string(got) != tt.want {
+					t.Errorf("Expected %q, got %q", tt.want, got)
+				}
+				if tt.actual == 0 {
+					if err != nil || r.Close() != nil {
+						t.Errorf("Expected success, got %v / %v", err, r.Close())
+					}
+					continue
+				}
+				if tt.n > int64(len(data)) {
+					assertSizeError(t, err, tt.n, tt.actual)
+				} else if err == nil {
+					t.Error("Expected an error for the extra bytes")
+				}
+			}
+		})
+	}
+
+	// 途中で読むのをやめた場合は Close で検出する
+	r := common.NewExpectedSizeReader(bytes.NewReader(data), 10)
+	io.ReadFull(r, make([]byte, 4))
+	assertSizeError(t, r.Close(), 10, 4)
+}
+
+func TestExpectedSizeReader_ThroughStreamCompressor(t *testing.T) {
+	checkNoGoroutineLeak(t)
+	data := testcorpus.Random(4096, 9)
+
+	// 短い入力は圧縮中のエラーとして読み込み側に伝わり、不完全な圧縮データは成功扱いにならない
+	short := common.NewCompressingReader(common.NewExpectedSizeReader(bytes.NewReader(data), 5000), rle.NewCompressor())
+	_, err := io.ReadAll(short)
+	short.Close()
+	assertSizeError(t, err, 5000, 4096)
+
+	// 長い入力も同様
+	long := common.NewCompressingReader(common.NewExpectedSizeReader(bytes.NewReader(data), 1000), rle.NewCompressor())
+	_, err = io.ReadAll(long)
+	long.Close()
+	if !errors.Is(err, common.ErrCorrupted) {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+
+	// 展開結果が宣言より長い場合は書き込みの時点で止まる
+	compressed, _ := rle.NewCompressor().Compress(data)
+	var out bytes.Buffer
+	w := common.NewExpectedSizeWriter(&out, 100)
+	err = rle.NewCompressor().DecompressStream(bytes.NewReader(compressed), w)
+	if !errors.Is(err, common.ErrCorrupted) || out.Len() > 100 {
+		t.Errorf("Expected ErrCorrupted with at most 100 bytes written, got %v (%d bytes)", err, out.Len())
+	}
+}
+
+func BenchmarkExpectedSizeWriter(b *testing.B) {
+	data := testcorpus.Random(64<<10, 1)
+	compressed, _ := rle.NewCompressor().Compress(data)
+	c := rle.NewCompressor()
+
+	b.Run("plain", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			if err := c.DecompressStream(bytes.NewReader(compressed), io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("checked", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			w := common.NewExpectedSizeWriter(io.Discard, int64(len(data)))
+			if err := c.DecompressStream(bytes.NewReader(compressed), w); err != nil {
+				b.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
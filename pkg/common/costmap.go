@@ -0,0 +1,24 @@
+package common
+
+// CostMap は圧縮で出力したビット数を、入力のどの範囲のために出力したかを受け取る関数です
+// 入力の pos から length バイトのために bits ビットを出力したことを表します。ヘッダーや
+// 符号表のように入力の特定の位置に対応しない出力は通知しないため、通知したビット数の
+// 合計は圧縮後のサイズより小さくなることがあります。
+type CostMap func(pos, length int, bits float64)
+
+// CostMapped は出力のビット数を入力の位置ごとに CostMap に通知しながら圧縮する Compressor を作れるインターフェースです
+// 入力のどこで圧縮が効いているかを、アルゴリズムごとに比べるために使います（compare.SavingsMap）。
+// CostMap を設定していない Compressor の圧縮速度には影響しません。
+type CostMapped interface {
+	// WithCostMap は Compress で m に出力のビット数を通知する Compressor を返します（元の Compressor は変更しません）
+	WithCostMap(m CostMap) Compressor
+}
+
+// WithCostMap は c が CostMapped を実装していれば m に出力のビット数を通知する Compressor を返します
+// 実装していない場合は c と false を返します。
+func WithCostMap(c Compressor, m CostMap) (Compressor, bool) {
+	if mapped, ok := c.(CostMapped); ok {
+		return mapped.WithCostMap(m), true
+	}
+	return c, false
+}
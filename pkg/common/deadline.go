@@ -0,0 +1,91 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// Deadlined は期限までにできるだけ圧縮する Compressor のインターフェースです
+// ブロックごとに圧縮する Compressor（blocks.Compressor）が実装し、期限を過ぎた後の
+// ブロックは圧縮せずに格納します。出力は Compress と同じ形式で、Decompress で展開できます。
+type Deadlined interface {
+	// CompressDeadline は ctx が終わるまで data を圧縮し、残りを圧縮せずに格納した圧縮データと、
+	// 期限までに圧縮した入力のバイト数を返します。ctx が終わらなければ Compress と同じ結果です。
+	CompressDeadline(ctx context.Context, data []byte) (compressed []byte, done int, err error)
+}
+
+// CompressDeadline は ctx の期限までに c でできるだけ data を圧縮し、圧縮データと統計を返します
+// c が Deadlined を実装していれば、期限までのブロックだけを圧縮し、残りを圧縮せずに格納した
+// c の形式の圧縮データを返します（圧縮の効きが悪くなるだけで、c で展開できます）。
+// 実装していない場合は、期限までに Compress が終われば結果を、終わらなければ元のデータの
+// コピー（統計の Algorithm は StoredAlgorithm）を返します。期限を過ぎた Compress は
+// 終わるまでバックグラウンドで続きますが、結果は捨てます。
+// 統計の CompressedFraction は実際に圧縮した入力の割合、DeadlineExceeded は期限までに
+// 入力全体を圧縮できなかったことを表します。ブロックや Compress の途中では止めないため、
+// 1ブロック（または1回の Compress）の分だけ期限を過ぎることがあります。
+func CompressDeadline(ctx context.Context, c Compressor, data []byte) ([]byte, CompressionStats, error) {
+	return Policy{}.CompressDeadline(ctx, c, data)
+}
+
+// CompressDeadline は CompressDeadline と同じですが、Strict の場合は期限までに入力全体を
+// 圧縮できなかったときに、残りを圧縮せずに格納した結果を返さずに *StrictError を返します
+func (p Policy) CompressDeadline(ctx context.Context, c Compressor, data []byte) ([]byte, CompressionStats, error) {
+	start := time.Now()
+	stats := CompressionStats{OriginalSize: int64(len(data)), Algorithm: c.Name()}
+
+	var (
+		result []byte
+		done   int
+		err    error
+	)
+	if d, ok := c.(Deadlined); ok {
+		result, done, err = d.CompressDeadline(ctx, data)
+	} else {
+		var finished bool
+		if result, finished, err = compressBefore(ctx, c, data); finished {
+			done = len(data)
+		} else {
+			result, stats.Algorithm = append([]byte{}, data...), StoredAlgorithm
+		}
+	}
+	if err != nil {
+		return nil, stats, err
+	}
+
+	stats.DeadlineExceeded = done < len(data)
+	if stats.DeadlineExceeded {
+		if err := p.Refuse("deadline exceeded before the whole input was compressed", "a longer deadline, or omit -strict"); err != nil {
+			return nil, stats, err
+		}
+	}
+	stats.CompressedFraction = 1
+	if len(data) > 0 {
+		stats.CompressedFraction = float64(done) / float64(len(data))
+	}
+	stats.CompressedSize = int64(len(result))
+	stats.CalculateRatio()
+	stats.Duration = time.Since(start)
+	return result, stats, nil
+}
+
+// compressBefore は ctx が終わるまでに c.Compress が終われば結果と true を返します
+func compressBefore(ctx context.Context, c Compressor, data []byte) ([]byte, bool, error) {
+	if ctx.Err() != nil {
+		return nil, false, nil
+	}
+	type outcome struct {
+		result []byte
+		err    error
+	}
+	finished := make(chan outcome, 1)
+	go func() {
+		result, err := c.Compress(data)
+		finished <- outcome{result, err}
+	}()
+	select {
+	case o := <-finished:
+		return o.result, true, o.err
+	case <-ctx.Done():
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,60 @@
+package common_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// blockingCompressor は release が閉じられるまで Compress を終えないCompressorです
+type blockingCompressor struct {
+	release chan struct{}
+}
+
+func (blockingCompressor) Name() string { return "blocking" }
+func (b blockingCompressor) Compress(data []byte) ([]byte, error) {
+	<-b.release
+	return data, nil
+}
+func (blockingCompressor) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+func TestCompressDeadline_OneShot(t *testing.T) {
+	data := testcorpus.Cycle(10000)
+	c := rle.NewCompressor()
+
+	// 期限に余裕があれば Compress と同じ結果になる
+	want, err := c.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	got, stats, err := common.CompressDeadline(ctx, c, data)
+	if err != nil {
+		t.Fatalf("CompressDeadline failed: %v", err)
+	}
+	if !bytes.Equal(got, want) || stats.DeadlineExceeded || stats.CompressedFraction != 1 || stats.Algorithm != c.Name() {
+		t.Errorf("Unexpected result: %d bytes (want %d), %+v", len(got), len(want), stats)
+	}
+
+	// 期限までに終わらなければ元のデータをそのまま返す
+	slow := blockingCompressor{release: make(chan struct{})}
+	defer close(slow.release)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	got, stats, err = common.CompressDeadline(ctx, slow, data)
+	if err != nil {
+		t.Fatalf("CompressDeadline failed: %v", err)
+	}
+	if !bytes.Equal(got, data) || !stats.DeadlineExceeded || stats.CompressedFraction != 0 || stats.Algorithm != common.StoredAlgorithm {
+		t.Errorf("Unexpected result after the deadline: %d bytes, %+v", len(got), stats)
+	}
+
+	_, _, err = strict.CompressDeadline(ctx, slow, data)
+	expectStrict(t, err, "deadline exceeded")
+}
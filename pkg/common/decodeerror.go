@@ -0,0 +1,89 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidData は圧縮データが壊れている、または形式が正しくない場合のエラーです
+var ErrInvalidData = errors.New("invalid compressed data")
+
+// decodeContextSize は DecodeError に保存する周辺のバイト数です
+const decodeContextSize = 16
+
+// DecodeError は展開中に見つかった不正なデータの位置を表します
+// errors.Is(err, ErrInvalidData) で判定でき、String は周辺のバイトを16進数で表示します。
+// Offset は展開器に渡されたデータの先頭からの位置です（ブロックやコンテナの中では
+// そのペイロードの先頭からの位置になります）。
+type DecodeError struct {
+	Algorithm     string // アルゴリズム名（"LZ77" など）
+	Offset        int64  // 不正な箇所の位置（途中で終わったフィールドはその開始位置）
+	Reason        string // 理由
+	Context       []byte // Offset 周辺の最大16バイト
+	ContextOffset int64  // Context の先頭の位置
+	Err           error  // 元になったエラー（ErrInvalidData）
+}
+
+// NewDecodeError は data の offset にある不正な箇所を表すエラーを作成します
+// offset は len(data) でもよく、その場合はデータの終端で途切れたことを表します。
+func NewDecodeError(algorithm string, data []byte, offset int, format string, args ...any) *DecodeError {
+	offset = max(0, min(offset, len(data)))
+	start := max(0, offset-decodeContextSize/2)
+	end := min(len(data), start+decodeContextSize)
+	start = max(0, end-decodeContextSize)
+
+	return &DecodeError{
+		Algorithm:     algorithm,
+		Offset:        int64(offset),
+		Reason:        fmt.Sprintf(format, args...),
+		Context:       append([]byte(nil), data[start:end]...),
+		ContextOffset: int64(start),
+		Err:           ErrInvalidData,
+	}
+}
+
+// WithBase は Offset と ContextOffset に base を加えて返します
+// data の一部分だけを NewDecodeError に渡した場合に、全体の中の位置に直すために使います
+func (e *DecodeError) WithBase(base int64) *DecodeError {
+	e.Offset += base
+	e.ContextOffset += base
+	return e
+}
+
+// Error はエラーメッセージを返します
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %v at offset %d: %s", e.Algorithm, e.Err, e.Offset, e.Reason)
+}
+
+// Unwrap は元になったエラーを返します
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// String はエラーメッセージに続けて、周辺のバイトの16進ダンプと不正な箇所を示す ^^ を返します
+//
+//	LZ77: invalid compressed data at offset 1: invalid distance 10, history length 0
+//	  00000000  01 00 0a 03 61
+//	               ^^
+func (e *DecodeError) String() string {
+	var sb strings.Builder
+	sb.WriteString(e.Error())
+	if len(e.Context) == 0 {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "\n  %08x ", e.ContextOffset)
+	for _, b := range e.Context {
+		fmt.Fprintf(&sb, " %02x", b)
+	}
+
+	column := int(e.Offset - e.ContextOffset)
+	sb.WriteString("\n  ")
+	sb.WriteString(strings.Repeat(" ", 10+3*column))
+	sb.WriteString("^^")
+	if column >= len(e.Context) {
+		sb.WriteString(" (end of data)")
+	}
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewDecodeError_ContextWindow(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	tests := []struct {
+		offset        int
+		contextOffset int64
+		contextLength int
+	}{
+		{0, 0, 16},    // 先頭
+		{50, 42, 16},  // 前後8バイトずつ
+		{95, 84, 16},  // 末尾に寄せる
+		{100, 84, 16}, // データの終端
+	}
+
+	for _, tt := range tests {
+		e := NewDecodeError("Test", data, tt.offset, "bad byte")
+		if e.Offset != int64(tt.offset) {
+			t.Errorf("offset %d: got Offset %d", tt.offset, e.Offset)
+		}
+		if e.ContextOffset != tt.contextOffset || len(e.Context) != tt.contextLength {
+			t.Errorf("offset %d: expected context at %d (%d bytes), got at %d (%d bytes)",
+				tt.offset, tt.contextOffset, tt.contextLength, e.ContextOffset, len(e.Context))
+		}
+		if len(e.Context) > 0 && e.Context[0] != byte(e.ContextOffset) {
+			t.Errorf("offset %d: context does not start at ContextOffset", tt.offset)
+		}
+	}
+
+	// 短いデータは全体が周辺のバイトになる
+	e := NewDecodeError("Test", []byte{1, 2, 3}, 1, "bad byte")
+	if e.ContextOffset != 0 || len(e.Context) != 3 {
+		t.Errorf("Expected whole data as context, got %d bytes at %d", len(e.Context), e.ContextOffset)
+	}
+}
+
+func TestDecodeError_Unwrap(t *testing.T) {
+	e := NewDecodeError("LZ77", []byte{1, 0, 5}, 0, "incomplete match token")
+	wrapped := fmt.Errorf("block 2: %w", e)
+
+	if !errors.Is(wrapped, ErrInvalidData) {
+		t.Error("Expected wrapped DecodeError to match ErrInvalidData")
+	}
+	var decodeErr *DecodeError
+	if !errors.As(wrapped, &decodeErr) || decodeErr.Offset != 0 {
+		t.Errorf("Expected to extract DecodeError, got %v", wrapped)
+	}
+
+	expected := "LZ77: invalid compressed data at offset 0: incomplete match token"
+	if e.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, e.Error())
+	}
+}
+
+func TestDecodeError_String(t *testing.T) {
+	e := NewDecodeError("LZ77", []byte{1, 0, 10, 3, 'a'}, 1, "invalid distance 10").WithBase(16)
+
+	lines := strings.Split(e.String(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %q", e.String())
+	}
+	if lines[0] != e.Error() || e.Offset != 17 {
+		t.Errorf("Unexpected first line %q", lines[0])
+	}
+	if lines[1] != "  00000010  01 00 0a 03 61" {
+		t.Errorf("Unexpected hex line %q", lines[1])
+	}
+
+	// ^^ は不正なバイトの真下にある
+	caret := strings.Index(lines[2], "^^")
+	if lines[1][caret:caret+2] != "00" {
+		t.Errorf("Caret is not under the failing byte:\n%s\n%s", lines[1], lines[2])
+	}
+
+	// データの終端で途切れた場合は最後のバイトの次を指す
+	end := NewDecodeError("RLE", []byte{'a', 1, 'b'}, 3, "truncated")
+	if !strings.HasSuffix(end.String(), "^^ (end of data)") {
+		t.Errorf("Expected end-of-data marker, got %q", end.String())
+	}
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"sort"
+	"strings"
+)
+
+// Capability はアルゴリズムの能力を表すビットの集合です（Descriptor.Capabilities）
+type Capability uint32
+
+const (
+	// CapStreaming は入力全体をメモリに読み込まずに圧縮・展開できることを表します
+	// NewFunc の Compressor か NewStreamFunc が StreamCompressor を実装します。
+	CapStreaming Capability = 1 << iota
+	// CapDictionary はプリセット辞書を使えることを表します（Compressor の WithDict）
+	CapDictionary
+	// CapLevels は圧縮レベルを選べることを表します（Compressor の Level）
+	CapLevels
+	// CapDeterministic は同じ入力と設定から常に同じ圧縮データを出力することを表します
+	CapDeterministic
+)
+
+// capabilityNames は Capability のビットの順の名前です（Strings と -version -json の出力）
+var capabilityNames = []string{"streaming", "dictionary", "levels", "deterministic"}
+
+// Strings は c に含まれる能力の名前を、ビットの順に返します
+func (c Capability) Strings() []string {
+	names := []string{}
+	for i, name := range capabilityNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String は "streaming, deterministic" のように能力の名前を返します（ない場合は "-"）
+func (c Capability) String() string {
+	if names := c.Strings(); len(names) > 0 {
+		return strings.Join(names, ", ")
+	}
+	return "-"
+}
+
+// Descriptor は登録したアルゴリズムの説明です
+// CLIの使用方法や -version、Web UI はこの説明からアルゴリズムの一覧を表示します。
+// Capabilities が0や Description が空の説明は、能力を宣言していない登録として
+// テストで検出します（Register で登録した場合など）。
+type Descriptor struct {
+	Name         string     // 登録名
+	ID           byte       // 圧縮データに記録する番号（AlgorithmID、番号の表にない場合は0）
+	Extensions   []string   // 圧縮ファイルの拡張子（最初が -o を省略した場合の拡張子、空の場合は ContainerExtension）
+	Capabilities Capability // 能力
+	Description  string     // 1行の説明
+	UseCase      string     // 向いているデータや用途
+	MinVersion   byte       // 展開できる最も古い形式のバージョン
+	MaxVersion   byte       // Compress が出力する形式のバージョン（common.Versioned、ない場合は0）
+
+	// NewFunc は新しいCompressorを作成します
+	NewFunc Factory
+	// NewStreamFunc は NewFunc の Compressor と同じ形式でストリームを圧縮・展開する
+	// StreamCompressor を作成します（NewFunc の Compressor が実装している場合やストリームに対応していない場合は nil）
+	NewStreamFunc func() StreamCompressor
+}
+
+// Has は d が能力 c をすべて持つかを返します
+func (d Descriptor) Has(c Capability) bool {
+	return d.Capabilities&c == c
+}
+
+// storedDescriptor は登録しなくても New で作成できる StoredAlgorithm の説明です
+var storedDescriptor = Descriptor{
+	Name:         StoredAlgorithm,
+	Capabilities: CapDeterministic,
+	Description:  "元のデータをそのまま格納（圧縮しない）",
+	UseCase:      "圧縮しても小さくならないデータ",
+	NewFunc:      func() Compressor { return NewStored() },
+}
+
+func init() {
+	storedDescriptor.ID, _ = AlgorithmID(StoredAlgorithm)
+}
+
+// Describe は登録名 name のアルゴリズムの説明を返します（登録していない名前は false）
+// StoredAlgorithm は登録しなくても説明を返します（DescribeAll には含めません）。
+func Describe(name string) (Descriptor, bool) {
+	registryMu.RLock()
+	d, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok && name == StoredAlgorithm {
+		d, ok = storedDescriptor, true
+	}
+	d.Extensions = append([]string(nil), d.Extensions...)
+	return d, ok
+}
+
+// DescribeAll は登録済みのアルゴリズムの説明を名前順に返します（Names と同じ順）
+func DescribeAll() []Descriptor {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]Descriptor, 0, len(registry))
+	for _, d := range registry {
+		d.Extensions = append([]string(nil), d.Extensions...)
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
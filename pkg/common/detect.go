@@ -0,0 +1,239 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// DataKind はデータの種類です
+type DataKind int
+
+const (
+	// KindBinary はどの特徴にも当てはまらないバイナリデータです
+	KindBinary DataKind = iota
+	// KindText はASCIIテキストです
+	KindText
+	// KindUTF8Text はASCII以外の文字を含むUTF-8テキストです
+	KindUTF8Text
+	// KindRuns は同じバイトの連続が多いバイナリデータです
+	KindRuns
+	// KindCompressed は圧縮済み（またはランダム）のデータです
+	KindCompressed
+	// KindPeriodic は固定長レコードの数値列のような周期的なデータです
+	KindPeriodic
+)
+
+// String はデータの種類の表示名を返します
+func (k DataKind) String() string {
+	switch k {
+	case KindText:
+		return "テキスト"
+	case KindUTF8Text:
+		return "UTF-8テキスト"
+	case KindRuns:
+		return "ランの多いバイナリ"
+	case KindCompressed:
+		return "圧縮済み"
+	case KindPeriodic:
+		return "周期的な数値データ"
+	default:
+		return "バイナリ"
+	}
+}
+
+// DataType はデータの種類の推定結果です
+type DataType struct {
+	Kind       DataKind
+	Confidence float64 // 推定の確からしさ (0〜1)
+	Format     string  // マジックバイトで判定したファイル形式（"png" など、判定できなければ空）
+	Period     int     // KindPeriodic の場合のレコード長
+}
+
+const (
+	// detectSampleSize は種類の推定に使う先頭部分のサイズです
+	detectSampleSize = 64 * 1024
+
+	// compressedEntropy はこれ以上のエントロピー(bits/byte)のデータを圧縮済みとみなす閾値です
+	compressedEntropy = 7.5
+
+	// textRatio は表示可能な文字がこの割合以上ならテキストとみなす閾値です
+	textRatio = 0.95
+
+	// maxPeriod は周期として調べる最大のレコード長です
+	maxPeriod = 16
+)
+
+// magicNumbers は圧縮済みのファイル形式のマジックバイトです
+var magicNumbers = []struct {
+	format string
+	magic  []byte
+}{
+	{"png", []byte("\x89PNG\r\n\x1a\n")},
+	{"jpeg", []byte{0xFF, 0xD8, 0xFF}},
+	{"gzip", []byte{0x1F, 0x8B}},
+	{"zip", []byte("PK\x03\x04")},
+	{"bzip2", []byte("BZh")},
+	{"xz", []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", []byte{0x28, 0xB5, 0x2F, 0xFD}},
+}
+
+// DetectDataType はデータの先頭64KBから種類を推定します
+// マジックバイト、表示可能な文字の割合、小さなずれでの自己相関
+// （同じバイトが現れる割合）、エントロピーを順に調べます。
+func DetectDataType(data []byte) DataType {
+	sample := data
+	if len(sample) > detectSampleSize {
+		sample = sample[:detectSampleSize]
+	}
+	if len(sample) == 0 {
+		return DataType{Kind: KindBinary}
+	}
+
+	for _, m := range magicNumbers {
+		if bytes.HasPrefix(sample, m.magic) {
+			return DataType{Kind: KindCompressed, Confidence: 0.99, Format: m.format}
+		}
+	}
+
+	if kind, ratio := detectText(sample, len(data) > len(sample)); kind != KindBinary {
+		return DataType{Kind: kind, Confidence: ratio}
+	}
+
+	// ずれ1（ラン）とずれ2〜16（周期）で同じバイトが現れる割合
+	// 値の種類が多いとエントロピーは高くなるため、エントロピーより先に調べる
+	runs := autocorrelation(sample, 1)
+	period, periodic := 0, 0.0
+	for lag := 2; lag <= maxPeriod && lag < len(sample)/4; lag++ {
+		if c := autocorrelation(sample, lag); c > periodic*1.1 {
+			// 周期の倍数も相関が高くなるため、明らかに高い場合だけ更新して最小の周期を選ぶ
+			period, periodic = lag, c
+		}
+	}
+
+	switch {
+	case periodic >= 0.3 && periodic > runs*1.5:
+		return DataType{Kind: KindPeriodic, Confidence: clamp(periodic), Period: period}
+	case runs >= 0.5:
+		return DataType{Kind: KindRuns, Confidence: clamp(runs)}
+	}
+
+	if entropy := CalculateEntropy(sample); entropy >= compressedEntropy {
+		return DataType{Kind: KindCompressed, Confidence: clamp(0.5 + (entropy - compressedEntropy))}
+	}
+	return DataType{Kind: KindBinary, Confidence: 0.5}
+}
+
+// detectText は表示可能な文字の割合からテキストかどうかを判定します
+// truncated が true の場合、サンプルの末尾で途切れたUTF-8文字は無視します
+func detectText(sample []byte, truncated bool) (DataKind, float64) {
+	printable, nonASCII := 0, 0
+	for _, b := range sample {
+		switch {
+		case b >= 0x20 && b < 0x7F, b == '\n', b == '\r', b == '\t':
+			printable++
+		case b >= 0x80:
+			nonASCII++
+		}
+	}
+
+	total := float64(len(sample))
+	if nonASCII == 0 {
+		if ratio := float64(printable) / total; ratio >= textRatio {
+			return KindText, ratio
+		}
+		return KindBinary, 0
+	}
+
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	if !utf8.Valid(sample) {
+		return KindBinary, 0
+	}
+	if ratio := float64(printable+nonASCII) / total; ratio >= textRatio {
+		return KindUTF8Text, ratio
+	}
+	return KindBinary, 0
+}
+
+// autocorrelation は data[i] == data[i-lag] となる位置の割合を返します
+func autocorrelation(data []byte, lag int) float64 {
+	if len(data) <= lag {
+		return 0
+	}
+	same := 0
+	for i := lag; i < len(data); i++ {
+		if data[i] == data[i-lag] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(data)-lag)
+}
+
+func clamp(v float64) float64 {
+	if v > 1 {
+		return 1
+	}
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// Recommendation はデータの種類に応じたおすすめの設定です
+type Recommendation struct {
+	Algorithm string // 登録名（空の場合は圧縮しない）
+	Filter    string // -filter に指定するフィルタ（例: "transpose:4,delta"）
+	Reason    string // 理由
+}
+
+// Recommend はデータの種類からおすすめのアルゴリズムとフィルタを返します
+func Recommend(dt DataType) Recommendation {
+	switch dt.Kind {
+	case KindText, KindUTF8Text:
+		return Recommendation{Algorithm: "lz77", Reason: "テキストは繰り返し現れる単語や文字列が多いため"}
+	case KindRuns:
+		return Recommendation{Algorithm: "rle", Reason: "同じバイトの連続が多いため"}
+	case KindCompressed:
+		reason := "エントロピーが高く、これ以上小さくならないため"
+		if dt.Format != "" {
+			reason = fmt.Sprintf("%s形式で既に圧縮されているため", dt.Format)
+		}
+		return Recommendation{Reason: reason}
+	case KindPeriodic:
+		return Recommendation{
+			Algorithm: "rle",
+			Filter:    fmt.Sprintf("transpose:%d,delta", dt.Period),
+			Reason:    fmt.Sprintf("%dバイト周期のレコード列は、バイト位置ごとに並べ替えて差分をとると連続が増えるため", dt.Period),
+		}
+	default:
+		return Recommendation{Algorithm: "huffman", Reason: "バイトの出現頻度に偏りがあれば効果があるため"}
+	}
+}
+
+// FprintDataType は PrintDataType と同じ内容を w に書き込みます
+func FprintDataType(w io.Writer, dt DataType) {
+	fmt.Fprintf(w, "=== データ種別 ===\n")
+	fmt.Fprintf(w, "種類:   %s (確からしさ %.0f%%)\n", dt.Kind, dt.Confidence*100)
+	if dt.Format != "" {
+		fmt.Fprintf(w, "形式:   %s\n", dt.Format)
+	}
+	if dt.Kind == KindPeriodic {
+		fmt.Fprintf(w, "周期:   %d bytes\n", dt.Period)
+	}
+
+	rec := Recommend(dt)
+	switch {
+	case rec.Algorithm == "":
+		fmt.Fprintf(w, "推奨:   圧縮しない（-adaptive ではstoredブロックとして格納されます）\n")
+	case rec.Filter != "":
+		fmt.Fprintf(w, "推奨:   -algo %s -filter %s\n", rec.Algorithm, rec.Filter)
+	default:
+		fmt.Fprintf(w, "推奨:   -algo %s\n", rec.Algorithm)
+	}
+	fmt.Fprintf(w, "理由:   %s\n", rec.Reason)
+}
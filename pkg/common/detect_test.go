@@ -0,0 +1,114 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomBytes は乱数のバイト列を作成します（圧縮済みデータの代わり）
+func randomBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestDetectDataType_Categories(t *testing.T) {
+	var counters []byte
+	for i := 0; i < 4096; i++ {
+		counters = binary.LittleEndian.AppendUint32(counters, uint32(100000+i*3))
+	}
+
+	var audio []byte
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 8192; i++ {
+		v := 200*math.Sin(float64(i)*2*math.Pi/64) + float64(r.Intn(9)-4)
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(int16(v)))
+	}
+
+	var runs []byte
+	for i := 0; i < 200; i++ {
+		runs = append(runs, bytes.Repeat([]byte{byte(i * 37)}, 5+i%20)...)
+	}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		kind   DataKind
+		format string
+		period int
+	}{
+		{"ascii text", []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 50)), KindText, "", 0},
+		{"utf-8 text", []byte(strings.Repeat("吾輩は猫である。名前はまだ無い。\n", 50)), KindUTF8Text, "", 0},
+		{"runs", runs, KindRuns, "", 0},
+		{"random", randomBytes(8192, 1), KindCompressed, "", 0},
+		{"png", append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), make([]byte, 100)...), KindCompressed, "png", 0},
+		{"jpeg", append([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F'}, make([]byte, 100)...), KindCompressed, "jpeg", 0},
+		{"gzip", append([]byte{0x1F, 0x8B, 0x08, 0x00}, []byte("looks like text but is gzip")...), KindCompressed, "gzip", 0},
+		{"zip", append([]byte("PK\x03\x04\x14\x00"), make([]byte, 100)...), KindCompressed, "zip", 0},
+		{"uint32 counters", counters, KindPeriodic, "", 4},
+		{"16-bit audio", audio, KindPeriodic, "", 2},
+		{"empty", nil, KindBinary, "", 0},
+	}
+
+	for _, tt := range tests {
+		dt := DetectDataType(tt.data)
+		if dt.Kind != tt.kind || dt.Format != tt.format || dt.Period != tt.period {
+			t.Errorf("%s: got %+v (%s), expected kind %s, format %q, period %d",
+				tt.name, dt, dt.Kind, tt.kind, tt.format, tt.period)
+		}
+		if dt.Confidence < 0 || dt.Confidence > 1 {
+			t.Errorf("%s: confidence out of range: %f", tt.name, dt.Confidence)
+		}
+		if tt.kind != KindBinary && dt.Confidence < 0.3 {
+			t.Errorf("%s: unexpectedly low confidence %f", tt.name, dt.Confidence)
+		}
+	}
+}
+
+func TestDetectDataType_SamplesPrefix(t *testing.T) {
+	// 先頭64KBだけを調べるため、その後ろの乱数は判定に影響しない
+	text := []byte(strings.Repeat("log line with some words\n", 3000))[:detectSampleSize]
+	data := append(text, randomBytes(1<<20, 2)...)
+
+	if dt := DetectDataType(data); dt.Kind != KindText {
+		t.Errorf("Expected text from the sampled prefix, got %s", dt.Kind)
+	}
+
+	// サンプルの境界で途切れたUTF-8文字があってもテキストと判定する
+	utf := []byte(strings.Repeat("日本語", detectSampleSize/9+1))
+	if dt := DetectDataType(utf); dt.Kind != KindUTF8Text {
+		t.Errorf("Expected UTF-8 text across the sample boundary, got %s", dt.Kind)
+	}
+}
+
+func TestRecommend_FollowsDataType(t *testing.T) {
+	var counters []byte
+	for i := 0; i < 4096; i++ {
+		counters = binary.LittleEndian.AppendUint32(counters, uint32(i))
+	}
+
+	periodic := Recommend(DetectDataType(counters))
+	if periodic.Algorithm != "rle" || periodic.Filter != "transpose:4,delta" {
+		t.Errorf("Unexpected recommendation for counters: %+v", periodic)
+	}
+
+	compressed := Recommend(DetectDataType(randomBytes(8192, 3)))
+	if compressed.Algorithm != "" || compressed.Filter != "" {
+		t.Errorf("Expected no compression for random data, got %+v", compressed)
+	}
+
+	text := Recommend(DetectDataType([]byte(strings.Repeat("hello world ", 100))))
+	if text.Algorithm != "lz77" || text.Filter != "" {
+		t.Errorf("Unexpected recommendation for text: %+v", text)
+	}
+
+	for _, kind := range []DataKind{KindBinary, KindText, KindUTF8Text, KindRuns, KindCompressed, KindPeriodic} {
+		if Recommend(DataType{Kind: kind, Period: 4}).Reason == "" {
+			t.Errorf("%s: missing reason", kind)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package common_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// ストレージエンジンなどの func(io.Writer) (io.WriteCloser, error) を受け取る口に、
+// 登録済みのアルゴリズムを渡します。ここではバッファ付きのファイルに書き込んで読み戻します。
+func ExampleWriterFactory() {
+	newWriter, err := common.WriterFactory("gzip")
+	if err != nil {
+		log.Fatal(err)
+	}
+	newReader, err := common.ReaderFactory("gzip")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("", "example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "segment.gz")
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bw := bufio.NewWriter(f)
+	w, err := newWriter(bw)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(w, "key=alpha value=1")
+	fmt.Fprintln(w, "key=beta value=2")
+	// Close で圧縮を終えてから、bufio とファイルを閉じる
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err = os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	r, err := newReader(bufio.NewReader(f))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	io.Copy(os.Stdout, r)
+
+	_, err = common.WriterFactory("huffman")
+	fmt.Println(err)
+	// Output:
+	// key=alpha value=1
+	// key=beta value=2
+	// streaming unsupported: huffman
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStreamingUnsupported はストリームで圧縮・展開できないアルゴリズムを表します
+// WriterFactory と ReaderFactory は CapStreaming を持たないアルゴリズムでこのエラーを返します。
+var ErrStreamingUnsupported = errors.New("streaming unsupported")
+
+// WriterFactory は登録名 name のアルゴリズムで圧縮する io.WriteCloser を作成する関数を返します
+// ストレージエンジンなどの「func(w io.Writer) (io.WriteCloser, error) を受け取る」
+// 差し替え可能な圧縮の口に、1行で登録済みのアルゴリズムを渡すためのものです。
+// 返した関数が作成する Writer は、書き込んだデータをゴルーチンで CompressStream に渡し、
+// 圧縮結果を w に書き込みます。Close で圧縮を終え、w に書き込み終わるまで待ちます（w は閉じません）。
+// 圧縮のエラーは以降の Write と Close で返します。
+// opts は将来のアルゴリズムごとの設定のためのもので、現在はどの値もエラーになります。
+func WriterFactory(name string, opts ...any) (func(w io.Writer) (io.WriteCloser, error), error) {
+	sc, err := streamCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		return nil, fmt.Errorf("%s: unsupported writer option %T", name, opt)
+	}
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return NewCompressingWriter(w, sc), nil
+	}, nil
+}
+
+// ReaderFactory は登録名 name のアルゴリズムの圧縮データを展開する io.ReadCloser を作成する関数を返します
+// opts には DecompressOptions を指定でき、展開結果の最大サイズとメモリ予算を確認します
+// （超えた場合は ErrOutputTooLarge か ErrBudgetExceeded を Read で返します）。
+// それ以外の型はエラーになります。Read と Close の動作は NewDecompressingReader と同じです。
+func ReaderFactory(name string, opts ...any) (func(r io.Reader) (io.ReadCloser, error), error) {
+	sc, err := streamCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	var limits DecompressOptions
+	for _, opt := range opts {
+		o, ok := opt.(DecompressOptions)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported reader option %T", name, opt)
+		}
+		limits = o
+	}
+
+	transform := sc.DecompressStream
+	if wd, ok := sc.(WriterDecompressor); ok {
+		transform = func(src io.Reader, dst io.Writer) error {
+			return wd.DecompressToWriter(src, dst, limits)
+		}
+	} else if limits.MaxOutputSize > 0 || limits.Budget != nil {
+		transform = func(src io.Reader, dst io.Writer) error {
+			return sc.DecompressStream(src, &reservingWriter{w: dst, opts: limits})
+		}
+	}
+	return func(r io.Reader) (io.ReadCloser, error) {
+		return newPipeReader(r, transform), nil
+	}, nil
+}
+
+// streamCompressor は登録名 name のアルゴリズムを StreamCompressor として作成します
+// Descriptor.NewStreamFunc があればそれを、なければ New の Compressor を使います。
+func streamCompressor(name string) (StreamCompressor, error) {
+	c, err := New(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, _ := Describe(name); d.NewStreamFunc != nil {
+		return d.NewStreamFunc(), nil
+	}
+	sc, ok := c.(StreamCompressor)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStreamingUnsupported, name)
+	}
+	return sc, nil
+}
+
+// reservingWriter は書き込む前に DecompressOptions で出力を確保します
+type reservingWriter struct {
+	w     io.Writer
+	opts  DecompressOptions
+	total int64
+}
+
+func (r *reservingWriter) Write(p []byte) (int, error) {
+	if err := r.opts.ReserveOutput(int64(len(p)), r.total+int64(len(p))); err != nil {
+		return 0, err
+	}
+	r.total += int64(len(p))
+	return r.w.Write(p)
+}
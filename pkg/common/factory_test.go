@@ -0,0 +1,114 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+func TestFactories_RoundTrip(t *testing.T) {
+	data := append(testcorpus.Cycle(100<<10), testcorpus.Random(10<<10, 1)...)
+	streaming := 0
+	for _, name := range common.Names() {
+		d, _ := common.Describe(name)
+		newWriter, werr := common.WriterFactory(name)
+		newReader, rerr := common.ReaderFactory(name)
+		if !d.Has(common.CapStreaming) {
+			if !errors.Is(werr, common.ErrStreamingUnsupported) || !errors.Is(rerr, common.ErrStreamingUnsupported) {
+				t.Errorf("%s: expected ErrStreamingUnsupported, got %v and %v", name, werr, rerr)
+			}
+			continue
+		}
+		streaming++
+		if werr != nil || rerr != nil {
+			t.Fatalf("%s: factory failed: %v, %v", name, werr, rerr)
+		}
+
+		var compressed bytes.Buffer
+		w, err := newWriter(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 小さな書き込みに分けても同じ結果になる
+		for start := 0; start < len(data); start += 4093 {
+			if _, err := w.Write(data[start:min(start+4093, len(data))]); err != nil {
+				t.Fatalf("%s: Write failed: %v", name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close failed: %v", name, err)
+		}
+
+		r, err := newReader(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: round trip mismatch (%d bytes, err %v)", name, len(got), err)
+		}
+	}
+	if streaming == 0 {
+		t.Fatal("Expected at least one streaming-capable algorithm")
+	}
+}
+
+func TestFactories_Errors(t *testing.T) {
+	if _, err := common.WriterFactory("nope"); err == nil {
+		t.Error("Expected an error for an unknown algorithm")
+	}
+	if _, err := common.WriterFactory("rle", 5); err == nil {
+		t.Error("Expected an error for an unsupported writer option")
+	}
+	if _, err := common.ReaderFactory("rle", "fast"); err == nil {
+		t.Error("Expected an error for an unsupported reader option")
+	}
+	_, err := common.WriterFactory("huffman")
+	if !errors.Is(err, common.ErrStreamingUnsupported) || err.Error() != "streaming unsupported: huffman" {
+		t.Errorf("Expected a clear streaming error, got %v", err)
+	}
+
+	// 展開結果の上限
+	for _, name := range []string{"rle", "gzip"} {
+		c, _ := common.New(name)
+		compressed, _ := c.Compress(bytes.Repeat([]byte("x"), 1<<20))
+		newReader, err := common.ReaderFactory(name, common.DecompressOptions{MaxOutputSize: 1 << 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ := newReader(bytes.NewReader(compressed))
+		_, err = io.ReadAll(r)
+		r.Close()
+		if !errors.Is(err, common.ErrOutputTooLarge) {
+			t.Errorf("%s: expected ErrOutputTooLarge, got %v", name, err)
+		}
+	}
+}
+
+func TestNewCompressingWriter_Error(t *testing.T) {
+	checkNoGoroutineLeak(t)
+	c, _ := common.New("rle")
+	w := common.NewCompressingWriter(failingWriter{}, c.(common.StreamCompressor))
+	// 圧縮側が止まっても Write はブロックせず、圧縮のエラーを返す
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = w.Write(testcorpus.Random(64<<10, int64(i)))
+	}
+	if !errors.Is(err, errWrite) {
+		t.Errorf("Expected the write error from Write, got %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, errWrite) {
+		t.Errorf("Expected the write error from Close, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package common
+
+import "math"
+
+// FloorEstimator は、アルゴリズムのモデルで到達できる圧縮後のサイズの下限の目安を返すインターフェースです
+// 0次のエントロピー（EntropyBits）はバイトの出現頻度だけを見るため、ランや繰り返しを
+// 使うアルゴリズムの下限にはなりません。各アルゴリズムは、自身がデータから取り出す
+// 構造（RLEのラン、LZ77のトークン列など）を理想的に符号化した場合のサイズを返します。
+// ヘッダーや頻度表は含まないため、実際の圧縮結果より小さくなるのが普通です。
+type FloorEstimator interface {
+	// Floor は data を圧縮したときのサイズの下限の目安（bytes）です
+	Floor(data []byte) float64
+}
+
+// Floor は c で data を圧縮したときのサイズの下限の目安を返します
+// c が FloorEstimator を実装していない場合は 0 と false を返します。
+func Floor(c Compressor, data []byte) (float64, bool) {
+	if f, ok := c.(FloorEstimator); ok {
+		return f.Floor(data), true
+	}
+	return 0, false
+}
+
+// OrderZeroFloor は data の0次のエントロピーから求めた下限（bytes）を返します
+// バイトを独立に符号化する場合（Huffmanなど）の下限です。
+func OrderZeroFloor(data []byte) float64 {
+	return CalculateEntropy(data) * float64(len(data)) / 8
+}
+
+// EntropyBits は出現回数が counts のシンボル列を、出現頻度から理想的に符号化したときのビット数を返します
+// 各シンボルは -log2(出現回数 / 合計) ビットです。0の要素は無視します。
+func EntropyBits(counts []int) float64 {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	bits := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			bits += float64(c) * math.Log2(float64(total)/float64(c))
+		}
+	}
+	return bits
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEntropyBits(t *testing.T) {
+	tests := []struct {
+		counts []int
+		bits   float64
+	}{
+		{nil, 0},
+		{[]int{5}, 0},
+		{[]int{1, 1}, 2},
+		{[]int{3, 1, 0}, 3*math.Log2(4.0/3) + 2},
+		{[]int{2, 2, 2, 2}, 16},
+	}
+	for _, tt := range tests {
+		if got := EntropyBits(tt.counts); math.Abs(got-tt.bits) > 1e-9 {
+			t.Errorf("EntropyBits(%v) = %f, expected %f", tt.counts, got, tt.bits)
+		}
+	}
+
+	// 0次のエントロピーの下限はバイトの出現回数のエントロピーと同じ
+	data := []byte("abracadabra")
+	if got, want := OrderZeroFloor(data), EntropyBits([]int{5, 2, 2, 1, 1})/8; math.Abs(got-want) > 1e-9 {
+		t.Errorf("OrderZeroFloor = %f, expected %f", got, want)
+	}
+}
+
+func TestFloor_NotImplemented(t *testing.T) {
+	if floor, ok := Floor(NewStored(), []byte("abc")); ok || floor != 0 {
+		t.Errorf("Expected no floor for a compressor without FloorEstimator, got %f, %v", floor, ok)
+	}
+}
@@ -0,0 +1,21 @@
+package common
+
+// MemoryReporter は圧縮の作業領域の大きさを報告するインターフェースです
+// 比較（pkg/compare）はヒープの増加を測りますが、複数のゴルーチンで圧縮する場合の
+// ワーカーごとの内訳は分からないため、アルゴリズム自身が作業領域の目安を報告します。
+type MemoryReporter interface {
+	// WorkingMemory は n バイトの入力を圧縮するときの、ワーカーごとの作業領域の目安（bytes）です
+	// 目安がない設定では nil を返します。
+	WorkingMemory(n int) []int64
+}
+
+// WorkingMemory は c で n バイトを圧縮するときの、ワーカーごとの作業領域の目安を返します
+// c が MemoryReporter を実装していないか、目安がない場合は nil と false を返します。
+func WorkingMemory(c Compressor, n int) ([]int64, bool) {
+	if m, ok := c.(MemoryReporter); ok {
+		if workers := m.WorkingMemory(n); workers != nil {
+			return workers, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,62 @@
+package common
+
+// CompressNoExpand は data を c で圧縮し、元より小さくなった場合だけ圧縮結果を返します
+// 圧縮しても小さくならない（乱数や圧縮済みのデータなど）場合は data をそのまま返し、
+// compressed を false にします。その場合は data を圧縮せずに格納（NewStored）するか、
+// HTTP の identity のように元のまま送ってください。空のデータは圧縮しません。
+func CompressNoExpand(c Compressor, data []byte) (out []byte, compressed bool, err error) {
+	return Policy{}.CompressNoExpand(c, data)
+}
+
+// CompressNoExpand は CompressNoExpand と同じですが、Strict の場合は小さくならない
+// データを元のまま返さずに *StrictError を返します
+func (p Policy) CompressNoExpand(c Compressor, data []byte) (out []byte, compressed bool, err error) {
+	if len(data) == 0 {
+		return data, false, nil
+	}
+	result, err := c.Compress(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(result) >= len(data) {
+		if err := p.RefuseStored(); err != nil {
+			return nil, false, err
+		}
+		return data, false, nil
+	}
+	return result, true, nil
+}
+
+// stored はデータを変換せずにそのまま格納する Compressor です
+type stored struct{}
+
+// NewStored はデータを圧縮せずにそのまま格納する Compressor を作成します
+// 名前は StoredAlgorithm で、登録しなくても New(StoredAlgorithm) で作成できます。
+// CompressNoExpand で圧縮しなかったデータを、コンテナのメンバーなどとして格納するために使います。
+func NewStored() Compressor {
+	return stored{}
+}
+
+func (stored) Name() string {
+	return StoredAlgorithm
+}
+
+// Compress は data のコピーを返します
+func (stored) Compress(data []byte) ([]byte, error) {
+	return append([]byte{}, data...), nil
+}
+
+// Decompress は data のコピーを返します
+func (s stored) Decompress(data []byte) ([]byte, error) {
+	return s.DecompressWithOptions(data, DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認してから data のコピーを返します
+func (stored) DecompressWithOptions(data []byte, opts DecompressOptions) ([]byte, error) {
+	if err := opts.ReserveOutput(int64(len(data)), int64(len(data))); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, data...), nil
+}
+
+var _ OptionsDecompressor = stored{}
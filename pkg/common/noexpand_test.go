@@ -0,0 +1,87 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+func TestCompressNoExpand(t *testing.T) {
+	c := rle.NewCompressor()
+	tests := map[string]struct {
+		data       []byte
+		compressed bool
+	}{
+		"random": {testcorpus.Random(4096, 3), false},
+		"zeros":  {make([]byte, 4096), true},
+		"empty":  {[]byte{}, false},
+	}
+	for name, tt := range tests {
+		out, compressed, err := common.CompressNoExpand(c, tt.data)
+		if err != nil {
+			t.Fatalf("%s: CompressNoExpand failed: %v", name, err)
+		}
+		if compressed != tt.compressed {
+			t.Errorf("%s: Expected compressed=%v, got %v", name, tt.compressed, compressed)
+		}
+
+		// 圧縮しなかった場合は元のデータ、圧縮した場合は c で展開できる小さなデータ
+		if !compressed {
+			if !bytes.Equal(out, tt.data) {
+				t.Errorf("%s: Expected the original bytes", name)
+			}
+			continue
+		}
+		if len(out) >= len(tt.data) {
+			t.Errorf("%s: Expected fewer than %d bytes, got %d", name, len(tt.data), len(out))
+		}
+		if got, err := c.Decompress(out); err != nil || !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: Round trip failed: %v", name, err)
+		}
+	}
+}
+
+func TestCompressionStats_Expanded(t *testing.T) {
+	for _, tt := range []struct {
+		original, compressed int64
+		want                 bool
+	}{
+		{100, 40, false},
+		{100, 100, false},
+		{100, 101, true},
+	} {
+		stats := common.CompressionStats{OriginalSize: tt.original, CompressedSize: tt.compressed}
+		if got := stats.Expanded(); got != tt.want {
+			t.Errorf("%d -> %d: Expected Expanded()=%v, got %v", tt.original, tt.compressed, tt.want, got)
+		}
+	}
+}
+
+func TestNewStored(t *testing.T) {
+	// 登録しなくても New で作成でき、登録名の一覧には含まれない
+	c, err := common.New(common.StoredAlgorithm)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if c.Name() != common.StoredAlgorithm || slices.Contains(common.Names(), common.StoredAlgorithm) {
+		t.Errorf("Unexpected stored compressor %q in %v", c.Name(), common.Names())
+	}
+
+	data := testcorpus.Random(256, 5)
+	compressed, err := c.Compress(data)
+	if err != nil || !bytes.Equal(compressed, data) {
+		t.Fatalf("Expected the data unchanged, got %v", err)
+	}
+	if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+	_, err = common.DecompressWithOptions(c, compressed, common.DecompressOptions{MaxOutputSize: 100})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// DefaultMaxOneShotSize は Compress で一度に圧縮できる入力の既定の上限です（512MB）
+// Compress は入力と圧縮結果（と作業領域）をすべてメモリに置くため、これより大きな入力は
+// ストリームの API（StreamCompressor、blocks.Writer、container.CompressFile）で圧縮してください。
+const DefaultMaxOneShotSize = 512 << 20
+
+// ErrInputTooLarge は入力が Compress で一度に圧縮できる上限を超える場合のエラーです（errors.Is で判定）
+var ErrInputTooLarge = errors.New("input too large for one-shot compression")
+
+// InputTooLargeError は Compress で一度に圧縮できる上限を超えた入力です
+type InputTooLargeError struct {
+	Algorithm string // Compressor.Name
+	Size      int64  // 入力のバイト数
+	Limit     int64  // 上限のバイト数
+}
+
+func (e *InputTooLargeError) Error() string {
+	return fmt.Sprintf("%s: input of %d bytes exceeds the one-shot limit of %d bytes "+
+		"(compress it with the streaming API such as container.CompressFile or blocks.Writer, "+
+		"or raise the limit with WithMaxOneShotSize or SetMaxOneShotSize)",
+		e.Algorithm, e.Size, e.Limit)
+}
+
+// Is は target が ErrInputTooLarge かどうかを返します
+func (e *InputTooLargeError) Is(target error) bool {
+	return target == ErrInputTooLarge
+}
+
+// maxOneShotSize は SetMaxOneShotSize で設定したプロセス全体の上限です（0以下は上限なし）
+var maxOneShotSize atomic.Int64
+
+func init() {
+	maxOneShotSize.Store(DefaultMaxOneShotSize)
+}
+
+// SetMaxOneShotSize は Compress で一度に圧縮できる入力の上限を n バイトにし、以前の値を返します
+// n が0以下の場合は上限なしです。WithMaxOneShotSize で上限を設定した Compressor には影響しません。
+// 複数のゴルーチンから同時に呼び出せます。
+func SetMaxOneShotSize(n int64) int64 {
+	return maxOneShotSize.Swap(max(n, 0))
+}
+
+// MaxOneShotSize は Compress で一度に圧縮できる入力の上限を返します（0は上限なし）
+func MaxOneShotSize() int64 {
+	return maxOneShotSize.Load()
+}
+
+// OneShotLimit は Compressor ごとの Compress の入力の上限です
+// ゼロ値は MaxOneShotSize（プロセス全体の上限）に従います。各アルゴリズムは Compress の
+// 最初に Check を呼び出します。
+type OneShotLimit struct {
+	limit int64 // 0は MaxOneShotSize に従う、負は上限なし
+}
+
+// NewOneShotLimit は n バイトを上限とする OneShotLimit を返します（0以下は上限なし）
+func NewOneShotLimit(n int64) OneShotLimit {
+	if n <= 0 {
+		return OneShotLimit{limit: -1}
+	}
+	return OneShotLimit{limit: n}
+}
+
+// Limit は上限のバイト数を返します（0は上限なし）
+func (l OneShotLimit) Limit() int64 {
+	switch {
+	case l.limit == 0:
+		return MaxOneShotSize()
+	case l.limit < 0:
+		return 0
+	}
+	return l.limit
+}
+
+// Check は size バイトの入力が上限を超える場合に *InputTooLargeError を返します
+// algorithm はエラーに含める Compressor.Name です。
+func (l OneShotLimit) Check(algorithm string, size int) error {
+	if limit := l.Limit(); limit > 0 && int64(size) > limit {
+		return &InputTooLargeError{Algorithm: algorithm, Size: int64(size), Limit: limit}
+	}
+	return nil
+}
+
+// OneShotLimited は Compress の入力の上限を Compressor ごとに変更できるインターフェースです
+type OneShotLimited interface {
+	// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+	// Compressor を返します（元の Compressor は変更しません）
+	WithMaxOneShotSize(n int64) Compressor
+}
+
+// WithMaxOneShotSize は c が OneShotLimited を実装していれば、Compress の入力の上限を
+// n バイト（0以下は上限なし）にした Compressor を返します
+// 実装していない場合は c と false を返します。
+func WithMaxOneShotSize(c Compressor, n int64) (Compressor, bool) {
+	if limited, ok := c.(OneShotLimited); ok {
+		return limited.WithMaxOneShotSize(n), true
+	}
+	return c, false
+}
@@ -0,0 +1,63 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+func TestCompress_OneShotLimit(t *testing.T) {
+	previous := common.SetMaxOneShotSize(1000)
+	defer common.SetMaxOneShotSize(previous)
+	if previous != common.DefaultMaxOneShotSize {
+		t.Errorf("Default limit = %d, want %d", previous, common.DefaultMaxOneShotSize)
+	}
+
+	large := testcorpus.Cycle(1001)
+	for _, name := range common.Names() {
+		c, _ := common.New(name)
+		if _, err := c.Compress(large[:1000]); err != nil {
+			t.Errorf("%s: Compress at the limit failed: %v", name, err)
+		}
+
+		_, err := c.Compress(large)
+		var tooLarge *common.InputTooLargeError
+		if !errors.Is(err, common.ErrInputTooLarge) || !errors.As(err, &tooLarge) {
+			t.Errorf("%s: expected ErrInputTooLarge, got %v", name, err)
+			continue
+		}
+		if tooLarge.Size != 1001 || tooLarge.Limit != 1000 || tooLarge.Algorithm != c.Name() {
+			t.Errorf("%s: unexpected error %+v", name, tooLarge)
+		}
+
+		// Compressor ごとの上限は SetMaxOneShotSize より優先する（0以下は上限なし）
+		for _, n := range []int64{2000, 0} {
+			limited, ok := common.WithMaxOneShotSize(c, n)
+			if !ok {
+				t.Fatalf("%s does not implement OneShotLimited", name)
+			}
+			compressed, err := limited.Compress(large)
+			if err != nil {
+				t.Errorf("%s: Compress with limit %d failed: %v", name, n, err)
+				continue
+			}
+			if got, err := limited.Decompress(compressed); err != nil || !bytes.Equal(got, large) {
+				t.Errorf("%s: round trip with limit %d failed: %v", name, n, err)
+			}
+		}
+		limited, _ := common.WithMaxOneShotSize(c, 500)
+		if _, err := limited.Compress(large[:600]); !errors.Is(err, common.ErrInputTooLarge) {
+			t.Errorf("%s: expected ErrInputTooLarge above a lower limit, got %v", name, err)
+		}
+	}
+
+	common.SetMaxOneShotSize(0)
+	if c, _ := common.New("rle"); common.MaxOneShotSize() != 0 {
+		t.Errorf("MaxOneShotSize after SetMaxOneShotSize(0) = %d, want 0", common.MaxOneShotSize())
+	} else if _, err := c.Compress(large); err != nil {
+		t.Errorf("Compress without a limit failed: %v", err)
+	}
+}
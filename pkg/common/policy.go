@@ -0,0 +1,64 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy は圧縮・展開の経路で、指定されていない選択（フォールバック）をしてよいかの設定です
+// ゼロ値はこれまでどおり暗黙の選択を許します。Strict の場合は、指定したアルゴリズムと
+// パラメーターのとおりに処理できないときに、代わりの方法を選ばずに *StrictError を返します。
+// ベンチマークのように、結果が指定したものだけを反映する必要がある場合に使います。
+//
+// 暗黙の選択をする処理は Policy を受け取り（CompressWithTarget など）、Compressor は
+// PolicyAware を実装して WithPolicy で設定します。
+type Policy struct {
+	Strict bool
+}
+
+// ErrStrict は Policy.Strict のために暗黙の選択を拒否したことを表します（errors.Is で判定）
+var ErrStrict = errors.New("strict")
+
+// StrictError は Policy.Strict のために拒否した暗黙の選択です
+type StrictError struct {
+	Behavior string // 拒否した動作
+	Enable   string // その動作を使う場合の指定（フラグやオプション）
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("refused: %s (%s)", e.Behavior, e.Enable)
+}
+
+// Is は target が ErrStrict かどうかを返します
+func (e *StrictError) Is(target error) bool {
+	return target == ErrStrict
+}
+
+// Refuse は Strict の場合に behavior を拒否する *StrictError を返します（それ以外は nil）
+// enable にはその動作を使う場合の指定を書きます。
+func (p Policy) Refuse(behavior, enable string) error {
+	if !p.Strict {
+		return nil
+	}
+	return &StrictError{Behavior: behavior, Enable: enable}
+}
+
+// RefuseStored は、圧縮すると大きくなるため元のデータをそのまま格納することを拒否します
+func (p Policy) RefuseStored() error {
+	return p.Refuse("output would expand", "stored without -strict")
+}
+
+// PolicyAware は Policy に従って暗黙の選択をする Compressor です
+type PolicyAware interface {
+	// WithPolicy は p に従う Compressor を返します（元の Compressor は変更しません）
+	WithPolicy(p Policy) Compressor
+}
+
+// WithPolicy は c が PolicyAware を実装していれば p に従う Compressor を返します
+// 実装していない Compressor は暗黙の選択をしないため、c をそのまま返します。
+func WithPolicy(c Compressor, p Policy) Compressor {
+	if aware, ok := c.(PolicyAware); ok {
+		return aware.WithPolicy(p)
+	}
+	return c
+}
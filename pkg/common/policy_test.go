@@ -0,0 +1,98 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+var strict = common.Policy{Strict: true}
+
+// expectStrict は err が暗黙の選択を拒否した *StrictError であることを確認します
+func expectStrict(t *testing.T, err error, behavior string) {
+	t.Helper()
+	var se *common.StrictError
+	if !errors.As(err, &se) || !errors.Is(err, common.ErrStrict) {
+		t.Fatalf("Expected a StrictError, got %v", err)
+	}
+	if !strings.Contains(se.Behavior, behavior) || se.Enable == "" || !strings.HasPrefix(err.Error(), "refused: ") {
+		t.Errorf("Unexpected strict error %q (behavior %q, enable %q)", err, se.Behavior, se.Enable)
+	}
+}
+
+func TestPolicy_CompressNoExpand(t *testing.T) {
+	random := testcorpus.Random(4096, 3)
+
+	// 小さくならないデータは、通常は元のまま返し、Strict ではエラーにする
+	if out, compressed, err := (common.Policy{}).CompressNoExpand(rle.NewCompressor(), random); err != nil || compressed || !bytes.Equal(out, random) {
+		t.Errorf("Expected the original bytes, got compressed=%v err=%v", compressed, err)
+	}
+	_, _, err := strict.CompressNoExpand(rle.NewCompressor(), random)
+	expectStrict(t, err, "output would expand")
+
+	// 小さくなるデータと空のデータは Strict でも変わらない
+	if _, compressed, err := strict.CompressNoExpand(rle.NewCompressor(), make([]byte, 4096)); err != nil || !compressed {
+		t.Errorf("Expected compressed zeros, got compressed=%v err=%v", compressed, err)
+	}
+	if _, compressed, err := strict.CompressNoExpand(rle.NewCompressor(), nil); err != nil || compressed {
+		t.Errorf("Expected empty data to pass, got compressed=%v err=%v", compressed, err)
+	}
+}
+
+func TestPolicy_CompressWithTarget(t *testing.T) {
+	random := testcorpus.Random(4096, 1)
+	c := mustNew(t, "rle")
+
+	if _, used, _, err := (common.Policy{}).CompressWithTarget(random, 0.7, c); err != nil || used != common.StoredAlgorithm {
+		t.Errorf("Expected the stored fallback, got used=%q err=%v", used, err)
+	}
+	_, _, _, err := strict.CompressWithTarget(random, 0.7, c)
+	expectStrict(t, err, "target ratio")
+
+	// 複数の候補から選ぶことも暗黙の選択になる
+	var calls []string
+	_, _, _, err = strict.CompressWithTarget(random, 0.7, fixedCompressor{"a", 0.5, &calls}, fixedCompressor{"b", 0.5, &calls})
+	expectStrict(t, err, "several algorithms")
+	if len(calls) != 0 {
+		t.Errorf("Candidates were tried in strict mode: %v", calls)
+	}
+
+	// 目標を満たせば Strict でも同じ結果
+	zeros := make([]byte, 4096)
+	if _, used, met, err := strict.CompressWithTarget(zeros, 0.7, c); err != nil || !met || used != c.Name() {
+		t.Errorf("Expected %s to meet the target, got used=%q met=%v err=%v", c.Name(), used, met, err)
+	}
+}
+
+func TestPolicy_BestOf(t *testing.T) {
+	random := testcorpus.Random(4096, 2)
+	for _, best := range []common.Compressor{common.NewBestOf(bestOfCandidates()...), common.NewParallelBestOf(bestOfCandidates()...)} {
+		if out, err := best.Compress(random); err != nil || out[0] != 0 {
+			t.Errorf("Expected the stored fallback, got %v", err)
+		}
+		strictBest := common.WithPolicy(best, strict)
+		_, err := strictBest.Compress(random)
+		expectStrict(t, err, "output would expand")
+
+		// 小さくなる候補があれば Strict でも同じ出力
+		want, _ := best.Compress(runHeavy())
+		if got, err := strictBest.Compress(runHeavy()); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Strict output differs for compressible data (err %v)", err)
+		}
+	}
+}
+
+func TestWithPolicy_NotAware(t *testing.T) {
+	c := rle.NewCompressor()
+	if got := common.WithPolicy(c, strict); got != common.Compressor(c) {
+		t.Errorf("Expected the compressor unchanged, got %v", got)
+	}
+	if err := (common.Policy{}).Refuse("anything", "-flag"); err != nil {
+		t.Errorf("Expected nil without Strict, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package common
+
+import "os"
+
+// os.Stdout に表示する互換用の Print... はこのファイルにまとめます
+// ほかに os を使うのは safety.go の期限切れのエラー（os.ErrDeadlineExceeded）だけで、
+// ファイルは開きません。WebAssembly（GOOS=js）向けのビルドでは Fprint... を使ってください。
+
+// PrintCompressionStats は圧縮統計を見やすく表示します
+func PrintCompressionStats(stats CompressionStats) {
+	FprintCompressionStats(os.Stdout, stats)
+}
+
+// PrintAggregate は複数の圧縮結果の集計を見やすく表示します
+func PrintAggregate(a StatsAggregate) {
+	FprintAggregate(os.Stdout, a)
+}
+
+// PrintDataType はデータの種類とおすすめの設定を表示します
+func PrintDataType(dt DataType) {
+	FprintDataType(os.Stdout, dt)
+}
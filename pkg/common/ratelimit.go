@@ -0,0 +1,72 @@
+package common
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// rateBucketDivisor はバケットの大きさを決める値です（1秒あたりのバイト数の 1/rateBucketDivisor）
+// バケットが小さいほど読み込みの間隔が均等になり、大きいほど1回の Read で多く読めます。
+const rateBucketDivisor = 10
+
+// RateLimitedReader は読み込む速度を1秒あたりのバイト数で制限する io.Reader です
+// トークンバケットで、Read はバケットの大きさ（0.1 秒分）までを先に読み、読んだ分の
+// トークンがたまるまで次の Read を待たせます。待つ間は足りない分がたまる時間だけ sleep し、
+// ビジーループはしません。止まっていた間のトークンは持ち越さないため、待たずに読める
+// 量（バースト）は常に1バケットまでで、N バイトを読み終える（EOF を返す）までの時間は
+// N / 1秒あたりのバイト数 になります。バケットより大きな Read は分割します。
+// 同時に複数のゴルーチンから使うことはできません。
+type RateLimitedReader struct {
+	r      io.Reader
+	rate   int64   // 1秒あたりのバイト数
+	bucket int64   // バケットの大きさ（1回の Read で読む最大のバイト数）
+	debt   float64 // 先に読んだ分のうち、まだトークンがたまっていないバイト数
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimitedReader は r から1秒あたり bytesPerSec バイトまで読み込む Reader を作成します
+// bytesPerSec が0以下の場合は制限しません。
+func NewRateLimitedReader(r io.Reader, bytesPerSec int64) *RateLimitedReader {
+	return newRateLimitedReader(r, bytesPerSec, time.Now, time.Sleep)
+}
+
+func newRateLimitedReader(r io.Reader, bytesPerSec int64, now func() time.Time, sleep func(time.Duration)) *RateLimitedReader {
+	return &RateLimitedReader{
+		r:      r,
+		rate:   bytesPerSec,
+		bucket: max(bytesPerSec/rateBucketDivisor, 1),
+		last:   now(),
+		now:    now,
+		sleep:  sleep,
+	}
+}
+
+// Read は前の Read で先に読んだ分のトークンがたまるまで待ってから、バケットの大きさまで読み込みます
+func (l *RateLimitedReader) Read(p []byte) (int, error) {
+	if l.rate <= 0 || len(p) == 0 {
+		return l.r.Read(p)
+	}
+
+	for l.refill(); l.debt > 0; l.refill() {
+		// 足りない分がたまる時間だけ待つ（sleep が早く戻った場合はもう一度待つ）
+		wait := math.Ceil(l.debt / float64(l.rate) * float64(time.Second))
+		l.sleep(max(time.Duration(wait), 1))
+	}
+
+	n, err := l.r.Read(p[:min(int64(len(p)), l.bucket)])
+	l.debt += float64(n)
+	return n, err
+}
+
+// refill は前回からの経過時間の分だけトークンを補充し、先に読んだ分に充てます
+func (l *RateLimitedReader) refill() {
+	now := l.now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.debt = max(0, l.debt-elapsed.Seconds()*float64(l.rate))
+	}
+	l.last = now
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// fakeClock は sleep で時間が進む、テスト用の時計です
+type fakeClock struct {
+	now    time.Time
+	slept  time.Duration // sleep した合計
+	sleeps int           // sleep の回数
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+	c.sleeps++
+}
+
+func newFakeLimiter(r io.Reader, rate int64) (*RateLimitedReader, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	return newRateLimitedReader(r, rate, clock.Now, clock.Sleep), clock
+}
+
+func TestRateLimitedReader_Pacing(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 10000)
+	l, clock := newFakeLimiter(bytes.NewReader(data), 1000)
+
+	got, err := io.ReadAll(l)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadAll returned %d bytes (err %v)", len(got), err)
+	}
+	// EOF を返すまでに 10000 バイト / 1000 バイト毎秒 = 10秒
+	if want := 10 * time.Second; clock.slept < want-time.Millisecond || clock.slept > want+time.Millisecond {
+		t.Errorf("Expected %v of sleep, got %v", want, clock.slept)
+	}
+}
+
+func TestRateLimitedReader_SplitsLargeReads(t *testing.T) {
+	data := bytes.Repeat([]byte("y"), 5000)
+	l, clock := newFakeLimiter(bytes.NewReader(data), 1000)
+
+	// 1回の大きな Read はバケットの大きさ（100バイト）までに分割する
+	buf := make([]byte, len(data))
+	n, err := l.Read(buf)
+	if err != nil || n != 100 {
+		t.Fatalf("Expected a read of one bucket, got %d (err %v)", n, err)
+	}
+	if clock.sleeps != 0 {
+		t.Errorf("First bucket should not wait, slept %v", clock.slept)
+	}
+
+	// 次の Read は1バケット分（0.1秒）待つ
+	n, err = l.Read(buf)
+	if err != nil || n != 100 || clock.slept != 100*time.Millisecond || clock.sleeps != 1 {
+		t.Errorf("Expected one sleep of 100ms for the next bucket, got %d bytes after %d sleeps of %v (err %v)", n, clock.sleeps, clock.slept, err)
+	}
+}
+
+func TestRateLimitedReader_Burst(t *testing.T) {
+	l, clock := newFakeLimiter(bytes.NewReader(make([]byte, 1000)), 1000)
+	buf := make([]byte, 100)
+	l.Read(buf)
+
+	// 止まっていた間のトークンは持ち越さないため、待たずに読めるのは1バケットまで
+	clock.now = clock.now.Add(time.Minute)
+	if n, _ := l.Read(buf); n != 100 || clock.sleeps != 0 {
+		t.Fatalf("Expected an immediate read after idling, got %d bytes, %d sleeps", n, clock.sleeps)
+	}
+	if n, _ := l.Read(buf); n != 100 || clock.slept != 100*time.Millisecond {
+		t.Errorf("Expected the burst to be limited to one bucket, slept %v", clock.slept)
+	}
+
+	// 小さな Read の後はその分だけ待つ
+	l.Read(buf[:10])
+	before := clock.slept
+	if n, _ := l.Read(buf); n != 100 || clock.slept-before != 10*time.Millisecond {
+		t.Errorf("Expected 10ms after reading 10 bytes, got %v", clock.slept-before)
+	}
+}
+
+func TestRateLimitedReader_ShortReads(t *testing.T) {
+	// 元の Reader が少しずつしか返さない場合は、読めた分だけトークンを消費する
+	data := bytes.Repeat([]byte("z"), 1000)
+	l, clock := newFakeLimiter(iotest.OneByteReader(bytes.NewReader(data)), 1000)
+
+	got, err := io.ReadAll(l)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadAll returned %d bytes (err %v)", len(got), err)
+	}
+	if want := time.Second; clock.slept < want-time.Millisecond || clock.slept > want+time.Millisecond {
+		t.Errorf("Expected %v of sleep, got %v", want, clock.slept)
+	}
+}
+
+func TestRateLimitedReader_Unlimited(t *testing.T) {
+	l, clock := newFakeLimiter(bytes.NewReader(make([]byte, 1<<20)), 0)
+	if n, _ := io.Copy(io.Discard, l); n != 1<<20 || clock.sleeps != 0 {
+		t.Errorf("Expected no limit for rate 0, got %d bytes, %d sleeps", n, clock.sleeps)
+	}
+}
+
+func TestRateLimitedReader_WallTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wall clock test in short mode")
+	}
+	// 1秒あたり 200KB で 100KB を読むと約0.5秒
+	const rate, size = 200 << 10, 100 << 10
+	start := time.Now()
+	n, err := io.Copy(io.Discard, NewRateLimitedReader(bytes.NewReader(make([]byte, size)), rate))
+	elapsed := time.Since(start)
+	if err != nil || n != size {
+		t.Fatalf("Copy returned %d bytes (err %v)", n, err)
+	}
+	if elapsed < 450*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("Expected about 500ms for %d bytes at %d bytes/s, took %v", size, rate, elapsed)
+	}
+}
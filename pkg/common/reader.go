@@ -0,0 +1,103 @@
+package common
+
+import "io"
+
+// pipeReader はゴルーチンで実行するストリーム処理の出力を読み込むReaderです
+type pipeReader struct {
+	pr   *io.PipeReader
+	done chan struct{} // ゴルーチンの終了時に閉じられる
+}
+
+// NewCompressingReader は src を読みながら圧縮したデータを返すReaderを作成します
+// 圧縮はゴルーチンで c.CompressStream を実行して行い、io.Pipe で受け渡します。
+// http.Request のBodyやコマンドの標準入力のように、io.Reader を受け取るAPIと組み合わせられます。
+//
+// 圧縮中のエラー（src の読み込みエラーを含む）は Read のエラーとして返されます。
+// 最後まで読まずに Close した場合は、ゴルーチンの書き込みが失敗して終了します。
+// Close はゴルーチンの終了を待つため、src の読み込みが戻らない場合は Close も戻りません。
+func NewCompressingReader(src io.Reader, c StreamCompressor) io.ReadCloser {
+	return newPipeReader(src, c.CompressStream)
+}
+
+// NewDecompressingReader は圧縮された src を読みながら展開したデータを返すReaderを作成します
+// エラーの伝播と Close の動作は NewCompressingReader と同じです。
+func NewDecompressingReader(src io.Reader, c StreamCompressor) io.ReadCloser {
+	return newPipeReader(src, c.DecompressStream)
+}
+
+// newPipeReader は transform をゴルーチンで実行し、その出力を読み込むReaderを作成します
+func newPipeReader(src io.Reader, transform func(io.Reader, io.Writer) error) *pipeReader {
+	pr, pw := io.Pipe()
+	r := &pipeReader{pr: pr, done: make(chan struct{})}
+
+	go func() {
+		defer close(r.done)
+		// err が nil の場合、読み込み側には io.EOF が返される
+		pw.CloseWithError(transform(src, pw))
+	}()
+
+	return r
+}
+
+// Read は変換後のデータを読み込みます
+func (r *pipeReader) Read(p []byte) (int, error) {
+	return r.pr.Read(p)
+}
+
+// Close は読み込みを終了し、ゴルーチンの終了を待ちます
+func (r *pipeReader) Close() error {
+	// 以降のゴルーチンの書き込みは io.ErrClosedPipe で失敗する
+	r.pr.Close()
+	<-r.done
+	return nil
+}
+
+// pipeWriter は書き込んだデータをゴルーチンで実行するストリーム処理に渡すWriterです
+type pipeWriter struct {
+	pw   *io.PipeWriter
+	done chan struct{} // ゴルーチンの終了時に閉じられる
+	err  error         // ストリーム処理のエラー（done が閉じてから読む）
+}
+
+// NewCompressingWriter は書き込んだデータを圧縮して dst に書き込むWriterを作成します
+// 圧縮はゴルーチンで c.CompressStream を実行して行い、io.Pipe で受け渡します。
+// io.WriteCloser を受け取るAPI（compress/flate の Writer の代わりなど）と組み合わせられます。
+//
+// Close で入力の終わりを伝え、圧縮結果を dst に書き込み終わるまで待ちます（dst は閉じません）。
+// 圧縮中のエラー（dst への書き込みエラーを含む）は、以降の Write と Close のエラーとして返されます。
+func NewCompressingWriter(dst io.Writer, c StreamCompressor) io.WriteCloser {
+	pr, pw := io.Pipe()
+	w := &pipeWriter{pw: pw, done: make(chan struct{})}
+
+	go func() {
+		defer close(w.done)
+		w.err = c.CompressStream(pr, dst)
+		// 入力を最後まで読まずに終わった場合も、以降の Write がブロックしないようにする
+		if w.err != nil {
+			pr.CloseWithError(w.err)
+		} else {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+	}()
+
+	return w
+}
+
+// Write は圧縮するデータを書き込みます
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	if err != nil {
+		<-w.done
+		if w.err != nil {
+			return n, w.err
+		}
+	}
+	return n, err
+}
+
+// Close は入力の終わりを伝え、ストリーム処理の終了を待ってそのエラーを返します
+func (w *pipeWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
@@ -0,0 +1,137 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// checkNoGoroutineLeak はテスト終了時にゴルーチン数が開始時に戻ることを確認します
+func checkNoGoroutineLeak(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				t.Errorf("goroutine leak: %d before, %d after", before, runtime.NumGoroutine())
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// readInChunks は chunk バイトずつ読み込みます
+func readInChunks(r io.Reader, chunk int) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, chunk)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+// failingReader は data を返した後にエラーを返すReaderです
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestCompressingReader_OddChunks(t *testing.T) {
+	checkNoGoroutineLeak(t)
+	c := rle.NewCompressor()
+
+	for _, sample := range testcorpus.Samples() {
+		expected, _ := c.Compress(sample.Data)
+
+		for _, chunk := range []int{1, 3, 7, 509} {
+			r := common.NewCompressingReader(bytes.NewReader(sample.Data), c)
+			compressed, err := readInChunks(r, chunk)
+			r.Close()
+			if err != nil {
+				t.Fatalf("%s: read failed: %v", sample.Name, err)
+			}
+			if !bytes.Equal(compressed, expected) {
+				t.Fatalf("%s (chunk %d): stream output differs from Compress", sample.Name, chunk)
+			}
+
+			d := common.NewDecompressingReader(bytes.NewReader(compressed), c)
+			decompressed, err := readInChunks(d, chunk)
+			d.Close()
+			if err != nil {
+				t.Fatalf("%s: decompressing read failed: %v", sample.Name, err)
+			}
+			if !bytes.Equal(decompressed, sample.Data) {
+				t.Fatalf("%s (chunk %d): round trip mismatch", sample.Name, chunk)
+			}
+		}
+	}
+}
+
+func TestCompressingReader_CloseHalfway(t *testing.T) {
+	checkNoGoroutineLeak(t)
+
+	// 圧縮しても大きいままのデータ（パイプのバッファで止まる）
+	data := testcorpus.Random(1<<20, 1)
+	r := common.NewCompressingReader(bytes.NewReader(data), rle.NewCompressor())
+
+	buf := make([]byte, 1000)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := r.Read(buf); err == nil {
+		t.Error("Expected error reading after Close")
+	}
+}
+
+func TestCompressingReader_SourceError(t *testing.T) {
+	checkNoGoroutineLeak(t)
+	sourceErr := errors.New("disk on fire")
+
+	src := &failingReader{data: []byte("aaaabbbb"), err: sourceErr}
+	r := common.NewCompressingReader(src, rle.NewCompressor())
+	defer r.Close()
+
+	if _, err := io.ReadAll(r); !errors.Is(err, sourceErr) {
+		t.Errorf("Expected source error, got %v", err)
+	}
+}
+
+func TestDecompressingReader_InvalidData(t *testing.T) {
+	checkNoGoroutineLeak(t)
+
+	// 奇数バイトのRLEデータは展開エラーになる
+	r := common.NewDecompressingReader(bytes.NewReader([]byte{'a', 3, 'b'}), rle.NewCompressor())
+	defer r.Close()
+
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("Expected decompression error")
+	}
+}
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory は新しいCompressorを作成する関数です
+type Factory func() Compressor
+
+// ContainerExtension は拡張子を宣言していないアルゴリズムの圧縮ファイルの拡張子です
+// CLIの圧縮ファイルはどのアルゴリズムでも.tzzコンテナで、拡張子は名前の付け方の規則だけです。
+const ContainerExtension = ".tzz"
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Descriptor)
+)
+
+// Register はアルゴリズムを名前付きで登録します
+// 能力や説明を持たない Descriptor{Name: name, NewFunc: factory} を登録する RegisterDescriptor と同じです。
+// 新しいアルゴリズムは RegisterDescriptor で能力と説明を宣言してください。
+func Register(name string, factory Factory) {
+	RegisterDescriptor(Descriptor{Name: name, NewFunc: factory})
+}
+
+// RegisterDescriptor はアルゴリズムを説明 d とともに登録します
+// 各アルゴリズムのパッケージが init() から呼び出すことを想定しています。
+// d.ID は番号の表（AlgorithmID）から設定するため、0のままでかまいません。
+// NewFunc が nil の場合、表と異なる ID、不正な拡張子、同じ名前の二重の登録ではpanicします。
+func RegisterDescriptor(d Descriptor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if d.NewFunc == nil {
+		panic("common: Register factory is nil")
+	}
+	if _, exists := registry[d.Name]; exists {
+		panic(fmt.Sprintf("common: Register called twice for algorithm %q", d.Name))
+	}
+	if id, _ := AlgorithmID(d.Name); d.ID != 0 && d.ID != id {
+		panic(fmt.Sprintf("common: Register called with ID %d for algorithm %q, want %d", d.ID, d.Name, id))
+	} else {
+		d.ID = id
+	}
+	for _, ext := range d.Extensions {
+		checkExtension(ext)
+	}
+	d.Extensions = append([]string(nil), d.Extensions...)
+	registry[d.Name] = d
+}
+
+// New は登録済みのアルゴリズム名からCompressorを作成します
+// StoredAlgorithm は登録しなくても NewStored で作成します（Names には含めません）。
+func New(name string) (Compressor, error) {
+	registryMu.RLock()
+	d, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok && name == StoredAlgorithm {
+		return NewStored(), nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm: %s", name)
+	}
+	return d.NewFunc(), nil
+}
+
+// Names は登録済みのアルゴリズム名をソートして返します
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterExtension は登録済みのアルゴリズム name の圧縮ファイルの拡張子を宣言します
+// CLIは -o を省略した場合にこの拡張子を付け、展開では既知の拡張子を除いて出力ファイル名にします。
+// ext は "." で始まり、ほかに "." やディレクトリの区切りを含まない拡張子です（例: ".lz77"）。
+// 複数のアルゴリズムが同じ拡張子を宣言してもかまいません。Register と同じく init() から呼び出し、
+// 登録していない名前、不正な拡張子、二重の宣言（Descriptor.Extensions を含む）ではpanicします。
+func RegisterExtension(name, ext string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	d, ok := registry[name]
+	if !ok {
+		panic(fmt.Sprintf("common: RegisterExtension called for unregistered algorithm %q", name))
+	}
+	checkExtension(ext)
+	if len(d.Extensions) > 0 {
+		panic(fmt.Sprintf("common: RegisterExtension called twice for algorithm %q", name))
+	}
+	d.Extensions = []string{ext}
+	registry[name] = d
+}
+
+// checkExtension は ext が圧縮ファイルの拡張子として正しくなければpanicします
+func checkExtension(ext string) {
+	if len(ext) < 2 || ext[0] != '.' || strings.ContainsAny(ext[1:], `./\`) {
+		panic(fmt.Sprintf("common: RegisterExtension called with invalid extension %q", ext))
+	}
+}
+
+// Extension はアルゴリズム name の圧縮ファイルの拡張子を返します（Descriptor.Extensions の最初）
+// 拡張子を宣言していないアルゴリズムや登録していない名前は ContainerExtension です。
+func Extension(name string) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if d, ok := registry[name]; ok && len(d.Extensions) > 0 {
+		return d.Extensions[0]
+	}
+	return ContainerExtension
+}
+
+// Extensions は宣言された拡張子と ContainerExtension を、重複を除いてソートして返します
+func Extensions() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	seen := map[string]bool{ContainerExtension: true}
+	exts := []string{ContainerExtension}
+	for _, d := range registry {
+		for _, ext := range d.Extensions {
+			if !seen[ext] {
+				seen[ext] = true
+				exts = append(exts, ext)
+			}
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// algorithmIDs は圧縮データに記録するアルゴリズムの番号の表です（番号は添字 + 1）
+// 0は番号を持たない（登録していない）Compressor を表します。番号は圧縮データに残るため、
+// 既存の名前の順序は変えずに末尾にだけ追加してください。
+var algorithmIDs = []string{
+	"rle", "rle-gamma", "huffman", "huffman16", "lz77", "lz77-optimal", "lz77h",
+	"lzw", "lzp", "gzip", "zlib", StoredAlgorithm, BestOfAlgorithm,
+}
+
+// AlgorithmID は登録名 name の番号を返します（番号の表にない名前は false）
+func AlgorithmID(name string) (byte, bool) {
+	for i, n := range algorithmIDs {
+		if n == name {
+			return byte(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// AlgorithmByID は番号 id の登録名を返します（表にない番号は false）
+// 名前が表にあっても、そのアルゴリズムのパッケージがリンクされていなければ New は失敗します。
+func AlgorithmByID(id byte) (string, bool) {
+	if id == 0 || int(id) > len(algorithmIDs) {
+		return "", false
+	}
+	return algorithmIDs[id-1], true
+}
+
+// RegisteredName は c と同じ Name の Compressor を作成する登録名を返します（ない場合は false）
+// 登録済みのファクトリーで作成した Compressor の Name と比べるため、オプションを変えた
+// Compressor（lz77.WithAdaptiveLookahead など）も、圧縮データの形式が同じなら同じ登録名です。
+func RegisteredName(c Compressor) (string, bool) {
+	name := c.Name()
+	if name == StoredAlgorithm {
+		return StoredAlgorithm, true
+	}
+
+	// ファクトリーが New を呼び出すことがあるため、ロックを外してから作成する
+	registryMu.RLock()
+	factories := make(map[string]Factory, len(registry))
+	for n, d := range registry {
+		factories[n] = d.NewFunc
+	}
+	registryMu.RUnlock()
+
+	for _, n := range Names() {
+		if f, ok := factories[n]; ok && f().Name() == name {
+			return n, true
+		}
+	}
+	return "", false
+}
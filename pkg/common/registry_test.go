@@ -0,0 +1,360 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+func TestRegistry_BuiltinAlgorithms(t *testing.T) {
+	names := common.Names()
+	for _, want := range []string{"huffman", "lz77", "rle"} {
+		found := false
+		for _, name := range names {
+			if name == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %q to be registered, got %v", want, names)
+		}
+	}
+}
+
+func TestRegistry_UnknownAlgorithm(t *testing.T) {
+	if _, err := common.New("no-such-algorithm"); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+func TestRegistry_DuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for duplicate registration")
+		}
+	}()
+	common.Register("rle", func() common.Compressor { return nil })
+}
+
+// 番号は圧縮データ（パイプラインのヘッダー）に記録するため、登録したアルゴリズムには番号が必要です
+func TestRegistry_AlgorithmIDs(t *testing.T) {
+	seen := map[byte]string{}
+	for _, name := range common.Names() {
+		id, ok := common.AlgorithmID(name)
+		if !ok {
+			t.Errorf("%q has no algorithm ID; append it to algorithmIDs", name)
+			continue
+		}
+		if other, dup := seen[id]; dup {
+			t.Errorf("%q and %q share algorithm ID %d", name, other, id)
+		}
+		seen[id] = name
+		if back, ok := common.AlgorithmByID(id); !ok || back != name {
+			t.Errorf("AlgorithmByID(%d) = %q, want %q", id, back, name)
+		}
+
+		c, err := common.New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := common.RegisteredName(c); !ok || got != name {
+			t.Errorf("RegisteredName(New(%q)) = %q, %v", name, got, ok)
+		}
+	}
+	if _, ok := common.AlgorithmByID(0); ok {
+		t.Error("ID 0 should not name an algorithm")
+	}
+}
+
+// 登録したアルゴリズムは能力と説明を宣言しなければなりません（Register ではなく RegisterDescriptor で登録する）
+func TestDescribe_Complete(t *testing.T) {
+	all := common.DescribeAll()
+	if len(all) != len(common.Names()) {
+		t.Fatalf("Expected a descriptor for each of %v, got %d", common.Names(), len(all))
+	}
+	for i, d := range all {
+		if d.Name != common.Names()[i] {
+			t.Errorf("Descriptor %d is %q, want %q", i, d.Name, common.Names()[i])
+		}
+		if d.Capabilities == 0 || d.Description == "" || d.UseCase == "" || d.NewFunc == nil {
+			t.Errorf("%s: incomplete descriptor (capabilities %v, description %q, use case %q); register it with RegisterDescriptor",
+				d.Name, d.Capabilities, d.Description, d.UseCase)
+		}
+		if id, _ := common.AlgorithmID(d.Name); d.ID == 0 || d.ID != id {
+			t.Errorf("%s: ID %d, want %d", d.Name, d.ID, id)
+		}
+		if d.MinVersion > d.MaxVersion {
+			t.Errorf("%s: version range %d-%d is empty", d.Name, d.MinVersion, d.MaxVersion)
+		}
+		if got, ok := common.Describe(d.Name); !ok || got.Name != d.Name {
+			t.Errorf("Describe(%q) = %+v, %v", d.Name, got, ok)
+		}
+	}
+
+	if d, ok := common.Describe(common.StoredAlgorithm); !ok || d.Capabilities == 0 || d.NewFunc().Name() != common.StoredAlgorithm {
+		t.Errorf("Expected a descriptor for %q, got %+v, %v", common.StoredAlgorithm, d, ok)
+	}
+	if _, ok := common.Describe("no-such-algorithm"); ok {
+		t.Error("Expected no descriptor for an unknown algorithm")
+	}
+}
+
+// TestDescribe_CapabilitiesMatch は宣言した能力が Compressor の実装と一致することを確認します
+func TestDescribe_CapabilitiesMatch(t *testing.T) {
+	streamType := reflect.TypeFor[common.StreamCompressor]()
+	data := testcorpus.Samples()[0].Data
+	for _, d := range common.DescribeAll() {
+		c := d.NewFunc()
+		typ := reflect.TypeOf(c)
+		_, dict := typ.MethodByName("WithDict")
+		_, levels := typ.MethodByName("Level")
+		for capability, has := range map[common.Capability]bool{
+			common.CapStreaming:  d.NewStreamFunc != nil || typ.Implements(streamType),
+			common.CapDictionary: dict,
+			common.CapLevels:     levels,
+		} {
+			if d.Has(capability) != has {
+				t.Errorf("%s: declares %v = %v, but %v implements it = %v", d.Name, capability, d.Has(capability), typ, has)
+			}
+		}
+		if v := common.FormatVersion(c); d.MaxVersion != v {
+			t.Errorf("%s: MaxVersion %d, but FormatVersion is %d", d.Name, d.MaxVersion, v)
+		}
+		if got := common.Extension(d.Name); len(d.Extensions) > 0 && got != d.Extensions[0] {
+			t.Errorf("%s: Extension is %s, want %s", d.Name, got, d.Extensions[0])
+		}
+
+		if d.Has(common.CapDeterministic) {
+			first, err1 := c.Compress(data)
+			second, err2 := d.NewFunc().Compress(data)
+			if err1 != nil || err2 != nil || !bytes.Equal(first, second) {
+				t.Errorf("%s: declared deterministic, but two compressions differ (%v, %v)", d.Name, err1, err2)
+			}
+		}
+		if d.NewStreamFunc != nil {
+			var compressed bytes.Buffer
+			if err := d.NewStreamFunc().CompressStream(bytes.NewReader(data), &compressed); err != nil {
+				t.Fatalf("%s: CompressStream failed: %v", d.Name, err)
+			}
+			if got, err := c.Decompress(compressed.Bytes()); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: NewStreamFunc output is not readable by NewFunc (%v)", d.Name, err)
+			}
+		}
+	}
+
+	if got := (common.CapStreaming | common.CapDeterministic).String(); got != "streaming, deterministic" {
+		t.Errorf("Unexpected capability string %q", got)
+	}
+	if got := common.Capability(0).String(); got != "-" {
+		t.Errorf("Unexpected empty capability string %q", got)
+	}
+}
+
+func TestRegistry_Extensions(t *testing.T) {
+	if got := common.Extension("lz77"); got != ".lz77" {
+		t.Errorf("Expected .lz77, got %s", got)
+	}
+	if got := common.Extension("gzip"); got != common.ContainerExtension {
+		t.Errorf("Expected an undeclared extension to be %s, got %s", common.ContainerExtension, got)
+	}
+	if got := common.Extension("no-such-algorithm"); got != common.ContainerExtension {
+		t.Errorf("Expected an unknown algorithm to be %s, got %s", common.ContainerExtension, got)
+	}
+
+	exts := common.Extensions()
+	for _, want := range []string{".tzz", ".rle", ".huf", ".lz77"} {
+		n := 0
+		for _, ext := range exts {
+			if ext == want {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("Expected %s exactly once in %v", want, exts)
+		}
+	}
+
+	for name, call := range map[string]func(){
+		"unregistered": func() { common.RegisterExtension("no-such-algorithm", ".x") },
+		"no dot":       func() { common.RegisterExtension("gzip", "gz") },
+		"two dots":     func() { common.RegisterExtension("gzip", ".tar.gz") },
+		"separator":    func() { common.RegisterExtension("gzip", ".a/b") },
+		"twice":        func() { common.RegisterExtension("rle", ".rle") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			call()
+		}()
+	}
+}
+
+// TestRegistry_TinyInputSizes は0〜3バイトの入力の圧縮サイズを固定します
+// 空の入力でも各アルゴリズムは空でない圧縮データを出力し、空の圧縮データは展開エラーになります
+func TestRegistry_TinyInputSizes(t *testing.T) {
+	inputs := []string{"", "a", "ab", "abc"}
+	expected := map[string][]int{
+		"rle":          {2, 2, 4, 6},
+		"rle-gamma":    {1, 2, 3, 4},
+		"huffman":      {11, 12, 17, 22},
+		"huffman16":    {3, 4, 8, 9},
+		"lz77":         {1, 2, 4, 5},
+		"lz77-optimal": {1, 2, 4, 5},
+		"lz77h":        {1, 15, 20, 25},
+		"lzp":          {1, 2, 3, 4},
+		"lzw":          {1, 2, 4, 5},
+		"gzip":         {20, 26, 27, 28},
+		"zlib":         {8, 14, 15, 16},
+	}
+
+	for _, name := range common.Names() {
+		t.Run(name, func(t *testing.T) {
+			sizes, ok := expected[name]
+			if !ok {
+				t.Fatalf("No expected sizes for %q", name)
+			}
+			compressor, err := common.New(name)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			for i, input := range inputs {
+				compressed, err := compressor.Compress([]byte(input))
+				if err != nil {
+					t.Fatalf("%q: Compress failed: %v", input, err)
+				}
+				if len(compressed) != sizes[i] {
+					t.Errorf("%q: expected %d bytes, got %d (% x)", input, sizes[i], len(compressed), compressed)
+				}
+
+				decompressed, err := compressor.Decompress(compressed)
+				if err != nil {
+					t.Fatalf("%q: Decompress failed: %v", input, err)
+				}
+				if string(decompressed) != input {
+					t.Errorf("%q: round trip mismatch: got %q", input, decompressed)
+				}
+			}
+
+			if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+				t.Errorf("Expected ErrInvalidData for empty compressed data, got %v", err)
+			}
+		})
+	}
+}
+
+// concurrencyInputs はゴルーチンごとに異なる入力を用意します
+func concurrencyInputs(n int) [][]byte {
+	samples := testcorpus.Samples()
+	inputs := make([][]byte, n)
+	for i := range inputs {
+		base := samples[i%len(samples)].Data
+		inputs[i] = append([]byte(fmt.Sprintf("goroutine-%d:", i)), base...)
+	}
+	return inputs
+}
+
+// TestRegistry_ConcurrentUse は登録済みの各Compressorを1つのインスタンスで
+// 16個のゴルーチンから同時に使用し、単一スレッドの結果と一致することを確認します
+// （go test -race で実行するとデータ競合も検出されます）
+func TestRegistry_ConcurrentUse(t *testing.T) {
+	const goroutines = 16
+	const iterations = 5
+
+	inputs := concurrencyInputs(goroutines)
+
+	for _, name := range common.Names() {
+		t.Run(name, func(t *testing.T) {
+			compressor, err := common.New(name)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			// 単一スレッドでの期待値
+			expected := make([][]byte, goroutines)
+			for i, input := range inputs {
+				expected[i], err = compressor.Compress(input)
+				if err != nil {
+					t.Fatalf("Compress failed: %v", err)
+				}
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, goroutines)
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for it := 0; it < iterations; it++ {
+						compressed, err := compressor.Compress(inputs[g])
+						if err != nil {
+							errs <- fmt.Errorf("goroutine %d: Compress failed: %v", g, err)
+							return
+						}
+						if !bytes.Equal(compressed, expected[g]) {
+							errs <- fmt.Errorf("goroutine %d: output differs from single-threaded result", g)
+							return
+						}
+						decompressed, err := compressor.Decompress(compressed)
+						if err != nil {
+							errs <- fmt.Errorf("goroutine %d: Decompress failed: %v", g, err)
+							return
+						}
+						if !bytes.Equal(decompressed, inputs[g]) {
+							errs <- fmt.Errorf("goroutine %d: round trip mismatch", g)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRegistry_OverheadIsLowerBound は各アルゴリズムの Overhead が実際の圧縮データのサイズを
+// 超えないことを確認します（CompressOrStore が勝てる候補を省かないための条件）
+func TestRegistry_OverheadIsLowerBound(t *testing.T) {
+	inputs := [][]byte{nil, []byte("a"), []byte("ab"), testcorpus.Random(16, 2), bytes.Repeat([]byte{0}, 64)}
+	for _, sample := range testcorpus.Samples() {
+		inputs = append(inputs, sample.Data)
+	}
+
+	for _, name := range common.Names() {
+		t.Run(name, func(t *testing.T) {
+			c, err := common.New(name)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			for _, input := range inputs {
+				compressed, err := c.Compress(input)
+				if err != nil {
+					t.Fatalf("Compress failed: %v", err)
+				}
+				if overhead := common.Overhead(c, input); overhead > len(compressed) {
+					t.Errorf("%d-byte input: overhead %d exceeds compressed size %d", len(input), overhead, len(compressed))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrRatioExceeded は展開結果が入力に比べて大きすぎる（圧縮爆弾の疑いがある）場合のエラーです
+var ErrRatioExceeded = errors.New("decompression ratio limit exceeded")
+
+// DefaultRatioGrace は SafetyPolicy.RatioGrace が0の場合の、圧縮率を確認し始めるまでの出力のバイト数です
+// 小さなデータは高い圧縮率になりやすいため、最初の1MBまでは確認しません。
+const DefaultRatioGrace = 1 << 20
+
+// SafetyPolicy は信頼できない入力をストリームで展開するときの制限をまとめたものです
+// ゼロ値は何も制限しません。
+type SafetyPolicy struct {
+	// MaxOutputSize は展開結果の最大サイズです（0は無制限）
+	MaxOutputSize int64
+
+	// MaxCompressionRatio は展開結果のサイズ / 読み込んだ入力のサイズの上限です（0は無制限）
+	// 展開結果が RatioGrace を超えてから、書き込むたびに確認します（例: 1000）。
+	MaxCompressionRatio float64
+
+	// RatioGrace は MaxCompressionRatio を確認し始める展開結果のサイズです（0は DefaultRatioGrace）
+	RatioGrace int64
+
+	// Budget は出力と内部構造を合わせたメモリ予算です（nilは無制限）
+	Budget *Budget
+
+	// Deadline を過ぎると展開を止めます（ゼロ値は無制限）
+	// 入力が SetReadDeadline を持つ場合（net.Conn など）は、読み込みの待ちも期限で止まります。
+	Deadline time.Time
+
+	// RateLimit は入力を読み込む速度の上限です（1秒あたりのバイト数、0は無制限）
+	RateLimit int64
+
+	// TolerateSizeMismatch は展開結果のサイズがヘッダーの元のサイズと異なるメンバーを
+	// エラーにせず、展開できた分を出力します（一部が壊れたデータの復旧用）
+	// サイズが異なればCRC32も一致しないため、そのメンバーのチェックサムは確認しません。
+	// 不一致は CompressionStats.SizeMismatches に記録します。
+	TolerateSizeMismatch bool
+}
+
+// DecompressOptions は展開器に渡す出力サイズの上限とメモリ予算を返します
+func (p SafetyPolicy) DecompressOptions() DecompressOptions {
+	return DecompressOptions{MaxOutputSize: p.MaxOutputSize, Budget: p.Budget}
+}
+
+// PartialOutputError は展開の途中で失敗し、出力先に一部のデータを書き込んだ後であることを表すエラーです
+// 出力先の内容は検証が済んでいないため、破棄してください。
+type PartialOutputError struct {
+	Written int64 // 失敗するまでに出力先に書き込んだバイト数
+	Err     error
+}
+
+func (e *PartialOutputError) Error() string {
+	return fmt.Sprintf("%v (%d bytes of unverified partial output already written)", e.Err, e.Written)
+}
+
+func (e *PartialOutputError) Unwrap() error {
+	return e.Err
+}
+
+// SafetyGuard は SafetyPolicy の制限を入力と出力に適用します
+// Reader で読み込んだバイト数と Writer に書き込んだバイト数から、期限、出力サイズ、
+// 圧縮率を確認します。展開器には Reader と Writer を渡します。
+// 同時に複数のゴルーチンから使うことはできません。
+type SafetyGuard struct {
+	policy SafetyPolicy
+	src    io.Reader
+	dst    io.Writer
+	in     int64
+	out    int64
+}
+
+// NewSafetyGuard は src と dst に policy を適用する SafetyGuard を作成します
+// policy.Deadline があり、src が SetReadDeadline を持つ場合は src の期限を設定します。
+func NewSafetyGuard(src io.Reader, dst io.Writer, policy SafetyPolicy) *SafetyGuard {
+	if d, ok := src.(interface{ SetReadDeadline(time.Time) error }); ok && !policy.Deadline.IsZero() {
+		d.SetReadDeadline(policy.Deadline)
+	}
+	g := &SafetyGuard{policy: policy, dst: dst}
+	g.src = NewRateLimitedReader(src, policy.RateLimit)
+	return g
+}
+
+// Reader は期限を確認しながら src から読み込む Reader を返します
+func (g *SafetyGuard) Reader() io.Reader {
+	return guardReader{g}
+}
+
+// Writer は期限、出力サイズ、圧縮率を確認してから dst に書き込む Writer を返します
+// 制限を超える書き込みは1バイトも dst に書き込みません。
+func (g *SafetyGuard) Writer() io.Writer {
+	return guardWriter{g}
+}
+
+// InputBytes は src から読み込んだバイト数を返します
+func (g *SafetyGuard) InputBytes() int64 {
+	return g.in
+}
+
+// OutputBytes は dst に書き込んだバイト数を返します
+func (g *SafetyGuard) OutputBytes() int64 {
+	return g.out
+}
+
+// Err は展開のエラー err を、dst に書き込んだ後なら *PartialOutputError にして返します
+func (g *SafetyGuard) Err(err error) error {
+	if err == nil || g.out == 0 {
+		return err
+	}
+	return &PartialOutputError{Written: g.out, Err: err}
+}
+
+// checkDeadline は期限を過ぎていれば os.ErrDeadlineExceeded を返します
+func (g *SafetyGuard) checkDeadline() error {
+	if !g.policy.Deadline.IsZero() && !time.Now().Before(g.policy.Deadline) {
+		return fmt.Errorf("%w: deadline %s passed", os.ErrDeadlineExceeded, g.policy.Deadline.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// checkOutput は合計 total バイトの出力が出力サイズと圧縮率の上限を超えないかを確認します
+func (g *SafetyGuard) checkOutput(total int64) error {
+	p := g.policy
+	if p.MaxOutputSize > 0 && total > p.MaxOutputSize {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d bytes", ErrOutputTooLarge, total, p.MaxOutputSize)
+	}
+	grace := p.RatioGrace
+	if grace <= 0 {
+		grace = DefaultRatioGrace
+	}
+	if p.MaxCompressionRatio > 0 && total > grace {
+		if ratio := float64(total) / float64(max(g.in, 1)); ratio > p.MaxCompressionRatio {
+			return fmt.Errorf("%w: %d bytes from %d bytes of input (%.0fx, limit %.0fx)",
+				ErrRatioExceeded, total, g.in, ratio, p.MaxCompressionRatio)
+		}
+	}
+	return nil
+}
+
+type guardReader struct{ g *SafetyGuard }
+
+func (r guardReader) Read(p []byte) (int, error) {
+	if err := r.g.checkDeadline(); err != nil {
+		return 0, err
+	}
+	n, err := r.g.src.Read(p)
+	r.g.in += int64(n)
+	return n, err
+}
+
+type guardWriter struct{ g *SafetyGuard }
+
+func (w guardWriter) Write(p []byte) (int, error) {
+	if err := w.g.checkDeadline(); err != nil {
+		return 0, err
+	}
+	if err := w.g.checkOutput(w.g.out + int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := w.g.dst.Write(p)
+	w.g.out += int64(n)
+	return n, err
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafetyGuard_OutputLimit(t *testing.T) {
+	var dst bytes.Buffer
+	g := NewSafetyGuard(strings.NewReader("x"), &dst, SafetyPolicy{MaxOutputSize: 10})
+	w := g.Writer()
+	if _, err := w.Write(make([]byte, 8)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// 上限を超える書き込みは1バイトも書き込まない
+	if _, err := w.Write(make([]byte, 3)); !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	if dst.Len() != 8 || g.OutputBytes() != 8 {
+		t.Errorf("Expected 8 bytes written, got %d (counted %d)", dst.Len(), g.OutputBytes())
+	}
+}
+
+func TestSafetyGuard_Ratio(t *testing.T) {
+	var dst bytes.Buffer
+	g := NewSafetyGuard(strings.NewReader(strings.Repeat("x", 10)), &dst, SafetyPolicy{MaxCompressionRatio: 100, RatioGrace: 1000})
+	if _, err := io.Copy(io.Discard, g.Reader()); err != nil {
+		t.Fatal(err)
+	}
+	w := g.Writer()
+
+	// 猶予の範囲内なら圧縮率が高くても書き込める
+	if _, err := w.Write(make([]byte, 1000)); err != nil {
+		t.Fatalf("Write within grace failed: %v", err)
+	}
+	// 10バイトの入力から 100倍の1000バイトまでは許す
+	if _, err := w.Write(make([]byte, 1)); !errors.Is(err, ErrRatioExceeded) {
+		t.Fatalf("Expected ErrRatioExceeded, got %v", err)
+	}
+	if g.InputBytes() != 10 || g.OutputBytes() != 1000 {
+		t.Errorf("Expected 10 bytes in and 1000 bytes out, got %d and %d", g.InputBytes(), g.OutputBytes())
+	}
+}
+
+func TestSafetyGuard_Deadline(t *testing.T) {
+	g := NewSafetyGuard(strings.NewReader("data"), io.Discard, SafetyPolicy{Deadline: time.Now().Add(-time.Second)})
+	if _, err := g.Reader().Read(make([]byte, 4)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read: expected os.ErrDeadlineExceeded, got %v", err)
+	}
+	if _, err := g.Writer().Write([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write: expected os.ErrDeadlineExceeded, got %v", err)
+	}
+}
+
+// deadlineReader は SetReadDeadline で設定された期限を記録する Reader です
+type deadlineReader struct {
+	io.Reader
+	deadline time.Time
+}
+
+func (r *deadlineReader) SetReadDeadline(t time.Time) error {
+	r.deadline = t
+	return nil
+}
+
+func TestSafetyGuard_SetsReadDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	src := &deadlineReader{Reader: strings.NewReader("")}
+	NewSafetyGuard(src, io.Discard, SafetyPolicy{Deadline: deadline})
+	if !src.deadline.Equal(deadline) {
+		t.Errorf("Expected read deadline %v, got %v", deadline, src.deadline)
+	}
+}
+
+func TestSafetyGuard_Err(t *testing.T) {
+	g := NewSafetyGuard(strings.NewReader(""), io.Discard, SafetyPolicy{})
+	if err := g.Err(ErrOutputTooLarge); err != ErrOutputTooLarge {
+		t.Errorf("Expected the error unchanged before any output, got %v", err)
+	}
+
+	g.Writer().Write([]byte("abc"))
+	err := g.Err(ErrOutputTooLarge)
+	var partial *PartialOutputError
+	if !errors.As(err, &partial) || partial.Written != 3 || !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("Expected PartialOutputError with 3 bytes wrapping ErrOutputTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "3 bytes of unverified partial output") {
+		t.Errorf("Expected the message to mention the partial output, got %q", err)
+	}
+	if g.Err(nil) != nil {
+		t.Error("Expected nil for a nil error")
+	}
+}
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Overheader は圧縮データのうち、内容によらず必要なヘッダーなどのバイト数を返すインターフェースです
+// 戻り値は len(Compress(data)) 以下でなければなりません（Huffman の頻度表や gzip の
+// ヘッダーとフッターなど）。CompressOrStore は小さな入力で、これが見込める節約分以上の
+// アルゴリズムを試さずに省きます。
+type Overheader interface {
+	// Overhead は data を圧縮したときの固定のバイト数です
+	Overhead(data []byte) int
+}
+
+// Overhead は c で data を圧縮したときの固定のバイト数を返します（Overheader を実装していない場合は0）
+func Overhead(c Compressor, data []byte) int {
+	if o, ok := c.(Overheader); ok {
+		return o.Overhead(data)
+	}
+	return 0
+}
+
+// DefaultSmallInputThreshold は CompressOrStore が小さな入力として扱う入力のサイズの既定値です
+const DefaultSmallInputThreshold = 256
+
+// StoreOptions は CompressOrStore の設定です
+type StoreOptions struct {
+	// SmallInputThreshold はこのバイト数未満の入力を小さな入力として扱います
+	// 0は DefaultSmallInputThreshold、負の値は小さな入力の戦略を使いません。
+	SmallInputThreshold int
+}
+
+// フレームの形式
+//
+//	フラグ(1バイト) + 元のサイズ(uvarint) + 本体
+//
+// フラグの下位7ビットは0なら本体が元のデータそのまま（stored）、k (1〜127) なら
+// candidates[k-1] で圧縮したデータです。最上位ビットは将来のために予約しています。
+// フレームのヘッダーは元のサイズが128バイト未満なら2バイト、16KB未満なら3バイトです。
+const (
+	frameStored   = 0
+	frameReserved = 0x80
+
+	// MaxStoreCandidates は CompressOrStore に渡せる候補の最大数です
+	MaxStoreCandidates = 127
+)
+
+// CompressOrStore は candidates のうち最も小さくなった結果を、使った候補の番号と元のサイズを
+// 記録した小さなフレームにして返します
+// どの候補でも元のサイズより小さくならない場合は元のデータをそのまま格納するため、出力は
+// 最大でも元のサイズ + フレームのヘッダー（元のサイズが2MB未満なら4バイト以下）です。
+// 展開には同じ順序の candidates を DecompressStored に渡します。
+//
+// SmallInputThreshold 未満の入力では、キャッシュの値のような小さなデータで固定の
+// オーバーヘッドが節約分を上回る候補を、実際に圧縮する前に省きます。見込める節約分
+// （繰り返しと出現頻度の偏りから見積もる）が候補の Overhead 以下ならその候補は試さず、
+// 試す候補がなければ圧縮せずに格納します。それ以外の入力でも、Overhead がそれまでの
+// 最小のサイズ以上の候補は試しません。
+func CompressOrStore(data []byte, opts StoreOptions, candidates ...Compressor) ([]byte, error) {
+	if len(candidates) > MaxStoreCandidates {
+		return nil, fmt.Errorf("too many candidates: %d (max %d)", len(candidates), MaxStoreCandidates)
+	}
+	threshold := opts.SmallInputThreshold
+	if threshold == 0 {
+		threshold = DefaultSmallInputThreshold
+	}
+
+	best, bestIndex := data, -1
+	if len(data) > 0 {
+		savings := math.MaxInt
+		if len(data) < threshold {
+			savings = estimateSavings(data)
+		}
+		for i, c := range candidates {
+			if Overhead(c, data) >= min(savings, len(best)) {
+				continue
+			}
+			compressed, err := c.Compress(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", c.Name(), err)
+			}
+			if len(compressed) < len(best) {
+				best, bestIndex = compressed, i
+			}
+		}
+	}
+
+	frame := make([]byte, 0, 1+binary.MaxVarintLen64+len(best))
+	frame = append(frame, byte(bestIndex+1))
+	frame = binary.AppendUvarint(frame, uint64(len(data)))
+	return append(frame, best...), nil
+}
+
+// DecompressStored は CompressOrStore のフレームを展開します
+// candidates は圧縮したときと同じ順序で渡します。展開結果がフレームに記録された元のサイズと
+// 一致しない場合は *SizeError を返します。
+func DecompressStored(frame []byte, opts DecompressOptions, candidates ...Compressor) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, NewDecodeError("frame", frame, 0, "フレームが空です")
+	}
+	flags := frame[0]
+	if flags&frameReserved != 0 {
+		return nil, NewDecodeError("frame", frame, 0, "予約されたフラグ 0x%02x が設定されています", flags)
+	}
+	size, n := binary.Uvarint(frame[1:])
+	if n <= 0 {
+		return nil, NewDecodeError("frame", frame, 1, "元のサイズが不正です")
+	}
+	body := frame[1+n:]
+
+	if flags == frameStored {
+		if uint64(len(body)) != size {
+			return nil, &SizeError{Expected: int64(min(size, math.MaxInt64)), Actual: int64(len(body))}
+		}
+		if err := opts.ReserveOutput(int64(size), int64(size)); err != nil {
+			return nil, err
+		}
+		return append([]byte{}, body...), nil
+	}
+
+	index := int(flags) - 1
+	if index >= len(candidates) {
+		return nil, NewDecodeError("frame", frame, 0, "候補 %d がありません（%d 個）", index+1, len(candidates))
+	}
+	if size > math.MaxInt64 {
+		return nil, NewDecodeError("frame", frame, 1, "元のサイズが大きすぎます")
+	}
+	if err := opts.ReserveOutput(0, int64(size)); err != nil {
+		return nil, err
+	}
+	data, err := DecompressWithOptions(candidates[index], body, opts)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != size {
+		return nil, &SizeError{Expected: int64(size), Actual: int64(len(data))}
+	}
+	return data, nil
+}
+
+// estimateMatchCost は estimateSavings が繰り返し1つの参照に見込むバイト数です（楽観的な値）
+const estimateMatchCost = 2
+
+// estimateSavings は小さな data を圧縮して節約できそうなバイト数を大まかに見積もります
+// 以前に出現した3バイト以上の並びの繰り返し（ランも距離1の繰り返しとして数える）から
+// 参照のコストを引いた分と、出現頻度の偏りによるエントロピー符号化の節約分から
+// 出現したバイトの種類数（頻度表などのモデルのコスト）を引いた分の大きい方です。
+func estimateSavings(data []byte) int {
+	matched := 0
+	last := make(map[uint32]int, len(data))
+	for i := 0; i+3 <= len(data); {
+		key := uint32(data[i])<<16 | uint32(data[i+1])<<8 | uint32(data[i+2])
+		j, ok := last[key]
+		last[key] = i
+		if !ok {
+			i++
+			continue
+		}
+		length := 3
+		for i+length < len(data) && data[j+length] == data[i+length] {
+			length++
+		}
+		matched += length - estimateMatchCost
+		i += length
+	}
+
+	var seen [256]bool
+	distinct := 0
+	for _, b := range data {
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+	}
+	entropyBytes := int(math.Ceil(CalculateEntropy(data) * float64(len(data)) / 8))
+	return max(matched, len(data)-entropyBytes-distinct, 0)
+}
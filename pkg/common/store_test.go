@@ -0,0 +1,172 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// allCompressors は登録済みの全アルゴリズムを名前順に返します
+func allCompressors(t testing.TB) []common.Compressor {
+	t.Helper()
+	var cs []common.Compressor
+	for _, name := range common.Names() {
+		c, err := common.New(name)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// smallPayloads はキャッシュの値を想定した、サイズと種類の異なる小さな入力です
+func smallPayloads() map[string][]byte {
+	payloads := make(map[string][]byte)
+	for _, size := range []int{1, 16, 64, 256} {
+		text := bytes.Repeat([]byte(`{"id":42,"name":"tiny"}`), size/23+1)[:size]
+		payloads[fmt.Sprintf("random-%d", size)] = testcorpus.Random(size, int64(size))
+		payloads[fmt.Sprintf("zeros-%d", size)] = make([]byte, size)
+		payloads[fmt.Sprintf("json-%d", size)] = text
+		payloads[fmt.Sprintf("cycle-%d", size)] = testcorpus.Cycle(size)
+	}
+	return payloads
+}
+
+func TestCompressOrStore_SmallPayloads(t *testing.T) {
+	candidates := allCompressors(t)
+	for name, data := range smallPayloads() {
+		for _, threshold := range []int{0, -1} {
+			t.Run(fmt.Sprintf("%s/threshold=%d", name, threshold), func(t *testing.T) {
+				frame, err := common.CompressOrStore(data, common.StoreOptions{SmallInputThreshold: threshold}, candidates...)
+				if err != nil {
+					t.Fatalf("CompressOrStore failed: %v", err)
+				}
+				if len(frame) > len(data)+4 {
+					t.Errorf("Expected at most %d bytes, got %d", len(data)+4, len(frame))
+				}
+				got, err := common.DecompressStored(frame, common.DecompressOptions{}, candidates...)
+				if err != nil {
+					t.Fatalf("DecompressStored failed: %v", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Error("Round trip mismatch")
+				}
+			})
+		}
+	}
+}
+
+func TestCompressOrStore_Choice(t *testing.T) {
+	candidates := allCompressors(t)
+
+	// 1バイトや乱数は圧縮せずに格納する（フラグ0 + 元のサイズ + データ）
+	for _, data := range [][]byte{[]byte("x"), testcorpus.Random(64, 3)} {
+		frame, _ := common.CompressOrStore(data, common.StoreOptions{}, candidates...)
+		if frame[0] != 0 || len(frame) != len(data)+2 || !bytes.Equal(frame[2:], data) {
+			t.Errorf("Expected a stored frame for %d bytes, got % x", len(data), frame)
+		}
+	}
+
+	// 繰り返しの多いデータは圧縮し、格納より小さくなる
+	zeros := make([]byte, 64)
+	frame, _ := common.CompressOrStore(zeros, common.StoreOptions{}, candidates...)
+	if frame[0] == 0 || len(frame) >= len(zeros) {
+		t.Errorf("Expected 64 zero bytes to be compressed, got %d bytes (flags %d)", len(frame), frame[0])
+	}
+
+	// 空のデータは2バイト
+	frame, _ = common.CompressOrStore(nil, common.StoreOptions{}, candidates...)
+	if !bytes.Equal(frame, []byte{0, 0}) {
+		t.Errorf("Expected an empty stored frame, got % x", frame)
+	}
+}
+
+// countingCompressor は Compress が呼ばれた回数を数えます
+type countingCompressor struct {
+	common.Compressor
+	overhead int
+	calls    int
+}
+
+func (c *countingCompressor) Overhead(data []byte) int { return c.overhead }
+
+func (c *countingCompressor) Compress(data []byte) ([]byte, error) {
+	c.calls++
+	return c.Compressor.Compress(data)
+}
+
+// TestCompressOrStore_SkipsOverhead は小さな入力で、固定のオーバーヘッドが見込める節約分以上の
+// 候補を圧縮せずに省くことを確認します
+func TestCompressOrStore_SkipsOverhead(t *testing.T) {
+	rle, _ := common.New("rle")
+	heavy := &countingCompressor{Compressor: rle, overhead: 50}
+	light := &countingCompressor{Compressor: rle, overhead: 0}
+	data := testcorpus.Cycle(64) // a-z の繰り返しで、見込める節約分は50バイト未満
+
+	if _, err := common.CompressOrStore(data, common.StoreOptions{}, heavy, light); err != nil {
+		t.Fatalf("CompressOrStore failed: %v", err)
+	}
+	if heavy.calls != 0 || light.calls != 1 {
+		t.Errorf("Expected only the light candidate to be tried, got heavy=%d light=%d", heavy.calls, light.calls)
+	}
+
+	// 小さな入力の戦略を無効にすると、オーバーヘッドが元のサイズ未満の候補はすべて試す
+	heavy.calls, light.calls = 0, 0
+	common.CompressOrStore(data, common.StoreOptions{SmallInputThreshold: -1}, heavy, light)
+	if heavy.calls != 1 || light.calls != 1 {
+		t.Errorf("Expected both candidates to be tried, got heavy=%d light=%d", heavy.calls, light.calls)
+	}
+}
+
+func TestDecompressStored_Invalid(t *testing.T) {
+	rle, _ := common.New("rle")
+	frame, _ := common.CompressOrStore(make([]byte, 64), common.StoreOptions{}, rle)
+
+	tests := map[string]struct {
+		frame []byte
+		want  error
+	}{
+		"empty":          {[]byte{}, common.ErrInvalidData},
+		"reserved flag":  {[]byte{0x80, 0}, common.ErrInvalidData},
+		"bad size":       {[]byte{0, 0x80}, common.ErrInvalidData},
+		"no candidate":   {[]byte{2, 1, 'x'}, common.ErrInvalidData},
+		"stored short":   {[]byte{0, 3, 'a', 'b'}, common.ErrCorrupted},
+		"stored long":    {[]byte{0, 1, 'a', 'b'}, common.ErrCorrupted},
+		"size mismatch":  {append([]byte{frame[0], 63}, frame[2:]...), common.ErrCorrupted},
+		"bad compressed": {[]byte{1, 2, 'a'}, common.ErrInvalidData},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := common.DecompressStored(tt.frame, common.DecompressOptions{}, rle); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := common.DecompressStored(frame, common.DecompressOptions{MaxOutputSize: 10}, rle); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+func BenchmarkCompressOrStore(b *testing.B) {
+	candidates := allCompressors(b)
+	for _, size := range []int{16, 64, 256} {
+		data := bytes.Repeat([]byte(`{"id":42,"name":"tiny"}`), size/23+1)[:size]
+		for _, threshold := range []int{0, -1} {
+			b.Run(fmt.Sprintf("%d/threshold=%d", size, threshold), func(b *testing.B) {
+				opts := common.StoreOptions{SmallInputThreshold: threshold}
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					if _, err := common.CompressOrStore(data, opts, candidates...); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// StoredAlgorithm は CompressWithTarget が目標を満たせず、元のデータをそのまま返した場合の名前です
+const StoredAlgorithm = "stored"
+
+// CompressWithTarget は candidates を順に試し、圧縮後のサイズが元のサイズの target 倍以下に
+// なった最初の結果と、そのCompressorの名前（Name）を返します
+// 目標を満たす候補がない場合は、元のデータのコピーと StoredAlgorithm を返します。
+// met は返した結果が目標を満たしているかで、元のデータを返した場合も target が1以上なら
+// true になります。空のデータは候補を試さずにそのまま返します（met は true）。
+func CompressWithTarget(data []byte, target float64, candidates ...Compressor) (result []byte, used string, met bool, err error) {
+	return Policy{}.CompressWithTarget(data, target, candidates...)
+}
+
+// CompressWithTarget は CompressWithTarget と同じですが、Strict の場合は候補を1つだけ
+// 受け付け、目標を満たさないときは元のデータを返さずに *StrictError を返します
+func (p Policy) CompressWithTarget(data []byte, target float64, candidates ...Compressor) (result []byte, used string, met bool, err error) {
+	if len(candidates) > 1 {
+		if err := p.Refuse("trying several algorithms in turn", "specify a single algorithm, or omit -strict"); err != nil {
+			return nil, "", false, err
+		}
+	}
+	if !(target > 0) || math.IsInf(target, 1) {
+		return nil, "", false, fmt.Errorf("invalid target ratio: %v", target)
+	}
+
+	limit := target * float64(len(data))
+	if len(data) > 0 {
+		for _, c := range candidates {
+			compressed, err := c.Compress(data)
+			if err != nil {
+				return nil, "", false, fmt.Errorf("%s: %w", c.Name(), err)
+			}
+			if float64(len(compressed)) <= limit {
+				return compressed, c.Name(), true, nil
+			}
+		}
+	}
+	if len(data) > 0 {
+		if err := p.Refuse("output does not meet the target ratio", "stored without -strict"); err != nil {
+			return nil, "", false, err
+		}
+	}
+	return append([]byte{}, data...), StoredAlgorithm, float64(len(data)) <= limit, nil
+}
+
+// RecommendedOrder は data に試すアルゴリズムの登録名を、おすすめの順に返します
+// Recommend のアルゴリズムを先頭に、残りの登録済みアルゴリズムを名前順に続けます。
+// 推奨のフィルタは含みません。
+func RecommendedOrder(data []byte) []string {
+	first := Recommend(DetectDataType(data)).Algorithm
+	names := Names()
+	order := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == first {
+			order = append(order, name)
+		}
+	}
+	for _, name := range names {
+		if name != first {
+			order = append(order, name)
+		}
+	}
+	return order
+}
@@ -0,0 +1,146 @@
+package common_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// fixedCompressor は決まった割合のサイズに圧縮したことにするCompressorで、呼び出しを記録します
+type fixedCompressor struct {
+	name  string
+	ratio float64
+	calls *[]string
+}
+
+func (f fixedCompressor) Name() string { return f.name }
+
+func (f fixedCompressor) Compress(data []byte) ([]byte, error) {
+	*f.calls = append(*f.calls, f.name)
+	return make([]byte, int(float64(len(data))*f.ratio)), nil
+}
+
+func (f fixedCompressor) Decompress(data []byte) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func mustNew(t *testing.T, name string) common.Compressor {
+	t.Helper()
+	c, err := common.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCompressWithTarget_Met(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 50)
+	c := mustNew(t, "lz77")
+
+	result, used, met, err := common.CompressWithTarget(data, 0.7, c)
+	if err != nil {
+		t.Fatalf("CompressWithTarget failed: %v", err)
+	}
+	if !met || used != c.Name() {
+		t.Fatalf("Expected target met with %s, got met=%v used=%q", c.Name(), met, used)
+	}
+	if float64(len(result)) > 0.7*float64(len(data)) {
+		t.Errorf("Expected at most 70%% of %d bytes, got %d", len(data), len(result))
+	}
+	if decompressed, err := c.Decompress(result); err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+}
+
+func TestCompressWithTarget_RandomFallsBackToStored(t *testing.T) {
+	data := testcorpus.Random(4096, 1)
+	var candidates []common.Compressor
+	for _, name := range []string{"lz77", "huffman", "rle"} {
+		candidates = append(candidates, mustNew(t, name))
+	}
+
+	result, used, met, err := common.CompressWithTarget(data, 0.7, candidates...)
+	if err != nil {
+		t.Fatalf("CompressWithTarget failed: %v", err)
+	}
+	if met || used != common.StoredAlgorithm || !bytes.Equal(result, data) {
+		t.Errorf("Expected the original data as %q with target not met, got met=%v used=%q (%d bytes)",
+			common.StoredAlgorithm, met, used, len(result))
+	}
+
+	// 元のデータのサイズでよい目標なら、元のデータでも目標を満たす
+	if _, used, met, _ := common.CompressWithTarget(data, 1, candidates...); !met || used != common.StoredAlgorithm {
+		t.Errorf("Expected stored data to meet target 1.0, got met=%v used=%q", met, used)
+	}
+}
+
+func TestCompressWithTarget_CandidateOrder(t *testing.T) {
+	data := make([]byte, 1000)
+
+	tests := map[string]struct {
+		ratios []float64
+		used   string
+		calls  []string
+	}{
+		// 目標を満たした候補で止め、後の候補は試さない
+		"first meets":  {[]float64{0.5, 0.1, 0.1}, "a", []string{"a"}},
+		"second meets": {[]float64{0.9, 0.6, 0.1}, "b", []string{"a", "b"}},
+		// 最も小さい候補ではなく、目標を満たす最初の候補を選ぶ
+		"boundary": {[]float64{0.8, 0.7, 0.1}, "b", []string{"a", "b"}},
+		"none":     {[]float64{0.9, 0.8, 0.75}, common.StoredAlgorithm, []string{"a", "b", "c"}},
+	}
+	for name, tt := range tests {
+		var calls []string
+		var candidates []common.Compressor
+		for i, ratio := range tt.ratios {
+			candidates = append(candidates, fixedCompressor{name: string(rune('a' + i)), ratio: ratio, calls: &calls})
+		}
+
+		_, used, _, err := common.CompressWithTarget(data, 0.7, candidates...)
+		if err != nil {
+			t.Fatalf("%s: CompressWithTarget failed: %v", name, err)
+		}
+		if used != tt.used || !slices.Equal(calls, tt.calls) {
+			t.Errorf("%s: expected %q after %v, got %q after %v", name, tt.used, tt.calls, used, calls)
+		}
+	}
+}
+
+func TestCompressWithTarget_EmptyAndInvalid(t *testing.T) {
+	var calls []string
+	c := fixedCompressor{name: "a", ratio: 0.5, calls: &calls}
+
+	result, used, met, err := common.CompressWithTarget(nil, 0.7, c)
+	if err != nil || len(result) != 0 || used != common.StoredAlgorithm || !met || len(calls) != 0 {
+		t.Errorf("Expected empty input to be returned as stored without trying candidates, got %v %q %v %v %v",
+			result, used, met, err, calls)
+	}
+
+	for _, target := range []float64{0, -1} {
+		if _, _, _, err := common.CompressWithTarget([]byte("abc"), target, c); err == nil {
+			t.Errorf("Expected error for target %v", target)
+		}
+	}
+}
+
+func TestRecommendedOrder(t *testing.T) {
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20)
+	order := common.RecommendedOrder(text)
+
+	if len(order) != len(common.Names()) || order[0] != common.Recommend(common.DetectDataType(text)).Algorithm {
+		t.Fatalf("Expected the recommended algorithm first and every algorithm once, got %v", order)
+	}
+	rest := slices.Clone(order[1:])
+	if !slices.IsSorted(rest) || slices.Contains(rest, order[0]) {
+		t.Errorf("Expected the remaining algorithms in name order, got %v", rest)
+	}
+
+	// 圧縮しないことが推奨される場合は名前順
+	if order := common.RecommendedOrder(testcorpus.Random(4096, 1)); !slices.Equal(order, common.Names()) {
+		t.Errorf("Expected name order for incompressible data, got %v", order)
+	}
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 圧縮全体を分けるフェーズの名前です（container.CompressFile や CLI が記録します）
+// アルゴリズムが記録するフェーズ（huffman.PhaseCount など）は PhaseCompress の内訳です。
+const (
+	PhaseRead     = "read"     // 入力の読み込み（速度の制限で待った時間を含む）
+	PhaseCompress = "compress" // 圧縮（読み込みと書き込み以外のすべて）
+	PhaseWrite    = "write"    // 出力の書き込み（一時ファイルの置き換えを含む）
+)
+
+// Timings はフェーズの名前ごとの処理時間です
+// アルゴリズムはフェーズの境目で Since を呼ぶだけなので、計測のコストは境目ごとに
+// time.Now 1回です。nil の Timings は何も記録せず、Start も時刻を取得しません。
+// 複数のゴルーチンから同時に使用でき、同じフェーズの時間は合計します。
+type Timings struct {
+	mu     sync.Mutex
+	phases map[string]time.Duration
+	order  []string // 最初に記録した順のフェーズの名前
+
+	now func() time.Time
+}
+
+// NewTimings は空の Timings を作成します
+func NewTimings() *Timings {
+	return newTimings(time.Now)
+}
+
+func newTimings(now func() time.Time) *Timings {
+	return &Timings{phases: make(map[string]time.Duration), now: now}
+}
+
+// Start は最初のフェーズの開始時刻を返します（t が nil の場合はゼロ値）
+func (t *Timings) Start() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.now()
+}
+
+// Since は start から現在までの時間を phase に加え、現在の時刻（次のフェーズの開始時刻）を返します
+// t が nil の場合は何もせずにゼロ値を返します。
+func (t *Timings) Since(phase string, start time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	now := t.now()
+	t.Add(phase, now.Sub(start))
+	return now
+}
+
+// Add は phase に d を加えます
+func (t *Timings) Add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.phases[phase]; !ok {
+		t.order = append(t.order, phase)
+	}
+	t.phases[phase] += d
+}
+
+// Get は phase の時間を返します（記録していない場合は0）
+func (t *Timings) Get(phase string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phases[phase]
+}
+
+// Phases は記録したフェーズの名前を最初に記録した順に返します
+func (t *Timings) Phases() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.order...)
+}
+
+// MarshalJSON はフェーズの名前からナノ秒へのオブジェクトとして出力します
+func (t *Timings) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(t.phases)
+}
+
+// UnmarshalJSON は MarshalJSON の出力を読み込みます（フェーズの順序は名前順になります）
+func (t *Timings) UnmarshalJSON(data []byte) error {
+	var phases map[string]time.Duration
+	if err := json.Unmarshal(data, &phases); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = make(map[string]time.Duration, len(phases))
+	t.order = slices.Sorted(maps.Keys(phases))
+	maps.Copy(t.phases, phases)
+	if t.now == nil {
+		t.now = time.Now
+	}
+	return nil
+}
+
+// Timed はフェーズごとの処理時間を記録しながら圧縮する Compressor を作れるインターフェースです
+// Timings を設定していない Compressor の圧縮速度には影響しません。
+type Timed interface {
+	// WithTimings は t に処理時間を記録する Compressor を返します（元の Compressor は変更しません）
+	WithTimings(t *Timings) Compressor
+}
+
+// WithTimings は c が Timed を実装していれば t に処理時間を記録する Compressor を返します
+// 実装していない場合は c と false を返します。
+func WithTimings(c Compressor, t *Timings) (Compressor, bool) {
+	if timed, ok := c.(Timed); ok {
+		return timed.WithTimings(t), true
+	}
+	return c, false
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings_Since(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	timings := newTimings(clock.Now)
+
+	// フェーズの境目ごとに時計を進める
+	start := timings.Start()
+	clock.now = clock.now.Add(3 * time.Millisecond)
+	start = timings.Since("count", start)
+	clock.now = clock.now.Add(5 * time.Millisecond)
+	start = timings.Since("encode", start)
+	clock.now = clock.now.Add(2 * time.Millisecond)
+	timings.Since("count", start)
+
+	if got := timings.Get("count"); got != 5*time.Millisecond {
+		t.Errorf("Expected count to accumulate 5ms, got %v", got)
+	}
+	if got := timings.Get("encode"); got != 5*time.Millisecond {
+		t.Errorf("Expected encode to be 5ms, got %v", got)
+	}
+	if got := timings.Phases(); !slices.Equal(got, []string{"count", "encode"}) {
+		t.Errorf("Expected phases in first-recorded order, got %v", got)
+	}
+
+	data, err := json.Marshal(timings)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"count":5000000,"encode":5000000}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestTimings_Nil(t *testing.T) {
+	var timings *Timings
+	if start := timings.Start(); !start.IsZero() {
+		t.Errorf("Expected a zero start time, got %v", start)
+	}
+	timings.Since("count", time.Now())
+	timings.Add("count", time.Second)
+	if timings.Get("count") != 0 || timings.Phases() != nil {
+		t.Error("Expected a nil Timings to record nothing")
+	}
+
+	// 計測していない統計のJSONには含めない
+	data, _ := json.Marshal(CompressionStats{})
+	if strings.Contains(string(data), "timings") {
+		t.Errorf("Expected no timings in %s", data)
+	}
+}
+
+func TestFprintCompressionStats_Timings(t *testing.T) {
+	timings := NewTimings()
+	timings.Add(PhaseRead, 10*time.Millisecond)
+	timings.Add("match", 60*time.Millisecond)
+	timings.Add(PhaseWrite, 10*time.Millisecond)
+	timings.Add(PhaseCompress, 80*time.Millisecond)
+
+	var buf bytes.Buffer
+	FprintCompressionStats(&buf, CompressionStats{Duration: 100 * time.Millisecond, Timings: timings})
+	out := buf.String()
+
+	// 読み込み・圧縮・書き込みの後に、アルゴリズムのフェーズを字下げして表示する
+	read, compress, write, match := strings.Index(out, "read:"), strings.Index(out, "compress:"), strings.Index(out, "write:"), strings.Index(out, "match:")
+	if read < 0 || !(read < compress && compress < write && write < match) {
+		t.Errorf("Unexpected order of phases:\n%s", out)
+	}
+	if !strings.Contains(out, "(80.0%)") || !strings.Contains(out, "    match:") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
+
+func TestWithTimings_NotTimed(t *testing.T) {
+	c := NewBestOf()
+	if got, ok := WithTimings(c, NewTimings()); ok || got != c {
+		t.Error("Expected a compressor without phases to be returned unchanged")
+	}
+}
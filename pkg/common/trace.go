@@ -0,0 +1,87 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Tracer は符号化の各ステップのイベントを受け取るインターフェースです
+// 授業などでエンコーダーが何をしたかを確認するためのもので、イベントの型はアルゴリズムごとに
+// 異なります（lz77.StepEvent、huffman.MergeEvent、rle.RunEvent など）。
+type Tracer interface {
+	OnStep(event any)
+}
+
+// TracerFunc は関数を Tracer として使うためのアダプターです
+type TracerFunc func(event any)
+
+// OnStep は f(event) を呼び出します
+func (f TracerFunc) OnStep(event any) {
+	f(event)
+}
+
+// Traced は Tracer にステップを通知しながら圧縮する Compressor を作れるインターフェースです
+// Tracer を設定していない Compressor の圧縮速度には影響しません。
+type Traced interface {
+	// WithTracer は t にステップを通知する Compressor を返します（元の Compressor は変更しません）
+	WithTracer(t Tracer) Compressor
+}
+
+// WithTracer は c が Traced を実装していれば t にステップを通知する Compressor を返します
+// 実装していない場合は c と false を返します。
+func WithTracer(c Compressor, t Tracer) (Compressor, bool) {
+	if traced, ok := c.(Traced); ok {
+		return traced.WithTracer(t), true
+	}
+	return c, false
+}
+
+// JSONLTracer はイベントを1行1つのJSON（JSON Lines）として書き込む Tracer です
+// 各行は {"seq": 0, "type": "lz77.StepEvent", "event": {...}} の形式です。
+// OnStep はエラーを返せないため、最初の書き込みエラーを Err で確認します。
+type JSONLTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	seq int
+	err error
+}
+
+// NewJSONLTracer は w に書き込む JSONLTracer を作成します
+func NewJSONLTracer(w io.Writer) *JSONLTracer {
+	return &JSONLTracer{enc: json.NewEncoder(w)}
+}
+
+// traceLine は JSONLTracer が書き込む1行です
+type traceLine struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event any    `json:"event"`
+}
+
+// OnStep はイベントを1行書き込みます（エラーの後は何もしません）
+func (t *JSONLTracer) OnStep(event any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	if t.err = t.enc.Encode(traceLine{Seq: t.seq, Type: fmt.Sprintf("%T", event), Event: event}); t.err == nil {
+		t.seq++
+	}
+}
+
+// Count は書き込んだイベントの数を返します
+func (t *JSONLTracer) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seq
+}
+
+// Err は最初の書き込みエラーを返します
+func (t *JSONLTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
@@ -0,0 +1,66 @@
+package common_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+func TestJSONLTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := common.NewJSONLTracer(&buf)
+	c, ok := common.WithTracer(rle.NewCompressor(), tracer)
+	if !ok {
+		t.Fatal("Expected rle to support tracing")
+	}
+	if _, err := c.Compress([]byte("aab")); err != nil {
+		t.Fatal(err)
+	}
+	if tracer.Err() != nil || tracer.Count() != 2 {
+		t.Fatalf("Expected 2 events, got %d (err %v)", tracer.Count(), tracer.Err())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []string{
+		`{"seq":0,"type":"rle.RunEvent","event":{"position":0,"byte":97,"length":2}}`,
+		`{"seq":1,"type":"rle.RunEvent","event":{"position":2,"byte":98,"length":1}}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), buf.String())
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("Invalid JSON line: %s", line)
+		}
+	}
+}
+
+var errWrite = errors.New("disk full")
+
+// failingWriter は常に errWrite を返す io.Writer です
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errWrite }
+
+func TestJSONLTracer_WriteError(t *testing.T) {
+	tracer := common.NewJSONLTracer(failingWriter{})
+	tracer.OnStep(1)
+	tracer.OnStep(2)
+	if !errors.Is(tracer.Err(), errWrite) || tracer.Count() != 0 {
+		t.Errorf("Expected the first write error, got %v (count %d)", tracer.Err(), tracer.Count())
+	}
+}
+
+func TestWithTracer_Unsupported(t *testing.T) {
+	c := lzw.NewCompressor()
+	got, ok := common.WithTracer(c, common.TracerFunc(func(any) {}))
+	if ok || got != common.Compressor(c) {
+		t.Errorf("Expected lzw to be returned unchanged, got %v, %v", got, ok)
+	}
+}
@@ -1,15 +1,23 @@
 package common
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 // Compressor は圧縮アルゴリズムの共通インターフェース
+//
+// 並行性の約束: 実装は1つのインスタンスを複数のゴルーチンから同時に
+// 使用しても安全でなければなりません。マッチング用のハッシュテーブルや
+// 適応モデルなどの作業用の状態は呼び出しごとに確保し、インスタンスには
+// 構築後に変更されない設定だけを保持してください。
 type Compressor interface {
 	// Compress はデータを圧縮します
 	Compress(data []byte) ([]byte, error)
-	
+
 	// Decompress は圧縮されたデータを展開します
 	Decompress(data []byte) ([]byte, error)
-	
+
 	// Name はアルゴリズム名を返します
 	Name() string
 }
@@ -18,17 +26,55 @@ type Compressor interface {
 type StreamCompressor interface {
 	// CompressStream はストリームを圧縮します
 	CompressStream(src io.Reader, dst io.Writer) error
-	
+
 	// DecompressStream は圧縮ストリームを展開します
 	DecompressStream(src io.Reader, dst io.Writer) error
 }
 
 // CompressionStats は圧縮統計情報
 type CompressionStats struct {
-	OriginalSize   int64   // 元のサイズ
-	CompressedSize int64   // 圧縮後のサイズ
-	Ratio          float64 // 圧縮率
-	Algorithm      string  // 使用アルゴリズム
+	OriginalSize   int64         `json:"original_size"`   // 元のサイズ
+	CompressedSize int64         `json:"compressed_size"` // 圧縮後のサイズ
+	Ratio          float64       `json:"ratio"`           // 圧縮率
+	Algorithm      string        `json:"algorithm"`       // 使用アルゴリズム
+	Duration       time.Duration `json:"duration_ns"`     // 処理時間（計測していない場合は0）
+	Source         string        `json:"source"`          // 入力の名前（ファイル名など、空でもよい）
+
+	// TargetRatio は目標の圧縮率です（CompressWithTarget を使った場合のみ、それ以外は0）
+	TargetRatio float64 `json:"target_ratio,omitempty"`
+	// TargetNotMet は目標を満たせず、元のデータをそのまま出力したことを表します
+	TargetNotMet bool `json:"target_not_met,omitempty"`
+
+	// Timings はフェーズごとの処理時間です（計測していない場合は nil）
+	Timings *Timings `json:"timings_ns,omitempty"`
+
+	// SizeMismatches はサイズの不一致を許容して展開したメンバーです（展開のみ、なければ nil）
+	SizeMismatches []SizeMismatch `json:"size_mismatches,omitempty"`
+
+	// Damaged は展開できずに埋めたブロックです（展開のみ、なければ nil）
+	Damaged []DamagedBlock `json:"damaged,omitempty"`
+
+	// Nested は入れ子の .tzz コンテナを表します。圧縮では入力が既にコンテナだったため
+	// 圧縮せずに格納したこと、展開では展開結果がまだコンテナであることです。
+	Nested bool `json:"nested,omitempty"`
+	// Layers は展開したコンテナの層の数です（展開のみ、入れ子を続けて展開した場合は2以上）
+	Layers int `json:"layers,omitempty"`
+
+	// CompressedFraction は CompressDeadline で期限までに実際に圧縮した入力の割合です（0〜1、CompressDeadline 以外は0）
+	CompressedFraction float64 `json:"compressed_fraction,omitempty"`
+	// DeadlineExceeded は CompressDeadline の期限までに入力全体を圧縮できず、残りを圧縮せずに格納したことを表します
+	DeadlineExceeded bool `json:"deadline_exceeded,omitempty"`
+}
+
+// Recovered はサイズの不一致を許容したか、壊れたブロックを埋めて、元のデータと異なる展開結果を出力したかを返します
+func (s CompressionStats) Recovered() bool {
+	return len(s.SizeMismatches) > 0 || len(s.Damaged) > 0
+}
+
+// Expanded は圧縮後のサイズが元のサイズより大きくなったかを返します
+// 同じサイズの場合は false です。
+func (s CompressionStats) Expanded() bool {
+	return s.CompressedSize > s.OriginalSize
 }
 
 // CalculateRatio は圧縮率を計算します
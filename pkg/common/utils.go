@@ -2,7 +2,12 @@ package common
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // CountBytes はバイト配列内の各バイトの出現回数をカウントします
@@ -19,18 +24,18 @@ func CalculateEntropy(data []byte) float64 {
 	if len(data) == 0 {
 		return 0
 	}
-	
+
 	counts := CountBytes(data)
 	total := float64(len(data))
 	entropy := 0.0
-	
+
 	for _, count := range counts {
 		if count > 0 {
 			p := float64(count) / total
 			entropy -= p * math.Log2(p)
 		}
 	}
-	
+
 	return entropy
 }
 
@@ -40,30 +45,135 @@ func FormatBytes(bytes int64) string {
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
 	}
-	
+
 	div, exp := int64(unit), 0
 	for n := bytes / unit; n >= unit; n /= unit {
 		div *= unit
 		exp++
 	}
-	
+
 	units := []string{"KB", "MB", "GB", "TB"}
 	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
 }
 
-// PrintCompressionStats は圧縮統計を見やすく表示します
-func PrintCompressionStats(stats CompressionStats) {
-	fmt.Printf("=== 圧縮統計 ===\n")
-	fmt.Printf("アルゴリズム: %s\n", stats.Algorithm)
-	fmt.Printf("元のサイズ:   %s (%d bytes)\n", FormatBytes(stats.OriginalSize), stats.OriginalSize)
-	fmt.Printf("圧縮後サイズ: %s (%d bytes)\n", FormatBytes(stats.CompressedSize), stats.CompressedSize)
-	fmt.Printf("圧縮率:       %.2f%% (%.3f)\n", stats.Ratio*100, stats.Ratio)
-	
-	if stats.Ratio < 1.0 {
-		reduction := (1.0 - stats.Ratio) * 100
-		fmt.Printf("削減率:       %.2f%%\n", reduction)
-	} else {
+// FprintCompressionStats は PrintCompressionStats と同じ内容を w に書き込みます
+func FprintCompressionStats(w io.Writer, stats CompressionStats) {
+	fmt.Fprintf(w, "=== 圧縮統計 ===\n")
+	fmt.Fprintf(w, "アルゴリズム: %s\n", stats.Algorithm)
+	fmt.Fprintf(w, "元のサイズ:   %s (%d bytes)\n", FormatBytes(stats.OriginalSize), stats.OriginalSize)
+	fmt.Fprintf(w, "圧縮後サイズ: %s (%d bytes)\n", FormatBytes(stats.CompressedSize), stats.CompressedSize)
+	fmt.Fprintf(w, "圧縮率:       %.2f%% (%.3f)\n", stats.Ratio*100, stats.Ratio)
+
+	// 空の入力は圧縮率を計算しないため、削減率（100%）として表示する
+	if stats.Expanded() && stats.OriginalSize > 0 {
 		increase := (stats.Ratio - 1.0) * 100
-		fmt.Printf("サイズ増加:   %.2f%%\n", increase)
+		fmt.Fprintf(w, "サイズ増加:   %.2f%%\n", increase)
+	} else {
+		reduction := (1.0 - stats.Ratio) * 100
+		fmt.Fprintf(w, "削減率:       %.2f%%\n", reduction)
+	}
+	if stats.TargetRatio > 0 {
+		result := "達成"
+		if stats.TargetNotMet {
+			result = "未達（元のデータをそのまま出力）"
+		}
+		fmt.Fprintf(w, "目標圧縮率:   %.2f%% (%s)\n", stats.TargetRatio*100, result)
+	}
+	if stats.Duration > 0 {
+		fmt.Fprintf(w, "処理時間:     %v\n", stats.Duration.Round(time.Microsecond))
+	}
+	fprintTimings(w, stats.Timings, stats.Duration)
+}
+
+// fprintTimings はフェーズごとの処理時間を、読み込み・圧縮・書き込み、アルゴリズムの
+// フェーズ（圧縮の内訳）の順に表示します
+// 割合は total に対する値です（total が0の場合は表示しません）。
+func fprintTimings(w io.Writer, t *Timings, total time.Duration) {
+	phases := t.Phases()
+	if len(phases) == 0 {
+		return
+	}
+	line := func(indent, phase string) {
+		d := t.Get(phase)
+		fmt.Fprintf(w, "  %s%-*s %v", indent, 10-len(indent), phase+":", d.Round(time.Microsecond))
+		if total > 0 {
+			fmt.Fprintf(w, " (%.1f%%)", float64(d)/float64(total)*100)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "処理時間の内訳:\n")
+	top := []string{PhaseRead, PhaseCompress, PhaseWrite}
+	for _, phase := range top {
+		if slices.Contains(phases, phase) {
+			line("", phase)
+		}
+	}
+	for _, phase := range phases {
+		if !slices.Contains(top, phase) {
+			line("  ", phase)
+		}
+	}
+}
+
+// FprintAggregate は PrintAggregate と同じ内容を w に書き込みます
+func FprintAggregate(w io.Writer, a StatsAggregate) {
+	fmt.Fprintf(w, "=== 集計 ===\n")
+	fmt.Fprintf(w, "件数:         %d\n", a.Count)
+	fmt.Fprintf(w, "元のサイズ:   %s (%d bytes)\n", FormatBytes(a.TotalOriginal), a.TotalOriginal)
+	fmt.Fprintf(w, "圧縮後サイズ: %s (%d bytes)\n", FormatBytes(a.TotalCompressed), a.TotalCompressed)
+	fmt.Fprintf(w, "圧縮率:       %.2f%% (%.3f)\n", a.Ratio()*100, a.Ratio())
+	if a.TotalDuration > 0 {
+		fmt.Fprintf(w, "処理時間:     %v\n", a.TotalDuration.Round(time.Microsecond))
+	}
+	if a.Best != nil {
+		fmt.Fprintf(w, "最良:         %s (%.2f%%)\n", sourceName(*a.Best), ratioOf(*a.Best)*100)
+		fmt.Fprintf(w, "最悪:         %s (%.2f%%)\n", sourceName(*a.Worst), ratioOf(*a.Worst)*100)
+	}
+}
+
+// sourceName は集計の表示に使う入力の名前を返します
+func sourceName(s CompressionStats) string {
+	if s.Source != "" {
+		return s.Source
+	}
+	return "(名前なし)"
+}
+
+// ParseBytes は "256M" や "64KB"、"1.5GiB" のようなサイズ表記をバイト数に変換します
+// 単位は1024倍で解釈します（K/KB/KiB, M/MB/MiB, G/GB/GiB, T/TB/TiB）
+func ParseBytes(s string) (int64, error) {
+	str := strings.TrimSpace(strings.ToUpper(s))
+	if str == "" {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	bytes := value * float64(multiplier)
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("size too large: %q", s)
 	}
+	return int64(bytes), nil
 }
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/golden"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"100B", 100},
+		{"64K", 64 << 10},
+		{"64KB", 64 << 10},
+		{"256M", 256 << 20},
+		{"256m", 256 << 20},
+		{"1.5G", 3 << 29},
+		{"2GiB", 2 << 30},
+		{" 1T ", 1 << 40},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.input)
+		if err != nil {
+			t.Errorf("ParseBytes(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseBytes(%q) = %d, expected %d", tt.input, got, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"", "abc", "-5M", "M", "1.2.3K"} {
+		if _, err := ParseBytes(invalid); err == nil {
+			t.Errorf("ParseBytes(%q): expected error", invalid)
+		}
+	}
+}
+
+func TestFprint_Golden(t *testing.T) {
+	var stats bytes.Buffer
+	for _, s := range []CompressionStats{
+		{Algorithm: "lz77", OriginalSize: 10 << 10, CompressedSize: 3 << 10, Duration: 1500 * time.Microsecond},
+		{Algorithm: "huffman", OriginalSize: 100, CompressedSize: 140, TargetRatio: 0.5, TargetNotMet: true},
+		{Algorithm: "rle"},
+	} {
+		s.CalculateRatio()
+		FprintCompressionStats(&stats, s)
+	}
+	golden.Check(t, "compression_stats", stats.Bytes())
+
+	var a StatsAggregate
+	a.Add(CompressionStats{Source: "a.txt", OriginalSize: 1000, CompressedSize: 400, Ratio: 0.4, Duration: time.Millisecond})
+	a.Add(CompressionStats{OriginalSize: 1 << 20, CompressedSize: 1 << 19, Ratio: 0.5})
+	var aggregate bytes.Buffer
+	FprintAggregate(&aggregate, a)
+	golden.Check(t, "aggregate", aggregate.Bytes())
+
+	var dataType bytes.Buffer
+	for _, dt := range []DataType{
+		{Kind: KindText, Confidence: 0.98},
+		{Kind: KindCompressed, Confidence: 0.99, Format: "png"},
+		{Kind: KindPeriodic, Confidence: 0.6, Period: 4},
+	} {
+		FprintDataType(&dataType, dt)
+	}
+	golden.Check(t, "data_type", dataType.Bytes())
+}
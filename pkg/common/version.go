@@ -0,0 +1,42 @@
+package common
+
+import "fmt"
+
+// ErrUnsupportedVersion は圧縮データの形式バージョンが、このプログラムが対応している
+// バージョンより新しい場合のエラーです。データの破損（ErrInvalidData）とは区別され、
+// より新しい tinyzipzap で作成されたデータであることを表します。
+type ErrUnsupportedVersion struct {
+	Format string // 形式の名前（アルゴリズムの登録名、"container" など）
+	Have   byte   // データの形式バージョン
+	Max    byte   // 対応している最大のバージョン
+}
+
+// Error はエラーメッセージを返します
+func (e *ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("%s: unsupported format version %d (supported up to %d)", e.Format, e.Have, e.Max)
+}
+
+// Versioned は圧縮形式のバージョンを持つCompressorのインターフェースです
+// 形式を変更するときはバージョンを上げ、以前のバージョンのデータも展開できるようにします。
+// .tzz コンテナは各メンバーのペイロードの先頭にこのバージョンを記録します。
+type Versioned interface {
+	// FormatVersion は Compress が出力する形式のバージョンです（展開できる最大のバージョン）
+	FormatVersion() byte
+}
+
+// FormatVersion は c の形式のバージョンを返します（Versioned を実装していない場合は0）
+func FormatVersion(c Compressor) byte {
+	if v, ok := c.(Versioned); ok {
+		return v.FormatVersion()
+	}
+	return 0
+}
+
+// CheckFormatVersion は形式バージョン have のデータを c で展開できるかを確認します
+// have が c の対応するバージョンより新しい場合は *ErrUnsupportedVersion を返します
+func CheckFormatVersion(format string, c Compressor, have byte) error {
+	if max := FormatVersion(c); have > max {
+		return &ErrUnsupportedVersion{Format: format, Have: have, Max: max}
+	}
+	return nil
+}
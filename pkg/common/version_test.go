@@ -0,0 +1,41 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+// versionedCompressor は形式バージョン2の、何もしないCompressorです
+type versionedCompressor struct{ plainCompressor }
+
+func (versionedCompressor) FormatVersion() byte { return 2 }
+
+func TestFormatVersion(t *testing.T) {
+	if v := FormatVersion(plainCompressor{}); v != 0 {
+		t.Errorf("Expected version 0 without Versioned, got %d", v)
+	}
+	if v := FormatVersion(versionedCompressor{}); v != 2 {
+		t.Errorf("Expected version 2, got %d", v)
+	}
+}
+
+func TestCheckFormatVersion(t *testing.T) {
+	c := versionedCompressor{}
+	for have := byte(0); have <= 2; have++ {
+		if err := CheckFormatVersion("nop", c, have); err != nil {
+			t.Errorf("version %d: unexpected error %v", have, err)
+		}
+	}
+
+	err := CheckFormatVersion("nop", c, 3)
+	var unsupported *ErrUnsupportedVersion
+	if !errors.As(err, &unsupported) || unsupported.Have != 3 || unsupported.Max != 2 || unsupported.Format != "nop" {
+		t.Fatalf("Expected ErrUnsupportedVersion{3, 2}, got %v", err)
+	}
+	if errors.Is(err, ErrInvalidData) {
+		t.Error("Unsupported version must not be reported as invalid data")
+	}
+	if expected := "nop: unsupported format version 3 (supported up to 2)"; err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
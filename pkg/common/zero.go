@@ -0,0 +1,41 @@
+package common
+
+import "encoding/binary"
+
+// ZeroPrefixLen は data の先頭から続く0のバイト数を返します
+// 8バイトずつ比較するため、ディスクイメージなどの大きな0の領域を1バイトずつ走査するより高速です。
+func ZeroPrefixLen(data []byte) int {
+	n := 0
+	for ; n+8 <= len(data); n += 8 {
+		if binary.LittleEndian.Uint64(data[n:]) != 0 {
+			break
+		}
+	}
+	for n < len(data) && data[n] == 0 {
+		n++
+	}
+	return n
+}
+
+// FindZeroRun は data の中で minRun バイト以上続く最初の0の領域を探し、開始位置と長さを返します
+// 見つからない場合は (len(data), 0) を返します。minRun が16未満の場合は16として扱います。
+// minRun 以上の0の領域は必ず8バイト境界の0の語を含むため、8バイトごとの語だけを調べます。
+func FindZeroRun(data []byte, minRun int) (start, length int) {
+	minRun = max(minRun, 16)
+	for i := 0; i+8 <= len(data); i += 8 {
+		if binary.LittleEndian.Uint64(data[i:]) != 0 {
+			continue
+		}
+		start = i
+		for start > 0 && data[start-1] == 0 {
+			start--
+		}
+		length = i - start + ZeroPrefixLen(data[i:])
+		if length >= minRun {
+			return start, length
+		}
+		// 短い0の領域の後ろから探し直す（語の境界は揃えたままにする）
+		i += (length - (i - start)) &^ 7
+	}
+	return len(data), 0
+}
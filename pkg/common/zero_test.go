@@ -0,0 +1,79 @@
+package common
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestZeroPrefixLen(t *testing.T) {
+	tests := map[string]struct {
+		data     []byte
+		expected int
+	}{
+		"empty":       {nil, 0},
+		"non-zero":    {[]byte{1, 0, 0}, 0},
+		"short":       {[]byte{0, 0, 0, 7}, 3},
+		"all zero":    {make([]byte, 100), 100},
+		"word + tail": {append(make([]byte, 19), 5), 19},
+		"exact words": {append(make([]byte, 16), 5, 0), 16},
+	}
+	for name, tt := range tests {
+		if got := ZeroPrefixLen(tt.data); got != tt.expected {
+			t.Errorf("%s: expected %d, got %d", name, tt.expected, got)
+		}
+	}
+}
+
+// findZeroRunSlow は FindZeroRun を1バイトずつ確認する実装です
+func findZeroRunSlow(data []byte, minRun int) (int, int) {
+	minRun = max(minRun, 16)
+	for i := 0; i < len(data); {
+		n := 0
+		for i+n < len(data) && data[i+n] == 0 {
+			n++
+		}
+		if n >= minRun {
+			return i, n
+		}
+		i += n + 1
+	}
+	return len(data), 0
+}
+
+func TestFindZeroRun_MatchesSlow(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		// 長さの異なる0の領域と0でないバイトを並べる
+		var data []byte
+		for len(data) < 2000 {
+			if r.Intn(2) == 0 {
+				data = append(data, make([]byte, r.Intn(80))...)
+			} else {
+				data = append(data, bytes.Repeat([]byte{byte(1 + r.Intn(255))}, 1+r.Intn(20))...)
+			}
+		}
+		for _, minRun := range []int{0, 16, 17, 40, 64} {
+			start, length := FindZeroRun(data, minRun)
+			wantStart, wantLength := findZeroRunSlow(data, minRun)
+			if start != wantStart || length != wantLength {
+				t.Fatalf("minRun %d: expected (%d, %d), got (%d, %d)", minRun, wantStart, wantLength, start, length)
+			}
+		}
+	}
+}
+
+func TestFindZeroRun_NotFound(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 10)
+	if start, length := FindZeroRun(data, 16); start != len(data) || length != 0 {
+		t.Errorf("Expected (%d, 0), got (%d, %d)", len(data), start, length)
+	}
+}
+
+func BenchmarkZeroPrefixLen(b *testing.B) {
+	data := make([]byte, 1<<20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		ZeroPrefixLen(data)
+	}
+}
@@ -0,0 +1,285 @@
+// Package compare implements the shared engine for comparing algorithms.
+// 複数のアルゴリズムで同じデータを圧縮し、サイズ・時間を測定します。
+// 圧縮率だけでなく、展開結果が元のデータと一致することも既定で検証するため、
+// 展開できない出力を返すアルゴリズムが良い圧縮率を報告することはありません。
+package compare
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// Options は比較の設定です
+type Options struct {
+	// NoVerify が true の場合、展開と検証を省略します（速度優先）
+	NoVerify bool
+
+	// Decompress は検証のための展開の制限です（ゼロ値は制限なし）
+	// 信頼できないデータを比較する場合は、MaxOutputSize に元のデータのサイズを指定すると、
+	// 壊れたデコーダーが大きな出力を確保する前に止められます。
+	Decompress common.DecompressOptions
+
+	// MeasureMemory が true の場合、圧縮・展開で増えたメモリを測定します（Result.Memory）
+	// 候補ごとにガベージコレクションを実行するため、比較が遅くなります。
+	MeasureMemory bool
+
+	// Policy は各アルゴリズムに設定する暗黙の選択の扱いです（common.WithPolicy）
+	// Strict の場合、暗黙の選択をしないと処理できないアルゴリズムはエラーとして報告します。
+	Policy common.Policy
+}
+
+// Result は1つのアルゴリズムの比較結果です
+type Result struct {
+	Algorithm      string                  // アルゴリズム名（Name() の値）
+	Stats          common.CompressionStats // 圧縮統計
+	CompressTime   time.Duration           // 圧縮時間
+	DecompressTime time.Duration           // 展開時間（検証を省略した場合は0）
+	Verified       bool                    // 展開結果が元データと一致したか
+	MismatchOffset int                     // 最初に一致しなかった位置（一致した場合は-1）
+	Err            error                   // 圧縮・展開中のエラー
+
+	// Floor はアルゴリズムのモデルでの圧縮後のサイズの下限の目安（bytes）です
+	// アルゴリズムが common.FloorEstimator を実装していない場合は-1です。
+	Floor float64
+
+	// Memory は圧縮・展開で増えたメモリの目安です（Options.MeasureMemory の場合だけ）
+	Memory Memory
+}
+
+// Efficiency は下限に対する圧縮後のサイズの効率（Floor / 圧縮後のサイズ、0〜1）を返します
+// 下限がない場合や圧縮後のサイズが0の場合は-1を返します。
+func (r Result) Efficiency() float64 {
+	if r.Floor < 0 || r.Stats.CompressedSize == 0 {
+		return -1
+	}
+	return r.Floor / float64(r.Stats.CompressedSize)
+}
+
+// Failed は圧縮・展開に失敗したか、検証で不一致が見つかったかを返します
+func (r Result) Failed() bool {
+	return r.Err != nil || r.MismatchOffset >= 0
+}
+
+// Report は比較結果の一覧です
+type Report struct {
+	Results        []Result
+	Verified       bool // 検証を実行したか
+	MemoryMeasured bool // メモリを測定したか
+}
+
+// OK はすべてのアルゴリズムが成功したかを返します
+func (r Report) OK() bool {
+	for _, result := range r.Results {
+		if result.Failed() {
+			return false
+		}
+	}
+	return true
+}
+
+// ExitCode はCLIの終了コードを返します（失敗があれば1）
+func (r Report) ExitCode() int {
+	if r.OK() {
+		return 0
+	}
+	return 1
+}
+
+// Run は登録済みのアルゴリズム名を指定して比較します
+// names が空の場合は登録済みのすべてのアルゴリズムを比較します
+func Run(data []byte, names []string, opts Options) (Report, error) {
+	if len(names) == 0 {
+		names = common.Names()
+	}
+
+	compressors := make([]common.Compressor, 0, len(names))
+	for _, name := range names {
+		c, err := common.New(name)
+		if err != nil {
+			return Report{}, err
+		}
+		compressors = append(compressors, c)
+	}
+
+	return RunCompressors(data, compressors, opts), nil
+}
+
+// RunCompressors は指定したCompressorで比較します
+func RunCompressors(data []byte, compressors []common.Compressor, opts Options) Report {
+	report := Report{Verified: !opts.NoVerify, MemoryMeasured: opts.MeasureMemory}
+	for _, c := range compressors {
+		report.Results = append(report.Results, runOne(data, c, opts))
+	}
+	return report
+}
+
+// runOne は1つのアルゴリズムで圧縮・展開・検証を行います
+func runOne(data []byte, c common.Compressor, opts Options) Result {
+	c = common.WithPolicy(c, opts.Policy)
+	result := Result{
+		Algorithm:      c.Name(),
+		MismatchOffset: -1,
+		Floor:          -1,
+	}
+
+	var (
+		compressed []byte
+		err        error
+	)
+	measure(opts, &result.Memory.Compress, func() {
+		start := time.Now()
+		compressed, err = c.Compress(data)
+		result.CompressTime = time.Since(start)
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("compress: %w", err)
+		return result
+	}
+
+	result.Stats = common.CompressionStats{
+		OriginalSize:   int64(len(data)),
+		CompressedSize: int64(len(compressed)),
+		Algorithm:      c.Name(),
+		Duration:       result.CompressTime,
+	}
+	result.Stats.CalculateRatio()
+	// 下限の計算は圧縮時間に含めない
+	if floor, ok := common.Floor(c, data); ok {
+		result.Floor = floor
+	}
+	if opts.MeasureMemory {
+		result.Memory.Workers, _ = common.WorkingMemory(c, len(data))
+	}
+
+	if opts.NoVerify {
+		return result
+	}
+
+	var decompressed []byte
+	measure(opts, &result.Memory.Decompress, func() {
+		start := time.Now()
+		decompressed, err = common.DecompressWithOptions(c, compressed, opts.Decompress)
+		result.DecompressTime = time.Since(start)
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("decompress: %w", err)
+		return result
+	}
+
+	result.MismatchOffset = FirstMismatch(data, decompressed)
+	result.Verified = result.MismatchOffset < 0
+	return result
+}
+
+// measure は fn を実行し、opts.MeasureMemory の場合は増えたメモリを usage に格納します
+// 時間は fn の中で測るため、測定のためのガベージコレクションは含みません。
+func measure(opts Options, usage *MemoryUsage, fn func()) {
+	if !opts.MeasureMemory {
+		fn()
+		return
+	}
+	*usage = measureMemory(fn)
+}
+
+// FirstMismatch は2つのデータが最初に異なる位置を返します（一致する場合は-1）
+// 一方が他方の先頭部分である場合は、短い方の長さを返します
+func FirstMismatch(expected, actual []byte) int {
+	n := len(expected)
+	if len(actual) < n {
+		n = len(actual)
+	}
+	for i := 0; i < n; i++ {
+		if expected[i] != actual[i] {
+			return i
+		}
+	}
+	if len(expected) != len(actual) {
+		return n
+	}
+	return -1
+}
+
+// PrintReport は比較結果を表形式で表示します
+func PrintReport(report Report) {
+	FprintReport(os.Stdout, report)
+}
+
+// FprintReport は PrintReport と同じ内容を w に書き込みます
+// メモリを測定した場合は、目安であることを表す ~ を付けたピークの列と、複数の
+// ワーカーを報告したアルゴリズムのワーカーごとの作業領域を表示します。
+func FprintReport(w io.Writer, report Report) {
+	fmt.Fprintf(w, "=== アルゴリズム比較 ===\n")
+	fmt.Fprintf(w, "%-45s %12s %12s %9s %12s %8s %12s %12s",
+		"アルゴリズム", "元サイズ", "圧縮後", "圧縮率", "下限", "効率", "圧縮時間", "展開時間")
+	if report.MemoryMeasured {
+		fmt.Fprintf(w, " %12s", "メモリ(目安)")
+	}
+	fmt.Fprintf(w, "  %s\n", "検証")
+
+	for _, r := range report.Results {
+		fmt.Fprintf(w, "%-45s %12d %12d %8.2f%% %12s %8s %12s %12s",
+			r.Algorithm,
+			r.Stats.OriginalSize,
+			r.Stats.CompressedSize,
+			r.Stats.Ratio*100,
+			floorCell(r),
+			efficiencyCell(r),
+			r.CompressTime.Round(time.Microsecond),
+			r.DecompressTime.Round(time.Microsecond))
+		if report.MemoryMeasured {
+			fmt.Fprintf(w, " %12s", "~"+common.FormatBytes(r.Memory.Peak()))
+		}
+		fmt.Fprintf(w, "  %s\n", verifyMark(r, report.Verified))
+	}
+
+	if report.MemoryMeasured {
+		for _, r := range report.Results {
+			if len(r.Memory.Workers) < 2 {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s のワーカーごとの作業領域（目安）:", r.Algorithm)
+			for _, m := range r.Memory.Workers {
+				fmt.Fprintf(w, " %s", common.FormatBytes(m))
+			}
+			fmt.Fprintf(w, "（合計 %s）\n", common.FormatBytes(r.Memory.WorkersTotal()))
+		}
+	}
+
+	if !report.OK() {
+		fmt.Fprintf(w, "\n✗ 検証に失敗したアルゴリズムがあります\n")
+	}
+}
+
+// floorCell は下限の表示文字列を返します（下限がない場合は "-"）
+func floorCell(r Result) string {
+	if r.Err != nil || r.Floor < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", r.Floor)
+}
+
+// efficiencyCell は効率の表示文字列を返します（下限がない場合は "-"）
+func efficiencyCell(r Result) string {
+	if e := r.Efficiency(); r.Err == nil && e >= 0 {
+		return fmt.Sprintf("%.1f%%", e*100)
+	}
+	return "-"
+}
+
+// verifyMark は検証結果の表示文字列を返します
+func verifyMark(r Result, verified bool) string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("✗ エラー: %v", r.Err)
+	case r.MismatchOffset >= 0:
+		return fmt.Sprintf("✗ 不一致 (offset %d)", r.MismatchOffset)
+	case !verified:
+		return "- (省略)"
+	default:
+		return "✓"
+	}
+}
@@ -0,0 +1,385 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// brokenCompressor は展開結果の4バイト目を壊す、意図的に壊れたCompressorです
+type brokenCompressor struct{}
+
+func (brokenCompressor) Name() string { return "broken" }
+
+func (brokenCompressor) Compress(data []byte) ([]byte, error) {
+	// 1バイトだけ返して、圧縮率は非常に良く見せる
+	return []byte{0}, nil
+}
+
+func (brokenCompressor) Decompress(data []byte) ([]byte, error) {
+	return []byte("abcX"), nil
+}
+
+// failingCompressor は展開でエラーを返すCompressorです
+type failingCompressor struct{}
+
+func (failingCompressor) Name() string                         { return "failing" }
+func (failingCompressor) Compress(data []byte) ([]byte, error) { return data, nil }
+func (failingCompressor) Decompress(data []byte) ([]byte, error) {
+	return nil, errors.New("corrupted")
+}
+
+func init() {
+	// テストでのみ登録される壊れたアルゴリズム
+	common.Register("test-broken", func() common.Compressor { return brokenCompressor{} })
+}
+
+func TestRun_AllVerified(t *testing.T) {
+	data := []byte("aaaaabbbbbcccccdddddeeeee hello hello hello")
+
+	report, err := Run(data, []string{"rle", "huffman", "lz77"}, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(report.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(report.Results))
+	}
+	for _, r := range report.Results {
+		if !r.Verified || r.Failed() {
+			t.Errorf("%s: expected verified result, got %+v", r.Algorithm, r)
+		}
+	}
+	if !report.OK() || report.ExitCode() != 0 {
+		t.Errorf("Expected OK report with exit code 0")
+	}
+}
+
+func TestRun_BrokenCompressorSurfaced(t *testing.T) {
+	data := []byte("abcdefgh")
+
+	// 名前を指定しない場合は登録済みのすべて（壊れたスタブを含む）を比較する
+	report, err := Run(data, nil, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var broken *Result
+	for i := range report.Results {
+		if report.Results[i].Algorithm == "broken" {
+			broken = &report.Results[i]
+		}
+	}
+	if broken == nil {
+		t.Fatal("Expected broken compressor in report")
+	}
+
+	if broken.Verified || !broken.Failed() {
+		t.Error("Expected broken compressor to fail verification")
+	}
+	if broken.MismatchOffset != 3 {
+		t.Errorf("Expected mismatch at offset 3, got %d", broken.MismatchOffset)
+	}
+	if report.OK() {
+		t.Error("Expected report not to be OK")
+	}
+	if report.ExitCode() == 0 {
+		t.Error("Expected nonzero exit code")
+	}
+}
+
+func TestRun_NoVerify(t *testing.T) {
+	report, err := Run([]byte("abcdefgh"), []string{"test-broken"}, Options{NoVerify: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	r := report.Results[0]
+	if r.Verified || r.Failed() || r.DecompressTime != 0 {
+		t.Errorf("Expected unverified, non-failed result, got %+v", r)
+	}
+	if report.ExitCode() != 0 {
+		t.Error("Expected exit code 0 when verification is skipped")
+	}
+}
+
+func TestRunCompressors_DecompressError(t *testing.T) {
+	report := RunCompressors([]byte("data"), []common.Compressor{rle.NewCompressor(), failingCompressor{}}, Options{})
+
+	if report.Results[0].Failed() {
+		t.Errorf("RLE should succeed: %+v", report.Results[0])
+	}
+	if report.Results[1].Err == nil {
+		t.Error("Expected decompress error to be recorded")
+	}
+	if report.ExitCode() != 1 {
+		t.Errorf("Expected exit code 1, got %d", report.ExitCode())
+	}
+}
+
+func TestRun_Floor(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefg"), 100)
+	report := RunCompressors(data, []common.Compressor{rle.NewCompressor(), failingCompressor{}}, Options{})
+
+	r := report.Results[0]
+	if want := rle.NewCompressor().Floor(data); r.Floor != want {
+		t.Errorf("Expected floor %f, got %f", want, r.Floor)
+	}
+	if e := r.Efficiency(); e <= 0 || e > 1 {
+		t.Errorf("Expected an efficiency in (0, 1], got %f", e)
+	}
+	// FloorEstimator を実装していないアルゴリズムには下限がない
+	if r := report.Results[1]; r.Floor != -1 || r.Efficiency() != -1 {
+		t.Errorf("Expected no floor, got %f (efficiency %f)", r.Floor, r.Efficiency())
+	}
+
+	var buf bytes.Buffer
+	FprintReport(&buf, report)
+	out := buf.String()
+	if !strings.Contains(out, "下限") || !strings.Contains(out, fmt.Sprintf("%.1f%%", r.Efficiency()*100)) {
+		t.Errorf("Expected floor and efficiency columns in:\n%s", out)
+	}
+}
+
+// hungryCompressor は圧縮のたびに size バイトを確保して保持し続ける Compressor です
+type hungryCompressor struct {
+	size int
+	kept *[][]byte
+}
+
+func (hungryCompressor) Name() string { return "hungry" }
+
+func (h hungryCompressor) Compress(data []byte) ([]byte, error) {
+	buf := make([]byte, h.size)
+	buf[len(buf)-1] = 1
+	*h.kept = append(*h.kept, buf)
+	return append([]byte{}, data...), nil
+}
+
+func (hungryCompressor) Decompress(data []byte) ([]byte, error) {
+	return append([]byte{}, data...), nil
+}
+
+func TestRun_MemoryOrdering(t *testing.T) {
+	// RLE の作業領域は出力だけなので、ランの多い入力では接尾辞配列よりずっと小さい
+	data := bytes.Repeat([]byte(strings.Repeat("a", 40)+strings.Repeat("b", 30)+"cd"), 4096)
+	report, err := Run(data, []string{"rle", "lz77-optimal"}, Options{MeasureMemory: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !report.MemoryMeasured || !report.OK() {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	rleMemory, optimalMemory := report.Results[0].Memory, report.Results[1].Memory
+
+	// 接尾辞配列は入力の1バイトあたり12バイト以上を使う
+	if optimalMemory.Compress.Peak < int64(len(data))*12 {
+		t.Errorf("lz77-optimal peak %d is smaller than its suffix array", optimalMemory.Compress.Peak)
+	}
+	if optimalMemory.Peak() < 4*rleMemory.Peak() {
+		t.Errorf("lz77-optimal peak %d is not far above RLE peak %d", optimalMemory.Peak(), rleMemory.Peak())
+	}
+	if optimalMemory.Compress.Allocated < optimalMemory.Compress.Peak {
+		t.Errorf("Allocated %d is smaller than peak %d", optimalMemory.Compress.Allocated, optimalMemory.Compress.Peak)
+	}
+	if want := int64(len(data)) * 12; len(optimalMemory.Workers) != 1 || optimalMemory.Workers[0] != want {
+		t.Errorf("Reported workers = %v, want [%d]", optimalMemory.Workers, want)
+	}
+	if rleMemory.Workers != nil {
+		t.Errorf("RLE reported workers %v", rleMemory.Workers)
+	}
+
+	// 測定しない場合は0のまま
+	report, _ = Run(data[:1000], []string{"lz77-optimal"}, Options{})
+	if report.MemoryMeasured || report.Results[0].Memory.Peak() != 0 {
+		t.Errorf("Memory measured without MeasureMemory: %+v", report.Results[0].Memory)
+	}
+}
+
+func TestRun_MemoryIsolatedBetweenCandidates(t *testing.T) {
+	data := bytes.Repeat([]byte("abcabcabd"), 1000)
+	var kept [][]byte
+	hungry := hungryCompressor{size: 32 << 20, kept: &kept}
+
+	alone := RunCompressors(data, []common.Compressor{rle.NewCompressor()}, Options{MeasureMemory: true})
+	after := RunCompressors(data, []common.Compressor{hungry, rle.NewCompressor()}, Options{MeasureMemory: true})
+
+	if peak := after.Results[0].Memory.Compress.Peak; peak < int64(hungry.size) {
+		t.Errorf("hungry peak %d is smaller than its allocation", peak)
+	}
+	// 前の候補が確保して保持しているメモリは、次の候補に数えない
+	alonePeak, afterPeak := alone.Results[0].Memory.Peak(), after.Results[1].Memory.Peak()
+	if afterPeak > alonePeak+1<<20 {
+		t.Errorf("RLE peak after a hungry candidate = %d, alone = %d", afterPeak, alonePeak)
+	}
+	if len(kept) != 1 {
+		t.Errorf("hungry ran %d times", len(kept))
+	}
+}
+
+func TestRun_MemoryWorkers(t *testing.T) {
+	data := bytes.Repeat([]byte("xyz"), 1000)
+	candidates := []common.Compressor{rle.NewCompressor(), lz77.NewCompressor(lz77.WithOptimalMatcher())}
+	report := RunCompressors(data, []common.Compressor{common.NewParallelBestOf(candidates...)}, Options{MeasureMemory: true})
+
+	m := report.Results[0].Memory
+	if len(m.Workers) != len(candidates) {
+		t.Fatalf("Workers = %v, want one per candidate", m.Workers)
+	}
+	if m.Workers[1] <= m.Workers[0] || m.WorkersTotal() != m.Workers[0]+m.Workers[1] {
+		t.Errorf("Unexpected workers %v (total %d)", m.Workers, m.WorkersTotal())
+	}
+	if m.Peak() < m.WorkersTotal() {
+		t.Errorf("Peak %d is below the reported total %d", m.Peak(), m.WorkersTotal())
+	}
+
+	var buf bytes.Buffer
+	FprintReport(&buf, report)
+	for _, want := range []string{"メモリ(目安)", "~", "ワーカーごとの作業領域"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Report does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunCompressors_StrictPolicy(t *testing.T) {
+	noise := make([]byte, 512)
+	for i := range noise {
+		noise[i] = byte(i * 167)
+	}
+	best := common.NewBestOf(rle.NewCompressor())
+
+	if report := RunCompressors(noise, []common.Compressor{best}, Options{}); !report.OK() {
+		t.Fatalf("Expected the stored fallback to pass: %+v", report.Results[0])
+	}
+	report := RunCompressors(noise, []common.Compressor{best}, Options{Policy: common.Policy{Strict: true}})
+	if err := report.Results[0].Err; !errors.Is(err, common.ErrStrict) {
+		t.Errorf("Expected a strict error, got %v", err)
+	}
+}
+
+func TestRun_UnknownAlgorithm(t *testing.T) {
+	if _, err := Run([]byte("x"), []string{"no-such"}, Options{}); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+func TestFirstMismatch(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"abc", "abc", -1},
+		{"", "", -1},
+		{"abc", "abd", 2},
+		{"abc", "ab", 2},
+		{"ab", "abc", 2},
+		{"xbc", "abc", 0},
+	}
+
+	for _, tt := range tests {
+		if got := FirstMismatch([]byte(tt.a), []byte(tt.b)); got != tt.expected {
+			t.Errorf("FirstMismatch(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestCSVWriter_ParseBack(t *testing.T) {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		// カンマや引用符を含むファイル名も正しくクォートされる
+		{`data, "quoted".txt`, []byte("aaaaabbbbbcccccdddddeeeee hello hello hello")},
+		{"second.bin", []byte("abcabcabcabcabcabc")},
+	}
+	names := []string{"rle", "huffman", "lz77"}
+
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	for _, f := range files {
+		report, err := Run(f.data, names, Options{})
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if err := w.Write(f.name, report); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	// ヘッダーは1回だけ
+	if len(records) != 1+len(files)*len(names) {
+		t.Fatalf("Expected %d records, got %d", 1+len(files)*len(names), len(records))
+	}
+	if !reflect.DeepEqual(records[0], CSVHeader) {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+
+	// 行の順序はファイルの順、その中でアルゴリズムの指定順
+	var expectedAlgorithms []string
+	for _, name := range names {
+		c, _ := common.New(name)
+		expectedAlgorithms = append(expectedAlgorithms, c.Name())
+	}
+	for i, record := range records[1:] {
+		if len(record) != len(CSVHeader) {
+			t.Fatalf("Row %d: expected %d fields, got %d", i, len(CSVHeader), len(record))
+		}
+		if record[0] != files[i/len(names)].name {
+			t.Errorf("Row %d: expected file %q, got %q", i, files[i/len(names)].name, record[0])
+		}
+		if record[1] != expectedAlgorithms[i%len(names)] {
+			t.Errorf("Row %d: expected algorithm %q, got %q", i, expectedAlgorithms[i%len(names)], record[1])
+		}
+
+		for _, col := range []int{2, 3} {
+			if _, err := strconv.ParseInt(record[col], 10, 64); err != nil {
+				t.Errorf("Row %d: %s is not an integer: %q", i, CSVHeader[col], record[col])
+			}
+		}
+		for _, col := range []int{4, 5, 6, 7} {
+			if _, err := strconv.ParseFloat(record[col], 64); err != nil {
+				t.Errorf("Row %d: %s is not a number: %q", i, CSVHeader[col], record[col])
+			}
+		}
+		if verified, err := strconv.ParseBool(record[8]); err != nil || !verified {
+			t.Errorf("Row %d: expected verified=true, got %q", i, record[8])
+		}
+	}
+}
+
+func TestCSVWriter_HeaderOnlyOnce(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	w.Write("a", Report{})
+	w.Write("b", Report{})
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Expected only the header row, got %d records", len(records))
+	}
+}
@@ -0,0 +1,94 @@
+package compare
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSVHeader はCSV出力の列名です
+var CSVHeader = []string{
+	"file",
+	"algorithm",
+	"original_size",
+	"compressed_size",
+	"ratio",
+	"compress_ms",
+	"decompress_ms",
+	"throughput_mbps",
+	"verified",
+	"peak_memory_bytes",
+}
+
+// CSVWriter は比較結果を (ファイル, アルゴリズム) ごとに1行のCSVとして書き込みます
+// ヘッダー行は複数のファイルを書き込んでも最初に1回だけ出力されます。
+type CSVWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+// NewCSVWriter は w に書き込む CSVWriter を作成します
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write は1つのファイルの比較結果を書き込みます
+func (c *CSVWriter) Write(file string, report Report) error {
+	if !c.headerWritten {
+		if err := c.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	for _, r := range report.Results {
+		if err := c.w.Write(csvRecord(file, r, report.MemoryMeasured)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush はバッファされたデータを書き込み、書き込み中のエラーを返します
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvRecord は1つの結果をCSVの1行に変換します
+func csvRecord(file string, r Result, memoryMeasured bool) []string {
+	return []string{
+		file,
+		r.Algorithm,
+		strconv.FormatInt(r.Stats.OriginalSize, 10),
+		strconv.FormatInt(r.Stats.CompressedSize, 10),
+		strconv.FormatFloat(r.Stats.Ratio, 'f', 6, 64),
+		formatMillis(r.CompressTime),
+		formatMillis(r.DecompressTime),
+		strconv.FormatFloat(throughput(r.Stats.OriginalSize, r.CompressTime), 'f', 3, 64),
+		strconv.FormatBool(r.Verified),
+		peakMemoryCell(r, memoryMeasured),
+	}
+}
+
+// peakMemoryCell はメモリのピークの目安の列です（測定しなかった場合は空）
+func peakMemoryCell(r Result, measured bool) string {
+	if !measured {
+		return ""
+	}
+	return strconv.FormatInt(r.Memory.Peak(), 10)
+}
+
+// formatMillis は時間をミリ秒の小数で表します
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// throughput は圧縮のスループット (MB/s) を返します（時間が0の場合は0）
+func throughput(size int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(size) / 1e6 / d.Seconds()
+}
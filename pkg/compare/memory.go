@@ -0,0 +1,95 @@
+package compare
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// MemoryUsage は1つの処理（圧縮または展開）で増えたメモリの近似値です
+type MemoryUsage struct {
+	Peak      int64 // 処理の前からのヒープの増加の最大（bytes、結果を含む）
+	Allocated int64 // 処理中に確保したバイト数の合計（途中で解放したものを含む）
+}
+
+// Memory は1つのアルゴリズムのメモリの測定結果です（Options.MeasureMemory）
+// ヒープの増加はガベージコレクションのタイミングとサンプリングの間隔に左右されるため、
+// 値は目安です。同じ入力でのアルゴリズムの比較に使ってください。
+type Memory struct {
+	Compress   MemoryUsage
+	Decompress MemoryUsage
+
+	// Workers はアルゴリズムが報告したワーカーごとの作業領域の目安（bytes）です
+	// アルゴリズムが common.MemoryReporter を実装していない場合は nil です。
+	Workers []int64
+}
+
+// WorkersTotal は Workers の合計を返します
+func (m Memory) WorkersTotal() int64 {
+	var total int64
+	for _, w := range m.Workers {
+		total += w
+	}
+	return total
+}
+
+// Peak は圧縮・展開のピークと、報告された作業領域の合計のうち最も大きい値を返します
+// 短い処理ではサンプリングの間にピークを逃すことがあるため、報告された作業領域を下限にします。
+func (m Memory) Peak() int64 {
+	return max(m.Compress.Peak, m.Decompress.Peak, m.WorkersTotal())
+}
+
+// memorySampleInterval はヒープの大きさを読み取る間隔です
+const memorySampleInterval = 200 * time.Microsecond
+
+// heapObjectsMetric はヒープ上のオブジェクトのバイト数（未回収のものを含む）のメトリクスです
+// runtime.ReadMemStats と異なりプログラムを止めないため、処理中に繰り返し読み取れます。
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// measureMemory は fn の実行中に増えたメモリを測定します
+// 前の候補の不要なメモリを含めないよう、始める前にガベージコレクションを実行します。
+// 処理中はゴルーチンでヒープの大きさを読み取り、終了時の値と合わせて最大を求めます。
+func measureMemory(fn func()) MemoryUsage {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	baseline := heapObjects()
+
+	var (
+		peak = baseline
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				peak = max(peak, heapObjects())
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	peak = max(peak, heapObjects())
+	runtime.ReadMemStats(&after)
+
+	return MemoryUsage{
+		Peak:      int64(peak - baseline),
+		Allocated: int64(after.TotalAlloc - before.TotalAlloc),
+	}
+}
+
+// heapObjects はヒープ上のオブジェクトのバイト数を返します
+func heapObjects() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,125 @@
+package compare
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// DefaultSliceSize は SavingsMap で sliceSize が0以下の場合の区切りのバイト数です
+const DefaultSliceSize = 4 << 10
+
+// SavingsMap は data を sliceSize バイトごとに区切り、algos のそれぞれが各区切りのために出力したバイト数を返します
+// 結果の i 行目が algos[i] の区切りごとのバイト数で、区切りのバイト数に比べて小さいほど、
+// その範囲で圧縮が効いています（最後の区切りは sliceSize より短いことがあります）。
+// 出力のビット数は common.CostMapped で入力の位置ごとに受け取り、複数の区切りにまたがる
+// 出力（長いマッチなど）は重なるバイト数に応じて分けます。ヘッダーや符号表のように位置に
+// 対応しない出力は含みません。CostMapped を実装していないアルゴリズムと、圧縮に失敗した
+// アルゴリズムの行は nil です。sliceSize が0以下の場合は DefaultSliceSize を使います。
+func SavingsMap(data []byte, algos []common.Compressor, sliceSize int) [][]float64 {
+	if sliceSize <= 0 {
+		sliceSize = DefaultSliceSize
+	}
+	slices := (len(data) + sliceSize - 1) / sliceSize
+
+	rows := make([][]float64, len(algos))
+	for i, c := range algos {
+		row := make([]float64, slices)
+		mapped, ok := common.WithCostMap(c, func(pos, length int, bits float64) {
+			addCost(row, sliceSize, len(data), pos, length, bits)
+		})
+		if !ok {
+			continue
+		}
+		if _, err := mapped.Compress(data); err != nil {
+			continue
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// addCost は入力の pos から length バイトに使った bits ビットを、重なる区切りに分けて row に加えます
+// data の終わりを超える範囲は data の中の部分に、data の外だけの範囲は最後の区切りに加えます。
+func addCost(row []float64, sliceSize, size, pos, length int, bits float64) {
+	if len(row) == 0 {
+		return
+	}
+	end := min(pos+max(length, 1), size)
+	if pos >= end {
+		row[len(row)-1] += bits / 8
+		return
+	}
+	perByte := bits / 8 / float64(end-pos)
+	for pos < end {
+		slice := pos / sliceSize
+		next := min((slice+1)*sliceSize, end)
+		row[slice] += perByte * float64(next-pos)
+		pos = next
+	}
+}
+
+// savingsMapWidth は FprintSavingsMap の帯の最大の文字数です（区切りが多い場合は隣どうしをまとめます）
+const savingsMapWidth = 64
+
+// heatRamp は元のサイズに対する出力の割合（0〜100%）を表す文字です（'!' は元より大きい）
+const heatRamp = " .:-=+*#%@"
+
+// FprintSavingsMap は SavingsMap の結果を、アルゴリズムごとに1行の帯として w に書き込みます
+// 帯の1文字は入力の同じ範囲を表すため、行を縦に比べるとどのアルゴリズムがどこで
+// 出力を使っているかが分かります。文字は区切りの元のサイズに対する出力の割合で、
+// 空白（ほぼ0%）から '@'（100%）まで濃くなり、元より大きくなった範囲は '!' です。
+// 行の終わりには位置に対応する出力の合計の割合を表示します。names は rows と同じ順の
+// 表示名、size は入力のバイト数です。nil の行は「対応していません」と表示します。
+func FprintSavingsMap(w io.Writer, names []string, rows [][]float64, size, sliceSize int) {
+	if sliceSize <= 0 {
+		sliceSize = DefaultSliceSize
+	}
+	slices := (size + sliceSize - 1) / sliceSize
+	cols := min(slices, savingsMapWidth)
+	nameWidth := 0
+	for _, name := range names {
+		nameWidth = max(nameWidth, len(name))
+	}
+
+	fmt.Fprintf(w, "=== 位置ごとの出力（%s ごと） ===\n", common.FormatBytes(int64(sliceSize)))
+	end := common.FormatBytes(int64(size))
+	fmt.Fprintf(w, "%-*s  0%*s\n", nameWidth, "", max(cols-1, len(end)), end)
+	for i, row := range rows {
+		if row == nil {
+			fmt.Fprintf(w, "%-*s  （対応していません）\n", nameWidth, names[i])
+			continue
+		}
+		var strip strings.Builder
+		total := 0.0
+		for c := range cols {
+			// 列 c は区切り [first, last) をまとめたもの
+			first, last := c*slices/cols, (c+1)*slices/cols
+			cost := 0.0
+			for _, v := range row[first:last] {
+				cost += v
+			}
+			total += cost
+			strip.WriteByte(heatChar(cost / float64(min(last*sliceSize, size)-first*sliceSize)))
+		}
+		ratio := 0.0
+		if size > 0 {
+			ratio = total / float64(size)
+		}
+		fmt.Fprintf(w, "%-*s |%s| %5.1f%%\n", nameWidth, names[i], strip.String(), ratio*100)
+	}
+	fmt.Fprintf(w, "%-*s  凡例: 元のサイズに対する出力 '%c' 0%% ～ '%c' 100%%、'!' 元より大きい\n",
+		nameWidth, "", heatRamp[0], heatRamp[len(heatRamp)-1])
+}
+
+// heatChar は元のサイズに対する出力の割合 ratio を表す文字を返します（最も近い段階の文字）
+func heatChar(ratio float64) byte {
+	if ratio > 1 {
+		return '!'
+	}
+	steps := len(heatRamp) - 1
+	return heatRamp[min(max(int(math.Round(ratio*float64(steps))), 0), steps)]
+}
@@ -0,0 +1,107 @@
+package compare
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+func TestSavingsMap_HalfZerosHalfRandom(t *testing.T) {
+	const sliceSize = 4 << 10
+	const half = 16 * sliceSize
+	data := append(make([]byte, half), testcorpus.Random(half, 1)...)
+
+	algos := []common.Compressor{
+		rle.NewCompressor(),
+		// 既定の最大マッチ長（18）では0の並びも19バイトごとにトークンが必要になる
+		lz77.NewCompressor(lz77.WithMaxMatchLength(1 << 16)),
+		huffman.NewCompressor(),
+		lzw.NewCompressor(),
+	}
+	rows := SavingsMap(data, algos, sliceSize)
+	if len(rows) != len(algos) {
+		t.Fatalf("Expected %d rows, got %d", len(algos), len(rows))
+	}
+	if rows[3] != nil {
+		t.Errorf("Expected a nil row for an algorithm without a cost map, got %v", rows[3])
+	}
+
+	for i, row := range rows[:3] {
+		name := algos[i].Name()
+		if len(row) != 2*half/sliceSize {
+			t.Fatalf("%s: expected %d slices, got %d", name, 2*half/sliceSize, len(row))
+		}
+
+		// 0の半分はRLEとLZ77ではほとんど出力しない
+		if i < 2 {
+			for s, cost := range row[:half/sliceSize] {
+				if cost > 0.01*sliceSize {
+					t.Errorf("%s: slice %d of zeros cost %.1f bytes", name, s, cost)
+				}
+			}
+		}
+
+		// 乱数の半分はどの区切りもほぼ同じで、元のサイズ以上になる
+		random := row[half/sliceSize:]
+		mean := 0.0
+		for _, cost := range random {
+			mean += cost / float64(len(random))
+		}
+		if mean < 0.95*sliceSize {
+			t.Errorf("%s: random slices cost %.1f bytes on average, want about %d", name, mean, sliceSize)
+		}
+		for s, cost := range random {
+			if math.Abs(cost-mean) > 0.1*mean {
+				t.Errorf("%s: random slice %d cost %.1f bytes, mean %.1f", name, s, cost, mean)
+			}
+		}
+	}
+
+	// RLEとLZ77は位置に対応しない出力がないため、合計が圧縮後のサイズと一致する
+	for i := range 2 {
+		compressed, err := algos[i].Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0.0
+		for _, cost := range rows[i] {
+			total += cost
+		}
+		if math.Abs(total-float64(len(compressed))) > 1e-6 {
+			t.Errorf("%s: mapped %.3f bytes, compressed to %d", algos[i].Name(), total, len(compressed))
+		}
+	}
+
+	var buf bytes.Buffer
+	FprintSavingsMap(&buf, []string{"rle", "lz77", "huffman", "lzw"}, rows, len(data), sliceSize)
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) < 6 || !strings.HasPrefix(lines[2], "rle     |                ") || !strings.Contains(lines[2], "!!!!!!!!!!!!!!!!|") {
+		t.Errorf("Unexpected strip for rle:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[5], "（対応していません）") {
+		t.Errorf("Expected lzw to be reported as unsupported:\n%s", buf.String())
+	}
+}
+
+func TestSavingsMap_Variants(t *testing.T) {
+	// 16bitシンボルのHuffmanとlz77hも、位置に対応する出力を入力全体に通知する
+	data := append(testcorpus.Cycle(10<<10), testcorpus.Random(10<<10+1, 2)...)
+	wide, _ := huffman.NewCompressorWithWidth(2)
+	rows := SavingsMap(data, []common.Compressor{wide, lz77.NewCompressorEntropyLiterals()}, 0)
+	for i, row := range rows {
+		if len(row) != (len(data)+DefaultSliceSize-1)/DefaultSliceSize {
+			t.Fatalf("Row %d: expected %d slices of the default size, got %d", i, (len(data)+DefaultSliceSize-1)/DefaultSliceSize, len(row))
+		}
+		if row[0] >= row[len(row)-2] {
+			t.Errorf("Row %d: expected the repeating start to cost less than the random end, got %v", i, row)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package container
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// DefaultChecksumChunkSize は CompressFile がストリームで圧縮したメンバーに記録する、
+// チャンクのチェックサムの間隔（元のデータのバイト数）の既定値です
+const DefaultChecksumChunkSize = 4 << 20
+
+// ChunkError は展開結果のチャンクのCRC32がヘッダーの値と一致しない場合のエラーです
+// errors.Is(err, ErrChecksum) で判定できます。Start と End は展開結果の先頭からの
+// 位置で、展開結果の [Start, End) のどこかが壊れています。
+type ChunkError struct {
+	Index    int    // チャンクの番号
+	Start    int64  // チャンクの開始位置
+	End      int64  // チャンクの終了位置（このバイトは含まない）
+	Expected uint32 // ヘッダーのCRC32
+	Actual   uint32 // 展開結果のCRC32
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("%v in chunk %d (bytes %d-%d): expected %08x, got %08x",
+		ErrChecksum, e.Index, e.Start, e.End, e.Expected, e.Actual)
+}
+
+// Unwrap は ErrChecksum を返します
+func (e *ChunkError) Unwrap() error {
+	return ErrChecksum
+}
+
+// chunkHasher は書き込まれたデータを size バイトごとのチャンクに区切り、各チャンクのCRC32を計算します
+// チャンクごとにハッシュをリセットするため、データ全体を保持しません。
+type chunkHasher struct {
+	size int64
+	hash hash.Hash32
+	n    int64 // 現在のチャンクに書き込んだバイト数
+	sums []uint32
+}
+
+func newChunkHasher(size int64) *chunkHasher {
+	return &chunkHasher{size: size, hash: crc32.NewIEEE()}
+}
+
+func (c *chunkHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(int64(len(p)), c.size-c.n)
+		c.hash.Write(p[:n])
+		c.n += n
+		p = p[n:]
+		if c.n == c.size {
+			c.sums = append(c.sums, c.hash.Sum32())
+			c.hash.Reset()
+			c.n = 0
+		}
+	}
+	return written, nil
+}
+
+// Sums は各チャンクのCRC32を返します（最後の短いチャンクを含む）
+func (c *chunkHasher) Sums() []uint32 {
+	if c.n > 0 {
+		return append(c.sums, c.hash.Sum32())
+	}
+	return c.sums
+}
+
+// chunkVerifier は w に書き込みながらチャンクのCRC32を確認します
+// チャンクの終わりまで書き込んだ時点で一致しなければ *ChunkError を返し、それ以降は
+// w に書き込みません。base は展開結果全体の中でのメンバーの開始位置です（エラーの位置に加えます）。
+// 最後の短いチャンクは Close で確認します。
+type chunkVerifier struct {
+	w     io.Writer
+	h     Header
+	base  int64
+	hash  hash.Hash32
+	index int   // 現在のチャンクの番号
+	n     int64 // 現在のチャンクに書き込んだバイト数
+}
+
+func newChunkVerifier(w io.Writer, h Header, base int64) *chunkVerifier {
+	return &chunkVerifier{w: w, h: h, base: base, hash: crc32.NewIEEE()}
+}
+
+func (v *chunkVerifier) Write(p []byte) (int, error) {
+	written := 0
+	size := int64(v.h.ChunkSize)
+	for len(p) > 0 {
+		n := min(int64(len(p)), size-v.n)
+		if _, err := v.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		v.hash.Write(p[:n])
+		v.n += n
+		written += int(n)
+		p = p[n:]
+		if v.n == size {
+			if err := v.check(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close は最後の短いチャンクを確認します
+func (v *chunkVerifier) Close() error {
+	if v.n > 0 {
+		return v.check()
+	}
+	return nil
+}
+
+// check は現在のチャンクのCRC32を確認し、次のチャンクに進みます
+func (v *chunkVerifier) check() error {
+	start := v.base + int64(v.index)*int64(v.h.ChunkSize)
+	err := v.h.checkChunk(v.index, v.hash.Sum32(), start, start+v.n)
+	v.hash.Reset()
+	v.index++
+	v.n = 0
+	return err
+}
+
+// checkChunk は i 番目のチャンク [start, end) のCRC32が sum であることを確認します
+// ヘッダーにないチャンク（元のサイズより多い展開結果）は確認しません。サイズの確認に任せます。
+func (h Header) checkChunk(i int, sum uint32, start, end int64) error {
+	if i >= len(h.ChunkCRCs) || h.ChunkCRCs[i] == sum {
+		return nil
+	}
+	return &ChunkError{Index: i, Start: start, End: end, Expected: h.ChunkCRCs[i], Actual: sum}
+}
+
+// verifyChunks はメモリ上の展開結果 data のチャンクのCRC32を確認します
+// チャンクのチェックサムを持たないメンバーでは何もしません。
+func (h Header) verifyChunks(data []byte) error {
+	if h.ChunkSize == 0 {
+		return nil
+	}
+	size := int64(h.ChunkSize)
+	for i := 0; int64(i)*size < int64(len(data)); i++ {
+		start := int64(i) * size
+		end := min(start+size, int64(len(data)))
+		if err := h.checkChunk(i, crc32.ChecksumIEEE(data[start:end]), start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
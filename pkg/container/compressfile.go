@@ -0,0 +1,657 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// DefaultChunkSize は StreamCompressor を実装していないアルゴリズムで、
+// 1つのメンバーに格納する元データの最大サイズです
+const DefaultChunkSize = 1 << 20
+
+// FileOptions はファイル単位の圧縮と展開の設定です
+type FileOptions struct {
+	// Algorithm はメンバーに記録する登録名です（common.New で使う名前）
+	// 展開時はコンテナでない入力の展開に使用します
+	Algorithm string
+
+	// ChunkSize は StreamCompressor でない場合に1メンバーに格納する元データの最大サイズです
+	// 0以下の場合は DefaultChunkSize を使用します
+	ChunkSize int
+
+	// Decompress は展開時の出力サイズの上限とメモリ予算です（ファイル全体に適用）
+	Decompress common.DecompressOptions
+
+	// MkdirAll は出力先の親ディレクトリがなければ作成します
+	MkdirAll bool
+
+	// Overwrite は既存の出力ファイルを置き換えます
+	Overwrite bool
+
+	// SkipExisting は既存の出力ファイルに書き込まずに fileutil.ErrSkipped を返します
+	SkipExisting bool
+
+	// VerifyExisting は出力を一時ファイルに書き込んでから既存の出力ファイルと比べ、
+	// 同じなら fileutil.ErrIdentical、異なれば fileutil.ErrDiffers を返します（置き換えません）
+	VerifyExisting bool
+
+	// Sparse は出力の0の領域を書き込まずにシークで飛ばし、スパースファイルとして作成します
+	// ファイルシステムが対応していない場合も、内容とサイズは通常の書き込みと同じになります。
+	Sparse bool
+
+	// Progress は入力を読み込むたびに、それまでに読み込んだ入力のバイト数で呼び出されます
+	// 展開時は圧縮データのバイト数です。nil の場合は呼び出しません。
+	Progress func(processed int64)
+
+	// Stdin は入力のパスが "-" の場合に読み込む標準入力です
+	// nil の場合は os.Stdin を使用します。
+	Stdin io.Reader
+
+	// RateLimit は入力を読み込む速度の上限（1秒あたりのバイト数）です
+	// 展開時は圧縮データを読み込む速度です。0以下の場合は制限しません。
+	RateLimit int64
+
+	// TolerateSizeMismatch は展開結果のサイズがヘッダーの元のサイズと異なるメンバーをエラーにせず、
+	// 展開できた分を出力して統計の SizeMismatches に記録します（common.SafetyPolicy と同じ）
+	TolerateSizeMismatch bool
+
+	// ChecksumChunkSize は StreamCompressor で圧縮したメンバーに記録するチャンクのチェックサムの間隔です
+	// 0の場合は DefaultChecksumChunkSize を使用し、負の場合は記録しません（バージョン2のメンバー）。
+	ChecksumChunkSize int64
+
+	// Nested は圧縮する入力が既に .tzz コンテナの場合の扱いです（既定は NestedStore）
+	Nested NestedMode
+
+	// MaxDepth は展開結果がまた .tzz コンテナの場合に、続けて展開する最大の層の数です
+	// 1以下の場合は入力の1層だけを展開します（展開結果がコンテナなら統計の Nested で知らせます）。
+	MaxDepth int
+}
+
+// CompressFile は srcPath を圧縮し、.tzz コンテナとして dstPath に書き込みます
+// c が common.StreamCompressor を実装していれば入力全体を1メンバーとしてストリームで圧縮し
+// （ペイロードは一時ファイルに書き出してからヘッダーの後ろにコピーします）、
+// それ以外は ChunkSize ごとに1メンバーとして圧縮します。どちらもメモリ使用量は
+// 入力のサイズによらず一定です。出力は一時ファイルに書き込んでから置き換えるため、
+// 失敗した場合に dstPath が中途半端な状態で残ることはありません。
+// srcPath が "-" の場合は標準入力から読み込みます。
+// 入力が既に .tzz コンテナの場合は opts.Nested に従い、既定では c で圧縮せずに
+// NestedAlgorithm のメンバーとして格納して、統計の Nested で知らせます。
+// 統計の Timings には読み込み・圧縮・書き込み（common.PhaseRead など）の処理時間と、
+// c が common.Timed を実装していればアルゴリズムのフェーズの処理時間を記録します。
+// 読み込み・圧縮・書き込みの合計は Duration と同じです。
+func CompressFile(srcPath, dstPath string, c common.Compressor, opts FileOptions) (common.CompressionStats, error) {
+	start := time.Now()
+	timings := common.NewTimings()
+	stats := common.CompressionStats{Algorithm: c.Name(), Source: srcPath, Timings: timings}
+
+	if err := checkName(opts.Algorithm); err != nil {
+		return stats, err
+	}
+
+	file, err := openInput(srcPath, opts.Stdin)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+	src := bufio.NewReader(&countingReader{
+		r:        &timedReader{r: common.NewRateLimitedReader(file, opts.RateLimit), timings: timings},
+		progress: opts.Progress,
+	})
+	if head, _ := src.Peek(headerPeekSize); opts.Nested != NestedCompress && LooksLikeContainer(head) {
+		if opts.Nested == NestedReject {
+			return stats, ErrNested
+		}
+		// 圧縮してもほとんど小さくならず、展開も2回必要になるため、そのまま格納する
+		c, opts.Algorithm, stats.Nested = common.NewStored(), NestedAlgorithm, true
+		stats.Algorithm = c.Name()
+	}
+	timed, _ := common.WithTimings(c, timings)
+
+	var finished time.Time
+	stats.CompressedSize, err = writeOutput(dstPath, opts, func(dst io.Writer) error {
+		var err error
+		dst = &timedWriter{w: dst, timings: timings}
+		if sc, ok := c.(common.StreamCompressor); ok {
+			stats.OriginalSize, err = compressStream(dst, src, sc, opts, common.FormatVersion(c), filepath.Dir(dstPath))
+		} else {
+			stats.OriginalSize, err = compressChunks(dst, src, timed, opts)
+		}
+		finished = time.Now()
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// 一時ファイルの書き出しと置き換えは書き込みに、読み込みと書き込み以外は圧縮に含める
+	timings.Since(common.PhaseWrite, finished)
+	stats.CalculateRatio()
+	stats.Duration = time.Since(start)
+	timings.Add(common.PhaseCompress, stats.Duration-timings.Get(common.PhaseRead)-timings.Get(common.PhaseWrite))
+	return stats, nil
+}
+
+// compressStream は src 全体を1メンバーとしてストリームで圧縮し、元のサイズを返します
+// version はペイロードの先頭に記録する形式バージョンです。opts.ChecksumChunkSize が負でなければ、
+// 展開しながら破損を見つけられるようにチャンクのチェックサムを記録します。
+func compressStream(dst io.Writer, src io.Reader, sc common.StreamCompressor, opts FileOptions, version byte, tmpDir string) (int64, error) {
+	tmp, err := os.CreateTemp(tmpDir, ".tinyzipzap-payload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	chunkSize := opts.ChecksumChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChecksumChunkSize
+	}
+	crc := crc32.NewIEEE()
+	hashes := io.Writer(crc)
+	var chunks *chunkHasher
+	if chunkSize > 0 {
+		chunks = newChunkHasher(chunkSize)
+		hashes = io.MultiWriter(crc, chunks)
+	}
+	original := &countingWriter{w: hashes}
+	payload := &countingWriter{w: tmp}
+	if err := sc.CompressStream(io.TeeReader(src, original), payload); err != nil {
+		return 0, err
+	}
+
+	// 空の入力は EncodeMember と同じくヘッダーだけのメンバーにする
+	header := Header{Version: Version, Algorithm: opts.Algorithm, CRC: crc.Sum32()}
+	if original.n > 0 {
+		header.OriginalSize = uint64(original.n)
+		header.PayloadSize = 1 + uint64(payload.n)
+		if chunks != nil {
+			header.Version = ChunkedVersion
+			header.ChunkSize = uint64(chunkSize)
+			header.ChunkCRCs = chunks.Sums()
+		}
+	} else {
+		payload.n = 0
+	}
+
+	member := appendHeader(nil, header)
+	if original.n > 0 {
+		member = append(member, version)
+	}
+	if _, err := dst.Write(member); err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(dst, tmp, payload.n); err != nil {
+		return 0, err
+	}
+	return original.n, nil
+}
+
+// compressChunks は src を ChunkSize ごとのメンバーに圧縮し、元のサイズを返します
+// 空の入力でもアルゴリズム名を記録するため、空のメンバーを1つ書き込みます
+// ChunkSize が一度に圧縮できる上限（common.MaxOneShotSize）を超える場合は、上限ごとに区切ります。
+func compressChunks(dst io.Writer, src io.Reader, c common.Compressor, opts FileOptions) (int64, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if limit := common.MaxOneShotSize(); limit > 0 && int64(chunkSize) > limit {
+		chunkSize = int(limit)
+	}
+
+	buf := make([]byte, chunkSize)
+	total := int64(0)
+	for first := true; ; first = false {
+		n, err := io.ReadFull(src, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return total, err
+		}
+		if n == 0 && !first {
+			return total, nil
+		}
+
+		member, err := EncodeMember(opts.Algorithm, c, buf[:n])
+		if err != nil {
+			return total, fmt.Errorf("member at offset %d: %w", total, err)
+		}
+		if _, err := dst.Write(member); err != nil {
+			return total, err
+		}
+		total += int64(n)
+
+		if n < len(buf) {
+			return total, nil
+		}
+	}
+}
+
+// DecompressFile は srcPath を展開して dstPath に書き込みます
+// .tzz コンテナの場合は各メンバーを resolve が返すCompressorで展開してCRC32を確認し、
+// それ以外の入力は opts.Algorithm のCompressorで展開します。Compressorが
+// common.StreamCompressor か common.WriterDecompressor（ブロックコンテナなど）を
+// 実装していれば、展開結果をメモリに保持せずに書き込みます。
+// 展開結果は一時ファイルに書き込みながらCRC32とサイズを確認し、すべてのメンバーの確認が
+// 済んでから dstPath に名前を変更します。途中で失敗した場合は一時ファイルを削除するため、
+// dstPath は作られず、既存のファイルもそのまま残ります。
+// srcPath が "-" の場合は標準入力から読み込みます。
+// 統計の OriginalSize は展開後のサイズ、CompressedSize は入力のサイズです。
+// opts.MaxDepth が2以上の場合は、展開結果がまた .tzz コンテナ（誤って2重に圧縮したファイル）
+// である間、最大 MaxDepth 層まで続けて展開します。展開したコンテナの層の数は統計の Layers に、
+// 最後の展開結果がまだコンテナかは統計の Nested に記録します。
+// opts.TolerateSizeMismatch の場合は、サイズの異なるメンバーがあっても dstPath に書き込み、
+// エラーを返さずに統計の SizeMismatches に記録します。
+// opts.Decompress.OnDamage を指定した場合は、展開できないブロックを埋めて続け（salvage）、
+// 埋めたブロックを統計の Damaged にも記録します。埋めたブロックを含むメンバーのCRC32は
+// 一致しないため確認しません。salvage ではチャンクのチェックサムも確認しません
+// （壊れたチャンクで止めずに続けるためです）。
+func DecompressFile(srcPath, dstPath string, resolve Resolver, opts FileOptions) (common.CompressionStats, error) {
+	start := time.Now()
+	stats := common.CompressionStats{Source: srcPath}
+
+	src, err := openInput(srcPath, opts.Stdin)
+	if err != nil {
+		return stats, err
+	}
+	defer src.Close()
+
+	input := &countingReader{r: common.NewRateLimitedReader(src, opts.RateLimit), progress: opts.Progress}
+	r := bufio.NewReader(input)
+
+	if onDamage := opts.Decompress.OnDamage; onDamage != nil {
+		opts.Decompress.OnDamage = func(d common.DamagedBlock) error {
+			stats.Damaged = append(stats.Damaged, d)
+			return onDamage(d)
+		}
+	}
+
+	var names []string
+	stats.OriginalSize, err = writeOutput(dstPath, opts, func(dst io.Writer) error {
+		var err error
+		names, err = decompressLayers(dst, r, resolve, opts, filepath.Dir(dstPath), &stats)
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	stats.CompressedSize = input.n
+	stats.Algorithm = strings.Join(names, ", ")
+	stats.CalculateRatio()
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// decompressMembers はすべてのメンバーを順に展開して dst に書き込み、使用したアルゴリズム名を返します
+// 出力サイズの上限と予算の扱いは Decompress と同じです。tolerate の場合は展開結果のサイズが
+// 元のサイズと異なるメンバーも書き込み、その不一致を返します（そのメンバーのCRC32は確認しません）。
+func decompressMembers(dst io.Writer, r io.Reader, resolve Resolver, opts common.DecompressOptions, tolerate bool) ([]string, []common.SizeMismatch, error) {
+	var names []string
+	var mismatches []common.SizeMismatch
+	total := int64(0)
+
+	for i := 0; ; i++ {
+		h, _, err := readHeader(r)
+		if err == io.EOF {
+			return names, mismatches, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("member %d: %w", i, err)
+		}
+		if h.PayloadSize > math.MaxInt64 || h.OriginalSize > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("member %d: invalid container: size out of range", i)
+		}
+		if opts.MaxOutputSize > 0 && int64(h.OriginalSize) > opts.MaxOutputSize-total {
+			return nil, nil, fmt.Errorf("member %d: %w: %d bytes exceeds limit of %d bytes",
+				i, common.ErrOutputTooLarge, total+int64(h.OriginalSize), opts.MaxOutputSize)
+		}
+
+		c, err := resolveMember(resolve, h.Algorithm)
+		if err != nil {
+			return nil, nil, fmt.Errorf("member %d: %w", i, err)
+		}
+		if len(names) == 0 || names[len(names)-1] != c.Name() {
+			names = append(names, c.Name())
+		}
+
+		// 展開結果はヘッダーの元のサイズちょうどでなければならない（超える書き込みは拒否する）
+		// tolerate の場合は超える分も書き込み、展開が終わってからサイズを比べる
+		// チャンクのチェックサムがあれば、壊れたチャンクの終わりで展開を止める（salvage では確認しない）
+		crc := crc32.NewIEEE()
+		memberDst := dst
+		var chunks *chunkVerifier
+		if h.ChunkSize > 0 && opts.OnDamage == nil {
+			chunks = newChunkVerifier(dst, h, total)
+			memberDst = chunks
+		}
+		limit := int64(h.OriginalSize)
+		if tolerate {
+			limit = math.MaxInt64
+		}
+		out := common.NewExpectedSizeWriter(io.MultiWriter(memberDst, crc), limit)
+		payload := &io.LimitedReader{R: r, N: int64(h.PayloadSize)}
+
+		// バージョン2以降のペイロードは形式バージョンで始まる
+		if !h.isEmpty() && h.Version != legacyVersion {
+			err = readFormatVersion(payload, c, h)
+		}
+
+		memberOpts, damaged := memberOptions(opts, i, total), false
+		if memberOpts.OnDamage != nil {
+			onDamage := memberOpts.OnDamage
+			memberOpts.OnDamage = func(d common.DamagedBlock) error {
+				damaged = true
+				return onDamage(d)
+			}
+		}
+
+		sc, ok := c.(common.StreamCompressor)
+		wd, toWriter := c.(common.WriterDecompressor)
+		switch {
+		case err != nil, h.isEmpty():
+			// ヘッダーだけのメンバーは展開器に渡さない
+		case ok:
+			err = sc.DecompressStream(payload, out)
+		case toWriter:
+			err = wd.DecompressToWriter(payload, out, memberOpts)
+		default:
+			err = decompressPayload(out, payload, c, memberOpts)
+		}
+
+		// 展開器が読み残したペイロードを読み飛ばし、途中で入力が終わっていないかを確認する
+		// 入力が途切れていれば、それが原因の展開エラーよりも優先して報告する
+		if _, copyErr := io.Copy(io.Discard, payload); copyErr != nil {
+			return nil, nil, fmt.Errorf("member %d: %w", i, copyErr)
+		}
+		if payload.N != 0 {
+			return nil, nil, fmt.Errorf("member %d: %w", i, ErrTruncated)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("member %d: %w", i, err)
+		}
+
+		written := out.Written()
+		total += written
+		if tolerate && written != int64(h.OriginalSize) {
+			// サイズが違えば最後のチャンクとメンバー全体のCRC32も一致しないため確認しない
+			mismatches = append(mismatches, common.SizeMismatch{Member: i, Expected: int64(h.OriginalSize), Actual: written})
+			continue
+		}
+		if !tolerate {
+			if err := out.Close(); err != nil {
+				return nil, nil, fmt.Errorf("member %d: %w", i, err)
+			}
+		}
+		if damaged {
+			// 埋めたブロックの分だけ元のデータと異なるため、CRC32は確認しない
+			continue
+		}
+		if chunks != nil {
+			if err := chunks.Close(); err != nil {
+				return nil, nil, fmt.Errorf("member %d: %w", i, err)
+			}
+		}
+		if sum := crc.Sum32(); sum != h.CRC {
+			return nil, nil, fmt.Errorf("member %d: %w: expected %08x, got %08x", i, ErrChecksum, h.CRC, sum)
+		}
+	}
+}
+
+// readFormatVersion はペイロードの先頭の形式バージョンを読み込み、c で展開できるかを確認します
+func readFormatVersion(payload *io.LimitedReader, c common.Compressor, h Header) error {
+	var version [1]byte
+	if _, err := io.ReadFull(payload, version[:]); err != nil {
+		if payload.N == 0 {
+			return errors.New("invalid container: missing format version")
+		}
+		return err
+	}
+	return common.CheckFormatVersion(h.Algorithm, c, version[0])
+}
+
+// decompressPayload はペイロードの残りをメモリに読み込んで展開し、out に書き込みます
+// opts はこのメンバーに適用する制限です（memberOptions）。
+func decompressPayload(out io.Writer, payload *io.LimitedReader, c common.Compressor, opts common.DecompressOptions) error {
+	data, err := io.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	if payload.N != 0 {
+		return ErrTruncated
+	}
+
+	decompressed, err := common.DecompressWithOptions(c, data, opts)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(decompressed)
+	return err
+}
+
+// memberOptions は total バイトを展開した後の member 番目のメンバーに適用する制限を返します
+// OnDamage に渡す壊れたブロックには、メンバーの番号と展開結果全体の中での位置を設定します。
+func memberOptions(opts common.DecompressOptions, member int, total int64) common.DecompressOptions {
+	if opts.MaxOutputSize > 0 {
+		opts.MaxOutputSize -= total
+	}
+	if onDamage := opts.OnDamage; onDamage != nil {
+		opts.OnDamage = func(d common.DamagedBlock) error {
+			d.Member, d.Offset = member, d.Offset+total
+			return onDamage(d)
+		}
+	}
+	return opts
+}
+
+// decompressRaw はコンテナでない圧縮データを c で展開して dst に書き込みます
+// c が common.StreamCompressor か common.WriterDecompressor を実装していれば、
+// 入力全体をメモリに読み込まずに展開します。
+func decompressRaw(dst io.Writer, r io.Reader, c common.Compressor, opts common.DecompressOptions) error {
+	if sc, ok := c.(common.StreamCompressor); ok {
+		out := &limitWriter{w: dst, limit: opts.MaxOutputSize}
+		if opts.MaxOutputSize <= 0 {
+			out.limit = math.MaxInt64
+		}
+		return sc.DecompressStream(r, out)
+	}
+	if wd, ok := c.(common.WriterDecompressor); ok {
+		return wd.DecompressToWriter(r, dst, opts)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	decompressed, err := common.DecompressWithOptions(c, data, opts)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(decompressed)
+	return err
+}
+
+// openInput は入力ファイルを開きます（"-" の場合は stdin、nil なら os.Stdin）
+func openInput(path string, stdin io.Reader) (io.ReadCloser, error) {
+	if path == "-" {
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(path)
+}
+
+// writeOutput は出力先を確認してから同じディレクトリの一時ファイルに fn で書き込み、
+// 成功した場合だけ path に置き換えます（既存の path の扱いは opts に従います）。
+// 書き込んだバイト数を返します。
+func writeOutput(path string, opts FileOptions, fn func(w io.Writer) error) (int64, error) {
+	writeOpts := fileutil.Options{
+		MkdirAll:       opts.MkdirAll,
+		Overwrite:      opts.Overwrite,
+		SkipExisting:   opts.SkipExisting,
+		VerifyExisting: opts.VerifyExisting,
+	}
+	if err := fileutil.Prepare(path, writeOpts); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	var sparse *sparseWriter
+	bw := bufio.NewWriter(tmp)
+	if opts.Sparse {
+		sparse = &sparseWriter{f: tmp}
+		bw = bufio.NewWriterSize(sparse, sparseBufferSize)
+	}
+	out := &countingWriter{w: bw}
+	if err := fn(out); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	// 末尾の0の領域はシークしただけなので、切り詰めてファイルサイズを確定する
+	if sparse != nil {
+		if err := tmp.Truncate(sparse.size); err != nil {
+			return 0, err
+		}
+	}
+	if err := tmp.Chmod(fileutil.FilePerm); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := fileutil.Commit(tmp.Name(), path, writeOpts); err != nil {
+		return 0, err
+	}
+	committed = true
+	return out.n, nil
+}
+
+// countingWriter は書き込んだバイト数を数えます
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// timedReader は読み込みにかかった時間を common.PhaseRead に記録します
+type timedReader struct {
+	r       io.Reader
+	timings *common.Timings
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	t.timings.Since(common.PhaseRead, start)
+	return n, err
+}
+
+// timedWriter は書き込みにかかった時間を common.PhaseWrite に記録します
+type timedWriter struct {
+	w       io.Writer
+	timings *common.Timings
+}
+
+func (t *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	t.timings.Since(common.PhaseWrite, start)
+	return n, err
+}
+
+// sparseHoleSize はスパースファイルの穴にする0の領域の最小の長さです
+// 多くのファイルシステムのブロックサイズに合わせ、それより短い領域は通常どおり書き込みます
+const sparseHoleSize = 4096
+
+// sparseBufferSize はスパースファイルに書き込むときのバッファサイズです
+const sparseBufferSize = 64 * sparseHoleSize
+
+// sparseWriter は sparseHoleSize バイト以上の0の領域を書き込まずにシークで飛ばします
+type sparseWriter struct {
+	f    *os.File
+	size int64 // 書き込んだ（飛ばした分を含む）バイト数
+}
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		start, length := common.FindZeroRun(p, sparseHoleSize)
+		n, err := s.f.Write(p[:start])
+		written += n
+		s.size += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if length > 0 {
+			if _, err := s.f.Seek(int64(length), io.SeekCurrent); err != nil {
+				return written, err
+			}
+			written += length
+			s.size += int64(length)
+		}
+		p = p[start+length:]
+	}
+	return written, nil
+}
+
+// countingReader は読み込んだバイト数を数え、progress が nil でなければ通知します
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	progress func(int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if n > 0 && c.progress != nil {
+		c.progress(c.n)
+	}
+	return n, err
+}
+
+// limitWriter は limit バイトを超える書き込みを common.ErrOutputTooLarge で拒否します
+type limitWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.limit-l.n {
+		return 0, fmt.Errorf("%w: exceeds limit of %d bytes", common.ErrOutputTooLarge, l.limit)
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,481 @@
+// Package container implements the multi-member .tzz stream format.
+// 各メンバーは自己完結したヘッダー（アルゴリズム名、元のサイズ、ペイロードのサイズ、CRC32）
+// を持つため、メンバーを連結したものもそのまま有効なストリームになります。
+// ログファイルのように、既存の出力の末尾に新しいメンバーを追記していく使い方ができます。
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// メンバーのフォーマット
+//
+//	マジック "TZZ" + バージョン(1バイト) + アルゴリズム名の長さ(1バイト) + アルゴリズム名
+//	+ 元のサイズ(uvarint) + ペイロードのサイズ(uvarint) + CRC32(4バイト, 元のデータ) + ペイロード
+//
+// バージョン2以降のペイロードは、アルゴリズムの形式バージョン(1バイト、common.Versioned)
+// と圧縮データからなります。バージョン1のペイロードは圧縮データだけで、形式バージョン0
+// として展開します。空のデータのメンバーはペイロードを持ちません。
+//
+// バージョン3（ChunkedVersion）のメンバーは、CRC32の後にチャンクのチェックサムを持ちます。
+//
+//	チャンクのサイズ(uvarint) + チャンクごとに CRC32(4バイト, 元のデータのチャンク)
+//
+// 元のデータをチャンクのサイズごとに区切った各チャンク（最後は短くてもよい）のCRC32で、
+// 展開しながら確認するため、大きなメンバーの破損も壊れたチャンクの終わりまでに見つかります。
+const (
+	// Magic は各メンバーの先頭のマジックです
+	Magic = "TZZ"
+
+	// Version は現在のフォーマットのバージョンです（チャンクのチェックサムを持たないメンバー）
+	Version = 2
+
+	// ChunkedVersion はチャンクのチェックサムを持つメンバーのバージョンです
+	ChunkedVersion = 3
+
+	// legacyVersion はペイロードに形式バージョンを持たない、読み込みに対応している最も古いバージョンです
+	legacyVersion = 1
+
+	// maxNameLength はアルゴリズム名の最大長です
+	maxNameLength = 255
+)
+
+func init() {
+	common.RegisterFeature(common.Feature{
+		Name:        "tzz",
+		Description: ".tzz コンテナ",
+		Versions:    []int{legacyVersion, Version, ChunkedVersion},
+	})
+}
+
+var (
+	// ErrTruncated はストリームの末尾に不完全なメンバーがある場合のエラーです
+	ErrTruncated = errors.New("truncated member")
+
+	// ErrVersionMismatch はメンバーのバージョンに対応していない場合のエラーです
+	// 新しすぎるバージョンのエラーは *common.ErrUnsupportedVersion も含みます
+	ErrVersionMismatch = errors.New("container version mismatch")
+
+	// ErrChecksum は展開結果のCRC32がヘッダーの値と一致しない場合のエラーです
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// Header はメンバーのヘッダーです
+type Header struct {
+	Version      byte   // フォーマットのバージョン
+	Algorithm    string // 圧縮アルゴリズムの登録名（common.New で使用する名前）
+	OriginalSize uint64 // 元のデータのサイズ
+	PayloadSize  uint64 // 圧縮データのサイズ
+	CRC          uint32 // 元のデータのCRC32
+
+	// ChunkSize はチャンクのチェックサムを計算する元のデータのバイト数です（ChunkedVersion 以外は0）
+	ChunkSize uint64
+	// ChunkCRCs は元のデータを ChunkSize ごとに区切った各チャンクのCRC32です
+	ChunkCRCs []uint32
+}
+
+// isEmpty は空のデータを表すヘッダーだけのメンバーかを返します
+func (h Header) isEmpty() bool {
+	return h.OriginalSize == 0 && h.PayloadSize == 0
+}
+
+// Member はストリーム中の1つのメンバーです
+type Member struct {
+	Header
+	Offset  int64  // ストリーム中のメンバーの開始位置
+	Payload []byte // ペイロード（バージョン2以降は形式バージョン + 圧縮データ）
+}
+
+// FormatVersion はペイロードに記録されたアルゴリズムの形式バージョンを返します
+// バージョン1のメンバーと空のデータのメンバーでは0を返します
+func (m Member) FormatVersion() byte {
+	if m.Version == legacyVersion || len(m.Payload) == 0 {
+		return 0
+	}
+	return m.Payload[0]
+}
+
+// Body はペイロードから形式バージョンを除いた圧縮データを返します
+func (m Member) Body() []byte {
+	if m.Version == legacyVersion || len(m.Payload) == 0 {
+		return m.Payload
+	}
+	return m.Payload[1:]
+}
+
+// Resolver はアルゴリズムの登録名から展開に使うCompressorを返します
+type Resolver func(name string) (common.Compressor, error)
+
+// EncodeMember は data を c で圧縮し、アルゴリズム名 name を記録したメンバーを作成します
+// name は展開時に Resolver に渡されるため、common.New で使う登録名を指定します
+func EncodeMember(name string, c common.Compressor, data []byte) ([]byte, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	var compressed []byte
+	if len(data) > 0 {
+		var err error
+		if compressed, err = c.Compress(data); err != nil {
+			return nil, err
+		}
+	}
+	return EncodeCompressedMember(name, c, data, compressed)
+}
+
+// EncodeCompressedMember は c で圧縮済みの compressed から、data のメンバーを作成します
+// compressed は c.Compress(data) の結果でなければなりません。圧縮結果を先に確認してから
+// コンテナに書き込む場合（common.CompressWithTarget など）に、圧縮をやり直さずに済みます。
+func EncodeCompressedMember(name string, c common.Compressor, data, compressed []byte) ([]byte, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	// 空のデータはペイロードのないヘッダーだけのメンバーにします
+	var payload []byte
+	if len(data) > 0 {
+		payload = append([]byte{common.FormatVersion(c)}, compressed...)
+	}
+
+	member := make([]byte, 0, maxHeaderSize(name)+len(payload))
+	member = appendHeader(member, Header{
+		Version:      Version,
+		Algorithm:    name,
+		OriginalSize: uint64(len(data)),
+		PayloadSize:  uint64(len(payload)),
+		CRC:          crc32.ChecksumIEEE(data),
+	})
+	return append(member, payload...), nil
+}
+
+// checkName はアルゴリズム名がヘッダーに記録できる長さかを確認します
+func checkName(name string) error {
+	if len(name) == 0 || len(name) > maxNameLength {
+		return fmt.Errorf("invalid algorithm name: %q", name)
+	}
+	return nil
+}
+
+// maxHeaderSize はアルゴリズム名が name のヘッダーの最大のバイト数です
+func maxHeaderSize(name string) int {
+	return len(Magic) + 2 + len(name) + 2*binary.MaxVarintLen64 + 4
+}
+
+// appendHeader はメンバーのヘッダーを dst に追加します
+func appendHeader(dst []byte, h Header) []byte {
+	dst = append(dst, Magic...)
+	dst = append(dst, h.Version, byte(len(h.Algorithm)))
+	dst = append(dst, h.Algorithm...)
+	dst = binary.AppendUvarint(dst, h.OriginalSize)
+	dst = binary.AppendUvarint(dst, h.PayloadSize)
+	dst = binary.BigEndian.AppendUint32(dst, h.CRC)
+	if h.Version >= ChunkedVersion {
+		dst = binary.AppendUvarint(dst, h.ChunkSize)
+		for _, crc := range h.ChunkCRCs {
+			dst = binary.BigEndian.AppendUint32(dst, crc)
+		}
+	}
+	return dst
+}
+
+// IsContainer は data がメンバーのマジックで始まるかを返します
+func IsContainer(data []byte) bool {
+	return len(data) >= len(Magic) && string(data[:len(Magic)]) == Magic
+}
+
+// byteReader は io.Reader から1バイトずつ読み込み、読み込んだバイト数を数えます
+type byteReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(b.r, buf[:]); err != nil {
+		return 0, err
+	}
+	b.n++
+	return buf[0], nil
+}
+
+// readHeader はメンバーのヘッダーを読み込み、ヘッダーのバイト数を返します
+// ストリームの終端（メンバーの境界）では io.EOF を、ヘッダーの途中で終わった場合は ErrTruncated を返します
+func readHeader(r io.Reader) (Header, int64, error) {
+	br := &byteReader{r: r}
+	var h Header
+
+	magic := make([]byte, len(Magic))
+	for i := range magic {
+		b, err := br.ReadByte()
+		if err == io.EOF && i == 0 {
+			return h, 0, io.EOF
+		}
+		if err != nil {
+			return h, br.n, truncated(err)
+		}
+		magic[i] = b
+	}
+	if string(magic) != Magic {
+		return h, br.n, fmt.Errorf("invalid container: bad magic %q", magic)
+	}
+
+	var err error
+	if h.Version, err = br.ReadByte(); err != nil {
+		return h, br.n, truncated(err)
+	}
+	switch {
+	case h.Version > ChunkedVersion:
+		return h, br.n, fmt.Errorf("%w: %w", ErrVersionMismatch,
+			&common.ErrUnsupportedVersion{Format: "container", Have: h.Version, Max: ChunkedVersion})
+	case h.Version < legacyVersion:
+		return h, br.n, fmt.Errorf("%w: found version %d, expected %d to %d", ErrVersionMismatch, h.Version, legacyVersion, ChunkedVersion)
+	}
+
+	nameLength, err := br.ReadByte()
+	if err != nil {
+		return h, br.n, truncated(err)
+	}
+	name := make([]byte, nameLength)
+	for i := range name {
+		if name[i], err = br.ReadByte(); err != nil {
+			return h, br.n, truncated(err)
+		}
+	}
+	h.Algorithm = string(name)
+
+	if h.OriginalSize, err = binary.ReadUvarint(br); err != nil {
+		return h, br.n, truncated(err)
+	}
+	if h.PayloadSize, err = binary.ReadUvarint(br); err != nil {
+		return h, br.n, truncated(err)
+	}
+
+	readCRC := func() (uint32, error) {
+		var crc [4]byte
+		for i := range crc {
+			if crc[i], err = br.ReadByte(); err != nil {
+				return 0, truncated(err)
+			}
+		}
+		return binary.BigEndian.Uint32(crc[:]), nil
+	}
+	if h.CRC, err = readCRC(); err != nil {
+		return h, br.n, err
+	}
+	if h.Version < ChunkedVersion {
+		return h, br.n, nil
+	}
+
+	if h.ChunkSize, err = binary.ReadUvarint(br); err != nil {
+		return h, br.n, truncated(err)
+	}
+	if h.ChunkSize == 0 {
+		return h, br.n, errors.New("invalid container: chunk size is 0")
+	}
+	// チャンクの数は元のサイズから決まる（不正に大きな値でも、読めた分だけ確保する）
+	count := h.OriginalSize/h.ChunkSize + min(h.OriginalSize%h.ChunkSize, 1)
+	h.ChunkCRCs = make([]uint32, 0, min(count, 1<<16))
+	for range count {
+		crc, err := readCRC()
+		if err != nil {
+			return h, br.n, err
+		}
+		h.ChunkCRCs = append(h.ChunkCRCs, crc)
+	}
+	return h, br.n, nil
+}
+
+// truncated はヘッダーの途中で入力が終わったエラーを ErrTruncated に変換します
+func truncated(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return err
+}
+
+// ScanResult はストリームの構造を確認した結果です
+type ScanResult struct {
+	Members   []Header // 完全なメンバーのヘッダー
+	ValidSize int64    // 完全なメンバーだけを含む先頭部分のサイズ
+	Truncated bool     // 末尾に不完全なメンバーがあるか
+}
+
+// Scan はペイロードを読み飛ばしながらストリームのメンバーを確認します
+// 末尾の不完全なメンバーはエラーではなく Truncated として報告します。
+// 対応していないバージョンのメンバーがある場合は ErrVersionMismatch を返します。
+func Scan(r io.ReadSeeker) (ScanResult, error) {
+	var result ScanResult
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return result, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return result, err
+	}
+
+	offset := int64(0)
+	for {
+		h, n, err := readHeader(r)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrTruncated) {
+			result.Truncated = true
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("member %d at offset %d: %w", len(result.Members), offset, err)
+		}
+
+		end := offset + n + int64(h.PayloadSize)
+		if h.PayloadSize > uint64(size) || end > size {
+			result.Truncated = true
+			break
+		}
+		if _, err := r.Seek(end, io.SeekStart); err != nil {
+			return result, err
+		}
+
+		result.Members = append(result.Members, h)
+		offset = end
+		result.ValidSize = end
+	}
+
+	return result, nil
+}
+
+// Parse はストリームのすべてのメンバーを読み込みます
+// 末尾に不完全なメンバーがある場合は ErrTruncated を返します
+func Parse(data []byte) ([]Member, error) {
+	r := bytes.NewReader(data)
+	var members []Member
+
+	offset := int64(0)
+	for {
+		h, n, err := readHeader(r)
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("member %d at offset %d: %w", len(members), offset, err)
+		}
+
+		start := offset + n
+		if h.PayloadSize > uint64(int64(len(data))-start) {
+			return nil, fmt.Errorf("member %d at offset %d: %w", len(members), offset, ErrTruncated)
+		}
+		end := start + int64(h.PayloadSize)
+
+		members = append(members, Member{Header: h, Offset: offset, Payload: data[start:end]})
+		r.Seek(end, io.SeekStart)
+		offset = end
+	}
+}
+
+// Decompress はすべてのメンバーを展開して連結します
+// 各メンバーは resolve が返すCompressorで展開し、CRC32を確認します。
+// opts の出力サイズの上限と予算はストリーム全体に対して適用されます。
+// opts.OnDamage に渡す壊れたブロックの位置は、連結した展開結果の中での位置です。
+func Decompress(data []byte, resolve Resolver, opts common.DecompressOptions) ([]byte, error) {
+	members, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []byte
+	for i, m := range members {
+		total := int64(len(result)) + int64(m.OriginalSize)
+		if opts.MaxOutputSize > 0 && (m.OriginalSize > uint64(opts.MaxOutputSize) || total > opts.MaxOutputSize) {
+			return nil, fmt.Errorf("member %d: %w: %d bytes exceeds limit of %d bytes",
+				i, common.ErrOutputTooLarge, total, opts.MaxOutputSize)
+		}
+
+		// 出力サイズの上限は残りの分だけ各メンバーに適用する
+		decompressed, err := m.Decompress(resolve, memberOptions(opts, i, int64(len(result))))
+		if err != nil {
+			return nil, fmt.Errorf("member %d: %w", i, err)
+		}
+
+		result = append(result, decompressed...)
+	}
+
+	return result, nil
+}
+
+// Decompress はメンバーを resolve が返すCompressorで展開し、サイズとCRC32を確認します
+// opts.OnDamage を指定してブロックを埋めた場合は、サイズだけを確認します（チャンクの
+// チェックサムとCRC32は埋めた分だけ一致しないためです）。
+func (m Member) Decompress(resolve Resolver, opts common.DecompressOptions) ([]byte, error) {
+	c, err := resolveMember(resolve, m.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	damaged := false
+	if onDamage := opts.OnDamage; onDamage != nil {
+		opts.OnDamage = func(d common.DamagedBlock) error {
+			damaged = true
+			return onDamage(d)
+		}
+	}
+
+	var decompressed []byte
+	if !m.isEmpty() {
+		if err := common.CheckFormatVersion(m.Algorithm, c, m.FormatVersion()); err != nil {
+			return nil, err
+		}
+		if decompressed, err = common.DecompressWithOptions(c, m.Body(), opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// 壊れた位置を報告できるように、サイズより先にチャンクのチェックサムを確認する
+	if !damaged {
+		if err := m.verifyChunks(decompressed); err != nil {
+			return nil, err
+		}
+	}
+	if uint64(len(decompressed)) != m.OriginalSize {
+		return nil, fmt.Errorf("invalid container: size mismatch: %w",
+			&common.SizeError{Expected: int64(m.OriginalSize), Actual: int64(len(decompressed))})
+	}
+	if damaged {
+		return decompressed, nil
+	}
+	if crc := crc32.ChecksumIEEE(decompressed); crc != m.CRC {
+		return nil, fmt.Errorf("%w: expected %08x, got %08x", ErrChecksum, m.CRC, crc)
+	}
+	return decompressed, nil
+}
+
+// PrintMembers はメンバーの一覧を表示します
+func PrintMembers(members []Header) {
+	FprintMembers(os.Stdout, members)
+}
+
+// FprintMembers は PrintMembers と同じ内容を w に書き込みます
+func FprintMembers(w io.Writer, members []Header) {
+	fmt.Fprintf(w, "=== メンバー一覧 ===\n")
+	fmt.Fprintf(w, "%6s  %-12s %12s %12s %9s  %s\n", "番号", "アルゴリズム", "元サイズ", "圧縮後", "圧縮率", "CRC32")
+
+	var original, compressed uint64
+	for i, h := range members {
+		ratio := 0.0
+		if h.OriginalSize > 0 {
+			ratio = float64(h.PayloadSize) / float64(h.OriginalSize) * 100
+		}
+		fmt.Fprintf(w, "%6d  %-12s %12d %12d %8.2f%%  %08x\n", i, h.Algorithm, h.OriginalSize, h.PayloadSize, ratio, h.CRC)
+		original += h.OriginalSize
+		compressed += h.PayloadSize
+	}
+	fmt.Fprintf(w, "合計: %d メンバー, %s -> %s\n", len(members),
+		common.FormatBytes(int64(original)), common.FormatBytes(int64(compressed)))
+}
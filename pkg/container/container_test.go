@@ -0,0 +1,1332 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzp"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+	"github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+// appendMember は data をメンバーとして path に追記します
+func appendMember(t *testing.T, path, name string, data []byte) []byte {
+	t.Helper()
+	c, err := common.New(name)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	member, err := EncodeMember(name, c, data)
+	if err != nil {
+		t.Fatalf("EncodeMember failed: %v", err)
+	}
+	if err := AppendFile(path, member, fileutil.Options{}); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	return member
+}
+
+// logLines は i 番目の追記で書き込むログを作成します
+func logLines(i int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("2026-10-16 12:00:%02d INFO request served id=%d\n", i, i)), 20)
+}
+
+func TestAppendFile_ThreeMembers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log.tzz")
+
+	var expected []byte
+	for i, name := range []string{"lz77", "rle", "huffman"} {
+		data := logLines(i)
+		appendMember(t, path, name, data)
+		expected = append(expected, data...)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsContainer(data) {
+		t.Fatal("Expected container magic")
+	}
+
+	members, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(members) != 3 || members[1].Algorithm != "rle" {
+		t.Fatalf("Unexpected members: %+v", members)
+	}
+
+	decompressed, err := Decompress(data, common.New, common.DecompressOptions{})
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(decompressed, expected) {
+		t.Error("Decompressed data differs from the concatenation of the inputs")
+	}
+}
+
+func TestRepairFile_TruncatedFourthMember(t *testing.T) {
+	dir := t.TempDir()
+
+	var expected []byte
+	base := filepath.Join(dir, "base.tzz")
+	for i := 0; i < 3; i++ {
+		appendMember(t, base, "lz77", logLines(i))
+		expected = append(expected, logLines(i)...)
+	}
+	complete, _ := os.ReadFile(base)
+
+	c := lz77.NewCompressor()
+	fourth, err := EncodeMember("lz77", c, logLines(3))
+	if err != nil {
+		t.Fatalf("EncodeMember failed: %v", err)
+	}
+
+	// ヘッダーの途中、ペイロードの途中、最後の1バイト前で切れた場合
+	for _, cut := range []int{1, 5, len(fourth) / 2, len(fourth) - 1} {
+		path := filepath.Join(dir, fmt.Sprintf("crash-%d.tzz", cut))
+		os.WriteFile(path, append(bytes.Clone(complete), fourth[:cut]...), fileutil.FilePerm)
+
+		// 不完全なメンバーの後ろには追記できない
+		if err := AppendFile(path, fourth, fileutil.Options{}); !errors.Is(err, ErrTruncated) {
+			t.Fatalf("cut %d: expected ErrTruncated on append, got %v", cut, err)
+		}
+
+		result, removed, err := RepairFile(path)
+		if err != nil {
+			t.Fatalf("cut %d: RepairFile failed: %v", cut, err)
+		}
+		if removed != int64(cut) || len(result.Members) != 3 {
+			t.Errorf("cut %d: removed %d bytes, %d members remain", cut, removed, len(result.Members))
+		}
+
+		repaired, _ := os.ReadFile(path)
+		decompressed, err := Decompress(repaired, common.New, common.DecompressOptions{})
+		if err != nil {
+			t.Fatalf("cut %d: Decompress after repair failed: %v", cut, err)
+		}
+		if !bytes.Equal(decompressed, expected) {
+			t.Errorf("cut %d: data mismatch after repair", cut)
+		}
+
+		// 修復後は再び追記できる
+		if err := AppendFile(path, fourth, fileutil.Options{}); err != nil {
+			t.Errorf("cut %d: append after repair failed: %v", cut, err)
+		}
+	}
+
+	// 完全なファイルは変更しない
+	if _, removed, err := RepairFile(base); err != nil || removed != 0 {
+		t.Errorf("Expected no repair for complete file, removed %d (err %v)", removed, err)
+	}
+}
+
+func TestAppendFile_VersionMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.tzz")
+	member, err := EncodeMember("rle", lz77.NewCompressor(), []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	member[len(Magic)] = ChunkedVersion + 1
+	os.WriteFile(path, member, fileutil.FilePerm)
+
+	err = AppendFile(path, member, fileutil.Options{})
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+	var unsupported *common.ErrUnsupportedVersion
+	if !errors.As(err, &unsupported) || unsupported.Have != ChunkedVersion+1 || unsupported.Max != ChunkedVersion {
+		t.Errorf("Expected ErrUnsupportedVersion for a newer container, got %v", err)
+	}
+}
+
+// legacyMember はバージョン1の（ペイロードに形式バージョンを持たない）メンバーを作成します
+func legacyMember(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	payload, err := mustNew(t, name).Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	member := appendHeader(nil, Header{
+		Version:      legacyVersion,
+		Algorithm:    name,
+		OriginalSize: uint64(len(data)),
+		PayloadSize:  uint64(len(payload)),
+		CRC:          crc32.ChecksumIEEE(data),
+	})
+	return append(member, payload...)
+}
+
+func TestDecompress_LegacyVersion(t *testing.T) {
+	dir := t.TempDir()
+	data := logLines(5)
+
+	// RLE はストリームで、LZ77 はメモリ上で展開される
+	for _, name := range []string{"rle", "lz77"} {
+		legacy := legacyMember(t, name, data)
+		current, _ := EncodeMember(name, mustNew(t, name), data)
+		stream := append(legacy, current...)
+
+		decompressed, err := Decompress(stream, common.New, common.DecompressOptions{})
+		if err != nil || !bytes.Equal(decompressed, append(bytes.Clone(data), data...)) {
+			t.Errorf("%s: Decompress failed for mixed versions: %v", name, err)
+		}
+
+		src := filepath.Join(dir, name+".tzz")
+		out := filepath.Join(dir, name+".out")
+		os.WriteFile(src, stream, fileutil.FilePerm)
+		if _, err := DecompressFile(src, out, common.New, FileOptions{}); err != nil {
+			t.Errorf("%s: DecompressFile failed for mixed versions: %v", name, err)
+		}
+	}
+}
+
+func TestDecompress_FutureFormatVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range common.Names() {
+		c := mustNew(t, name)
+		member, err := EncodeMember(name, c, logLines(1))
+		if err != nil {
+			t.Fatalf("%s: EncodeMember failed: %v", name, err)
+		}
+
+		// ペイロードの先頭の形式バージョンを、対応しているバージョンの次にする
+		members, _ := Parse(member)
+		if got := members[0].FormatVersion(); got != common.FormatVersion(c) {
+			t.Errorf("%s: expected format version %d, got %d", name, common.FormatVersion(c), got)
+		}
+		member[len(member)-len(members[0].Payload)] = common.FormatVersion(c) + 1
+
+		check := func(how string, err error) {
+			var unsupported *common.ErrUnsupportedVersion
+			if !errors.As(err, &unsupported) {
+				t.Errorf("%s: %s: expected ErrUnsupportedVersion, got %v", name, how, err)
+				return
+			}
+			if unsupported.Format != name || unsupported.Have != common.FormatVersion(c)+1 || unsupported.Max != common.FormatVersion(c) {
+				t.Errorf("%s: %s: unexpected error %+v", name, how, unsupported)
+			}
+			if errors.Is(err, common.ErrInvalidData) {
+				t.Errorf("%s: %s: future version reported as corruption: %v", name, how, err)
+			}
+		}
+
+		_, err = Decompress(member, common.New, common.DecompressOptions{})
+		check("Decompress", err)
+
+		src := filepath.Join(dir, name+".tzz")
+		os.WriteFile(src, member, fileutil.FilePerm)
+		_, err = DecompressFile(src, filepath.Join(dir, name+".out"), common.New, FileOptions{})
+		check("DecompressFile", err)
+	}
+}
+
+// mustNew は登録名 name のCompressorを作成します
+func mustNew(t *testing.T, name string) common.Compressor {
+	t.Helper()
+	c, err := common.New(name)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c
+}
+
+func TestDecompress_Errors(t *testing.T) {
+	member, err := EncodeMember("lz77", lz77.NewCompressor(), []byte("hello hello hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decompress(member[:len(member)-1], common.New, common.DecompressOptions{}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+	if _, err := Decompress([]byte("XYZ\x01"), common.New, common.DecompressOptions{}); err == nil {
+		t.Error("Expected error for bad magic")
+	}
+	if _, err := Decompress(member, common.New, common.DecompressOptions{MaxOutputSize: 4}); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+
+	unknown, _ := EncodeMember("no-such", lz77.NewCompressor(), []byte("x"))
+	if _, err := Decompress(unknown, common.New, common.DecompressOptions{}); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+
+	// CRC32を壊すと検出される
+	_, n, _ := readHeader(bytes.NewReader(member))
+	crcCorrupted := bytes.Clone(member)
+	crcCorrupted[n-1] ^= 0xFF
+	if _, err := Decompress(crcCorrupted, common.New, common.DecompressOptions{}); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+}
+
+// compressFileRoundTrip は src を CompressFile と DecompressFile で往復させ、統計と内容を確認します
+func compressFileRoundTrip(t *testing.T, name string, data []byte, chunkSize int) ScanResult {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "input.bin")
+	dst := filepath.Join(dir, "input.bin.tzz")
+	out := filepath.Join(dir, "output.bin")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := common.New(name)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	opts := FileOptions{Algorithm: name, ChunkSize: chunkSize}
+
+	stats, err := CompressFile(src, dst, c, opts)
+	if err != nil {
+		t.Fatalf("%s: CompressFile failed: %v", name, err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.OriginalSize != int64(len(data)) || stats.CompressedSize != info.Size() {
+		t.Errorf("%s: expected %d -> %d bytes, got %d -> %d", name, len(data), info.Size(), stats.OriginalSize, stats.CompressedSize)
+	}
+	if stats.Algorithm != c.Name() || stats.Duration <= 0 {
+		t.Errorf("%s: unexpected stats %+v", name, stats)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	result, err := Scan(f)
+	if err != nil || result.Truncated {
+		t.Fatalf("%s: Scan failed: %v (truncated=%v)", name, err, result.Truncated)
+	}
+
+	stats, err = DecompressFile(dst, out, common.New, opts)
+	if err != nil {
+		t.Fatalf("%s: DecompressFile failed: %v", name, err)
+	}
+	if stats.OriginalSize != int64(len(data)) || stats.CompressedSize != info.Size() {
+		t.Errorf("%s: expected %d -> %d bytes, got %d -> %d", name, info.Size(), len(data), stats.CompressedSize, stats.OriginalSize)
+	}
+	decompressed, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Errorf("%s: data mismatch", name)
+	}
+	return result
+}
+
+func TestCompressFile_RoundTrip(t *testing.T) {
+	const chunkSize = 4096
+	data := bytes.Repeat(logLines(1), 10) // 約10KB
+
+	// StreamCompressor (RLE) は入力全体が1メンバー、それ以外はチャンクごとのメンバー
+	if result := compressFileRoundTrip(t, "rle", data, chunkSize); len(result.Members) != 1 {
+		t.Errorf("rle: expected 1 member, got %d", len(result.Members))
+	}
+	expected := (len(data) + chunkSize - 1) / chunkSize
+	for _, name := range []string{"lz77", "huffman"} {
+		if result := compressFileRoundTrip(t, name, data, chunkSize); len(result.Members) != expected {
+			t.Errorf("%s: expected %d members, got %d", name, expected, len(result.Members))
+		}
+	}
+}
+
+func TestCompressFile_OneShotLimit(t *testing.T) {
+	defer common.SetMaxOneShotSize(common.SetMaxOneShotSize(3000))
+	data := bytes.Repeat(logLines(1), 10)
+
+	// チャンクは一度に圧縮できる上限ごとに区切り、上限を超える入力もエラーにしない
+	result := compressFileRoundTrip(t, "lz77", data, 0)
+	if want := (len(data) + 2999) / 3000; len(result.Members) != want {
+		t.Errorf("Expected %d members, got %d", want, len(result.Members))
+	}
+}
+
+func TestCompressFile_Empty(t *testing.T) {
+	for _, name := range []string{"rle", "lz77"} {
+		result := compressFileRoundTrip(t, name, nil, 0)
+		if len(result.Members) != 1 || result.Members[0].OriginalSize != 0 || result.Members[0].Algorithm != name {
+			t.Errorf("%s: expected a single empty member, got %+v", name, result.Members)
+		}
+		// 空の入力はペイロードのないヘッダーだけのメンバーになる
+		if len(result.Members) == 1 && result.Members[0].PayloadSize != 0 {
+			t.Errorf("%s: expected a header-only member, got payload of %d bytes", name, result.Members[0].PayloadSize)
+		}
+	}
+
+	c, _ := common.New("huffman")
+	member, err := EncodeMember("huffman", c, nil)
+	if err != nil {
+		t.Fatalf("EncodeMember failed: %v", err)
+	}
+	if want := len(Magic) + 2 + len("huffman") + 2 + 4; len(member) != want {
+		t.Errorf("Expected %d-byte header-only member, got %d bytes", want, len(member))
+	}
+	decompressed, err := Decompress(member, common.New, common.DecompressOptions{})
+	if err != nil || len(decompressed) != 0 {
+		t.Errorf("Expected empty output, got %v, %v", decompressed, err)
+	}
+}
+
+func TestCompressFile_Progress(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "input.log")
+	data := bytes.Repeat(logLines(1), 10)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 進捗は読み込んだ入力のバイト数で、増え続けて入力のサイズで終わる
+	var reports []int64
+	opts := FileOptions{Algorithm: "lz77", ChunkSize: 4096, Progress: func(n int64) { reports = append(reports, n) }}
+	c, _ := common.New("lz77")
+	if _, err := CompressFile(src, filepath.Join(dir, "out.tzz"), c, opts); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	assertProgress(t, "compress", reports, int64(len(data)))
+	if len(reports) < 2 {
+		t.Errorf("compress: expected a report per chunk, got %v", reports)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "out.tzz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports = nil
+	if _, err := DecompressFile(filepath.Join(dir, "out.tzz"), filepath.Join(dir, "out.log"), common.New, opts); err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	assertProgress(t, "decompress", reports, info.Size())
+}
+
+func TestCompressFile_Timings(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "input.log")
+	if err := os.WriteFile(src, bytes.Repeat(logLines(1), 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"rle", "lz77"} {
+		c, _ := common.New(name)
+		stats, err := CompressFile(src, filepath.Join(dir, name+".tzz"), c, FileOptions{Algorithm: name, ChunkSize: 4096})
+		if err != nil {
+			t.Fatalf("%s: CompressFile failed: %v", name, err)
+		}
+
+		// 読み込み・圧縮・書き込みの合計は全体の処理時間と同じ
+		timings := stats.Timings
+		sum := timings.Get(common.PhaseRead) + timings.Get(common.PhaseCompress) + timings.Get(common.PhaseWrite)
+		if sum != stats.Duration || timings.Get(common.PhaseCompress) < 0 {
+			t.Errorf("%s: Expected phases %v to sum to %v, got %v", name, timings.Phases(), stats.Duration, sum)
+		}
+	}
+
+	// common.Timed のアルゴリズムはフェーズの内訳も記録する
+	c, _ := common.New("lz77")
+	stats, _ := CompressFile(src, filepath.Join(dir, "lz77.tzz"), c, FileOptions{Algorithm: "lz77", Overwrite: true})
+	if phases := stats.Timings.Phases(); !slices.Contains(phases, lz77.PhaseMatch) || !slices.Contains(phases, lz77.PhaseSerialize) {
+		t.Errorf("Expected LZ77 phases, got %v", phases)
+	}
+}
+
+// assertProgress は進捗の通知が単調に増えて total で終わることを確認します
+func assertProgress(t *testing.T, name string, reports []int64, total int64) {
+	t.Helper()
+	if len(reports) == 0 {
+		t.Fatalf("%s: expected progress reports", name)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] <= reports[i-1] {
+			t.Errorf("%s: progress went from %d to %d", name, reports[i-1], reports[i])
+		}
+	}
+	if last := reports[len(reports)-1]; last != total {
+		t.Errorf("%s: expected final progress %d, got %d", name, total, last)
+	}
+}
+
+func TestDecompressFile_RawInput(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "raw.lz")
+	out := filepath.Join(dir, "raw.out")
+
+	data := logLines(3)
+	compressed, _ := lz77.NewCompressor().Compress(data)
+	if err := os.WriteFile(src, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// コンテナでない入力はアルゴリズムの指定が必要
+	if _, err := DecompressFile(src, out, common.New, FileOptions{}); err == nil {
+		t.Error("Expected error without algorithm")
+	}
+
+	stats, err := DecompressFile(src, out, common.New, FileOptions{Algorithm: "lz77"})
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	decompressed, _ := os.ReadFile(out)
+	if !bytes.Equal(decompressed, data) || stats.OriginalSize != int64(len(data)) {
+		t.Errorf("Raw round trip failed: %+v", stats)
+	}
+}
+
+// nestedFixture は data を algorithms の順に CompressFile で重ねて圧縮した、入れ子のコンテナを作成します
+// 最後に作成したファイル（最も外側の層）のパスを返します。
+func nestedFixture(t *testing.T, dir string, data []byte, algorithms ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, "layer0")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range algorithms {
+		next := filepath.Join(dir, fmt.Sprintf("layer%d", i+1))
+		if _, err := CompressFile(path, next, mustNew(t, name), FileOptions{Algorithm: name, Nested: NestedCompress}); err != nil {
+			t.Fatalf("Layer %d (%s): CompressFile failed: %v", i+1, name, err)
+		}
+		path = next
+	}
+	return path
+}
+
+func TestCompressFile_Nested(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat(logLines(1), 10)
+	once := nestedFixture(t, dir, data, "lz77")
+	compressed, _ := os.ReadFile(once)
+
+	// 誤って2重に圧縮すると、圧縮せずに入れ子のメンバーとして格納する
+	twice := filepath.Join(dir, "twice.tzz")
+	stats, err := CompressFile(once, twice, mustNew(t, "lz77"), FileOptions{Algorithm: "lz77"})
+	if err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	if !stats.Nested || stats.Algorithm != common.StoredAlgorithm || stats.OriginalSize != int64(len(compressed)) {
+		t.Errorf("Expected the container to be stored as nested, got %+v", stats)
+	}
+	stored, _ := os.ReadFile(twice)
+	members := mustParse(t, stored)
+	if len(members) != 1 || members[0].Algorithm != NestedAlgorithm || !bytes.Equal(members[0].Body(), compressed) {
+		t.Errorf("Expected a single nested member holding the container, got %+v", members)
+	}
+
+	// 1層だけ展開すると元のコンテナに戻り、まだコンテナであることを知らせる
+	out := filepath.Join(dir, "out")
+	stats, err = DecompressFile(twice, out, common.New, FileOptions{})
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, compressed) || !stats.Nested || stats.Layers != 1 {
+		t.Errorf("Expected the inner container back and Nested, got %+v", stats)
+	}
+
+	// 明示した場合は圧縮し、拒否する場合は何も書き込まない
+	stats, err = CompressFile(once, filepath.Join(dir, "recompressed.tzz"), mustNew(t, "huffman"), FileOptions{Algorithm: "huffman", Nested: NestedCompress})
+	if err != nil || stats.Nested || stats.Algorithm != mustNew(t, "huffman").Name() {
+		t.Errorf("Expected the container to be compressed again, got %+v, %v", stats, err)
+	}
+	rejected := filepath.Join(dir, "rejected.tzz")
+	if _, err := CompressFile(once, rejected, mustNew(t, "lz77"), FileOptions{Algorithm: "lz77", Nested: NestedReject}); !errors.Is(err, ErrNested) {
+		t.Errorf("Expected ErrNested, got %v", err)
+	}
+	if _, err := os.Stat(rejected); !os.IsNotExist(err) {
+		t.Errorf("Expected no output for a rejected input, got %v", err)
+	}
+
+	// マジックで始まるだけのテキストはコンテナとみなさない
+	text := filepath.Join(dir, "tzz.txt")
+	if err := os.WriteFile(text, []byte("TZZ is the extension of the container"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := CompressFile(text, text+".tzz", mustNew(t, "lz77"), FileOptions{Algorithm: "lz77"}); err != nil || stats.Nested {
+		t.Errorf("Expected text starting with the magic to be compressed, got %+v, %v", stats, err)
+	}
+}
+
+func TestDecompressFile_Recursive(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat(logLines(2), 5)
+	fixture := nestedFixture(t, dir, data, "lz77", "huffman", "rle")
+
+	out := filepath.Join(dir, "out")
+	stats, err := DecompressFile(fixture, out, common.New, FileOptions{MaxDepth: DefaultMaxDepth})
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, data) {
+		t.Error("Expected all 3 layers to be unwrapped")
+	}
+	if stats.Layers != 3 || stats.Nested || stats.OriginalSize != int64(len(data)) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	want := strings.Join([]string{mustNew(t, "rle").Name(), mustNew(t, "huffman").Name(), mustNew(t, "lz77").Name()}, ", ")
+	if stats.Algorithm != want {
+		t.Errorf("Expected algorithms %q from the outside in, got %q", want, stats.Algorithm)
+	}
+
+	// 最大の深さで止めた場合は、残りの層を展開せずにまだコンテナであることを知らせる
+	inner, _ := os.ReadFile(filepath.Join(dir, "layer1"))
+	stats, err = DecompressFile(fixture, out, common.New, FileOptions{MaxDepth: 2, Overwrite: true})
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, inner) || stats.Layers != 2 || !stats.Nested {
+		t.Errorf("Expected to stop after 2 layers, got %+v", stats)
+	}
+
+	// 入れ子でないファイルは -recursive でも1層だけ展開する
+	stats, err = DecompressFile(filepath.Join(dir, "layer1"), out, common.New, FileOptions{MaxDepth: DefaultMaxDepth, Overwrite: true})
+	if got, _ := os.ReadFile(out); err != nil || !bytes.Equal(got, data) || stats.Layers != 1 || stats.Nested {
+		t.Errorf("Expected a single layer, got %+v, %v", stats, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 5 {
+		t.Errorf("Expected temporary layers to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestDecompressFile_Sparse(t *testing.T) {
+	size := 100 << 20
+	if testing.Short() {
+		size = 4 << 20
+	}
+	// 1MBごとに短いテキストがあり、残りと末尾は0のデータ
+	data := make([]byte, size)
+	for offset := 0; offset < size; offset += 1 << 20 {
+		copy(data[offset:], "tinyzipzap sparse record\n")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// CLIと同じく、-algo のメンバーはブロックコンテナ（0の領域を圧縮しない）で展開する
+	c := blocks.NewCompressor(rle.NewCompressor(), blocks.DefaultBlockSize, true)
+	resolve := func(string) (common.Compressor, error) { return c, nil }
+	opts := FileOptions{Algorithm: "rle"}
+	if _, err := CompressFile(src, filepath.Join(dir, "disk.tzz"), c, opts); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+
+	opts.Sparse = true
+	dst := filepath.Join(dir, "restored.img")
+	stats, err := DecompressFile(filepath.Join(dir, "disk.tzz"), dst, resolve, opts)
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	if stats.OriginalSize != int64(size) {
+		t.Errorf("Expected %d bytes written, got %d", size, stats.OriginalSize)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(size) {
+		t.Errorf("Expected file size %d, got %d", size, info.Size())
+	}
+	restored, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Error("Sparse output does not match the original")
+	}
+}
+
+func TestDecompressFile_FailureKeepsNoOutput(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.tzz")
+	out := filepath.Join(dir, "out.bin")
+
+	c, _ := common.New("rle")
+	member, _ := EncodeMember("rle", c, logLines(4))
+	corrupted := append([]byte(nil), member...)
+	corrupted[len(corrupted)-2] ^= 0x01 // 最後のランの値を変える
+	if err := os.WriteFile(src, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecompressFile(src, out, common.New, FileOptions{}); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+
+	// 出力上限はストリーム展開でも適用される
+	if err := os.WriteFile(src, member, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := FileOptions{Decompress: common.DecompressOptions{MaxOutputSize: 10}}
+	if _, err := DecompressFile(src, out, common.New, opts); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+
+	// 途中で切れたメンバー
+	if err := os.WriteFile(src, member[:len(member)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecompressFile(src, out, common.New, FileOptions{}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+
+	// 失敗した場合は出力ファイルも一時ファイルも残らない
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the input file, got %v", entries)
+	}
+}
+
+func TestDecompressFile_DeclaredSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.tzz")
+	data := logLines(5)
+
+	// ヘッダーの元のサイズだけを変えたメンバー（RLEはストリームで、LZ77はメモリ上で展開する）
+	for _, name := range []string{"rle", "lz77"} {
+		member, _ := EncodeMember(name, mustNew(t, name), data)
+		members, err := Parse(member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, declared := range []int64{int64(len(data)) - 7, int64(len(data)) + 7} {
+			h := members[0].Header
+			h.OriginalSize = uint64(declared)
+			if err := os.WriteFile(src, append(appendHeader(nil, h), members[0].Payload...), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := DecompressFile(src, filepath.Join(dir, "out.bin"), common.New, FileOptions{})
+			var sizeErr *common.SizeError
+			if !errors.Is(err, common.ErrCorrupted) || !errors.As(err, &sizeErr) {
+				t.Fatalf("%s (declared %d): expected ErrCorrupted, got %v", name, declared, err)
+			}
+			// 短い場合は実際のサイズ、長い場合は超えた時点までに書き込もうとしたサイズ
+			if sizeErr.Expected != declared || declared < int64(len(data)) && sizeErr.Actual <= declared ||
+				declared > int64(len(data)) && sizeErr.Actual != int64(len(data)) {
+				t.Errorf("%s (declared %d): unexpected counts %+v", name, declared, *sizeErr)
+			}
+			if !strings.HasPrefix(err.Error(), "member 0: corrupted data: expected ") {
+				t.Errorf("%s: unexpected message %q", name, err)
+			}
+		}
+	}
+}
+
+// mismatchedMember は data のヘッダーに、data を切り詰めたか伸ばしたデータ payload のペイロードを
+// 持つメンバーを作成します（展開器は正しく展開できるが、元のサイズと一致しない）
+func mismatchedMember(t *testing.T, name string, data, payload []byte) []byte {
+	t.Helper()
+	header, err := EncodeMember(name, mustNew(t, name), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := EncodeMember(name, mustNew(t, name), payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, p := mustParse(t, header)[0].Header, mustParse(t, body)[0].Payload
+	h.PayloadSize = uint64(len(p))
+	return append(appendHeader(nil, h), p...)
+}
+
+// mustParse は Parse に失敗したらテストを止めます
+func mustParse(t *testing.T, data []byte) []Member {
+	t.Helper()
+	members, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return members
+}
+
+func TestDecompress_SizeMismatchPolicy(t *testing.T) {
+	dir := t.TempDir()
+	data := logLines(7)
+	payloads := map[string][]byte{
+		"truncated": data[:len(data)-37],
+		"padded":    append(slices.Clone(data), logLines(8)[:41]...),
+	}
+	good, _ := EncodeMember("rle", rle.NewCompressor(), logLines(9))
+
+	for _, name := range common.Names() {
+		for kind, payload := range payloads {
+			// 2番目のメンバーが壊れていても、前後のメンバーは確認して展開する
+			stream := slices.Concat(good, mismatchedMember(t, name, data, payload), good)
+			want := slices.Concat(logLines(9), payload, logLines(9))
+			delta := int64(len(payload) - len(data))
+
+			// デフォルトは元のサイズと展開結果のサイズを含むエラー
+			var sizeErr *common.SizeError
+			if _, err := Decompress(stream, common.New, common.DecompressOptions{}); !errors.As(err, &sizeErr) {
+				t.Errorf("%s/%s: Decompress expected a SizeError, got %v", name, kind, err)
+			}
+			src := filepath.Join(dir, name+"-"+kind+".tzz")
+			if err := os.WriteFile(src, stream, 0644); err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(dir, name+"-"+kind+".out")
+			if _, err := DecompressFile(src, out, common.New, FileOptions{}); !errors.As(err, &sizeErr) || sizeErr.Expected != int64(len(data)) {
+				t.Errorf("%s/%s: DecompressFile expected a SizeError for %d bytes, got %v", name, kind, len(data), err)
+			}
+			if _, err := os.Stat(out); !os.IsNotExist(err) {
+				t.Errorf("%s/%s: output was written despite the error", name, kind)
+			}
+			if _, err := SafeDecompressStream(bytes.NewReader(stream), io.Discard, common.New, common.SafetyPolicy{}); !errors.As(err, &sizeErr) {
+				t.Errorf("%s/%s: SafeDecompressStream expected a SizeError, got %v", name, kind, err)
+			}
+
+			// 許容する場合は展開できた分を出力し、差を統計に記録する
+			wantMismatch := []common.SizeMismatch{{Member: 1, Expected: int64(len(data)), Actual: int64(len(payload))}}
+			stats, err := DecompressFile(src, out, common.New, FileOptions{TolerateSizeMismatch: true})
+			if err != nil {
+				t.Fatalf("%s/%s: DecompressFile failed: %v", name, kind, err)
+			}
+			if got, _ := os.ReadFile(out); !bytes.Equal(got, want) {
+				t.Errorf("%s/%s: DecompressFile did not write the recovered data", name, kind)
+			}
+			if !slices.Equal(stats.SizeMismatches, wantMismatch) || !stats.Recovered() || stats.SizeMismatches[0].Delta() != delta {
+				t.Errorf("%s/%s: DecompressFile mismatches = %v, want %v", name, kind, stats.SizeMismatches, wantMismatch)
+			}
+
+			var dst bytes.Buffer
+			stats, err = SafeDecompressStream(bytes.NewReader(stream), &dst, common.New, common.SafetyPolicy{TolerateSizeMismatch: true})
+			if err != nil || !bytes.Equal(dst.Bytes(), want) {
+				t.Fatalf("%s/%s: SafeDecompressStream did not recover the data (err %v)", name, kind, err)
+			}
+			if !slices.Equal(stats.SizeMismatches, wantMismatch) {
+				t.Errorf("%s/%s: SafeDecompressStream mismatches = %v, want %v", name, kind, stats.SizeMismatches, wantMismatch)
+			}
+		}
+	}
+}
+
+func TestDecompress_SalvageOffsets(t *testing.T) {
+	const blockSize = 256
+	bc := blocks.NewCompressor(rle.NewCompressor(), blockSize, false)
+	resolve := func(string) (common.Compressor, error) { return bc, nil }
+	first, second := logLines(5), logLines(6)
+	memberA, _ := EncodeMember("rle", bc, first)
+	memberB, err := EncodeMember("rle", bc, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2番目のメンバーの2番目のブロック（番号1）のペイロードを壊す
+	m, err := Parse(memberB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, _ := blocks.Inspect(m[0].Body())
+	pos := bytes.Index(memberB, m[0].Body()) + 4
+	for _, info := range infos[:2] {
+		pos += 1 + len(binary.AppendUvarint(nil, uint64(info.OriginalSize))) + len(binary.AppendUvarint(nil, uint64(info.PayloadSize)))
+		if info.Index == 1 {
+			copy(memberB[pos:pos+info.PayloadSize], bytes.Repeat([]byte{0xff}, info.PayloadSize))
+		}
+		pos += info.PayloadSize
+	}
+	stream := slices.Concat(memberA, memberB)
+	want := []common.DamagedBlock{{Member: 1, Block: 1, Offset: int64(len(first) + blockSize), Length: blockSize}}
+	check := func(name string, got []byte, damaged []common.DamagedBlock) {
+		t.Helper()
+		if len(damaged) != 1 || damaged[0].Reason == "" {
+			t.Fatalf("%s: damaged = %v, want %v", name, damaged, want)
+		}
+		damaged[0].Reason = ""
+		if damaged[0] != want[0] {
+			t.Errorf("%s: damaged = %+v, want %+v", name, damaged[0], want[0])
+		}
+		wantData := slices.Concat(first, second)
+		clear(wantData[want[0].Offset:want[0].End()])
+		if !bytes.Equal(got, wantData) {
+			t.Errorf("%s: output differs outside the damaged block", name)
+		}
+	}
+
+	if _, err := Decompress(stream, resolve, common.DecompressOptions{}); err == nil {
+		t.Fatal("Expected an error without OnDamage")
+	}
+	var damaged []common.DamagedBlock
+	onDamage := func(d common.DamagedBlock) error { damaged = append(damaged, d); return nil }
+	got, err := Decompress(stream, resolve, common.DecompressOptions{OnDamage: onDamage})
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	check("Decompress", got, damaged)
+
+	src := filepath.Join(t.TempDir(), "damaged.tzz")
+	if err := os.WriteFile(src, stream, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := src + ".out"
+	damaged = nil
+	stats, err := DecompressFile(src, out, resolve, FileOptions{Decompress: common.DecompressOptions{OnDamage: onDamage}})
+	if err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	got, _ = os.ReadFile(out)
+	check("DecompressFile", got, damaged)
+	if len(stats.Damaged) != 1 || !stats.Recovered() {
+		t.Errorf("Expected the damaged block in the stats, got %v", stats.Damaged)
+	}
+}
+
+// TestGzipMember は標準ライブラリの gzip で圧縮したメンバーを、メモリ上とストリームの両方で展開できることを確認します
+func TestGzipMember(t *testing.T) {
+	dir := t.TempDir()
+	data := logLines(200)
+
+	// メモリ上: EncodeMember で作成したメンバーの連結
+	member, err := EncodeMember("gzip", stdcompat.NewGzip(stdcompat.WithLevel(9)), data)
+	if err != nil {
+		t.Fatalf("EncodeMember failed: %v", err)
+	}
+	members, err := Parse(member)
+	if err != nil || members[0].Algorithm != "gzip" {
+		t.Fatalf("Expected a gzip member, got %+v, %v", members, err)
+	}
+	decoded, err := Decompress(append(member, member...), common.New, common.DecompressOptions{})
+	if err != nil || !bytes.Equal(decoded, append(append([]byte(nil), data...), data...)) {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+
+	// ストリーム: CompressFile は StreamCompressor として1メンバーに圧縮する
+	src := filepath.Join(dir, "log.txt")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	gz, _ := common.New("gzip")
+	tzz := filepath.Join(dir, "log.tzz")
+	if _, err := CompressFile(src, tzz, gz, FileOptions{Algorithm: "gzip"}); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "log.out")
+	if _, err := DecompressFile(tzz, out, common.New, FileOptions{}); err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, data) {
+		t.Error("Round trip through a gzip .tzz file mismatch")
+	}
+}
+
+// TestDecompressFile_CorruptedNearEndWritesNothing は数MBのコンテナの末尾付近の1ビットを
+// 反転させると、それより前の展開結果を書き込んだ後でも出力ファイルが作られず、既存の
+// ファイルも置き換えられないことを確認します
+func TestDecompressFile_CorruptedNearEndWritesNothing(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 3<<20; i++ {
+		fmt.Fprintf(&buf, "2026-10-16 id=%07d %s\n", i, strings.Repeat("-", 40))
+	}
+	data := buf.Bytes()
+
+	// rle は1メンバーのストリーム、huffman は ChunkSize ごとの複数のメンバーになる
+	for _, name := range []string{"rle", "huffman"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "in.bin")
+			tzz := filepath.Join(dir, "in.tzz")
+			if err := os.WriteFile(src, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			c, _ := common.New(name)
+			if _, err := CompressFile(src, tzz, c, FileOptions{Algorithm: name}); err != nil {
+				t.Fatalf("CompressFile failed: %v", err)
+			}
+			compressed, _ := os.ReadFile(tzz)
+			members, _ := Parse(compressed)
+			if name == "huffman" && len(members) < 3 {
+				t.Fatalf("Expected several members, got %d", len(members))
+			}
+			compressed[len(compressed)-10] ^= 0x10
+			if err := os.WriteFile(tzz, compressed, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, "out.bin")
+			_, err := DecompressFile(tzz, out, common.New, FileOptions{})
+			if !errors.Is(err, ErrChecksum) && !errors.Is(err, common.ErrCorrupted) && !errors.Is(err, common.ErrInvalidData) {
+				t.Fatalf("Expected a verification error, got %v", err)
+			}
+			if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Expected no output file, got %v", err)
+			}
+
+			// 既存のファイルを置き換える場合も、検証に失敗したら元の内容のまま
+			if err := os.WriteFile(out, []byte("previous"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecompressFile(tzz, out, common.New, FileOptions{Overwrite: true}); err == nil {
+				t.Fatal("Expected a verification error")
+			}
+			if got, _ := os.ReadFile(out); string(got) != "previous" {
+				t.Errorf("Expected the existing file to be kept, got %d bytes", len(got))
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 3 {
+				t.Errorf("Expected no temporary files to be left, got %v", entries)
+			}
+		})
+	}
+}
+
+// chunkedLog はチャンクのチェックサムのテストに使う、RLEで圧縮できる大きめのデータです
+func chunkedLog() []byte {
+	var data []byte
+	for i := range 200 {
+		data = append(data, logLines(i%60)...)
+		data = append(data, bytes.Repeat([]byte{byte('a' + i%26)}, 100)...)
+	}
+	return data
+}
+
+// countWriter は書き込まれたバイト数を数えます
+type countWriter struct{ n int64 }
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestCompressFile_ChunkChecksums(t *testing.T) {
+	const chunkSize = 16 << 10
+	dir := t.TempDir()
+	data := chunkedLog()
+	src := filepath.Join(dir, "input.log")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := common.New("rle")
+	dst := filepath.Join(dir, "input.log.tzz")
+	if _, err := CompressFile(src, dst, c, FileOptions{Algorithm: "rle", ChecksumChunkSize: chunkSize}); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	compressed, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := Parse(compressed)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	h := members[0].Header
+	if want := (len(data) + chunkSize - 1) / chunkSize; h.Version != ChunkedVersion || h.ChunkSize != chunkSize || len(h.ChunkCRCs) != want {
+		t.Fatalf("Expected version %d with %d chunk checksums, got version %d with %d", ChunkedVersion, want, h.Version, len(h.ChunkCRCs))
+	}
+	if got, err := Decompress(compressed, common.New, common.DecompressOptions{}); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+
+	// ペイロードの中ほどの1バイトを壊し、展開結果で最初に変わる位置を求める
+	corrupted := slices.Clone(compressed)
+	payloadStart := members[0].Offset + int64(len(compressed)-len(members[0].Payload))
+	pos := payloadStart + int64(len(members[0].Payload))/2
+	corrupted[pos] ^= 0x01
+	var broken bytes.Buffer
+	rle.NewCompressor().DecompressStream(bytes.NewReader(corrupted[payloadStart+1:]), &broken)
+	at := int64(0)
+	for at < int64(broken.Len()) && at < int64(len(data)) && broken.Bytes()[at] == data[at] {
+		at++
+	}
+
+	// 壊れたチャンクの範囲を報告し、その終わりより後は書き込まない
+	out := &countWriter{}
+	_, _, err = decompressMembers(out, bytes.NewReader(corrupted), common.New, common.DecompressOptions{}, false)
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Expected a ChunkError, got %v", err)
+	}
+	if at < chunkErr.Start || at >= chunkErr.End {
+		t.Errorf("Expected bytes %d-%d to contain the corrupted offset %d", chunkErr.Start, chunkErr.End, at)
+	}
+	if out.n > chunkErr.End || out.n >= int64(len(data)) {
+		t.Errorf("Expected decompression to stop at byte %d, wrote %d of %d", chunkErr.End, out.n, len(data))
+	}
+
+	// メモリ上の展開でも同じチャンクを報告する
+	_, err = Decompress(corrupted, common.New, common.DecompressOptions{})
+	var memErr *ChunkError
+	if !errors.As(err, &memErr) || memErr.Index != chunkErr.Index {
+		t.Errorf("Expected chunk %d to fail, got %v", chunkErr.Index, err)
+	}
+
+	// 負の間隔ではチャンクのチェックサムを記録しない
+	if _, err := CompressFile(src, dst, c, FileOptions{Algorithm: "rle", ChecksumChunkSize: -1, Overwrite: true}); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	compressed, _ = os.ReadFile(dst)
+	if members, err := Parse(compressed); err != nil || members[0].Version != Version || members[0].ChunkCRCs != nil {
+		t.Errorf("Expected a version %d member without chunk checksums, got %+v (err %v)", Version, members[0].Header, err)
+	}
+}
+
+// countingReaderAt は ReadAt で読み込んだバイト数を数えます
+type countingReaderAt struct {
+	r     *bytes.Reader
+	bytes int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func (c *countingReaderAt) Size() int64 {
+	return c.r.Size()
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	data := chunkedLog()
+	src := filepath.Join(dir, "input.log")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// チャンクのチェックサム付きのメンバー、通常のメンバー、ブロックコンテナのメンバー、空のメンバー
+	path := filepath.Join(dir, "all.tzz")
+	c, _ := common.New("rle")
+	if _, err := CompressFile(src, path, c, FileOptions{Algorithm: "rle", ChecksumChunkSize: 16 << 10}); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+	appendMember(t, path, "lz77", data)
+	adaptive, _ := EncodeMember("rle", blocks.NewCompressor(rle.NewCompressor(), 4096, true), data)
+	if err := AppendFile(path, adaptive, fileutil.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	appendMember(t, path, "huffman", nil)
+	file, _ := os.ReadFile(path)
+
+	r := &countingReaderAt{r: bytes.NewReader(file)}
+	info, err := Inspect(r)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Format != FormatTzz || info.Size != int64(len(file)) || len(info.Members) != 4 || info.Truncated {
+		t.Fatalf("Unexpected info: %+v", info)
+	}
+	if info.OriginalSize != 3*int64(len(data)) {
+		t.Errorf("Expected original size %d, got %d", 3*len(data), info.OriginalSize)
+	}
+	// ペイロードは読み込まない
+	if r.bytes >= int64(len(file))/4 {
+		t.Errorf("Expected the payloads to be skipped, read %d of %d bytes", r.bytes, len(file))
+	}
+
+	crc := crc32.ChecksumIEEE(data)
+	want := []struct {
+		version   byte
+		algorithm string
+		size      uint64
+		crc       uint32
+		chunks    int
+		blocks    bool
+	}{
+		{ChunkedVersion, "rle", uint64(len(data)), crc, (len(data) + 16<<10 - 1) / (16 << 10), false},
+		{Version, "lz77", uint64(len(data)), crc, 0, false},
+		{Version, "rle", uint64(len(data)), crc, 0, true},
+		{Version, "huffman", 0, 0, 0, false},
+	}
+	members, _ := Parse(file)
+	for i, w := range want {
+		m := info.Members[i]
+		if m.Offset != members[i].Offset || m.Version != w.version || m.Algorithm != w.algorithm ||
+			m.OriginalSize != w.size || m.CRC != w.crc || m.Checksum != ChecksumCRC32 || len(m.ChunkCRCs) != w.chunks ||
+			(m.Blocks != nil) != w.blocks || m.FormatVersion != members[i].FormatVersion() {
+			t.Errorf("Member %d: unexpected info %+v", i, m)
+		}
+	}
+	if b := info.Members[2].Blocks; b.BlockSize != 4096 || b.Count != (len(data)+4095)/4096 || b.Compressed+b.Stored+b.Zero != b.Count {
+		t.Errorf("Unexpected blocks %+v", b)
+	}
+
+	var out bytes.Buffer
+	FprintInfo(&out, info)
+	for _, s := range []string{
+		"形式:       tzz",
+		fmt.Sprintf("#3 offset=%d バージョン 2, huffman", members[3].Offset),
+		fmt.Sprintf("チャンクのチェックサム: %d 個 (16.0 KB ごと)", want[0].chunks),
+		fmt.Sprintf("ブロック: %d 個 (ブロックサイズ 4.0 KB", info.Members[2].Blocks.Count),
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in the output:\n%s", s, out.String())
+		}
+	}
+
+	// 末尾の不完全なメンバーは Truncated として報告する
+	info, err = Inspect(bytes.NewReader(file[:len(file)-3]))
+	if err != nil || !info.Truncated || len(info.Members) != 3 || info.ValidSize != members[3].Offset {
+		t.Errorf("Expected 3 members truncated at %d, got %+v (err %v)", members[3].Offset, info, err)
+	}
+
+	// ブロックコンテナだけのファイル
+	framed, _ := blocks.Compress(data, rle.NewCompressor(), 8192)
+	info, err = Inspect(bytes.NewReader(framed))
+	if err != nil || info.Format != FormatBlocks || info.Blocks == nil || info.Blocks.BlockSize != 8192 || info.OriginalSize != int64(len(data)) {
+		t.Errorf("Unexpected info for a block container: %+v (err %v)", info, err)
+	}
+}
+
+func TestInspect_Unknown(t *testing.T) {
+	// ヘッダーのない以前の形式（アルゴリズムの出力そのまま）は判別できない形式として報告する
+	raw, _ := rle.NewCompressor().Compress(chunkedLog())
+	for _, data := range [][]byte{raw, nil, []byte("TZ")} {
+		info, err := Inspect(bytes.NewReader(data))
+		if err != nil || info.Format != FormatUnknown || info.Size != int64(len(data)) {
+			t.Errorf("Expected an unknown format of %d bytes, got %+v (err %v)", len(data), info, err)
+		}
+		var out bytes.Buffer
+		FprintInfo(&out, info)
+		if want := fmt.Sprintf("unknown format, %d bytes\n", len(data)); out.String() != want {
+			t.Errorf("Expected %q, got %q", want, out.String())
+		}
+	}
+
+	// 新しいバージョンのメンバーは対応していないバージョンとして報告する
+	member, _ := EncodeMember("rle", rle.NewCompressor(), []byte("abc"))
+	member[len(Magic)] = ChunkedVersion + 1
+	if _, err := Inspect(bytes.NewReader(member)); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch, got %v", err)
+	}
+
+	// サイズがわからない ReaderAt は扱えない
+	if _, err := Inspect(struct{ io.ReaderAt }{bytes.NewReader(raw)}); err == nil {
+		t.Error("Expected an error for a reader without a size")
+	}
+}
+
+// slowReader は1回の Read で最大 n バイトを、delay だけ待ってから返す Reader です
+type slowReader struct {
+	r     io.Reader
+	n     int
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p[:min(len(p), s.n)])
+}
+
+// encodeStream は data を algorithm の1つ以上のメンバーにしたコンテナを返します
+func encodeStream(t *testing.T, algorithm string, data []byte, chunkSize int) []byte {
+	t.Helper()
+	c, err := common.New(algorithm)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var stream []byte
+	for len(data) > 0 {
+		n := min(len(data), chunkSize)
+		member, err := EncodeMember(algorithm, c, data[:n])
+		if err != nil {
+			t.Fatalf("EncodeMember failed: %v", err)
+		}
+		stream = append(stream, member...)
+		data = data[n:]
+	}
+	return stream
+}
+
+func TestSafeDecompressStream(t *testing.T) {
+	data := bytes.Repeat(logLines(1), 3000) // 約3MB
+	stream := encodeStream(t, "huffman", data, 1<<20)
+	policy := common.SafetyPolicy{
+		MaxOutputSize:       int64(len(data)),
+		MaxCompressionRatio: 1000,
+		Budget:              common.NewBudget(8 << 20),
+		Deadline:            time.Now().Add(time.Minute),
+	}
+
+	var dst bytes.Buffer
+	stats, err := SafeDecompressStream(bytes.NewReader(stream), &dst, common.New, policy)
+	if err != nil {
+		t.Fatalf("SafeDecompressStream failed: %v", err)
+	}
+	if !bytes.Equal(dst.Bytes(), data) {
+		t.Fatal("Output does not match the original data")
+	}
+	if stats.OriginalSize != int64(len(data)) || stats.CompressedSize != int64(len(stream)) {
+		t.Errorf("Expected sizes %d/%d, got %d/%d", len(data), len(stream), stats.OriginalSize, stats.CompressedSize)
+	}
+}
+
+func TestSafeDecompressStream_RatioBomb(t *testing.T) {
+	// ゼロの連続はRLEで100倍以上に縮む
+	data := make([]byte, 16<<20)
+	stream := encodeStream(t, "rle", data, len(data))
+	policy := common.SafetyPolicy{MaxCompressionRatio: 100}
+
+	var dst bytes.Buffer
+	_, err := SafeDecompressStream(bytes.NewReader(stream), &dst, common.New, policy)
+	if !errors.Is(err, common.ErrRatioExceeded) {
+		t.Fatalf("Expected ErrRatioExceeded, got %v", err)
+	}
+
+	// dst には確認の済んでいない一部のデータが残り、エラーはそのバイト数を返す
+	var partial *common.PartialOutputError
+	if !errors.As(err, &partial) {
+		t.Fatalf("Expected a PartialOutputError, got %T", err)
+	}
+	if partial.Written != int64(dst.Len()) || partial.Written < common.DefaultRatioGrace || partial.Written >= int64(len(data)) {
+		t.Errorf("Expected Written (%d) to equal the partial output (%d bytes) between the grace and the full size",
+			partial.Written, dst.Len())
+	}
+	if !strings.Contains(err.Error(), "partial output") {
+		t.Errorf("Expected the error to mention the partial output, got %q", err)
+	}
+}
+
+func TestSafeDecompressStream_Deadline(t *testing.T) {
+	data := bytes.Repeat(logLines(1), 100)
+	stream := encodeStream(t, "huffman", data, 1024)
+	src := &slowReader{r: bytes.NewReader(stream), n: 64, delay: 5 * time.Millisecond}
+	policy := common.SafetyPolicy{Deadline: time.Now().Add(50 * time.Millisecond)}
+
+	var dst bytes.Buffer
+	_, err := SafeDecompressStream(src, &dst, common.New, policy)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected os.ErrDeadlineExceeded, got %v", err)
+	}
+	var partial *common.PartialOutputError
+	if errors.As(err, &partial) && partial.Written != int64(dst.Len()) {
+		t.Errorf("Expected Written %d, got %d", dst.Len(), partial.Written)
+	}
+}
+
+func TestSafeDecompressStream_Checksum(t *testing.T) {
+	stream := encodeStream(t, "rle", []byte("hello, hello, hello"), 1024)
+	stream[len(stream)-1] ^= 0xff
+
+	_, err := SafeDecompressStream(bytes.NewReader(stream), io.Discard, common.New, common.SafetyPolicy{})
+	if err == nil {
+		t.Fatal("Expected an error for corrupted data")
+	}
+	if _, err := SafeDecompressStream(strings.NewReader("not a container"), io.Discard, common.New, common.SafetyPolicy{}); err == nil {
+		t.Error("Expected an error for non-container input")
+	}
+}
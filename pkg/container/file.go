@@ -0,0 +1,71 @@
+package container
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+)
+
+// AppendFile は完全なメンバーを path の末尾に追記し、ディスクに同期します
+// 既存のファイルが別のバージョンのメンバーを含む場合や、末尾に不完全なメンバーが
+// 残っている場合（追記すると以降のメンバーが読めなくなる）はエラーを返します。
+func AppendFile(path string, member []byte, opts fileutil.Options) error {
+	// ファイルがない、ディレクトリである、などの報告は fileutil に任せる
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		if err := checkAppendable(path); err != nil {
+			return err
+		}
+	}
+
+	return fileutil.Append(path, member, opts)
+}
+
+// checkAppendable は既存のファイルに追記できるかを確認します
+func checkAppendable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	result, err := Scan(f)
+	if err != nil {
+		return fmt.Errorf("cannot append to %s: %w", path, err)
+	}
+	if result.Truncated {
+		return fmt.Errorf("cannot append to %s: %w at offset %d (run repair first)", path, ErrTruncated, result.ValidSize)
+	}
+	return nil
+}
+
+// RepairFile は末尾の不完全なメンバーを切り詰めます
+// クラッシュなどで追記が途中で止まったファイルを、完全なメンバーだけの状態に戻します。
+// 切り詰めたバイト数を返します（不完全なメンバーがなければ0）。
+func RepairFile(path string) (ScanResult, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return ScanResult{}, 0, err
+	}
+	defer f.Close()
+
+	result, err := Scan(f)
+	if err != nil {
+		return result, 0, err
+	}
+	if !result.Truncated {
+		return result, 0, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return result, 0, err
+	}
+	if err := f.Truncate(result.ValidSize); err != nil {
+		return result, 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return result, 0, err
+	}
+	return result, info.Size() - result.ValidSize, nil
+}
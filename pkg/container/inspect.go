@@ -0,0 +1,326 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/blocks"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// Inspect が判別する形式の名前
+const (
+	FormatTzz     = "tzz"     // .tzz コンテナ（メンバーの連結）
+	FormatBlocks  = "tzb"     // ブロックコンテナ（blocks パッケージ）
+	FormatUnknown = "unknown" // ヘッダーのない圧縮データなど、判別できない形式
+)
+
+// ChecksumCRC32 は Info の Checksum に記録するチェックサムの種類です
+const ChecksumCRC32 = "crc32"
+
+// Info は Inspect が圧縮ファイルのヘッダーから読み取った情報です
+// 形式によって使うフィールドが異なり、.tzz は Members を、アーカイブは Entries と
+// （.tza の場合は）Members を、ブロックコンテナは Blocks を持ちます。
+type Info struct {
+	Format         string `json:"format"`            // 形式（FormatTzz など、アーカイブは "tza" と "zip"）
+	Version        byte   `json:"version,omitempty"` // アーカイブの形式のバージョン（.tzz はメンバーごと）
+	Size           int64  `json:"size"`              // ファイルのサイズ
+	OriginalSize   int64  `json:"original_size"`     // 元のデータのサイズの合計（判別できない形式では0）
+	CompressedSize int64  `json:"compressed_size"`   // 圧縮データのサイズの合計（ヘッダーを除く）
+	// Reproducible はアーカイブのヘッダーに、再現可能なビルド（エントリが名前順で、
+	// 更新日時などの環境によるメタデータを含まない）として書き込んだことが記録されていることを表します
+	Reproducible bool `json:"reproducible,omitempty"`
+
+	Members []MemberInfo `json:"members,omitempty"` // .tzz コンテナのメンバー
+	Entries []EntryInfo  `json:"entries,omitempty"` // アーカイブのエントリ
+	Blocks  *BlocksInfo  `json:"blocks,omitempty"`  // ブロックコンテナの構成
+
+	// ValidSize は完全なメンバーだけを含む先頭部分のサイズです（Truncated の場合）
+	ValidSize int64 `json:"valid_size,omitempty"`
+	// Truncated は末尾に不完全なメンバーがあることを表します
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// MemberInfo は .tzz コンテナの1つのメンバーの情報です
+type MemberInfo struct {
+	Offset        int64       `json:"offset"`                // ファイル中のメンバーの開始位置
+	Version       byte        `json:"version"`               // コンテナのフォーマットのバージョン
+	Algorithm     string      `json:"algorithm"`             // 圧縮アルゴリズムの登録名
+	FormatVersion byte        `json:"format_version"`        // アルゴリズムの形式バージョン
+	OriginalSize  uint64      `json:"original_size"`         // 元のデータのサイズ
+	PayloadSize   uint64      `json:"payload_size"`          // ペイロードのサイズ
+	Checksum      string      `json:"checksum"`              // チェックサムの種類（ChecksumCRC32）
+	CRC           uint32      `json:"crc32"`                 // 元のデータのCRC32
+	ChunkSize     uint64      `json:"chunk_size,omitempty"`  // チャンクのチェックサムの間隔（ChunkedVersion のみ）
+	ChunkCRCs     []uint32    `json:"chunk_crc32,omitempty"` // チャンクごとのCRC32
+	Blocks        *BlocksInfo `json:"blocks,omitempty"`      // ペイロードがブロックコンテナ（-adaptive）の場合の構成
+}
+
+// EntryInfo はアーカイブの1つのエントリの情報です
+type EntryInfo struct {
+	Name           string `json:"name"`              // "/" 区切りのパス
+	Algorithm      string `json:"algorithm"`         // 圧縮アルゴリズムの登録名（zip では格納方式）
+	Size           int64  `json:"size"`              // 元のサイズ
+	CompressedSize int64  `json:"compressed_size"`   // 圧縮データのサイズ（リンクの場合は0）
+	CRC            uint32 `json:"crc32"`             // 元のデータのCRC32
+	Link           string `json:"link,omitempty"`    // 同じ内容を格納したエントリの名前
+	Symlink        string `json:"symlink,omitempty"` // シンボリックリンクの場合のリンク先
+}
+
+// BlocksInfo はブロックコンテナの構成です
+type BlocksInfo struct {
+	Count      int `json:"count"`      // ブロック数
+	BlockSize  int `json:"block_size"` // 最大のブロックの元のサイズ（圧縮時のブロックサイズ、0の領域を除く）
+	Compressed int `json:"compressed"` // 圧縮したブロックの数
+	Stored     int `json:"stored"`     // 無圧縮のブロックの数
+	Zero       int `json:"zero"`       // 0の領域の数
+}
+
+// InspectFunc は Inspect が先頭のマジックで判別した形式のファイルを調べる関数です
+// size は r のサイズです。
+type InspectFunc func(r io.ReaderAt, size int64) (Info, error)
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[string]InspectFunc)
+)
+
+// RegisterFormat は Inspect が magic で始まるファイルを inspect で調べるように登録します
+// .tzz 以外の形式を持つパッケージ（archive など）が init() から呼び出すことを想定しています。
+// 同じマジックを二重に登録するとpanicします。
+func RegisterFormat(magic string, inspect InspectFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	if magic == "" || inspect == nil {
+		panic("container: RegisterFormat magic is empty or inspect is nil")
+	}
+	if _, exists := formats[magic]; exists {
+		panic(fmt.Sprintf("container: RegisterFormat called twice for magic %q", magic))
+	}
+	formats[magic] = inspect
+}
+
+// maxMagicLength は Inspect がマジックの判別に読み込む先頭のバイト数です
+const maxMagicLength = 8
+
+// Inspect は r の圧縮ファイルのヘッダーだけを読み込み、形式と構成を返します
+// ペイロードは展開せずに読み飛ばすため、大きなファイルでもすぐに終わります。
+// r のサイズは Size() int64 か Stat()（*os.File）から求めます。
+// .tzz コンテナ、ブロックコンテナ、RegisterFormat で登録された形式のどれでもない場合は
+// エラーにせず、Format が FormatUnknown の Info を返します。
+func Inspect(r io.ReaderAt) (Info, error) {
+	size, err := readerSize(r)
+	if err != nil {
+		return Info{}, err
+	}
+
+	header := make([]byte, min(size, maxMagicLength))
+	if n, err := r.ReadAt(header, 0); n < len(header) {
+		return Info{}, err
+	}
+
+	switch {
+	case IsContainer(header):
+		return InspectMembers(r, 0, size)
+	case blocks.IsBlocks(header):
+		return inspectBlocks(r, size)
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for magic, inspect := range formats {
+		if strings.HasPrefix(string(header), magic) {
+			return inspect(r, size)
+		}
+	}
+	return Info{Format: FormatUnknown, Size: size}, nil
+}
+
+// readerSize は r のサイズを返します
+func readerSize(r io.ReaderAt) (int64, error) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	return 0, errors.New("container: cannot determine the size of the reader")
+}
+
+// InspectMembers は r の offset から size までに連結された .tzz コンテナのメンバーを調べます
+// Scan と同じく、末尾の不完全なメンバーはエラーではなく Truncated として報告します。
+// アーカイブのように、メンバーの前に独自のヘッダーを持つ形式の InspectFunc から使えます。
+func InspectMembers(r io.ReaderAt, offset, size int64) (Info, error) {
+	info := Info{Format: FormatTzz, Size: size}
+
+	for offset < size {
+		// ヘッダーは小さいため、少しずつ読み込む（ペイロードは読み込まない）
+		h, n, err := readHeader(bufio.NewReaderSize(io.NewSectionReader(r, offset, size-offset), 64))
+		if errors.Is(err, ErrTruncated) {
+			info.Truncated = true
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("member %d at offset %d: %w", len(info.Members), offset, err)
+		}
+
+		start := offset + n
+		if h.PayloadSize > uint64(size-start) {
+			info.Truncated = true
+			break
+		}
+
+		m := MemberInfo{
+			Offset:       offset,
+			Version:      h.Version,
+			Algorithm:    h.Algorithm,
+			OriginalSize: h.OriginalSize,
+			PayloadSize:  h.PayloadSize,
+			Checksum:     ChecksumCRC32,
+			CRC:          h.CRC,
+			ChunkSize:    h.ChunkSize,
+			ChunkCRCs:    h.ChunkCRCs,
+		}
+		if err := m.inspectPayload(r, start); err != nil {
+			return info, fmt.Errorf("member %d at offset %d: %w", len(info.Members), offset, err)
+		}
+
+		info.Members = append(info.Members, m)
+		info.OriginalSize += int64(h.OriginalSize)
+		info.CompressedSize += int64(h.PayloadSize)
+		offset = start + int64(h.PayloadSize)
+	}
+
+	if info.Truncated {
+		info.ValidSize = offset
+	}
+	return info, nil
+}
+
+// inspectPayload はペイロードの先頭から形式バージョンと、ブロックコンテナの構成を読み取ります
+func (m *MemberInfo) inspectPayload(r io.ReaderAt, start int64) error {
+	if m.Version == legacyVersion || m.PayloadSize == 0 {
+		return nil
+	}
+
+	header := make([]byte, min(m.PayloadSize, 1+maxMagicLength))
+	if n, err := r.ReadAt(header, start); n < len(header) {
+		return err
+	}
+	m.FormatVersion = header[0]
+	if !blocks.IsBlocks(header[1:]) {
+		return nil
+	}
+
+	// 偶然マジックで始まっただけの圧縮データもあるため、ブロックコンテナとして
+	// 読めないペイロードはエラーにしない
+	body := int64(m.PayloadSize) - 1
+	if info, err := inspectBlocks(io.NewSectionReader(r, start+1, body), body); err == nil {
+		m.Blocks = info.Blocks
+	}
+	return nil
+}
+
+// inspectBlocks はブロックコンテナのブロックヘッダーを読み取ります
+func inspectBlocks(r io.ReaderAt, size int64) (Info, error) {
+	infos, err := blocks.InspectAt(r, size)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{Format: FormatBlocks, Size: size, Blocks: &BlocksInfo{Count: len(infos)}}
+	for _, b := range infos {
+		switch b.Mode {
+		case blocks.ModeCompressed:
+			info.Blocks.Compressed++
+		case blocks.ModeStored:
+			info.Blocks.Stored++
+		case blocks.ModeZero:
+			info.Blocks.Zero++
+		}
+		if b.Mode != blocks.ModeZero {
+			info.Blocks.BlockSize = max(info.Blocks.BlockSize, b.OriginalSize)
+		}
+		info.OriginalSize += int64(b.OriginalSize)
+		info.CompressedSize += int64(b.PayloadSize)
+	}
+	return info, nil
+}
+
+// PrintInfo は Inspect の結果を表示します
+func PrintInfo(info Info) {
+	FprintInfo(os.Stdout, info)
+}
+
+// FprintInfo は PrintInfo と同じ内容を w に書き込みます
+func FprintInfo(w io.Writer, info Info) {
+	if info.Format == FormatUnknown {
+		fmt.Fprintf(w, "unknown format, %d bytes\n", info.Size)
+		return
+	}
+
+	fmt.Fprintf(w, "=== ファイル情報 ===\n")
+	fmt.Fprintf(w, "形式:       %s", info.Format)
+	if info.Version > 0 {
+		fmt.Fprintf(w, " (バージョン %d)", info.Version)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "ファイル:   %s\n", common.FormatBytes(info.Size))
+	fmt.Fprintf(w, "元のサイズ: %s\n", common.FormatBytes(info.OriginalSize))
+	fmt.Fprintf(w, "圧縮後:     %s\n", common.FormatBytes(info.CompressedSize))
+	if info.Reproducible {
+		fmt.Fprintf(w, "再現可能:   はい（エントリは名前順、更新日時と権限は固定）\n")
+	}
+	if info.Blocks != nil {
+		fprintBlocks(w, "", info.Blocks)
+	}
+
+	if len(info.Members) > 0 {
+		fmt.Fprintf(w, "\n=== メンバー (%d) ===\n", len(info.Members))
+	}
+	for i, m := range info.Members {
+		fmt.Fprintf(w, "#%d offset=%d バージョン %d, %s (形式 %d), %d -> %d bytes, %s %08x\n",
+			i, m.Offset, m.Version, m.Algorithm, m.FormatVersion, m.OriginalSize, m.PayloadSize, m.Checksum, m.CRC)
+		if m.ChunkSize > 0 {
+			fmt.Fprintf(w, "   チャンクのチェックサム: %d 個 (%s ごと)\n", len(m.ChunkCRCs), common.FormatBytes(int64(m.ChunkSize)))
+		}
+		if m.Blocks != nil {
+			fprintBlocks(w, "   ", m.Blocks)
+		}
+	}
+	if info.Truncated {
+		fmt.Fprintf(w, "⚠️  オフセット %d 以降に不完全なメンバーがあります\n", info.ValidSize)
+	}
+
+	if len(info.Entries) > 0 {
+		fmt.Fprintf(w, "\n=== エントリ (%d) ===\n", len(info.Entries))
+		fmt.Fprintf(w, "%-12s %12s %12s  %-8s  %s\n", "アルゴリズム", "元サイズ", "圧縮後", "CRC32", "名前")
+	}
+	for _, e := range info.Entries {
+		if e.Symlink != "" {
+			fmt.Fprintf(w, "%-12s %12s %12s  %-8s  %s -> %s\n", "symlink", "-", "-", "-", e.Name, e.Symlink)
+			continue
+		}
+		if e.Link != "" {
+			fmt.Fprintf(w, "%-12s %12d %12s  %08x  %s (= %s)\n", e.Algorithm, e.Size, "-", e.CRC, e.Name, e.Link)
+			continue
+		}
+		fmt.Fprintf(w, "%-12s %12d %12d  %08x  %s\n", e.Algorithm, e.Size, e.CompressedSize, e.CRC, e.Name)
+	}
+}
+
+// fprintBlocks はブロックコンテナの構成を1行で表示します
+func fprintBlocks(w io.Writer, indent string, b *BlocksInfo) {
+	fmt.Fprintf(w, "%sブロック: %d 個 (ブロックサイズ %s, 圧縮: %d, stored: %d, zero: %d)\n",
+		indent, b.Count, common.FormatBytes(int64(b.BlockSize)), b.Compressed, b.Stored, b.Zero)
+}
@@ -0,0 +1,147 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// NestedAlgorithm は、元のデータが既に .tzz コンテナだったため圧縮せずに格納したメンバーのアルゴリズム名です
+// ペイロードは元のデータそのもの（common.NewStored と同じ）で、展開には Resolver を使いません。
+// 誤って2重に圧縮したファイルを、展開する側でも入れ子と分かるように記録します。
+const NestedAlgorithm = "nested"
+
+// DefaultMaxDepth は入れ子のコンテナを続けて展開する場合の、既定の最大の層の数です（FileOptions.MaxDepth）
+const DefaultMaxDepth = 4
+
+// ErrNested は入力が既に .tzz コンテナのため圧縮しなかったことを表すエラーです（NestedReject）
+var ErrNested = errors.New("input is already a .tzz container")
+
+// NestedMode は圧縮する入力が既に .tzz コンテナの場合の扱いです
+type NestedMode int
+
+const (
+	// NestedStore は圧縮せずに NestedAlgorithm のメンバーとして格納します（既定）
+	NestedStore NestedMode = iota
+	// NestedCompress はほかの入力と同じく圧縮します
+	NestedCompress
+	// NestedReject は圧縮せずに ErrNested を返します
+	NestedReject
+)
+
+// headerPeekSize は入力や展開結果が .tzz コンテナかを確かめるために調べる先頭のバイト数です
+// ヘッダーが途中で終わってもよいため、チャンクのチェックサムまで含める必要はありません。
+const headerPeekSize = 64
+
+// LooksLikeContainer は head が .tzz コンテナのメンバーのヘッダーで始まるかを返します
+// head はファイルの先頭だけでもよく、ヘッダーの途中で終わっている場合も true です。
+// マジックだけでなくバージョンなども確かめるため、たまたま "TZZ" で始まるテキストは
+// ほとんどの場合 false になります。
+func LooksLikeContainer(head []byte) bool {
+	if !IsContainer(head) {
+		return false
+	}
+	_, _, err := readHeader(bytes.NewReader(head))
+	return err == nil || errors.Is(err, ErrTruncated)
+}
+
+// resolveMember はメンバーのアルゴリズム名 name から展開に使うCompressorを返します
+// NestedAlgorithm のメンバーは resolve を呼ばずに、そのまま格納したデータとして展開します。
+func resolveMember(resolve Resolver, name string) (common.Compressor, error) {
+	if name == NestedAlgorithm {
+		return common.NewStored(), nil
+	}
+	return resolve(name)
+}
+
+// decompressLayers は r を展開して dst に書き込み、使用したアルゴリズム名を返します
+// opts.MaxDepth が2以上の場合は、展開結果がまた .tzz コンテナである間、最大 MaxDepth 層まで
+// 続けて展開します（途中の層は tmpDir の一時ファイルに書き込みます）。展開したコンテナの
+// 層の数を stats.Layers に、最後の展開結果がまだコンテナかを stats.Nested に設定します。
+func decompressLayers(dst io.Writer, r *bufio.Reader, resolve Resolver, opts FileOptions, tmpDir string, stats *common.CompressionStats) ([]string, error) {
+	var temps []*os.File
+	defer func() {
+		for _, tmp := range temps {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	var names []string
+	for depth := 1; ; depth++ {
+		// 次の層があるかもしれない間は、一時ファイルに展開してから先頭を確かめる
+		var tmp *os.File
+		var buffered *bufio.Writer
+		out := dst
+		if depth < opts.MaxDepth {
+			var err error
+			if tmp, err = os.CreateTemp(tmpDir, ".tinyzipzap-layer-*"); err != nil {
+				return nil, err
+			}
+			temps = append(temps, tmp)
+			buffered = bufio.NewWriter(tmp)
+			out = buffered
+		}
+
+		head := &headWriter{w: out}
+		layer, err := decompressLayer(head, r, resolve, opts, stats)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, layer...)
+		nested := LooksLikeContainer(head.head)
+		if tmp == nil {
+			stats.Nested = nested
+			return names, nil
+		}
+
+		if err := buffered.Flush(); err != nil {
+			return nil, err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if !nested {
+			_, err := io.Copy(dst, tmp)
+			return names, err
+		}
+		r = bufio.NewReader(tmp)
+	}
+}
+
+// decompressLayer は r の1層を展開して dst に書き込み、使用したアルゴリズム名を返します
+// .tzz コンテナの場合は各メンバーを展開し、それ以外は opts.Algorithm のCompressorで展開します。
+func decompressLayer(dst io.Writer, r *bufio.Reader, resolve Resolver, opts FileOptions, stats *common.CompressionStats) ([]string, error) {
+	if magic, _ := r.Peek(len(Magic)); IsContainer(magic) {
+		names, mismatches, err := decompressMembers(dst, r, resolve, opts.Decompress, opts.TolerateSizeMismatch)
+		stats.SizeMismatches = append(stats.SizeMismatches, mismatches...)
+		stats.Layers++
+		return names, err
+	}
+
+	if opts.Algorithm == "" {
+		return nil, errors.New("invalid container: bad magic and no algorithm specified")
+	}
+	c, err := resolve(opts.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return []string{c.Name()}, decompressRaw(dst, r, c, opts.Decompress)
+}
+
+// headWriter は書き込まれたデータの先頭 headerPeekSize バイトを記録します
+type headWriter struct {
+	w    io.Writer
+	head []byte
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if n := headerPeekSize - len(h.head); n > 0 {
+		h.head = append(h.head, p[:min(n, len(p))]...)
+	}
+	return h.w.Write(p)
+}
@@ -0,0 +1,54 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// SafeDecompressStream は信頼できない入力の .tzz コンテナを src から読み込みながら展開し、dst に書き込みます
+// 各メンバーの元のサイズとCRC32を確認し、policy の出力サイズ、圧縮率、メモリ予算、期限、
+// 読み込み速度の制限を適用します。ネットワークから受け取ったデータを展開する場合の入口です。
+// 長さとチェックサムを確認できないため、コンテナでない入力はエラーにします。
+//
+// 展開結果は確認と同時に dst に書き込むため、途中で失敗した場合は dst に確認の済んでいない
+// データが残っていることがあります。その場合のエラーは *common.PartialOutputError で、
+// Written に書き込んだバイト数が入ります（errors.Is で元のエラーも判定できます）。
+// 一時ファイルを使って出力を残さない場合は DecompressFile を使ってください。
+//
+// 統計の OriginalSize は展開後のサイズ、CompressedSize は src から読み込んだサイズです。
+// 展開結果のサイズがヘッダーの元のサイズと異なるメンバーは、元のサイズと展開結果のサイズを
+// 含む *common.SizeError（errors.Is で common.ErrCorrupted）にします。policy.TolerateSizeMismatch
+// の場合は展開できた分を書き込んで続け、統計の SizeMismatches に記録します。
+func SafeDecompressStream(src io.Reader, dst io.Writer, resolve Resolver, policy common.SafetyPolicy) (common.CompressionStats, error) {
+	start := time.Now()
+	var stats common.CompressionStats
+
+	guard := common.NewSafetyGuard(src, dst, policy)
+	r := bufio.NewReader(guard.Reader())
+
+	magic, err := r.Peek(len(Magic))
+	if err != nil && err != io.EOF {
+		return stats, err
+	}
+	if !IsContainer(magic) {
+		return stats, errors.New("invalid container: bad magic")
+	}
+
+	names, mismatches, err := decompressMembers(guard.Writer(), r, resolve, policy.DecompressOptions(), policy.TolerateSizeMismatch)
+	stats.OriginalSize = guard.OutputBytes()
+	stats.CompressedSize = guard.InputBytes()
+	if err != nil {
+		return stats, guard.Err(err)
+	}
+
+	stats.Algorithm = strings.Join(names, ", ")
+	stats.SizeMismatches = mismatches
+	stats.CalculateRatio()
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
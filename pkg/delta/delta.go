@@ -0,0 +1,262 @@
+// Package delta implements binary patches between two versions of a file.
+// 新しいファイルを、古いファイル（ベース）からのコピー（COPY）と新しいバイト列の挿入（INSERT）の
+// 並びで表します。コピー元の検索には LZ77 の索引（lz77.Index）を使うため、少しだけ変更した
+// ファイルのパッチは変更箇所の大きさ程度になります。パッチには古いファイルと新しいファイルの
+// サイズとチェックサムを記録し、違うベースに適用した場合は ErrBaseMismatch を返します。
+package delta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+)
+
+// パッチの形式
+//
+//	マジック "TZDP" + 形式バージョン(1バイト)
+//	+ 古いファイルのサイズ(uvarint) + CRC32(4バイト, BigEndian)
+//	+ 新しいファイルのサイズ(uvarint) + CRC32(4バイト, BigEndian)
+//	+ 操作の並び
+//
+//	INSERT: フラグ(0) + バイト数(uvarint) + バイト列
+//	COPY:   フラグ(1) + コピー元の位置(varint) + バイト数(uvarint)
+//
+// COPY の位置は直前の COPY の終わり（最初は0）からの差です。変更箇所をはさんで
+// 古いファイルの続きをコピーする場合は0や小さな値になり、短く書き込めます。
+const (
+	patchMagic = "TZDP"
+
+	// Version はパッチの形式バージョンです
+	Version = 1
+
+	opInsert = 0
+	opCopy   = 1
+
+	// minCopyLength はコピーにする最小の一致の長さです
+	// これより短い一致は COPY の見出しの方が大きくなりやすいため、挿入します。
+	minCopyLength = 8
+
+	// maxChain は1回の検索で調べるハッシュチェーンの候補の数です
+	maxChain = 256
+
+	// maxQuery は1回の検索で比べる長さです（これより長い一致は検索の後で延ばします）
+	maxQuery = 4 << 10
+)
+
+// ErrBaseMismatch はパッチを作成したときと異なる古いファイルに適用しようとしたことを表します
+var ErrBaseMismatch = errors.New("delta: patch does not match the base file")
+
+// Stats はパッチの内容の集計です
+type Stats struct {
+	OldSize       int `json:"old_size"`       // 古いファイルのサイズ
+	NewSize       int `json:"new_size"`       // 新しいファイルのサイズ
+	Copies        int `json:"copies"`         // COPY の数
+	Inserts       int `json:"inserts"`        // INSERT の数
+	CopiedBytes   int `json:"copied_bytes"`   // 古いファイルからコピーしたバイト数
+	InsertedBytes int `json:"inserted_bytes"` // パッチに含めたバイト数
+}
+
+// header はパッチの見出しです
+type header struct {
+	oldSize, newSize int
+	oldCRC, newCRC   uint32
+}
+
+// Diff は old を new に変換するパッチを作成します
+func Diff(old, new []byte) ([]byte, error) {
+	patch := append([]byte(patchMagic), Version)
+	patch = binary.AppendUvarint(patch, uint64(len(old)))
+	patch = binary.BigEndian.AppendUint32(patch, crc32.ChecksumIEEE(old))
+	patch = binary.AppendUvarint(patch, uint64(len(new)))
+	patch = binary.BigEndian.AppendUint32(patch, crc32.ChecksumIEEE(new))
+
+	idx := lz77.NewIndex(old)
+	insertStart, copyEnd := 0, 0
+	flush := func(end int) {
+		if end > insertStart {
+			patch = append(patch, opInsert)
+			patch = binary.AppendUvarint(patch, uint64(end-insertStart))
+			patch = append(patch, new[insertStart:end]...)
+		}
+	}
+
+	for pos := 0; pos < len(new); {
+		// 直前の COPY の続きを先に調べる（変更のない部分は索引を使わずに長くコピーできる）
+		offset, length := copyEnd, commonPrefix(old[copyEnd:], new[pos:])
+		if length < maxQuery {
+			if m := idx.FindLimited(new[pos:min(pos+maxQuery, len(new))], maxChain); m.Length > length {
+				offset, length = len(old)-m.Distance, m.Length
+			}
+			if length == maxQuery {
+				length += commonPrefix(old[offset+length:], new[pos+length:])
+			}
+		}
+		if length < minCopyLength {
+			pos++
+			continue
+		}
+
+		flush(pos)
+		patch = append(patch, opCopy)
+		patch = binary.AppendVarint(patch, int64(offset-copyEnd))
+		patch = binary.AppendUvarint(patch, uint64(length))
+		pos += length
+		insertStart, copyEnd = pos, offset+length
+	}
+	flush(len(new))
+	return patch, nil
+}
+
+// commonPrefix は a と b の先頭から一致するバイト数を返します
+func commonPrefix(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Apply は old に patch を適用して新しいファイルを返します
+// old のサイズかチェックサムがパッチと異なる場合は ErrBaseMismatch を、パッチが壊れている
+// 場合は common.ErrInvalidData を、新しい形式のパッチは *common.ErrUnsupportedVersion を返します。
+func Apply(old, patch []byte) ([]byte, error) {
+	h, pos, err := parseHeader(patch)
+	if err != nil {
+		return nil, err
+	}
+	if len(old) != h.oldSize {
+		return nil, fmt.Errorf("%w: base has %d bytes, patch expects %d", ErrBaseMismatch, len(old), h.oldSize)
+	}
+	if crc := crc32.ChecksumIEEE(old); crc != h.oldCRC {
+		return nil, fmt.Errorf("%w: base checksum %08x, patch expects %08x", ErrBaseMismatch, crc, h.oldCRC)
+	}
+
+	// 見出しのサイズは信用せず、確保する大きさはパッチと古いファイルから決める
+	result := make([]byte, 0, min(h.newSize, len(old)+len(patch)))
+	err = walkOps(patch, pos, h, func(pos, offset, length int, literals []byte) error {
+		if len(result)+length > h.newSize {
+			return common.NewDecodeError("delta", patch, pos, "output exceeds %d bytes", h.newSize)
+		}
+		if literals != nil {
+			result = append(result, literals...)
+		} else {
+			result = append(result, old[offset:offset+length]...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != h.newSize {
+		return nil, common.NewDecodeError("delta", patch, len(patch), "output has %d bytes, want %d", len(result), h.newSize)
+	}
+	if crc := crc32.ChecksumIEEE(result); crc != h.newCRC {
+		return nil, common.NewDecodeError("delta", patch, len(patch), "checksum mismatch: expected %08x, got %08x", h.newCRC, crc)
+	}
+	return result, nil
+}
+
+// Inspect はパッチの操作を集計します（古いファイルは必要ありません）
+func Inspect(patch []byte) (Stats, error) {
+	h, pos, err := parseHeader(patch)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{OldSize: h.oldSize, NewSize: h.newSize}
+	err = walkOps(patch, pos, h, func(_, _, length int, literals []byte) error {
+		if literals != nil {
+			stats.Inserts++
+			stats.InsertedBytes += length
+		} else {
+			stats.Copies++
+			stats.CopiedBytes += length
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// parseHeader はパッチの見出しを読み取り、操作の並びの先頭の位置を返します
+func parseHeader(patch []byte) (header, int, error) {
+	var h header
+	if len(patch) < len(patchMagic)+1 || string(patch[:len(patchMagic)]) != patchMagic {
+		return h, 0, common.NewDecodeError("delta", patch, 0, "invalid magic")
+	}
+	if v := patch[len(patchMagic)]; v > Version {
+		return h, 0, &common.ErrUnsupportedVersion{Format: "delta", Have: v, Max: Version}
+	} else if v == 0 {
+		return h, 0, common.NewDecodeError("delta", patch, len(patchMagic), "invalid version 0")
+	}
+
+	pos := len(patchMagic) + 1
+	field := func(name string) (int, uint32, error) {
+		size, n := binary.Uvarint(patch[pos:])
+		if n <= 0 || size > math.MaxInt32 {
+			return 0, 0, common.NewDecodeError("delta", patch, pos, "invalid %s size", name)
+		}
+		pos += n
+		if len(patch)-pos < 4 {
+			return 0, 0, common.NewDecodeError("delta", patch, pos, "missing %s checksum", name)
+		}
+		pos += 4
+		return int(size), binary.BigEndian.Uint32(patch[pos-4:]), nil
+	}
+	var err error
+	if h.oldSize, h.oldCRC, err = field("base"); err != nil {
+		return h, 0, err
+	}
+	if h.newSize, h.newCRC, err = field("output"); err != nil {
+		return h, 0, err
+	}
+	return h, pos, nil
+}
+
+// walkOps は pos からパッチの操作を順に読み取り、fn を呼び出します
+// INSERT は literals にバイト列を、COPY は古いファイルの範囲を offset と length で渡します
+// （literals は nil）。COPY の範囲が古いファイルに収まることは確認済みです。
+func walkOps(patch []byte, pos int, h header, fn func(pos, offset, length int, literals []byte) error) error {
+	copyEnd := 0
+	for pos < len(patch) {
+		start := pos
+		switch patch[pos] {
+		case opInsert:
+			length, n := binary.Uvarint(patch[pos+1:])
+			if n <= 0 || length == 0 || length > uint64(len(patch)-pos-1-n) {
+				return common.NewDecodeError("delta", patch, pos+1, "invalid insert length")
+			}
+			pos += 1 + n + int(length)
+			if err := fn(start, 0, int(length), patch[pos-int(length):pos]); err != nil {
+				return err
+			}
+		case opCopy:
+			delta, n := binary.Varint(patch[pos+1:])
+			if n <= 0 {
+				return common.NewDecodeError("delta", patch, pos+1, "invalid copy offset")
+			}
+			pos += 1 + n
+			length, n := binary.Uvarint(patch[pos:])
+			if n <= 0 || length == 0 {
+				return common.NewDecodeError("delta", patch, pos, "invalid copy length")
+			}
+			pos += n
+			offset := int64(copyEnd) + delta
+			if offset < 0 || length > uint64(h.oldSize) || offset > int64(h.oldSize)-int64(length) {
+				return common.NewDecodeError("delta", patch, start, "copy of %d bytes at %d is outside the base (%d bytes)", length, offset, h.oldSize)
+			}
+			if err := fn(start, int(offset), int(length), nil); err != nil {
+				return err
+			}
+			copyEnd = int(offset) + int(length)
+		default:
+			return common.NewDecodeError("delta", patch, pos, "unknown operation %d", patch[pos])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// logFile は行番号の入ったログのようなテキストを作成します
+func logFile(lines int) []byte {
+	var buf bytes.Buffer
+	for i := range lines {
+		fmt.Fprintf(&buf, "2024-05-01T12:%02d:%02d level=info request=%d path=/api/items/%d status=200\n", i/60%60, i%60, i, i*7%1000)
+	}
+	return buf.Bytes()
+}
+
+// roundTrip は old から new へのパッチを作成して適用し、結果を確認します
+func roundTrip(t *testing.T, old, new []byte) []byte {
+	t.Helper()
+	patch, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	got, err := Apply(old, patch)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(got, new) {
+		t.Fatalf("Apply returned %d bytes, want %d", len(got), len(new))
+	}
+	return patch
+}
+
+func TestDiff_NearIdentical(t *testing.T) {
+	old := logFile(2000)
+
+	// 途中の数行を書き換え、1行を削除し、末尾に1行を追加する
+	new := bytes.Replace(old, []byte("request=500 "), []byte("request=500 retry=1 "), 1)
+	new = bytes.Replace(new, []byte("status=200\n2024-05-01T12:16:40"), []byte("status=503\n2024-05-01T12:16:40"), 1)
+	line := bytes.Index(new, []byte("2024-05-01T12:25:00"))
+	end := line + bytes.IndexByte(new[line:], '\n') + 1
+	new = append(new[:line:line], new[end:]...)
+	new = append(new, "2024-05-01T13:00:00 level=warn shutting down\n"...)
+
+	patch := roundTrip(t, old, new)
+	stats, err := Inspect(patch)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if len(patch) > 200 {
+		t.Errorf("Patch for a few edits in %d bytes is too large: %d bytes (%+v)", len(old), len(patch), stats)
+	}
+	if stats.OldSize != len(old) || stats.NewSize != len(new) || stats.CopiedBytes+stats.InsertedBytes != len(new) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// 同じファイルのパッチは見出しと1つの COPY だけ
+	patch = roundTrip(t, old, old)
+	if stats, _ := Inspect(patch); stats.Copies != 1 || stats.Inserts != 0 {
+		t.Errorf("Expected a single copy for identical files, got %+v", stats)
+	}
+}
+
+func TestDiff_Unrelated(t *testing.T) {
+	old := testcorpus.Random(20000, 1)
+	new := testcorpus.Random(20000, 2)
+
+	patch := roundTrip(t, old, new)
+	stats, _ := Inspect(patch)
+	if stats.InsertedBytes < len(new)*99/100 {
+		t.Errorf("Expected mostly inserts for unrelated files, got %+v", stats)
+	}
+	// 見出しと INSERT の長さの分だけ大きくなる
+	if len(patch) > len(new)+64 {
+		t.Errorf("Patch of unrelated files is %d bytes for %d bytes of input", len(patch), len(new))
+	}
+}
+
+func TestDiff_EdgeCases(t *testing.T) {
+	samples := testcorpus.Samples()
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"both empty", nil, nil},
+		{"empty base", nil, []byte("hello")},
+		{"empty output", []byte("hello"), nil},
+		{"moved blocks", append(logFile(100), testcorpus.Cycle(5000)...), append(testcorpus.Cycle(5000), logFile(100)...)},
+		{"repeated base", bytes.Repeat([]byte{0}, 100000), bytes.Repeat([]byte{0}, 150000)},
+	}
+	for _, s := range samples {
+		tests = append(tests, struct {
+			name     string
+			old, new []byte
+		}{s.Name, s.Data, append(append([]byte{}, s.Data...), s.Data...)})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, tt.old, tt.new)
+		})
+	}
+}
+
+func TestApply_WrongBase(t *testing.T) {
+	old := logFile(500)
+	new := append(logFile(500), "appended\n"...)
+	patch, _ := Diff(old, new)
+
+	modified := bytes.Clone(old)
+	modified[1000] ^= 1
+	if _, err := Apply(modified, patch); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("Expected ErrBaseMismatch for a modified base, got %v", err)
+	}
+	if _, err := Apply(old[:len(old)-1], patch); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("Expected ErrBaseMismatch for a truncated base, got %v", err)
+	}
+	if _, err := Apply(new, patch); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("Expected ErrBaseMismatch when applying to the new file, got %v", err)
+	}
+}
+
+func TestApply_InvalidPatch(t *testing.T) {
+	old := logFile(200)
+	new := bytes.Replace(old, []byte("status=200"), []byte("status=404"), 3)
+	patch, _ := Diff(old, new)
+
+	for i := range patch {
+		corrupted := bytes.Clone(patch)
+		corrupted[i] ^= 0x55
+		got, err := Apply(old, corrupted)
+		switch {
+		case err == nil && !bytes.Equal(got, new):
+			t.Fatalf("Corruption at %d was not detected", i)
+		case err != nil && !errors.Is(err, common.ErrInvalidData) && !errors.Is(err, ErrBaseMismatch):
+			var unsupported *common.ErrUnsupportedVersion
+			if !errors.As(err, &unsupported) {
+				t.Fatalf("Unexpected error for corruption at %d: %v", i, err)
+			}
+		}
+	}
+	for n := range len(patch) {
+		if _, err := Apply(old, patch[:n]); err == nil {
+			t.Fatalf("Truncated patch of %d bytes was accepted", n)
+		}
+	}
+
+	newer := bytes.Clone(patch)
+	newer[len(patchMagic)] = Version + 1
+	var unsupported *common.ErrUnsupportedVersion
+	if _, err := Apply(old, newer); !errors.As(err, &unsupported) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
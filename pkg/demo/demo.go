@@ -0,0 +1,211 @@
+// Package demo renders encoder trace events as terminal frames.
+// エンコーダーが common.Tracer に通知したイベントを1つずつ受け取り、入力のどこを
+// 符号化しているか（ラン、マッチとその参照元）と、出力が増えていく様子を
+// ANSIエスケープシーケンスだけで描いた1画面（フレーム）として書き込みます。
+// エンコーダーは表示について何も知らず、フレームは io.Writer に書き込むだけなので、
+// 端末がなくてもフレームを比べてテストできます。対応するイベントは rle.RunEvent と
+// lz77.StepEvent です。
+package demo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// ANSIエスケープシーケンス
+const (
+	clearScreen  = "\x1b[H\x1b[2J"
+	styleDone    = "\x1b[2m"    // 符号化済みの範囲（薄く表示）
+	styleCurrent = "\x1b[7m"    // このステップで符号化する範囲（反転）
+	styleSource  = "\x1b[4;36m" // LZ77のマッチの参照元（下線、シアン）
+	styleReset   = "\x1b[0m"
+)
+
+const (
+	// DefaultWidth は入力を表示するときの1行のバイト数のデフォルトです
+	DefaultWidth = 32
+
+	// maxInputLines は表示する入力の最大の行数です（今のステップの周辺だけを表示します）
+	maxInputLines = 8
+
+	// codesPerLine と maxOutputLines は出力の符号を表示するときの1行の個数と最大の行数です
+	// 行数を超えた分は古い方から省略します。
+	codesPerLine   = 8
+	maxOutputLines = 6
+)
+
+// Renderer はトレースのイベントからフレームを作成します
+// イベントは圧縮で通知された順に渡す必要があり、Renderer はそれまでの出力を覚えています。
+type Renderer struct {
+	// Total はイベントの総数です（0の場合はステップ番号だけを表示します）
+	Total int
+
+	input       []byte
+	width       int
+	steps       int
+	codes       []string // 出力した符号の表示
+	outputBytes int      // 出力したバイト数
+}
+
+// NewRenderer は input を圧縮したときのイベントを表示する Renderer を作成します
+// width は入力を表示するときの1行のバイト数で、0以下の場合は DefaultWidth です。
+func NewRenderer(input []byte, width int) *Renderer {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	return &Renderer{input: input, width: width}
+}
+
+// step は1つのイベントを表示用にまとめたものです
+type step struct {
+	name             string // アルゴリズム名
+	start, end       int    // このステップで符号化する範囲 input[start:end]
+	srcStart, srcEnd int    // マッチの参照元 input[srcStart:srcEnd]（なければ空）
+	desc             string // ステップの説明
+	code             string // 出力に追加する符号の表示
+	size             int    // 符号のバイト数
+}
+
+// Supports は event が Renderer で表示できるイベントかどうかを返します
+func Supports(event any) bool {
+	switch event.(type) {
+	case rle.RunEvent, lz77.StepEvent:
+		return true
+	}
+	return false
+}
+
+// Render は event の次のフレームを w に書き込みます
+// 画面を消去してから、入力、ステップの説明、それまでの出力、操作方法を表示します。
+func (r *Renderer) Render(w io.Writer, event any) error {
+	var s step
+	switch e := event.(type) {
+	case rle.RunEvent:
+		s = runStep(e)
+	case lz77.StepEvent:
+		s = lz77Step(e)
+	default:
+		return fmt.Errorf("demo: unsupported event %T", event)
+	}
+	s.start, s.end = r.clamp(s.start), r.clamp(s.end)
+	s.srcStart, s.srcEnd = r.clamp(s.srcStart), r.clamp(s.srcEnd)
+
+	r.steps++
+	r.codes = append(r.codes, s.code)
+	r.outputBytes += s.size
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	if r.Total > 0 {
+		fmt.Fprintf(&b, "TinyZipZap デモ: %s  ステップ %d/%d\n\n", s.name, r.steps, r.Total)
+	} else {
+		fmt.Fprintf(&b, "TinyZipZap デモ: %s  ステップ %d\n\n", s.name, r.steps)
+	}
+	fmt.Fprintf(&b, "入力 (%d バイト):\n", len(r.input))
+	r.writeInput(&b, s)
+	fmt.Fprintf(&b, "\n%s\n\n", s.desc)
+	fmt.Fprintf(&b, "出力 (%d バイト):\n", r.outputBytes)
+	r.writeOutput(&b)
+	b.WriteString("\n")
+	if r.Total > 0 && r.steps >= r.Total {
+		fmt.Fprintf(&b, "完了: %d バイト -> %d バイト\n", len(r.input), r.outputBytes)
+	} else {
+		b.WriteString("[スペース] 次へ  [a] 自動再生  [q] 終了\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runStep は RLE の組を1つ出力したステップです
+func runStep(e rle.RunEvent) step {
+	start := int(e.Position)
+	return step{
+		name:  "RLE",
+		start: start, end: start + e.Length,
+		desc: fmt.Sprintf("ラン: %q が %d 個続く -> 組 (%q, %d) を出力", rune(e.Byte), e.Length, rune(e.Byte), e.Length),
+		code: fmt.Sprintf("(%q,%d)", rune(e.Byte), e.Length),
+		size: 2,
+	}
+}
+
+// lz77Step は LZ77 のトークンを1つ決めたステップです
+func lz77Step(e lz77.StepEvent) step {
+	t := e.Token
+	s := step{name: "LZ77", start: e.Position, size: t.EncodedSize()}
+	if t.IsLiteral() {
+		s.end = e.Position + 1
+		s.desc = fmt.Sprintf("リテラル: ウィンドウ (%d バイト) に3バイト以上の一致がない -> %q をそのまま出力",
+			e.WindowSize, rune(t.Literal))
+		s.code = fmt.Sprintf("%q", rune(t.Literal))
+		return s
+	}
+	length, distance := int(t.Length), int(t.Distance)
+	s.end = e.Position + length + 1
+	s.srcStart, s.srcEnd = e.Position-distance, e.Position-distance+length
+	s.desc = fmt.Sprintf("マッチ: %d バイト前から %d バイト一致（候補 %d 個）+ 次の文字 %q -> (%d,%d,%q) を出力",
+		distance, length, len(e.Candidates), rune(t.Literal), distance, length, rune(t.Literal))
+	s.code = fmt.Sprintf("(%d,%d,%q)", distance, length, rune(t.Literal))
+	return s
+}
+
+// clamp は位置を入力の範囲に収めます
+func (r *Renderer) clamp(pos int) int {
+	return min(max(pos, 0), len(r.input))
+}
+
+// writeInput は今のステップの周辺の入力を、範囲ごとの色を付けて書き込みます
+func (r *Renderer) writeInput(b *strings.Builder, s step) {
+	lines := (len(r.input) + r.width - 1) / r.width
+	first := max(0, min(s.start/r.width-maxInputLines/2, lines-maxInputLines))
+	last := min(lines, first+maxInputLines)
+
+	for line := first; line < last; line++ {
+		start := line * r.width
+		end := min(start+r.width, len(r.input))
+		fmt.Fprintf(b, "  %04x  ", start)
+		current := styleReset
+		for i := start; i < end; i++ {
+			style := styleReset
+			switch {
+			case i >= s.start && i < s.end:
+				style = styleCurrent
+			case i >= s.srcStart && i < s.srcEnd:
+				style = styleSource
+			case i < s.start:
+				style = styleDone
+			}
+			if style != current {
+				b.WriteString(style)
+				current = style
+			}
+			b.WriteByte(printable(r.input[i]))
+		}
+		b.WriteString(styleReset + "\n")
+	}
+}
+
+// writeOutput はそれまでに出力した符号を書き込みます（古い行は省略します）
+func (r *Renderer) writeOutput(b *strings.Builder) {
+	lines := (len(r.codes) + codesPerLine - 1) / codesPerLine
+	first := max(0, lines-maxOutputLines)
+	if first > 0 {
+		fmt.Fprintf(b, "  ...（%d 個省略）\n", first*codesPerLine)
+	}
+	for line := first; line < lines; line++ {
+		codes := r.codes[line*codesPerLine : min((line+1)*codesPerLine, len(r.codes))]
+		fmt.Fprintf(b, "  %s\n", strings.Join(codes, " "))
+	}
+}
+
+// printable は表示できない文字を '.' にします
+func printable(c byte) byte {
+	if c < 0x20 || c >= 0x7F {
+		return '.'
+	}
+	return c
+}
@@ -0,0 +1,157 @@
+package demo
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+var update = flag.Bool("update", false, "testdata/*.golden を書き換える")
+
+// traceEvents は c で input を圧縮したときのイベントを返します
+func traceEvents(t *testing.T, c common.Compressor, input []byte) []any {
+	t.Helper()
+	var events []any
+	traced, ok := common.WithTracer(c, common.TracerFunc(func(event any) {
+		events = append(events, event)
+	}))
+	if !ok {
+		t.Fatalf("%s does not support tracing", c.Name())
+	}
+	if _, err := traced.Compress(input); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	return events
+}
+
+// renderAll はすべてのイベントのフレームを順に書き込みます
+func renderAll(t *testing.T, input []byte, events []any) []byte {
+	t.Helper()
+	r := NewRenderer(input, 8)
+	r.Total = len(events)
+	var out bytes.Buffer
+	for _, event := range events {
+		if err := r.Render(&out, event); err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestRenderer_GoldenFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     common.Compressor
+		input string
+	}{
+		{"rle", rle.NewCompressor(), "aaabccdddd\n"},
+		{"lz77", lz77.NewCompressor(), "abcabcabcx abcd"},
+	}
+
+	for _, tt := range tests {
+		got := renderAll(t, []byte(tt.input), traceEvents(t, tt.c, []byte(tt.input)))
+		path := filepath.Join("testdata", tt.name+".golden")
+		if *update {
+			if err := os.WriteFile(path, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v (run go test ./pkg/demo -update)", tt.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: frames differ from %s; run go test ./pkg/demo -update and review the diff\n%s", tt.name, path, got)
+		}
+	}
+}
+
+func TestRenderer_Highlights(t *testing.T) {
+	input := []byte("abcabcabcx")
+	events := traceEvents(t, lz77.NewCompressor(), input)
+	r := NewRenderer(input, 0)
+
+	var frame bytes.Buffer
+	for _, event := range events {
+		frame.Reset()
+		if err := r.Render(&frame, event); err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		if !event.(lz77.StepEvent).Token.IsLiteral() {
+			break
+		}
+	}
+	// 最初のマッチは位置3から6バイト + 次の文字で、参照元は位置0から6バイト（マッチに重なる）
+	got := frame.String()
+	if !strings.Contains(got, styleSource+"abc"+styleCurrent+"abcabcx"+styleReset) {
+		t.Errorf("Expected the source and the match to be highlighted, got %q", got)
+	}
+	if !strings.Contains(got, "(3,6,'x')") || !strings.HasPrefix(got, clearScreen) {
+		t.Errorf("Expected the match token in the output, got %q", got)
+	}
+}
+
+func TestRenderer_Unsupported(t *testing.T) {
+	events := traceEvents(t, huffman.NewCompressor(), []byte("aab"))
+	if Supports(events[0]) {
+		t.Errorf("Expected %T to be unsupported", events[0])
+	}
+	if err := NewRenderer([]byte("aab"), 0).Render(&bytes.Buffer{}, events[0]); err == nil {
+		t.Error("Expected error for an unsupported event")
+	}
+}
+
+func TestRenderer_LongOutput(t *testing.T) {
+	// 出力が多い場合は古い符号を省略し、入力も今の位置の周辺だけを表示する
+	input := bytes.Repeat([]byte("ab"), 200)
+	events := traceEvents(t, rle.NewCompressor(), input)
+	r := NewRenderer(input, 16)
+	var frame bytes.Buffer
+	for _, event := range events {
+		frame.Reset()
+		r.Render(&frame, event)
+	}
+	got := frame.String()
+	if !strings.Contains(got, "個省略") || strings.Count(got, "\n") > 30 {
+		t.Errorf("Expected a bounded frame, got %d lines:\n%s", strings.Count(got, "\n"), got)
+	}
+	if !strings.Contains(got, "  0180  ") || strings.Contains(got, "  0000  ") {
+		t.Errorf("Expected only the lines around the last step, got:\n%s", got)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	input := []byte("aaabccdddd")
+	events := traceEvents(t, rle.NewCompressor(), input)
+	frames := func(keys string) int {
+		var out bytes.Buffer
+		if err := Play(strings.NewReader(keys), &out, NewRenderer(input, 0), events, time.Millisecond); err != nil {
+			t.Fatalf("Play failed: %v", err)
+		}
+		if !strings.HasSuffix(out.String(), showCursor) {
+			t.Error("Expected the cursor to be restored")
+		}
+		return strings.Count(out.String(), clearScreen)
+	}
+
+	if n := frames(" q"); n != 2 {
+		t.Errorf("Expected 2 frames after space and q, got %d", n)
+	}
+	if n := frames("a"); n != len(events) {
+		t.Errorf("Expected autoplay to show all %d frames, got %d", len(events), n)
+	}
+	// 入力が終わった場合も自動再生で最後まで表示する
+	if n := frames(""); n != len(events) {
+		t.Errorf("Expected all %d frames at end of input, got %d", len(events), n)
+	}
+}
@@ -0,0 +1,91 @@
+package demo
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	hideCursor = "\x1b[?25l"
+	showCursor = "\x1b[?25h"
+)
+
+// Play は events のフレームを順に out に表示し、in から読んだキーでステップを進めます
+// スペースか Enter で次へ進み、a で自動再生（interval ごとに次へ進む）を切り替え、
+// q で終了します。in が終わった場合は自動再生で最後まで表示します。
+// 端末で1文字ずつ読むには、呼び出し側で端末を cbreak モードにしてください。
+// in を読むゴルーチンは、Play が戻った後も読んでいる途中の Read が終わるまで残ります。
+func Play(in io.Reader, out io.Writer, r *Renderer, events []any, interval time.Duration) error {
+	if r.Total == 0 {
+		r.Total = len(events)
+	}
+	if _, err := io.WriteString(out, hideCursor); err != nil {
+		return err
+	}
+	defer io.WriteString(out, showCursor)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	keys := readKeys(in, stop)
+	auto := false
+	for i, event := range events {
+		if err := r.Render(out, event); err != nil {
+			return err
+		}
+		if i == len(events)-1 {
+			break
+		}
+
+	wait:
+		for {
+			var timeout <-chan time.Time
+			if auto || keys == nil {
+				timeout = time.After(interval)
+			}
+			select {
+			case key, ok := <-keys:
+				if !ok {
+					keys = nil
+					continue
+				}
+				switch key {
+				case ' ', '\n', '\r':
+					break wait
+				case 'a':
+					if auto = !auto; auto {
+						break wait
+					}
+				case 'q':
+					return nil
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	return nil
+}
+
+// readKeys は in から1バイトずつ読み、in が終わったら閉じるチャネルを返します
+// stop が閉じられた後は、読んでいる途中の1文字を捨てて終了します。
+func readKeys(in io.Reader, stop <-chan struct{}) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		var buf [1]byte
+		for {
+			n, err := in.Read(buf[:])
+			if n > 0 {
+				select {
+				case keys <- buf[0]:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
@@ -0,0 +1,291 @@
+// Package dict implements preset-dictionary training and storage.
+// 似た構造の小さなデータ（JSONメッセージなど）は、1件ずつ圧縮すると履歴が
+// 空の状態から始まるため圧縮が効きません。よく現れる部分文字列を集めた
+// 辞書を事前に用意し、LZ77の履歴として使うことで最初からマッチを見つけられます。
+package dict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/fileutil"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// ファイルフォーマット
+//
+//	マジック "TZD" + バージョン(1バイト) + CRC32(4バイト, 内容のハッシュ) + 内容の長さ(uvarint) + 内容
+const (
+	magic   = "TZD"
+	version = 1
+
+	// kmerSize は頻度を数える部分文字列の長さです
+	kmerSize = 8
+
+	// segmentSize は辞書に追加する区間の長さです（LZ77の最大マッチ長より少し長め）
+	segmentSize = 32
+)
+
+// Dictionary は学習済みの辞書です
+type Dictionary struct {
+	Content []byte // 辞書の内容（LZ77の履歴として使用）
+	Hash    uint32 // 内容のCRC32（辞書の識別に使用）
+}
+
+// New は内容から辞書を作成します
+func New(content []byte) *Dictionary {
+	return &Dictionary{
+		Content: content,
+		Hash:    crc32.ChecksumIEEE(content),
+	}
+}
+
+// Train はサンプルデータの集合から最大 maxSize バイトの辞書を学習します
+//
+// 簡易的なcoverアルゴリズムです:
+//  1. 長さ kmerSize の部分文字列が何個のサンプルに現れるかを数える
+//  2. 区間に含まれる部分文字列の頻度の合計が最大になる区間を選んで辞書に追加する
+//  3. 選んだ区間の部分文字列の頻度を0にして（重複を避けるため）2に戻る
+//
+// 価値の高い区間ほど辞書の末尾（圧縮対象のデータに近い位置）に配置します。
+func Train(samples [][]byte, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("dict: invalid dictionary size: %d", maxSize)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("dict: no samples")
+	}
+
+	freq := countKmers(samples)
+
+	var segments [][]byte
+	size := 0
+	for size < maxSize {
+		segment := bestSegment(samples, freq)
+		if segment == nil {
+			break
+		}
+		if size+len(segment) > maxSize {
+			segment = segment[len(segment)-(maxSize-size):]
+		}
+
+		segments = append(segments, segment)
+		size += len(segment)
+
+		// 選んだ区間の部分文字列はもう価値がない
+		for i := 0; i+kmerSize <= len(segment); i++ {
+			delete(freq, string(segment[i:i+kmerSize]))
+		}
+	}
+
+	if size == 0 {
+		return nil, fmt.Errorf("dict: samples have no repeated content")
+	}
+
+	// 最初に選んだ（最も価値の高い）区間を末尾に置く
+	content := make([]byte, 0, size)
+	for i := len(segments) - 1; i >= 0; i-- {
+		content = append(content, segments[i]...)
+	}
+	return content, nil
+}
+
+// countKmers は各部分文字列が現れるサンプル数を数えます
+// 1つのサンプル内での繰り返しはLZ77自身が圧縮できるので、1回として数えます
+func countKmers(samples [][]byte) map[string]int {
+	freq := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+kmerSize <= len(sample); i++ {
+			kmer := string(sample[i : i+kmerSize])
+			if !seen[kmer] {
+				seen[kmer] = true
+				freq[kmer]++
+			}
+		}
+	}
+
+	// 1つのサンプルにしか現れない部分文字列は辞書に入れても役に立たない
+	for kmer, count := range freq {
+		if count < 2 {
+			delete(freq, kmer)
+		}
+	}
+	return freq
+}
+
+// bestSegment は部分文字列の頻度の合計が最大の区間を返します（見つからなければnil）
+func bestSegment(samples [][]byte, freq map[string]int) []byte {
+	var best []byte
+	bestScore := 0
+
+	for _, sample := range samples {
+		if len(sample) < kmerSize {
+			continue
+		}
+
+		// 各位置の部分文字列の頻度
+		scores := make([]int, len(sample)-kmerSize+1)
+		for i := range scores {
+			scores[i] = freq[string(sample[i:i+kmerSize])]
+		}
+
+		// 区間内のスコアの合計をスライディングウィンドウで計算
+		span := segmentSize - kmerSize + 1
+		if span > len(scores) {
+			span = len(scores)
+		}
+		score := 0
+		for i := 0; i < span; i++ {
+			score += scores[i]
+		}
+		for start := 0; ; start++ {
+			if score > bestScore {
+				bestScore = score
+				end := start + span - 1 + kmerSize
+				best = sample[start:end]
+			}
+			if start+span >= len(scores) {
+				break
+			}
+			score += scores[start+span] - scores[start]
+		}
+	}
+
+	if bestScore == 0 {
+		return nil
+	}
+	return append([]byte(nil), best...)
+}
+
+// MarshalBinary は辞書をヘッダー付きのファイル形式に変換します
+func (d *Dictionary) MarshalBinary() ([]byte, error) {
+	result := make([]byte, 0, len(magic)+1+4+binary.MaxVarintLen64+len(d.Content))
+	result = append(result, magic...)
+	result = append(result, version)
+	result = binary.BigEndian.AppendUint32(result, d.Hash)
+	result = binary.AppendUvarint(result, uint64(len(d.Content)))
+	result = append(result, d.Content...)
+	return result, nil
+}
+
+// Parse はファイル形式の辞書を読み込み、ハッシュを検証します
+func Parse(data []byte) (*Dictionary, error) {
+	headerSize := len(magic) + 1 + 4
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("dict: invalid dictionary header")
+	}
+	if v := data[len(magic)]; v > version {
+		return nil, &common.ErrUnsupportedVersion{Format: "dict", Have: v, Max: version}
+	} else if v != version {
+		return nil, fmt.Errorf("dict: unsupported dictionary version: %d", v)
+	}
+
+	hash := binary.BigEndian.Uint32(data[len(magic)+1:])
+	length, n := binary.Uvarint(data[headerSize:])
+	if n <= 0 {
+		return nil, fmt.Errorf("dict: invalid content length")
+	}
+	content := data[headerSize+n:]
+	if uint64(len(content)) != length {
+		return nil, fmt.Errorf("dict: content length mismatch: expected %d, got %d", length, len(content))
+	}
+
+	d := New(bytes.Clone(content))
+	if d.Hash != hash {
+		return nil, fmt.Errorf("dict: hash mismatch: expected %08x, got %08x", hash, d.Hash)
+	}
+	return d, nil
+}
+
+// Load はファイルから辞書を読み込みます
+func Load(path string) (*Dictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Save は辞書をファイルに書き込みます
+func (d *Dictionary) Save(path string) error {
+	data, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(path, data, fileutil.Options{Overwrite: true})
+}
+
+// Stats は辞書の統計情報です
+type Stats struct {
+	Size          int      // 内容のサイズ
+	Hash          uint32   // 内容のCRC32
+	Entropy       float64  // エントロピー (bits/byte)
+	PrintableRate float64  // 表示可能なASCII文字の割合
+	TopSegments   []string // 出現頻度の高い部分文字列（最大5件）
+}
+
+// Inspect は辞書の統計情報を計算します
+func (d *Dictionary) Inspect() Stats {
+	stats := Stats{
+		Size:    len(d.Content),
+		Hash:    d.Hash,
+		Entropy: common.CalculateEntropy(d.Content),
+	}
+
+	printable := 0
+	for _, b := range d.Content {
+		if b >= 0x20 && b < 0x7F || b == '\n' || b == '\t' {
+			printable++
+		}
+	}
+	if len(d.Content) > 0 {
+		stats.PrintableRate = float64(printable) / float64(len(d.Content))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i+kmerSize <= len(d.Content); i++ {
+		counts[string(d.Content[i:i+kmerSize])]++
+	}
+	kmers := make([]string, 0, len(counts))
+	for kmer := range counts {
+		kmers = append(kmers, kmer)
+	}
+	sort.Slice(kmers, func(i, j int) bool {
+		if counts[kmers[i]] != counts[kmers[j]] {
+			return counts[kmers[i]] > counts[kmers[j]]
+		}
+		return kmers[i] < kmers[j]
+	})
+	if len(kmers) > 5 {
+		kmers = kmers[:5]
+	}
+	stats.TopSegments = kmers
+
+	return stats
+}
+
+// PrintStats は辞書の統計情報を表示します
+func PrintStats(stats Stats) {
+	FprintStats(os.Stdout, stats)
+}
+
+// FprintStats は PrintStats と同じ内容を w に書き込みます
+func FprintStats(w io.Writer, stats Stats) {
+	fmt.Fprintf(w, "=== 辞書情報 ===\n")
+	fmt.Fprintf(w, "サイズ:       %s (%d bytes)\n", common.FormatBytes(int64(stats.Size)), stats.Size)
+	fmt.Fprintf(w, "ハッシュ:     %08x\n", stats.Hash)
+	fmt.Fprintf(w, "エントロピー: %.3f bits/byte\n", stats.Entropy)
+	fmt.Fprintf(w, "表示可能文字: %.1f%%\n", stats.PrintableRate*100)
+	if len(stats.TopSegments) > 0 {
+		fmt.Fprintf(w, "頻出部分文字列:\n")
+		for _, segment := range stats.TopSegments {
+			fmt.Fprintf(w, "  %q\n", segment)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dict
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/golden"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+)
+
+// jsonSamples はJSON風の小さなメッセージを生成します
+func jsonSamples(n int, seed int64) [][]byte {
+	r := rand.New(rand.NewSource(seed))
+	names := []string{"alice", "bob", "carol", "dave", "eve", "frank"}
+	statuses := []string{"active", "inactive", "pending"}
+
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(
+			`{"id":%d,"user":{"name":"%s","email":"%s@example.com"},"status":"%s","score":%d,"tags":["customer","newsletter"]}`,
+			r.Intn(100000), names[r.Intn(len(names))], names[r.Intn(len(names))],
+			statuses[r.Intn(len(statuses))], r.Intn(1000)))
+	}
+	return samples
+}
+
+func TestTrain_ImprovesLZ77OnHeldOutSamples(t *testing.T) {
+	training := jsonSamples(200, 1)
+	heldOut := jsonSamples(20, 2)
+
+	content, err := Train(training, 4096)
+	if err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	if len(content) == 0 || len(content) > 4096 {
+		t.Fatalf("Unexpected dictionary size: %d", len(content))
+	}
+
+	plain := lz77.NewCompressor()
+	withDict := lz77.NewCompressorWithDict(content)
+
+	plainTotal, dictTotal := 0, 0
+	for _, sample := range heldOut {
+		p, err := plain.Compress(sample)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		d, err := withDict.Compress(sample)
+		if err != nil {
+			t.Fatalf("Compress with dictionary failed: %v", err)
+		}
+		plainTotal += len(p)
+		dictTotal += len(d)
+
+		decompressed, err := withDict.Decompress(d)
+		if err != nil {
+			t.Fatalf("Decompress with dictionary failed: %v", err)
+		}
+		if !bytes.Equal(sample, decompressed) {
+			t.Fatalf("Round trip mismatch")
+		}
+	}
+
+	t.Logf("held-out total: plain=%d bytes, dictionary=%d bytes", plainTotal, dictTotal)
+	if float64(dictTotal) > float64(plainTotal)*0.6 {
+		t.Errorf("Dictionary did not help enough: %d vs %d bytes", dictTotal, plainTotal)
+	}
+}
+
+func TestTrain_RespectsMaxSize(t *testing.T) {
+	content, err := Train(jsonSamples(50, 3), 100)
+	if err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	if len(content) > 100 {
+		t.Errorf("Dictionary size %d exceeds maximum 100", len(content))
+	}
+}
+
+func TestTrain_InvalidInput(t *testing.T) {
+	if _, err := Train(nil, 100); err == nil {
+		t.Error("Expected error for no samples")
+	}
+	if _, err := Train(jsonSamples(10, 1), 0); err == nil {
+		t.Error("Expected error for zero size")
+	}
+	// 共通する部分がないサンプル
+	if _, err := Train([][]byte{[]byte("abcdefghij"), []byte("klmnopqrst")}, 100); err == nil {
+		t.Error("Expected error when samples share no content")
+	}
+}
+
+func TestDictionary_SaveLoad(t *testing.T) {
+	content, err := Train(jsonSamples(50, 4), 512)
+	if err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	d := New(content)
+
+	path := filepath.Join(t.TempDir(), "app.dict")
+	if err := d.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !bytes.Equal(loaded.Content, content) || loaded.Hash != d.Hash {
+		t.Error("Loaded dictionary differs")
+	}
+
+	stats := loaded.Inspect()
+	if stats.Size != len(content) || stats.Hash != d.Hash {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.PrintableRate < 0.99 {
+		t.Errorf("Expected printable JSON dictionary, got %.2f", stats.PrintableRate)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	valid, _ := New([]byte("dictionary content")).MarshalBinary()
+
+	corrupted := bytes.Clone(valid)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	cases := map[string][]byte{
+		"empty":     {},
+		"magic":     append([]byte("XYZ"), valid[3:]...),
+		"version":   append([]byte("TZD\x09"), valid[4:]...),
+		"truncated": valid[:len(valid)-1],
+		"hash":      corrupted,
+	}
+	for name, data := range cases {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	var unsupported *common.ErrUnsupportedVersion
+	if _, err := Parse(cases["version"]); !errors.As(err, &unsupported) || unsupported.Have != 9 {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestFprintStats_Golden(t *testing.T) {
+	var out bytes.Buffer
+	FprintStats(&out, Stats{Size: 2048, Hash: 0xdeadbeef, Entropy: 4.25, PrintableRate: 0.97, TopSegments: []string{`"name":`, "tags"}})
+	FprintStats(&out, Stats{Size: 16, Hash: 1, Entropy: 8})
+	golden.Check(t, "stats", out.Bytes())
+}
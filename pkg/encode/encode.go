@@ -0,0 +1,221 @@
+// Package encode serializes Go values and compresses them in one call.
+// 値を encoding/gob または encoding/json でシリアライズし、登録済みのアルゴリズムで
+// 圧縮します。先頭にシリアライザとアルゴリズムの登録名を記録するため、Unmarshal は
+// どちらも指定せずに元の値に戻せます。キャッシュの値のように、構造体をそのまま
+// 小さく保存したい場合に使います。
+package encode
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// フォーマット
+//
+//	シリアライザ(1バイト) + アルゴリズム名の長さ(1バイト) + アルゴリズム名
+//	+ アルゴリズムの形式バージョン(1バイト、common.Versioned) + 圧縮データ
+//
+// アルゴリズム名は common.New で使う登録名です。圧縮データはシリアライズした
+// バイト列を Compress（StreamCompressor の場合は CompressStream）で圧縮したものです。
+const (
+	// maxNameLength はアルゴリズム名の最大長です
+	maxNameLength = 255
+)
+
+// Serializer は値をバイト列にする方式です
+type Serializer byte
+
+const (
+	// Gob は encoding/gob でシリアライズします（デフォルト）
+	Gob Serializer = 1
+	// JSON は encoding/json でシリアライズします
+	JSON Serializer = 2
+)
+
+// String はシリアライザの名前を返します
+func (s Serializer) String() string {
+	switch s {
+	case Gob:
+		return "gob"
+	case JSON:
+		return "json"
+	default:
+		return fmt.Sprintf("Serializer(%d)", byte(s))
+	}
+}
+
+var (
+	// ErrUnknownAlgorithm は記録されたアルゴリズムが登録されていない場合のエラーです
+	// アルゴリズムを登録するパッケージ（pkg/lz77 など）を import していないときに起こります。
+	ErrUnknownAlgorithm = errors.New("encode: algorithm is not registered")
+
+	// ErrInvalidData は先頭の記録が壊れている場合のエラーです
+	ErrInvalidData = errors.New("encode: invalid data")
+)
+
+// options は Marshal の設定です
+type options struct {
+	serializer Serializer
+	algorithm  string
+}
+
+// Option は Marshal の設定を変更します
+type Option func(*options)
+
+// WithSerializer はシリアライザを指定します（デフォルトは Gob）
+func WithSerializer(s Serializer) Option {
+	return func(o *options) {
+		o.serializer = s
+	}
+}
+
+// WithAlgorithm は記録するアルゴリズムの登録名を指定します
+// 省略した場合は、登録済みのアルゴリズムから c と同じ Name() のものを探します。
+// 設定を変えて作成した Compressor のように、Name() から登録名を決められない場合に使います。
+func WithAlgorithm(name string) Option {
+	return func(o *options) {
+		o.algorithm = name
+	}
+}
+
+// Marshal は v をシリアライズして c で圧縮します
+func Marshal(v any, c common.Compressor, opts ...Option) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := MarshalTo(&buf, v, c, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalTo は Marshal の結果を w に書き込みます
+// c が common.StreamCompressor を実装している場合は、シリアライズしながら圧縮するため、
+// シリアライズしたバイト列全体をメモリに保持しません。
+func MarshalTo(w io.Writer, v any, c common.Compressor, opts ...Option) error {
+	o := options{serializer: Gob}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.serializer != Gob && o.serializer != JSON {
+		return fmt.Errorf("encode: unknown serializer: %s", o.serializer)
+	}
+	name := o.algorithm
+	if name == "" {
+		var err error
+		if name, err = registeredName(c); err != nil {
+			return err
+		}
+	}
+	if len(name) == 0 || len(name) > maxNameLength {
+		return fmt.Errorf("encode: invalid algorithm name: %q", name)
+	}
+
+	header := []byte{byte(o.serializer), byte(len(name))}
+	header = append(header, name...)
+	header = append(header, common.FormatVersion(c))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	if sc, ok := c.(common.StreamCompressor); ok {
+		cw := common.NewCompressingWriter(w, sc)
+		if err := serialize(cw, v, o.serializer); err != nil {
+			cw.Close()
+			return err
+		}
+		return cw.Close()
+	}
+
+	var buf bytes.Buffer
+	if err := serialize(&buf, v, o.serializer); err != nil {
+		return err
+	}
+	compressed, err := c.Compress(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(compressed)
+	return err
+}
+
+// Unmarshal は Marshal の結果を展開して v に格納します
+// シリアライザとアルゴリズムは先頭の記録から決めます。
+func Unmarshal(data []byte, v any) error {
+	return UnmarshalFrom(bytes.NewReader(data), v)
+}
+
+// UnmarshalFrom は r から Marshal の結果を読み込み、展開して v に格納します
+// 記録されたアルゴリズムが common.StreamCompressor を実装している場合は、
+// 展開しながらデシリアライズします。
+func UnmarshalFrom(r io.Reader, v any) error {
+	var prefix [2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	serializer := Serializer(prefix[0])
+	if serializer != Gob && serializer != JSON {
+		return fmt.Errorf("%w: unknown serializer %d", ErrInvalidData, prefix[0])
+	}
+	rest := make([]byte, int(prefix[1])+1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	name, version := string(rest[:len(rest)-1]), rest[len(rest)-1]
+	if name == "" {
+		return fmt.Errorf("%w: empty algorithm name", ErrInvalidData)
+	}
+
+	c, err := common.New(name)
+	if err != nil {
+		return fmt.Errorf("%w: %q (import the package that registers it)", ErrUnknownAlgorithm, name)
+	}
+	if err := common.CheckFormatVersion(name, c, version); err != nil {
+		return err
+	}
+
+	if sc, ok := c.(common.StreamCompressor); ok {
+		dr := common.NewDecompressingReader(r, sc)
+		defer dr.Close()
+		return deserialize(dr, v, serializer)
+	}
+
+	compressed, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	data, err := c.Decompress(compressed)
+	if err != nil {
+		return err
+	}
+	return deserialize(bytes.NewReader(data), v, serializer)
+}
+
+// registeredName は c と同じ Name() を返す登録済みのアルゴリズムの登録名を返します
+func registeredName(c common.Compressor) (string, error) {
+	want := c.Name()
+	for _, name := range append(common.Names(), common.StoredAlgorithm) {
+		if candidate, err := common.New(name); err == nil && candidate.Name() == want {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("encode: no registered algorithm named %q (use WithAlgorithm)", want)
+}
+
+func serialize(w io.Writer, v any, s Serializer) error {
+	if s == JSON {
+		return json.NewEncoder(w).Encode(v)
+	}
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func deserialize(r io.Reader, v any, s Serializer) error {
+	if s == JSON {
+		return json.NewDecoder(r).Decode(v)
+	}
+	return gob.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,142 @@
+package encode
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
+)
+
+type item struct {
+	ID    int
+	Name  string
+	Tags  []string
+	Price float64
+}
+
+type catalog struct {
+	Title   string
+	Items   []item
+	Index   map[string]int
+	Parent  *item
+	Version uint8
+}
+
+func sampleCatalog() catalog {
+	c := catalog{Title: "store", Index: map[string]int{}, Parent: &item{ID: -1, Name: "root"}, Version: 3}
+	for i := range 200 {
+		name := strings.Repeat("widget-", i%5+1)
+		c.Items = append(c.Items, item{ID: i, Name: name, Tags: []string{"a", "b"}, Price: float64(i) / 4})
+		c.Index[name] = i
+	}
+	return c
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	want := sampleCatalog()
+	compressors := []common.Compressor{lz77.NewCompressor(), huffman.NewCompressor(), stdcompat.NewGzip()}
+
+	for _, c := range compressors {
+		for _, s := range []Serializer{Gob, JSON} {
+			t.Run(c.Name()+"/"+s.String(), func(t *testing.T) {
+				data, err := Marshal(want, c, WithSerializer(s))
+				if err != nil {
+					t.Fatalf("Marshal failed: %v", err)
+				}
+				var got catalog
+				if err := Unmarshal(data, &got); err != nil {
+					t.Fatalf("Unmarshal failed: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Round trip mismatch")
+				}
+
+				// ストリームの版も同じ形式で、相互に読み書きできる
+				var buf bytes.Buffer
+				if err := MarshalTo(&buf, want, c, WithSerializer(s)); err != nil {
+					t.Fatalf("MarshalTo failed: %v", err)
+				}
+				got = catalog{}
+				if err := UnmarshalFrom(&buf, &got); err != nil {
+					t.Fatalf("UnmarshalFrom failed: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Stream round trip mismatch")
+				}
+			})
+		}
+	}
+}
+
+func TestMarshal_Prefix(t *testing.T) {
+	data, err := Marshal([]int{1, 2, 3}, stdcompat.NewZlib(), WithSerializer(JSON))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if Serializer(data[0]) != JSON {
+		t.Errorf("Serializer byte = %d, want %d", data[0], JSON)
+	}
+	if name := string(data[2 : 2+int(data[1])]); name != "zlib" {
+		t.Errorf("Recorded algorithm = %q, want zlib", name)
+	}
+
+	// 同じ値でもシリアライザが違えば先頭が変わり、それぞれの方式で戻せる
+	gobData, err := Marshal([]int{1, 2, 3}, stdcompat.NewZlib())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if Serializer(gobData[0]) != Gob {
+		t.Errorf("Default serializer byte = %d, want %d", gobData[0], Gob)
+	}
+	for _, d := range [][]byte{data, gobData} {
+		var got []int
+		if err := Unmarshal(d, &got); err != nil || !reflect.DeepEqual(got, []int{1, 2, 3}) {
+			t.Errorf("Unmarshal = %v, %v", got, err)
+		}
+	}
+}
+
+func TestMarshal_WithAlgorithm(t *testing.T) {
+	c := lz77.NewCompressor(lz77.WithOptimalMatcher())
+	data, err := Marshal("hello", c, WithAlgorithm("lz77-optimal"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if name := string(data[2 : 2+int(data[1])]); name != "lz77-optimal" {
+		t.Errorf("Recorded algorithm = %q, want lz77-optimal", name)
+	}
+	var got string
+	if err := Unmarshal(data, &got); err != nil || got != "hello" {
+		t.Errorf("Unmarshal = %q, %v", got, err)
+	}
+}
+
+func TestUnmarshal_UnknownAlgorithm(t *testing.T) {
+	data, err := Marshal(map[string]int{"a": 1}, stdcompat.NewGzip(), WithAlgorithm("not-registered"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var got map[string]int
+	err = Unmarshal(data, &got)
+	if !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Fatalf("Unmarshal error = %v, want ErrUnknownAlgorithm", err)
+	}
+	if !strings.Contains(err.Error(), `"not-registered"`) {
+		t.Errorf("Error does not name the algorithm: %v", err)
+	}
+}
+
+func TestUnmarshal_InvalidData(t *testing.T) {
+	for _, data := range [][]byte{nil, {byte(Gob)}, {9, 1, 'x', 0}, {byte(JSON), 4, 'g', 'z'}, {byte(Gob), 0, 0}} {
+		var v any
+		if err := Unmarshal(data, &v); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("Unmarshal(%v) error = %v, want ErrInvalidData", data, err)
+		}
+	}
+}
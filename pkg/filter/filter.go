@@ -0,0 +1,250 @@
+// Package filter implements reversible pre-processing filters.
+// フィルタはデータを圧縮しやすい形に並べ替える可逆な変換です。それ自体はデータを
+// 小さくしませんが、固定長レコードの列などでは後段の圧縮の効果を大きく改善します。
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// Filter は可逆なデータ変換のインターフェースです
+// 実装は状態を持たず、複数のゴルーチンから同時に使用できる必要があります
+type Filter interface {
+	// Encode はデータを変換します
+	Encode(data []byte) ([]byte, error)
+
+	// Decode は Encode の変換を元に戻します
+	Decode(data []byte) ([]byte, error)
+
+	// Name はフィルタ名を返します
+	Name() string
+}
+
+// Transpose は固定長レコードの列を、各レコードの0バイト目、1バイト目...の順に並べ替えます
+// 末尾の不完全なレコードは並べ替えずにそのまま最後に置きます。
+func Transpose(data []byte, recordSize int) ([]byte, error) {
+	if recordSize < 1 {
+		return nil, fmt.Errorf("invalid record size: %d", recordSize)
+	}
+
+	records := len(data) / recordSize
+	full := records * recordSize
+	result := make([]byte, len(data))
+	for r := 0; r < records; r++ {
+		for p := 0; p < recordSize; p++ {
+			result[p*records+r] = data[r*recordSize+p]
+		}
+	}
+	copy(result[full:], data[full:])
+	return result, nil
+}
+
+// Untranspose は Transpose の並べ替えを元に戻します
+// 末尾の不完全なレコードの長さはデータ長とレコードサイズから決まります。
+func Untranspose(data []byte, recordSize int) ([]byte, error) {
+	if recordSize < 1 {
+		return nil, fmt.Errorf("invalid record size: %d", recordSize)
+	}
+
+	records := len(data) / recordSize
+	full := records * recordSize
+	result := make([]byte, len(data))
+	for r := 0; r < records; r++ {
+		for p := 0; p < recordSize; p++ {
+			result[r*recordSize+p] = data[p*records+r]
+		}
+	}
+	copy(result[full:], data[full:])
+	return result, nil
+}
+
+// Delta は各バイトを直前のバイトとの差に置き換えます（256を法とする）
+// ゆっくり増減する値の列が、同じ値の連続になります。
+func Delta(data []byte) []byte {
+	result := make([]byte, len(data))
+	prev := byte(0)
+	for i, b := range data {
+		result[i] = b - prev
+		prev = b
+	}
+	return result
+}
+
+// Undelta は Delta の変換を元に戻します
+func Undelta(data []byte) []byte {
+	result := make([]byte, len(data))
+	prev := byte(0)
+	for i, d := range data {
+		prev += d
+		result[i] = prev
+	}
+	return result
+}
+
+// transposeFilter はレコードサイズをヘッダーに保存する Transpose フィルタです
+type transposeFilter struct {
+	recordSize int
+}
+
+// NewTranspose はレコードサイズ recordSize の Transpose フィルタを作成します
+// 出力の先頭にレコードサイズ(uvarint)を保存するため、展開時は保存された値を使います。
+func NewTranspose(recordSize int) (Filter, error) {
+	if recordSize < 1 {
+		return nil, fmt.Errorf("invalid record size: %d", recordSize)
+	}
+	return transposeFilter{recordSize: recordSize}, nil
+}
+
+func (f transposeFilter) Name() string {
+	return fmt.Sprintf("Transpose(%d)", f.recordSize)
+}
+
+func (f transposeFilter) Encode(data []byte) ([]byte, error) {
+	transposed, err := Transpose(data, f.recordSize)
+	if err != nil {
+		return nil, err
+	}
+	result := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(data)), uint64(f.recordSize))
+	return append(result, transposed...), nil
+}
+
+func (f transposeFilter) Decode(data []byte) ([]byte, error) {
+	recordSize, n := binary.Uvarint(data)
+	if n <= 0 || recordSize < 1 || recordSize > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid filtered data: bad record size header")
+	}
+	return Untranspose(data[n:], int(recordSize))
+}
+
+// deltaFilter は Delta フィルタです
+type deltaFilter struct{}
+
+// NewDelta は Delta フィルタを作成します
+func NewDelta() Filter {
+	return deltaFilter{}
+}
+
+func (deltaFilter) Name() string                       { return "Delta" }
+func (deltaFilter) Encode(data []byte) ([]byte, error) { return Delta(data), nil }
+func (deltaFilter) Decode(data []byte) ([]byte, error) { return Undelta(data), nil }
+
+// Parse はカンマ区切りのフィルタ指定（例: "transpose:4,delta"、"remap:pack"、"nlnorm"）を解析します
+func Parse(spec string) ([]Filter, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var filters []Filter
+	for _, part := range strings.Split(spec, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(part), ":")
+		switch strings.ToLower(name) {
+		case "transpose":
+			if !hasArg {
+				return nil, fmt.Errorf("transpose requires a record size (e.g. transpose:4)")
+			}
+			size, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid record size %q: %w", arg, err)
+			}
+			f, err := NewTranspose(size)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, f)
+		case "delta":
+			if hasArg {
+				return nil, fmt.Errorf("delta takes no argument")
+			}
+			filters = append(filters, NewDelta())
+		case "remap":
+			if hasArg && !strings.EqualFold(arg, "pack") {
+				return nil, fmt.Errorf("remap takes no argument or \"pack\" (e.g. remap:pack)")
+			}
+			filters = append(filters, NewRemap(hasArg))
+		case "nlnorm":
+			if hasArg {
+				return nil, fmt.Errorf("nlnorm takes no argument")
+			}
+			filters = append(filters, NewlineNormalize())
+		default:
+			return nil, fmt.Errorf("unknown filter: %s", name)
+		}
+	}
+	return filters, nil
+}
+
+// Compressor はフィルタを順に適用してから圧縮するCompressorです
+// 展開時は圧縮を展開してから、フィルタを逆順に戻します。
+type Compressor struct {
+	filters []Filter
+	inner   common.Compressor
+}
+
+// NewCompressor は filters を適用してから inner で圧縮するCompressorを作成します
+func NewCompressor(inner common.Compressor, filters ...Filter) *Compressor {
+	return &Compressor{filters: filters, inner: inner}
+}
+
+// Name はアルゴリズム名を返します（例: "Transpose(4) + Delta + Run-Length Encoding (RLE)"）
+func (c *Compressor) Name() string {
+	names := make([]string, 0, len(c.filters)+1)
+	for _, f := range c.filters {
+		names = append(names, f.Name())
+	}
+	return strings.Join(append(names, c.inner.Name()), " + ")
+}
+
+// FormatVersion は内側のCompressorの圧縮形式のバージョンを返します（common.Versioned）
+func (c *Compressor) FormatVersion() byte {
+	return common.FormatVersion(c.inner)
+}
+
+// Compress はフィルタを適用してから圧縮します
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	for _, f := range c.filters {
+		var err error
+		if data, err = f.Encode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+	}
+	return c.inner.Compress(data)
+}
+
+// Decompress は展開してからフィルタを逆順に戻します
+func (c *Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は制限付きで展開します
+// フィルタのほとんどはデータ長を大きく変えませんが、詰めたシンボルを戻す Remap は
+// 最大8倍に増えるため、フィルタで増えた分も出力の制限と予算で確認します。
+func (c *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	data, err := common.DecompressWithOptions(c.inner, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(c.filters) - 1; i >= 0; i-- {
+		decoded, err := c.filters[i].Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.filters[i].Name(), err)
+		}
+		if grown := len(decoded) - len(data); grown > 0 {
+			if err := opts.ReserveOutput(int64(grown), int64(len(decoded))); err != nil {
+				return nil, err
+			}
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+)
@@ -0,0 +1,481 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/pipeline"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// counters はリトルエンディアンのuint32カウンタの配列を作成します
+func counters(n int) []byte {
+	data := make([]byte, 0, 4*n)
+	for i := 0; i < n; i++ {
+		data = binary.LittleEndian.AppendUint32(data, uint32(1000+i))
+	}
+	return data
+}
+
+func TestTranspose_Layout(t *testing.T) {
+	data := []byte("abcABCxyz12")
+	got, err := Transpose(data, 3)
+	if err != nil {
+		t.Fatalf("Transpose failed: %v", err)
+	}
+	// 末尾の不完全なレコード "12" はそのまま残る
+	if string(got) != "aAxbBycCz12" {
+		t.Errorf("Transpose = %q, expected %q", got, "aAxbBycCz12")
+	}
+}
+
+func TestTranspose_RoundTrip(t *testing.T) {
+	for _, sample := range testcorpus.Samples() {
+		for _, size := range []int{1, 2, 3, 4, 7, 16, 5000} {
+			transposed, err := Transpose(sample.Data, size)
+			if err != nil {
+				t.Fatalf("%s: Transpose failed: %v", sample.Name, err)
+			}
+			restored, err := Untranspose(transposed, size)
+			if err != nil {
+				t.Fatalf("%s: Untranspose failed: %v", sample.Name, err)
+			}
+			if !bytes.Equal(sample.Data, restored) {
+				t.Errorf("%s (size %d): round trip mismatch", sample.Name, size)
+			}
+		}
+	}
+}
+
+func TestTranspose_InvalidRecordSize(t *testing.T) {
+	if _, err := Transpose([]byte("abc"), 0); err == nil {
+		t.Error("Expected error for record size 0")
+	}
+	if _, err := NewTranspose(-1); err == nil {
+		t.Error("Expected error for negative record size")
+	}
+}
+
+func TestDelta_RoundTrip(t *testing.T) {
+	for _, sample := range testcorpus.Samples() {
+		if got := Undelta(Delta(sample.Data)); !bytes.Equal(sample.Data, got) {
+			t.Errorf("%s: round trip mismatch", sample.Name)
+		}
+	}
+}
+
+func TestCompressor_CountersPipeline(t *testing.T) {
+	// 10001個のカウンタ + 不完全なレコード
+	data := append(counters(10001), 0xAB, 0xCD)
+
+	transpose, err := NewTranspose(4)
+	if err != nil {
+		t.Fatalf("NewTranspose failed: %v", err)
+	}
+	pipeline := NewCompressor(rle.NewCompressor(), transpose, NewDelta())
+
+	filtered, err := pipeline.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	plain, err := rle.NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	t.Logf("%s: %d bytes, plain RLE: %d bytes", pipeline.Name(), len(filtered), len(plain))
+	if len(filtered)*10 >= len(plain) {
+		t.Errorf("Pipeline output (%d) is not >10x smaller than plain RLE (%d)", len(filtered), len(plain))
+	}
+
+	restored, err := pipeline.Decompress(filtered)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, restored) {
+		t.Error("Round trip mismatch")
+	}
+}
+
+func TestCompressor_Name(t *testing.T) {
+	transpose, _ := NewTranspose(4)
+	c := NewCompressor(rle.NewCompressor(), transpose, NewDelta())
+	expected := "Transpose(4) + Delta + Run-Length Encoding (RLE)"
+	if c.Name() != expected {
+		t.Errorf("Expected %q, got %q", expected, c.Name())
+	}
+}
+
+func TestCompressor_RecordSizeFromHeader(t *testing.T) {
+	// 展開側のレコードサイズ設定に関係なく、ヘッダーの値で元に戻せる
+	t4, _ := NewTranspose(4)
+	t8, _ := NewTranspose(8)
+	data := counters(100)
+
+	compressed, err := NewCompressor(rle.NewCompressor(), t4).Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	restored, err := NewCompressor(rle.NewCompressor(), t8).Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, restored) {
+		t.Error("Round trip mismatch")
+	}
+
+	if _, err := t4.Decode([]byte{0}); err == nil {
+		t.Error("Expected error for zero record size header")
+	}
+	if _, err := t4.Decode(nil); err == nil {
+		t.Error("Expected error for missing header")
+	}
+}
+
+func TestParse(t *testing.T) {
+	filters, err := Parse("transpose:4, delta")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(filters) != 2 || filters[0].Name() != "Transpose(4)" || filters[1].Name() != "Delta" {
+		t.Errorf("Unexpected filters: %v", filters)
+	}
+
+	if filters, err := Parse(""); err != nil || filters != nil {
+		t.Errorf("Expected no filters for empty spec, got %v, %v", filters, err)
+	}
+
+	filters, err = Parse("remap,remap:pack")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(filters) != 2 || filters[0].Name() != "Remap" || filters[1].Name() != "Remap(packed)" {
+		t.Errorf("Unexpected filters: %v", filters)
+	}
+
+	filters, err = Parse("nlnorm")
+	if err != nil || len(filters) != 1 || filters[0].Name() != "NewlineNormalize" {
+		t.Errorf("Unexpected filters: %v (err %v)", filters, err)
+	}
+
+	for _, spec := range []string{"transpose", "transpose:x", "transpose:0", "delta:1", "zigzag", "remap:2", "nlnorm:crlf"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+// acgt は偏りのある出現頻度（A 40%, C 30%, G 20%, T 10%）の塩基配列を作成します
+func acgt(n int, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	data := make([]byte, n)
+	for i := range data {
+		switch x := rng.Float64(); {
+		case x < 0.4:
+			data[i] = 'A'
+		case x < 0.7:
+			data[i] = 'C'
+		case x < 0.9:
+			data[i] = 'G'
+		default:
+			data[i] = 'T'
+		}
+	}
+	return data
+}
+
+func TestRemap_DNA(t *testing.T) {
+	data := acgt(1<<20, 1)
+
+	packed, err := NewRemap(true).Encode(data)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	ratio := float64(len(data)) / float64(len(packed))
+	t.Logf("Remap(packed): %d -> %d bytes (%.2fx)", len(data), len(packed), ratio)
+	if ratio < 3.9 {
+		t.Errorf("Packed remap ratio %.2fx, want ~4x", ratio)
+	}
+
+	plain, err := huffman.NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	pipeline := NewCompressor(huffman.NewCompressor(), NewRemap(true))
+	compressed, err := pipeline.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	// 1バイトに4塩基を詰めると、Huffman が4塩基の組をまとめて符号化できる
+	t.Logf("%s: %d bytes, plain Huffman: %d bytes", pipeline.Name(), len(compressed), len(plain))
+	if len(compressed) >= len(plain) {
+		t.Errorf("Remap+Huffman (%d) is not smaller than plain Huffman (%d)", len(compressed), len(plain))
+	}
+
+	for _, c := range []*Compressor{pipeline, NewCompressor(huffman.NewCompressor(), NewRemap(false))} {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", c.Name(), err)
+		}
+		restored, err := c.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", c.Name(), err)
+		}
+		if !bytes.Equal(data, restored) {
+			t.Errorf("%s: round trip mismatch", c.Name())
+		}
+	}
+}
+
+func TestRemap_Hex(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789abcdef", 64))
+	encoded, err := NewRemap(true).Encode(data)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	// パレット16バイト + ヘッダー + 1バイトに2シンボル
+	if want := len(data)/2 + 16 + 5; len(encoded) > want {
+		t.Errorf("Encoded size %d, want at most %d (4 bits per symbol)", len(encoded), want)
+	}
+	if got := SymbolBits(len(Palette(data))); got != 4 {
+		t.Errorf("SymbolBits(16) = %d, want 4", got)
+	}
+}
+
+func TestRemap_RoundTrip(t *testing.T) {
+	for _, pack := range []bool{false, true} {
+		f := NewRemap(pack)
+		for _, sample := range testcorpus.Samples() {
+			encoded, err := f.Encode(sample.Data)
+			if err != nil {
+				t.Fatalf("%s (pack %v): Encode failed: %v", sample.Name, pack, err)
+			}
+			restored, err := f.Decode(encoded)
+			if err != nil {
+				t.Fatalf("%s (pack %v): Decode failed: %v", sample.Name, pack, err)
+			}
+			if !bytes.Equal(sample.Data, restored) {
+				t.Errorf("%s (pack %v): round trip mismatch", sample.Name, pack)
+			}
+		}
+	}
+
+	for n, want := range map[int]int{0: 1, 1: 1, 2: 1, 3: 2, 4: 2, 5: 4, 16: 4, 17: 8, 256: 8} {
+		if got := SymbolBits(n); got != want {
+			t.Errorf("SymbolBits(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestRemap_OutsidePalette(t *testing.T) {
+	f, err := NewRemapWithPalette([]byte("TGCA"), true)
+	if err != nil {
+		t.Fatalf("NewRemapWithPalette failed: %v", err)
+	}
+	if f.Name() != "Remap(4 bytes, packed)" {
+		t.Errorf("Unexpected name %q", f.Name())
+	}
+
+	data := []byte("ACGTTGCA")
+	encoded, err := f.Encode(data)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if restored, err := f.Decode(encoded); err != nil || !bytes.Equal(data, restored) {
+		t.Errorf("Round trip mismatch: %q, %v", restored, err)
+	}
+
+	_, err = f.Encode([]byte("ACGN"))
+	if !errors.Is(err, ErrOutsidePalette) {
+		t.Fatalf("Expected ErrOutsidePalette, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "0x4e at offset 3") {
+		t.Errorf("Error does not name the byte and offset: %v", err)
+	}
+	if _, err := NewCompressor(huffman.NewCompressor(), f).Compress([]byte("ACGN")); !errors.Is(err, ErrOutsidePalette) {
+		t.Errorf("Expected ErrOutsidePalette from the pipeline, got %v", err)
+	}
+
+	for _, palette := range [][]byte{nil, []byte("ACGA")} {
+		if _, err := NewRemapWithPalette(palette, false); err == nil {
+			t.Errorf("%q: expected error", palette)
+		}
+	}
+}
+
+func TestRemap_DecodeInvalid(t *testing.T) {
+	f := NewRemap(true)
+	tests := map[string][]byte{
+		"empty":           nil,
+		"short palette":   {4, 'A', 'C'},
+		"unsorted":        {2, 'C', 'A', 8, 0},
+		"missing bits":    {2, 'A', 'C'},
+		"wrong bits":      {2, 'A', 'C', 4, 1, 0},
+		"symbol count":    {2, 'A', 'C', 1, 0xFF, 0xFF, 0x03, 0},
+		"short packed":    {4, 'A', 'C', 'G', 'T', 2, 9, 0},
+		"outside palette": {2, 'A', 'C', 8, 0, 1, 2},
+	}
+	for name, data := range tests {
+		if _, err := f.Decode(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCompressor_RemapOutputLimit(t *testing.T) {
+	data := acgt(4000, 2)
+	c := NewCompressor(rle.NewCompressor(), NewRemap(true))
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// 内側の展開結果（約1000バイト）は制限内でも、Remap で戻すと制限を超える
+	_, err = c.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 2000})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	restored, err := c.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 4000})
+	if err != nil || !bytes.Equal(data, restored) {
+		t.Errorf("Round trip within the limit failed: %v", err)
+	}
+}
+
+// lineEndingCombinations は "a"、"\r"、"\n"、"\r\n" を最大 n 個並べたすべての列を返します
+func lineEndingCombinations(n int) [][]byte {
+	pieces := []string{"a", "\r", "\n", "\r\n"}
+	all := [][]byte{{}}
+	last := [][]byte{{}}
+	for range n {
+		var next [][]byte
+		for _, prefix := range last {
+			for _, p := range pieces {
+				next = append(next, append(slices.Clone(prefix), p...))
+			}
+		}
+		all = append(all, next...)
+		last = next
+	}
+	return all
+}
+
+func TestNewlineNormalize_AllLineEndings(t *testing.T) {
+	f := NewlineNormalize()
+	for _, data := range lineEndingCombinations(5) {
+		encoded, err := f.Encode(data)
+		if err != nil {
+			t.Fatalf("%q: Encode failed: %v", data, err)
+		}
+		decoded, err := f.Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Fatalf("%q: round trip got %q (err %v)", data, decoded, err)
+		}
+
+		// ブロックの境界がどこにあっても（\r\n の間でも）同じデータに戻る
+		for _, size := range []int{2, 3, 5} {
+			small := &NewlineNormalizer{blockSize: size}
+			var stream, restored bytes.Buffer
+			if err := small.CompressStream(iotest.OneByteReader(bytes.NewReader(data)), &stream); err != nil {
+				t.Fatalf("%q: CompressStream failed: %v", data, err)
+			}
+			if err := small.DecompressStream(iotest.OneByteReader(&stream), &restored); err != nil || !bytes.Equal(restored.Bytes(), data) {
+				t.Fatalf("%q (block %d): stream round trip got %q (err %v)", data, size, restored.Bytes(), err)
+			}
+		}
+	}
+}
+
+func TestNewlineNormalize_SplitAcrossBlocks(t *testing.T) {
+	// \r\n がブロックの境界をまたいでも、\n にそろえてから記録する
+	f := &NewlineNormalizer{blockSize: 8}
+	data := []byte("abcdefg\r\nabcdefg\r\nab\r\r\n\r")
+	var stream bytes.Buffer
+	if err := f.CompressStream(bytes.NewReader(data), &stream); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stream.Bytes(), []byte("g\r")) {
+		t.Errorf("A \\r\\n split across blocks was not normalized: %q", stream.Bytes())
+	}
+	decoded, err := f.Decode(stream.Bytes())
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Round trip got %q (err %v)", decoded, err)
+	}
+
+	// 1ブロックの場合は Encode と同じ出力
+	encoded, _ := NewlineNormalize().Encode(data)
+	var single bytes.Buffer
+	NewlineNormalize().CompressStream(iotest.HalfReader(bytes.NewReader(data)), &single)
+	if !bytes.Equal(single.Bytes(), encoded) {
+		t.Errorf("CompressStream output %q differs from Encode %q", single.Bytes(), encoded)
+	}
+}
+
+func TestNewlineNormalize_DecodeInvalid(t *testing.T) {
+	f := NewlineNormalize()
+	for name, data := range map[string][]byte{
+		"zero length":    {0, 0},
+		"too long":       binary.AppendUvarint(nil, newlineBlockSize+1),
+		"missing text":   {5, 0, 'a'},
+		"too many runs":  {1, 3, 0, 1, 0, '\n'},
+		"extra newline":  {2, 1, 1, '\n', '\n'},
+		"missing lines":  {2, 2, 1, 2, 'a', '\n'},
+		"truncated runs": {3, 2, 1},
+	} {
+		if _, err := f.Decode(data); !errors.Is(err, errNewlineBlock) {
+			t.Errorf("%s: expected errNewlineBlock, got %v", name, err)
+		}
+	}
+}
+
+// mixedEndingsLog は2つの環境（\r\n と \n）から届く同じ形式の行が、行ごとにどちらの改行かが
+// 変わりながら混ざったログを作成します
+func mixedEndingsLog(lines int, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	var data []byte
+	for i := range lines {
+		ending := "\n"
+		if rng.Intn(2) == 0 {
+			ending = "\r\n"
+		}
+		data = fmt.Appendf(data, "worker %d: heartbeat ok, queue depth %d%s", i%12, i%12*7, ending)
+	}
+	return data
+}
+
+func TestNewlineNormalize_MixedEndingsLog(t *testing.T) {
+	// 改行をそろえると、LZ77の一致が行をまたいで長く続く（先読みが長い場合に効果が出る）
+	data := mixedEndingsLog(3000, 1)
+	plain, err := lz77.NewCompressor(lz77.WithAdaptiveLookahead()).Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []common.Compressor{
+		NewCompressor(lz77.NewCompressor(lz77.WithAdaptiveLookahead()), NewlineNormalize()),
+		pipeline.NewCompressor(NewlineNormalize(), lz77.NewCompressor(lz77.WithAdaptiveLookahead())),
+	} {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", c.Name(), err)
+		}
+		t.Logf("%s: %d bytes, plain LZ77: %d bytes", c.Name(), len(compressed), len(plain))
+		if len(compressed)*5 > len(plain)*4 {
+			t.Errorf("%s: %d bytes is not 20%% smaller than plain LZ77 %d bytes", c.Name(), len(compressed), len(plain))
+		}
+		restored, err := c.Decompress(compressed)
+		if err != nil || !bytes.Equal(restored, data) {
+			t.Errorf("%s: round trip failed (err %v)", c.Name(), err)
+		}
+	}
+}
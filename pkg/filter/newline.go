@@ -0,0 +1,222 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// newlineBlockSize は NewlineNormalize が1つのブロックにまとめる元のデータの最大のバイト数です
+// ストリームでもこの大きさごとに変換するため、メモリ使用量は入力のサイズによらず一定です。
+const newlineBlockSize = 64 * 1024
+
+// NewlineNormalizer は \r\n を \n に置き換え、元に戻すための改行の種類を別に記録するフィルタです
+// 複数の環境のログが混ざって \r\n と \n が交互に現れるデータでは、改行の違いで LZ77 などの
+// 一致が途切れます。改行を \n にそろえて一致を長くし、各 \n が \r\n だったかを連の長さの
+// 列（\n の連、\r\n の連、...）として各ブロックの先頭に置きます。\n の前にない単独の \r は
+// そのまま残すため、どんなデータでもバイト単位で元に戻せます。
+//
+// 出力の形式（ブロックの繰り返し、空のデータはブロックなし）
+//
+//	変換後のテキストの長さ(uvarint) + 連の数(uvarint) + 連の長さ(uvarint)... + 変換後のテキスト
+//
+// 連は \n の連から始まり（最初の改行が \r\n なら長さ0）、\r\n の連と交互に続きます。
+// 連の長さの合計はテキストの \n の数と同じです。Filter のほか、pipeline の段として使える
+// common.StreamCompressor も実装し、ストリームではブロックの境界で分かれた \r\n も
+// 1つの改行として扱います（出力は Encode と同じです）。状態を持たないため、複数の
+// ゴルーチンから同時に使用できます。
+type NewlineNormalizer struct {
+	blockSize int
+}
+
+// NewlineNormalize は改行を \n にそろえる NewlineNormalizer を作成します
+// -filter では "nlnorm" で指定します（例: -filter nlnorm -algo lz77）。
+func NewlineNormalize() *NewlineNormalizer {
+	return &NewlineNormalizer{blockSize: newlineBlockSize}
+}
+
+// Name はフィルタ名を返します
+func (f *NewlineNormalizer) Name() string {
+	return "NewlineNormalize"
+}
+
+// Encode は data の \r\n を \n に置き換えます
+func (f *NewlineNormalizer) Encode(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(data) + binary.MaxVarintLen64)
+	if err := f.CompressStream(bytes.NewReader(data), &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Decode は Encode の変換を元に戻します
+func (f *NewlineNormalizer) Decode(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(data))
+	if err := f.DecompressStream(bytes.NewReader(data), &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Compress は Encode と同じです（pipeline の段として使う場合の common.Compressor）
+func (f *NewlineNormalizer) Compress(data []byte) ([]byte, error) {
+	return f.Encode(data)
+}
+
+// Decompress は Decode と同じです
+func (f *NewlineNormalizer) Decompress(data []byte) ([]byte, error) {
+	return f.Decode(data)
+}
+
+// CompressStream は src をブロックごとに変換して dst に書き込みます
+// ブロックが \r で終わる場合は、次のブロックの先頭の \n と組になるかもしれないため、
+// その \r を次のブロックに回します。
+func (f *NewlineNormalizer) CompressStream(src io.Reader, dst io.Writer) error {
+	buf := make([]byte, max(f.blockSize, 2))
+	carry := 0
+	for {
+		n, err := io.ReadFull(src, buf[carry:])
+		n += carry
+		end := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !end {
+			return err
+		}
+
+		block := buf[:n]
+		carry = 0
+		if !end && block[n-1] == '\r' {
+			block, carry = block[:n-1], 1
+		}
+		if len(block) > 0 {
+			if _, err := dst.Write(appendNewlineBlock(nil, block)); err != nil {
+				return err
+			}
+		}
+		if end {
+			return nil
+		}
+		if carry > 0 {
+			buf[0] = '\r'
+		}
+	}
+}
+
+// appendNewlineBlock は block を変換したブロックを dst に追加します
+func appendNewlineBlock(dst, block []byte) []byte {
+	text := make([]byte, 0, len(block))
+	var runs []uint64
+	crlf := false // 今の連が \r\n の連か
+	run := uint64(0)
+	for i := 0; i < len(block); i++ {
+		b := block[i]
+		isCRLF := b == '\r' && i+1 < len(block) && block[i+1] == '\n'
+		if isCRLF {
+			b = '\n'
+			i++
+		}
+		if b == '\n' {
+			if isCRLF != crlf {
+				runs = append(runs, run)
+				crlf, run = isCRLF, 0
+			}
+			run++
+		}
+		text = append(text, b)
+	}
+	if run > 0 {
+		runs = append(runs, run)
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(text)))
+	dst = binary.AppendUvarint(dst, uint64(len(runs)))
+	for _, r := range runs {
+		dst = binary.AppendUvarint(dst, r)
+	}
+	return append(dst, text...)
+}
+
+// errNewlineBlock は NewlineNormalize のブロックの形式が不正な場合のエラーです
+var errNewlineBlock = errors.New("invalid filtered data: bad newline block")
+
+// DecompressStream は src のブロックを元に戻して dst に書き込みます
+func (f *NewlineNormalizer) DecompressStream(src io.Reader, dst io.Writer) error {
+	r := bufio.NewReader(src)
+	var text, out []byte
+	for {
+		length, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", errNewlineBlock, err)
+		}
+		// 変換後のテキストは元のブロックより長くならない
+		if length == 0 || length > newlineBlockSize {
+			return fmt.Errorf("%w: text length %d", errNewlineBlock, length)
+		}
+		count, err := binary.ReadUvarint(r)
+		if err != nil || count > length+1 {
+			return fmt.Errorf("%w: bad run count", errNewlineBlock)
+		}
+		runs := make([]uint64, count)
+		for i := range runs {
+			if runs[i], err = binary.ReadUvarint(r); err != nil || runs[i] > length {
+				return fmt.Errorf("%w: bad run length", errNewlineBlock)
+			}
+		}
+		text = append(text[:0], make([]byte, length)...)
+		if _, err := io.ReadFull(r, text); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("%w: %w", errNewlineBlock, err)
+		}
+
+		if out, err = restoreNewlines(out[:0], text, runs); err != nil {
+			return err
+		}
+		if _, err := dst.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreNewlines は text の \n を runs に従って \n か \r\n にして dst に追加します
+func restoreNewlines(dst, text []byte, runs []uint64) ([]byte, error) {
+	next, left := 0, uint64(0)
+	crlf := true // 最初の連を読むと \n の連になる
+	for _, b := range text {
+		if b == '\n' {
+			for left == 0 {
+				if next == len(runs) {
+					return nil, fmt.Errorf("%w: more newlines than recorded", errNewlineBlock)
+				}
+				left, crlf = runs[next], !crlf
+				next++
+			}
+			left--
+			if crlf {
+				dst = append(dst, '\r')
+			}
+		}
+		dst = append(dst, b)
+	}
+	if left != 0 || next != len(runs) {
+		return nil, fmt.Errorf("%w: fewer newlines than recorded", errNewlineBlock)
+	}
+	return dst, nil
+}
+
+// コンパイル時にインターフェースの実装を確認
+var (
+	_ Filter                  = (*NewlineNormalizer)(nil)
+	_ common.Compressor       = (*NewlineNormalizer)(nil)
+	_ common.StreamCompressor = (*NewlineNormalizer)(nil)
+)
@@ -0,0 +1,213 @@
+package filter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// ErrOutsidePalette は固定のパレットにないバイトを Remap しようとしたことを表します
+var ErrOutsidePalette = errors.New("byte outside the palette")
+
+// Palette は data に出現するバイトを昇順に並べて返します
+func Palette(data []byte) []byte {
+	var seen [256]bool
+	for _, b := range data {
+		seen[b] = true
+	}
+	palette := make([]byte, 0, 16)
+	for b, ok := range seen {
+		if ok {
+			palette = append(palette, byte(b))
+		}
+	}
+	return palette
+}
+
+// SymbolBits は palette の大きさ n のシンボルを詰めるときの1シンボルあたりのビット数です
+// バイトの境界をまたがないよう 1, 2, 4, 8 のいずれかにします（DNA の ACGT は2、16進数は4）。
+func SymbolBits(n int) int {
+	width := bits.Len(uint(max(n-1, 1)))
+	for _, b := range []int{1, 2, 4} {
+		if width <= b {
+			return b
+		}
+	}
+	return 8
+}
+
+// Remap は data の各バイトを palette での位置（0から始まる小さなシンボル）に置き換えます
+// palette にないバイトがあれば ErrOutsidePalette を返します。
+func Remap(data, palette []byte) ([]byte, error) {
+	index, err := paletteIndex(palette)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(data))
+	for i, b := range data {
+		symbol := index[b]
+		if symbol < 0 {
+			return nil, fmt.Errorf("%w: 0x%02x at offset %d (palette has %d bytes)", ErrOutsidePalette, b, i, len(palette))
+		}
+		result[i] = byte(symbol)
+	}
+	return result, nil
+}
+
+// Unmap は Remap の置き換えを元に戻します
+func Unmap(symbols, palette []byte) ([]byte, error) {
+	result := make([]byte, len(symbols))
+	for i, s := range symbols {
+		if int(s) >= len(palette) {
+			return nil, fmt.Errorf("symbol %d at offset %d is outside the palette of %d bytes", s, i, len(palette))
+		}
+		result[i] = palette[s]
+	}
+	return result, nil
+}
+
+// paletteIndex はバイトから palette での位置への表を作ります（ないバイトは -1）
+func paletteIndex(palette []byte) ([256]int, error) {
+	var index [256]int
+	for i := range index {
+		index[i] = -1
+	}
+	for i, b := range palette {
+		if index[b] >= 0 {
+			return index, fmt.Errorf("duplicate byte 0x%02x in palette", b)
+		}
+		index[b] = i
+	}
+	return index, nil
+}
+
+// PackSymbols は bitsPerSymbol ビットのシンボルを上位ビットから順に詰めます
+// 最後のバイトの余ったビットは0です。bitsPerSymbol は 1, 2, 4, 8 のいずれかです。
+func PackSymbols(symbols []byte, bitsPerSymbol int) []byte {
+	perByte := 8 / bitsPerSymbol
+	result := make([]byte, (len(symbols)+perByte-1)/perByte)
+	for i, s := range symbols {
+		shift := 8 - bitsPerSymbol*(i%perByte+1)
+		result[i/perByte] |= s << shift
+	}
+	return result
+}
+
+// UnpackSymbols は PackSymbols で詰めた n 個のシンボルを取り出します
+func UnpackSymbols(packed []byte, bitsPerSymbol, n int) ([]byte, error) {
+	if bitsPerSymbol != 1 && bitsPerSymbol != 2 && bitsPerSymbol != 4 && bitsPerSymbol != 8 {
+		return nil, fmt.Errorf("invalid bits per symbol: %d", bitsPerSymbol)
+	}
+	perByte := 8 / bitsPerSymbol
+	if n < 0 || (n+perByte-1)/perByte != len(packed) {
+		return nil, fmt.Errorf("packed data has %d bytes, want %d symbols of %d bits", len(packed), n, bitsPerSymbol)
+	}
+	mask := byte(1)<<bitsPerSymbol - 1
+	result := make([]byte, n)
+	for i := range result {
+		shift := 8 - bitsPerSymbol*(i%perByte+1)
+		result[i] = packed[i/perByte] >> shift & mask
+	}
+	return result, nil
+}
+
+// remapFilter はパレットをヘッダーに保存する Remap フィルタです
+type remapFilter struct {
+	palette []byte // nil の場合はデータに出現するバイトから作る
+	pack    bool
+}
+
+// NewRemap はデータに出現するバイトをパレットにする Remap フィルタを作成します
+// pack が true の場合はシンボルを SymbolBits のビット数で詰めます（ACGT なら1バイトに4つ）。
+// 詰めない場合も、シンボルが小さな値にそろうため後段の符号化が扱いやすくなります。
+func NewRemap(pack bool) Filter {
+	return remapFilter{pack: pack}
+}
+
+// NewRemapWithPalette は固定のパレットを使う Remap フィルタを作成します
+// パレットにないバイトを含むデータの Encode は ErrOutsidePalette を返します。
+func NewRemapWithPalette(palette []byte, pack bool) (Filter, error) {
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("empty palette")
+	}
+	if _, err := paletteIndex(palette); err != nil {
+		return nil, err
+	}
+	return remapFilter{palette: slices.Sorted(slices.Values(palette)), pack: pack}, nil
+}
+
+func (f remapFilter) Name() string {
+	var opts []string
+	if f.palette != nil {
+		opts = append(opts, fmt.Sprintf("%d bytes", len(f.palette)))
+	}
+	if f.pack {
+		opts = append(opts, "packed")
+	}
+	if len(opts) == 0 {
+		return "Remap"
+	}
+	return "Remap(" + strings.Join(opts, ", ") + ")"
+}
+
+// Encode の出力は パレットのバイト数(uvarint) + パレット（昇順）+ ビット数(1バイト)
+// + 詰めた場合はシンボル数(uvarint) + シンボル列 です（詰めない場合と、17種類以上で
+// 詰められない場合のビット数は8）
+func (f remapFilter) Encode(data []byte) ([]byte, error) {
+	palette := f.palette
+	if palette == nil {
+		palette = Palette(data)
+	}
+	symbols, err := Remap(data, palette)
+	if err != nil {
+		return nil, err
+	}
+
+	result := binary.AppendUvarint(make([]byte, 0, 2*binary.MaxVarintLen64+len(palette)+len(data)), uint64(len(palette)))
+	result = append(result, palette...)
+	bitsPerSymbol := SymbolBits(len(palette))
+	if !f.pack || bitsPerSymbol == 8 {
+		return append(append(result, 8), symbols...), nil
+	}
+	result = append(result, byte(bitsPerSymbol))
+	result = binary.AppendUvarint(result, uint64(len(symbols)))
+	return append(result, PackSymbols(symbols, bitsPerSymbol)...), nil
+}
+
+func (f remapFilter) Decode(data []byte) ([]byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > 256 || count > uint64(len(data)-n) {
+		return nil, fmt.Errorf("invalid filtered data: bad palette header")
+	}
+	palette := data[n : n+int(count)]
+	for i := 1; i < len(palette); i++ {
+		if palette[i] <= palette[i-1] {
+			return nil, fmt.Errorf("invalid filtered data: palette is not sorted")
+		}
+	}
+	rest := data[n+int(count):]
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("invalid filtered data: missing bits per symbol")
+	}
+
+	bitsPerSymbol, rest := int(rest[0]), rest[1:]
+	if bitsPerSymbol == 8 {
+		return Unmap(rest, palette)
+	}
+	if bitsPerSymbol != SymbolBits(int(count)) {
+		return nil, fmt.Errorf("invalid filtered data: %d bits per symbol for a palette of %d bytes", bitsPerSymbol, count)
+	}
+	symbols, n := binary.Uvarint(rest)
+	// 詰めたシンボルは元のデータの最大8倍にしかならない
+	if n <= 0 || symbols > 8*uint64(len(rest)) {
+		return nil, fmt.Errorf("invalid filtered data: bad symbol count")
+	}
+	unpacked, err := UnpackSymbols(rest[n:], bitsPerSymbol, int(symbols))
+	if err != nil {
+		return nil, fmt.Errorf("invalid filtered data: %w", err)
+	}
+	return Unmap(unpacked, palette)
+}
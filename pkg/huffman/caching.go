@@ -0,0 +1,216 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// CachingCompressor の圧縮データの形式
+//
+//	種類(1バイト) + モデルの番号(uvarint)
+//	+ 種類が cachingFresh の場合だけ モデルの長さ(uvarint) + モデル（Model.MarshalBinary）
+//	+ Model.Compress の出力（元のサイズ(uvarint) + 符号化データ）
+//
+// モデルの番号は圧縮側がモデルを作り直すたびに1から1つずつ増やします。
+const (
+	cachingFresh  = 0 // 新しいモデルを含む
+	cachingCached = 1 // 前に送ったモデル（番号で指定）を使う
+
+	// divergenceBits はキャッシュしたモデルを作り直す、モデルの無駄の増加（1バイトあたりのビット数）です
+	// モデルの無駄はサンプルの平均符号長とサンプルのエントロピーの差で、モデルを作ったデータでの
+	// 無駄より0.5ビット以上大きくなる場合は、データの傾向が変わったとみなします。
+	divergenceBits = 0.5
+
+	// divergenceSamples は傾向の確認で符号長を調べるバイトの最大数です
+	divergenceSamples = 256
+)
+
+// ErrModelNotReceived は、キャッシュしたモデルを参照する圧縮データを、そのモデルを含む
+// データを展開していない CachingCompressor で展開しようとした場合のエラーです
+var ErrModelNotReceived = errors.New("huffman: compressed data references a model this decoder has not received")
+
+// CachingCompressor は前回作ったHuffmanのモデルを次の Compress でも使う Compressor です
+// ほとんど同じ内容の小さなデータ（数KBのメトリクスなど）を続けて多数圧縮する場合に、
+// 毎回の頻度表の作成と木の構築を省きます。モデルは refreshEvery 回ごとか、データの
+// 一部をサンプルしたときの平均符号長がモデルを作ったときより大きく長くなった場合に作り直し、
+// そのときだけ圧縮データにモデルを含めます（ほかのデータはモデルの番号だけを持ちます）。
+//
+// 圧縮データは、同じ順に展開する1つの CachingCompressor（または同じ順に圧縮データを
+// 受け取る別のインスタンス）でしか展開できません。Decompress はモデルを含むデータを
+// 展開したときにそのモデルを記録し、以降の番号だけのデータに使います。1つの接続の
+// 送信側と受信側のように、圧縮側と展開側が状態を対にして持つ用途向けで、保存するファイルや
+// 順序が入れ替わる通信には向きません（.tzz コンテナでは使えません）。
+//
+// 圧縮の状態と展開の状態は別で、それぞれミューテックスで保護するため、複数の
+// ゴルーチンから呼び出せますが、圧縮データの順序は呼び出しの順序になります。
+type CachingCompressor struct {
+	refreshEvery int
+
+	encMu       sync.Mutex
+	encModel    *Model      // 圧縮で使っているモデル（まだない場合は nil）
+	encTable    *modelCodes // encModel の符号をバイトで引ける表
+	encSeq      uint64      // encModel の番号
+	encUses     int         // encModel で圧縮した回数
+	encBaseline float64     // encModel を作ったデータでのモデルの無駄（modelCodes.divergence）
+	refreshes   int         // モデルを作った回数
+
+	decMu    sync.Mutex
+	decModel *Model // 展開で最後に受け取ったモデル
+	decSeq   uint64 // decModel の番号
+}
+
+// NewCachingCompressor はモデルを refreshEvery 回ごとに作り直す CachingCompressor を作成します
+// refreshEvery が0以下の場合は回数では作り直さず、データの傾向が変わった場合だけ作り直します。
+func NewCachingCompressor(refreshEvery int) *CachingCompressor {
+	return &CachingCompressor{refreshEvery: refreshEvery}
+}
+
+// Name はアルゴリズム名を返します
+func (c *CachingCompressor) Name() string {
+	return "Huffman Coding (cached model)"
+}
+
+// Refreshes はこれまでに圧縮でモデルを作った回数を返します
+func (c *CachingCompressor) Refreshes() int {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+	return c.refreshes
+}
+
+// Compress はキャッシュしたモデル（必要なら作り直したモデル）で data を圧縮します
+func (c *CachingCompressor) Compress(data []byte) ([]byte, error) {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	fresh := c.encModel == nil ||
+		(c.refreshEvery > 0 && c.encUses >= c.refreshEvery) ||
+		c.encTable.divergence(data) > c.encBaseline+divergenceBits
+	if fresh {
+		model, err := BuildModel(data)
+		if err != nil {
+			return nil, err
+		}
+		c.encModel, c.encTable = model, model.codeTable()
+		c.encSeq++
+		c.encUses = 0
+		c.encBaseline = c.encTable.divergence(data)
+		c.refreshes++
+	}
+	c.encUses++
+
+	out := make([]byte, 0, 1+binary.MaxVarintLen64+len(data))
+	if fresh {
+		encoded, err := c.encModel.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cachingFresh)
+		out = binary.AppendUvarint(out, c.encSeq)
+		out = binary.AppendUvarint(out, uint64(len(encoded)))
+		out = append(out, encoded...)
+	} else {
+		out = append(out, cachingCached)
+		out = binary.AppendUvarint(out, c.encSeq)
+	}
+	out = binary.AppendUvarint(out, uint64(len(data)))
+	w := bitio.NewWriter()
+	if err := c.encTable.encode(w, data); err != nil {
+		return nil, err
+	}
+	return append(out, w.Bytes()...), nil
+}
+
+// divergence は data の最大 divergenceSamples バイトを等間隔に調べ、モデルでの平均符号長と
+// サンプルのエントロピーの差（1バイトあたりのビット数）を返します。空のデータは0です。
+// モデルにないバイトはエスケープの符号と8ビットの長さです。サンプルが少ないとエントロピーは
+// 小さく見積もられるため、値そのものではなく、モデルを作ったデータでの値との差で判断します。
+func (t *modelCodes) divergence(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	step := max(1, len(data)/divergenceSamples)
+	bits, n := 0, 0
+	for i := 0; i < len(data); i += step {
+		b := data[i]
+		counts[b]++
+		if code := t.codes[b]; code.length > 0 {
+			bits += code.length
+		} else {
+			bits += t.escape.length + 8
+		}
+		n++
+	}
+	return (float64(bits) - common.EntropyBits(counts[:])) / float64(n)
+}
+
+// Decompress は圧縮データを展開します（モデルを含むデータの場合はモデルを記録します）
+func (c *CachingCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 番号だけのデータが最後に受け取ったモデルと違う番号を指定している場合は、
+// ErrModelNotReceived を返します（モデルを含むデータを展開していないか、順序が違います）。
+func (c *CachingCompressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, common.NewDecodeError("Huffman", data, 0, "empty compressed data")
+	}
+	kind := data[0]
+	seq, n := binary.Uvarint(data[1:])
+	if n <= 0 || seq == 0 {
+		return nil, common.NewDecodeError("Huffman", data, 1, "invalid model sequence number")
+	}
+	offset := 1 + n
+
+	c.decMu.Lock()
+	defer c.decMu.Unlock()
+
+	model := c.decModel
+	switch kind {
+	case cachingFresh:
+		size, n := binary.Uvarint(data[offset:])
+		if n <= 0 || size > uint64(len(data)-offset-n) {
+			return nil, common.NewDecodeError("Huffman", data, offset, "invalid model length")
+		}
+		offset += n
+		model = new(Model)
+		if err := model.UnmarshalBinary(data[offset : offset+int(size)]); err != nil {
+			var decodeErr *common.DecodeError
+			if errors.As(err, &decodeErr) {
+				return nil, decodeErr.WithBase(int64(offset))
+			}
+			return nil, err
+		}
+		offset += int(size)
+	case cachingCached:
+		if model == nil || seq != c.decSeq {
+			return nil, fmt.Errorf("%w: model %d (last received %d)", ErrModelNotReceived, seq, c.decSeq)
+		}
+	default:
+		return nil, common.NewDecodeError("Huffman", data, 0, "unknown payload kind %d", kind)
+	}
+
+	result, err := model.DecompressWithOptions(data[offset:], opts)
+	if err != nil {
+		var decodeErr *common.DecodeError
+		if errors.As(err, &decodeErr) {
+			return nil, decodeErr.WithBase(int64(offset))
+		}
+		return nil, err
+	}
+	// 展開できたモデルだけを記録する（壊れたデータで以降の展開を止めない）
+	c.decModel, c.decSeq = model, seq
+	return result, nil
+}
+
+// コンパイル時にインターフェースの実装を確認
+var (
+	_ common.Compressor          = (*CachingCompressor)(nil)
+	_ common.OptionsDecompressor = (*CachingCompressor)(nil)
+)
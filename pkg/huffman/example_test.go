@@ -0,0 +1,38 @@
+package huffman_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+)
+
+// 出現頻度の高いバイトほど短い符号になります
+// 圧縮データには頻度表も含まれるため、ごく短いデータでは元より大きくなります。
+func ExampleCompressor_Compress() {
+	data := []byte(`It was the best of times, it was the worst of times, it was the age of wisdom,
+it was the age of foolishness, it was the epoch of belief, it was the epoch of incredulity,
+it was the season of Light, it was the season of Darkness, it was the spring of hope,
+it was the winter of despair, we had everything before us, we had nothing before us,
+we were all going direct to Heaven, we were all going direct the other way.
+`)
+
+	c := huffman.NewCompressor()
+	compressed, err := c.Compress(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(c.Name())
+	fmt.Printf("%d -> %d bytes\n", len(data), len(compressed))
+	fmt.Println(bytes.Equal(decompressed, data))
+	// Output:
+	// Huffman Coding
+	// 418 -> 372 bytes
+	// true
+}
@@ -4,31 +4,94 @@ package huffman
 
 import (
 	"container/heap"
+	"errors"
 	"fmt"
 	"sort"
+	"unsafe"
 
 	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "huffman",
+		Extensions:   []string{".huf"},
+		Capabilities: common.CapDeterministic,
+		Description:  "Huffman符号化（出現頻度の高いバイトほど短い符号）",
+		UseCase:      "バイトの出現頻度に偏りがあるデータ（テキストなど）",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressor() },
+	})
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "huffman16",
+		Extensions:   []string{".huf16"},
+		Capabilities: common.CapDeterministic,
+		Description:  "16bitシンボルのHuffman符号化",
+		UseCase:      "UTF-16のテキスト、16bitの音声サンプル",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return &Compressor{width: 2} },
+	})
+}
+
 // Compressor はHuffman Coding圧縮を実装します
-type Compressor struct{}
+// 頻度表や木は呼び出しごとに構築するため、複数のゴルーチンから同時に使用できます
+type Compressor struct {
+	width   int                 // シンボルのバイト数（1 または 2）
+	tracer  common.Tracer       // nil でなければ圧縮で木を構築するときに MergeEvent を通知する
+	timings *common.Timings     // nil でなければ圧縮のフェーズごとの処理時間を記録する
+	costMap common.CostMap      // nil でなければ Compress でシンボルごとの符号のビット数を通知する
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
 
-// NewCompressor は新しいCompressorを作成します
+// Compress が common.Timings に記録するフェーズの名前です
+const (
+	PhaseCount  = "count"  // 頻度表の作成
+	PhaseTree   = "tree"   // Huffman木と符号表の構築
+	PhaseEncode = "encode" // ヘッダーとデータの符号化
+)
+
+// NewCompressor は1バイトを1シンボルとする新しいCompressorを作成します
 func NewCompressor() *Compressor {
-	return &Compressor{}
+	return &Compressor{width: 1}
+}
+
+// NewCompressorWithWidth はシンボル幅を指定してCompressorを作成します
+// width 2 では入力をリトルエンディアンのuint16列として扱います（UTF-16テキストや16bitサンプル向け）
+// 圧縮と展開で同じ幅を指定する必要があります
+func NewCompressorWithWidth(width int) (*Compressor, error) {
+	if width != 1 && width != 2 {
+		return nil, fmt.Errorf("unsupported symbol width: %d", width)
+	}
+	return &Compressor{width: width}, nil
+}
+
+// Width はシンボルのバイト数を返します
+func (h *Compressor) Width() int {
+	return h.width
 }
 
 // Name はアルゴリズム名を返します
 func (h *Compressor) Name() string {
+	if h.width == 2 {
+		return "Huffman Coding (16-bit symbols)"
+	}
 	return "Huffman Coding"
 }
 
+// formatVersion はHuffmanの圧縮形式のバージョンです（1バイト・16bitシンボル共通）
+const formatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (h *Compressor) FormatVersion() byte {
+	return formatVersion
+}
+
 // Node はHuffman木のノードを表します
 type Node struct {
-	Char  byte  // 文字（リーフノードの場合）
-	Freq  int   // 頻度
-	Left  *Node // 左の子ノード
-	Right *Node // 右の子ノード
+	Symbol uint16 // シンボル（リーフノードの場合）
+	Freq   int    // 頻度
+	Left   *Node  // 左の子ノード
+	Right  *Node  // 右の子ノード
 }
 
 // IsLeaf はリーフノードかどうかを判定します
@@ -55,25 +118,45 @@ func (h *NodeHeap) Pop() interface{} {
 	return x
 }
 
-// buildFrequencyTable は文字の出現頻度テーブルを構築します
-func buildFrequencyTable(data []byte) map[byte]int {
-	freq := make(map[byte]int)
-	for _, b := range data {
-		freq[b]++
+// buildFrequencyTable はシンボルの出現頻度テーブルを構築します
+func buildFrequencyTable(symbols []uint16) map[uint16]int {
+	freq := make(map[uint16]int)
+	for _, s := range symbols {
+		freq[s]++
 	}
 	return freq
 }
 
+// byteSymbols はバイト列を1バイト1シンボルの列に変換します
+func byteSymbols(data []byte) []uint16 {
+	symbols := make([]uint16, len(data))
+	for i, b := range data {
+		symbols[i] = uint16(b)
+	}
+	return symbols
+}
+
+// sortedSymbols は頻度テーブルのシンボルを昇順で返します
+func sortedSymbols(freq map[uint16]int) []uint16 {
+	symbols := make([]uint16, 0, len(freq))
+	for s := range freq {
+		symbols = append(symbols, s)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+	return symbols
+}
+
 // buildTree はHuffman木を構築します
-func buildTree(freq map[byte]int) *Node {
+// tracer が nil でなければ、ノードを結合するごとに MergeEvent を通知します。
+func buildTree(freq map[uint16]int, tracer common.Tracer) *Node {
 	if len(freq) == 0 {
 		return nil
 	}
 
-	// 単一文字の場合
+	// 単一シンボルの場合
 	if len(freq) == 1 {
-		for char, f := range freq {
-			return &Node{Char: char, Freq: f}
+		for symbol, f := range freq {
+			return &Node{Symbol: symbol, Freq: f}
 		}
 	}
 
@@ -81,15 +164,9 @@ func buildTree(freq map[byte]int) *Node {
 	h := &NodeHeap{}
 	heap.Init(h)
 
-	// 各文字をソートしてからノードとしてヒープに追加（安定性を保証）
-	var chars []byte
-	for char := range freq {
-		chars = append(chars, char)
-	}
-	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
-
-	for _, char := range chars {
-		heap.Push(h, &Node{Char: char, Freq: freq[char]})
+	// 各シンボルをソートしてからノードとしてヒープに追加（安定性を保証）
+	for _, symbol := range sortedSymbols(freq) {
+		heap.Push(h, &Node{Symbol: symbol, Freq: freq[symbol]})
 	}
 
 	// Huffman木を構築
@@ -103,30 +180,33 @@ func buildTree(freq map[byte]int) *Node {
 			Right: right,
 		}
 		heap.Push(h, merged)
+		if tracer != nil {
+			traceMerge(tracer, merged, h.Len())
+		}
 	}
 
 	return heap.Pop(h).(*Node)
 }
 
 // buildCodeTable はHuffman符号テーブルを構築します
-func buildCodeTable(root *Node) map[byte]string {
+func buildCodeTable(root *Node) map[uint16]string {
 	if root == nil {
-		return make(map[byte]string)
+		return make(map[uint16]string)
 	}
 
-	// 単一文字の場合
+	// 単一シンボルの場合
 	if root.IsLeaf() {
-		return map[byte]string{root.Char: "0"}
+		return map[uint16]string{root.Symbol: "0"}
 	}
 
-	codes := make(map[byte]string)
+	codes := make(map[uint16]string)
 	var buildCodes func(*Node, string)
 	buildCodes = func(node *Node, code string) {
 		if node == nil {
 			return
 		}
 		if node.IsLeaf() {
-			codes[node.Char] = code
+			codes[node.Symbol] = code
 			return
 		}
 		buildCodes(node.Left, code+"0")
@@ -137,68 +217,95 @@ func buildCodeTable(root *Node) map[byte]string {
 	return codes
 }
 
+// CodeTable はデータの各バイトに割り当てられるHuffman符号を返します
+// 8ビット単位の Compressor が使う符号と同じで、出現しないバイトは含みません。
+func CodeTable(data []byte) map[byte]string {
+	codes := buildCodeTable(buildTree(buildFrequencyTable(byteSymbols(data)), nil))
+	table := make(map[byte]string, len(codes))
+	for symbol, code := range codes {
+		table[byte(symbol)] = code
+	}
+	return table
+}
+
+// Overhead は data を圧縮したときのヘッダーのバイト数を返します（common.Overheader）
+// 1バイト単位では出現したバイトごとに5バイトの頻度表を持つため、種類の多い小さな
+// データでは符号化で節約できる分よりヘッダーの方が大きくなります。
+func (h *Compressor) Overhead(data []byte) int {
+	if h.width == 2 {
+		return wideOverhead(data)
+	}
+	var seen [256]bool
+	distinct := 0
+	for _, b := range data {
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+	}
+	// 文字数(1) + 頻度表(5 * 文字数、空のデータも1つ) + データ長(4) + 余分なビット数(1)
+	return 1 + 5*max(distinct, 1) + 4 + 1
+}
+
 // Compress はHuffmanアルゴリズムでデータを圧縮します
+// 空のデータもヘッダーを持つ圧縮データになるため、出力が空になることはありません
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
 func (h *Compressor) Compress(data []byte) ([]byte, error) {
-	if len(data) == 0 {
-		return []byte{}, nil
+	if err := h.oneShot.Check(h.Name(), len(data)); err != nil {
+		return nil, err
 	}
+	if h.width == 2 {
+		return compressWide(data, h.tracer, h.timings, h.costMap)
+	}
+	start := h.timings.Start()
 
 	// 頻度テーブルを構築
-	freq := buildFrequencyTable(data)
+	symbols := byteSymbols(data)
+	freq := buildFrequencyTable(symbols)
+	if len(freq) == 0 {
+		// 空のデータは頻度0のシンボル1つ、データ長0として保存します
+		freq[0] = 0
+	}
+	start = h.timings.Since(PhaseCount, start)
 
 	// Huffman木を構築
-	root := buildTree(freq)
+	root := buildTree(freq, h.tracer)
 	if root == nil {
 		return nil, fmt.Errorf("failed to build Huffman tree")
 	}
 
 	// 符号テーブルを構築
-	codes := buildCodeTable(root)
+	model, err := treeModel(root)
+	if err != nil {
+		return nil, err
+	}
+	start = h.timings.Since(PhaseTree, start)
 
 	// 圧縮データを構築
 	var compressed []byte
 
 	// ヘッダー: 文字数 + 頻度テーブル
+	// 文字数は1〜256なので、256種類すべてが出現した場合は0として保存します
 	compressed = append(compressed, byte(len(freq)))
 
 	// 頻度テーブルをソートして保存
-	var chars []byte
-	for char := range freq {
-		chars = append(chars, char)
-	}
-	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
-
-	for _, char := range chars {
-		compressed = append(compressed, char)
-		f := freq[char]
+	for _, symbol := range sortedSymbols(freq) {
+		compressed = append(compressed, byte(symbol))
+		f := freq[symbol]
 		// 頻度を4バイトで保存
 		compressed = append(compressed,
 			byte(f>>24), byte(f>>16), byte(f>>8), byte(f))
 	}
 
 	// データを符号化
-	var bits []byte
-	bitCount := 0
-	currentByte := byte(0)
-
-	for _, b := range data {
-		code := codes[b]
-		for _, bit := range code {
-			if bit == '1' {
-				currentByte |= (1 << (7 - bitCount))
-			}
-			bitCount++
-			if bitCount == 8 {
-				bits = append(bits, currentByte)
-				currentByte = 0
-				bitCount = 0
-			}
+	if h.costMap != nil {
+		for i, s := range symbols {
+			h.costMap(i, 1, float64(model.lengths[s]))
 		}
 	}
-
-	// 最後のバイトを処理
-	if bitCount > 0 {
-		bits = append(bits, currentByte)
+	bits, nbits, err := EncodeWithModel(model, data)
+	if err != nil {
+		return nil, err
 	}
 
 	// データ長（ビット数）を保存
@@ -207,105 +314,167 @@ func (h *Compressor) Compress(data []byte) ([]byte, error) {
 		byte(dataLen>>24), byte(dataLen>>16), byte(dataLen>>8), byte(dataLen))
 
 	// 余分なビット数を保存
-	paddingBits := byte(8 - bitCount)
-	if bitCount == 0 {
-		paddingBits = 0
-	}
-	compressed = append(compressed, paddingBits)
+	compressed = append(compressed, byte(8*len(bits)-nbits))
 
 	// 符号化されたデータを追加
 	compressed = append(compressed, bits...)
 
+	h.timings.Since(PhaseEncode, start)
 	return compressed, nil
 }
 
+// WithTimings は圧縮のフェーズ（PhaseCount、PhaseTree、PhaseEncode）ごとの処理時間を
+// t に記録する Compressor を返します（common.Timed）
+func (h *Compressor) WithTimings(t *common.Timings) common.Compressor {
+	c := *h
+	c.timings = t
+	return &c
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (h *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	c := *h
+	c.oneShot = common.NewOneShotLimit(n)
+	return &c
+}
+
+// WithCostMap は Compress でシンボルごとに符号のビット数を通知する Compressor を返します（common.CostMapped）
+// 16bitシンボルでは2バイトごとに、奇数の長さの最後の1バイト（ヘッダーに格納）は8ビットを通知します。
+// 頻度表などのヘッダーは通知しません。
+func (h *Compressor) WithCostMap(m common.CostMap) common.Compressor {
+	c := *h
+	c.costMap = m
+	return &c
+}
+
+// nodeSize はHuffman木の1ノードが使用するメモリ量です（予算の計算に使用）
+const nodeSize = int64(unsafe.Sizeof(Node{}))
+
 // Decompress はHuffman圧縮されたデータを展開します
 func (h *Compressor) Decompress(data []byte) ([]byte, error) {
+	return h.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 木の再構築と出力バッファの確保の前に、それぞれ予算を確認します
+func (h *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
 	if len(data) == 0 {
-		return []byte{}, nil
+		return nil, common.NewDecodeError("Huffman", data, 0, "empty compressed data")
+	}
+	if h.width == 2 {
+		return decompressWide(data, opts)
 	}
 
 	offset := 0
 
 	// 文字数を読み取り
 	if offset >= len(data) {
-		return nil, fmt.Errorf("invalid compressed data: missing character count")
+		return nil, common.NewDecodeError("Huffman", data, offset, "missing character count")
 	}
 	charCount := int(data[offset])
+	if charCount == 0 {
+		charCount = 256
+	}
 	offset++
 
 	// 頻度テーブルを再構築
-	freq := make(map[byte]int)
+	freq := make(map[uint16]int)
+	total := 0
 	for i := 0; i < charCount; i++ {
 		if offset+4 >= len(data) {
-			return nil, fmt.Errorf("invalid compressed data: incomplete frequency table")
+			return nil, common.NewDecodeError("Huffman", data, offset, "incomplete frequency table")
 		}
 		char := data[offset]
+		if _, dup := freq[uint16(char)]; dup {
+			return nil, corrupted(data, offset, "duplicate symbol %#02x in frequency table", char)
+		}
 		offset++
 		f := int(data[offset])<<24 | int(data[offset+1])<<16 |
 			int(data[offset+2])<<8 | int(data[offset+3])
 		offset += 4
-		freq[char] = f
-	}
-
-	// Huffman木を再構築
-	root := buildTree(freq)
-	if root == nil {
-		return nil, fmt.Errorf("failed to rebuild Huffman tree")
+		freq[uint16(char)] = f
+		total += f
 	}
 
 	// データ長を読み取り
 	if offset+4 >= len(data) {
-		return nil, fmt.Errorf("invalid compressed data: missing data length")
+		return nil, common.NewDecodeError("Huffman", data, offset, "missing data length")
 	}
 	dataLen := int(data[offset])<<24 | int(data[offset+1])<<16 |
 		int(data[offset+2])<<8 | int(data[offset+3])
+
+	// 頻度表とデータ長は同じデータを表すので、頻度の合計はデータ長と一致する
+	switch {
+	case dataLen > total:
+		return nil, corrupted(data, offset, "data length %d exceeds the sum of frequencies %d", dataLen, total)
+	case dataLen != total:
+		return nil, corrupted(data, offset, "data length %d does not match the sum of frequencies %d", dataLen, total)
+	}
 	offset += 4
 
 	// 余分なビット数を読み取り
 	if offset >= len(data) {
-		return nil, fmt.Errorf("invalid compressed data: missing padding bits")
+		return nil, common.NewDecodeError("Huffman", data, offset, "missing padding bits")
 	}
 	paddingBits := int(data[offset])
+	if paddingBits > 7 {
+		return nil, corrupted(data, offset, "invalid padding bits %d", paddingBits)
+	}
 	offset++
 
-	// 符号化されたデータを展開
-	var result []byte
-	current := root
-
-	// 単一文字の場合
-	if root.IsLeaf() {
-		for i := 0; i < dataLen; i++ {
-			result = append(result, root.Char)
-		}
-		return result, nil
+	// Huffman木を再構築（ノード数は最大で 2×文字数-1）
+	if err := opts.Budget.Reserve(int64(2*len(freq)) * nodeSize); err != nil {
+		return nil, err
+	}
+	root := buildTree(freq, nil)
+	if root == nil {
+		return nil, fmt.Errorf("failed to rebuild Huffman tree")
 	}
 
-	for offset < len(data) && len(result) < dataLen {
-		b := data[offset]
-
-		for i := 7; i >= 0 && len(result) < dataLen; i-- {
-			// 最後のバイトの余分なビットをスキップ
-			if offset == len(data)-1 && i < paddingBits {
-				break
-			}
-
-			bit := (b >> i) & 1
-			if bit == 1 {
-				current = current.Right
-			} else {
-				current = current.Left
-			}
+	// 符号化データのビット数は「頻度×符号長」の合計と一致する
+	// （データ長×最短の符号長から、データ長×最長の符号長の範囲に入る）。
+	// 出力を確保する前に確認するため、短い入力で巨大なデータ長を指定しても確保しない。
+	wantBits := 0
+	for symbol, length := range codeLengths(root) {
+		wantBits += freq[symbol] * length
+	}
+	payloadBits := 8*(len(data)-offset) - paddingBits
+	if payloadBits != wantBits {
+		return nil, corrupted(data, offset, "encoded data has %d bits, frequency table requires %d", max(payloadBits, 0), wantBits)
+	}
 
-			if current.IsLeaf() {
-				result = append(result, current.Char)
-				current = root
-			}
+	// 符号化されたデータを展開
+	if err := opts.ReserveOutput(int64(dataLen), int64(dataLen)); err != nil {
+		return nil, err
+	}
+	model, err := treeModel(root)
+	if err != nil {
+		return nil, corrupted(data, offset, "%v", err)
+	}
+	result, err := DecodeWithModel(model, data[offset:], payloadBits, dataLen)
+	if err != nil {
+		var decodeErr *common.DecodeError
+		if errors.As(err, &decodeErr) {
+			return nil, corrupted(data, offset+int(decodeErr.Offset), "%s", decodeErr.Reason)
 		}
-		offset++
+		return nil, err
 	}
-
 	return result, nil
 }
 
-var _ common.Compressor = (*Compressor)(nil)
+// corrupted は頻度表と符号化データが一致しない箇所を表すエラーを作成します
+// errors.Is(err, common.ErrCorrupted) で判定できます。
+func corrupted(data []byte, offset int, format string, args ...any) error {
+	err := common.NewDecodeError("Huffman", data, offset, format, args...)
+	err.Err = common.ErrCorrupted
+	return err
+}
+
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+	_ common.FloorEstimator      = (*Compressor)(nil)
+	_ common.OneShotLimited      = (*Compressor)(nil)
+	_ common.CostMapped          = (*Compressor)(nil)
+)
@@ -2,7 +2,20 @@ package huffman
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
 func TestCompressor_Name(t *testing.T) {
@@ -21,6 +34,13 @@ func TestCompressor_EmptyData(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Compress failed: %v", err)
 	}
+	// 空のデータも空でない圧縮データになり、空の圧縮データは不正として扱われる
+	if len(compressed) == 0 {
+		t.Error("Expected non-empty compressed data for empty input")
+	}
+	if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for empty compressed data, got %v", err)
+	}
 
 	decompressed, err := compressor.Decompress(compressed)
 	if err != nil {
@@ -79,6 +99,27 @@ func TestCompressor_BasicText(t *testing.T) {
 	}
 }
 
+func TestCodeTable(t *testing.T) {
+	codes := CodeTable([]byte("abracadabra"))
+	if len(codes) != 5 {
+		t.Fatalf("Expected codes for 5 bytes, got %v", codes)
+	}
+	// 最も多い 'a' が最も短く、どの符号もほかの符号の接頭辞にならない
+	for b, code := range codes {
+		if b != 'a' && len(code) < len(codes['a']) {
+			t.Errorf("Expected 'a' (%s) to be no longer than %q (%s)", codes['a'], b, code)
+		}
+		for other, otherCode := range codes {
+			if b != other && strings.HasPrefix(otherCode, code) {
+				t.Errorf("%q (%s) is a prefix of %q (%s)", b, code, other, otherCode)
+			}
+		}
+	}
+	if len(CodeTable(nil)) != 0 {
+		t.Error("Expected no codes for empty data")
+	}
+}
+
 func TestCompressor_LargeData(t *testing.T) {
 	compressor := NewCompressor()
 
@@ -103,6 +144,149 @@ func TestCompressor_LargeData(t *testing.T) {
 	}
 }
 
+func TestCompressor_AllByteValues(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 256種類すべてのバイトが出現するデータ（文字数ヘッダーが1バイトに収まらないケース）
+	original := make([]byte, 512)
+	for i := range original {
+		original[i] = byte(i * 7)
+	}
+
+	compressed, err := compressor.Compress(original)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	decompressed, err := compressor.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+
+	if !bytes.Equal(original, decompressed) {
+		t.Errorf("Data mismatch")
+	}
+}
+
+func TestCompressor_BudgetPathologicalDataLen(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 2文字の頻度表 + 巨大なデータ長（約2GB）を宣言するヘッダー
+	// 頻度の合計と一致しないため、出力を確保する前に ErrCorrupted になる
+	payload := []byte{
+		2,
+		'a', 0, 0, 0, 1,
+		'b', 0, 0, 0, 1,
+		0x7F, 0xFF, 0xFF, 0xFF, // dataLen
+		0,    // padding
+		0x55, // 符号化データ
+	}
+
+	opts := common.DecompressOptions{
+		MaxOutputSize: 4 << 30, // 出力上限には収まる
+		Budget:        common.NewBudget(1 << 20),
+	}
+	_, err := compressor.DecompressWithOptions(payload, opts)
+	if !errors.Is(err, common.ErrCorrupted) {
+		t.Fatalf("Expected ErrCorrupted, got %v", err)
+	}
+	if opts.Budget.Used() != 0 {
+		t.Errorf("Expected nothing reserved, got %d bytes", opts.Budget.Used())
+	}
+
+	// ヘッダーが正しい大きなデータは予算で止める
+	compressed, err := compressor.Compress(bytes.Repeat([]byte("ab"), 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Budget = common.NewBudget(1 << 20)
+	if _, err := compressor.DecompressWithOptions(compressed, opts); !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if opts.Budget.Used() > 1<<20 {
+		t.Errorf("Budget usage %d exceeds limit", opts.Budget.Used())
+	}
+}
+
+func TestDecompress_HeaderInvariants(t *testing.T) {
+	// 文字数(1) + 頻度表('a', 'b') + データ長(11〜14) + パディング(15) + 符号化データ(16)
+	valid, err := NewCompressor().Compress([]byte("aaab"))
+	if err != nil || len(valid) != 17 || valid[14] != 4 || valid[15] != 4 {
+		t.Fatalf("Unexpected layout % x (err %v)", valid, err)
+	}
+
+	with := func(edit func(p []byte) []byte) []byte {
+		return edit(append([]byte(nil), valid...))
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"data length exceeds frequencies", with(func(p []byte) []byte { p[14] = 200; return p })},
+		{"frequencies exceed data length", with(func(p []byte) []byte { p[14] = 3; return p })},
+		{"huge frequencies", with(func(p []byte) []byte {
+			copy(p[1:], []byte{'a', 0x7F, 0xFF, 0xFF, 0xFF})
+			copy(p[11:], []byte{0x80, 0, 0, 0})
+			return p
+		})},
+		{"duplicate symbol", with(func(p []byte) []byte { p[6] = 'a'; return p })},
+		{"missing payload bytes", with(func(p []byte) []byte { return p[:len(p)-1] })},
+		{"extra payload bytes", with(func(p []byte) []byte { return append(p, 0) })},
+		{"padding too large", with(func(p []byte) []byte { p[15] = 8; return p })},
+		{"padding mismatch", with(func(p []byte) []byte { p[15] = 3; return p })},
+	}
+
+	// 1ビットの 'a' を含まない同じ長さのビット列は、2ビットの符号だけで3文字になる
+	short, _ := NewCompressor().Compress([]byte("aabc"))
+	fill := byte(0x00)
+	if CodeTable([]byte("aabc"))['a'] == "0" {
+		fill = 0xFC
+	}
+	short[len(short)-1] = fill
+	tests = append(tests, struct {
+		name    string
+		payload []byte
+	}{"too few symbols in bit stream", short})
+	for _, tt := range tests {
+		start := time.Now()
+		_, err := NewCompressor().Decompress(tt.payload)
+		if !errors.Is(err, common.ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", tt.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%s: took %v", tt.name, elapsed)
+		}
+	}
+}
+
+func TestCompressor_BudgetRoundTrip(t *testing.T) {
+	compressor := NewCompressor()
+	original := bytes.Repeat([]byte("hello huffman "), 100)
+
+	compressed, err := compressor.Compress(original)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	budget := common.NewBudget(64 << 10)
+	decompressed, err := compressor.DecompressWithOptions(compressed, common.DecompressOptions{Budget: budget})
+	if err != nil {
+		t.Fatalf("DecompressWithOptions failed: %v", err)
+	}
+	if !bytes.Equal(original, decompressed) {
+		t.Errorf("Data mismatch")
+	}
+	if budget.Used() < int64(len(original)) {
+		t.Errorf("Expected output to be accounted, used %d", budget.Used())
+	}
+
+	// 出力上限を下回る場合はエラー
+	_, err = compressor.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 100})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
 func BenchmarkCompress(b *testing.B) {
 	compressor := NewCompressor()
 	data := []byte("The quick brown fox jumps over the lazy dog. " +
@@ -135,3 +319,900 @@ func BenchmarkDecompress(b *testing.B) {
 		}
 	}
 }
+
+// utf16LE は文字列をUTF-16LEに変換します
+func utf16LE(s string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
+
+// audioSamples は16bitの音声風データ（小さな振幅の正弦波+ノイズ）を作成します
+// 符号付きの小さな値は上位バイトが0x00と0xFFに分かれるため、バイト単位では相関を捉えられません
+func audioSamples(n int) []byte {
+	r := rand.New(rand.NewSource(1))
+	var out []byte
+	for i := 0; i < n; i++ {
+		v := 200*math.Sin(float64(i)*2*math.Pi/64) + float64(r.Intn(9)-4)
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(v)))
+	}
+	return out
+}
+
+func TestCompressorWidth2_BeatsWidth1(t *testing.T) {
+	narrow := NewCompressor()
+	wide, err := NewCompressorWithWidth(2)
+	if err != nil {
+		t.Fatalf("NewCompressorWithWidth failed: %v", err)
+	}
+
+	inputs := map[string][]byte{
+		"utf16-japanese": utf16LE(strings.Repeat("吾輩は猫である。名前はまだ無い。どこで生れたかとんと見当がつかぬ。", 40)),
+		"audio":          audioSamples(65536),
+	}
+
+	for name, data := range inputs {
+		narrowOut, err := narrow.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: width 1 Compress failed: %v", name, err)
+		}
+		wideOut, err := wide.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: width 2 Compress failed: %v", name, err)
+		}
+
+		decompressed, err := wide.Decompress(wideOut)
+		if err != nil {
+			t.Fatalf("%s: width 2 Decompress failed: %v", name, err)
+		}
+		if !bytes.Equal(data, decompressed) {
+			t.Fatalf("%s: width 2 round trip mismatch", name)
+		}
+
+		t.Logf("%s: %d bytes -> width 1: %d, width 2: %d", name, len(data), len(narrowOut), len(wideOut))
+		if len(wideOut) >= len(narrowOut) {
+			t.Errorf("%s: width 2 (%d) did not beat width 1 (%d)", name, len(wideOut), len(narrowOut))
+		}
+	}
+}
+
+func TestCompressorWidth2_RoundTripCorpus(t *testing.T) {
+	wide, _ := NewCompressorWithWidth(2)
+
+	// 奇数長（末尾の1バイトを別に保存）も含む
+	for _, sample := range testcorpus.Samples() {
+		compressed, err := wide.Compress(sample.Data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", sample.Name, err)
+		}
+		decompressed, err := wide.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", sample.Name, err)
+		}
+		if !bytes.Equal(sample.Data, decompressed) {
+			t.Errorf("%s: data mismatch", sample.Name)
+		}
+	}
+}
+
+func TestCompressorWidth2_InvalidData(t *testing.T) {
+	wide, _ := NewCompressorWithWidth(2)
+	valid, err := wide.Compress(utf16LE("こんにちは、世界"))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// offset は不正なフィールドの位置（符号の途中で切れた場合は最後の符号を含むバイト）
+	cases := map[string]struct {
+		data   []byte
+		offset int64
+	}{
+		"unknown flags":   {[]byte{0x80, 0, 0}, 0},
+		"missing odd":     {[]byte{flagOddByte}, 1},
+		"table too large": {[]byte{0, 1, 0xFF, 0xFF, 0x7F}, 2},
+		"zero length":     {[]byte{0, 1, 1, 0, 0, 0xFF}, 4},
+		"over-subscribed": {[]byte{0, 1, 3, 0, 1, 0, 1, 0, 1, 0xFF}, 3},
+		"count too large": {[]byte{0, 0xFF, 0x01, 1, 0, 1, 0x00}, 6},
+		"truncated":       {valid[:len(valid)-1], int64(len(valid) - 2)},
+	}
+	for name, tc := range cases {
+		_, err := wide.Decompress(tc.data)
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+			continue
+		}
+		var decodeErr *common.DecodeError
+		if !errors.As(err, &decodeErr) || !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: expected DecodeError, got %v", name, err)
+			continue
+		}
+		if decodeErr.Offset != tc.offset {
+			t.Errorf("%s: expected offset %d, got %d (%v)", name, tc.offset, decodeErr.Offset, err)
+		}
+	}
+}
+
+func TestCompressorWidth2_IncompleteCodeTable(t *testing.T) {
+	wide, _ := NewCompressorWithWidth(2)
+	valid, err := wide.Compress([]byte("hello hello hello world"))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// "hello hello hello world" の圧縮データの出現シンボル数を1バイト壊したもの
+	// 2ビットの符号のシンボルが1つだけの（使われない符号が残る）表で、以前は復号の位置が
+	// 桁あふれしてパニックしていた
+	corrupted := []byte{
+		0x01, 0x64, 0x0b, 0x01, 0xef, 0x40, 0x02, 0xf8, 0x89, 0x01, 0x02,
+		0x83, 0x0e, 0x02, 0x05, 0x03, 0x84, 0x06, 0x03, 0x61, 0x86, 0x3e,
+	}
+	cases := map[string][]byte{"incomplete table": corrupted}
+	for i := range valid {
+		for _, mask := range []byte{0x01, 0x80, 0xFF} {
+			mutated := bytes.Clone(valid)
+			mutated[i] ^= mask
+			cases[fmt.Sprintf("byte %d ^ %#x", i, mask)] = mutated
+		}
+	}
+
+	for name, data := range cases {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					t.Errorf("%s: Decompress panicked: %v", name, v)
+				}
+			}()
+			_, err := wide.Decompress(data)
+			if err != nil && !errors.As(err, new(*common.DecodeError)) {
+				t.Errorf("%s: expected DecodeError, got %v", name, err)
+			}
+		}()
+	}
+
+	_, err = wide.Decompress(corrupted)
+	var decodeErr *common.DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, common.ErrInvalidData) {
+		t.Fatalf("Expected DecodeError, got %v", err)
+	}
+	if decodeErr.Offset != 4 {
+		t.Errorf("Expected the offset of the symbol table 4, got %d (%v)", decodeErr.Offset, err)
+	}
+}
+
+func TestDecompress_InvalidDataOffset(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 文字数2だが頻度表が1エントリ分しかない
+	_, err := compressor.Decompress([]byte{2, 'a', 0, 0, 0, 1})
+	var decodeErr *common.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected DecodeError, got %v", err)
+	}
+	if decodeErr.Offset != 6 {
+		t.Errorf("Expected offset 6, got %d", decodeErr.Offset)
+	}
+}
+
+func TestNewCompressorWithWidth_Invalid(t *testing.T) {
+	if _, err := NewCompressorWithWidth(3); err == nil {
+		t.Error("Expected error for width 3")
+	}
+}
+
+func TestAnalyzeCodes(t *testing.T) {
+	// a:3, b:2, c:1 → a は1ビット、b と c は2ビット
+	stats := AnalyzeCodes([]byte("aaabbc"))
+	if stats.Frequencies['a'] != 3 || stats.Frequencies['b'] != 2 || stats.Frequencies['c'] != 1 {
+		t.Errorf("Unexpected frequencies: a=%d b=%d c=%d", stats.Frequencies['a'], stats.Frequencies['b'], stats.Frequencies['c'])
+	}
+	if stats.CodeLengths['a'] != 1 || stats.CodeLengths['b'] != 2 || stats.CodeLengths['c'] != 2 || stats.CodeLengths['d'] != 0 {
+		t.Errorf("Unexpected code lengths: a=%d b=%d c=%d d=%d",
+			stats.CodeLengths['a'], stats.CodeLengths['b'], stats.CodeLengths['c'], stats.CodeLengths['d'])
+	}
+	if stats.EncodedBits != 9 {
+		t.Errorf("Expected 9 encoded bits, got %d", stats.EncodedBits)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"frequencies", "code_lengths"} {
+		if values, ok := fields[key].([]any); !ok || len(values) != 256 {
+			t.Errorf("Expected %q to be an array of 256 values in %s", key, data)
+		}
+	}
+	for _, key := range []string{"data_size", "encoded_bits", "entropy_bits"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("Expected field %q in %s", key, data)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 257 || lines[0] != "symbol,frequency,code_length" || lines['a'+1] != "97,3,1" {
+		t.Errorf("Unexpected CSV (%d lines): %q...", len(lines), lines[:2])
+	}
+}
+
+func TestFloor(t *testing.T) {
+	// a:3, b:2, c:1 の0次のエントロピーは 3*log2(2) + 2*log2(3) + log2(6) ビット
+	want := 3 + 2*math.Log2(3) + math.Log2(6)
+	stats := AnalyzeCodes([]byte("aaabbc"))
+	if math.Abs(stats.EntropyBits-want) > 1e-9 {
+		t.Errorf("Expected %f entropy bits, got %f", want, stats.EntropyBits)
+	}
+	if float64(stats.EncodedBits) < stats.EntropyBits || float64(stats.EncodedBits) >= stats.EntropyBits+6 {
+		t.Errorf("Expected the encoded bits %d to be within 1 bit per symbol of %f", stats.EncodedBits, stats.EntropyBits)
+	}
+	if got := NewCompressor().Floor([]byte("aaabbc")); math.Abs(got-want/8) > 1e-9 {
+		t.Errorf("Expected a floor of %f bytes, got %f", want/8, got)
+	}
+
+	// 16bitシンボルでは2バイトの組の頻度を使う: "abab" は1種類のシンボルで0ビット、端数の1バイトは8ビット
+	wide, _ := NewCompressorWithWidth(2)
+	if got := wide.Floor([]byte("ababababa")); got != 1 {
+		t.Errorf("Expected a 16-bit floor of 1 byte, got %f", got)
+	}
+	if got := NewCompressor().Floor([]byte("abababab")); got != 1 {
+		t.Errorf("Expected an 8-bit floor of 1 byte, got %f", got)
+	}
+}
+
+func TestWithTracer(t *testing.T) {
+	var merges []MergeEvent
+	tracer := common.TracerFunc(func(event any) { merges = append(merges, event.(MergeEvent)) })
+
+	// 4種類のシンボル a:4 b:2 c:1 d:1 は3回の結合で木になる
+	data := []byte("aaaabbcd")
+	compressed, err := NewCompressor().WithTracer(tracer).Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := NewCompressor().Compress(data); !bytes.Equal(compressed, want) {
+		t.Errorf("Expected tracing not to change the output")
+	}
+	if len(merges) != 3 {
+		t.Fatalf("Expected 3 merges, got %d: %+v", len(merges), merges)
+	}
+	for i, want := range []struct{ freq, remaining int }{{2, 3}, {4, 2}, {8, 1}} {
+		m := merges[i]
+		if m.Freq != want.freq || m.Remaining != want.remaining || m.Left.Freq+m.Right.Freq != m.Freq {
+			t.Errorf("Merge %d: unexpected event %+v", i, m)
+		}
+	}
+	first := append(merges[0].Left.Symbols, merges[0].Right.Symbols...)
+	if slices.Sort(first); !slices.Equal(first, []uint16{'c', 'd'}) {
+		t.Errorf("Expected the rarest symbols to be merged first, got %v", first)
+	}
+	if all := append(merges[2].Left.Symbols, merges[2].Right.Symbols...); len(all) != 4 {
+		t.Errorf("Expected the last merge to cover all symbols, got %v", all)
+	}
+
+	// 1種類だけなら結合しない、展開では通知しない
+	merges = nil
+	traced := NewCompressor().WithTracer(tracer)
+	compressed, _ = traced.Compress([]byte("zzzz"))
+	traced.Decompress(compressed)
+	if len(merges) != 0 {
+		t.Errorf("Expected no merges, got %+v", merges)
+	}
+
+	// 16bitシンボルでも同じ
+	wide, _ := NewCompressorWithWidth(2)
+	wide.WithTracer(tracer).Compress([]byte{1, 0, 2, 0, 3, 0})
+	if len(merges) != 2 {
+		t.Errorf("Expected 2 merges for 3 wide symbols, got %d", len(merges))
+	}
+}
+
+func TestWithTimings(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 200)
+	wide, _ := NewCompressorWithWidth(2)
+	for _, c := range []*Compressor{NewCompressor(), wide} {
+		timings := common.NewTimings()
+		start := time.Now()
+		compressed, err := c.WithTimings(timings).Compress(data)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := c.Compress(data); !bytes.Equal(compressed, want) {
+			t.Errorf("%s: Expected timing not to change the output", c.Name())
+		}
+
+		// 記録するフェーズがすべてあり、合計は呼び出し全体の時間以下になる
+		var sum time.Duration
+		for _, phase := range []string{PhaseCount, PhaseTree, PhaseEncode} {
+			if !slices.Contains(timings.Phases(), phase) {
+				t.Errorf("%s: Expected phase %q, got %v", c.Name(), phase, timings.Phases())
+			}
+			sum += timings.Get(phase)
+		}
+		if sum <= 0 || sum > elapsed {
+			t.Errorf("%s: Expected phases to sum to at most %v, got %v", c.Name(), elapsed, sum)
+		}
+	}
+}
+
+// modelMessages は似た構造の小さなJSONメッセージを n 件生成します
+func modelMessages(n int, seed int64) [][]byte {
+	rng := rand.New(rand.NewSource(seed))
+	names := []string{"alice", "bob", "carol", "dave", "erin"}
+	messages := make([][]byte, n)
+	for i := range messages {
+		messages[i] = fmt.Appendf(nil, `{"id":%d,"user":"%s","status":"ok","score":%d}`,
+			rng.Intn(100000), names[rng.Intn(len(names))], rng.Intn(1000))
+	}
+	return messages
+}
+
+func TestModel_HeldOutMessages(t *testing.T) {
+	model, err := BuildModel(bytes.Join(modelMessages(200, 1), nil))
+	if err != nil {
+		t.Fatalf("BuildModel failed: %v", err)
+	}
+
+	// モデルは別に保存して読み込み直す
+	encoded, err := model.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var loaded Model
+	if err := loaded.UnmarshalBinary(encoded); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	totalModel, totalSelf, totalOriginal := 0, 0, 0
+	for _, msg := range modelMessages(50, 2) {
+		compressed, err := model.Compress(msg)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		got, err := loaded.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("Decompress failed: %v", err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("Round trip mismatch: %q -> %q", msg, got)
+		}
+		self, _ := NewCompressor().Compress(msg)
+		totalModel += len(compressed)
+		totalSelf += len(self)
+		totalOriginal += len(msg)
+	}
+
+	// 頻度表を含まないため、1件ずつの Huffman より大幅に小さく、元のサイズよりも小さい
+	t.Logf("model %d bytes, per message: model %d, self-contained %d, original %d (total)", len(encoded), totalModel, totalSelf, totalOriginal)
+	if totalModel*2 > totalSelf || totalModel >= totalOriginal {
+		t.Errorf("Expected shared model to be much smaller: model %d, self-contained %d, original %d", totalModel, totalSelf, totalOriginal)
+	}
+}
+
+// TestModel_UnseenSymbols はサンプルにないバイトをエスケープして符号化することを確認します
+func TestModel_UnseenSymbols(t *testing.T) {
+	model, _ := BuildModel([]byte("aaaabbc"))
+	if model.Symbols() != 3 {
+		t.Errorf("Expected 3 symbols, got %d", model.Symbols())
+	}
+
+	seen, _ := model.Compress([]byte("abcabc"))
+	unseen, _ := model.Compress([]byte("abcxyz"))
+	for _, compressed := range [][]byte{seen, unseen} {
+		if _, err := model.Decompress(compressed); err != nil {
+			t.Fatalf("Decompress failed: %v", err)
+		}
+	}
+	got, _ := model.Decompress(unseen)
+	if string(got) != "abcxyz" {
+		t.Errorf("Expected unseen bytes to round trip, got %q", got)
+	}
+	// エスケープしたバイトはエスケープの符号と8ビットを使う
+	if len(unseen) <= len(seen) {
+		t.Errorf("Expected escaped bytes to cost more: seen %d, unseen %d", len(seen), len(unseen))
+	}
+
+	// 空のサンプルではすべてのバイトをエスケープする
+	empty, err := BuildModel(nil)
+	if err != nil {
+		t.Fatalf("BuildModel failed: %v", err)
+	}
+	data := testcorpus.Random(256, 1)
+	compressed, _ := empty.Compress(data)
+	if got, err := empty.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Round trip with an empty model failed: %v", err)
+	}
+	for _, s := range testcorpus.Samples() {
+		compressed, _ := model.Compress(s.Data)
+		if got, err := model.Decompress(compressed); err != nil || !bytes.Equal(got, s.Data) {
+			t.Errorf("%s: round trip failed: %v", s.Name, err)
+		}
+	}
+}
+
+func TestModel_Invalid(t *testing.T) {
+	model, _ := BuildModel([]byte("hello world"))
+	encoded, _ := model.MarshalBinary()
+
+	models := map[string][]byte{
+		"empty":           {},
+		"bad magic":       []byte("TZHX\x01\x01\x00\x01"),
+		"no symbols":      []byte("TZHM\x01\x00"),
+		"truncated":       encoded[:len(encoded)-1],
+		"trailing":        append(bytes.Clone(encoded), 0),
+		"no escape":       []byte("TZHM\x01\x02\x61\x01\x00\x01"),
+		"over-subscribed": []byte("TZHM\x01\x03\x61\x01\x00\x01\x9d\x01\x01"),
+	}
+	for name, data := range models {
+		var m Model
+		if err := m.UnmarshalBinary(data); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: Expected ErrInvalidData, got %v", name, err)
+		}
+	}
+	var m Model
+	if err := m.UnmarshalBinary([]byte("TZHM\x02\x01\x80\x02\x01")); !errors.As(err, new(*common.ErrUnsupportedVersion)) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	compressed, _ := model.Compress([]byte("hello"))
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"too long":  append([]byte{0x40}, compressed[1:]...),
+		"truncated": compressed[:len(compressed)-1],
+	} {
+		if _, err := model.Decompress(data); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: Expected ErrInvalidData, got %v", name, err)
+		}
+	}
+	if _, err := model.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 2}); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+// TestEncodeWithModel_Unframed は枠組みのない符号化データを、別に記録した長さで展開できることを確認します
+func TestEncodeWithModel_Unframed(t *testing.T) {
+	model, err := BuildModel(bytes.Join(modelMessages(200, 1), nil))
+	if err != nil {
+		t.Fatalf("BuildModel failed: %v", err)
+	}
+
+	// 呼び出し側がメッセージごとのビット数と元のサイズを記録し、符号化データを詰めて並べる
+	type frame struct{ nbits, outLen int }
+	var stream []byte
+	var frames []frame
+	odd := 0
+	for _, msg := range append(modelMessages(50, 2), nil, []byte("\x00\xff unseen")) {
+		bits, nbits, err := EncodeWithModel(model, msg)
+		if err != nil {
+			t.Fatalf("EncodeWithModel failed: %v", err)
+		}
+		if len(bits) != (nbits+7)/8 {
+			t.Errorf("Expected %d bytes for %d bits, got %d", (nbits+7)/8, nbits, len(bits))
+		}
+		if nbits%8 != 0 {
+			odd++
+		}
+		// Model.Compress は元のサイズを前に付けただけの同じ符号化データ
+		if compressed, _ := model.Compress(msg); !bytes.Equal(compressed, append(binary.AppendUvarint(nil, uint64(len(msg))), bits...)) {
+			t.Errorf("Model.Compress(%q) does not match EncodeWithModel", msg)
+		}
+		stream = append(stream, bits...)
+		frames = append(frames, frame{nbits, len(msg)})
+	}
+	if odd == 0 {
+		t.Fatal("Expected some messages to end in the middle of a byte")
+	}
+
+	offset := 0
+	for i, f := range frames {
+		size := (f.nbits + 7) / 8
+		got, err := DecodeWithModel(model, stream[offset:offset+size], f.nbits, f.outLen)
+		if err != nil {
+			t.Fatalf("Message %d: DecodeWithModel failed: %v", i, err)
+		}
+		if len(got) != f.outLen {
+			t.Errorf("Message %d: expected %d bytes, got %d", i, f.outLen, len(got))
+		}
+		offset += size
+	}
+
+	// 最後のバイトの余りのビットは読まない
+	msg := []byte(`{"id":1,"user":"bob"}`)
+	bits, nbits, _ := EncodeWithModel(model, msg)
+	if got, err := DecodeWithModel(model, bits, 8*len(bits), len(msg)); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("Expected padding bits to be ignored, got %q, %v", got, err)
+	}
+
+	for name, tc := range map[string]struct{ nbits, outLen int }{
+		"truncated":    {nbits - 1, len(msg)},
+		"too long":     {nbits, nbits + 1},
+		"negative":     {nbits, -1},
+		"bits too big": {8*len(bits) + 1, len(msg)},
+	} {
+		var decodeErr *common.DecodeError
+		if _, err := DecodeWithModel(model, bits, tc.nbits, tc.outLen); !errors.As(err, &decodeErr) {
+			t.Errorf("%s: Expected DecodeError, got %v", name, err)
+		} else if decodeErr.Offset > int64(len(bits)) {
+			t.Errorf("%s: expected an offset within the bits, got %d", name, decodeErr.Offset)
+		}
+	}
+}
+
+// TestCompressor_FormatUnchanged は Compressor の出力が EncodeWithModel を使う前と同じことを確認します
+func TestCompressor_FormatUnchanged(t *testing.T) {
+	cases := map[string][]byte{
+		"":        {0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		"aaaa":    {0x1, 0x61, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x4, 0x4, 0x0},
+		"aaaabbc": {0x3, 0x61, 0x0, 0x0, 0x0, 0x4, 0x62, 0x0, 0x0, 0x0, 0x2, 0x63, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x7, 0x6, 0xf5, 0x0},
+		"abracadabra": {0x5, 0x61, 0x0, 0x0, 0x0, 0x5, 0x62, 0x0, 0x0, 0x0, 0x2, 0x63, 0x0, 0x0, 0x0, 0x1, 0x64, 0x0, 0x0, 0x0, 0x1,
+			0x72, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0xb, 0x1, 0x59, 0xcf, 0x58},
+	}
+	for input, want := range cases {
+		compressed, err := NewCompressor().Compress([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: Compress failed: %v", input, err)
+		}
+		if !bytes.Equal(compressed, want) {
+			t.Errorf("%q: expected %#v, got %#v", input, want, compressed)
+		}
+		got, err := NewCompressor().Decompress(want)
+		if err != nil || string(got) != input {
+			t.Errorf("%q: Decompress returned %q, %v", input, got, err)
+		}
+	}
+
+}
+
+func TestStaticCompressor_SmallJSON(t *testing.T) {
+	static, err := NewStaticCompressor(ProfileJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippets := []string{
+		`{"id": 17, "name": "Mallory", "ok": true}`,
+		`{"status": "ok", "items": [1, 2, 3], "n": 3}`,
+		`{"user": {"id": 99, "tags": ["a", "b"]}}  `,
+	}
+	for _, snippet := range snippets {
+		data := []byte(snippet[:40])
+		compressed, err := static.Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dynamic, _ := NewCompressor().Compress(data)
+		if len(compressed) >= len(dynamic) || len(compressed) >= len(data) {
+			t.Errorf("%s: expected static %d bytes to be smaller than dynamic %d and the input %d",
+				data, len(compressed), len(dynamic), len(data))
+		}
+		if got, err := static.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: round trip failed: %v", data, err)
+		}
+	}
+}
+
+func TestStaticCompressor_RoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("Hello, world. The quick brown fox jumps over the lazy dog."),
+		[]byte(`{"a": [1, 2.5, null], "b": "ZQX~"}`),
+		[]byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+		// プロファイルのサンプルにないバイトはエスケープで符号化する
+		{0x00, 0xff, 0x80, '\t', 0x7f},
+		testcorpus.Random(1000, 1),
+	}
+	if got := Profiles(); !slices.Equal(got, []Profile{ProfileEnglish, ProfileHex, ProfileJSON}) {
+		t.Errorf("Unexpected profiles %v", got)
+	}
+	for _, profile := range Profiles() {
+		static, err := NewStaticCompressor(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range inputs {
+			compressed, err := static.Compress(data)
+			if err != nil {
+				t.Fatalf("%s: %v", profile, err)
+			}
+			if p, err := StaticProfile(compressed); err != nil || p != profile {
+				t.Errorf("%s: expected the profile ID, got %q (err %v)", profile, p, err)
+			}
+			if got, err := static.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: round trip failed for %q: %v", profile, data, err)
+			}
+		}
+	}
+}
+
+func TestStaticCompressor_Invalid(t *testing.T) {
+	if _, err := NewStaticCompressor("klingon"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+
+	english, _ := NewStaticCompressor(ProfileEnglish)
+	hex, _ := NewStaticCompressor(ProfileHex)
+	compressed, _ := english.Compress([]byte("some english text"))
+	if _, err := hex.Decompress(compressed); err == nil || !strings.Contains(err.Error(), `profile "english"`) {
+		t.Errorf("Expected a profile mismatch error, got %v", err)
+	}
+	for _, data := range [][]byte{nil, {0xee, 0x00}, compressed[:3]} {
+		if _, err := english.Decompress(data); err == nil {
+			t.Errorf("Expected an error for %x", data)
+		}
+	}
+}
+
+func TestCompressParallel_Deterministic(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1000)
+	data = append(data, testcorpus.Random(777, 1)...) // 最後のブロックは途中で終わる
+
+	want, err := CompressParallel(data, 4096, 1)
+	if err != nil {
+		t.Fatalf("CompressParallel failed: %v", err)
+	}
+	for _, workers := range []int{2, 3, 8, 0} {
+		got, err := CompressParallel(data, 4096, workers)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("workers %d: output differs from a single worker (%v)", workers, err)
+		}
+		decompressed, err := DecompressParallel(want, workers, common.DecompressOptions{})
+		if err != nil || !bytes.Equal(decompressed, data) {
+			t.Errorf("workers %d: round trip failed: %v", workers, err)
+		}
+	}
+}
+
+func TestCompressParallel_RoundTrip(t *testing.T) {
+	for _, sample := range testcorpus.Samples() {
+		for _, blockSize := range []int{1, 7, 1 << 20} {
+			compressed, err := CompressParallel(sample.Data, blockSize, 4)
+			if err != nil {
+				t.Fatalf("%s/%d: CompressParallel failed: %v", sample.Name, blockSize, err)
+			}
+			decompressed, err := DecompressParallel(compressed, 4, common.DecompressOptions{})
+			if err != nil || !bytes.Equal(decompressed, sample.Data) {
+				t.Errorf("%s/%d: round trip failed: %v", sample.Name, blockSize, err)
+			}
+		}
+	}
+	if _, err := CompressParallel([]byte("abc"), 0, 1); err == nil {
+		t.Error("Expected an error for block size 0")
+	}
+}
+
+func TestDecompressParallel_Invalid(t *testing.T) {
+	data := bytes.Repeat([]byte("hello, parallel huffman "), 100)
+	compressed, err := CompressParallel(data, 256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":      {},
+		"bad magic":  append([]byte("XXXX"), compressed[4:]...),
+		"truncated":  compressed[:len(compressed)-1],
+		"trailing":   append(bytes.Clone(compressed), 0),
+		"header":     compressed[:len(parallelMagic)+2],
+		"last block": append(bytes.Clone(compressed[:len(compressed)-1]), compressed[len(compressed)-1]^0xff),
+	}
+	for name, input := range tests {
+		if _, err := DecompressParallel(input, 2, common.DecompressOptions{}); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: expected ErrInvalidData, got %v", name, err)
+		}
+	}
+
+	_, err = DecompressParallel(compressed, 2, common.DecompressOptions{MaxOutputSize: int64(len(data) - 1)})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+// BenchmarkCompressParallel は50MBのテキストを1MBのブロックに分けて、ワーカー数ごとに圧縮します
+func BenchmarkCompressParallel(b *testing.B) {
+	line := []byte("2026-10-16 12:00:00 INFO request served path=/api/v1/items status=200 bytes=5123\n")
+	data := bytes.Repeat(line, 50<<20/len(line))
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				if _, err := CompressParallel(data, 1<<20, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecompressParallel(b *testing.B) {
+	line := []byte("2026-10-16 12:00:00 INFO request served path=/api/v1/items status=200 bytes=5123\n")
+	data := bytes.Repeat(line, 50<<20/len(line))
+	compressed, err := CompressParallel(data, 1<<20, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				if _, err := DecompressParallel(compressed, workers, common.DecompressOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// metricPayloads は内容がほとんど同じ約2KBのメトリクスのデータを n 個作ります
+func metricPayloads(n int, seed int64) [][]byte {
+	rng := rand.New(rand.NewSource(seed))
+	payloads := make([][]byte, n)
+	for i := range payloads {
+		var buf bytes.Buffer
+		for buf.Len() < 2000 {
+			fmt.Fprintf(&buf, "cpu.usage{host=web-%02d} %d.%02d\n", rng.Intn(20), rng.Intn(100), rng.Intn(100))
+		}
+		payloads[i] = buf.Bytes()
+	}
+	return payloads
+}
+
+// cachingKinds は圧縮データの種類（モデルを含むかどうか）と番号を返します
+func cachingKinds(t *testing.T, compressed [][]byte) (kinds []byte, seqs []uint64) {
+	t.Helper()
+	for _, c := range compressed {
+		seq, n := binary.Uvarint(c[1:])
+		if n <= 0 {
+			t.Fatalf("Invalid sequence number in %x", c[:8])
+		}
+		kinds = append(kinds, c[0])
+		seqs = append(seqs, seq)
+	}
+	return kinds, seqs
+}
+
+func TestCachingCompressor_RefreshBoundaries(t *testing.T) {
+	payloads := metricPayloads(7, 1)
+	enc := NewCachingCompressor(3)
+	var compressed [][]byte
+	for _, p := range payloads {
+		c, err := enc.Compress(p)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		compressed = append(compressed, c)
+	}
+
+	kinds, seqs := cachingKinds(t, compressed)
+	wantKinds := []byte{cachingFresh, cachingCached, cachingCached, cachingFresh, cachingCached, cachingCached, cachingFresh}
+	wantSeqs := []uint64{1, 1, 1, 2, 2, 2, 3}
+	if !slices.Equal(kinds, wantKinds) || !slices.Equal(seqs, wantSeqs) {
+		t.Errorf("Kinds %v, sequence numbers %v, want %v, %v", kinds, seqs, wantKinds, wantSeqs)
+	}
+	if enc.Refreshes() != 3 {
+		t.Errorf("Refreshes = %d, want 3", enc.Refreshes())
+	}
+	// モデルを含まないデータは頻度表の分だけ小さい
+	if len(compressed[1]) >= len(compressed[0]) {
+		t.Errorf("Cached payload %d bytes is not smaller than fresh payload %d bytes", len(compressed[1]), len(compressed[0]))
+	}
+
+	// 別のインスタンスでも、同じ順に展開すればモデルの切り替わりをまたいで展開できる
+	dec := NewCachingCompressor(3)
+	for i, c := range compressed {
+		got, err := dec.Decompress(c)
+		if err != nil || !bytes.Equal(got, payloads[i]) {
+			t.Fatalf("Payload %d: round trip failed (err %v)", i, err)
+		}
+	}
+}
+
+func TestCachingCompressor_Divergence(t *testing.T) {
+	enc := NewCachingCompressor(0)
+	text := metricPayloads(3, 2)
+	random := make([]byte, 2000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	var kinds []byte
+	for _, p := range [][]byte{text[0], text[1], random, random, text[2]} {
+		c, err := enc.Compress(p)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		kinds = append(kinds, c[0])
+	}
+	// 回数では作り直さず、傾向の違うデータに変わったときだけ作り直す
+	want := []byte{cachingFresh, cachingCached, cachingFresh, cachingCached, cachingFresh}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("Kinds = %v, want %v", kinds, want)
+	}
+
+	// 似たデータが続く間は作り直さない
+	enc = NewCachingCompressor(0)
+	for _, p := range metricPayloads(50, 6) {
+		if _, err := enc.Compress(p); err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+	}
+	if enc.Refreshes() != 1 {
+		t.Errorf("Refreshes for similar payloads = %d, want 1", enc.Refreshes())
+	}
+}
+
+func TestCachingCompressor_DecodeAcrossRefresh(t *testing.T) {
+	payloads := metricPayloads(4, 4)
+	enc := NewCachingCompressor(2)
+	var compressed [][]byte
+	for _, p := range payloads {
+		c, err := enc.Compress(p)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		compressed = append(compressed, c)
+	}
+
+	// モデルを含むデータを受け取っていない展開側は番号だけのデータを展開できない
+	dec := NewCachingCompressor(2)
+	if _, err := dec.Decompress(compressed[1]); !errors.Is(err, ErrModelNotReceived) {
+		t.Errorf("Decompress without model: err = %v, want ErrModelNotReceived", err)
+	}
+
+	// 壊れたモデルのデータは記録しない
+	broken := slices.Clone(compressed[0])
+	broken[4] ^= 0xff
+	if _, err := dec.Decompress(broken); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Decompress of broken model: err = %v, want ErrInvalidData", err)
+	}
+
+	for _, i := range []int{0, 1, 2} {
+		if got, err := dec.Decompress(compressed[i]); err != nil || !bytes.Equal(got, payloads[i]) {
+			t.Fatalf("Payload %d: round trip failed (err %v)", i, err)
+		}
+	}
+	// 作り直した後は、前のモデルを参照するデータを展開できない
+	if _, err := dec.Decompress(compressed[1]); !errors.Is(err, ErrModelNotReceived) {
+		t.Errorf("Decompress of previous model after refresh: err = %v, want ErrModelNotReceived", err)
+	}
+	if got, err := dec.Decompress(compressed[3]); err != nil || !bytes.Equal(got, payloads[3]) {
+		t.Errorf("Payload 3: round trip failed (err %v)", err)
+	}
+}
+
+func TestCachingCompressor_Empty(t *testing.T) {
+	c := NewCachingCompressor(0)
+	for _, data := range [][]byte{{}, {}, []byte("a"), {}} {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		if got, err := c.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Round trip of %q failed: %q, %v", data, got, err)
+		}
+	}
+}
+
+// BenchmarkCachingCompress は約2KBのほとんど同じデータを続けて圧縮します
+// refresh=1 は毎回モデルを作り直す場合で、キャッシュの効果は refresh=1000 との差です。
+func BenchmarkCachingCompress(b *testing.B) {
+	payloads := metricPayloads(64, 5)
+	run := func(b *testing.B, c common.Compressor) {
+		b.SetBytes(int64(len(payloads[0])))
+		i := 0
+		for b.Loop() {
+			if _, err := c.Compress(payloads[i%len(payloads)]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	}
+	b.Run("self-contained", func(b *testing.B) { run(b, NewCompressor()) })
+	b.Run("refresh=1", func(b *testing.B) { run(b, NewCachingCompressor(1)) })
+	b.Run("refresh=1000", func(b *testing.B) { run(b, NewCachingCompressor(1000)) })
+}
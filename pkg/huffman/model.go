@@ -0,0 +1,373 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// モデルの形式（MarshalBinary）
+//
+//	マジック "TZHM" + バージョン(1バイト) + シンボル数(uvarint)
+//	+ シンボルごとに (前のシンボルとの差(uvarint), 符号長(1バイト))
+//
+// シンボルは0〜255のバイトと escapeSymbol で、符号は16bitシンボル版と同じく
+// 符号長から正準ハフマン符号として再構築します。
+//
+// Model で圧縮したデータの形式
+//
+//	元のサイズ(uvarint) + 符号化データ
+//
+// モデルにないバイトは escapeSymbol の符号の後に8ビットでそのまま書き込みます。
+const (
+	modelMagic   = "TZHM"
+	modelVersion = 1
+
+	// escapeSymbol はモデルにないバイトが続くことを表すシンボルです
+	escapeSymbol = 256
+)
+
+// Model は学習用のサンプルから作った固定のHuffman符号です
+// 似た内容の小さなメッセージを多数圧縮する場合に、頻度表を別に1度だけ保存しておき、
+// 各メッセージには元のサイズと符号化データだけを格納します。
+//
+// サンプルに現れなかったバイトは、エスケープ（サンプルでの頻度を1とした特別な
+// シンボル）の符号に続けて8ビットでそのまま符号化します。そのためどんなデータも
+// 圧縮できますが、サンプルと傾向の違うデータではエスケープの分だけ大きくなります。
+//
+// 構築後は変更されないため、複数のゴルーチンから同時に使用できます。
+type Model struct {
+	lengths map[uint16]int           // シンボルごとの符号長
+	codes   map[uint16]canonicalCode // シンボルごとの符号
+	decoder symbolDecoder
+}
+
+// symbolDecoder はビット列から1つのシンボルを復号します
+// 符号長から作ったモデルは canonicalDecoder、Compressor の頻度表から作ったモデルは treeDecoder です。
+type symbolDecoder interface {
+	decode(r *bitio.Reader) (uint16, error)
+}
+
+// BuildModel は sample のバイトの出現頻度からモデルを作成します
+// sample が空の場合は、すべてのバイトをエスケープするモデルになります。
+func BuildModel(sample []byte) (*Model, error) {
+	// 大きなサンプルでも map を1バイトずつ更新しないよう、配列で数えてから頻度表にする
+	var counts [256]int
+	for _, b := range sample {
+		counts[b]++
+	}
+	freq := map[uint16]int{escapeSymbol: 1}
+	for b, n := range counts {
+		if n > 0 {
+			freq[uint16(b)] = n
+		}
+	}
+
+	lengths := codeLengths(buildTree(freq, nil))
+	for symbol, length := range lengths {
+		if length > maxCodeLength {
+			return nil, fmt.Errorf("Huffman code too long for symbol %d: %d bits", symbol, length)
+		}
+	}
+	return newModel(lengths)
+}
+
+// newModel は符号長の一覧からモデルを作成します
+func newModel(lengths map[uint16]int) (*Model, error) {
+	present := sortedSymbols(lengths)
+	codeLens := make([]int, len(present))
+	for i, symbol := range present {
+		codeLens[i] = lengths[symbol]
+	}
+	decoder, err := newCanonicalDecoder(present, codeLens)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Model{lengths: lengths, codes: make(map[uint16]canonicalCode, len(lengths)), decoder: decoder}
+	for _, c := range assignCanonicalCodes(lengths) {
+		m.codes[c.symbol] = c
+	}
+	return m, nil
+}
+
+// treeModel はHuffman木の符号（左が0、右が1）のモデルを作成します
+// Compressor の形式は正準符号ではなく木をたどった符号なので、復号も木をたどります。
+// エスケープは持たないため、頻度表にないバイトは符号化できません。
+func treeModel(root *Node) (*Model, error) {
+	m := &Model{lengths: codeLengths(root), codes: make(map[uint16]canonicalCode), decoder: treeDecoder{root: root}}
+	if root.IsLeaf() {
+		// 単一シンボルでも1ビット（0）を割り当てる
+		m.codes[root.Symbol] = canonicalCode{symbol: root.Symbol, length: 1}
+		return m, nil
+	}
+
+	var walk func(node *Node, code uint64, length int) error
+	walk = func(node *Node, code uint64, length int) error {
+		if node.IsLeaf() {
+			m.codes[node.Symbol] = canonicalCode{symbol: node.Symbol, length: length, code: code}
+			return nil
+		}
+		if length == maxCodeLength {
+			return fmt.Errorf("Huffman code too long: more than %d bits", maxCodeLength)
+		}
+		if err := walk(node.Left, code<<1, length+1); err != nil {
+			return err
+		}
+		return walk(node.Right, code<<1|1, length+1)
+	}
+	if err := walk(root, 0, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// treeDecoder はHuffman木をたどって1つのシンボルを復号します
+type treeDecoder struct {
+	root *Node
+}
+
+// decode は1つのシンボルを読み込みます（単一シンボルの木では値によらず1ビット）
+func (d treeDecoder) decode(r *bitio.Reader) (uint16, error) {
+	node := d.root
+	if node.IsLeaf() {
+		if _, err := r.ReadBit(); err != nil {
+			return 0, errTruncatedBits
+		}
+		return node.Symbol, nil
+	}
+	for !node.IsLeaf() {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, errTruncatedBits
+		}
+		if bit == 1 {
+			node = node.Right
+		} else {
+			node = node.Left
+		}
+	}
+	return node.Symbol, nil
+}
+
+// Name はアルゴリズム名を返します
+func (m *Model) Name() string {
+	return "Huffman Coding (shared model)"
+}
+
+// Symbols はモデルに含まれるバイトの種類数を返します（エスケープは含みません）
+func (m *Model) Symbols() int {
+	return len(m.lengths) - 1
+}
+
+// MarshalBinary はモデルをバイナリ形式に変換します（encoding.BinaryMarshaler）
+func (m *Model) MarshalBinary() ([]byte, error) {
+	present := sortedSymbols(m.lengths)
+	out := make([]byte, 0, len(modelMagic)+1+binary.MaxVarintLen64+3*len(present))
+	out = append(out, modelMagic...)
+	out = append(out, modelVersion)
+	out = binary.AppendUvarint(out, uint64(len(present)))
+	next := 0
+	for _, symbol := range present {
+		out = binary.AppendUvarint(out, uint64(int(symbol)-next))
+		out = append(out, byte(m.lengths[symbol]))
+		next = int(symbol) + 1
+	}
+	return out, nil
+}
+
+// UnmarshalBinary は MarshalBinary の出力からモデルを復元します（encoding.BinaryUnmarshaler）
+// エスケープの符号がない、符号長が符号として成立しないなどの不正なモデルはエラーにします。
+func (m *Model) UnmarshalBinary(data []byte) error {
+	headerSize := len(modelMagic) + 1
+	if len(data) < headerSize || string(data[:len(modelMagic)]) != modelMagic {
+		return common.NewDecodeError("Huffman model", data, 0, "invalid model header")
+	}
+	if v := data[len(modelMagic)]; v > modelVersion {
+		return &common.ErrUnsupportedVersion{Format: "Huffman model", Have: v, Max: modelVersion}
+	} else if v != modelVersion {
+		return common.NewDecodeError("Huffman model", data, len(modelMagic), "unsupported model version %d", v)
+	}
+
+	offset := headerSize
+	count, n := binary.Uvarint(data[offset:])
+	if n <= 0 || count == 0 || count > escapeSymbol+1 {
+		return common.NewDecodeError("Huffman model", data, offset, "invalid symbol count")
+	}
+	offset += n
+
+	lengths := make(map[uint16]int, count)
+	next := uint64(0)
+	for range count {
+		gap, n := binary.Uvarint(data[offset:])
+		if n <= 0 || offset+n >= len(data) {
+			return common.NewDecodeError("Huffman model", data, offset, "incomplete symbol table")
+		}
+		if gap > escapeSymbol-next {
+			return common.NewDecodeError("Huffman model", data, offset, "symbol out of range")
+		}
+		offset += n
+		symbol := uint16(next + gap)
+		next = next + gap + 1
+
+		length := int(data[offset])
+		if length == 0 || length > maxCodeLength {
+			return common.NewDecodeError("Huffman model", data, offset, "invalid code length %d", length)
+		}
+		lengths[symbol] = length
+		offset++
+	}
+	if offset != len(data) {
+		return common.NewDecodeError("Huffman model", data, offset, "%d trailing bytes after model", len(data)-offset)
+	}
+	if _, ok := lengths[escapeSymbol]; !ok {
+		return common.NewDecodeError("Huffman model", data, headerSize, "missing escape code")
+	}
+
+	model, err := newModel(lengths)
+	if err != nil {
+		return common.NewDecodeError("Huffman model", data, headerSize, "%v", err)
+	}
+	*m = *model
+	return nil
+}
+
+// Compress はモデルの符号で data を圧縮します
+// 出力には頻度表を含まないため、展開には同じモデルが必要です。
+func (m *Model) Compress(data []byte) ([]byte, error) {
+	bits, _, err := EncodeWithModel(m, data)
+	if err != nil {
+		return nil, err
+	}
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	return append(out, bits...), nil
+}
+
+// EncodeWithModel は m の符号で data を符号化し、符号化データとそのビット数を返します
+// 元のサイズ、モデル、余りのビット数などの枠組みは一切含みません。長さやモデルを
+// 通信の相手とあらかじめ決めてあるプロトコルで、メッセージごとのヘッダーを省くために
+// 使います。展開には DecodeWithModel に同じモデル、ビット数、元のサイズを渡します。
+// 最後のバイトの余りのビットは0です。
+func EncodeWithModel(m *Model, data []byte) (bits []byte, nbits int, err error) {
+	w := bitio.NewWriter()
+	if err := m.codeTable().encode(w, data); err != nil {
+		return nil, 0, err
+	}
+	return w.Bytes(), w.BitLen(), nil
+}
+
+// DecodeWithModel は EncodeWithModel の符号化データ bits の先頭 nbits ビットから outLen バイトを展開します
+// outLen バイトを復号した後に残ったビットは読みません。符号が nbits ビットの途中で
+// 切れている場合や、outLen が nbits より大きい（各バイトは1ビット以上）場合は、
+// bits の中の位置を持つ *common.DecodeError を返します。
+func DecodeWithModel(m *Model, bits []byte, nbits int, outLen int) ([]byte, error) {
+	if nbits < 0 || nbits > 8*len(bits) {
+		return nil, common.NewDecodeError("Huffman", bits, 0, "bit count %d out of range for %d bytes", nbits, len(bits))
+	}
+	if outLen < 0 || outLen > nbits {
+		return nil, common.NewDecodeError("Huffman", bits, 0, "data length %d exceeds bit stream", outLen)
+	}
+
+	result := make([]byte, outLen)
+	if start, err := m.decodeInto(bitio.NewReaderBits(bits, nbits), result); err != nil {
+		return nil, common.NewDecodeError("Huffman", bits, start/8, "%v", err)
+	}
+	return result, nil
+}
+
+// modelCodes はバイトごとの符号の表です（長さ0はモデルにないバイト）
+// 符号化のたびに map を引かないよう、符号化の前に Model.codeTable で作ります。
+type modelCodes struct {
+	codes  [256]canonicalCode
+	escape canonicalCode
+}
+
+// codeTable はモデルの符号をバイトで引ける表にします
+func (m *Model) codeTable() *modelCodes {
+	t := &modelCodes{escape: m.codes[escapeSymbol]}
+	for symbol, c := range m.codes {
+		if symbol < escapeSymbol {
+			t.codes[symbol] = c
+		}
+	}
+	return t
+}
+
+// encode は data の符号を w に書き込みます（モデルにないバイトはエスケープの後に8ビット）
+// エスケープのないモデル（treeModel）にないバイトはエラーにします。
+func (t *modelCodes) encode(w *bitio.Writer, data []byte) error {
+	for _, b := range data {
+		if c := t.codes[b]; c.length > 0 {
+			w.WriteBits(c.code, c.length)
+			continue
+		}
+		if t.escape.length == 0 {
+			return fmt.Errorf("byte %#02x is not in the Huffman model", b)
+		}
+		w.WriteBits(t.escape.code, t.escape.length)
+		w.WriteBits(uint64(b), 8)
+	}
+	return nil
+}
+
+// Decompress はモデルの符号で圧縮されたデータを展開します
+func (m *Model) Decompress(data []byte) ([]byte, error) {
+	return m.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+func (m *Model) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, common.NewDecodeError("Huffman", data, 0, "missing data length")
+	}
+
+	// 各バイトは1ビット以上なので、残りのビット数より多いバイト数はありえない
+	payload := data[n:]
+	if size > uint64(8*len(payload)) {
+		return nil, common.NewDecodeError("Huffman", data, 0, "data length %d exceeds bit stream", size)
+	}
+	if err := opts.ReserveOutput(int64(size), int64(size)); err != nil {
+		return nil, err
+	}
+
+	result, err := DecodeWithModel(m, payload, 8*len(payload), int(size))
+	if err != nil {
+		var decodeErr *common.DecodeError
+		if errors.As(err, &decodeErr) {
+			return nil, decodeErr.WithBase(int64(n))
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeInto は r から len(dst) バイト分の符号を読み、dst に展開します
+// エラーの場合は、読み込めなかった符号の先頭のビット位置も返します。
+func (m *Model) decodeInto(r *bitio.Reader, dst []byte) (int, error) {
+	for i := range dst {
+		start := r.Position()
+		symbol, err := m.decoder.decode(r)
+		if err == nil && symbol == escapeSymbol {
+			var b uint64
+			if b, err = r.ReadBits(8); err != nil {
+				err = errTruncatedBits
+			}
+			symbol = uint16(b)
+		}
+		if err != nil {
+			return start, err
+		}
+		dst[i] = byte(symbol)
+	}
+	return r.Position(), nil
+}
+
+// コンパイル時にインターフェースの実装を確認
+var (
+	_ common.Compressor          = (*Model)(nil)
+	_ common.OptionsDecompressor = (*Model)(nil)
+)
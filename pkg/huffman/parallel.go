@@ -0,0 +1,194 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// 並列圧縮の形式（CompressParallel）
+//
+//	マジック "TZHP" + 元のサイズ(uvarint) + ブロックサイズ(uvarint)
+//	+ モデルの長さ(uvarint) + モデル(Model.MarshalBinary)
+//	+ ブロックごとの符号化データのビット数(uvarint) × ブロック数
+//	+ ブロックごとの符号化データ（それぞれバイトの境界にそろえる）
+//
+// ブロック数は 元のサイズ / ブロックサイズ の切り上げで、最後のブロックだけが短くなります。
+// すべてのブロックは入力全体から作った1つのモデルで符号化するため、ブロックごとに
+// 頻度表を持つ場合より小さく、ビット数からブロックの位置が分かるため展開も並列にできます。
+const parallelMagic = "TZHP"
+
+// CompressParallel は data 全体の出現頻度から1つの符号を作り、blockSize バイトごとのブロックを
+// workers 個のゴルーチンで並列に符号化します
+// ブロックは元の順に連結するため、出力は workers によらず同じです。workers が0以下の場合は
+// runtime.GOMAXPROCS(0) を使います。展開には DecompressParallel を使います。
+func CompressParallel(data []byte, blockSize, workers int) ([]byte, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size: %d", blockSize)
+	}
+	model, err := BuildModel(data)
+	if err != nil {
+		return nil, err
+	}
+	header, err := model.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*bitio.Writer, (len(data)+blockSize-1)/blockSize)
+	codes := model.codeTable()
+	err = runParallel(len(blocks), workers, func(i int) error {
+		blocks[i] = bitio.NewWriter()
+		return codes.encode(blocks[i], data[i*blockSize:min((i+1)*blockSize, len(data))])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(nil), parallelMagic...)
+	out = binary.AppendUvarint(out, uint64(len(data)))
+	out = binary.AppendUvarint(out, uint64(blockSize))
+	out = binary.AppendUvarint(out, uint64(len(header)))
+	out = append(out, header...)
+	for _, w := range blocks {
+		out = binary.AppendUvarint(out, uint64(w.BitLen()))
+	}
+	for _, w := range blocks {
+		out = append(out, w.Bytes()...)
+	}
+	return out, nil
+}
+
+// DecompressParallel は CompressParallel で圧縮したデータを workers 個のゴルーチンで並列に展開します
+// workers が0以下の場合は runtime.GOMAXPROCS(0) を使います。出力サイズとメモリ予算は
+// ブロックの展開を始める前に確認します。
+func DecompressParallel(data []byte, workers int, opts common.DecompressOptions) ([]byte, error) {
+	p, err := parseParallel(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.ReserveOutput(int64(p.size), int64(p.size)); err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, p.size)
+	err = runParallel(len(p.bits), workers, func(i int) error {
+		start := i * p.blockSize
+		dst := result[start:min(start+p.blockSize, len(result))]
+		r := bitio.NewReaderBits(data[p.offsets[i]:], p.bits[i])
+		if bit, err := p.model.decodeInto(r, dst); err != nil {
+			return common.NewDecodeError("Huffman", data, p.offsets[i]+bit/8, "block %d: %v", i, err)
+		}
+		if r.Remaining() != 0 {
+			return common.NewDecodeError("Huffman", data, p.offsets[i], "block %d: %d unused bits", i, r.Remaining())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parallelData は並列圧縮の形式を解析した結果です
+type parallelData struct {
+	size      int
+	blockSize int
+	model     *Model
+	bits      []int // ブロックごとの符号化データのビット数
+	offsets   []int // ブロックごとの符号化データの data での位置
+}
+
+// parseParallel は並列圧縮の形式のヘッダーとブロックの一覧を解析します
+// ブロックの符号化データが data の終わりを超えないこと、余分なデータがないことも確認します。
+func parseParallel(data []byte) (*parallelData, error) {
+	if len(data) < len(parallelMagic) || string(data[:len(parallelMagic)]) != parallelMagic {
+		return nil, common.NewDecodeError("Huffman", data, 0, "invalid parallel header")
+	}
+	pos := len(parallelMagic)
+	uvarint := func(limit uint64) (int, bool) {
+		v, n := binary.Uvarint(data[pos:])
+		if n <= 0 || v > limit {
+			return 0, false
+		}
+		pos += n
+		return int(v), true
+	}
+
+	var p parallelData
+	var ok bool
+	if p.size, ok = uvarint(uint64(len(data)) * 8); !ok {
+		return nil, common.NewDecodeError("Huffman", data, pos, "invalid data length")
+	}
+	if p.blockSize, ok = uvarint(1 << 40); !ok || p.blockSize == 0 {
+		return nil, common.NewDecodeError("Huffman", data, pos, "invalid block size")
+	}
+	modelSize, ok := uvarint(uint64(len(data) - pos))
+	if !ok || modelSize > len(data)-pos {
+		return nil, common.NewDecodeError("Huffman", data, pos, "invalid model length")
+	}
+	p.model = new(Model)
+	if err := p.model.UnmarshalBinary(data[pos : pos+modelSize]); err != nil {
+		return nil, common.NewDecodeError("Huffman", data, pos, "%v", err)
+	}
+	pos += modelSize
+
+	// 各バイトは1ビット以上なので、ブロックのビット数は少なくともブロックのバイト数
+	count := (p.size + p.blockSize - 1) / p.blockSize
+	if count > len(data)-pos {
+		return nil, common.NewDecodeError("Huffman", data, pos, "block count %d exceeds data", count)
+	}
+	p.bits = make([]int, count)
+	for i := range p.bits {
+		if p.bits[i], ok = uvarint(uint64(len(data)) * 8); !ok {
+			return nil, common.NewDecodeError("Huffman", data, pos, "invalid bit length of block %d", i)
+		}
+	}
+	p.offsets = make([]int, count)
+	for i, bits := range p.bits {
+		p.offsets[i] = pos
+		if (bits+7)/8 > len(data)-pos {
+			return nil, common.NewDecodeError("Huffman", data, pos, "block %d is truncated", i)
+		}
+		pos += (bits + 7) / 8
+	}
+	if pos != len(data) {
+		return nil, common.NewDecodeError("Huffman", data, pos, "%d trailing bytes after blocks", len(data)-pos)
+	}
+	return &p, nil
+}
+
+// runParallel は fn(0) から fn(n-1) を workers 個のゴルーチンで実行し、最初のエラー（番号の小さい順）を返します
+func runParallel(n, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, max(n, 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Code generated by genprofiles; DO NOT EDIT.
+
+package huffman
+
+// profileModels は組み込みのプロファイルのモデル（Model.MarshalBinary の形式）です
+// testdata/profiles/<プロファイル名>.txt のサンプルから作成しています。
+var profileModels = map[Profile][]byte{
+	// 2877 bytes のサンプル、49 種類のバイト
+	"english": {
+		0x54, 0x5a, 0x48, 0x4d, 0x01, 0x32, 0x0a, 0x06, 0x15, 0x03, 0x00, 0x0b,
+		0x00, 0x07, 0x04, 0x0c, 0x04, 0x06, 0x01, 0x07, 0x01, 0x0c, 0x00, 0x0c,
+		0x08, 0x0a, 0x04, 0x0c, 0x01, 0x0c, 0x01, 0x0a, 0x01, 0x09, 0x01, 0x0c,
+		0x00, 0x0a, 0x00, 0x09, 0x05, 0x0b, 0x00, 0x0c, 0x02, 0x0a, 0x00, 0x08,
+		0x02, 0x09, 0x01, 0x0c, 0x07, 0x04, 0x00, 0x06, 0x00, 0x06, 0x00, 0x05,
+		0x00, 0x03, 0x00, 0x06, 0x00, 0x06, 0x00, 0x04, 0x00, 0x05, 0x00, 0x0b,
+		0x00, 0x07, 0x00, 0x05, 0x00, 0x06, 0x00, 0x04, 0x00, 0x04, 0x00, 0x07,
+		0x00, 0x09, 0x00, 0x04, 0x00, 0x04, 0x00, 0x04, 0x00, 0x06, 0x00, 0x07,
+		0x00, 0x06, 0x00, 0x08, 0x00, 0x06, 0x00, 0x0c, 0x85, 0x01, 0x0c,
+	},
+	// 2256 bytes のサンプル、20 種類のバイト
+	"hex": {
+		0x54, 0x5a, 0x48, 0x4d, 0x01, 0x15, 0x0a, 0x06, 0x15, 0x04, 0x0c, 0x05,
+		0x02, 0x04, 0x00, 0x04, 0x00, 0x05, 0x00, 0x04, 0x00, 0x04, 0x00, 0x04,
+		0x00, 0x04, 0x00, 0x04, 0x00, 0x05, 0x00, 0x04, 0x27, 0x05, 0x00, 0x04,
+		0x00, 0x04, 0x00, 0x04, 0x00, 0x05, 0x00, 0x04, 0x11, 0x07, 0x87, 0x01,
+		0x07,
+	},
+	// 2383 bytes のサンプル、69 種類のバイト
+	"json": {
+		0x54, 0x5a, 0x48, 0x4d, 0x01, 0x46, 0x0a, 0x06, 0x15, 0x03, 0x01, 0x03,
+		0x07, 0x0b, 0x01, 0x04, 0x00, 0x07, 0x00, 0x06, 0x00, 0x09, 0x00, 0x05,
+		0x00, 0x06, 0x00, 0x06, 0x00, 0x07, 0x00, 0x07, 0x00, 0x07, 0x00, 0x08,
+		0x00, 0x08, 0x00, 0x08, 0x00, 0x08, 0x00, 0x04, 0x02, 0x0b, 0x01, 0x0b,
+		0x00, 0x0a, 0x00, 0x0a, 0x00, 0x0a, 0x00, 0x0a, 0x00, 0x0a, 0x00, 0x0a,
+		0x00, 0x0a, 0x02, 0x0b, 0x02, 0x0b, 0x00, 0x0a, 0x00, 0x0b, 0x00, 0x0b,
+		0x00, 0x09, 0x02, 0x0b, 0x00, 0x08, 0x00, 0x0b, 0x04, 0x09, 0x00, 0x07,
+		0x01, 0x07, 0x01, 0x09, 0x01, 0x05, 0x00, 0x08, 0x00, 0x06, 0x00, 0x06,
+		0x00, 0x04, 0x00, 0x07, 0x00, 0x07, 0x00, 0x08, 0x00, 0x05, 0x00, 0x0a,
+		0x00, 0x08, 0x00, 0x06, 0x00, 0x06, 0x00, 0x06, 0x00, 0x05, 0x00, 0x06,
+		0x00, 0x09, 0x00, 0x05, 0x00, 0x05, 0x00, 0x05, 0x00, 0x06, 0x00, 0x07,
+		0x00, 0x08, 0x00, 0x09, 0x00, 0x07, 0x00, 0x09, 0x00, 0x06, 0x01, 0x06,
+		0x82, 0x01, 0x0b,
+	},
+}
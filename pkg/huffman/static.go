@@ -0,0 +1,125 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+//go:generate go run ../../internal/genprofiles -dir testdata/profiles -o profiles_gen.go
+
+// Profile は NewStaticCompressor の組み込みの符号表の名前です
+type Profile string
+
+// 組み込みのプロファイル
+const (
+	ProfileEnglish Profile = "english" // 英語の文章
+	ProfileJSON    Profile = "json"    // JSON
+	ProfileHex     Profile = "hex"     // 16進数の文字列（ハッシュ値、UUIDなど）
+)
+
+// profileIDs は圧縮データの先頭に書き込むプロファイルのIDです
+// 既存の圧縮データを展開できるよう、IDは変更せずに末尾にだけ追加してください。
+var profileIDs = map[Profile]byte{
+	ProfileEnglish: 1,
+	ProfileJSON:    2,
+	ProfileHex:     3,
+}
+
+// Profiles は組み込みのプロファイルの名前を名前順に返します
+func Profiles() []Profile {
+	names := make([]Profile, 0, len(profileIDs))
+	for p := range profileIDs {
+		names = append(names, p)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// StaticCompressor は組み込みのプロファイルの符号で圧縮します
+// deflate の固定ハフマン符号と同じく、頻度表を出力に含めないため、数十バイトの
+// テキストでも符号表の分だけ大きくなることがありません。
+//
+// 圧縮データの形式
+//
+//	プロファイルのID(1バイト) + 元のサイズ(uvarint) + 符号化データ
+//
+// 符号化データは Model と同じで、プロファイルのサンプルに現れなかったバイトは
+// エスケープの符号に続けて8ビットでそのまま書き込みます。
+// 構築後は変更されないため、複数のゴルーチンから同時に使用できます。
+type StaticCompressor struct {
+	profile Profile
+	id      byte
+	model   *Model
+}
+
+// NewStaticCompressor は profile の符号表で圧縮する StaticCompressor を作成します
+// 展開にも同じプロファイルが必要です（圧縮データのプロファイルは StaticProfile で確認できます）。
+func NewStaticCompressor(profile Profile) (*StaticCompressor, error) {
+	id, ok := profileIDs[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown Huffman profile: %q", profile)
+	}
+	model := new(Model)
+	if err := model.UnmarshalBinary(profileModels[profile]); err != nil {
+		return nil, fmt.Errorf("Huffman profile %q: %w", profile, err)
+	}
+	return &StaticCompressor{profile: profile, id: id, model: model}, nil
+}
+
+// StaticProfile は StaticCompressor で圧縮したデータの先頭のIDからプロファイルを返します
+func StaticProfile(data []byte) (Profile, error) {
+	if len(data) == 0 {
+		return "", common.NewDecodeError("Huffman", data, 0, "missing profile ID")
+	}
+	for p, id := range profileIDs {
+		if id == data[0] {
+			return p, nil
+		}
+	}
+	return "", common.NewDecodeError("Huffman", data, 0, "unknown profile ID %d", data[0])
+}
+
+// Profile はプロファイルの名前を返します
+func (s *StaticCompressor) Profile() Profile {
+	return s.profile
+}
+
+// Name はアルゴリズム名を返します
+func (s *StaticCompressor) Name() string {
+	return fmt.Sprintf("Huffman Coding (static %s)", s.profile)
+}
+
+// Compress はプロファイルの符号で data を圧縮します
+func (s *StaticCompressor) Compress(data []byte) ([]byte, error) {
+	out, err := s.model.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{s.id}, out...), nil
+}
+
+// Decompress はプロファイルの符号で圧縮されたデータを展開します
+func (s *StaticCompressor) Decompress(data []byte) ([]byte, error) {
+	return s.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 先頭のIDが別のプロファイルの場合はエラーにします。
+func (s *StaticCompressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	profile, err := StaticProfile(data)
+	if err != nil {
+		return nil, err
+	}
+	if profile != s.profile {
+		return nil, common.NewDecodeError("Huffman", data, 0, "data was compressed with profile %q, not %q", profile, s.profile)
+	}
+	return s.model.DecompressWithOptions(data[1:], opts)
+}
+
+// コンパイル時にインターフェースの実装を確認
+var (
+	_ common.Compressor          = (*StaticCompressor)(nil)
+	_ common.OptionsDecompressor = (*StaticCompressor)(nil)
+)
@@ -0,0 +1,64 @@
+package huffman
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// CodeStats はバイトごとの出現回数と、割り当てられるHuffman符号の長さです
+// グラフにするための生のデータで、配列の添字がバイトの値です。
+type CodeStats struct {
+	DataSize    int      `json:"data_size"`    // 元のデータサイズ
+	Frequencies [256]int `json:"frequencies"`  // バイトごとの出現回数
+	CodeLengths [256]int `json:"code_lengths"` // バイトごとの符号のビット数（出現しないバイトは0）
+	EncodedBits int      `json:"encoded_bits"` // 符号化したデータのビット数（符号表を除く）
+
+	// EntropyBits は0次のエントロピーによる下限のビット数です
+	// バイトを独立に符号化する符号で到達できる最小のビット数で、Huffman符号は1シンボルあたり
+	// 1ビット未満にはならないため、EncodedBits はこれ以上（差は1シンボルあたり1ビット未満）になります。
+	EntropyBits float64 `json:"entropy_bits"`
+}
+
+// AnalyzeCodes は data の8ビット単位のHuffman符号の統計を返します
+// 符号は CodeTable と同じです。
+func AnalyzeCodes(data []byte) CodeStats {
+	stats := CodeStats{DataSize: len(data)}
+	for _, b := range data {
+		stats.Frequencies[b]++
+	}
+	for b, code := range CodeTable(data) {
+		stats.CodeLengths[b] = len(code)
+		stats.EncodedBits += stats.Frequencies[b] * len(code)
+	}
+	stats.EntropyBits = common.EntropyBits(stats.Frequencies[:])
+	return stats
+}
+
+// Floor は data を符号化したデータの0次のエントロピーによる下限（bytes）を返します（common.FloorEstimator）
+// 16bitシンボルでは2バイトのシンボルの出現頻度から求め、奇数の長さの最後の1バイトは8ビットとします。
+// 符号表は含みません。
+func (h *Compressor) Floor(data []byte) float64 {
+	if h.width == 2 {
+		freq := buildFrequencyTable(wideSymbols(data))
+		counts := make([]int, 0, len(freq))
+		for _, c := range freq {
+			counts = append(counts, c)
+		}
+		return (common.EntropyBits(counts) + float64(8*(len(data)%2))) / 8
+	}
+	return AnalyzeCodes(data).EntropyBits / 8
+}
+
+// WriteCSV は統計を "symbol,frequency,code_length" の列の256行のCSVとして w に書き込みます
+func (s CodeStats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"symbol", "frequency", "code_length"})
+	for b := range s.Frequencies {
+		cw.Write([]string{strconv.Itoa(b), strconv.Itoa(s.Frequencies[b]), strconv.Itoa(s.CodeLengths[b])})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,62 @@
+package huffman
+
+import (
+	"slices"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// MergeEvent は圧縮でHuffman木を構築するときに、頻度の最も小さい2つのノードを
+// ヒープから取り出して結合したイベントです（common.Tracer に通知します）
+// n 種類のシンボルでは n-1 回の結合で木が完成します。1種類だけの場合は結合しません。
+type MergeEvent struct {
+	Left      MergeNode `json:"left"`      // 取り出した1つ目のノード（符号0の側）
+	Right     MergeNode `json:"right"`     // 取り出した2つ目のノード（符号1の側）
+	Freq      int       `json:"freq"`      // 結合したノードの頻度
+	Remaining int       `json:"remaining"` // 結合したノードを戻した後のヒープのノード数
+}
+
+// MergeNode は結合したノードの部分木です
+type MergeNode struct {
+	Symbols []uint16 `json:"symbols"` // 部分木に含まれるシンボル（昇順）
+	Freq    int      `json:"freq"`    // 頻度
+}
+
+// WithTracer はHuffman木の結合ごとに t に MergeEvent を通知する Compressor を返します（common.Traced）
+func (h *Compressor) WithTracer(t common.Tracer) common.Compressor {
+	c := *h
+	c.tracer = t
+	return &c
+}
+
+// traceMerge は merged を作った結合を通知します
+func traceMerge(tracer common.Tracer, merged *Node, remaining int) {
+	tracer.OnStep(MergeEvent{
+		Left:      mergeNode(merged.Left),
+		Right:     mergeNode(merged.Right),
+		Freq:      merged.Freq,
+		Remaining: remaining,
+	})
+}
+
+// mergeNode は部分木のシンボルを集めます
+func mergeNode(n *Node) MergeNode {
+	var symbols []uint16
+	var walk func(*Node)
+	walk = func(n *Node) {
+		if n.IsLeaf() {
+			symbols = append(symbols, n.Symbol)
+			return
+		}
+		walk(n.Left)
+		walk(n.Right)
+	}
+	walk(n)
+	slices.Sort(symbols)
+	return MergeNode{Symbols: symbols, Freq: n.Freq}
+}
+
+var (
+	_ common.Traced = (*Compressor)(nil)
+	_ common.Timed  = (*Compressor)(nil)
+)
@@ -0,0 +1,342 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// 16bitシンボル版のフォーマット
+//
+//	フラグ(1バイト) [末尾の奇数バイト] + シンボル数(uvarint) + 出現シンボル数(uvarint)
+//	+ 出現シンボルごとに (前のシンボルとの差-1(uvarint), 符号長(1バイト)) + 符号化データ
+//
+// 65536種類すべての頻度を保存すると大きくなるため、出現したシンボルと
+// 符号長だけを保存し、符号は符号長から正準ハフマン符号として再構築します。
+const (
+	// flagOddByte は入力が奇数バイトで、末尾の1バイトをそのまま保存していることを示します
+	flagOddByte = 0x01
+
+	// maxCodeLength は符号長の上限です
+	// 符号長が48ビットを超えるHuffman木には、フィボナッチ数 F(50)（約120億）以上のシンボルが必要です。
+	// 復号で符号を int64 で扱うため、上限を設けて桁あふれしないようにします。
+	maxCodeLength = 48
+)
+
+var (
+	errOverSubscribed = errors.New("over-subscribed code lengths")
+	errIncomplete     = errors.New("incomplete code lengths")
+	errTruncatedBits  = errors.New("truncated bit stream")
+	errUnknownCode    = errors.New("unknown code")
+)
+
+// canonicalCode は正準ハフマン符号の1エントリです
+type canonicalCode struct {
+	symbol uint16
+	length int
+	code   uint64
+}
+
+// codeLengths はHuffman木から各シンボルの符号長を求めます
+func codeLengths(root *Node) map[uint16]int {
+	lengths := make(map[uint16]int)
+	if root.IsLeaf() {
+		// 単一シンボルでも1ビットを割り当てる
+		lengths[root.Symbol] = 1
+		return lengths
+	}
+
+	var walk func(*Node, int)
+	walk = func(node *Node, depth int) {
+		if node.IsLeaf() {
+			lengths[node.Symbol] = depth
+			return
+		}
+		walk(node.Left, depth+1)
+		walk(node.Right, depth+1)
+	}
+	walk(root, 0)
+	return lengths
+}
+
+// assignCanonicalCodes は符号長の短い順、同じ長さではシンボルの小さい順に符号を割り当てます
+func assignCanonicalCodes(lengths map[uint16]int) []canonicalCode {
+	codes := make([]canonicalCode, 0, len(lengths))
+	for symbol, length := range lengths {
+		codes = append(codes, canonicalCode{symbol: symbol, length: length})
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].length != codes[j].length {
+			return codes[i].length < codes[j].length
+		}
+		return codes[i].symbol < codes[j].symbol
+	})
+
+	code := uint64(0)
+	prevLength := 0
+	for i := range codes {
+		code <<= uint(codes[i].length - prevLength)
+		codes[i].code = code
+		prevLength = codes[i].length
+		code++
+	}
+	return codes
+}
+
+// wideSymbols は入力をリトルエンディアンのuint16列に変換します（奇数バイト目は含みません）
+func wideSymbols(data []byte) []uint16 {
+	symbols := make([]uint16, len(data)/2)
+	for i := range symbols {
+		symbols[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return symbols
+}
+
+// wideOverhead は compressWide のヘッダーのバイト数の下限を返します
+// 符号長の表は出現したシンボルごとに少なくとも2バイト（差分と符号長）です。
+func wideOverhead(data []byte) int {
+	size := 1 + len(data)%2
+	symbols := wideSymbols(data)
+	size += len(binary.AppendUvarint(nil, uint64(len(symbols))))
+	if len(symbols) == 0 {
+		return size + 1
+	}
+	present := make(map[uint16]struct{})
+	for _, s := range symbols {
+		present[s] = struct{}{}
+	}
+	return size + len(binary.AppendUvarint(nil, uint64(len(present)))) + 2*len(present)
+}
+
+// compressWide は入力を16bitシンボルとして圧縮します（tracer は buildTree に渡します）
+// timings が nil でなければ、フェーズごとの処理時間を記録します。
+// costMap が nil でなければ、シンボルごとに符号のビット数を通知します。
+func compressWide(data []byte, tracer common.Tracer, timings *common.Timings, costMap common.CostMap) ([]byte, error) {
+	start := timings.Start()
+	symbols := wideSymbols(data)
+
+	var compressed []byte
+	if len(data)%2 != 0 {
+		compressed = append(compressed, flagOddByte, data[len(data)-1])
+		if costMap != nil {
+			costMap(len(data)-1, 1, 8)
+		}
+	} else {
+		compressed = append(compressed, 0)
+	}
+	compressed = binary.AppendUvarint(compressed, uint64(len(symbols)))
+
+	if len(symbols) == 0 {
+		return binary.AppendUvarint(compressed, 0), nil
+	}
+
+	freq := buildFrequencyTable(symbols)
+	start = timings.Since(PhaseCount, start)
+	root := buildTree(freq, tracer)
+	if root == nil {
+		return nil, fmt.Errorf("failed to build Huffman tree")
+	}
+	lengths := codeLengths(root)
+	start = timings.Since(PhaseTree, start)
+
+	// ヘッダー: 出現したシンボルを昇順に、差分と符号長で保存
+	present := make([]uint16, 0, len(lengths))
+	for symbol := range lengths {
+		present = append(present, symbol)
+	}
+	sort.Slice(present, func(i, j int) bool { return present[i] < present[j] })
+
+	compressed = binary.AppendUvarint(compressed, uint64(len(present)))
+	next := 0
+	for _, symbol := range present {
+		if lengths[symbol] > maxCodeLength {
+			return nil, fmt.Errorf("Huffman code too long: %d bits", lengths[symbol])
+		}
+		compressed = binary.AppendUvarint(compressed, uint64(int(symbol)-next))
+		compressed = append(compressed, byte(lengths[symbol]))
+		next = int(symbol) + 1
+	}
+
+	// データを符号化
+	table := make(map[uint16]canonicalCode, len(present))
+	for _, c := range assignCanonicalCodes(lengths) {
+		table[c.symbol] = c
+	}
+	w := bitio.NewWriter()
+	for i, s := range symbols {
+		c := table[s]
+		if costMap != nil {
+			costMap(2*i, 2, float64(c.length))
+		}
+		w.WriteBits(c.code, c.length)
+	}
+
+	compressed = append(compressed, w.Bytes()...)
+	timings.Since(PhaseEncode, start)
+	return compressed, nil
+}
+
+// canonicalDecoder は符号長ごとのシンボル数から正準ハフマン符号を復号します
+type canonicalDecoder struct {
+	counts  [maxCodeLength + 1]int64 // 符号長ごとのシンボル数
+	symbols []uint16                 // 符号長の短い順、同じ長さではシンボルの小さい順
+}
+
+// newCanonicalDecoder は符号長の一覧から復号器を作成します
+// 符号長の組み合わせが符号として成立しない（過剰に割り当てられている）場合や、使われない符号が
+// 残る場合はエラーを返します。Huffman木の符号は常に完全なため、例外は1ビットの符号を割り当てる
+// シンボルが1つだけの場合です。
+func newCanonicalDecoder(present []uint16, lengths []int) (*canonicalDecoder, error) {
+	d := &canonicalDecoder{symbols: make([]uint16, len(present))}
+	for _, length := range lengths {
+		d.counts[length]++
+	}
+
+	// 各符号長で残っている符号の数が負にならず、最後に0になることを確認
+	// （maxCodeLength までなので left は 1<<maxCodeLength を超えません）
+	left := int64(1)
+	for length := 1; length <= maxCodeLength; length++ {
+		left = left*2 - d.counts[length]
+		if left < 0 {
+			return nil, errOverSubscribed
+		}
+	}
+	single := len(present) == 1 && lengths[0] == 1
+	if left != 0 && len(present) > 0 && !single {
+		return nil, errIncomplete
+	}
+
+	// 符号長ごとの開始位置に、シンボルの昇順で並べる
+	var offsets [maxCodeLength + 2]int64
+	for length := 1; length <= maxCodeLength; length++ {
+		offsets[length+1] = offsets[length] + d.counts[length]
+	}
+	for i, symbol := range present {
+		d.symbols[offsets[lengths[i]]] = symbol
+		offsets[lengths[i]]++
+	}
+	return d, nil
+}
+
+// decode は1つのシンボルを読み込みます
+func (d *canonicalDecoder) decode(r *bitio.Reader) (uint16, error) {
+	var code, first, index int64
+	for length := 1; length <= maxCodeLength; length++ {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, errTruncatedBits
+		}
+		code |= int64(bit)
+
+		count := d.counts[length]
+		if code-first < count {
+			if i := index + code - first; i < int64(len(d.symbols)) {
+				return d.symbols[i], nil
+			}
+			return 0, errUnknownCode
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errUnknownCode
+}
+
+// decompressWide は16bitシンボルとして圧縮されたデータを展開します
+func decompressWide(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	flags := data[0]
+	offset := 1
+	if flags&^flagOddByte != 0 {
+		return nil, common.NewDecodeError("Huffman", data, 0, "unknown flags %#x", flags)
+	}
+
+	oddBytes := 0
+	if flags&flagOddByte != 0 {
+		if offset >= len(data) {
+			return nil, common.NewDecodeError("Huffman", data, offset, "missing trailing byte")
+		}
+		oddBytes = 1
+		offset++
+	}
+
+	symbolCount, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return nil, common.NewDecodeError("Huffman", data, offset, "missing symbol count")
+	}
+	offset += n
+
+	presentCount, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return nil, common.NewDecodeError("Huffman", data, offset, "missing symbol table size")
+	}
+	if presentCount > 1<<16 || (presentCount == 0) != (symbolCount == 0) {
+		return nil, common.NewDecodeError("Huffman", data, offset, "invalid symbol table size %d", presentCount)
+	}
+	offset += n
+
+	// シンボル表（シンボルと符号長、並べ替えた復号表）
+	tableBytes := int64(presentCount) * 12
+	if err := opts.Budget.Reserve(tableBytes); err != nil {
+		return nil, err
+	}
+	defer opts.Budget.Release(tableBytes)
+
+	tableStart := offset
+	present := make([]uint16, presentCount)
+	lengths := make([]int, presentCount)
+	next := uint64(0)
+	for i := range present {
+		gap, n := binary.Uvarint(data[offset:])
+		if n <= 0 || offset+n >= len(data) {
+			return nil, common.NewDecodeError("Huffman", data, offset, "incomplete symbol table")
+		}
+		if gap > 0xFFFF-next {
+			return nil, common.NewDecodeError("Huffman", data, offset, "symbol out of range")
+		}
+		offset += n
+		present[i] = uint16(next + gap)
+		next = next + gap + 1
+
+		lengths[i] = int(data[offset])
+		if lengths[i] == 0 || lengths[i] > maxCodeLength {
+			return nil, common.NewDecodeError("Huffman", data, offset, "invalid code length %d", lengths[i])
+		}
+		offset++
+	}
+
+	decoder, err := newCanonicalDecoder(present, lengths)
+	if err != nil {
+		return nil, common.NewDecodeError("Huffman", data, tableStart, "%v", err)
+	}
+
+	// 各シンボルは1ビット以上なので、残りのビット数より多いシンボル数はありえない
+	r := bitio.NewReader(data[offset:])
+	if symbolCount > uint64(r.Remaining()) {
+		return nil, common.NewDecodeError("Huffman", data, offset, "symbol count %d exceeds bit stream", symbolCount)
+	}
+
+	outputSize := int64(symbolCount)*2 + int64(oddBytes)
+	if err := opts.ReserveOutput(outputSize, outputSize); err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, outputSize)
+
+	for i := uint64(0); i < symbolCount; i++ {
+		start := r.Position()
+		symbol, err := decoder.decode(r)
+		if err != nil {
+			// 符号の先頭ビットを含むバイトの位置を報告する
+			return nil, common.NewDecodeError("Huffman", data, offset+start/8, "%v", err)
+		}
+		result = binary.LittleEndian.AppendUint16(result, symbol)
+	}
+
+	if oddBytes == 1 {
+		result = append(result, data[1])
+	}
+	return result, nil
+}
@@ -0,0 +1,195 @@
+// Package intcode implements universal variable-length integer codes.
+// Elias gamma / Elias delta / unary 符号は、小さい値ほど短いビット列になる
+// 可変長の整数符号で、ラン長や距離のように小さい値が多い整数列の表現に使います。
+//
+// 0の扱い: Elias符号は本来1以上の整数しか表せないため、このパッケージの
+// Gamma と Delta は値 v を v+1 として符号化します（0も符号化できます）。
+// そのため math.MaxUint64 だけは符号化できません。Unary は v 個の1と終端の0で
+// 表すので、シフトはありません。
+package intcode
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+)
+
+// MaxUnary は Unary で符号化できる最大値です（出力が巨大になるのを防ぎます）
+const MaxUnary = 1 << 16
+
+// Code は整数の可変長符号です
+type Code interface {
+	// Write は v を符号化して w に書き込みます
+	Write(w *bitio.Writer, v uint64) error
+
+	// Read は r から1つの値を読み込みます
+	Read(r *bitio.Reader) (uint64, error)
+
+	// BitLen は v を符号化したときのビット数を返します
+	BitLen(v uint64) int
+
+	// Name は符号の名前を返します
+	Name() string
+}
+
+var (
+	// Unary は unary 符号です: v → 1をv個 + 0
+	Unary Code = unaryCode{}
+
+	// Gamma は Elias gamma 符号です: x=v+1 のビット長-1 個の0 + x の2進表現
+	Gamma Code = gammaCode{}
+
+	// Delta は Elias delta 符号です: x=v+1 のビット長を gamma で + x の先頭ビットを除いた2進表現
+	Delta Code = deltaCode{}
+)
+
+// EncodeSlice は値の列を符号化してバイト列として返します
+// 最後のバイトの余りビットは0で埋められます（値の個数は呼び出し側で管理します）
+func EncodeSlice(c Code, values []uint64) ([]byte, error) {
+	w := bitio.NewWriter()
+	for i, v := range values {
+		if err := c.Write(w, v); err != nil {
+			return nil, fmt.Errorf("intcode: value %d: %w", i, err)
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// DecodeSlice は EncodeSlice で符号化された n 個の値を読み込みます
+func DecodeSlice(c Code, data []byte, n int) ([]uint64, error) {
+	r := bitio.NewReader(data)
+	values := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := c.Read(r)
+		if err != nil {
+			return nil, fmt.Errorf("intcode: value %d: %w", i, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+type unaryCode struct{}
+
+func (unaryCode) Name() string { return "unary" }
+
+func (unaryCode) BitLen(v uint64) int { return int(v) + 1 }
+
+func (unaryCode) Write(w *bitio.Writer, v uint64) error {
+	if v > MaxUnary {
+		return fmt.Errorf("unary: value %d exceeds maximum %d", v, MaxUnary)
+	}
+	for i := uint64(0); i < v; i++ {
+		w.WriteBit(1)
+	}
+	w.WriteBit(0)
+	return nil
+}
+
+func (unaryCode) Read(r *bitio.Reader) (uint64, error) {
+	var v uint64
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			return v, nil
+		}
+		v++
+		if v > MaxUnary {
+			return 0, fmt.Errorf("unary: value exceeds maximum %d", MaxUnary)
+		}
+	}
+}
+
+type gammaCode struct{}
+
+func (gammaCode) Name() string { return "gamma" }
+
+func (gammaCode) BitLen(v uint64) int {
+	n := bits.Len64(v + 1)
+	return 2*n - 1
+}
+
+func (gammaCode) Write(w *bitio.Writer, v uint64) error {
+	if v == math.MaxUint64 {
+		return fmt.Errorf("gamma: value %d cannot be encoded", v)
+	}
+	x := v + 1
+	n := bits.Len64(x)
+	w.WriteBits(0, n-1)
+	w.WriteBits(x, n)
+	return nil
+}
+
+func (gammaCode) Read(r *bitio.Reader) (uint64, error) {
+	x, err := readGamma(r)
+	if err != nil {
+		return 0, err
+	}
+	return x - 1, nil
+}
+
+// readGamma はシフトなしのgamma符号（1以上の値）を読み込みます
+func readGamma(r *bitio.Reader) (uint64, error) {
+	zeros := 0
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		zeros++
+		if zeros > 63 {
+			return 0, fmt.Errorf("gamma: prefix too long")
+		}
+	}
+
+	rest, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return 1<<uint(zeros) | rest, nil
+}
+
+type deltaCode struct{}
+
+func (deltaCode) Name() string { return "delta" }
+
+func (deltaCode) BitLen(v uint64) int {
+	n := bits.Len64(v + 1)
+	return gammaCode{}.BitLen(uint64(n-1)) + n - 1
+}
+
+func (deltaCode) Write(w *bitio.Writer, v uint64) error {
+	if v == math.MaxUint64 {
+		return fmt.Errorf("delta: value %d cannot be encoded", v)
+	}
+	x := v + 1
+	n := bits.Len64(x)
+	// ビット長 n (1以上) をそのままgamma符号で書く
+	w.WriteBits(0, bits.Len64(uint64(n))-1)
+	w.WriteBits(uint64(n), bits.Len64(uint64(n)))
+	w.WriteBits(x, n-1)
+	return nil
+}
+
+func (deltaCode) Read(r *bitio.Reader) (uint64, error) {
+	n, err := readGamma(r)
+	if err != nil {
+		return 0, err
+	}
+	if n > 64 {
+		return 0, fmt.Errorf("delta: bit length %d too large", n)
+	}
+	rest, err := r.ReadBits(int(n) - 1)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<(n-1) | rest) - 1, nil
+}
@@ -0,0 +1,172 @@
+package intcode
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+)
+
+var allCodes = []Code{Unary, Gamma, Delta}
+
+// encodeBits は1つの値の符号を "0"/"1" の文字列で返します
+func encodeBits(t *testing.T, c Code, v uint64) string {
+	t.Helper()
+	w := bitio.NewWriter()
+	if err := c.Write(w, v); err != nil {
+		t.Fatalf("%s: Write(%d) failed: %v", c.Name(), v, err)
+	}
+	r := bitio.NewReaderBits(w.Bytes(), w.BitLen())
+	s := ""
+	for r.Remaining() > 0 {
+		bit, _ := r.ReadBit()
+		s += string('0' + byte(bit))
+	}
+	return s
+}
+
+func TestCodes_KnownBitPatterns(t *testing.T) {
+	// Gamma/Delta は v+1 を符号化する（0 → 1 の符号）
+	tests := []struct {
+		code     Code
+		value    uint64
+		expected string
+	}{
+		{Unary, 0, "0"},
+		{Unary, 3, "1110"},
+		{Gamma, 0, "1"},
+		{Gamma, 1, "010"},
+		{Gamma, 2, "011"},
+		{Gamma, 3, "00100"},
+		{Gamma, 16, "000010001"},
+		{Delta, 0, "1"},
+		{Delta, 1, "0100"},
+		{Delta, 2, "0101"},
+		{Delta, 3, "01100"},
+		{Delta, 16, "001010001"},
+	}
+
+	for _, tt := range tests {
+		got := encodeBits(t, tt.code, tt.value)
+		if got != tt.expected {
+			t.Errorf("%s(%d): expected %s, got %s", tt.code.Name(), tt.value, tt.expected, got)
+		}
+		if len(got) != tt.code.BitLen(tt.value) {
+			t.Errorf("%s.BitLen(%d) = %d, actual %d", tt.code.Name(), tt.value, tt.code.BitLen(tt.value), len(got))
+		}
+	}
+}
+
+func TestCodes_ExhaustiveSmallValues(t *testing.T) {
+	for _, c := range allCodes {
+		values := make([]uint64, 0, 4096)
+		for v := uint64(0); v < 4096; v++ {
+			values = append(values, v)
+		}
+		if c == Unary {
+			values = values[:300]
+		}
+
+		data, err := EncodeSlice(c, values)
+		if err != nil {
+			t.Fatalf("%s: EncodeSlice failed: %v", c.Name(), err)
+		}
+		decoded, err := DecodeSlice(c, data, len(values))
+		if err != nil {
+			t.Fatalf("%s: DecodeSlice failed: %v", c.Name(), err)
+		}
+		for i := range values {
+			if decoded[i] != values[i] {
+				t.Fatalf("%s: value %d: expected %d, got %d", c.Name(), i, values[i], decoded[i])
+			}
+		}
+	}
+}
+
+func TestCodes_LargeValues(t *testing.T) {
+	values := []uint64{1 << 31, 1<<32 - 1, 1 << 40, 1<<62 - 1, 1 << 62, 1<<63 + 12345, math.MaxUint64 - 1}
+
+	for _, c := range []Code{Gamma, Delta} {
+		data, err := EncodeSlice(c, values)
+		if err != nil {
+			t.Fatalf("%s: EncodeSlice failed: %v", c.Name(), err)
+		}
+		decoded, err := DecodeSlice(c, data, len(values))
+		if err != nil {
+			t.Fatalf("%s: DecodeSlice failed: %v", c.Name(), err)
+		}
+		for i := range values {
+			if decoded[i] != values[i] {
+				t.Errorf("%s: expected %d, got %d", c.Name(), values[i], decoded[i])
+			}
+		}
+	}
+
+	// Delta は大きな値で Gamma より短い
+	if Delta.BitLen(1<<62) >= Gamma.BitLen(1<<62) {
+		t.Errorf("Expected delta (%d bits) to be shorter than gamma (%d bits) for 2^62",
+			Delta.BitLen(1<<62), Gamma.BitLen(1<<62))
+	}
+}
+
+func TestCodes_Limits(t *testing.T) {
+	for _, c := range []Code{Gamma, Delta} {
+		if err := c.Write(bitio.NewWriter(), math.MaxUint64); err == nil {
+			t.Errorf("%s: expected error for MaxUint64", c.Name())
+		}
+	}
+	if err := Unary.Write(bitio.NewWriter(), MaxUnary+1); err == nil {
+		t.Error("unary: expected error above MaxUnary")
+	}
+}
+
+func TestCodes_TruncatedInput(t *testing.T) {
+	for _, c := range allCodes {
+		data, err := EncodeSlice(c, []uint64{1000})
+		if err != nil {
+			t.Fatalf("%s: EncodeSlice failed: %v", c.Name(), err)
+		}
+		if _, err := DecodeSlice(c, data[:len(data)-1], 1); err == nil {
+			t.Errorf("%s: expected error for truncated input", c.Name())
+		}
+	}
+
+	// 64個を超える0の接頭辞は不正
+	if _, err := DecodeSlice(Gamma, make([]byte, 10), 1); err == nil {
+		t.Error("gamma: expected error for overlong prefix")
+	}
+}
+
+func FuzzCodes_RoundTrip(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6, 7})
+	f.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE, 1, 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		var values []uint64
+		for len(raw) >= 8 {
+			v := binary.LittleEndian.Uint64(raw)
+			raw = raw[8:]
+			if v == math.MaxUint64 {
+				continue
+			}
+			values = append(values, v)
+		}
+
+		for _, c := range []Code{Gamma, Delta} {
+			data, err := EncodeSlice(c, values)
+			if err != nil {
+				t.Fatalf("%s: EncodeSlice failed: %v", c.Name(), err)
+			}
+			decoded, err := DecodeSlice(c, data, len(values))
+			if err != nil {
+				t.Fatalf("%s: DecodeSlice failed: %v", c.Name(), err)
+			}
+			for i := range values {
+				if decoded[i] != values[i] {
+					t.Fatalf("%s: expected %d, got %d", c.Name(), values[i], decoded[i])
+				}
+			}
+		}
+	})
+}
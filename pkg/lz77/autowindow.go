@@ -0,0 +1,86 @@
+package lz77
+
+// 自動ウィンドウ（WithAutoWindow）の設定
+const (
+	autoStartWindow   = 512      // 最初のウィンドウのバイト数
+	autoProbeSize     = 16 << 10 // 最大のウィンドウも走査して、ウィンドウを広げるかを判断する入力の長さ
+	autoCheckInterval = 512      // ウィンドウを広げるかを判断する間隔（入力のバイト数）
+
+	// autoGrowDivisor は、検索のうちウィンドウの外により長い一致があった割合が
+	// 1/autoGrowDivisor 以上の場合にウィンドウを広げることを表します
+	autoGrowDivisor = 16
+)
+
+// WithAutoWindow は小さなウィンドウから始め、入力に合わせてウィンドウを広げるようにします
+// 入力の先頭 16KB では設定されたウィンドウ（最大）も走査し、今のウィンドウの外でより長い
+// 一致が見つかった割合が多ければ、その一致が届く大きさまでウィンドウを広げます。
+// 長い距離の繰り返しがあるデータでは大きなウィンドウとほぼ同じ圧縮率になり、そうでない
+// データでは残りの入力を小さなウィンドウで検索するため、圧縮が速くなります。
+//
+// 最後のウィンドウは圧縮データの先頭に記録し（形式バージョン3）、展開時にマッチの距離を
+// 確認します。2ストリーム形式（lz77h）には記録しません。WithOptimalMatcher と
+// 組み合わせた場合は、常に最大のウィンドウで検索します。
+func WithAutoWindow() Option {
+	return func(c *Compressor) {
+		c.encoder.autoWindow = true
+	}
+}
+
+// autoMatcher は WithAutoWindow のマッチャーです
+// 判断のための状態を持つため、エンコードの呼び出しごとに作成します。
+type autoMatcher struct {
+	m         *Matcher
+	window    int // 今のウィンドウのバイト数
+	probeEnd  int // この位置より前では最大のウィンドウも走査する
+	nextCheck int // 次にウィンドウを広げるかを判断する位置
+
+	searches int // 前回の判断からの検索の回数
+	rejected int // そのうち、ウィンドウの外により長い一致があった回数
+	farthest int // ウィンドウの外の一致の最大の距離
+}
+
+// newAutoMatcher は data[start:] をエンコードする autoMatcher を作成します
+func newAutoMatcher(m *Matcher, start int) *autoMatcher {
+	return &autoMatcher{
+		m:         m,
+		window:    min(autoStartWindow, m.windowSize),
+		probeEnd:  start + autoProbeSize,
+		nextCheck: start + autoCheckInterval,
+	}
+}
+
+// FindLongestMatch は今のウィンドウ内の最長一致を返します
+func (a *autoMatcher) FindLongestMatch(data []byte, pos int) MatchResult {
+	if pos >= a.probeEnd || a.window == a.m.windowSize {
+		best, _ := a.m.search(data, pos, a.window, a.window)
+		return best
+	}
+
+	if pos >= a.nextCheck {
+		a.adjust()
+		a.nextCheck = pos + autoCheckInterval
+	}
+	far, near := a.m.search(data, pos, a.m.windowSize, a.window)
+	a.searches++
+	if far.Length > near.Length {
+		a.rejected++
+		a.farthest = max(a.farthest, far.Distance)
+	}
+	return near
+}
+
+// lookahead は先読みの長さを返します
+func (a *autoMatcher) lookahead() int {
+	return a.m.bufferSize
+}
+
+// adjust はウィンドウの外の一致が多ければ、その一致が届く大きさ（2の累乗）までウィンドウを広げます
+func (a *autoMatcher) adjust() {
+	if a.searches > 0 && a.rejected*autoGrowDivisor >= a.searches {
+		for a.window < a.farthest {
+			a.window *= 2
+		}
+		a.window = min(a.window, a.m.windowSize)
+	}
+	a.searches, a.rejected, a.farthest = 0, 0, 0
+}
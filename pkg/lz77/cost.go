@@ -0,0 +1,36 @@
+package lz77
+
+// CostModel はトークンを圧縮データにしたときのバイト数を見積もります
+// エンコーダーはマッチが見つかるたびに、マッチトークン1つと、同じ範囲（マッチ長 + 次の文字）を
+// リテラルで出力した場合のコストを比べ、マッチの方が小さい場合だけマッチを出力します。
+type CostModel interface {
+	// MatchCost は距離 distance、長さ length のマッチトークン（次の文字を含む）のコストです
+	MatchCost(distance, length int) int
+	// LiteralCost はリテラル b のトークンのコストです
+	LiteralCost(b byte) int
+}
+
+// TokenCostModel はトークンのワイヤーフォーマットのサイズをコストとするモデルです（デフォルト）
+// マッチは距離によらず5バイト（長さ255以上は長さの拡張の分だけ大きい）、単独のリテラルは2バイトなので、最小マッチ長以上の
+// マッチは常にリテラルより小さくなります（リテラル列にまとめた場合のサイズは考慮しません）。
+type TokenCostModel struct{}
+
+// MatchCost はマッチトークンのバイト数を返します
+func (TokenCostModel) MatchCost(distance, length int) int {
+	return NewMatchToken(uint16(distance), uint32(length), 0).EncodedSize()
+}
+
+// LiteralCost はリテラルトークンのバイト数を返します
+func (TokenCostModel) LiteralCost(b byte) int {
+	return NewLiteralToken(b).EncodedSize()
+}
+
+// matchWins は data[pos:] を match で出力する方がリテラルより小さいかを返します
+// マッチトークンは次の文字も含むため、リテラルは match.Length+1 バイト分と比べます。
+func matchWins(m CostModel, data []byte, pos int, match MatchResult) bool {
+	literals := 0
+	for _, b := range data[pos : pos+match.Length+1] {
+		literals += m.LiteralCost(b)
+	}
+	return m.MatchCost(match.Distance, match.Length) < literals
+}
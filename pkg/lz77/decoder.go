@@ -1,8 +1,9 @@
 package lz77
 
 import (
-	"encoding/binary"
 	"fmt"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
 // Decoder はLZ77のデコード処理を担当します
@@ -14,75 +15,121 @@ func NewDecoder() *Decoder {
 }
 
 // Decode はバイナリデータをLZ77トークンの配列にパースします
+// リテラル列は個々のリテラルトークンになります
 func (d *Decoder) Decode(data []byte) ([]Token, error) {
-	if len(data) == 0 {
-		return []Token{}, nil
+	tokens := []Token{}
+	err := walkTokens(data, func(_ int, token Token, literals []byte) error {
+		if literals == nil {
+			tokens = append(tokens, token)
+			return nil
+		}
+		for _, b := range literals {
+			tokens = append(tokens, NewLiteralToken(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return tokens, nil
+}
 
-	var tokens []Token
-	pos := 0
-
-	for pos < len(data) {
-		if pos >= len(data) {
-			break
+// decodedSize は圧縮データを展開したときのバイト数を返します（形式の検証も行います）
+func decodedSize(data []byte) (int64, error) {
+	size := int64(0)
+	err := walkTokens(data, func(_ int, token Token, literals []byte) error {
+		switch {
+		case literals != nil:
+			size += int64(len(literals))
+		case token.IsLiteral():
+			size++
+		default:
+			size += int64(token.Length) + 1
 		}
+		return nil
+	})
+	return size, err
+}
 
-		flag := data[pos]
-		pos++
-
-		if flag == 0 {
-			// リテラル
-			if pos >= len(data) {
-				return nil, fmt.Errorf("invalid compressed data: missing literal")
+// decompress はトークン列を経由せずに、プリセット辞書を履歴として圧縮データを展開します
+// size は decodedSize の結果で、出力バッファの確保に使います。
+// エラーの位置は圧縮データの先頭からの位置で報告します。
+func (d *Decoder) decompress(dict, data []byte, size int64) ([]byte, error) {
+	result := make([]byte, 0, int64(len(dict))+size)
+	result = append(result, dict...)
+
+	err := walkTokens(data, func(pos int, token Token, literals []byte) error {
+		switch {
+		case literals != nil:
+			result = append(result, literals...)
+		case token.IsLiteral():
+			result = append(result, token.Literal)
+		default:
+			if int(token.Distance) > len(result) {
+				return common.NewDecodeError("LZ77", data, pos+1,
+					"invalid distance %d, history length %d", token.Distance, len(result))
 			}
-			tokens = append(tokens, NewLiteralToken(data[pos]))
-			pos++
-		} else {
-			// マッチ
-			if pos+4 > len(data) {
-				return nil, fmt.Errorf("invalid compressed data: incomplete match token")
+			if err := d.copyMatch(&result, int(token.Distance), int(token.Length)); err != nil {
+				return common.NewDecodeError("LZ77", data, pos, "%v", err)
 			}
-
-			distance := binary.BigEndian.Uint16(data[pos : pos+2])
-			pos += 2
-			length := data[pos]
-			pos++
-			literal := data[pos]
-			pos++
-
-			tokens = append(tokens, NewMatchToken(distance, length, literal))
+			result = append(result, token.Literal)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return tokens, nil
+	return result[len(dict):], nil
 }
 
 // TokensToData はトークン配列を元のデータに復元します
 func (d *Decoder) TokensToData(tokens []Token) ([]byte, error) {
-	var result []byte
+	return d.TokensToDataWithDict(nil, tokens)
+}
 
+// TokensToDataWithDict はプリセット辞書を履歴としてトークン配列を復元します
+// 戻り値には辞書の内容は含まれません。エラーの位置はトークン列を
+// ワイヤーフォーマットにしたときの位置で報告します。
+func (d *Decoder) TokensToDataWithDict(dict []byte, tokens []Token) ([]byte, error) {
+	result := make([]byte, 0, int64(len(dict))+outputSize(tokens))
+	result = append(result, dict...)
+
+	pos := int64(0)
 	for _, token := range tokens {
 		if token.IsLiteral() {
 			result = append(result, token.Literal)
 		} else {
-			// 距離チェック
+			// 距離チェック（距離フィールドはトークンの2バイト目から）
 			if int(token.Distance) > len(result) {
-				return nil, fmt.Errorf("invalid distance: %d, result length: %d", token.Distance, len(result))
+				return nil, common.NewDecodeError("LZ77", token.appendBinary(nil), 1,
+					"invalid distance %d, history length %d", token.Distance, len(result)).WithBase(pos)
 			}
 
 			// マッチした文字列をコピー
 			if err := d.copyMatch(&result, int(token.Distance), int(token.Length)); err != nil {
-				return nil, err
+				return nil, common.NewDecodeError("LZ77", token.appendBinary(nil), 0, "%v", err).WithBase(pos)
 			}
 
 			// 次のリテラル文字を追加
-			if token.Literal != 0 || len(result) < cap(result) {
-				result = append(result, token.Literal)
-			}
+			result = append(result, token.Literal)
 		}
+		pos += int64(token.EncodedSize())
 	}
 
-	return result, nil
+	return result[len(dict):], nil
+}
+
+// outputSize はトークン列を展開したときのバイト数を返します
+func outputSize(tokens []Token) int64 {
+	size := int64(0)
+	for _, token := range tokens {
+		if token.IsLiteral() {
+			size++
+		} else {
+			size += int64(token.Length) + 1
+		}
+	}
+	return size
 }
 
 // copyMatch はマッチした文字列を結果にコピーします
@@ -91,7 +138,7 @@ func (d *Decoder) copyMatch(result *[]byte, distance, length int) error {
 
 	for i := 0; i < length; i++ {
 		if start+i >= len(*result) {
-			return fmt.Errorf("invalid match: trying to copy from future position")
+			return fmt.Errorf("match copies from future position")
 		}
 		*result = append(*result, (*result)[start+i])
 	}
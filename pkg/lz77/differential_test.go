@@ -0,0 +1,185 @@
+package lz77
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// マッチャーの差分テスト
+//
+// すべてのマッチャーの設定で同じ入力を圧縮し、(1) 展開すると入力に戻ること、
+// (2) 圧縮後のサイズが設定の順位のとおりに並ぶこと、(3) MaxCompressedSize を
+// 超えないことを確認します。マッチャーを追加したら matcherConfigs に加えてください。
+//
+// 貪欲なパースでは、ある位置でより長いマッチを選んでも全体が小さくなるとは限らないため、
+// 順位の比較には設定ごとの許容量（tolerance）を認めます。
+
+// matcherConfig はマッチャーの設定の1つです
+type matcherConfig struct {
+	name string
+	// tier は期待する圧縮後のサイズの順位です（小さいほど小さくなる、負の場合は順位を比べない）
+	tier int
+	// tolerance は、より小さい順位の設定がこの設定より大きくなってもよい割合です
+	tolerance float64
+	new       func() *Compressor
+}
+
+var matcherConfigs = []matcherConfig{
+	// 接尾辞配列はウィンドウ内の本当の最長一致を見つけるため、総当たりと同じサイズになる
+	{name: "optimal", tier: 0, new: func() *Compressor { return NewCompressor(WithOptimalMatcher()) }},
+	{name: "greedy-brute-force", tier: 1, new: func() *Compressor { return NewCompressor() }},
+	// 自動ウィンドウは総当たりのウィンドウの一部だけを検索する
+	{name: "auto-window", tier: 2, tolerance: 0.02, new: func() *Compressor { return NewCompressor(WithAutoWindow()) }},
+	// 適応的な先読みは長い繰り返しで接尾辞配列（先読み18）より小さくなるため、順位は比べない
+	{name: "adaptive-lookahead", tier: -1, new: func() *Compressor { return NewCompressor(WithAdaptiveLookahead()) }},
+	{name: "adaptive-lookahead-auto-window", tier: -1, new: func() *Compressor {
+		return NewCompressor(WithAdaptiveLookahead(), WithAutoWindow())
+	}},
+}
+
+// matcherViolations は data をすべての設定で圧縮し、満たさなかった条件を返します
+func matcherViolations(data []byte) []string {
+	var violations []string
+	sizes := make([]int, len(matcherConfigs))
+	for i, cfg := range matcherConfigs {
+		c := cfg.new()
+		compressed, err := c.Compress(data)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s: Compress error: %v", cfg.name, err))
+			continue
+		}
+		sizes[i] = len(compressed)
+		if got, err := NewCompressor().Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+			violations = append(violations, fmt.Sprintf("%s: output does not decompress to the input (err %v)", cfg.name, err))
+		}
+		if bound := MaxCompressedSize(len(data)); len(compressed) > bound {
+			violations = append(violations, fmt.Sprintf("%s: %d bytes exceeds MaxCompressedSize %d", cfg.name, len(compressed), bound))
+		}
+	}
+
+	for i, better := range matcherConfigs {
+		for j, worse := range matcherConfigs {
+			if better.tier < 0 || better.tier >= worse.tier || sizes[i] == 0 || sizes[j] == 0 {
+				continue
+			}
+			if float64(sizes[i]) > float64(sizes[j])*(1+worse.tolerance) {
+				violations = append(violations, fmt.Sprintf("%s (%d bytes) is larger than %s (%d bytes) beyond %.0f%%",
+					better.name, sizes[i], worse.name, sizes[j], worse.tolerance*100))
+			}
+		}
+	}
+	return violations
+}
+
+// minimizeViolation は条件を満たさない data から、条件を満たさないまま取り除ける範囲を
+// 取り除いた入力を返します（attempts 回まで試します）
+func minimizeViolation(data []byte, attempts int) []byte {
+	for chunk := len(data) / 2; chunk >= 1 && attempts > 0; chunk /= 2 {
+		for start := 0; start+chunk <= len(data) && attempts > 0; attempts-- {
+			candidate := append(append([]byte{}, data[:start]...), data[start+chunk:]...)
+			if len(matcherViolations(candidate)) > 0 {
+				data = candidate
+			} else {
+				start += chunk
+			}
+		}
+	}
+	return data
+}
+
+// reportViolations は条件を満たさなかった入力と、再現のための最小化した入力を報告します
+func reportViolations(t *testing.T, label string, data []byte) {
+	t.Helper()
+	violations := matcherViolations(data)
+	if len(violations) == 0 {
+		return
+	}
+	for _, v := range violations {
+		t.Errorf("%s: %s", label, v)
+	}
+	small := minimizeViolation(data, 500)
+	if len(small) <= 256 {
+		t.Logf("%s: minimized reproduction (%d bytes), add to FuzzMatcherDifferential with f.Add([]byte(%q))", label, len(small), small)
+	} else {
+		t.Logf("%s: minimized reproduction is still %d bytes; rerun with the seed above", label, len(small))
+	}
+}
+
+// matcherProfiles は大きさとエントロピーの異なる入力の作り方です
+var matcherProfiles = []struct {
+	name     string
+	generate func(rng *rand.Rand, n int) []byte
+}{
+	{"random", func(rng *rand.Rand, n int) []byte {
+		data := make([]byte, n)
+		rng.Read(data)
+		return data
+	}},
+	{"low-entropy", func(rng *rand.Rand, n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = "acgt"[rng.Intn(4)]
+		}
+		return data
+	}},
+	{"text", func(rng *rand.Rand, n int) []byte {
+		words := []string{"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "compression", "window"}
+		var buf bytes.Buffer
+		for buf.Len() < n {
+			buf.WriteString(words[rng.Intn(len(words))])
+			buf.WriteByte(" .\n"[rng.Intn(3)])
+		}
+		return buf.Bytes()[:n]
+	}},
+	{"runs", func(rng *rand.Rand, n int) []byte {
+		var data []byte
+		for len(data) < n {
+			data = append(data, bytes.Repeat([]byte{byte(rng.Intn(256))}, rng.Intn(40)+1)...)
+		}
+		return data[:n]
+	}},
+	{"far-repeats", func(rng *rand.Rand, n int) []byte {
+		// ウィンドウの大きさに近い距離の繰り返しに、ところどころ変更を加える
+		block := make([]byte, 1500+rng.Intn(2000))
+		rng.Read(block)
+		var data []byte
+		for len(data) < n {
+			data = append(data, block...)
+			block[rng.Intn(len(block))] ^= byte(rng.Intn(255) + 1)
+		}
+		return data[:n]
+	}},
+}
+
+func TestMatcherDifferential(t *testing.T) {
+	sizes := []int{0, 1, 3, 17, 300, 5000, 30000}
+	if testing.Short() {
+		sizes = sizes[:len(sizes)-1]
+	}
+	for seed := int64(1); seed <= 3; seed++ {
+		for _, profile := range matcherProfiles {
+			for _, n := range sizes {
+				data := profile.generate(rand.New(rand.NewSource(seed)), n)
+				reportViolations(t, fmt.Sprintf("seed %d, %s, %d bytes", seed, profile.name, n), data)
+			}
+		}
+	}
+}
+
+func FuzzMatcherDifferential(f *testing.F) {
+	for _, profile := range matcherProfiles {
+		f.Add(profile.generate(rand.New(rand.NewSource(1)), 200))
+	}
+	f.Add([]byte{})
+	f.Add([]byte("abcabcabcabd"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// 総当たりのマッチャーは遅いため、大きな入力は調べない
+		if len(data) > 16<<10 {
+			t.Skip()
+		}
+		reportViolations(t, "fuzz input", data)
+	})
+}
@@ -2,78 +2,213 @@ package lz77
 
 import (
 	"encoding/binary"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
 // Encoder はLZ77のエンコード処理を担当します
 type Encoder struct {
-	matcher *Matcher
+	matcher           *Matcher
+	optimal           bool          // true の場合は接尾辞配列で本当の最長一致を検索する
+	autoWindow        bool          // true の場合は Compress でウィンドウを入力に合わせて広げる（WithAutoWindow）
+	adaptiveLookahead bool          // true の場合は打ち切られたマッチの割合で先読みを変える（WithAdaptiveLookahead）
+	cost              CostModel     // マッチとリテラルのどちらを出力するかの判断に使う
+	tracer            common.Tracer // nil でなければトークンを決めるごとに StepEvent を通知する
 }
 
 // NewEncoder は新しいEncoderを作成します
 func NewEncoder(windowSize, bufferSize int) *Encoder {
 	return &Encoder{
 		matcher: NewMatcher(windowSize, bufferSize),
+		cost:    TokenCostModel{},
 	}
 }
 
 // Encode はデータをLZ77トークンの配列にエンコードします
 func (e *Encoder) Encode(data []byte) []Token {
-	if len(data) == 0 {
+	return e.encodeFrom(data, 0, nil)
+}
+
+// EncodeWithDict はプリセット辞書の続きとしてデータをエンコードします
+// マッチは辞書の内容も参照できるため、短いデータでも最初からマッチが見つかります。
+// 展開には同じ辞書を Decoder.TokensToDataWithDict に渡す必要があります。
+func (e *Encoder) EncodeWithDict(dict, data []byte) []Token {
+	return e.encodeWithDict(dict, data, nil)
+}
+
+// encodeWithDict は EncodeWithDict と同じですが、counts が nil でなければ先読みの統計を数えます
+func (e *Encoder) encodeWithDict(dict, data []byte, counts *lookaheadCounts) []Token {
+	if len(dict) == 0 {
+		return e.encodeFrom(data, 0, counts)
+	}
+	buf := make([]byte, 0, len(dict)+len(data))
+	buf = append(buf, dict...)
+	buf = append(buf, data...)
+	return e.encodeFrom(buf, len(dict), counts)
+}
+
+// encodeFrom は data[start:] をエンコードします（data[:start] は参照専用の履歴）
+func (e *Encoder) encodeFrom(data []byte, start int, counts *lookaheadCounts) []Token {
+	if len(data) == start {
 		return []Token{}
 	}
+	tokens, _ := e.encodeWith(e.finder(data), data, start, len(data), counts)
+	return tokens
+}
+
+// encodeRange は data[start:] の先頭から、stop より前の位置で始まるトークンをエンコードし、
+// 次のトークンの位置を返します（data[:start] は参照専用の履歴）
+// 最後のトークンは stop 以降のバイトを含むことがあります。Writer は先読みが足りる
+// 位置までを stop にして、入力全体をエンコードしたときと同じトークンを得ます。
+func (e *Encoder) encodeRange(data []byte, start, stop int) ([]Token, int) {
+	return e.encodeWith(e.finder(data), data, start, stop, nil)
+}
+
+// finder は data をエンコードするマッチャーを返します（WithAutoWindow は encodeAuto で扱います）
+func (e *Encoder) finder(data []byte) matchFinder {
+	switch {
+	case e.optimal:
+		return newOptimalMatcher(data, e.matcher.windowSize, e.matcher.bufferSize)
+	case e.adaptiveLookahead:
+		return newLookaheadMatcher(e.matcher)
+	}
+	return e.matcher
+}
 
+// encodeAuto はプリセット辞書の続きとしてデータを自動ウィンドウでエンコードし、
+// トークン列と最後のウィンドウのバイト数を返します
+// WithOptimalMatcher の場合は最大のウィンドウで検索します。
+func (e *Encoder) encodeAuto(dict, data []byte) ([]Token, int) {
+	if e.optimal {
+		return e.EncodeWithDict(dict, data), e.matcher.windowSize
+	}
+	if len(data) == 0 {
+		return []Token{}, 0
+	}
+	buf := append(append(make([]byte, 0, len(dict)+len(data)), dict...), data...)
+	if !e.adaptiveLookahead {
+		auto := newAutoMatcher(e.matcher, len(dict))
+		tokens, _ := e.encodeWith(auto, buf, len(dict), len(buf), nil)
+		return tokens, auto.window
+	}
+	// 自動ウィンドウは先読みを変えるマッチャーのコピーで検索する
+	la := newLookaheadMatcher(e.matcher)
+	auto := newAutoMatcher(la.m, len(dict))
+	la.finder = auto
+	tokens, _ := e.encodeWith(la, buf, len(dict), len(buf), nil)
+	return tokens, auto.window
+}
+
+// lookaheadCounts はマッチトークンのうち先読みの長さで打ち切られたものの統計です
+type lookaheadCounts struct {
+	matches   int // マッチトークンの数
+	truncated int // そのうちマッチ長が検索したときの先読みの長さと等しいものの数
+	max       int // 使った先読みの最大の長さ
+}
+
+// encodeWith は encodeRange と同じですが、マッチの検索に finder を使います
+// counts が nil でなければ、マッチトークンを先読みの統計に数えます。
+func (e *Encoder) encodeWith(finder matchFinder, data []byte, start, stop int, counts *lookaheadCounts) ([]Token, int) {
 	var tokens []Token
-	pos := 0
+	pos := start
 
-	for pos < len(data) {
-		match := e.matcher.FindLongestMatch(data, pos)
+	for pos < stop {
+		match := finder.FindLongestMatch(data, pos)
 
-		if match.Length > 0 {
-			// マッチが見つかった場合
-			nextChar := e.getNextChar(data, pos+match.Length)
+		// マッチトークンは必ず「次の文字」を含むため、入力の最後の1バイトは
+		// マッチに含めず次の文字として残す
+		if limit := len(data) - pos - 1; match.Length > limit {
+			match.Length = limit
+		}
 
-			tokens = append(tokens, NewMatchToken(
+		var token Token
+		if match.Length >= minMatchLength && matchWins(e.cost, data, pos, match) {
+			// リテラルより小さいマッチが見つかった場合
+			nextChar := data[pos+match.Length]
+
+			token = NewMatchToken(
 				uint16(match.Distance),
-				uint8(match.Length),
+				uint32(match.Length),
 				nextChar,
-			))
-
-			pos += match.Length + 1 // マッチ長 + 次の文字
+			)
+			if counts != nil {
+				counts.matches++
+				if match.Length == finder.lookahead() {
+					counts.truncated++
+				}
+			}
 		} else {
-			// マッチが見つからない場合はリテラル
-			tokens = append(tokens, NewLiteralToken(data[pos]))
-			pos++
+			// マッチが見つからない、またはリテラルの方が小さい場合
+			token = NewLiteralToken(data[pos])
 		}
-	}
-
-	return tokens
-}
+		if counts != nil {
+			counts.max = max(counts.max, finder.lookahead())
+		}
+		if e.tracer != nil {
+			e.traceStep(data, start, pos, token)
+		}
+		tokens = append(tokens, token)
 
-// getNextChar は指定位置の次の文字を取得します（範囲外の場合は0を返す）
-func (e *Encoder) getNextChar(data []byte, pos int) byte {
-	if pos < len(data) {
-		return data[pos]
+		pos += int(token.Length) + 1 // マッチ長 + 次の文字（リテラルは1バイト）
 	}
-	return 0
+
+	return tokens, pos
 }
 
 // TokensToBytes はトークン配列をバイナリ形式にシリアライズします
+// 連続する minLiteralRun 個以上のリテラルはリテラル列にまとめます。
+// 空のトークン配列は emptyFlag の1バイトになります
 func TokensToBytes(tokens []Token) []byte {
+	if len(tokens) == 0 {
+		return []byte{emptyFlag}
+	}
+
 	var result []byte
 
-	for _, token := range tokens {
-		if token.IsLiteral() {
-			// リテラル: フラグ(0) + 文字
-			result = append(result, 0, token.Literal)
-		} else {
-			// マッチ: フラグ(1) + 距離(2バイト) + 長さ(1バイト) + リテラル(1バイト)
-			result = append(result, 1)
-			distanceBytes := make([]byte, 2)
-			binary.BigEndian.PutUint16(distanceBytes, token.Distance)
-			result = append(result, distanceBytes...)
-			result = append(result, token.Length, token.Literal)
+	for i := 0; i < len(tokens); {
+		run := 0
+		for i+run < len(tokens) && tokens[i+run].IsLiteral() {
+			run++
 		}
+		if run < minLiteralRun {
+			result = tokens[i].appendBinary(result)
+			i++
+			continue
+		}
+
+		result = append(result, literalRunFlag)
+		result = binary.AppendUvarint(result, uint64(run))
+		for _, token := range tokens[i : i+run] {
+			result = append(result, token.Literal)
+		}
+		i += run
 	}
 
 	return result
 }
+
+// mapTokenCosts は TokensToBytes と同じ区切り方で、各トークンのビット数をそのトークンが表す入力の範囲に通知します
+// マッチは一致した範囲と次の文字に、リテラル列のフラグと個数は列全体に、列の文字はそれぞれの位置に通知します。
+func mapTokenCosts(tokens []Token, m common.CostMap) {
+	pos := 0
+	for i := 0; i < len(tokens); {
+		run := 0
+		for i+run < len(tokens) && tokens[i+run].IsLiteral() {
+			run++
+		}
+		if run < minLiteralRun {
+			span := int(tokens[i].Length) + 1
+			m(pos, span, float64(8*tokens[i].EncodedSize()))
+			pos += span
+			i++
+			continue
+		}
+
+		m(pos, run, float64(8*(1+len(binary.AppendUvarint(nil, uint64(run))))))
+		for range run {
+			m(pos, 1, 8)
+			pos++
+		}
+		i += run
+	}
+}
@@ -0,0 +1,153 @@
+package lz77
+
+import (
+	"encoding/binary"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+)
+
+// 2ストリーム形式（lz77h）
+//
+//	トークン数(uvarint)
+//	+ フラグ列（1トークン1ビット、1はマッチ、上位ビットから順、トークン数/8 を切り上げたバイト数）
+//	+ リテラル列のHuffman圧縮データのバイト数(uvarint) + Huffman圧縮データ
+//	+ マッチ列（1マッチ3バイト〜: 距離(2バイト, BigEndian) + 長さ(1バイト〜、lz77 と同じ長さの拡張)）
+//
+// リテラル列はリテラルトークンの文字とマッチトークンの次の文字をトークンの順に並べたもので、
+// 長さは常にトークン数と同じです。マッチはトークンのワイヤーフォーマットから次の文字を
+// 除いた形のまま格納し、展開ではフラグ列に従ってリテラルとマッチを元の順に組み立てます。
+// トークンの選び方（モデル）は lz77 と同じで、違いはリテラルの符号化（エントロピー符号）だけです。
+// トークン数が0（空のデータ）の場合は 0x00 の1バイトだけです。
+const matchRecordSize = 3
+
+// NewCompressorEntropyLiterals はリテラルだけをHuffman符号化する2ストリーム形式のCompressorを作成します
+// Deflate の手前の段階として、LZ77 のトークン（モデル）とリテラルの符号化（エントロピー符号）を
+// 分けて扱います。英文のようなテキストでは通常の lz77 より小さくなります。
+// 登録名は "lz77h" です。
+func NewCompressorEntropyLiterals(opts ...Option) *Compressor {
+	c := NewCompressor(opts...)
+	c.entropyLiterals = true
+	return c
+}
+
+// encodeTwoStream はトークン列を2ストリーム形式にします
+func encodeTwoStream(tokens []Token) ([]byte, error) {
+	flags := bitio.NewWriter()
+	literals := make([]byte, len(tokens))
+	var matches []byte
+	for i, token := range tokens {
+		literals[i] = token.Literal
+		if token.IsLiteral() {
+			flags.WriteBit(0)
+			continue
+		}
+		flags.WriteBit(1)
+		matches = binary.BigEndian.AppendUint16(matches, token.Distance)
+		matches = appendLength(matches, token.Length)
+	}
+
+	result := binary.AppendUvarint(nil, uint64(len(tokens)))
+	if len(tokens) == 0 {
+		return result, nil
+	}
+	// リテラル列は入力より長くならず、入力の大きさは lz77h の Compress で確認済み
+	coded, err := huffman.NewCompressor().WithMaxOneShotSize(0).Compress(literals)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, flags.Bytes()...)
+	result = binary.AppendUvarint(result, uint64(len(coded)))
+	result = append(result, coded...)
+	return append(result, matches...), nil
+}
+
+// decodeTwoStream は2ストリーム形式からトークン列を復元します
+// リテラル列の展開には opts の予算と、トークン数を上限とする出力サイズを使います。
+func decodeTwoStream(data []byte, opts common.DecompressOptions) ([]Token, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, common.NewDecodeError("LZ77H", data, 0, "invalid token count")
+	}
+	pos := n
+	if count == 0 {
+		if pos != len(data) {
+			return nil, common.NewDecodeError("LZ77H", data, pos, "%d trailing bytes after empty stream", len(data)-pos)
+		}
+		return []Token{}, nil
+	}
+	// 1トークンにつき少なくとも1ビットのフラグがある
+	if count > 8*uint64(len(data)-pos) {
+		return nil, common.NewDecodeError("LZ77H", data, 0, "token count %d exceeds the data", count)
+	}
+	flagBytes := int((count + 7) / 8)
+	flags := bitio.NewReaderBits(data[pos:pos+flagBytes], int(count))
+	pos += flagBytes
+
+	codedLen, n := binary.Uvarint(data[pos:])
+	if n <= 0 || codedLen > uint64(len(data)-pos-n) {
+		return nil, common.NewDecodeError("LZ77H", data, pos, "invalid literal stream length")
+	}
+	pos += n
+	literalOpts := common.DecompressOptions{MaxOutputSize: int64(count), Budget: opts.Budget}
+	literals, err := huffman.NewCompressor().DecompressWithOptions(data[pos:pos+int(codedLen)], literalOpts)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(literals)) != count {
+		return nil, common.NewDecodeError("LZ77H", data, pos, "literal stream has %d bytes, want %d", len(literals), count)
+	}
+	pos += int(codedLen)
+
+	tokens := make([]Token, count)
+	for i := range tokens {
+		bit, _ := flags.ReadBit()
+		if bit == 0 {
+			tokens[i] = NewLiteralToken(literals[i])
+			continue
+		}
+		if len(data)-pos < matchRecordSize {
+			return nil, common.NewDecodeError("LZ77H", data, pos, "missing match record for token %d", i)
+		}
+		distance := binary.BigEndian.Uint16(data[pos:])
+		if distance == 0 {
+			return nil, common.NewDecodeError("LZ77H", data, pos, "match with zero distance")
+		}
+		length, n, err := parseLength(data, pos+2)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, common.NewDecodeError("LZ77H", data, pos, "incomplete match record for token %d", i)
+		}
+		tokens[i] = NewMatchToken(distance, length, literals[i])
+		pos += 2 + n
+	}
+	if pos != len(data) {
+		return nil, common.NewDecodeError("LZ77H", data, pos, "%d trailing bytes after match records", len(data)-pos)
+	}
+	return tokens, nil
+}
+
+// mapTwoStreamCosts は2ストリーム形式で各トークンに使うビット数を、そのトークンが表す入力の範囲に通知します
+// フラグの1ビット、リテラル列のHuffman符号の長さ、マッチの距離と長さのバイト数の合計です
+// （トークン数やHuffmanの頻度表のような、位置に対応しない分は含みません）。
+func mapTwoStreamCosts(tokens []Token, m common.CostMap) {
+	literals := make([]byte, len(tokens))
+	for i, token := range tokens {
+		literals[i] = token.Literal
+	}
+	codes := huffman.CodeTable(literals)
+
+	pos := 0
+	for _, token := range tokens {
+		span := int(token.Length) + 1
+		bits := 1 + len(codes[token.Literal])
+		if !token.IsLiteral() {
+			bits += 8 * (2 + lengthSize(token.Length))
+		}
+		m(pos, span, float64(bits))
+		pos += span
+	}
+}
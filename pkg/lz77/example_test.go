@@ -0,0 +1,65 @@
+package lz77_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+)
+
+const sample = `GET /index.html 200
+GET /style.css 200
+GET /index.html 304
+GET /script.js 200
+GET /index.html 304
+`
+
+// 以前に現れた文字列は (距離, 長さ) の参照になります
+func ExampleCompressor_Compress() {
+	c := lz77.NewCompressor()
+	compressed, err := c.Compress([]byte(sample))
+	if err != nil {
+		log.Fatal(err)
+	}
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(c.Name())
+	fmt.Printf("%d -> %d bytes\n", len(sample), len(compressed))
+	fmt.Println(string(decompressed) == sample)
+	// Output:
+	// LZ77
+	// 98 -> 74 bytes
+	// true
+}
+
+// Writer は書き込まれた分から順に圧縮し、Reader は読みながら展開します
+// どちらも全体をメモリに保持しないため、ログのように少しずつ届くデータに使えます。
+func Example_streamWriter() {
+	var compressed bytes.Buffer
+	w := lz77.NewWriter(&compressed)
+	for _, line := range bytes.SplitAfter([]byte(sample), []byte("\n")) {
+		if _, err := w.Write(line); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d -> %d bytes\n", len(sample), compressed.Len())
+
+	decompressed, err := io.ReadAll(lz77.NewReader(&compressed))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(decompressed[:20]))
+	fmt.Println(string(decompressed) == sample)
+	// Output:
+	// 98 -> 76 bytes
+	// GET /index.html 200
+	// true
+}
@@ -0,0 +1,111 @@
+package lz77
+
+// 索引のハッシュ表の大きさ（minMatchLength バイトのハッシュのビット数）
+const (
+	indexHashBits = 15
+	indexHashSize = 1 << indexHashBits
+)
+
+// Index は参照データに対する最長一致の検索のための索引（ハッシュチェーン）です
+// 一度作れば、差分の実験のように多数のブロックを同じ参照データと比べる場合に
+// 毎回参照データ全体を走査せずに済みます。作成後は変更されないため、
+// 複数のゴルーチンから同時に検索できます。
+//
+// 検索結果の MatchResult は、ブロックが参照データの直後に続くとみなしたときの
+// 後方距離（Distance）と一致の長さです。参照データでの位置は len(ref) - Distance で、
+// EncodeWithDict で参照データを辞書にした場合のマッチと同じ意味になります。
+type Index struct {
+	ref  []byte
+	head []int // ハッシュ → そのハッシュを持つ最後の位置 + 1（0 はなし）
+	prev []int // 位置 → 同じハッシュを持つ1つ前の位置 + 1（0 はなし）
+}
+
+// NewIndex は ref の索引を作成します（ref はコピーせずに参照します）
+func NewIndex(ref []byte) *Index {
+	idx := &Index{ref: ref, head: make([]int, indexHashSize)}
+	if len(ref) < minMatchLength {
+		return idx
+	}
+	idx.prev = make([]int, len(ref)-minMatchLength+1)
+	for pos := range idx.prev {
+		h := indexHash(ref[pos:])
+		idx.prev[pos] = idx.head[h]
+		idx.head[h] = pos + 1
+	}
+	return idx
+}
+
+// indexHash は b の先頭 minMatchLength バイトのハッシュを返します
+func indexHash(b []byte) uint32 {
+	v := uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	return (v * 2654435761) >> (32 - indexHashBits)
+}
+
+// Find は chunk の先頭と最も長く一致する参照データの位置を返します
+// 同じ長さの一致が複数ある場合は後方距離の短い（参照データの後ろの）方を返します。
+// minMatchLength 未満の一致は探さず、見つからない場合はゼロ値を返します。
+func (idx *Index) Find(chunk []byte) MatchResult {
+	return idx.FindLimited(chunk, 0)
+}
+
+// FindLimited は Find と同じですが、ハッシュチェーンの候補を maxChain 個までしか調べません
+// 同じ内容が何度も繰り返される参照データでも検索の時間が一定以下になる代わりに、
+// 最長の一致を見逃すことがあります。maxChain が0以下の場合は Find と同じです。
+func (idx *Index) FindLimited(chunk []byte, maxChain int) MatchResult {
+	var best MatchResult
+	idx.walk(chunk, minMatchLength, maxChain, func(m MatchResult) {
+		if m.Length > best.Length {
+			best = m
+		}
+	})
+	return best
+}
+
+// FindAll は chunk の先頭と minLen バイト以上一致する参照データの位置をすべて、後方距離の短い順に返します
+// minLen が minMatchLength より小さい場合は minMatchLength として扱います。
+func (idx *Index) FindAll(chunk []byte, minLen int) []MatchResult {
+	var matches []MatchResult
+	idx.walk(chunk, minLen, 0, func(m MatchResult) {
+		matches = append(matches, m)
+	})
+	return matches
+}
+
+// walk はハッシュチェーンをたどり、minLen バイト以上の一致ごとに fn を呼び出します（後方距離の短い順）
+// maxChain が正の場合は、チェーンの先頭から maxChain 個の候補だけを調べます。
+func (idx *Index) walk(chunk []byte, minLen, maxChain int, fn func(MatchResult)) {
+	minLen = max(minLen, minMatchLength)
+	if len(chunk) < minLen || idx.prev == nil {
+		return
+	}
+	for p, n := idx.head[indexHash(chunk)], 0; p != 0 && (maxChain <= 0 || n < maxChain); p, n = idx.prev[p-1], n+1 {
+		pos := p - 1
+		length := commonPrefix(idx.ref[pos:], chunk)
+		if length >= minLen {
+			fn(MatchResult{Distance: len(idx.ref) - pos, Length: length})
+		}
+	}
+}
+
+// commonPrefix は a と b の先頭から一致するバイト数を返します
+func commonPrefix(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// FindAllMatches は needle の先頭と minLen バイト以上一致する haystack の位置をすべて返します
+// 結果の意味と順序は Index.FindAll と同じです。同じ haystack を何度も検索する場合は
+// NewIndex で作った索引を使ってください。
+func FindAllMatches(haystack, needle []byte, minLen int) []MatchResult {
+	return NewIndex(haystack).FindAll(needle, minLen)
+}
+
+// BestMatch は needle の先頭と最も長く一致する haystack の位置を返します（Index.Find と同じ）
+func BestMatch(haystack, needle []byte) MatchResult {
+	return NewIndex(haystack).Find(needle)
+}
@@ -0,0 +1,85 @@
+package lz77
+
+// 適応的な先読み（WithAdaptiveLookahead）の設定
+const (
+	// lookaheadInterval は先読みを見直す間隔（今の先読みの何倍の入力ごとか）です
+	// 長い繰り返しの間に短い一致が続く部分があっても、すぐに先読みを縮めないようにします。
+	lookaheadInterval = 16
+
+	// lookaheadGrowDivisor は、マッチのうち先読みの長さで打ち切られた割合が
+	// 1/lookaheadGrowDivisor 以上の場合に先読みを2倍にすることを表します
+	lookaheadGrowDivisor = 8
+)
+
+// WithAdaptiveLookahead は先読み（最大マッチ長）をデータに合わせて変えるようにします
+// 直前の入力（先読みの16倍）のマッチのうち先読みの長さで打ち切られたものが多ければ先読みを
+// 2倍にし（圧縮データで表せる最大マッチ長まで）、先読みの半分より長いマッチが見つからなく
+// なれば半分に戻します（WithMaxMatchLength の値、デフォルトは18より小さくはしません）。
+// 数KBの繰り返しがあるデータでは大きな先読みを指定した場合に近い圧縮率になり、長い
+// 繰り返しのないデータでは先読みが変わらないため、速度も出力もデフォルトと同じです。
+//
+// マッチ長はそのまま圧縮データに記録されるため（255以上は長さの拡張）、展開側は先読みを
+// 知る必要がなく、出力は通常のCompressorで展開できます。WithOptimalMatcher と組み合わせた
+// 場合は無視します。
+func WithAdaptiveLookahead() Option {
+	return func(c *Compressor) {
+		c.encoder.adaptiveLookahead = true
+	}
+}
+
+// lookaheadMatcher は WithAdaptiveLookahead のマッチャーです
+// 判断のための状態を持つため、エンコードの呼び出しごとに作成します。
+type lookaheadMatcher struct {
+	m      *Matcher    // 検索に使うマッチャーのコピー（bufferSize を変える）
+	finder matchFinder // m で検索するマッチャー（m 自身か、m を使う autoMatcher）
+	base   int         // 先読みの最小の長さ
+
+	nextCheck int // 次に先読みを見直す位置（0はまだ検索していない）
+	matches   int // 前回の見直しからのマッチの数
+	truncated int // そのうち先読みの長さで打ち切られた数
+	long      int // そのうち先読みの半分より長い数
+}
+
+// newLookaheadMatcher は m の設定から始める lookaheadMatcher を作成します
+// finder は m のコピー（lookaheadMatcher.m）で検索します。
+func newLookaheadMatcher(m *Matcher) *lookaheadMatcher {
+	copied := *m
+	return &lookaheadMatcher{m: &copied, finder: &copied, base: m.bufferSize}
+}
+
+// FindLongestMatch は今の先読みで最長一致を検索し、結果を先読みの判断に数えます
+func (l *lookaheadMatcher) FindLongestMatch(data []byte, pos int) MatchResult {
+	if l.nextCheck == 0 {
+		l.nextCheck = pos + lookaheadInterval*l.m.bufferSize
+	} else if pos >= l.nextCheck {
+		l.adjust()
+		l.nextCheck = pos + lookaheadInterval*l.m.bufferSize
+	}
+	match := l.finder.FindLongestMatch(data, pos)
+	if match.Length >= minMatchLength {
+		l.matches++
+		if match.Length == l.m.bufferSize {
+			l.truncated++
+		}
+		if match.Length > l.m.bufferSize/2 {
+			l.long++
+		}
+	}
+	return match
+}
+
+// lookahead は今の先読みの長さを返します
+func (l *lookaheadMatcher) lookahead() int {
+	return l.m.bufferSize
+}
+
+// adjust は打ち切られたマッチが多ければ先読みを2倍に、長いマッチがなければ半分にします
+func (l *lookaheadMatcher) adjust() {
+	switch {
+	case l.matches > 0 && l.truncated*lookaheadGrowDivisor >= l.matches:
+		l.m.bufferSize = min(l.m.bufferSize, maxMatchLength/2) * 2
+	case l.long == 0:
+		l.m.bufferSize = max(l.m.bufferSize/2, l.base)
+	}
+	l.matches, l.truncated, l.long = 0, 0, 0
+}
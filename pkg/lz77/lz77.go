@@ -3,47 +3,311 @@
 package lz77
 
 import (
+	"math"
+
 	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:          "lz77",
+		Extensions:    []string{".lz77"},
+		Capabilities:  common.CapStreaming | common.CapDictionary | common.CapDeterministic,
+		Description:   "LZ77（スライディングウィンドウの過去の一致を距離と長さで参照）",
+		UseCase:       "繰り返しの多い一般的なデータ、プリセット辞書を使う小さなメッセージ",
+		MaxVersion:    formatVersion,
+		NewFunc:       func() common.Compressor { return NewCompressor() },
+		NewStreamFunc: func() common.StreamCompressor { return NewStreamCompressor() },
+	})
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "lz77-optimal",
+		Extensions:   []string{".lz77"},
+		Capabilities: common.CapDictionary | common.CapDeterministic,
+		Description:  "最適なマッチの並びを選ぶLZ77（lz77 と同じ形式）",
+		UseCase:      "圧縮に時間をかけても小さくしたい場合",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressor(WithOptimalMatcher()) },
+	})
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "lz77h",
+		Extensions:   []string{".lz77h"},
+		Capabilities: common.CapDictionary | common.CapDeterministic,
+		Description:  "リテラルをHuffman符号化する2ストリームのLZ77",
+		UseCase:      "一致の少ない部分も多いテキスト",
+		MinVersion:   1,
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressorEntropyLiterals() },
+	})
+}
+
 // Compressor はLZ77圧縮を実装します
+// encoder と decoder は構築後に変更されない設定だけを保持し、マッチングの
+// 作業領域は呼び出しごとに確保するため、複数のゴルーチンから同時に使用できます
 type Compressor struct {
 	encoder *Encoder
 	decoder *Decoder
+	dict    []byte // プリセット辞書（nilの場合は辞書なし）
+
+	entropyLiterals bool // リテラルをHuffman符号化する2ストリーム形式（lz77h）
+
+	timings *common.Timings     // nil でなければ圧縮のフェーズごとの処理時間を記録する
+	policy  common.Policy       // Strict の場合は WithAutoWindow のウィンドウの自動選択をエラーにする
+	costMap common.CostMap      // nil でなければ Compress でトークンごとのビット数を通知する
+	oneShot common.OneShotLimit // Compress の入力の上限
 }
 
-// NewCompressor は新しいCompressorを作成します
-func NewCompressor() *Compressor {
-	const (
-		defaultWindowSize = 4096 // 4KB
-		defaultBufferSize = 18   // 最大マッチ長
-	)
+// Compress が common.Timings に記録するフェーズの名前です
+const (
+	PhaseMatch     = "match"     // マッチの検索とトークン列の作成
+	PhaseSerialize = "serialize" // トークン列のバイト列への変換（lz77h ではリテラルのHuffman符号化を含む）
+)
+
+const (
+	defaultWindowSize = 4096 // 4KB
+	defaultBufferSize = 18   // 最大マッチ長
+)
+
+// Option はCompressorの設定を変更します
+type Option func(*Compressor)
+
+// WithOptimalMatcher は接尾辞配列を使い、ウィンドウ内の本当の最長一致を常に見つけるようにします
+// 通常のマッチャーより遅くなりますが、比較のための圧縮率の上限として使えます。
+// 出力の形式は変わらないため、通常のCompressorで展開できます。
+func WithOptimalMatcher() Option {
+	return func(c *Compressor) {
+		c.encoder.optimal = true
+	}
+}
+
+// WithCostModel はマッチを出力するかどうかの判断に m を使うようにします
+// デフォルトはトークンのワイヤーフォーマットのサイズ（TokenCostModel）です。モデルは
+// どのトークンを選ぶかだけに影響し、出力の形式は変わらないため、通常のCompressorで展開できます。
+func WithCostModel(m CostModel) Option {
+	return func(c *Compressor) {
+		c.encoder.cost = m
+	}
+}
+
+// WithWindowSize はウィンドウ（マッチを探す過去のデータ）を n バイトにします（デフォルトは4KB）
+// 大きなウィンドウでは離れた位置の繰り返しも参照できる代わりに、候補が増えるため圧縮が
+// 遅くなります。WithAutoWindow と組み合わせた場合は、ウィンドウを広げる上限になります。
+// n は1以上、圧縮データで表せる最大の後方距離（65535）以下に丸めます。
+func WithWindowSize(n int) Option {
+	return func(c *Compressor) {
+		c.encoder.matcher.windowSize = min(max(n, 1), maxDistance)
+	}
+}
+
+// maxMatchLength は WithMaxMatchLength で指定できる最大マッチ長の上限です（Token.Length の範囲）
+const maxMatchLength = math.MaxInt32
 
-	return &Compressor{
+// WithMaxMatchLength は最大マッチ長（先読みの長さ）を n にします（デフォルトは18）
+// 長い繰り返しを含むデータでは、1つのマッチで繰り返し全体を表せるため、トークン数と
+// 圧縮後のサイズが小さくなります。マッチは残りの入力の長さまでに制限されます。
+// 255以上のマッチは長さの拡張（形式バージョン2）で表すため、出力は通常のCompressorで展開できます。
+// 候補ごとに先読みの長さまで比較するため、大きな値では繰り返しの少ないデータの圧縮が遅くなります。
+// n は minMatchLength 以上 maxMatchLength 以下に丸めます。
+func WithMaxMatchLength(n int) Option {
+	return func(c *Compressor) {
+		c.encoder.matcher.bufferSize = min(max(n, minMatchLength), maxMatchLength)
+	}
+}
+
+// NewCompressor は新しいCompressorを作成します
+func NewCompressor(opts ...Option) *Compressor {
+	c := &Compressor{
 		encoder: NewEncoder(defaultWindowSize, defaultBufferSize),
 		decoder: NewDecoder(),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewCompressorWithDict はプリセット辞書を使うCompressorを作成します
+// 辞書はデータの前に置かれた履歴として扱われ、似た内容の小さなデータを
+// 圧縮するときに効果があります。展開にも同じ辞書が必要です。
+// ウィンドウサイズより前にある辞書の内容は参照されません。
+func NewCompressorWithDict(dict []byte, opts ...Option) *Compressor {
+	return NewCompressor(opts...).WithDict(dict)
+}
+
+// WithDict は l と同じ設定でプリセット辞書を使うCompressorを返します（l は変更しません）
+// 圧縮形式（lz77 / lz77h）を保ったまま辞書を追加するために使います。
+func (l *Compressor) WithDict(dict []byte) *Compressor {
+	if window := l.encoder.matcher.windowSize; len(dict) > window {
+		dict = dict[len(dict)-window:]
+	}
+	c := *l
+	c.dict = append([]byte(nil), dict...)
+	return &c
 }
 
 // Name はアルゴリズム名を返します
 func (l *Compressor) Name() string {
-	return "LZ77"
+	name := "LZ77"
+	if l.encoder.optimal {
+		name += " (optimal)"
+	}
+	if l.entropyLiterals {
+		name += " (Huffman literals)"
+	}
+	if l.dict != nil {
+		name += " (dictionary)"
+	}
+	return name
+}
+
+// formatVersion はLZ77の圧縮形式（トークンのワイヤーフォーマット）のバージョンです
+// 1: 連続するリテラルをリテラル列（フラグ2）にまとめる
+// 2: 255以上のマッチ長を長さの拡張（255 + uvarint）で表す
+// 3: 先頭にウィンドウ（WithAutoWindow で選んだウィンドウのバイト数）を置ける
+// 4: トークンの間に同期マーカー（Writer.Flush の区切り）を置ける
+// 2ストリーム形式（lz77h）は最初の形式がバージョン1で、長さの拡張は lz77 と同じくバージョン2です。
+const formatVersion = 4
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (l *Compressor) FormatVersion() byte {
+	return formatVersion
 }
 
 // Compress はLZ77アルゴリズムでデータを圧縮します
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+// 大きな入力は Writer（NewWriter）で圧縮してください。
 func (l *Compressor) Compress(data []byte) ([]byte, error) {
-	tokens := l.encoder.Encode(data)
+	if err := l.oneShot.Check(l.Name(), len(data)); err != nil {
+		return nil, err
+	}
+	if l.encoder.autoWindow {
+		if err := l.policy.Refuse("automatic window selection", "use WithWindowSize instead of WithAutoWindow"); err != nil {
+			return nil, err
+		}
+	}
+	start := l.timings.Start()
+	var tokens []Token
+	window := 0
+	if l.encoder.autoWindow {
+		tokens, window = l.encoder.encodeAuto(l.dict, data)
+	} else {
+		tokens = l.encoder.EncodeWithDict(l.dict, data)
+	}
+	start = l.timings.Since(PhaseMatch, start)
+	defer l.timings.Since(PhaseSerialize, start)
+	if l.costMap != nil {
+		if l.entropyLiterals {
+			mapTwoStreamCosts(tokens, l.costMap)
+		} else {
+			mapTokenCosts(tokens, l.costMap)
+		}
+	}
+	if l.entropyLiterals {
+		return encodeTwoStream(tokens)
+	}
+	if window > 0 {
+		return append(appendWindow(nil, window), TokensToBytes(tokens)...), nil
+	}
 	return TokensToBytes(tokens), nil
 }
 
+// WithTimings は圧縮のフェーズ（PhaseMatch、PhaseSerialize）ごとの処理時間を t に記録する
+// Compressor を返します（common.Timed）
+func (l *Compressor) WithTimings(t *common.Timings) common.Compressor {
+	c := *l
+	c.timings = t
+	return &c
+}
+
+// WithPolicy は p に従う Compressor を返します（common.PolicyAware）
+// Strict の場合、WithAutoWindow で作成した Compressor の Compress は *common.StrictError を返します。
+func (l *Compressor) WithPolicy(p common.Policy) common.Compressor {
+	c := *l
+	c.policy = p
+	return &c
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (l *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	c := *l
+	c.oneShot = common.NewOneShotLimit(n)
+	return &c
+}
+
+// WithCostMap は Compress でトークンごとのビット数を、そのトークンが表す入力の範囲に通知する
+// Compressor を返します（common.CostMapped）
+// マッチは一致した範囲と次の文字に、リテラルはその1バイトに通知します。
+func (l *Compressor) WithCostMap(m common.CostMap) common.Compressor {
+	c := *l
+	c.costMap = m
+	return &c
+}
+
 // Decompress はLZ77圧縮されたデータを展開します
 func (l *Compressor) Decompress(data []byte) ([]byte, error) {
-	tokens, err := l.decoder.Decode(data)
+	return l.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 圧縮データを一度走査して展開後のサイズを求め、出力バッファの確保前に予算を確認します。
+// トークン列は作らずに出力へ直接書き込みます。
+func (l *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if l.entropyLiterals {
+		tokens, err := decodeTwoStream(data, opts)
+		if err != nil {
+			return nil, err
+		}
+		size := outputSize(tokens)
+		if err := opts.ReserveOutput(size, size); err != nil {
+			return nil, err
+		}
+		return l.decoder.TokensToDataWithDict(l.dict, tokens)
+	}
+
+	size, err := decodedSize(data)
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.ReserveOutput(size, size); err != nil {
+		return nil, err
+	}
+	return l.decoder.decompress(l.dict, data, size)
+}
 
-	return l.decoder.TokensToData(tokens)
+// maxWindowHeaderSize は圧縮データの先頭のウィンドウの最大のバイト数です（フラグ + 65535 の uvarint）
+const maxWindowHeaderSize = 1 + 3
+
+// MaxCompressedSize は n バイトの入力を Compress したときの最大のバイト数を返します
+// デフォルトのコストモデル（TokenCostModel）では、マッチは同じ範囲のリテラルより小さい
+// 場合だけ出力し、リテラルは1バイトあたり最大2バイトなので、マッチャーやウィンドウに
+// よらず 2n + ウィンドウの分を超えません。空の入力は1バイト（emptyFlag）です。
+// 2ストリーム形式（lz77h）と独自の CostModel には当てはまりません。
+func MaxCompressedSize(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return 2*n + maxWindowHeaderSize
+}
+
+// WorkingMemory は WithOptimalMatcher の作業領域の目安を返します（common.MemoryReporter）
+// 接尾辞配列、順位、LCP はプリセット辞書を含む入力の1バイトあたり int32 が3つです。
+// 通常のマッチャーは入力に比例する作業領域を持たないため nil を返します。
+func (l *Compressor) WorkingMemory(n int) []int64 {
+	if !l.encoder.optimal {
+		return nil
+	}
+	return []int64{int64(len(l.dict)+n) * 3 * 4}
+}
+
+// EncodeTokens はデフォルト設定（4KBウィンドウ、最大マッチ長18）でデータをトークン列に変換します
+// Compress の出力は TokensToBytes(EncodeTokens(data)) と同一です
+func EncodeTokens(data []byte) []Token {
+	return NewEncoder(defaultWindowSize, defaultBufferSize).Encode(data)
+}
+
+// DecodeTokens はトークン列から元のデータを復元します
+func DecodeTokens(tokens []Token) ([]byte, error) {
+	return NewDecoder().TokensToData(tokens)
 }
 
 // FindLongestMatch は最長一致を検索します（テスト用の公開メソッド）
@@ -53,4 +317,13 @@ func (l *Compressor) FindLongestMatch(data []byte, pos int) (distance int, lengt
 }
 
 // コンパイル時にインターフェースの実装を確認
-var _ common.Compressor = (*Compressor)(nil)
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+	_ common.Timed               = (*Compressor)(nil)
+	_ common.FloorEstimator      = (*Compressor)(nil)
+	_ common.MemoryReporter      = (*Compressor)(nil)
+	_ common.PolicyAware         = (*Compressor)(nil)
+	_ common.OneShotLimited      = (*Compressor)(nil)
+	_ common.CostMapped          = (*Compressor)(nil)
+)
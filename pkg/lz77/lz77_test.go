@@ -2,7 +2,26 @@ package lz77
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/golden"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/stdcompat"
 )
 
 func TestLZ77Compressor_Name(t *testing.T) {
@@ -21,6 +40,13 @@ func TestLZ77Compressor_EmptyData(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Compress failed: %v", err)
 	}
+	// 空のデータも空でない圧縮データになり、空の圧縮データは不正として扱われる
+	if len(compressed) == 0 {
+		t.Error("Expected non-empty compressed data for empty input")
+	}
+	if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for empty compressed data, got %v", err)
+	}
 
 	decompressed, err := compressor.Decompress(compressed)
 	if err != nil {
@@ -172,10 +198,10 @@ func TestLZ77Compressor_FindLongestMatch(t *testing.T) {
 		t.Errorf("Expected no match at position 0, got distance=%d, length=%d", distance, length)
 	}
 
-	// 位置3では "abc" が一致するはず
+	// 位置3では残りの "abcabc" 全体が、現在位置に重なる距離3の一致になるはず
 	distance, length = compressor.FindLongestMatch(data, 3)
-	if distance != 3 || length != 3 {
-		t.Errorf("Expected match at position 3: distance=3, length=3, got distance=%d, length=%d", distance, length)
+	if distance != 3 || length != 6 {
+		t.Errorf("Expected match at position 3: distance=3, length=6, got distance=%d, length=%d", distance, length)
 	}
 
 	// 位置6では "abc" が一致するはず（より近い方を参照）
@@ -236,6 +262,7 @@ func TestLZ77Compressor_InvalidData(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid compressed data")
 	}
+	assertDecodeOffset(t, err, 0)
 
 	// 不正な距離のテスト
 	invalidDistanceData := []byte{1, 0, 10, 3, 'a'} // 距離10だが結果が空
@@ -244,6 +271,371 @@ func TestLZ77Compressor_InvalidData(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid distance")
 	}
+	assertDecodeOffset(t, err, 1)
+
+	// 2つ目のトークンの不正な距離は、その距離フィールドの位置で報告される
+	_, err = compressor.Decompress([]byte{0, 'a', 1, 0, 10, 3, 'a'})
+	assertDecodeOffset(t, err, 3)
+}
+
+// assertDecodeOffset はエラーが指定した位置の DecodeError であることを確認します
+func assertDecodeOffset(t *testing.T, err error, offset int64) {
+	t.Helper()
+	var decodeErr *common.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Expected DecodeError, got %v", err)
+		return
+	}
+	if !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected error to wrap ErrInvalidData, got %v", err)
+	}
+	if decodeErr.Offset != offset {
+		t.Errorf("Expected offset %d, got %d (%v)", offset, decodeErr.Offset, err)
+	}
+}
+
+func TestToken_MarshalBinaryRoundTrip(t *testing.T) {
+	tokens := []Token{
+		NewLiteralToken('a'),
+		NewLiteralToken(0x00),
+		NewMatchToken(1, 3, 'b'),
+		NewMatchToken(4096, 18, 0xFF),
+		NewMatchToken(0xFFFF, 0xFF, 0x00),
+	}
+
+	for _, token := range tokens {
+		var m encoding.BinaryMarshaler = token
+		data, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if len(data) != token.EncodedSize() {
+			t.Errorf("Token %+v: expected %d bytes, got %d", token, token.EncodedSize(), len(data))
+		}
+
+		var decoded Token
+		var u encoding.BinaryUnmarshaler = &decoded
+		if err := u.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary failed: %v", err)
+		}
+		if decoded != token {
+			t.Errorf("Expected %+v, got %+v", token, decoded)
+		}
+	}
+}
+
+func TestToken_MarshalBinaryMatchesWireFormat(t *testing.T) {
+	data, _ := NewMatchToken(0x0102, 7, 'z').MarshalBinary()
+	expected := []byte{1, 0x01, 0x02, 7, 'z'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	data, _ = NewLiteralToken('q').MarshalBinary()
+	expected = []byte{0, 'q'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+}
+
+func TestToken_UnmarshalBinaryInvalid(t *testing.T) {
+	invalid := []struct {
+		data   []byte
+		offset int64
+	}{
+		{[]byte{}, 0},
+		{[]byte{0}, 0},
+		{[]byte{1, 0, 5}, 0},
+		{[]byte{1, 0, 0, 3, 'a'}, 1}, // 距離0のマッチ
+		{[]byte{2, 1, 'a'}, 0},       // リテラル列は1トークンではない
+		{[]byte{3, 'a'}, 0},          // 未知のフラグ
+		{[]byte{0, 'a', 'b'}, 2},     // 余分なバイト
+	}
+
+	for _, tc := range invalid {
+		var token Token
+		err := token.UnmarshalBinary(tc.data)
+		if err == nil {
+			t.Errorf("Expected error for %v", tc.data)
+		}
+		assertDecodeOffset(t, err, tc.offset)
+	}
+}
+
+func TestToken_LongLength(t *testing.T) {
+	for _, length := range []uint32{254, 255, 256, 1 << 20, maxMatchLength} {
+		token := NewMatchToken(7, length, 'x')
+		data, _ := token.MarshalBinary()
+		if len(data) != token.EncodedSize() {
+			t.Errorf("Length %d: expected %d bytes, got %d", length, token.EncodedSize(), len(data))
+		}
+		var decoded Token
+		if err := decoded.UnmarshalBinary(data); err != nil || decoded != token {
+			t.Errorf("Length %d: expected %+v, got %+v (%v)", length, token, decoded, err)
+		}
+	}
+
+	// 255以上の長さは 255 + uvarint(長さ - 255) で表す
+	data, _ := NewMatchToken(1, 300, 'z').MarshalBinary()
+	expected := []byte{1, 0, 1, 255, 45, 'z'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+}
+
+func TestDecompress_TruncatedLengthExtension(t *testing.T) {
+	invalid := [][]byte{
+		{0, 'a', 1, 0, 1, 255},                                          // 拡張がない
+		{0, 'a', 1, 0, 1, 255, 0x80},                                    // uvarintの途中で終わる
+		{0, 'a', 1, 0, 1, 255, 45},                                      // 次の文字がない
+		{0, 'a', 1, 0, 1, 255, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 'b'}, // Token.Length の範囲外
+	}
+	for _, data := range invalid {
+		if _, err := NewCompressor().Decompress(data); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%v: expected ErrInvalidData, got %v", data, err)
+		}
+		_, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(data))))
+		if !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%v: expected ErrInvalidData from Reader, got %v", data, err)
+		}
+	}
+}
+
+func TestWithMaxMatchLength_LongRepeat(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefg"), (1<<20)/7)
+
+	for _, c := range []*Compressor{
+		NewCompressor(WithMaxMatchLength(1 << 20)),
+		NewCompressorEntropyLiterals(WithMaxMatchLength(1 << 20)),
+	} {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", c.Name(), err)
+		}
+		decompressed, err := c.Decompress(compressed)
+		if err != nil || !bytes.Equal(decompressed, data) {
+			t.Fatalf("%s: round trip failed: %v", c.Name(), err)
+		}
+		if len(compressed) > 64 {
+			t.Errorf("%s: expected at most 64 bytes, got %d", c.Name(), len(compressed))
+		}
+	}
+
+	// 繰り返し全体が数トークンになり、マッチ長は255を超える
+	compressed, _ := NewCompressor(WithMaxMatchLength(1 << 20)).Compress(data)
+	tokens, longest := 0, uint32(0)
+	walkTokens(compressed, func(_ int, token Token, literals []byte) error {
+		tokens++
+		longest = max(longest, token.Length)
+		return nil
+	})
+	if tokens > 24 {
+		t.Errorf("Expected a few dozen tokens at most, got %d", tokens)
+	}
+	if longest <= 255 {
+		t.Errorf("Expected a match longer than 255, got %d", longest)
+	}
+
+	// デフォルトの Compressor でも展開できる
+	decompressed, err := NewCompressor().Decompress(compressed)
+	if err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("Default compressor failed to decompress: %v", err)
+	}
+	streamed, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+	if err != nil || !bytes.Equal(streamed, data) {
+		t.Errorf("Reader failed to decompress: %v", err)
+	}
+}
+
+func TestTokensToBytes_LiteralRuns(t *testing.T) {
+	tokens := []Token{
+		NewLiteralToken('a'), NewLiteralToken('b'), // 2個は個別のリテラル
+		NewMatchToken(2, 3, 'c'),
+		NewLiteralToken('x'), NewLiteralToken('y'), NewLiteralToken('z'),
+	}
+	expected := []byte{0, 'a', 0, 'b', 1, 0, 2, 3, 'c', 2, 3, 'x', 'y', 'z'}
+	if data := TokensToBytes(tokens); !bytes.Equal(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	// リテラル列は個々のリテラルトークンとしてパースされる
+	decoded, err := NewDecoder().Decode(expected)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !slices.Equal(decoded, tokens) {
+		t.Errorf("Expected %+v, got %+v", tokens, decoded)
+	}
+}
+
+func TestCompress_LiteralRunSizes(t *testing.T) {
+	compressor := NewCompressor()
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int
+	}{
+		// 26個のリテラルは 1 + 1 + 26 バイト（リテラル列なしでは52バイト）
+		{"alphabet", []byte("abcdefghijklmnopqrstuvwxyz"), 28},
+		// 乱数はほぼ膨張しない（リテラル列なしでは約2倍）
+		{"random", testcorpus.Random(1024, 7), 1024 + 16},
+	}
+
+	for _, tt := range tests {
+		compressed, err := compressor.Compress(tt.data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", tt.name, err)
+		}
+		if len(compressed) > tt.maxSize {
+			t.Errorf("%s: expected at most %d bytes, got %d", tt.name, tt.maxSize, len(compressed))
+		}
+
+		decompressed, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", tt.name, err)
+		}
+		if !bytes.Equal(decompressed, tt.data) {
+			t.Errorf("%s: round trip mismatch", tt.name)
+		}
+	}
+}
+
+func TestDecompress_Version0(t *testing.T) {
+	// 形式バージョン0（リテラル列なし）のデータも展開できる
+	data := []byte{0, 'a', 0, 'b', 0, 'c', 1, 0, 3, 6, '!'}
+	decompressed, err := NewCompressor().Decompress(data)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if string(decompressed) != "abcabcabc!" {
+		t.Errorf("Expected %q, got %q", "abcabcabc!", decompressed)
+	}
+}
+
+func TestDecompress_InvalidLiteralRuns(t *testing.T) {
+	invalid := []struct {
+		name   string
+		data   []byte
+		offset int64
+	}{
+		{"missing length", []byte{0, 'a', 2}, 3},
+		{"empty run", []byte{2, 0, 'a'}, 1},
+		{"truncated run", []byte{0, 'a', 2, 5, 'b', 'c'}, 2},
+		{"distance beyond run", []byte{2, 3, 'a', 'b', 'c', 1, 0, 4, 3, 'd'}, 6},
+	}
+
+	for _, tc := range invalid {
+		_, err := NewCompressor().Decompress(tc.data)
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+			continue
+		}
+		assertDecodeOffset(t, err, tc.offset)
+	}
+}
+
+func TestEncodeDecodeTokens_Corpus(t *testing.T) {
+	compressor := NewCompressor()
+
+	for _, sample := range testcorpus.Samples() {
+		t.Run(sample.Name, func(t *testing.T) {
+			tokens := EncodeTokens(sample.Data)
+
+			decoded, err := DecodeTokens(tokens)
+			if err != nil {
+				t.Fatalf("DecodeTokens failed: %v", err)
+			}
+			if !bytes.Equal(sample.Data, decoded) {
+				t.Errorf("DecodeTokens(EncodeTokens(x)) != x")
+			}
+
+			// Compress の出力はトークン列の直列化と一致する
+			compressed, err := compressor.Compress(sample.Data)
+			if err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			if !bytes.Equal(compressed, TokensToBytes(tokens)) {
+				t.Errorf("Compress output differs from serialized tokens")
+			}
+		})
+	}
+}
+
+func TestTokenStream_WriteToReadFrom(t *testing.T) {
+	data := []byte("abcabcabcabc hello hello hello")
+	stream := TokenStream(EncodeTokens(data))
+
+	var buf bytes.Buffer
+	written, err := stream.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, buffer has %d", written, buf.Len())
+	}
+
+	var restored TokenStream
+	read, err := restored.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if read != written {
+		t.Errorf("ReadFrom reported %d bytes, expected %d", read, written)
+	}
+	if len(restored) != len(stream) {
+		t.Fatalf("Expected %d tokens, got %d", len(stream), len(restored))
+	}
+	for i := range stream {
+		if restored[i] != stream[i] {
+			t.Errorf("Token %d: expected %+v, got %+v", i, stream[i], restored[i])
+		}
+	}
+
+	// 書き出したストリームはそのまま Decompress できる
+	decompressed, err := NewCompressor().Decompress(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Original: %s, Decompressed: %s", data, decompressed)
+	}
+}
+
+func TestTokenStream_ReadFromInvalid(t *testing.T) {
+	var stream TokenStream
+	_, err := stream.ReadFrom(bytes.NewReader([]byte{0, 'a', 1, 0, 5}))
+	if err == nil {
+		t.Error("Expected error for truncated stream")
+	}
+	assertDecodeOffset(t, err, 2)
+}
+
+func TestLZ77Compressor_BudgetExceeded(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 1トークン(5バイト)で255バイトに展開されるマッチを並べる（約2.5MBに展開）
+	payload := []byte{0, 'a'}
+	for i := 0; i < 10000; i++ {
+		payload = append(payload, 1, 0, 1, 254, 'a')
+	}
+
+	opts := common.DecompressOptions{
+		MaxOutputSize: 10 << 20,
+		Budget:        common.NewBudget(1 << 20),
+	}
+	_, err := compressor.DecompressWithOptions(payload, opts)
+	if !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+	}
+
+	// 予算が十分なら展開できる
+	decompressed, err := compressor.DecompressWithOptions(payload, common.DecompressOptions{Budget: common.NewBudget(16 << 20)})
+	if err != nil {
+		t.Fatalf("DecompressWithOptions failed: %v", err)
+	}
+	if len(decompressed) != 1+10000*255 {
+		t.Errorf("Expected %d bytes, got %d", 1+10000*255, len(decompressed))
+	}
 }
 
 // ベンチマークテスト
@@ -281,3 +673,1400 @@ func BenchmarkLZ77Decompress(b *testing.B) {
 		}
 	}
 }
+
+func TestCompressorWithDict_RoundTrip(t *testing.T) {
+	dict := []byte(`{"user":{"name":"","email":"@example.com"},"status":"active"}`)
+	data := []byte(`{"user":{"name":"alice","email":"alice@example.com"},"status":"active"}`)
+
+	plain := NewCompressor()
+	withDict := NewCompressorWithDict(dict)
+
+	p, err := plain.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	d, err := withDict.Compress(data)
+	if err != nil {
+		t.Fatalf("Compress with dictionary failed: %v", err)
+	}
+	if len(d) >= len(p) {
+		t.Errorf("Dictionary did not help: %d vs %d bytes", len(d), len(p))
+	}
+
+	decompressed, err := withDict.Decompress(d)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Round trip mismatch: got %q", decompressed)
+	}
+
+	// 辞書なしでは展開できない（先頭から辞書を参照している）
+	if result, err := plain.Decompress(d); err == nil && bytes.Equal(result, data) {
+		t.Error("Expected decompression without dictionary to fail")
+	}
+}
+
+func TestOptimalMatcher_NeverLargerThanGreedy(t *testing.T) {
+	greedy := NewCompressor()
+	optimal := NewCompressor(WithOptimalMatcher())
+
+	for _, sample := range testcorpus.Samples() {
+		g, err := greedy.Compress(sample.Data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", sample.Name, err)
+		}
+		o, err := optimal.Compress(sample.Data)
+		if err != nil {
+			t.Fatalf("%s: optimal Compress failed: %v", sample.Name, err)
+		}
+		if len(o) > len(g) {
+			t.Errorf("%s: optimal output (%d) is larger than greedy output (%d)", sample.Name, len(o), len(g))
+		}
+
+		// 出力形式は同じなので通常のCompressorで展開できる
+		decompressed, err := greedy.Decompress(o)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", sample.Name, err)
+		}
+		if !bytes.Equal(sample.Data, decompressed) {
+			t.Errorf("%s: round trip mismatch", sample.Name)
+		}
+	}
+}
+
+func TestOptimalMatcher_FindsLongestMatch(t *testing.T) {
+	const window, buffer = 64, 18
+	r := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 20; trial++ {
+		data := make([]byte, 300)
+		for i := range data {
+			data[i] = byte('a' + r.Intn(3))
+		}
+		m := newOptimalMatcher(data, window, buffer)
+
+		for pos := 0; pos < len(data); pos++ {
+			// 重なりを許して、ウィンドウ内のすべての位置を比較する
+			expected := 0
+			for i := pos - 1; i >= 0 && i >= pos-window; i-- {
+				length := 0
+				for length < buffer && pos+length < len(data) && data[i+length] == data[pos+length] {
+					length++
+				}
+				if length > expected {
+					expected = length
+				}
+			}
+			if expected < minMatchLength {
+				expected = 0
+			}
+
+			got := m.FindLongestMatch(data, pos)
+			if got.Length != expected {
+				t.Fatalf("pos %d: length %d, expected %d", pos, got.Length, expected)
+			}
+			if got.Length > 0 {
+				start := pos - got.Distance
+				for j := 0; j < got.Length; j++ {
+					if data[start+j] != data[pos+j] {
+						t.Fatalf("pos %d: invalid match at distance %d", pos, got.Distance)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOptimalMatcher_LongRun(t *testing.T) {
+	data := bytes.Repeat([]byte{'x'}, 100000)
+
+	encoder := NewEncoder(defaultWindowSize, defaultBufferSize)
+	encoder.optimal = true
+	encoded := encoder.Encode(data)
+
+	// 重なる一致により、ほぼすべてのトークンが最大長のマッチになる
+	if len(encoded) > len(data)/defaultBufferSize+2 {
+		t.Errorf("Expected about %d tokens, got %d", len(data)/(defaultBufferSize+1), len(encoded))
+	}
+	decoded, err := DecodeTokens(encoded)
+	if err != nil {
+		t.Fatalf("DecodeTokens failed: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Error("Round trip mismatch")
+	}
+}
+
+// varintCostModel は距離を可変長整数で符号化し、リテラルを1バイトとする形式を想定したコストです
+// 遠い距離の短いマッチはリテラルより大きくなります。
+type varintCostModel struct{}
+
+func (varintCostModel) MatchCost(distance, length int) int {
+	return 1 + len(binary.AppendUvarint(nil, uint64(distance))) + 1 + 1
+}
+
+func (varintCostModel) LiteralCost(byte) int {
+	return 1
+}
+
+// farShortMatch は位置 far から、距離 far・長さ3のマッチだけが見つかるデータを返します
+// 0xF1〜0xF4 は埋め草（0〜127）に現れないため、ほかの位置からのマッチは位置 far にかかりません。
+func farShortMatch(far int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	filler := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(rng.Intn(128))
+		}
+		return b
+	}
+
+	data := []byte{0xF1, 0xF2, 0xF3}
+	data = append(data, filler(far-3)...)
+	data = append(data, 0xF1, 0xF2, 0xF3, 0xF4)
+	return append(data, filler(16)...)
+}
+
+// tokenAt は入力の位置 pos から始まるトークンを返します
+func tokenAt(t *testing.T, tokens []Token, pos int) Token {
+	t.Helper()
+	at := 0
+	for _, token := range tokens {
+		if at == pos {
+			return token
+		}
+		if token.IsLiteral() {
+			at++
+		} else {
+			at += int(token.Length) + 1
+		}
+	}
+	t.Fatalf("No token starts at %d", pos)
+	return Token{}
+}
+
+func TestCostModel_FarShortMatch(t *testing.T) {
+	const far = 3000
+	data := farShortMatch(far)
+
+	tests := map[string]struct {
+		opts      []Option
+		wantMatch bool
+	}{
+		// 固定長の形式ではマッチ(5バイト)が4バイト分のリテラル(8バイト)より小さい
+		"token format":         {nil, true},
+		"token format optimal": {[]Option{WithOptimalMatcher()}, true},
+		// 可変長の距離では 1+2+1+1 = 5バイトで、4バイト分のリテラルより大きい
+		"varint":         {[]Option{WithCostModel(varintCostModel{})}, false},
+		"varint optimal": {[]Option{WithCostModel(varintCostModel{}), WithOptimalMatcher()}, false},
+	}
+	for name, tt := range tests {
+		compressor := NewCompressor(tt.opts...)
+		tokens := compressor.encoder.Encode(data)
+
+		token := tokenAt(t, tokens, far)
+		if tt.wantMatch && (token.IsLiteral() || token.Distance != far || token.Length != 3) {
+			t.Errorf("%s: expected match {%d 3}, got %+v", name, far, token)
+		}
+		if !tt.wantMatch && !token.IsLiteral() {
+			t.Errorf("%s: expected literal, got %+v", name, token)
+		}
+
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", name, err)
+		}
+		// コストモデルは形式を変えないため、デフォルトのCompressorで展開できる
+		decompressed, err := NewCompressor().Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", name, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestCostModel_DefaultKeepsOutput(t *testing.T) {
+	// デフォルトのモデルでは最小マッチ長以上のマッチは常に選ばれるため、明示しても出力は同じ
+	for _, sample := range testcorpus.Samples() {
+		withDefault, _ := NewCompressor().Compress(sample.Data)
+		withModel, _ := NewCompressor(WithCostModel(TokenCostModel{})).Compress(sample.Data)
+		if !bytes.Equal(withDefault, withModel) {
+			t.Errorf("%s: output differs with explicit TokenCostModel", sample.Name)
+		}
+	}
+
+	if cost := (TokenCostModel{}).MatchCost(minMatchLength, 1); cost >= (minMatchLength+1)*literalTokenSize {
+		t.Errorf("Expected the shortest match (%d bytes) to beat literals (%d bytes)", cost, (minMatchLength+1)*literalTokenSize)
+	}
+}
+
+func TestCostModel_NearMatchesStillUsed(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20)
+	compressor := NewCompressor(WithCostModel(varintCostModel{}))
+
+	matches := 0
+	for _, token := range compressor.encoder.Encode(data) {
+		if !token.IsLiteral() {
+			matches++
+		}
+	}
+	if matches == 0 {
+		t.Error("Expected long near matches to win under the varint cost model")
+	}
+
+	compressed, _ := compressor.Compress(data)
+	if decompressed, err := compressor.Decompress(compressed); err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+}
+
+func TestAnalyzeMatches(t *testing.T) {
+	// a〜f のリテラルの後に、距離6・長さ5のマッチ（次の文字 'f'）が1つ
+	stats := NewCompressor().AnalyzeMatches([]byte("abcdefabcdef"))
+	if stats.DataSize != 12 || stats.Literals != 6 || stats.Matches != 1 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if len(stats.LengthCounts) != defaultBufferSize+1 || stats.LengthCounts[5] != 1 {
+		t.Errorf("Expected one match of length 5 in %d length buckets, got %v", defaultBufferSize+1, stats.LengthCounts)
+	}
+	// 距離の区間は [1,1], [2,3], ..., [2048,4095], [4096,4096] の13個
+	bins := stats.DistanceBins
+	if len(bins) != 13 || bins[2] != (DistanceBin{Min: 4, Max: 7, Count: 1}) || bins[12] != (DistanceBin{Min: 4096, Max: 4096}) {
+		t.Errorf("Unexpected distance bins: %v", bins)
+	}
+
+	// 配列の長さは入力によらず同じ
+	data, err := json.Marshal(NewCompressor().AnalyzeMatches(nil))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var fields struct {
+		DataSize     *int             `json:"data_size"`
+		Literals     *int             `json:"literals"`
+		Matches      *int             `json:"matches"`
+		LengthCounts []int            `json:"length_counts"`
+		DistanceBins []map[string]int `json:"distance_bins"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if fields.DataSize == nil || fields.Literals == nil || fields.Matches == nil ||
+		len(fields.LengthCounts) != defaultBufferSize+1 || len(fields.DistanceBins) != 13 {
+		t.Errorf("Unexpected JSON schema: %s", data)
+	}
+	for _, key := range []string{"min", "max", "count"} {
+		if _, ok := fields.DistanceBins[0][key]; !ok {
+			t.Errorf("Expected distance bin field %q in %s", key, data)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "histogram,min,max,count" || len(lines) != 1+defaultBufferSize+1+13 ||
+		!slices.Contains(lines, "length,5,5,1") || !slices.Contains(lines, "distance,4,7,1") {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestAnalyzeMatches_Floor(t *testing.T) {
+	// 6つのリテラルと1つのマッチ: 種類は 6:1、バイトは a〜e が1回ずつと f が2回、
+	// マッチ長と距離の区間は1種類だけで、距離6は区間 [4,7] の中の2ビット
+	stats := NewCompressor().AnalyzeMatches([]byte("abcdefabcdef"))
+	wantBits := 6*math.Log2(7.0/6) + math.Log2(7) + 5*math.Log2(7) + 2*math.Log2(7.0/2) + 2
+	if math.Abs(stats.FloorSize-wantBits/8) > 1e-9 {
+		t.Errorf("Expected a floor of %f bytes, got %f", wantBits/8, stats.FloorSize)
+	}
+
+	// 周期的なデータは0次のエントロピーが高くても、トークン列の下限はずっと小さい
+	data := bytes.Repeat([]byte("abcdefg"), 1000)
+	order0 := common.OrderZeroFloor(data)
+	for _, c := range []*Compressor{NewCompressor(), NewCompressor(WithMaxMatchLength(len(data)))} {
+		floor := c.Floor(data)
+		if floor <= 0 || floor > order0/10 {
+			t.Errorf("Expected a floor far below the order-0 floor %f, got %f", order0, floor)
+		}
+		if compressed, _ := c.Compress(data); float64(len(compressed)) < floor {
+			t.Errorf("Expected the compressed size %d to be at least the floor %f", len(compressed), floor)
+		}
+	}
+	// 1つの長いマッチで表せる場合は、7つのリテラルとマッチの情報だけになる
+	if floor := NewCompressor(WithMaxMatchLength(len(data))).Floor(data); floor > 8 {
+		t.Errorf("Expected a floor of a few bytes with long matches, got %f", floor)
+	}
+}
+
+// TestAnalyzeMatches_MatchesTokens はマッチの統計が Compress のトークン列と一致することを確認します
+func TestAnalyzeMatches_MatchesTokens(t *testing.T) {
+	for _, sample := range testcorpus.Samples() {
+		for _, c := range []*Compressor{NewCompressor(), NewCompressor(WithOptimalMatcher())} {
+			stats := c.AnalyzeMatches(sample.Data)
+			tokens := c.encoder.Encode(sample.Data)
+			covered := stats.Literals
+			for length, count := range stats.LengthCounts {
+				covered += (length + 1) * count
+			}
+			if stats.Literals+stats.Matches != len(tokens) || covered != len(sample.Data) {
+				t.Errorf("%s: stats %+v do not match %d tokens", sample.Name, stats, len(tokens))
+			}
+		}
+	}
+}
+
+func TestWithTracer(t *testing.T) {
+	var events []StepEvent
+	tracer := common.TracerFunc(func(event any) { events = append(events, event.(StepEvent)) })
+	traced := NewCompressor().WithTracer(tracer)
+
+	data := []byte("abcdefabcdef")
+	compressed, err := traced.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := NewCompressor().Compress(data); !bytes.Equal(compressed, want) {
+		t.Errorf("Expected tracing not to change the output")
+	}
+
+	// 6つのリテラルの後に、距離6・長さ5のマッチと次の文字 'f'
+	if len(events) != 7 {
+		t.Fatalf("Expected 7 steps, got %d: %+v", len(events), events)
+	}
+	for i, e := range events[:6] {
+		if e.Position != i || !e.Token.IsLiteral() || e.Token.Literal != data[i] || e.WindowSize != i {
+			t.Errorf("Step %d: unexpected event %+v", i, e)
+		}
+	}
+	last := events[6]
+	want := StepEvent{
+		Position:   6,
+		WindowSize: 6,
+		WindowTail: "abcdef",
+		// 走査では6バイトの一致が見つかるが、最後の1バイトは次の文字として残す
+		Candidates: []MatchResult{{Distance: 6, Length: 6}},
+		Token:      NewMatchToken(6, 5, 'f'),
+	}
+	if !reflect.DeepEqual(last, want) {
+		t.Errorf("Expected %+v, got %+v", want, last)
+	}
+
+	// 辞書の中の位置は負の値になる
+	events = nil
+	NewCompressorWithDict([]byte("abcdef")).WithTracer(tracer).Compress([]byte("abcdefg"))
+	if len(events) != 1 || events[0].WindowStart != -6 || events[0].Token.Distance != 6 {
+		t.Errorf("Expected a single match into the dictionary, got %+v", events)
+	}
+}
+
+func BenchmarkCompressTracer(b *testing.B) {
+	data := testcorpus.Cycle(16 << 10)
+	for _, bc := range []struct {
+		name string
+		c    common.Compressor
+	}{
+		{"nil", NewCompressor()},
+		{"discard", NewCompressor().WithTracer(common.TracerFunc(func(any) {}))},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				bc.c.Compress(data)
+			}
+		})
+	}
+}
+
+// streamCorpus はウィンドウと Reader の履歴の上限を何度も超える長さのテストデータを返します
+func streamCorpus() []byte {
+	var data []byte
+	for i := range 10 {
+		data = append(data, "The quick brown fox jumps over the lazy dog. "...)
+		data = append(data, testcorpus.Random(500, int64(i))...)
+		data = append(data, testcorpus.Cycle(14000)...)
+	}
+	return data
+}
+
+// writeChunks は data を乱数の長さに分けて w に書き込みます
+func writeChunks(t *testing.T, w io.Writer, data []byte, rng *rand.Rand) {
+	t.Helper()
+	for len(data) > 0 {
+		n := min(rng.Intn(5000)+1, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		data = data[n:]
+	}
+}
+
+func TestWriter_MatchesCompress(t *testing.T) {
+	data := streamCorpus()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	writeChunks(t, w, data, rand.New(rand.NewSource(1)))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	tokens, err := NewDecoder().Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if want := EncodeTokens(data); !slices.Equal(tokens, want) {
+		t.Errorf("Writer tokens differ from EncodeTokens (%d vs %d tokens)", len(tokens), len(want))
+	}
+
+	got, err := NewCompressor().Decompress(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Decompress of Writer output does not match the input")
+	}
+
+	for name, src := range map[string]io.Reader{
+		"whole":    bytes.NewReader(buf.Bytes()),
+		"one-byte": iotest.OneByteReader(bytes.NewReader(buf.Bytes())),
+	} {
+		got, err := io.ReadAll(NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: Reader error: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: Reader output does not match the input", name)
+		}
+	}
+}
+
+func TestReader_CompressOutput(t *testing.T) {
+	for _, sample := range testcorpus.Samples() {
+		compressed, err := NewCompressor().Compress(sample.Data)
+		if err != nil {
+			t.Fatalf("%s: Compress error: %v", sample.Name, err)
+		}
+		got, err := io.ReadAll(NewReader(iotest.HalfReader(bytes.NewReader(compressed))))
+		if err != nil {
+			t.Fatalf("%s: Reader error: %v", sample.Name, err)
+		}
+		if !bytes.Equal(got, sample.Data) {
+			t.Errorf("%s: Reader output does not match the input", sample.Name)
+		}
+	}
+}
+
+func TestWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{emptyFlag}) {
+		t.Errorf("Expected the empty stream [%#x], got %x", emptyFlag, buf.Bytes())
+	}
+	if _, err := w.Write([]byte("a")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Second Close error: %v", err)
+	}
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected empty output, got %q, %v", got, err)
+	}
+}
+
+// flushRequests は Flush のテストでクライアントが1つずつ送るリクエストです
+var flushRequests = [][]byte{
+	[]byte("GET /metrics HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+	bytes.Repeat([]byte("cpu=0.25 mem=512 disk=0.75\n"), 200),
+	[]byte("ok"),
+}
+
+func TestWriter_FlushOverPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	received := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		r := NewReader(pr)
+		for _, req := range flushRequests {
+			buf := make([]byte, len(req))
+			if _, err := io.ReadFull(r, buf); err != nil {
+				errc <- err
+				return
+			}
+			received <- buf
+		}
+		rest, err := io.ReadAll(r)
+		if err == nil && len(rest) > 0 {
+			err = errors.New("unexpected data after the last request")
+		}
+		errc <- err
+	}()
+
+	// 次のリクエストは、相手が前のリクエストを展開し終えてから書き込む
+	w := NewWriter(pw)
+	for i, req := range flushRequests {
+		if _, err := w.Write(req); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush error: %v", err)
+		}
+		select {
+		case got := <-received:
+			if !bytes.Equal(got, req) {
+				t.Errorf("Request %d decoded as %q", i, got)
+			}
+		case err := <-errc:
+			t.Fatalf("Reader error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Request %d was not decoded after Flush", i)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	pw.Close()
+	if err := <-errc; err != nil {
+		t.Errorf("Reader error at the end of the stream: %v", err)
+	}
+}
+
+func TestWriter_FlushSyncMarker(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	// 何もないときの Flush も同期マーカーを書き込む
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{syncFlag}) {
+		t.Errorf("Expected only the sync marker, got %x", buf.Bytes())
+	}
+	var want []byte
+	for _, req := range flushRequests {
+		want = append(want, req...)
+		w.Write(req)
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush error: %v", err)
+		}
+	}
+	w.Write(flushRequests[1])
+	want = append(want, flushRequests[1]...)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte{syncFlag}); n < len(flushRequests)+1 {
+		t.Errorf("Expected at least %d sync markers, found %d", len(flushRequests)+1, n)
+	}
+
+	got, err := NewCompressor().Decompress(buf.Bytes())
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Decompress of flushed stream failed (err %v)", err)
+	}
+	got, err = io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(buf.Bytes()))))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Reader of flushed stream failed (err %v)", err)
+	}
+
+	// 同期マーカーだけのストリームは空のデータ
+	for _, data := range [][]byte{{syncFlag}, {syncFlag, syncFlag}} {
+		if got, err := NewCompressor().Decompress(data); err != nil || len(got) != 0 {
+			t.Errorf("Decompress(%x) = %q, %v, want empty", data, got, err)
+		}
+		if got, err := io.ReadAll(NewReader(bytes.NewReader(data))); err != nil || len(got) != 0 {
+			t.Errorf("Reader(%x) = %q, %v, want empty", data, got, err)
+		}
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(bytes.Repeat([]byte("abcdefgh"), 100))
+	w.Close()
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"unknown flag", append(append([]byte{}, valid...), 7, 0)},
+		{"empty flag mid-stream", append(append([]byte{}, valid...), emptyFlag)},
+		{"distance beyond history", []byte{literalFlag, 'a', matchFlag, 0, 5, 3, 'b'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(tt.data))))
+			if !errors.Is(err, common.ErrInvalidData) {
+				t.Errorf("Expected ErrInvalidData, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWriter_ResumeState(t *testing.T) {
+	data := streamCorpus()
+	want := EncodeTokens(data)
+
+	for _, split := range []int{0, 1, 17, 4096, 50000, len(data) - 1, len(data)} {
+		// 前半を書き込んで状態を保存し、別の Writer で同じ出力の続きを書き込む
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		writeChunks(t, w, data[:split], rand.New(rand.NewSource(int64(split))))
+		state, err := w.SaveState()
+		if err != nil {
+			t.Fatalf("split %d: SaveState error: %v", split, err)
+		}
+
+		resumed, err := ResumeWriter(&buf, state)
+		if err != nil {
+			t.Fatalf("split %d: ResumeWriter error: %v", split, err)
+		}
+		writeChunks(t, resumed, data[split:], rand.New(rand.NewSource(int64(split)+1)))
+		if err := resumed.Close(); err != nil {
+			t.Fatalf("split %d: Close error: %v", split, err)
+		}
+
+		tokens, err := NewDecoder().Decode(buf.Bytes())
+		if err != nil {
+			t.Fatalf("split %d: Decode error: %v", split, err)
+		}
+		if !slices.Equal(tokens, want) {
+			t.Errorf("split %d: resumed tokens differ from one-shot encoding", split)
+		}
+		got, err := NewCompressor().Decompress(buf.Bytes())
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("split %d: Decompress mismatch (err %v)", split, err)
+		}
+	}
+}
+
+func TestReader_ResumeState(t *testing.T) {
+	data := streamCorpus()
+	compressed, err := NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+
+	for _, split := range []int{0, 1, 1000, 135000, len(data)} {
+		src := iotest.HalfReader(bytes.NewReader(compressed))
+		r := NewReader(src)
+		first := make([]byte, split)
+		if _, err := io.ReadFull(r, first); err != nil {
+			t.Fatalf("split %d: Read error: %v", split, err)
+		}
+		state, err := r.SaveState()
+		if err != nil {
+			t.Fatalf("split %d: SaveState error: %v", split, err)
+		}
+
+		// 保存した Reader が読み込んだ位置の続きから、別の Reader で展開する
+		resumed, err := ResumeReader(src, state)
+		if err != nil {
+			t.Fatalf("split %d: ResumeReader error: %v", split, err)
+		}
+		rest, err := io.ReadAll(resumed)
+		if err != nil {
+			t.Fatalf("split %d: resumed Read error: %v", split, err)
+		}
+		if got := append(first, rest...); !bytes.Equal(got, data) {
+			t.Errorf("split %d: resumed output does not match the input (%d vs %d bytes)", split, len(got), len(data))
+		}
+	}
+}
+
+// ringTokens はウィンドウ window の圧縮データで、リングバッファの折り返しをまたぐ
+// マッチ（ウィンドウいっぱいの距離、距離より長いマッチを含む）が多いトークン列を返します
+func ringTokens(window, count int, rng *rand.Rand) []Token {
+	tokens := []Token{NewLiteralToken('a')}
+	total := 1
+	for range count {
+		switch {
+		case rng.Intn(4) == 0:
+			tokens = append(tokens, NewLiteralToken(byte(rng.Intn(256))))
+			total++
+		default:
+			distance := rng.Intn(min(total, window)) + 1
+			if rng.Intn(3) == 0 {
+				distance = min(total, window)
+			}
+			length := rng.Intn(3 * window)
+			tokens = append(tokens, NewMatchToken(uint16(distance), uint32(length), byte(rng.Intn(256))))
+			total += length + 1
+		}
+	}
+	return tokens
+}
+
+func TestReader_RingMatchesDecompress(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for _, window := range []int{1, 7, 64, 1000, maxDistance} {
+		data := append(appendWindow(nil, window), TokensToBytes(ringTokens(window, 500, rng))...)
+		want, err := NewCompressor().Decompress(data)
+		if err != nil {
+			t.Fatalf("window %d: Decompress error: %v", window, err)
+		}
+
+		// 入力を1バイトずつ与え、出力は折り返しの位置とずれる長さで読む
+		for _, size := range []int{1, 5, window - 1, window + 3, 1 << 16} {
+			if size <= 0 {
+				continue
+			}
+			r := NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+			var got []byte
+			buf := make([]byte, size)
+			for {
+				n, err := r.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("window %d, size %d: Read error: %v", window, size, err)
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("window %d, size %d: Reader output differs from Decompress (%d vs %d bytes)", window, size, len(got), len(want))
+			}
+		}
+
+		// 長いマッチの途中で状態を保存しても、続きを展開できる
+		r := NewReader(bytes.NewReader(data))
+		first := make([]byte, len(want)/2)
+		if _, err := io.ReadFull(r, first); err != nil {
+			t.Fatalf("window %d: Read error: %v", window, err)
+		}
+		state, err := r.SaveState()
+		if err != nil {
+			t.Fatalf("window %d: SaveState error: %v", window, err)
+		}
+		resumed, err := ResumeReader(bytes.NewReader(data[len(data):]), state)
+		if err != nil {
+			t.Fatalf("window %d: ResumeReader error: %v", window, err)
+		}
+		rest, err := io.ReadAll(resumed)
+		if err != nil || !bytes.Equal(append(first, rest...), want) {
+			t.Errorf("window %d: resumed output differs from Decompress (err %v)", window, err)
+		}
+	}
+}
+
+// repeatReader は prefix の後に unit を count 回繰り返して返します
+type repeatReader struct {
+	prefix, unit []byte
+	count        int
+	pos          int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.prefix) > 0 {
+			k := copy(p[n:], r.prefix)
+			r.prefix = r.prefix[k:]
+			n += k
+			continue
+		}
+		if r.count == 0 {
+			break
+		}
+		k := copy(p[n:], r.unit[r.pos:])
+		n += k
+		if r.pos += k; r.pos == len(r.unit) {
+			r.pos = 0
+			r.count--
+		}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// heapSampler は書き込まれたバイト数を数え、一定量ごとにヒープの使用量を記録します
+type heapSampler struct {
+	written, next int64
+	maxHeap       uint64
+}
+
+func (h *heapSampler) Write(p []byte) (int, error) {
+	h.written += int64(len(p))
+	if h.written >= h.next {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		h.maxHeap = max(h.maxHeap, m.HeapAlloc)
+		h.next = h.written + 8<<20
+	}
+	return len(p), nil
+}
+
+func TestReader_ConstantMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping 200MB stream in short mode")
+	}
+
+	// 4KBのウィンドウのストリームで、1つのマッチが10万バイトを超える200MBの出力
+	const window, matchLength, outputSize = 4096, 100000, 200 << 20
+	prefix := appendWindow(nil, window)
+	prefix = append(prefix, TokensToBytes(ringTokens(window, 200, rand.New(rand.NewSource(1))))...)
+	unit := NewMatchToken(window-5, matchLength, 'z').appendBinary(nil)
+	unit = NewMatchToken(3, matchLength/2, 'y').appendBinary(unit)
+	count := outputSize / (matchLength*3/2 + 2)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	sink := &heapSampler{}
+	n, err := io.Copy(sink, NewReader(&repeatReader{prefix: prefix, unit: unit, count: count}))
+	if err != nil {
+		t.Fatalf("Reader error: %v", err)
+	}
+	if n < outputSize*9/10 {
+		t.Fatalf("Decompressed %d bytes, want about %d", n, outputSize)
+	}
+	if growth := int64(sink.maxHeap) - int64(before.HeapAlloc); growth > 4<<20 {
+		t.Errorf("Heap grew by %d bytes while streaming %d bytes, want a few MB at most", growth, n)
+	}
+}
+
+func TestResumeState_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(streamCorpus()[:10000])
+	state, err := w.SaveState()
+	if err != nil {
+		t.Fatalf("SaveState error: %v", err)
+	}
+	readerState, err := NewReader(bytes.NewReader(buf.Bytes())).SaveState()
+	if err != nil {
+		t.Fatalf("Reader SaveState error: %v", err)
+	}
+
+	// reseal は状態を書き換えてから CRC を付け直します
+	reseal := func(edit func([]byte)) []byte {
+		s := append([]byte{}, state[:len(state)-4]...)
+		edit(s)
+		return binary.BigEndian.AppendUint32(s, crc32.ChecksumIEEE(s))
+	}
+	flipped := append([]byte{}, state...)
+	flipped[len(flipped)/2] ^= 0x01
+
+	tests := []struct {
+		name  string
+		state []byte
+	}{
+		{"flipped byte", flipped},
+		{"truncated", state[:len(state)-5]},
+		{"empty", nil},
+		{"bad magic", reseal(func(s []byte) { s[0] = 'X' })},
+		{"reader state", readerState},
+		{"version 0", reseal(func(s []byte) { s[len(stateMagic)] = 0 })},
+		{"other window", reseal(func(s []byte) { s[len(stateMagic)+2] = 0x10 })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResumeWriter(io.Discard, tt.state); !errors.Is(err, common.ErrInvalidData) {
+				t.Errorf("Expected ErrInvalidData, got %v", err)
+			}
+		})
+	}
+
+	newer := reseal(func(s []byte) { s[len(stateMagic)] = StateVersion + 1 })
+	var unsupported *common.ErrUnsupportedVersion
+	if _, err := ResumeWriter(io.Discard, newer); !errors.As(err, &unsupported) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := ResumeReader(bytes.NewReader(nil), state); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for a writer state, got %v", err)
+	}
+}
+
+// bruteForceMatches は chunk の先頭と minLen バイト以上一致する ref の位置を、後方距離の短い順に返します
+func bruteForceMatches(ref, chunk []byte, minLen int) []MatchResult {
+	var matches []MatchResult
+	for pos := len(ref) - 1; pos >= 0; pos-- {
+		length := 0
+		for pos+length < len(ref) && length < len(chunk) && ref[pos+length] == chunk[length] {
+			length++
+		}
+		if length >= minLen {
+			matches = append(matches, MatchResult{Distance: len(ref) - pos, Length: length})
+		}
+	}
+	return matches
+}
+
+func TestIndex_MatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// 4種類のバイトだけの参照データでは一致が多く、ハッシュチェーンが長くなる
+	ref := make([]byte, 3000)
+	for i := range ref {
+		ref[i] = "acgt"[rng.Intn(4)]
+	}
+	idx := NewIndex(ref)
+
+	for i := range 500 {
+		var chunk []byte
+		switch i % 3 {
+		case 0: // 参照データの一部
+			start := rng.Intn(len(ref))
+			chunk = append(chunk, ref[start:min(start+rng.Intn(40), len(ref))]...)
+		case 1: // 参照データの一部を途中で書き換えたもの
+			start := rng.Intn(len(ref) - 40)
+			chunk = append(chunk, ref[start:start+40]...)
+			chunk[rng.Intn(40)] = 'x'
+		default: // ランダム
+			for range rng.Intn(20) {
+				chunk = append(chunk, "acgt"[rng.Intn(4)])
+			}
+		}
+		minLen := rng.Intn(8)
+
+		want := bruteForceMatches(ref, chunk, max(minLen, minMatchLength))
+		if got := idx.FindAll(chunk, minLen); !slices.Equal(got, want) {
+			t.Fatalf("FindAll(%q, %d): got %d matches, want %d", chunk, minLen, len(got), len(want))
+		}
+
+		var best MatchResult
+		for _, m := range bruteForceMatches(ref, chunk, minMatchLength) {
+			if m.Length > best.Length {
+				best = m
+			}
+		}
+		if got := idx.Find(chunk); got != best {
+			t.Fatalf("Find(%q) = %+v, want %+v", chunk, got, best)
+		}
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	ref := []byte("hello world, hello there")
+	tests := []struct {
+		chunk []byte
+		want  MatchResult
+	}{
+		{[]byte("world!"), MatchResult{Distance: 18, Length: 5}},
+		{[]byte("hello"), MatchResult{Distance: 11, Length: 5}}, // 同じ長さなら後ろの一致
+		{[]byte("hello w"), MatchResult{Distance: 24, Length: 7}},
+		{[]byte("xyz"), MatchResult{}},
+		{[]byte("he"), MatchResult{}}, // minMatchLength 未満は探さない
+		{nil, MatchResult{}},
+	}
+	for _, tt := range tests {
+		got := BestMatch(ref, tt.chunk)
+		if got != tt.want {
+			t.Errorf("BestMatch(%q) = %+v, want %+v", tt.chunk, got, tt.want)
+		}
+		if got.Length > 0 {
+			if offset := len(ref) - got.Distance; !bytes.HasPrefix(ref[offset:], tt.chunk[:got.Length]) {
+				t.Errorf("BestMatch(%q): ref[%d:] does not start with the match", tt.chunk, offset)
+			}
+		}
+	}
+
+	if got := FindAllMatches(ref, []byte("hello"), 5); len(got) != 2 || got[0].Distance != 11 || got[1].Distance != 24 {
+		t.Errorf("Unexpected matches %+v", got)
+	}
+	if got := FindAllMatches([]byte("ab"), []byte("ab"), 1); got != nil {
+		t.Errorf("Expected no matches in a reference shorter than minMatchLength, got %+v", got)
+	}
+}
+
+// indexBenchData は索引のベンチマーク用の参照データと、それに似たブロックを返します
+func indexBenchData() (ref []byte, chunks [][]byte) {
+	rng := rand.New(rand.NewSource(1))
+	ref = bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1500)
+	for range 1000 {
+		start := rng.Intn(len(ref) - 64)
+		chunk := append([]byte{}, ref[start:start+64]...)
+		chunk[rng.Intn(64)] ^= 0x20
+		chunks = append(chunks, chunk)
+	}
+	return ref, chunks
+}
+
+func BenchmarkIndexReuse(b *testing.B) {
+	ref, chunks := indexBenchData()
+	b.ResetTimer()
+	for range b.N {
+		idx := NewIndex(ref)
+		for _, chunk := range chunks {
+			idx.Find(chunk)
+		}
+	}
+}
+
+func BenchmarkIndexRebuild(b *testing.B) {
+	ref, chunks := indexBenchData()
+	b.ResetTimer()
+	for range b.N {
+		for _, chunk := range chunks {
+			BestMatch(ref, chunk)
+		}
+	}
+}
+
+// englishText は英文に似た単語の並びを生成します（seed が同じなら同じ結果）
+func englishText(words int, seed int64) []byte {
+	vocabulary := strings.Fields("the of and to in is that it was for on are with as his they be at one have " +
+		"this from or had by word but what some we can out other were all there when up use your how said " +
+		"compression algorithm data stream window literal match distance entropy huffman")
+	rng := rand.New(rand.NewSource(seed))
+
+	var sb strings.Builder
+	for i := range words {
+		word := vocabulary[rng.Intn(len(vocabulary))]
+		if i%12 == 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		sb.WriteString(word)
+		if i%12 == 11 {
+			sb.WriteString(". ")
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	return []byte(sb.String())
+}
+
+func TestCompressorEntropyLiterals_RoundTrip(t *testing.T) {
+	c := NewCompressorEntropyLiterals()
+	if name := c.Name(); name != "LZ77 (Huffman literals)" {
+		t.Errorf("Unexpected name %q", name)
+	}
+	inputs := map[string][]byte{"english": englishText(3000, 1)}
+	for _, s := range testcorpus.Samples() {
+		inputs[s.Name] = s.Data
+	}
+	for name, data := range inputs {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", name, err)
+		}
+		got, err := c.Decompress(compressed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: round trip failed (err %v)", name, err)
+		}
+		// 通常の lz77 と同じトークン列を、別の形式で格納する
+		tokens, err := decodeTwoStream(compressed, common.DecompressOptions{})
+		if err != nil || !slices.Equal(tokens, EncodeTokens(data)) {
+			t.Errorf("%s: two-stream tokens differ from lz77 (err %v)", name, err)
+		}
+	}
+
+	// 辞書を追加しても2ストリーム形式のまま
+	dict := englishText(500, 2)
+	withDict := c.WithDict(dict)
+	data := englishText(100, 3)
+	compressed, _ := withDict.Compress(data)
+	if got, err := withDict.Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Round trip with dictionary failed (err %v)", err)
+	}
+	if _, err := decodeTwoStream(compressed, common.DecompressOptions{}); err != nil {
+		t.Errorf("Expected the two-stream format with a dictionary: %v", err)
+	}
+}
+
+func TestCompressorEntropyLiterals_SmallerThanLZ77(t *testing.T) {
+	data := englishText(20000, 1)
+	plain, _ := NewCompressor().Compress(data)
+	entropy, _ := NewCompressorEntropyLiterals().Compress(data)
+	full, _ := stdcompat.NewGzip().Compress(data)
+
+	t.Logf("english %d bytes: lz77 %d, lz77h %d, gzip %d", len(data), len(plain), len(entropy), len(full))
+	if len(entropy) >= len(plain) {
+		t.Errorf("Expected lz77h (%d bytes) to be smaller than lz77 (%d bytes)", len(entropy), len(plain))
+	}
+	if len(full) >= len(entropy) {
+		t.Errorf("Expected gzip (%d bytes) to be smaller than lz77h (%d bytes)", len(full), len(entropy))
+	}
+}
+
+func TestCompressorEntropyLiterals_Invalid(t *testing.T) {
+	c := NewCompressorEntropyLiterals()
+	data := englishText(300, 4)
+	compressed, _ := c.Compress(data)
+
+	for n := range len(compressed) {
+		if _, err := c.Decompress(compressed[:n]); err == nil {
+			t.Fatalf("Truncated data of %d bytes was accepted", n)
+		}
+	}
+	if _, err := c.Decompress(append(bytes.Clone(compressed), 0)); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for trailing bytes, got %v", err)
+	}
+	// 巨大なトークン数は展開前に拒否する
+	if _, err := c.Decompress(binary.AppendUvarint(nil, 1<<40)); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for a huge token count, got %v", err)
+	}
+	if _, err := c.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 100}); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+func TestWithTimings(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 200)
+	for _, c := range []*Compressor{NewCompressor(), NewCompressorEntropyLiterals()} {
+		timings := common.NewTimings()
+		start := time.Now()
+		compressed, err := c.WithTimings(timings).Compress(data)
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := c.Compress(data); !bytes.Equal(compressed, want) {
+			t.Errorf("%s: Expected timing not to change the output", c.Name())
+		}
+
+		// 記録するフェーズがすべてあり、合計は呼び出し全体の時間以下になる
+		if got := timings.Phases(); !slices.Equal(got, []string{PhaseMatch, PhaseSerialize}) {
+			t.Errorf("%s: Expected match and serialize phases, got %v", c.Name(), got)
+		}
+		if sum := timings.Get(PhaseMatch) + timings.Get(PhaseSerialize); sum <= 0 || sum > elapsed {
+			t.Errorf("%s: Expected phases to sum to at most %v, got %v", c.Name(), elapsed, sum)
+		}
+	}
+}
+
+func TestAutoWindow_CloseToBetterFixedWindow(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 24<<10)
+	rng.Read(random)
+	block := make([]byte, 2<<10)
+	rng.Read(block)
+	repetitive := bytes.Repeat(block, 40) // 512バイトのウィンドウには届かない周期の繰り返し
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantWindow int
+	}{
+		{"random", random, autoStartWindow},
+		{"repetitive", repetitive, len(block)},
+	}
+	for _, tt := range tests {
+		small, _ := NewCompressor(WithWindowSize(512)).Compress(tt.data)
+		large, _ := NewCompressor(WithWindowSize(32 << 10)).Compress(tt.data)
+		auto, err := NewCompressor(WithWindowSize(32<<10), WithAutoWindow()).Compress(tt.data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", tt.name, err)
+		}
+		best := min(len(small), len(large))
+		if len(auto) > best+best*3/100 {
+			t.Errorf("%s: auto window gave %d bytes, fixed 512: %d, fixed 32K: %d", tt.name, len(auto), len(small), len(large))
+		}
+		if window, _, _ := parseWindow(auto); window != tt.wantWindow {
+			t.Errorf("%s: expected window %d, got %d", tt.name, tt.wantWindow, window)
+		}
+
+		// 通常の Compressor でも Reader でも展開できる
+		decompressed, err := NewCompressor().Decompress(auto)
+		if err != nil || !bytes.Equal(decompressed, tt.data) {
+			t.Fatalf("%s: round trip failed: %v", tt.name, err)
+		}
+		streamed, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(auto))))
+		if err != nil || !bytes.Equal(streamed, tt.data) {
+			t.Fatalf("%s: Reader round trip failed: %v", tt.name, err)
+		}
+	}
+}
+
+func TestAutoWindow_Empty(t *testing.T) {
+	compressed, err := NewCompressor(WithAutoWindow()).Compress(nil)
+	if err != nil || !bytes.Equal(compressed, []byte{emptyFlag}) {
+		t.Fatalf("Expected the empty marker, got %v, %v", compressed, err)
+	}
+}
+
+func TestAutoWindow_StrictPolicy(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefgh"), 100)
+	if _, err := NewCompressor(WithAutoWindow()).WithPolicy(common.Policy{}).Compress(data); err != nil {
+		t.Fatalf("Compress failed without Strict: %v", err)
+	}
+
+	// Strict ではウィンドウを自動で選ばずにエラーにし、固定のウィンドウはそのまま使える
+	_, err := NewCompressor(WithAutoWindow()).WithPolicy(common.Policy{Strict: true}).Compress(data)
+	if !errors.Is(err, common.ErrStrict) || !strings.Contains(err.Error(), "WithWindowSize") {
+		t.Errorf("Expected a strict error naming WithWindowSize, got %v", err)
+	}
+	if _, err := NewCompressor(WithWindowSize(8192)).WithPolicy(common.Policy{Strict: true}).Compress(data); err != nil {
+		t.Errorf("Fixed window failed in strict mode: %v", err)
+	}
+}
+
+func TestAutoWindow_DistanceBeyondWindow(t *testing.T) {
+	var tokens []Token
+	for i := range 20 {
+		tokens = append(tokens, NewLiteralToken(byte('a'+i)))
+	}
+	tokens = append(tokens, NewMatchToken(18, 3, 'x'))
+
+	tests := map[string][]byte{
+		"distance":      append(appendWindow(nil, 16), TokensToBytes(tokens)...),
+		"zero window":   append(appendWindow(nil, 0), TokensToBytes(tokens)...),
+		"only window":   appendWindow(nil, 16),
+		"window inside": append(TokensToBytes(tokens[:3]), appendWindow(nil, 16)...),
+	}
+	for name, data := range tests {
+		if _, err := NewCompressor().Decompress(data); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: Decompress: expected ErrInvalidData, got %v", name, err)
+		}
+		if _, err := io.ReadAll(NewReader(bytes.NewReader(data))); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("%s: Reader: expected ErrInvalidData, got %v", name, err)
+		}
+	}
+
+	// ウィンドウ内の距離なら展開できる
+	data := append(appendWindow(nil, 18), TokensToBytes(tokens)...)
+	if _, err := NewCompressor().Decompress(data); err != nil {
+		t.Errorf("Expected a match within the window to decode, got %v", err)
+	}
+}
+
+// repeatedParagraphs は distinct 種類の500バイトの段落を n 個、ランダムな順に並べます
+func repeatedParagraphs(n, distinct int, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	words := []string{"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "window", "lookahead", "match"}
+	paragraphs := make([][]byte, distinct)
+	for i := range paragraphs {
+		var buf bytes.Buffer
+		for buf.Len() < 500 {
+			buf.WriteString(words[rng.Intn(len(words))])
+			buf.WriteByte(" .\n"[rng.Intn(3)])
+		}
+		paragraphs[i] = buf.Bytes()[:500]
+	}
+	var data []byte
+	for range n {
+		data = append(data, paragraphs[rng.Intn(distinct)]...)
+	}
+	return data
+}
+
+func TestAdaptiveLookahead_RepeatedParagraphs(t *testing.T) {
+	data := repeatedParagraphs(200, 6, 1)
+	sizes := map[string]int{}
+	for name, c := range map[string]*Compressor{
+		"default":  NewCompressor(),
+		"fixed":    NewCompressor(WithMaxMatchLength(1024)),
+		"adaptive": NewCompressor(WithAdaptiveLookahead()),
+	} {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", name, err)
+		}
+		// 展開側は先読みを知らなくてよい
+		if got, err := NewCompressor().Decompress(compressed); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: round trip failed (err %v)", name, err)
+		}
+		sizes[name] = len(compressed)
+	}
+	t.Logf("default %d, fixed 1024 %d, adaptive %d bytes", sizes["default"], sizes["fixed"], sizes["adaptive"])
+	if float64(sizes["adaptive"]) > float64(sizes["fixed"])*1.10 {
+		t.Errorf("Adaptive lookahead %d bytes is not within 10%% of fixed lookahead %d bytes", sizes["adaptive"], sizes["fixed"])
+	}
+	if sizes["adaptive"]*2 > sizes["default"] {
+		t.Errorf("Adaptive lookahead %d bytes is not much smaller than default %d bytes", sizes["adaptive"], sizes["default"])
+	}
+
+	// 先読みの18バイトではほとんどのマッチが打ち切られ、適応的な先読みでは少なくなる
+	def := NewCompressor().AnalyzeMatches(data)
+	adaptive := NewCompressor(WithAdaptiveLookahead()).AnalyzeMatches(data)
+	if def.TruncatedRatio() < 0.5 || def.MaxLookahead != defaultBufferSize {
+		t.Errorf("Default: %.0f%% truncated, lookahead %d", def.TruncatedRatio()*100, def.MaxLookahead)
+	}
+	if adaptive.TruncatedRatio() > def.TruncatedRatio()/2 || adaptive.MaxLookahead < 500 {
+		t.Errorf("Adaptive: %.0f%% truncated, max lookahead %d", adaptive.TruncatedRatio()*100, adaptive.MaxLookahead)
+	}
+}
+
+func TestAdaptiveLookahead_RandomData(t *testing.T) {
+	data := make([]byte, 16<<10)
+	rand.New(rand.NewSource(2)).Read(data)
+	for _, opts := range [][]Option{nil, {WithAutoWindow()}} {
+		want, _ := NewCompressor(opts...).Compress(data)
+		got, _ := NewCompressor(append(opts, WithAdaptiveLookahead())...).Compress(data)
+		// 長いマッチがなければ先読みは変わらず、出力もデフォルトと同じ
+		if !bytes.Equal(got, want) {
+			t.Errorf("Adaptive lookahead changed the output on random data (%d options)", len(opts))
+		}
+	}
+	if s := NewCompressor(WithAdaptiveLookahead()).AnalyzeMatches(data); s.MaxLookahead != defaultBufferSize {
+		t.Errorf("MaxLookahead = %d on random data, want %d", s.MaxLookahead, defaultBufferSize)
+	}
+}
+
+func TestAdaptiveLookahead_Shrinks(t *testing.T) {
+	// 長い繰り返しの後に短い一致しかないデータが続くと、先読みは元の長さに戻る
+	data := repeatedParagraphs(40, 2, 3)
+	text := make([]byte, 64<<10)
+	rng := rand.New(rand.NewSource(4))
+	for i := range text {
+		text[i] = "abcdefgh"[rng.Intn(8)]
+	}
+	data = append(data, text...)
+
+	m := newLookaheadMatcher(NewMatcher(defaultWindowSize, defaultBufferSize))
+	grown := 0
+	for pos := 0; pos < len(data); {
+		match := m.FindLongestMatch(data, pos)
+		grown = max(grown, m.lookahead())
+		pos += max(match.Length, 1)
+	}
+	if grown < 500 {
+		t.Errorf("Lookahead grew only to %d on repeated paragraphs", grown)
+	}
+	if m.lookahead() != defaultBufferSize {
+		t.Errorf("Lookahead = %d after the repeats ended, want %d", m.lookahead(), defaultBufferSize)
+	}
+}
+
+func TestFprintMatchStats_Golden(t *testing.T) {
+	var out bytes.Buffer
+	for _, c := range []*Compressor{NewCompressor(), NewCompressor(WithAdaptiveLookahead())} {
+		for _, data := range [][]byte{nil, []byte("abcabcabcabcabc-xyz"), repeatedParagraphs(20, 2, 5)} {
+			FprintMatchStats(&out, c.AnalyzeMatches(data))
+		}
+	}
+	golden.Check(t, "match_stats", out.Bytes())
+}
+
+func BenchmarkAdaptiveLookahead(b *testing.B) {
+	random := make([]byte, 256<<10)
+	rand.New(rand.NewSource(6)).Read(random)
+	inputs := []struct {
+		name string
+		data []byte
+	}{
+		{"random", random},
+		{"paragraphs", repeatedParagraphs(512, 6, 7)},
+	}
+	for _, in := range inputs {
+		for _, mode := range []struct {
+			name string
+			opts []Option
+		}{
+			{"default", nil},
+			{"adaptive", []Option{WithAdaptiveLookahead()}},
+		} {
+			c := NewCompressor(mode.opts...)
+			b.Run(in.name+"/"+mode.name, func(b *testing.B) {
+				b.SetBytes(int64(len(in.data)))
+				for b.Loop() {
+					if _, err := c.Compress(in.data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package lz77
 
+// minMatchLength は最小マッチ長です（これより短い一致はリテラルの方が小さい）
+const minMatchLength = 3
+
 // MatchResult はマッチング結果を表します
 type MatchResult struct {
-	Distance int
-	Length   int
+	Distance int `json:"distance"`
+	Length   int `json:"length"`
 }
 
 // Matcher はLZ77のマッチング処理を担当します
+// 検索は data とパラメータだけに依存するため、同時に呼び出しても安全です
 type Matcher struct {
 	windowSize int
 	bufferSize int
@@ -22,43 +26,56 @@ func NewMatcher(windowSize, bufferSize int) *Matcher {
 
 // FindLongestMatch は最長一致を検索します
 func (m *Matcher) FindLongestMatch(data []byte, pos int) MatchResult {
+	best, _ := m.search(data, pos, m.windowSize, m.windowSize)
+	return best
+}
+
+// lookahead は先読みの長さを返します
+func (m *Matcher) lookahead() int {
+	return m.bufferSize
+}
+
+// search は pos の前 window バイトから最長一致を検索します
+// near は window 以下の小さなウィンドウで、その範囲での最長一致も nearBest に返します。
+// 1回の走査で両方のウィンドウの結果が分かるため、自動ウィンドウの判断に使います。
+func (m *Matcher) search(data []byte, pos, window, near int) (best, nearBest MatchResult) {
 	if pos == 0 {
-		return MatchResult{Distance: 0, Length: 0}
+		return MatchResult{}, MatchResult{}
 	}
 
-	maxLength := 0
-	bestDistance := 0
-
 	// 検索開始位置を決定
-	start := pos - m.windowSize
-	if start < 0 {
-		start = 0
-	}
+	start := max(pos-window, 0)
+	nearStart := max(pos-near, 0)
 
 	// 先読みバッファの最大長を決定
-	maxLookahead := len(data) - pos
-	if maxLookahead > m.bufferSize {
-		maxLookahead = m.bufferSize
-	}
+	maxLookahead := min(len(data)-pos, m.bufferSize)
 
-	// 検索ウィンドウ内で一致を探す
-	for i := start; i < pos; i++ {
+	// 検索ウィンドウ内で一致を探す（同じ長さなら近い方を優先するため後ろから走査）
+	// 先読みの最後まで一致すればそれより長い一致はないため、残りの候補は調べない
+	crossed := false
+	for i := pos - 1; i >= start && best.Length < maxLookahead; i-- {
+		if i < nearStart && !crossed {
+			nearBest, crossed = best, true
+		}
 		matchLength := m.calculateMatchLength(data, i, pos, maxLookahead)
 
-		// より長い一致が見つかった場合は更新（最小マッチ長は3）
-		if matchLength > maxLength && matchLength >= 3 {
-			maxLength = matchLength
-			bestDistance = pos - i
+		// より長い一致が見つかった場合は更新
+		if matchLength > best.Length && matchLength >= minMatchLength {
+			best = MatchResult{Distance: pos - i, Length: matchLength}
 		}
 	}
-
-	return MatchResult{Distance: bestDistance, Length: maxLength}
+	if !crossed {
+		nearBest = best
+	}
+	return best, nearBest
 }
 
 // calculateMatchLength は指定された位置からのマッチ長を計算します
+// 一致は現在位置に重なってもよく（距離がマッチ長より短い）、7バイトの繰り返しのような
+// データは距離7の1つのマッチになります。デコーダーは1バイトずつコピーするため正しく展開できます。
 func (m *Matcher) calculateMatchLength(data []byte, start, pos, maxLength int) int {
 	length := 0
-	for j := 0; j < maxLength && start+j < pos && data[start+j] == data[pos+j]; j++ {
+	for j := 0; j < maxLength && data[start+j] == data[pos+j]; j++ {
 		length++
 	}
 	return length
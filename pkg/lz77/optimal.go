@@ -0,0 +1,97 @@
+package lz77
+
+import "github.com/sasakihasuto/tinyzipzap/pkg/suffix"
+
+// matchFinder は位置ごとの最長一致を検索します
+type matchFinder interface {
+	FindLongestMatch(data []byte, pos int) MatchResult
+	// lookahead は直前の FindLongestMatch の先読み（マッチ長の上限）です
+	lookahead() int
+}
+
+// optimalMatcher は接尾辞配列を使って、ウィンドウ内の本当の最長一致を検索します
+// Matcher と異なり、現在位置に重なる一致（距離がマッチ長より短い一致）も見つけます。
+// デコーダーは1バイトずつコピーするため、重なる一致も正しく展開できます。
+//
+// 接尾辞配列はデータごとに構築するため、エンコードの呼び出しごとに作成します。
+type optimalMatcher struct {
+	windowSize int
+	bufferSize int
+	sa         []int32 // 接尾辞配列
+	rank       []int32 // 位置 -> 接尾辞配列中の順位
+	lcp        []int32 // 隣り合う接尾辞の共通接頭辞の長さ
+}
+
+// newOptimalMatcher は data の接尾辞配列を構築します
+func newOptimalMatcher(data []byte, windowSize, bufferSize int) *optimalMatcher {
+	sa := suffix.Build(data)
+	return &optimalMatcher{
+		windowSize: windowSize,
+		bufferSize: bufferSize,
+		sa:         sa,
+		rank:       suffix.Inverse(sa),
+		lcp:        suffix.LCP(data, sa),
+	}
+}
+
+// lookahead は先読みの長さを返します
+func (m *optimalMatcher) lookahead() int {
+	return m.bufferSize
+}
+
+// FindLongestMatch は最長一致を検索します
+// 辞書順で前後に離れるほど共通接頭辞は短くなるため、接尾辞配列を現在位置から
+// 上下交互に走査し、共通接頭辞が見つかった一致以下になった方向は打ち切ります。
+// 交互に走査するのは、長いランのように片方の方向にだけウィンドウ外（未来の位置）の
+// 候補が続く場合でも、もう片方で見つかった一致で早く打ち切るためです。
+func (m *optimalMatcher) FindLongestMatch(data []byte, pos int) MatchResult {
+	maxLength := len(data) - pos
+	if maxLength > m.bufferSize {
+		maxLength = m.bufferSize
+	}
+
+	best := MatchResult{}
+	r := int(m.rank[pos])
+	lo, hi := r-1, r+1
+	loCommon, hiCommon := maxLength, maxLength
+
+	for lo >= 0 || hi < len(m.sa) {
+		// 辞書順で前の接尾辞
+		if lo >= 0 {
+			if l := int(m.lcp[lo+1]); l < loCommon {
+				loCommon = l
+			}
+			if loCommon < minMatchLength || loCommon <= best.Length {
+				lo = -1
+			} else {
+				m.consider(&best, int(m.sa[lo]), pos, loCommon)
+				lo--
+			}
+		}
+
+		// 辞書順で後の接尾辞
+		if hi < len(m.sa) {
+			if l := int(m.lcp[hi]); l < hiCommon {
+				hiCommon = l
+			}
+			if hiCommon < minMatchLength || hiCommon <= best.Length {
+				hi = len(m.sa)
+			} else {
+				m.consider(&best, int(m.sa[hi]), pos, hiCommon)
+				hi++
+			}
+		}
+	}
+
+	return best
+}
+
+// consider は位置 i からの長さ length の一致がウィンドウ内にあれば best を更新します
+func (m *optimalMatcher) consider(best *MatchResult, i, pos, length int) {
+	if i >= pos || i < pos-m.windowSize {
+		return
+	}
+	if length > best.Length {
+		*best = MatchResult{Distance: pos - i, Length: length}
+	}
+}
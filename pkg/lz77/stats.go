@@ -0,0 +1,147 @@
+package lz77
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// MatchStats はLZ77のトークン列の統計です
+// グラフにするための生のヒストグラムで、配列の長さは入力によらずエンコーダーの設定だけで
+// 決まります。距離は最大でウィンドウサイズまであるため、2の累乗ごとの区間で数えます。
+type MatchStats struct {
+	DataSize int `json:"data_size"` // 元のデータサイズ
+	Literals int `json:"literals"`  // リテラルトークンの数
+	Matches  int `json:"matches"`   // マッチトークンの数
+
+	// Truncated はマッチのうち、マッチ長が先読みの長さに達して打ち切られた数です
+	// 多い場合は、より長い先読み（WithMaxMatchLength、WithAdaptiveLookahead）で小さくなります。
+	Truncated int `json:"truncated"`
+
+	// MaxLookahead は使った先読みの最大の長さです（WithAdaptiveLookahead では変わります）
+	MaxLookahead int `json:"max_lookahead"`
+
+	// LengthCounts はマッチ長ごとのマッチの数です（添字がマッチ長、長さは最大マッチ長 + 1）
+	// 最大マッチ長が maxLengthCounts 以上の場合は、maxLengthCounts と見つかった最長のマッチ長 + 1 の大きい方です。
+	LengthCounts []int `json:"length_counts"`
+
+	// DistanceBins は距離の区間 [1,1], [2,3], [4,7], ... ごとのマッチの数です
+	// 最後の区間の Max はウィンドウサイズです
+	DistanceBins []DistanceBin `json:"distance_bins"`
+
+	// FloorSize はトークン列を理想的なエントロピー符号で符号化したときのサイズ（bytes）です
+	// リテラルかマッチかの区別、リテラルと次の文字のバイト、マッチ長、距離の区間をそれぞれの
+	// 出現頻度で符号化し、区間の中の距離は区間の幅のビット数（添字 i の区間は i ビット）で表します。
+	// このトークン列から到達できる下限の目安で、0次のエントロピーよりずっと小さくなることがあります。
+	FloorSize float64 `json:"floor_size"`
+}
+
+// DistanceBin は距離の区間 [Min, Max] のマッチの数です
+type DistanceBin struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// maxLengthCounts は最大マッチ長によらず LengthCounts を確保する長さの上限です
+// WithMaxMatchLength で大きな最大マッチ長を指定しても、巨大な配列を確保しないようにします。
+const maxLengthCounts = 1 << 16
+
+// distanceBin は距離 d の区間の添字を返します
+func distanceBin(d int) int {
+	return bits.Len(uint(d)) - 1
+}
+
+// AnalyzeMatches は data を圧縮したときのトークン列の統計を返します
+// Compress と同じエンコーダーの設定（最適マッチャー、コストモデル、辞書）を使います。
+func (l *Compressor) AnalyzeMatches(data []byte) MatchStats {
+	window, buffer := l.encoder.matcher.windowSize, l.encoder.matcher.bufferSize
+	stats := MatchStats{
+		DataSize:     len(data),
+		LengthCounts: make([]int, min(buffer+1, maxLengthCounts)),
+		DistanceBins: make([]DistanceBin, distanceBin(window)+1),
+	}
+	for i := range stats.DistanceBins {
+		stats.DistanceBins[i].Min = 1 << i
+		stats.DistanceBins[i].Max = min(1<<(i+1)-1, window)
+	}
+
+	var symbols [256]int
+	var counts lookaheadCounts
+	extraBits := 0
+	for _, token := range l.encoder.encodeWithDict(l.dict, data, &counts) {
+		symbols[token.Literal]++
+		if token.IsLiteral() {
+			stats.Literals++
+			continue
+		}
+		stats.Matches++
+		if int(token.Length) >= len(stats.LengthCounts) {
+			stats.LengthCounts = append(stats.LengthCounts, make([]int, int(token.Length)+1-len(stats.LengthCounts))...)
+		}
+		stats.LengthCounts[token.Length]++
+		bin := distanceBin(int(token.Distance))
+		stats.DistanceBins[bin].Count++
+		extraBits += bin
+	}
+
+	stats.Truncated, stats.MaxLookahead = counts.truncated, counts.max
+
+	bins := make([]int, len(stats.DistanceBins))
+	for i, bin := range stats.DistanceBins {
+		bins[i] = bin.Count
+	}
+	floorBits := common.EntropyBits([]int{stats.Literals, stats.Matches}) + common.EntropyBits(symbols[:]) +
+		common.EntropyBits(stats.LengthCounts) + common.EntropyBits(bins) + float64(extraBits)
+	stats.FloorSize = floorBits / 8
+	return stats
+}
+
+// Floor はトークン列から求めた圧縮後のサイズの下限の目安（bytes）を返します（common.FloorEstimator）
+// AnalyzeMatches の FloorSize と同じです。
+func (l *Compressor) Floor(data []byte) float64 {
+	return l.AnalyzeMatches(data).FloorSize
+}
+
+// TruncatedRatio はマッチのうち先読みの長さで打ち切られた割合を返します（マッチがない場合は0）
+func (s MatchStats) TruncatedRatio() float64 {
+	if s.Matches == 0 {
+		return 0
+	}
+	return float64(s.Truncated) / float64(s.Matches)
+}
+
+// FprintMatchStats はトークン列の統計を w に表示します
+func FprintMatchStats(w io.Writer, s MatchStats) {
+	if s.DataSize == 0 {
+		fmt.Fprintln(w, "データが空です")
+		return
+	}
+
+	fmt.Fprintf(w, "=== LZ77分析結果 ===\n")
+	fmt.Fprintf(w, "リテラル: %d\n", s.Literals)
+	fmt.Fprintf(w, "マッチ: %d\n", s.Matches)
+	fmt.Fprintf(w, "先読みで打ち切られたマッチ: %d (%.1f%%、先読み最大 %d バイト)\n",
+		s.Truncated, s.TruncatedRatio()*100, s.MaxLookahead)
+	fmt.Fprintf(w, "トークン列の理論的下限: %.1f bytes\n", s.FloorSize)
+}
+
+// WriteCSV は統計を "histogram,min,max,count" の列のCSVとして w に書き込みます
+// マッチ長の行（histogram が "length"、min と max はどちらもマッチ長）の後に、
+// 距離の区間の行（histogram が "distance"）が続きます。
+func (s MatchStats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"histogram", "min", "max", "count"})
+	for length, count := range s.LengthCounts {
+		cw.Write([]string{"length", strconv.Itoa(length), strconv.Itoa(length), strconv.Itoa(count)})
+	}
+	for _, bin := range s.DistanceBins {
+		cw.Write([]string{"distance", strconv.Itoa(bin.Min), strconv.Itoa(bin.Max), strconv.Itoa(bin.Count)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
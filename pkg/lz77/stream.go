@@ -0,0 +1,610 @@
+package lz77
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// maxDistance は圧縮データで表せる最大の後方距離です（距離は2バイト）
+// Reader はどの Writer の出力でも展開できるよう、この長さの履歴を保持します。
+const maxDistance = 1<<16 - 1
+
+// readChunkSize は Reader が一度に読み込む圧縮データのバイト数です
+const readChunkSize = 32 << 10
+
+// ErrClosed は Close した Writer に書き込んだことを表します
+var ErrClosed = errors.New("lz77: writer is closed")
+
+// Writer は書き込まれたデータをLZ77で圧縮し、トークンができるごとに w に書き込みます
+// 出力は Compress と同じ形式で、書き込んだデータを連結して Compress したものと同じ
+// トークン列になります（リテラル列のまとめ方だけが異なることがあります）。そのため
+// Decompress と Reader のどちらでも展開できます。最大マッチ長 + 1 バイトの先読みが
+// そろうまでエンコードしないため、Flush か Close を呼ぶまで末尾のデータは出力されません。
+// 通信のように相手がすぐに展開する必要がある場合は、区切りごとに Flush を呼びます。
+//
+// SaveState で状態を保存し、ResumeWriter で復元すると、同じストリームの続きを
+// 別のプロセスや別の接続から書き込めます。同時に使用することはできません。
+type Writer struct {
+	w       io.Writer
+	enc     *Encoder
+	buf     []byte // ウィンドウの履歴（buf[:pos]）とまだエンコードしていないデータ（buf[pos:]）
+	pos     int    // 次にエンコードする位置
+	written bool   // トークンを1つ以上書き込んだ
+	closed  bool
+	err     error
+}
+
+// NewWriter はデフォルト設定（4KBウィンドウ、最大マッチ長18）で w に書き込む Writer を作成します
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, enc: NewEncoder(defaultWindowSize, defaultBufferSize)}
+}
+
+// Write は p を圧縮します（先読みがそろった分だけ w に書き込みます）
+func (z *Writer) Write(p []byte) (int, error) {
+	if err := z.check(); err != nil {
+		return 0, err
+	}
+	z.buf = append(z.buf, p...)
+	if err := z.encode(false, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush は先読みを待っているデータもすべてエンコードし、同期マーカーを付けて w に書き込みます
+// Flush までに書き込んだデータは、Reader が続きの圧縮データを待たずにすべて展開できます
+// （compress/flate の Flush と同じ使い方です）。ストリームは続けて書き込めますが、
+// Flush の直前のデータは先読みが足りないため、続けて書き込んだ場合よりマッチが短くなり、
+// 同期マーカーの1バイトが増えます。w への書き込みは Flush ごとに1回です。
+func (z *Writer) Flush() error {
+	if err := z.check(); err != nil {
+		return err
+	}
+	return z.encode(true, true)
+}
+
+// Close は残りのデータをエンコードしてストリームを終えます（w は閉じません）
+// 何も書き込まなかった場合は、空のデータの圧縮データ（1バイト）を書き込みます。
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	if err := z.check(); err != nil {
+		return err
+	}
+	if err := z.encode(true, false); err != nil {
+		return err
+	}
+	z.closed = true
+	if !z.written {
+		if _, err := z.w.Write([]byte{emptyFlag}); err != nil {
+			z.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// check は書き込めるかを確認します
+func (z *Writer) check() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// encode は先読みがそろった位置（final の場合はすべての位置）のトークンを w に書き込みます
+// sync の場合はトークンの後に同期マーカーを付けます（トークンがなくても書き込みます）。
+func (z *Writer) encode(final, sync bool) error {
+	stop := len(z.buf) - z.enc.matcher.bufferSize
+	if final {
+		stop = len(z.buf)
+	}
+
+	var out []byte
+	next := z.pos
+	if z.pos < stop {
+		var tokens []Token
+		tokens, next = z.enc.encodeRange(z.buf, z.pos, stop)
+		out = TokensToBytes(tokens)
+	}
+	if sync {
+		out = append(out, syncFlag)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	if _, err := z.w.Write(out); err != nil {
+		z.err = err
+		return err
+	}
+	z.pos = next
+	z.written = true
+
+	// ウィンドウより前の履歴は参照されないので、ある程度たまったら捨てる
+	window := z.enc.matcher.windowSize
+	if drop := z.pos - window; drop >= window {
+		z.buf = append(z.buf[:0], z.buf[drop:]...)
+		z.pos -= drop
+	}
+	return nil
+}
+
+// 状態のフォーマット
+//
+//	マジック "TZLS" + バージョン(1バイト) + 種類(1バイト、'W' または 'R')
+//	+ ウィンドウサイズ(uvarint) + 最大マッチ長(uvarint) + フラグ(1バイト)
+//	+ 履歴(uvarint長 + バイト列) + 保留中のデータ(uvarint長 + バイト列)
+//	+ CRC32（ここまでのバイト列、4バイト BigEndian）
+//
+// Reader のウィンドウサイズは圧縮データの先頭のウィンドウ（ない場合は最大の後方距離、
+// まだ読んでいない場合は0）です。
+// Writer の保留中のデータはまだエンコードしていない入力、Reader は読み込んだが
+// トークンにしていない圧縮データです。Reader の履歴はまだ返していない展開結果を含み、
+// その長さを保留中のデータの前に uvarint で記録します。フラグの最下位ビットは
+// トークンを1つ以上書き込んだ（読んだ）ことを表します。マッチングにはウィンドウと
+// 先読みだけを使い、ハッシュチェーンなどの索引は持たないため、状態には含みません。
+const (
+	stateMagic = "TZLS"
+
+	// StateVersion は SaveState が出力する状態のフォーマットのバージョンです
+	StateVersion = 1
+
+	stateWriter = 'W'
+	stateReader = 'R'
+
+	stateFlagTokens = 1
+)
+
+// SaveState は Writer の状態（ウィンドウの履歴とまだエンコードしていないデータ）を返します
+// 状態を ResumeWriter に渡すと、この Writer の続きを書き込めます。保存した後にこの Writer に
+// 書き込むと、ストリームが分岐するため、どちらか一方だけを使ってください。
+func (z *Writer) SaveState() ([]byte, error) {
+	if err := z.check(); err != nil {
+		return nil, err
+	}
+	history := z.buf[max(z.pos-z.enc.matcher.windowSize, 0):z.pos]
+	return appendState(stateWriter, z.enc.matcher.windowSize, z.enc.matcher.bufferSize, z.written, history, nil, z.buf[z.pos:]), nil
+}
+
+// ResumeWriter は SaveState の状態から、w に続きを書き込む Writer を作成します
+// 状態が壊れている場合は common.ErrInvalidData に一致する *common.DecodeError を、
+// 新しいバージョンの状態の場合は *common.ErrUnsupportedVersion を返します。
+func ResumeWriter(w io.Writer, state []byte) (*Writer, error) {
+	s, err := parseState(state, stateWriter)
+	if err != nil {
+		return nil, err
+	}
+	z := NewWriter(w)
+	if s.window != z.enc.matcher.windowSize || s.buffer != z.enc.matcher.bufferSize {
+		return nil, common.NewDecodeError("LZ77 state", state, len(stateMagic)+2,
+			"unsupported window %d / match length %d", s.window, s.buffer)
+	}
+	if len(s.history) > s.window {
+		return nil, common.NewDecodeError("LZ77 state", state, 0, "history longer than the window (%d bytes)", len(s.history))
+	}
+	z.buf = append(append([]byte{}, s.history...), s.pending...)
+	z.pos = len(s.history)
+	z.written = s.tokens
+	return z, nil
+}
+
+// Reader はLZ77の圧縮データを r から読みながら展開します
+// Compress と Writer のどちらの出力も展開できます。SaveState で状態を保存し、
+// ResumeReader で復元すると、r の続きから展開を再開できます。
+//
+// 展開したデータの履歴は、圧縮データの先頭のウィンドウ（ないものは最大の後方距離）の
+// 大きさのリングバッファに保持し、マッチは Read に渡されたバッファの分だけ展開します。
+// そのため、ストリームの長さやマッチの長さによらず、使用するメモリは一定です。
+type Reader struct {
+	r        io.Reader
+	in       []byte // 読み込んだがトークンにしていない圧縮データ（in[ipos:complete] は完全なトークン）
+	ipos     int    // 次に展開するトークンの位置
+	complete int    // in の先頭から完全なトークンが続くバイト数
+	ring     []byte // 展開したデータの最後のウィンドウ分（リングバッファ、書き込み位置は total % len(ring)）
+	total    int64  // 展開したバイト数
+
+	// 展開途中のトークン: matchLeft バイトのマッチの後に lit を返します
+	matchDist int
+	matchLeft int
+	lit       []byte // まだ返していないリテラル（in の一部、trail、または復元した状態）
+	trail     [1]byte
+
+	tokens bool  // トークンを1つ以上読んだ
+	window int   // 圧縮データの先頭のウィンドウ（ないものは maxDistance、まだ読んでいない場合は0）
+	offset int64 // in[0] の圧縮データの先頭からの位置（エラーの位置の報告に使用）
+	eof    bool
+	err    error
+}
+
+// NewReader は r の圧縮データを展開する Reader を作成します
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read は展開したデータを p に読み込みます
+func (z *Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		switch {
+		case z.matchLeft > 0:
+			n += z.copyMatch(p[n:])
+		case len(z.lit) > 0:
+			k := copy(p[n:], z.lit)
+			z.emit(z.lit[:k])
+			z.lit = z.lit[k:]
+			n += k
+		case z.err != nil:
+			if n > 0 {
+				return n, nil
+			}
+			return 0, z.err
+		case z.ipos < z.complete:
+			z.err = z.next()
+		case n > 0:
+			// 返せるデータがあれば、続きの圧縮データを待たずに返す
+			return n, nil
+		default:
+			z.err = z.fill()
+		}
+	}
+	return n, nil
+}
+
+// next は in[ipos:] の1トークンを展開途中のトークンにします
+func (z *Reader) next() error {
+	data := z.in[:z.complete]
+	pos := z.ipos
+	if data[pos] == syncFlag {
+		z.ipos++
+		z.tokens = true
+		return nil
+	}
+	if data[pos] == literalRunFlag {
+		start, end, err := parseLiteralRun(data, pos)
+		if err != nil {
+			return withBase(err, z.offset)
+		}
+		z.lit = data[start:end]
+		z.ipos = end
+		z.tokens = true
+		return nil
+	}
+
+	token, size, err := parseToken(data, pos)
+	if err != nil {
+		return withBase(err, z.offset)
+	}
+	if int(token.Distance) > z.window {
+		return common.NewDecodeError("LZ77", data, pos+1, "distance %d exceeds window %d", token.Distance, z.window).WithBase(z.offset)
+	}
+	if history := min(z.total, int64(len(z.ring))); int64(token.Distance) > history {
+		return common.NewDecodeError("LZ77", data, pos+1,
+			"invalid distance %d, history length %d", token.Distance, history).WithBase(z.offset)
+	}
+	z.matchDist, z.matchLeft = int(token.Distance), int(token.Length)
+	z.trail[0] = token.Literal
+	z.lit = z.trail[:]
+	z.ipos += size
+	z.tokens = true
+	return nil
+}
+
+// copyMatch は展開途中のマッチを p の長さまでリングバッファから展開し、p に書き込みます
+// 1回のコピーは後方距離までに区切るため、コピー元がこのコピーで上書きされることはありません。
+func (z *Reader) copyMatch(p []byte) int {
+	size := len(z.ring)
+	n := min(len(p), z.matchLeft)
+	for i := 0; i < n; {
+		dst := int(z.total % int64(size))
+		src := (dst - z.matchDist + size) % size
+		k := min(n-i, z.matchDist, size-dst, size-src)
+		copy(z.ring[dst:dst+k], z.ring[src:src+k])
+		copy(p[i:], z.ring[dst:dst+k])
+		z.total += int64(k)
+		i += k
+	}
+	z.matchLeft -= n
+	return n
+}
+
+// emit は返したデータをリングバッファの履歴に追加します
+func (z *Reader) emit(b []byte) {
+	for len(b) > 0 {
+		k := copy(z.ring[z.total%int64(len(z.ring)):], b)
+		b = b[k:]
+		z.total += int64(k)
+	}
+}
+
+// history はリングバッファの履歴を古い順に並べて返します
+func (z *Reader) history() []byte {
+	size := int64(len(z.ring))
+	if z.total <= size {
+		return append([]byte{}, z.ring[:z.total]...)
+	}
+	w := z.total % size
+	return append(append([]byte{}, z.ring[w:]...), z.ring[:w]...)
+}
+
+// fill は展開したトークンの圧縮データを捨て、続きを読み込んで完全なトークンの範囲を求めます
+func (z *Reader) fill() error {
+	z.in = append(z.in[:0], z.in[z.complete:]...)
+	z.offset += int64(z.complete)
+	z.ipos, z.complete = 0, 0
+
+	if z.eof {
+		switch {
+		case len(z.in) == 1 && z.in[0] == emptyFlag && !z.tokens && z.offset == 0:
+			z.in = z.in[:0]
+			return io.EOF
+		case len(z.in) > 0:
+			return common.NewDecodeError("LZ77", z.in, 0, "incomplete token at end of stream").WithBase(z.offset)
+		case !z.tokens:
+			return common.NewDecodeError("LZ77", nil, 0, "empty compressed data")
+		}
+		return io.EOF
+	}
+
+	z.in = slices.Grow(z.in, readChunkSize)
+	n, err := z.r.Read(z.in[len(z.in) : len(z.in)+readChunkSize])
+	z.in = z.in[:len(z.in)+n]
+	if err == io.EOF {
+		z.eof = true
+	} else if err != nil {
+		return err
+	}
+
+	// 空のデータの圧縮データは、ストリーム全体が1バイトの場合だけ有効
+	if !z.tokens && z.offset == 0 && len(z.in) == 1 && z.in[0] == emptyFlag {
+		return nil
+	}
+	if z.window == 0 && len(z.in) > 0 {
+		window, n, err := parseWindow(z.in)
+		if window == 0 || err != nil {
+			return withBase(err, z.offset)
+		}
+		z.window = window
+		z.ring = make([]byte, window)
+		z.in = append(z.in[:0], z.in[n:]...)
+		z.offset += int64(n)
+	}
+	complete, err := completeTokens(z.in)
+	if err != nil {
+		return withBase(err, z.offset)
+	}
+	z.complete = complete
+	return nil
+}
+
+// withBase は err が *common.DecodeError なら位置を base だけずらします
+func withBase(err error, base int64) error {
+	var decodeErr *common.DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.WithBase(base)
+	}
+	return err
+}
+
+// completeTokens は data の先頭から完全なトークンが続くバイト数を返します
+// 途中で切れている末尾のトークンは含めません。形式が不正な場合はエラーを返します。
+func completeTokens(data []byte) (int, error) {
+	pos := 0
+	for pos < len(data) {
+		size := 0
+		switch data[pos] {
+		case literalFlag:
+			size = literalTokenSize
+		case matchFlag:
+			_, n, err := parseLength(data, pos+3)
+			if err != nil {
+				return 0, err
+			}
+			if n == 0 {
+				return pos, nil // 長さの途中で切れている
+			}
+			size = 3 + n + 1
+		case windowFlag:
+			return 0, common.NewDecodeError("LZ77", data, pos, "window is only allowed at the start of the stream")
+		case syncFlag:
+			size = 1
+		case literalRunFlag:
+			count, n := binary.Uvarint(data[pos+1:])
+			if n < 0 || count > math.MaxInt32 {
+				return 0, common.NewDecodeError("LZ77", data, pos+1, "invalid literal run length")
+			}
+			if n == 0 {
+				return pos, nil // 個数の途中で切れている
+			}
+			size = 1 + n + int(count)
+		default:
+			// 空のデータの1バイトはストリーム全体の場合だけ有効（Reader.fill で扱う）
+			return 0, common.NewDecodeError("LZ77", data, pos, "unknown token flag %d", data[pos])
+		}
+		if pos+size > len(data) {
+			return pos, nil
+		}
+		pos += size
+	}
+	return pos, nil
+}
+
+// SaveState は Reader の状態（展開したデータの履歴、まだ返していないデータ、
+// 読み込んだがトークンにしていない圧縮データ）を返します
+// 状態を ResumeReader に渡すと、この Reader が読み込んだ位置の続きから展開できます。
+// 展開途中のマッチの残りは、まだ返していないデータとして展開して記録します。
+func (z *Reader) SaveState() ([]byte, error) {
+	if z.err != nil && z.err != io.EOF {
+		return nil, z.err
+	}
+	history := z.history()
+	done := len(history)
+	for range z.matchLeft {
+		history = append(history, history[len(history)-z.matchDist])
+	}
+	history = append(history, z.lit...)
+	return appendState(stateReader, z.window, defaultBufferSize, z.tokens, history, history[done:], z.in[z.ipos:]), nil
+}
+
+// ResumeReader は SaveState の状態から、r の続きを展開する Reader を作成します
+// r は保存した Reader が読み込んだ位置の続きから読める必要があります。
+// 状態が壊れている場合は common.ErrInvalidData に一致する *common.DecodeError を、
+// 新しいバージョンの状態の場合は *common.ErrUnsupportedVersion を返します。
+func ResumeReader(r io.Reader, state []byte) (*Reader, error) {
+	s, err := parseState(state, stateReader)
+	if err != nil {
+		return nil, err
+	}
+	if s.unread > len(s.history) || len(s.history)-s.unread > maxDistance || (s.window == 0 && len(s.history) > 0) {
+		return nil, common.NewDecodeError("LZ77 state", state, 0, "invalid history (%d bytes, %d unread)", len(s.history), s.unread)
+	}
+	if s.window > maxDistance {
+		return nil, common.NewDecodeError("LZ77 state", state, len(stateMagic)+2, "invalid window %d", s.window)
+	}
+	z := &Reader{
+		r:      r,
+		in:     append([]byte{}, s.pending...),
+		tokens: s.tokens,
+		window: s.window,
+	}
+	if s.window > 0 {
+		z.ring = make([]byte, s.window)
+		z.emit(s.history[:len(s.history)-s.unread])
+	}
+	z.lit = append([]byte{}, s.history[len(s.history)-s.unread:]...)
+	return z, nil
+}
+
+// streamState は状態のフォーマットを解析した結果です
+type streamState struct {
+	window, buffer int
+	tokens         bool
+	history        []byte
+	unread         int // Reader の履歴の末尾のうち、まだ返していないバイト数
+	pending        []byte
+}
+
+// appendState は状態をフォーマットにします（unread は Reader の場合だけ記録します）
+func appendState(kind byte, window, buffer int, tokens bool, history, unread, pending []byte) []byte {
+	state := append([]byte(stateMagic), StateVersion, kind)
+	state = binary.AppendUvarint(state, uint64(window))
+	state = binary.AppendUvarint(state, uint64(buffer))
+	flags := byte(0)
+	if tokens {
+		flags |= stateFlagTokens
+	}
+	state = append(state, flags)
+	state = binary.AppendUvarint(state, uint64(len(history)))
+	state = append(state, history...)
+	if kind == stateReader {
+		state = binary.AppendUvarint(state, uint64(len(unread)))
+	}
+	state = binary.AppendUvarint(state, uint64(len(pending)))
+	state = append(state, pending...)
+	return binary.BigEndian.AppendUint32(state, crc32.ChecksumIEEE(state))
+}
+
+// parseState は kind の状態を解析します
+func parseState(state []byte, kind byte) (streamState, error) {
+	var s streamState
+	header := len(stateMagic) + 2
+	if len(state) < header+4 || string(state[:len(stateMagic)]) != stateMagic {
+		return s, common.NewDecodeError("LZ77 state", state, 0, "invalid magic")
+	}
+	if v := state[len(stateMagic)]; v > StateVersion {
+		return s, &common.ErrUnsupportedVersion{Format: "lz77 state", Have: v, Max: StateVersion}
+	} else if v == 0 {
+		return s, common.NewDecodeError("LZ77 state", state, len(stateMagic), "invalid version 0")
+	}
+	if state[len(stateMagic)+1] != kind {
+		return s, common.NewDecodeError("LZ77 state", state, len(stateMagic)+1, "state of kind %q, want %q", state[len(stateMagic)+1], kind)
+	}
+	body := state[:len(state)-4]
+	if want, got := binary.BigEndian.Uint32(state[len(body):]), crc32.ChecksumIEEE(body); want != got {
+		return s, common.NewDecodeError("LZ77 state", state, len(body), "checksum mismatch: expected %08x, got %08x", want, got)
+	}
+
+	pos := header
+	uvarint := func() (int, bool) {
+		v, n := binary.Uvarint(body[pos:])
+		if n <= 0 || v > math.MaxInt32 {
+			return 0, false
+		}
+		pos += n
+		return int(v), true
+	}
+	bytesField := func() ([]byte, bool) {
+		n, ok := uvarint()
+		if !ok || n > len(body)-pos {
+			return nil, false
+		}
+		pos += n
+		return body[pos-n : pos], true
+	}
+
+	var ok bool
+	if s.window, ok = uvarint(); !ok {
+		return s, common.NewDecodeError("LZ77 state", state, pos, "invalid window size")
+	}
+	if s.buffer, ok = uvarint(); !ok {
+		return s, common.NewDecodeError("LZ77 state", state, pos, "invalid match length")
+	}
+	if pos >= len(body) || body[pos]&^stateFlagTokens != 0 {
+		return s, common.NewDecodeError("LZ77 state", state, pos, "invalid flags")
+	}
+	s.tokens = body[pos]&stateFlagTokens != 0
+	pos++
+	if s.history, ok = bytesField(); !ok {
+		return s, common.NewDecodeError("LZ77 state", state, pos, "invalid history")
+	}
+	if kind == stateReader {
+		if s.unread, ok = uvarint(); !ok {
+			return s, common.NewDecodeError("LZ77 state", state, pos, "invalid unread length")
+		}
+	}
+	if s.pending, ok = bytesField(); !ok || pos != len(body) {
+		return s, common.NewDecodeError("LZ77 state", state, pos, "invalid pending data")
+	}
+	return s, nil
+}
+
+// StreamCompressor はデフォルト設定の Compressor に common.StreamCompressor を加えたものです
+// CompressStream と DecompressStream は Writer と Reader を使うため、入力全体をメモリに
+// 読み込まずに圧縮・展開できます。圧縮データは Compress と同じ形式です。
+// 登録名 "lz77" の Compressor は、.tzz コンテナでチャンクごとのメンバーに圧縮する
+// （StreamCompressor として1メンバーにしない）ため、このインターフェースを実装していません。
+// パイプラインの段のように、ストリームでつなぎたい場合に使います。
+type StreamCompressor struct {
+	*Compressor
+}
+
+// NewStreamCompressor はデフォルト設定の StreamCompressor を作成します
+func NewStreamCompressor() *StreamCompressor {
+	return &StreamCompressor{Compressor: NewCompressor()}
+}
+
+// CompressStream は src を読みながら圧縮して dst に書き込みます
+func (s *StreamCompressor) CompressStream(src io.Reader, dst io.Writer) error {
+	w := NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecompressStream は src を読みながら展開して dst に書き込みます
+func (s *StreamCompressor) DecompressStream(src io.Reader, dst io.Writer) error {
+	_, err := io.Copy(dst, NewReader(src))
+	return err
+}
+
+var _ common.StreamCompressor = (*StreamCompressor)(nil)
@@ -1,10 +1,58 @@
 package lz77
 
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// トークンのワイヤーフォーマット
+//
+//	リテラル: フラグ(0) + 文字(1バイト)                                  = 2バイト
+//	マッチ:   フラグ(1) + 距離(2バイト, BigEndian) + 長さ(1バイト〜) + 次の文字(1バイト) = 5バイト〜
+//	リテラル列: フラグ(2) + 個数(uvarint) + 文字(個数バイト)                    = 個数+2バイト〜
+//	ウィンドウ: フラグ(3) + ウィンドウのバイト数(uvarint)                         = 2バイト〜
+//	同期:     フラグ(4)                                                      = 1バイト
+//
+// リテラル列は形式バージョン1で追加したもので、連続する minLiteralRun 個以上のリテラル
+// トークンを直列化するときに使います。展開すると個々のリテラルトークンになるため、
+// 1つのトークンとしては扱えません（MarshalBinary / UnmarshalBinary の対象外です）。
+//
+// 長さは形式バージョン2で拡張したもので、255未満はそのまま1バイト、255以上は
+// lengthExtension(255) の後に 長さ-255 を uvarint で続けます。バージョン1までの
+// Compressor は長さ18までのマッチしか出力しないため、255 のバイトが現れることはありません。
+// ウィンドウは形式バージョン3で追加したもので、WithAutoWindow で圧縮したデータの先頭に
+// だけ置きます。それ以降のマッチの距離はウィンドウ以下でなければならず、展開時に確認します。
+// 同期マーカーは形式バージョン4で追加したもので、Writer.Flush がそれまでのデータを
+// すべて出力した位置に置きます。展開では何も出力せず、トークンの間のどこにあっても読み飛ばします。
+// トークンが1つもない場合はフラグ(0xFF)の1バイトだけを出力し、空の圧縮データと区別します。
+const (
+	literalFlag    = 0
+	matchFlag      = 1
+	literalRunFlag = 2
+	windowFlag     = 3
+	syncFlag       = 4
+	emptyFlag      = 0xFF
+
+	// minLiteralRun はリテラル列にまとめるリテラルの最小個数です
+	// 2個では個別のリテラル（4バイト）と同じサイズになるため、3個以上でまとめます
+	minLiteralRun = 3
+
+	literalTokenSize = 2
+	matchTokenSize   = 5 // 長さが lengthExtension 未満のマッチ
+
+	// lengthExtension は長さのバイトで、続く uvarint を加えることを表す値です
+	lengthExtension = 255
+)
+
 // Token はLZ77のトークンを表します
+// Compressor の圧縮形式はトークン列をそのまま直列化したものなので、
+// トークンは可視化や解析のための公開された中間表現として利用できます。
 type Token struct {
-	Distance uint16 // 後方距離（0の場合はリテラル）
-	Length   uint8  // マッチ長
-	Literal  byte   // リテラル文字（Distance=0の場合に使用）
+	Distance uint16 `json:"distance"` // 後方距離（0の場合はリテラル）
+	Length   uint32 `json:"length"`   // マッチ長
+	Literal  byte   `json:"literal"`  // リテラル文字（Distance=0の場合に使用）
 }
 
 // IsLiteral はトークンがリテラルかどうかを判定します
@@ -22,10 +70,222 @@ func NewLiteralToken(literal byte) Token {
 }
 
 // NewMatchToken はマッチトークンを作成します
-func NewMatchToken(distance uint16, length uint8, nextChar byte) Token {
+func NewMatchToken(distance uint16, length uint32, nextChar byte) Token {
 	return Token{
 		Distance: distance,
 		Length:   length,
 		Literal:  nextChar,
 	}
 }
+
+// EncodedSize はトークンをワイヤーフォーマットにしたときのバイト数を返します
+func (t Token) EncodedSize() int {
+	if t.IsLiteral() {
+		return literalTokenSize
+	}
+	return matchTokenSize - 1 + lengthSize(t.Length)
+}
+
+// MarshalBinary はトークンをワイヤーフォーマットに変換します（encoding.BinaryMarshaler）
+func (t Token) MarshalBinary() ([]byte, error) {
+	return t.appendBinary(make([]byte, 0, t.EncodedSize())), nil
+}
+
+// UnmarshalBinary はワイヤーフォーマットからトークンを復元します（encoding.BinaryUnmarshaler）
+// data はちょうど1トークン分でなければなりません
+func (t *Token) UnmarshalBinary(data []byte) error {
+	token, n, err := parseToken(data, 0)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return common.NewDecodeError("LZ77", data, n, "%d trailing bytes after token", len(data)-n)
+	}
+	*t = token
+	return nil
+}
+
+// appendBinary はトークンのワイヤーフォーマットを dst に追加します
+func (t Token) appendBinary(dst []byte) []byte {
+	if t.IsLiteral() {
+		return append(dst, literalFlag, t.Literal)
+	}
+	dst = append(dst, matchFlag)
+	dst = binary.BigEndian.AppendUint16(dst, t.Distance)
+	dst = appendLength(dst, t.Length)
+	return append(dst, t.Literal)
+}
+
+// appendLength はマッチ長のフィールドを dst に追加します
+func appendLength(dst []byte, length uint32) []byte {
+	if length < lengthExtension {
+		return append(dst, byte(length))
+	}
+	dst = append(dst, lengthExtension)
+	return binary.AppendUvarint(dst, uint64(length-lengthExtension))
+}
+
+// lengthSize はマッチ長のフィールドのバイト数を返します
+func lengthSize(length uint32) int {
+	if length < lengthExtension {
+		return 1
+	}
+	return 1 + len(binary.AppendUvarint(nil, uint64(length-lengthExtension)))
+}
+
+// parseLength は data の pos からマッチ長のフィールドを読み取り、長さとフィールドのバイト数を返します
+// フィールドが data の終わりで切れている場合は n に0を返します（ストリームでは続きを待ちます）。
+func parseLength(data []byte, pos int) (length uint32, n int, err error) {
+	if pos >= len(data) {
+		return 0, 0, nil
+	}
+	if data[pos] < lengthExtension {
+		return uint32(data[pos]), 1, nil
+	}
+	ext, k := binary.Uvarint(data[pos+1:])
+	switch {
+	case k < 0 || ext > math.MaxUint32-lengthExtension:
+		return 0, 0, common.NewDecodeError("LZ77", data, pos+1, "match length extension overflows")
+	case k == 0:
+		return 0, 0, nil
+	}
+	return lengthExtension + uint32(ext), 1 + k, nil
+}
+
+// parseToken は data の pos から1トークンを読み取り、消費したバイト数を返します
+// エラーの位置は data の先頭からの位置で報告します
+func parseToken(data []byte, pos int) (Token, int, error) {
+	rest := data[pos:]
+	if len(rest) == 0 {
+		return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "missing token flag")
+	}
+
+	switch rest[0] {
+	case literalFlag:
+		if len(rest) < literalTokenSize {
+			return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "missing literal")
+		}
+		return NewLiteralToken(rest[1]), literalTokenSize, nil
+	case matchFlag:
+		// フラグ + 距離(2バイト) + 長さ(n バイト) + 次の文字
+		length, n, err := parseLength(data, pos+3)
+		if err != nil {
+			return Token{}, 0, err
+		}
+		size := 3 + n + 1
+		if n == 0 || len(rest) < size {
+			return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "incomplete match token")
+		}
+		distance := binary.BigEndian.Uint16(rest[1:3])
+		if distance == 0 {
+			return Token{}, 0, common.NewDecodeError("LZ77", data, pos+1, "match token with zero distance")
+		}
+		return NewMatchToken(distance, length, rest[size-1]), size, nil
+	case literalRunFlag:
+		return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "literal run is not a single token")
+	case windowFlag:
+		return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "window is only allowed at the start of the stream")
+	case syncFlag:
+		return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "sync marker is not a token")
+	default:
+		return Token{}, 0, common.NewDecodeError("LZ77", data, pos, "unknown token flag %d", rest[0])
+	}
+}
+
+// parseLiteralRun は data の pos からリテラル列を読み取り、リテラルの範囲 data[start:end] を返します
+func parseLiteralRun(data []byte, pos int) (start, end int, err error) {
+	count, n := binary.Uvarint(data[pos+1:])
+	if n <= 0 {
+		return 0, 0, common.NewDecodeError("LZ77", data, pos+1, "invalid literal run length")
+	}
+	if count == 0 {
+		return 0, 0, common.NewDecodeError("LZ77", data, pos+1, "empty literal run")
+	}
+	start = pos + 1 + n
+	if count > uint64(len(data)-start) {
+		return 0, 0, common.NewDecodeError("LZ77", data, pos, "incomplete literal run (%d of %d bytes)", len(data)-start, count)
+	}
+	return start, start + int(count), nil
+}
+
+// appendWindow はウィンドウ（形式バージョン3）を dst に追加します
+func appendWindow(dst []byte, window int) []byte {
+	dst = append(dst, windowFlag)
+	return binary.AppendUvarint(dst, uint64(window))
+}
+
+// parseWindow は圧縮データの先頭のウィンドウを読み取り、ウィンドウのバイト数と次のトークンの位置を返します
+// ウィンドウがない場合は maxDistance と0を、ウィンドウが data の終わりで切れている場合は
+// 0と0を返します（ストリームでは続きを待ちます）。
+func parseWindow(data []byte) (window, n int, err error) {
+	if len(data) == 0 || data[0] != windowFlag {
+		return maxDistance, 0, nil
+	}
+	v, k := binary.Uvarint(data[1:])
+	switch {
+	case k == 0:
+		return 0, 0, nil
+	case k < 0 || v == 0 || v > maxDistance:
+		return 0, 0, common.NewDecodeError("LZ77", data, 1, "invalid window size")
+	}
+	return int(v), 1 + k, nil
+}
+
+// walkTokens は圧縮データのトークンを先頭から順に読み取り、fn を呼び出します
+// リテラル列は literals にまとめて渡し（token はゼロ値）、それ以外は token を渡します
+// （literals は nil）。pos はトークンの先頭の位置です。先頭のウィンドウは fn に渡さず、
+// マッチの距離がウィンドウ以下かを確認します。
+func walkTokens(data []byte, fn func(pos int, token Token, literals []byte) error) error {
+	if len(data) == 0 {
+		return common.NewDecodeError("LZ77", data, 0, "empty compressed data")
+	}
+	if len(data) == 1 && data[0] == emptyFlag {
+		return nil
+	}
+
+	window, pos, err := parseWindow(data)
+	switch {
+	case err != nil:
+		return err
+	case window == 0:
+		return common.NewDecodeError("LZ77", data, 0, "incomplete window")
+	case pos == len(data):
+		return common.NewDecodeError("LZ77", data, pos, "missing tokens after window")
+	}
+	return walkBody(data, pos, window, fn)
+}
+
+// walkBody は data[pos:] のトークンを walkTokens と同じように読み取ります（ウィンドウは読み取りません）
+// マッチの距離が window を超える場合はエラーを返します。同期マーカーは fn に渡さずに読み飛ばします。
+func walkBody(data []byte, pos, window int, fn func(pos int, token Token, literals []byte) error) error {
+	for pos < len(data) {
+		if data[pos] == syncFlag {
+			pos++
+			continue
+		}
+		if data[pos] == literalRunFlag {
+			start, end, err := parseLiteralRun(data, pos)
+			if err != nil {
+				return err
+			}
+			if err := fn(pos, Token{}, data[start:end]); err != nil {
+				return err
+			}
+			pos = end
+			continue
+		}
+
+		token, n, err := parseToken(data, pos)
+		if err != nil {
+			return err
+		}
+		if int(token.Distance) > window {
+			return common.NewDecodeError("LZ77", data, pos+1, "distance %d exceeds window %d", token.Distance, window)
+		}
+		if err := fn(pos, token, nil); err != nil {
+			return err
+		}
+		pos += n
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package lz77
+
+import (
+	"io"
+)
+
+// TokenStream はワイヤーフォーマットで読み書きできるトークン列です
+// Compressor の圧縮データと同じ形式なので、保存したストリームは Decompress でも展開できます。
+type TokenStream []Token
+
+// WriteTo はトークン列をワイヤーフォーマットで w に書き込みます（io.WriterTo）
+func (s TokenStream) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(TokensToBytes(s))
+	return int64(n), err
+}
+
+// ReadFrom は r からEOFまでワイヤーフォーマットを読み込み、トークン列を置き換えます（io.ReaderFrom）
+func (s *TokenStream) ReadFrom(r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	tokens, err := NewDecoder().Decode(data)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	*s = tokens
+	return int64(len(data)), nil
+}
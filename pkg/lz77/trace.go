@@ -0,0 +1,62 @@
+package lz77
+
+import "github.com/sasakihasuto/tinyzipzap/pkg/common"
+
+// windowTailSize は StepEvent に含めるウィンドウの末尾のバイト数です
+const windowTailSize = 16
+
+// StepEvent はエンコーダーが1つのトークンを決めたときのイベントです（common.Tracer に通知します）
+// 位置は入力の先頭からのバイト数で、プリセット辞書の中は負の値になります。
+type StepEvent struct {
+	Position    int    `json:"position"`     // トークンを決めた位置
+	WindowStart int    `json:"window_start"` // 参照できるウィンドウの先頭の位置
+	WindowSize  int    `json:"window_size"`  // ウィンドウのバイト数
+	WindowTail  string `json:"window_tail"`  // ウィンドウの末尾（最大16バイト）
+
+	// Candidates はウィンドウを近い方から走査したときに、それまでの最長を更新したマッチです
+	// 最後の候補が最長一致で、マッチ長が最小マッチ長に満たない位置では空です。
+	Candidates []MatchResult `json:"candidates"`
+
+	Token Token `json:"token"` // 選んだトークン
+}
+
+// WithTracer はトークンを決めるごとに t に StepEvent を通知する Compressor を返します（common.Traced）
+func (l *Compressor) WithTracer(t common.Tracer) common.Compressor {
+	encoder := *l.encoder
+	encoder.tracer = t
+	c := *l
+	c.encoder = &encoder
+	return &c
+}
+
+// traceStep は data[pos] で token を選んだことを通知します（data[:start] は辞書）
+func (e *Encoder) traceStep(data []byte, start, pos int, token Token) {
+	windowStart := max(pos-e.matcher.windowSize, 0)
+	tailStart := max(pos-windowTailSize, windowStart)
+	e.tracer.OnStep(StepEvent{
+		Position:    pos - start,
+		WindowStart: windowStart - start,
+		WindowSize:  pos - windowStart,
+		WindowTail:  string(data[tailStart:pos]),
+		Candidates:  e.matcher.candidates(data, pos),
+		Token:       token,
+	})
+}
+
+// candidates は FindLongestMatch と同じ順にウィンドウを走査し、最長を更新したマッチを返します
+func (m *Matcher) candidates(data []byte, pos int) []MatchResult {
+	start := max(pos-m.windowSize, 0)
+	maxLookahead := min(len(data)-pos, m.bufferSize)
+
+	found := []MatchResult{}
+	best := minMatchLength - 1
+	for i := pos - 1; i >= start; i-- {
+		if length := m.calculateMatchLength(data, i, pos, maxLookahead); length > best {
+			best = length
+			found = append(found, MatchResult{Distance: pos - i, Length: length})
+		}
+	}
+	return found
+}
+
+var _ common.Traced = (*Compressor)(nil)
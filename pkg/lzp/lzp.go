@@ -0,0 +1,218 @@
+// Package lzp implements LZP (Lempel-Ziv + Prediction) compression.
+// LZPは直前の数バイト（文脈）から「前回同じ文脈の後に続いた位置」を予測し、
+// 予測が当たった長さだけを出力する圧縮アルゴリズムです。LZ77のように距離を
+// 出力せず、マッチの探索もハッシュ表を1回引くだけなので高速です。
+package lzp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/intcode"
+)
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "lzp",
+		Extensions:   []string{".lzp"},
+		Capabilities: common.CapDeterministic,
+		Description:  "LZP（直前の文脈から予測した位置との一致の長さを出力）",
+		UseCase:      "繰り返しの多いデータを速く圧縮したい場合",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressor() },
+	})
+}
+
+const (
+	// contextOrder は文脈として使う直前のバイト数です
+	contextOrder = 3
+
+	// hashBits はハッシュ表のサイズ（2^hashBits エントリ）です
+	hashBits = 16
+)
+
+// tableMemSize はハッシュ表が使用するメモリ量です（予算の計算に使用）
+const tableMemSize = int64(1<<hashBits) * int64(unsafe.Sizeof(int(0)))
+
+// Compressor はLZP圧縮を実装します
+// ハッシュ表は呼び出しごとに確保するため、複数のゴルーチンから同時に使用できます
+//
+// 形式: 元のサイズ(uvarint) + ビット列。ビット列は先頭から位置ごとに次のどれかです。
+//
+//	予測がない位置: リテラル(8ビット)
+//	予測が当たる:   フラグ(1) + マッチ長-1(gamma符号)
+//	予測が外れる:   フラグ(0) + リテラル(8ビット)
+//
+// 予測の有無は展開側も同じハッシュ表を更新しながら判断できるため、フラグは
+// 予測がある位置にだけ出力します。空のデータは元のサイズ0の1バイトになります。
+type Compressor struct {
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
+
+// NewCompressor は新しいCompressorを作成します
+func NewCompressor() *Compressor {
+	return &Compressor{}
+}
+
+// Name はアルゴリズム名を返します
+func (c *Compressor) Name() string {
+	return "LZP"
+}
+
+// formatVersion はLZPの圧縮形式のバージョンです
+const formatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (c *Compressor) FormatVersion() byte {
+	return formatVersion
+}
+
+// Overhead は圧縮データの先頭の元のサイズ(uvarint)のバイト数を返します（common.Overheader）
+func (c *Compressor) Overhead(data []byte) int {
+	return len(binary.AppendUvarint(nil, uint64(len(data))))
+}
+
+// Compress はLZPアルゴリズムでデータを圧縮します
+// 展開時に元のサイズを2GB未満に制限しているため、入力も2GB未満でなければなりません
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	if err := c.oneShot.Check(c.Name(), len(data)); err != nil {
+		return nil, err
+	}
+	if len(data) > math.MaxInt32 {
+		return nil, fmt.Errorf("LZP: input too large: %d bytes", len(data))
+	}
+
+	table := make([]int, 1<<hashBits)
+	w := bitio.NewWriter()
+
+	for pos := 0; pos < len(data); {
+		predicted := predict(table, data, pos)
+		if predicted < 0 {
+			w.WriteBits(uint64(data[pos]), 8)
+			pos++
+			continue
+		}
+
+		length := 0
+		for pos+length < len(data) && data[predicted+length] == data[pos+length] {
+			length++
+		}
+		if length == 0 {
+			w.WriteBit(0)
+			w.WriteBits(uint64(data[pos]), 8)
+			pos++
+			continue
+		}
+
+		w.WriteBit(1)
+		if err := intcode.Gamma.Write(w, uint64(length-1)); err != nil {
+			return nil, err
+		}
+		pos += length
+	}
+
+	compressed := binary.AppendUvarint(nil, uint64(len(data)))
+	return append(compressed, w.Bytes()...), nil
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (c *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	return &Compressor{oneShot: common.NewOneShotLimit(n)}
+}
+
+// Decompress はLZP圧縮されたデータを展開します
+func (c *Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// ヘッダーの元のサイズで出力を、展開前にハッシュ表の分の予算を確認します
+func (c *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, common.NewDecodeError("LZP", data, 0, "empty compressed data")
+	}
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > math.MaxInt32 {
+		return nil, common.NewDecodeError("LZP", data, 0, "invalid original size")
+	}
+	if err := opts.ReserveOutput(int64(size), int64(size)); err != nil {
+		return nil, err
+	}
+	if err := opts.Budget.Reserve(tableMemSize); err != nil {
+		return nil, err
+	}
+	defer opts.Budget.Release(tableMemSize)
+
+	// ビット単位の形式なので、エラーの位置は読み込み中のフィールドを含むバイトの位置
+	r := bitio.NewReader(data[n:])
+	offset := func(bitPos int) int { return n + bitPos/8 }
+
+	table := make([]int, 1<<hashBits)
+	// 長いマッチは少ないビットで大きな出力になるため、最初の確保は入力の大きさに抑える
+	result := make([]byte, 0, min(int(size), 8*len(data)))
+
+	for len(result) < int(size) {
+		pos := len(result)
+		fieldPos := r.Position()
+
+		if predicted := predict(table, result, pos); predicted >= 0 {
+			flag, err := r.ReadBit()
+			if err != nil {
+				return nil, common.NewDecodeError("LZP", data, offset(fieldPos), "missing prediction flag")
+			}
+			if flag == 1 {
+				length, err := intcode.Gamma.Read(r)
+				if err != nil {
+					return nil, common.NewDecodeError("LZP", data, offset(fieldPos), "invalid match length: %v", err)
+				}
+				if length >= size-uint64(pos) {
+					return nil, common.NewDecodeError("LZP", data, offset(fieldPos),
+						"match length %d exceeds remaining output %d", length+1, int(size)-pos)
+				}
+				// 予測位置は常に現在位置より前なので、重なっていても1バイトずつコピーできる
+				for i := 0; i <= int(length); i++ {
+					result = append(result, result[predicted+i])
+				}
+				continue
+			}
+			fieldPos = r.Position()
+		}
+
+		literal, err := r.ReadBits(8)
+		if err != nil {
+			return nil, common.NewDecodeError("LZP", data, offset(fieldPos), "missing literal")
+		}
+		result = append(result, byte(literal))
+	}
+
+	// 最後のバイトの余りビットより多く残っている場合は不正
+	if r.Remaining() >= 8 {
+		return nil, common.NewDecodeError("LZP", data, offset(r.Position()), "%d trailing bits", r.Remaining())
+	}
+	return result, nil
+}
+
+// predict は pos の直前の文脈から予測される位置を返し、ハッシュ表の文脈の位置を pos に更新します
+// 文脈が足りない位置や、文脈が初めて現れた位置では -1 を返します
+func predict(table []int, data []byte, pos int) int {
+	if pos < contextOrder {
+		return -1
+	}
+	h := hashContext(data[pos-contextOrder : pos])
+	// 表の0は未使用を表すため、位置+1を保存する
+	predicted := table[h] - 1
+	table[h] = pos + 1
+	return predicted
+}
+
+// hashContext は文脈の3バイトからハッシュ表の位置を計算します
+func hashContext(ctx []byte) uint32 {
+	v := uint32(ctx[0])<<16 | uint32(ctx[1])<<8 | uint32(ctx[2])
+	return (v * 2654435761) >> (32 - hashBits)
+}
@@ -0,0 +1,179 @@
+package lzp
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+)
+
+// englishText は英文に似た単語の並びを生成します（seed が同じなら同じ結果）
+func englishText(words int, seed int64) []byte {
+	vocabulary := strings.Fields("the of and to in is that it was for on are with as his they be at one have " +
+		"this from or had by word but what some we can out other were all there when up use your how said " +
+		"compression algorithm data stream window context prediction")
+	rng := rand.New(rand.NewSource(seed))
+
+	var sb strings.Builder
+	for i := 0; i < words; i++ {
+		word := vocabulary[rng.Intn(len(vocabulary))]
+		if i%12 == 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		sb.WriteString(word)
+		if i%12 == 11 {
+			sb.WriteString(". ")
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	return []byte(sb.String())
+}
+
+func TestLZP_RoundTrip(t *testing.T) {
+	compressor := NewCompressor()
+
+	tests := map[string][]byte{
+		"empty":    {},
+		"text":     englishText(2000, 1),
+		"binary":   testcorpus.Random(4096, 2),
+		"runs":     []byte("aaaaabbbbccccddddAAAAAAAAAAAAAAAAAAAAzzzzzzzzzz"),
+		"long-run": bytes.Repeat([]byte{'x'}, 10000),
+		"periodic": bytes.Repeat([]byte("abcd"), 300),
+	}
+	for _, sample := range testcorpus.Samples() {
+		tests["corpus-"+sample.Name] = sample.Data
+	}
+
+	for name, data := range tests {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", name, err)
+		}
+		decompressed, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", name, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestLZP_EmptyInput(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 空のデータは元のサイズ0の1バイトになり、空の圧縮データとは区別される
+	compressed, err := compressor.Compress(nil)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !bytes.Equal(compressed, []byte{0}) {
+		t.Errorf("Expected [0], got %v", compressed)
+	}
+	if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for empty compressed data, got %v", err)
+	}
+}
+
+func TestLZP_LongRunIsOneMatch(t *testing.T) {
+	// 先頭の4バイト以降は「xxx の後は x」という予測が当たり続けるため、1つのマッチになる
+	compressed, err := NewCompressor().Compress(bytes.Repeat([]byte{'x'}, 10000))
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if len(compressed) > 10 {
+		t.Errorf("Expected a few bytes for a long run, got %d", len(compressed))
+	}
+}
+
+func TestLZP_RatioComparedToLZ77(t *testing.T) {
+	data := englishText(5000, 3)
+
+	lzpCompressed, err := NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("LZP Compress failed: %v", err)
+	}
+	lz77Compressed, err := lz77.NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("LZ77 Compress failed: %v", err)
+	}
+
+	lzpRatio := float64(len(lzpCompressed)) / float64(len(data))
+	lz77Ratio := float64(len(lz77Compressed)) / float64(len(data))
+	t.Logf("LZP %.2f%%, LZ77 %.2f%% (%d bytes)", lzpRatio*100, lz77Ratio*100, len(data))
+
+	// 距離を出力しない分、マッチの探索は単純だが、圧縮率は同程度になる
+	if lzpRatio >= 1 || lzpRatio > lz77Ratio*1.25 {
+		t.Errorf("Expected LZP ratio close to LZ77: LZP %.2f%%, LZ77 %.2f%%", lzpRatio*100, lz77Ratio*100)
+	}
+}
+
+func TestLZP_InvalidData(t *testing.T) {
+	compressor := NewCompressor()
+	valid, _ := compressor.Compress([]byte("abcabcabcabc"))
+
+	tests := map[string]struct {
+		data   []byte
+		offset int64
+	}{
+		"元のサイズがない":    {[]byte{0x80}, 0},
+		"リテラルが途中で終わる": {[]byte{3, 'a', 'b'}, 3},
+		"マッチ長が長すぎる":   {append([]byte{7}, valid[1:]...), 7},
+		"余分なデータ":      {append(append([]byte(nil), valid...), 0, 0), 7},
+	}
+	for name, tt := range tests {
+		_, err := compressor.Decompress(tt.data)
+		var decodeErr *common.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected DecodeError, got %v", name, err)
+			continue
+		}
+		if decodeErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got %d (%v)", name, tt.offset, decodeErr.Offset, err)
+		}
+	}
+}
+
+func TestLZP_DecompressLimits(t *testing.T) {
+	compressed, _ := NewCompressor().Compress(bytes.Repeat([]byte("abc"), 1000))
+
+	_, err := NewCompressor().DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 100})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	_, err = NewCompressor().DecompressWithOptions(compressed, common.DecompressOptions{Budget: common.NewBudget(4096)})
+	if !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func BenchmarkLZPCompress(b *testing.B) {
+	compressor := NewCompressor()
+	data := englishText(5000, 3)
+
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := compressor.Compress(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLZ77CompressSameText は BenchmarkLZPCompress と同じデータでのLZ77の速度です
+func BenchmarkLZ77CompressSameText(b *testing.B) {
+	compressor := lz77.NewCompressor()
+	data := englishText(5000, 3)
+
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := compressor.Compress(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
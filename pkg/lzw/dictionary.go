@@ -0,0 +1,151 @@
+package lzw
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rootCount は最初から辞書にある1バイトのフレーズの数です（インデックス0〜255）
+const rootCount = 256
+
+// PhraseEntry は辞書の1つのフレーズです
+// フレーズは親のフレーズの後ろに Byte を1つ付け加えたもので、辞書全体はトライ木になります。
+type PhraseEntry struct {
+	Index  int  // フレーズのインデックス（圧縮データに出力される符号）
+	Parent int  // 親のフレーズのインデックス（1バイトのフレーズでは -1）
+	Byte   byte // 親のフレーズに付け加える最後のバイト
+	Length int  // フレーズの長さ（バイト数）
+}
+
+// phraseKey は (親のインデックス, 次のバイト) の組です
+type phraseKey struct {
+	parent int
+	b      byte
+}
+
+// Dictionary はLZWのフレーズ辞書です
+// (親のインデックス, 次のバイト) からインデックスへのハッシュマップで、フレーズの延長を
+// 1回の参照で調べられます。フレーズそのものは保存せず、親をたどって復元します。
+type Dictionary struct {
+	codes   map[phraseKey]int
+	entries []PhraseEntry
+}
+
+// NewDictionary は256個の1バイトのフレーズだけを持つ辞書を作成します
+func NewDictionary() *Dictionary {
+	d := &Dictionary{
+		codes:   make(map[phraseKey]int),
+		entries: make([]PhraseEntry, rootCount, rootCount*2),
+	}
+	for i := range d.entries {
+		d.entries[i] = PhraseEntry{Index: i, Parent: -1, Byte: byte(i), Length: 1}
+	}
+	return d
+}
+
+// Len は辞書のフレーズの数を返します（1バイトのフレーズを含む）
+func (d *Dictionary) Len() int {
+	return len(d.entries)
+}
+
+// Lookup はフレーズ parent の後ろに b を付け加えたフレーズのインデックスを返します
+func (d *Dictionary) Lookup(parent int, b byte) (int, bool) {
+	index, ok := d.codes[phraseKey{parent, b}]
+	return index, ok
+}
+
+// Add はフレーズ parent の後ろに b を付け加えたフレーズを追加し、そのインデックスを返します
+func (d *Dictionary) Add(parent int, b byte) int {
+	index := len(d.entries)
+	d.entries = append(d.entries, PhraseEntry{
+		Index:  index,
+		Parent: parent,
+		Byte:   b,
+		Length: d.entries[parent].Length + 1,
+	})
+	d.codes[phraseKey{parent, b}] = index
+	return index
+}
+
+// Phrase はインデックス index のフレーズを返します
+func (d *Dictionary) Phrase(index int) []byte {
+	return d.appendPhrase(nil, index)
+}
+
+// appendPhrase はフレーズを dst の後ろに追加します
+// 親をたどると末尾から順に得られるため、先に長さ分を確保して後ろから埋めます
+func (d *Dictionary) appendPhrase(dst []byte, index int) []byte {
+	start := len(dst)
+	dst = append(dst, make([]byte, d.entries[index].Length)...)
+	for i := len(dst) - 1; i >= start; i-- {
+		dst[i] = d.entries[index].Byte
+		index = d.entries[index].Parent
+	}
+	return dst
+}
+
+// firstByte はフレーズの先頭のバイトを返します（1バイトのフレーズのインデックスはバイトの値）
+func (d *Dictionary) firstByte(index int) byte {
+	for d.entries[index].Parent >= 0 {
+		index = d.entries[index].Parent
+	}
+	return byte(index)
+}
+
+// Snapshot は圧縮中に追加されたフレーズをインデックス順に返します
+// 最初からある1バイトのフレーズ（0〜255）は含みません。
+func (d *Dictionary) Snapshot() []PhraseEntry {
+	return append([]PhraseEntry(nil), d.entries[rootCount:]...)
+}
+
+// WriteDOT は辞書のトライ木をGraphvizのDOT形式で w に書き込みます
+// 追加されたフレーズと、その祖先になっている1バイトのフレーズだけを出力します。
+// 各ノードのラベルはインデックスとフレーズ、辺のラベルは付け加えるバイトです。
+//
+//	dot -Tsvg trie.dot -o trie.svg
+func (d *Dictionary) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph lzw {\n")
+	sb.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	sb.WriteString("\troot [label=\"\", shape=point];\n")
+
+	used := make([]bool, rootCount)
+	for _, e := range d.entries[rootCount:] {
+		if e.Parent < rootCount {
+			used[e.Parent] = true
+		}
+	}
+	for i, ok := range used {
+		if ok {
+			fmt.Fprintf(&sb, "\tn%d [label=\"%d: %s\"];\n", i, i, dotEscape([]byte{byte(i)}))
+			fmt.Fprintf(&sb, "\troot -> n%d [label=\"%s\"];\n", i, dotEscape([]byte{byte(i)}))
+		}
+	}
+	for _, e := range d.entries[rootCount:] {
+		fmt.Fprintf(&sb, "\tn%d [label=\"%d: %s\"];\n", e.Index, e.Index, dotEscape(d.Phrase(e.Index)))
+		fmt.Fprintf(&sb, "\tn%d -> n%d [label=\"%s\"];\n", e.Parent, e.Index, dotEscape([]byte{e.Byte}))
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// dotEscape はバイト列をDOTの文字列の中に書ける形にします
+// 表示できないバイトは \xNN の形で表します。
+func dotEscape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c >= 0x20 && c < 0x7F:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "\\\\x%02X", c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,102 @@
+package lzw
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDictionary_SnapshotTextbook(t *testing.T) {
+	// 教科書のLZWの例で追加されるフレーズ（256以降）
+	expected := []struct {
+		phrase string
+		parent int
+	}{
+		{"TO", 'T'}, {"OB", 'O'}, {"BE", 'B'}, {"EO", 'E'}, {"OR", 'O'},
+		{"RN", 'R'}, {"NO", 'N'}, {"OT", 'O'}, {"TT", 'T'}, {"TOB", 256},
+	}
+
+	d := BuildDictionary([]byte("TOBEORNOTTOBE"))
+	snapshot := d.Snapshot()
+	if len(snapshot) != len(expected) {
+		t.Fatalf("Expected %d phrases, got %d: %+v", len(expected), len(snapshot), snapshot)
+	}
+	for i, e := range snapshot {
+		want := expected[i]
+		last := want.phrase[len(want.phrase)-1]
+		if e.Index != 256+i || e.Parent != want.parent || e.Byte != last || e.Length != len(want.phrase) {
+			t.Errorf("phrase %d: expected {%d %d %q %d}, got %+v", i, 256+i, want.parent, last, len(want.phrase), e)
+		}
+		if got := string(d.Phrase(e.Index)); got != want.phrase {
+			t.Errorf("phrase %d: expected %q, got %q", e.Index, want.phrase, got)
+		}
+	}
+
+	// Snapshot はコピーを返す
+	snapshot[0].Byte = 'X'
+	if d.Snapshot()[0].Byte != 'O' {
+		t.Error("Snapshot must not share the dictionary's entries")
+	}
+}
+
+func TestDictionary_LookupAdd(t *testing.T) {
+	d := NewDictionary()
+	if d.Len() != 256 {
+		t.Fatalf("Expected 256 root phrases, got %d", d.Len())
+	}
+	if _, ok := d.Lookup('a', 'b'); ok {
+		t.Error("Expected no phrase \"ab\" in a new dictionary")
+	}
+
+	ab := d.Add('a', 'b')
+	abc := d.Add(ab, 'c')
+	if got, ok := d.Lookup(ab, 'c'); !ok || got != abc {
+		t.Errorf("Expected Lookup(ab, 'c') = %d, got %d, %v", abc, got, ok)
+	}
+	if got := string(d.Phrase(abc)); got != "abc" {
+		t.Errorf("Expected \"abc\", got %q", got)
+	}
+	if got := d.firstByte(abc); got != 'a' {
+		t.Errorf("Expected first byte 'a', got %q", got)
+	}
+}
+
+func TestDictionary_WriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := BuildDictionary([]byte("TOBEORNOTTOBE")).WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	dot := buf.String()
+
+	if !strings.HasPrefix(dot, "digraph lzw {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("Expected a digraph, got:\n%s", dot)
+	}
+
+	// 根 + 親になっている1バイトのフレーズ（T, O, B, E, R, N）+ 追加された10フレーズ
+	nodes := regexp.MustCompile(`(?m)^\t(root|n\d+) \[`).FindAllString(dot, -1)
+	if len(nodes) != 1+6+10 {
+		t.Errorf("Expected 17 nodes, got %d:\n%s", len(nodes), dot)
+	}
+	edges := strings.Count(dot, " -> ")
+	if edges != 6+10 {
+		t.Errorf("Expected 16 edges, got %d", edges)
+	}
+	if !strings.Contains(dot, "\tn256 -> n265 [label=\"B\"];\n") || !strings.Contains(dot, "label=\"265: TOB\"") {
+		t.Errorf("Expected the TOB phrase under TO, got:\n%s", dot)
+	}
+}
+
+func TestDotEscape(t *testing.T) {
+	tests := map[string]string{
+		"abc":        "abc",
+		`a"b`:        `a\"b`,
+		`a\b`:        `a\\b`,
+		"\x00\n\xff": `\\x00\\x0A\\xFF`,
+	}
+	for input, expected := range tests {
+		if got := dotEscape([]byte(input)); got != expected {
+			t.Errorf("dotEscape(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package lzw implements LZW (Lempel-Ziv-Welch) compression.
+// LZWはLZ78系の辞書式圧縮で、入力を読みながら「既知のフレーズ + 次の1バイト」を
+// 新しいフレーズとして辞書に追加し、各フレーズを辞書のインデックスで出力します。
+// 辞書は展開側でも同じ手順で再構築できるため、圧縮データには含めません。
+package lzw
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "lzw",
+		Extensions:   []string{".lzw"},
+		Capabilities: common.CapDeterministic,
+		Description:  "LZW（読みながら作る辞書のフレーズの番号を出力）",
+		UseCase:      "同じ単語や並びが繰り返し現れるテキスト",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressor() },
+	})
+}
+
+const (
+	// maxCodeBits は符号の最大ビット数です
+	maxCodeBits = 16
+
+	// maxEntries は辞書のフレーズの最大数です（これに達した後は辞書を固定します）
+	maxEntries = 1 << maxCodeBits
+)
+
+// entryMemSize は辞書の1フレーズあたりのおおよそのメモリ量です（予算の計算に使用）
+// PhraseEntry とハッシュマップの要素の分です。
+const entryMemSize = 64
+
+// Compressor はLZW圧縮を実装します
+// 辞書は呼び出しごとに作成するため、複数のゴルーチンから同時に使用できます
+//
+// 形式: 元のサイズ(uvarint) + 符号の列。符号のビット数は、その符号を出力する時点の
+// 辞書の大きさから決まり（最初は8ビット、256, 512, ... を超えるごとに1ビット増える）、
+// 最大16ビットです。辞書が 2^16 フレーズに達した後はフレーズを追加しません。
+// 空のデータは元のサイズ0の1バイトになります。
+type Compressor struct {
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
+
+// NewCompressor は新しいCompressorを作成します
+func NewCompressor() *Compressor {
+	return &Compressor{}
+}
+
+// Name はアルゴリズム名を返します
+func (c *Compressor) Name() string {
+	return "LZW"
+}
+
+// formatVersion はLZWの圧縮形式のバージョンです
+const formatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (c *Compressor) FormatVersion() byte {
+	return formatVersion
+}
+
+// Overhead は圧縮データの先頭の元のサイズ(uvarint)のバイト数を返します（common.Overheader）
+func (c *Compressor) Overhead(data []byte) int {
+	return len(binary.AppendUvarint(nil, uint64(len(data))))
+}
+
+// Compress はLZWアルゴリズムでデータを圧縮します
+// 展開時に元のサイズを2GB未満に制限しているため、入力も2GB未満でなければなりません
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	if err := c.oneShot.Check(c.Name(), len(data)); err != nil {
+		return nil, err
+	}
+	if len(data) > math.MaxInt32 {
+		return nil, fmt.Errorf("LZW: input too large: %d bytes", len(data))
+	}
+
+	w := bitio.NewWriter()
+	encode(data, func(code, width int) {
+		w.WriteBits(uint64(code), width)
+	})
+
+	compressed := binary.AppendUvarint(nil, uint64(len(data)))
+	return append(compressed, w.Bytes()...), nil
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (c *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	return &Compressor{oneShot: common.NewOneShotLimit(n)}
+}
+
+// BuildDictionary は data を圧縮したときに作られる辞書を返します
+// 分析モードで辞書のトライ木を表示するために使用します。
+func BuildDictionary(data []byte) *Dictionary {
+	return encode(data, func(code, width int) {})
+}
+
+// encode はLZWで data を符号の列にし、各符号とそのビット数で emit を呼び出します
+// 圧縮後の辞書を返します。
+func encode(data []byte, emit func(code, width int)) *Dictionary {
+	d := NewDictionary()
+	if len(data) == 0 {
+		return d
+	}
+
+	current := int(data[0])
+	for _, b := range data[1:] {
+		if next, ok := d.Lookup(current, b); ok {
+			current = next
+			continue
+		}
+		emit(current, codeWidth(d.Len()))
+		if d.Len() < maxEntries {
+			d.Add(current, b)
+		}
+		current = int(b)
+	}
+	emit(current, codeWidth(d.Len()))
+	return d
+}
+
+// codeWidth は辞書のフレーズが n 個のときの符号のビット数を返します
+func codeWidth(n int) int {
+	return bits.Len(uint(n - 1))
+}
+
+// Decompress はLZW圧縮されたデータを展開します
+func (c *Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// ヘッダーの元のサイズで出力を、展開前に辞書の分の予算を確認します。符号は8ビット以上
+// なので、辞書のフレーズ数は圧縮データのバイト数 + 256 を超えません。
+func (c *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, common.NewDecodeError("LZW", data, 0, "empty compressed data")
+	}
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > math.MaxInt32 {
+		return nil, common.NewDecodeError("LZW", data, 0, "invalid original size")
+	}
+	if err := opts.ReserveOutput(int64(size), int64(size)); err != nil {
+		return nil, err
+	}
+	dictMemSize := int64(rootCount+min(len(data), maxEntries-rootCount)) * entryMemSize
+	if err := opts.Budget.Reserve(dictMemSize); err != nil {
+		return nil, err
+	}
+	defer opts.Budget.Release(dictMemSize)
+
+	// ビット単位の形式なので、エラーの位置は読み込み中の符号を含むバイトの位置
+	r := bitio.NewReader(data[n:])
+	offset := func(bitPos int) int { return n + bitPos/8 }
+
+	d := NewDictionary()
+	// 長いフレーズは少ないビットで大きな出力になるため、最初の確保は入力の大きさに抑える
+	result := make([]byte, 0, min(int(size), 8*len(data)))
+
+	prev := -1
+	for len(result) < int(size) {
+		// 展開側は1つ前の符号のフレーズを、次の符号を読んでから追加するため、
+		// 圧縮側が符号を出力した時点の辞書は展開側より1つ大きい
+		entries := d.Len()
+		if prev >= 0 {
+			entries = min(entries+1, maxEntries)
+		}
+
+		fieldPos := r.Position()
+		value, err := r.ReadBits(codeWidth(entries))
+		if err != nil {
+			return nil, common.NewDecodeError("LZW", data, offset(fieldPos), "missing code")
+		}
+		code := int(value)
+		if code >= entries {
+			return nil, common.NewDecodeError("LZW", data, offset(fieldPos),
+				"invalid code %d (dictionary has %d phrases)", code, entries)
+		}
+
+		if prev >= 0 && d.Len() < maxEntries {
+			// code がまだない場合（直前のフレーズ + その先頭のバイト）も、先頭のバイトは同じ
+			first := d.firstByte(prev)
+			if code < d.Len() {
+				first = d.firstByte(code)
+			}
+			d.Add(prev, first)
+		}
+
+		if d.entries[code].Length > int(size)-len(result) {
+			return nil, common.NewDecodeError("LZW", data, offset(fieldPos),
+				"phrase length %d exceeds remaining output %d", d.entries[code].Length, int(size)-len(result))
+		}
+		result = d.appendPhrase(result, code)
+		prev = code
+	}
+
+	// 最後のバイトの余りビットより多く残っている場合は不正
+	if r.Remaining() >= 8 {
+		return nil, common.NewDecodeError("LZW", data, offset(r.Position()), "%d trailing bits", r.Remaining())
+	}
+	return result, nil
+}
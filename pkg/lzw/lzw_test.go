@@ -0,0 +1,152 @@
+package lzw
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+func TestLZW_RoundTrip(t *testing.T) {
+	compressor := NewCompressor()
+
+	tests := map[string][]byte{
+		"empty":    {},
+		"single":   []byte("a"),
+		"textbook": []byte("TOBEORNOTTOBEORTOBEORNOT"),
+		"kwkwk":    []byte("aaaaaaaaaaaaaaaa"),
+		"binary":   testcorpus.Random(4096, 1),
+		"long-run": bytes.Repeat([]byte{'x'}, 10000),
+		// 辞書が 2^16 フレーズに達し、固定された後も展開できる
+		"dictionary-full": testcorpus.Random(200000, 2),
+	}
+	for _, sample := range testcorpus.Samples() {
+		tests["corpus-"+sample.Name] = sample.Data
+	}
+
+	for name, data := range tests {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: Compress failed: %v", name, err)
+		}
+		decompressed, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", name, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestLZW_EmptyInput(t *testing.T) {
+	compressor := NewCompressor()
+
+	// 空のデータは元のサイズ0の1バイトになり、空の圧縮データとは区別される
+	compressed, err := compressor.Compress(nil)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !bytes.Equal(compressed, []byte{0}) {
+		t.Errorf("Expected [0], got %v", compressed)
+	}
+	if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for empty compressed data, got %v", err)
+	}
+}
+
+func TestLZW_TextbookCodes(t *testing.T) {
+	// 教科書のLZWの例: 2回目の TO と BE は辞書のフレーズとして出力される
+	var codes, widths []int
+	encode([]byte("TOBEORNOTTOBE"), func(code, width int) {
+		codes = append(codes, code)
+		widths = append(widths, width)
+	})
+
+	expected := []int{'T', 'O', 'B', 'E', 'O', 'R', 'N', 'O', 'T', 256, 258}
+	if len(codes) != len(expected) {
+		t.Fatalf("Expected %d codes, got %d: %v", len(expected), len(codes), codes)
+	}
+	for i := range expected {
+		if codes[i] != expected[i] {
+			t.Errorf("code %d: expected %d, got %d", i, expected[i], codes[i])
+		}
+	}
+
+	// 最初の符号だけは辞書が256フレーズなので8ビット、以降は9ビット
+	if widths[0] != 8 {
+		t.Errorf("Expected first code width 8, got %d", widths[0])
+	}
+	for i, w := range widths[1:] {
+		if w != 9 {
+			t.Errorf("code %d: expected width 9, got %d", i+1, w)
+		}
+	}
+}
+
+func TestLZW_CodeWidth(t *testing.T) {
+	tests := map[int]int{256: 8, 257: 9, 512: 9, 513: 10, maxEntries: maxCodeBits}
+	for n, expected := range tests {
+		if got := codeWidth(n); got != expected {
+			t.Errorf("codeWidth(%d): expected %d, got %d", n, expected, got)
+		}
+	}
+}
+
+func TestLZW_InvalidData(t *testing.T) {
+	compressor := NewCompressor()
+	valid, _ := compressor.Compress([]byte("abcabcabcabc"))
+	abc, _ := compressor.Compress([]byte("abc"))
+
+	tests := map[string]struct {
+		data   []byte
+		offset int64
+	}{
+		"元のサイズがない":  {[]byte{0x80}, 0},
+		"符号が途中で終わる": {[]byte{3, 'a'}, 2},
+		"辞書にない符号":   {[]byte{3, 'a', 0xFF, 0x80}, 2},
+		"フレーズが長すぎる": {append([]byte{4}, valid[1:]...), 4},
+		"余分なデータ":    {append(append([]byte(nil), abc...), 0, 0), 4},
+	}
+	for name, tt := range tests {
+		_, err := compressor.Decompress(tt.data)
+		var decodeErr *common.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expected DecodeError, got %v", name, err)
+			continue
+		}
+		if decodeErr.Offset != tt.offset {
+			t.Errorf("%s: expected offset %d, got %d (%v)", name, tt.offset, decodeErr.Offset, err)
+		}
+	}
+}
+
+func TestLZW_DecompressLimits(t *testing.T) {
+	compressed, _ := NewCompressor().Compress(bytes.Repeat([]byte("abc"), 1000))
+
+	_, err := NewCompressor().DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 100})
+	if !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("Expected ErrOutputTooLarge, got %v", err)
+	}
+	_, err = NewCompressor().DecompressWithOptions(compressed, common.DecompressOptions{Budget: common.NewBudget(4096)})
+	if !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func BenchmarkLZWCompress(b *testing.B) {
+	compressor := NewCompressor()
+	var data []byte
+	for _, sample := range testcorpus.Samples() {
+		data = append(data, sample.Data...)
+	}
+
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := compressor.Compress(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/pipeline"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// RLEで連続するバイトをまとめてから、LZ77で繰り返しを参照に置き換えます
+// 展開は逆の順に行います。
+func Example_pipeline() {
+	var data []byte
+	for i := range 20 {
+		data = fmt.Appendf(data, "%s\nrequest %d served%s200\n", strings.Repeat("-", 60), i, strings.Repeat(" ", 30))
+	}
+
+	p := pipeline.NewCompressor(rle.NewCompressor(), lz77.NewStreamCompressor())
+	compressed, err := p.Compress(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	decompressed, err := p.Decompress(compressed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rleOnly, err := rle.NewCompressor().Compress(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(p.Name())
+	fmt.Printf("rle: %d -> %d bytes\n", len(data), len(rleOnly))
+	fmt.Printf("rle + lz77: %d -> %d bytes\n", len(data), len(compressed))
+	fmt.Println(bytes.Equal(decompressed, data))
+	// Output:
+	// Run-Length Encoding (RLE) + LZ77
+	// rle: 2230 -> 898 bytes
+	// rle + lz77: 2230 -> 352 bytes
+	// true
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// 圧縮データのヘッダー
+//
+//	マジック "TZP" + バージョン(1バイト) + 段の数(1バイト) + 段ごとに 番号(1バイト)
+//	+ 番号が0の段だけ 名前の長さ(1バイト) + 名前（Compressor.Name）
+//
+// 番号は common.AlgorithmID の登録名の番号で、圧縮の順に並べます。登録していない段
+// （フィルタや独自の Compressor）は0と Name を記録し、展開時の確認だけに使います。
+const (
+	// Magic はパイプラインの圧縮データの先頭のマジックです
+	Magic = "TZP"
+
+	// headerVersion はヘッダーの形式のバージョンです
+	headerVersion = 1
+
+	// maxStages は1つのパイプラインの最大の段の数です
+	maxStages = 255
+
+	// maxStageName はヘッダーに記録できる登録していない段の名前の最大のバイト数です
+	maxStageName = 255
+)
+
+var (
+	// ErrHeader はパイプラインのヘッダーがないか、形式が不正な場合のエラーです
+	ErrHeader = errors.New("pipeline: invalid header")
+
+	// ErrStageMismatch は圧縮データに記録された段と、展開に使うパイプラインの段が異なる場合のエラーです
+	ErrStageMismatch = errors.New("pipeline: stages do not match")
+
+	// ErrUnknownStage はヘッダーの段の番号を知らないか、その段を組み立てられない場合のエラーです
+	ErrUnknownStage = errors.New("pipeline: unknown stage")
+)
+
+func init() {
+	common.RegisterAutoFormat(common.AutoFormat{Name: "pipeline", Magic: Magic, Decompress: DecompressAuto})
+}
+
+// stageID はヘッダーに記録する段の番号です
+type stageID struct {
+	id   byte   // common.AlgorithmID の番号（登録していない段は0）
+	name string // 登録名（番号が0の場合は Compressor.Name）
+}
+
+// describe は段 c の stageID を返します
+func describe(c common.Compressor) stageID {
+	if name, ok := common.RegisteredName(c); ok {
+		if id, ok := common.AlgorithmID(name); ok {
+			return stageID{id: id, name: name}
+		}
+	}
+	return stageID{name: c.Name()}
+}
+
+func (s stageID) String() string {
+	if s.id == 0 {
+		return fmt.Sprintf("%q", s.name)
+	}
+	return s.name
+}
+
+// formatStages は段の一覧を "[rle huffman]" の形式で返します
+func formatStages(ids []stageID) string {
+	names := make([]string, len(ids))
+	for i, s := range ids {
+		names[i] = s.String()
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// appendHeader は ids のヘッダーを dst に追加します
+func appendHeader(dst []byte, ids []stageID) []byte {
+	dst = append(dst, Magic...)
+	dst = append(dst, headerVersion, byte(len(ids)))
+	for _, s := range ids {
+		dst = append(dst, s.id)
+		if s.id == 0 {
+			name := s.name[:min(len(s.name), maxStageName)]
+			dst = append(dst, byte(len(name)))
+			dst = append(dst, name...)
+		}
+	}
+	return dst
+}
+
+// headerReader はヘッダーを読み込む入力です（bytes.Reader、bufio.Reader）
+type headerReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readHeader はヘッダーを読み込み、記録された段を圧縮の順に返します
+// 番号の表にない番号は ErrUnknownStage です。
+func readHeader(r headerReader) ([]stageID, error) {
+	var head [len(Magic) + 2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("%w: missing header", ErrHeader)
+	}
+	if string(head[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrHeader, head[:len(Magic)])
+	}
+	if version := head[len(Magic)]; version != headerVersion {
+		return nil, fmt.Errorf("%w: %w", ErrHeader, &common.ErrUnsupportedVersion{Format: "pipeline", Have: version, Max: headerVersion})
+	}
+	count := int(head[len(Magic)+1])
+	if count == 0 {
+		return nil, fmt.Errorf("%w: no stages", ErrHeader)
+	}
+
+	ids := make([]stageID, count)
+	for i := range ids {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated stage list", ErrHeader)
+		}
+		if id != 0 {
+			name, ok := common.AlgorithmByID(id)
+			if !ok {
+				return nil, fmt.Errorf("%w: stage %d has unknown algorithm ID %d", ErrUnknownStage, i+1, id)
+			}
+			ids[i] = stageID{id: id, name: name}
+			continue
+		}
+		length, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated stage list", ErrHeader)
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("%w: truncated stage list", ErrHeader)
+		}
+		ids[i] = stageID{name: string(name)}
+	}
+	return ids, nil
+}
+
+// checkStages は圧縮データに記録された段 recorded が p の段と同じ順序で一致するかを確認します
+func (p *Compressor) checkStages(recorded []stageID) error {
+	if len(recorded) == len(p.ids) {
+		same := true
+		for i, s := range recorded {
+			if s.id != p.ids[i].id || s.id == 0 && s.name != p.ids[i].name {
+				same = false
+				break
+			}
+		}
+		if same {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: data was compressed with %s, this pipeline has %s",
+		ErrStageMismatch, formatStages(recorded), formatStages(p.ids))
+}
+
+// DecompressAuto はヘッダーに記録された段からパイプラインを組み立てて展開します
+// common.DecompressAuto からも呼び出されます。段はすべて common.New で作成するため、
+// 登録していない段（番号が0）を含むデータや、段のパッケージがリンクされていない場合は
+// ErrUnknownStage を返します。
+func DecompressAuto(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	ids, err := readHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	stages := make([]common.Compressor, len(ids))
+	for i, s := range ids {
+		if s.id == 0 {
+			return nil, fmt.Errorf("%w: stage %d (%s) is not a registered algorithm", ErrUnknownStage, i+1, s)
+		}
+		if stages[i], err = common.New(s.name); err != nil {
+			return nil, fmt.Errorf("%w: stage %d: %w", ErrUnknownStage, i+1, err)
+		}
+	}
+	return NewCompressor(stages...).DecompressWithOptions(data, opts)
+}
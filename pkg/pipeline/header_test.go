@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+var headerData = bytes.Repeat([]byte("aaaabbbcc tinyzipzap header "), 200)
+
+func TestHeader_RecordsStages(t *testing.T) {
+	p := NewCompressor(rle.NewCompressor(), huffman.NewCompressor())
+	compressed, err := p.Compress(headerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := readHeader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("readHeader failed: %v", err)
+	}
+	if got := formatStages(ids); got != "[rle huffman]" {
+		t.Errorf("Recorded stages = %s, want [rle huffman]", got)
+	}
+}
+
+func TestHeader_StageMismatch(t *testing.T) {
+	compressed, err := NewCompressor(rle.NewCompressor(), huffman.NewCompressor()).Compress(headerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Compressor{
+		NewCompressor(huffman.NewCompressor(), rle.NewCompressor()),
+		NewCompressor(rle.NewCompressor()),
+		NewCompressor(rle.NewCompressor(), lz77.NewCompressor()),
+	} {
+		if _, err := p.Decompress(compressed); !errors.Is(err, ErrStageMismatch) {
+			t.Errorf("%s: expected ErrStageMismatch, got %v", p.Name(), err)
+		}
+		var out bytes.Buffer
+		if err := p.DecompressStream(bytes.NewReader(compressed), &out); !errors.Is(err, ErrStageMismatch) {
+			t.Errorf("%s: stream: expected ErrStageMismatch, got %v", p.Name(), err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: stream wrote %d bytes before detecting the mismatch", p.Name(), out.Len())
+		}
+	}
+
+	// 登録していない段は名前で確認する
+	unregistered := NewCompressor(rle.NewCompressor(), batchStage{huffman.NewCompressor()})
+	compressed, err = unregistered.Compress(headerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := unregistered.Decompress(compressed); err != nil || !bytes.Equal(got, headerData) {
+		t.Errorf("Unregistered stage: round trip failed (err %v)", err)
+	}
+	other := NewCompressor(rle.NewCompressor(), batchStage{lz77.NewCompressor()})
+	if _, err := other.Decompress(compressed); !errors.Is(err, ErrStageMismatch) {
+		t.Errorf("Unregistered stage with another name: expected ErrStageMismatch, got %v", err)
+	}
+}
+
+func TestHeader_Invalid(t *testing.T) {
+	p := NewCompressor(rle.NewCompressor())
+	rleID, _ := common.AlgorithmID("rle")
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrHeader},
+		{"no header", []byte("abcdef"), ErrHeader},
+		{"no stages", []byte{'T', 'Z', 'P', headerVersion, 0}, ErrHeader},
+		{"truncated", []byte{'T', 'Z', 'P', headerVersion, 2, rleID}, ErrHeader},
+		{"truncated name", []byte{'T', 'Z', 'P', headerVersion, 1, 0, 5, 'a'}, ErrHeader},
+		{"unknown stage ID", []byte{'T', 'Z', 'P', headerVersion, 1, 200}, ErrUnknownStage},
+	}
+	for _, tt := range tests {
+		if _, err := p.Decompress(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if _, err := DecompressAuto(tt.data, common.DecompressOptions{}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: DecompressAuto: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	var versionErr *common.ErrUnsupportedVersion
+	_, err := p.Decompress([]byte{'T', 'Z', 'P', headerVersion + 1, 1, rleID})
+	if !errors.Is(err, ErrHeader) || !errors.As(err, &versionErr) {
+		t.Errorf("Expected ErrUnsupportedVersion for a newer header, got %v", err)
+	}
+}
+
+func TestDecompressAuto(t *testing.T) {
+	for _, p := range []*Compressor{
+		NewCompressor(rle.NewCompressor(), huffman.NewCompressor()),
+		NewCompressor(lz77.NewStreamCompressor(), huffman.NewCompressor(), rle.NewCompressor()),
+	} {
+		compressed, err := p.Compress(headerData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := common.DecompressAuto(compressed, common.DecompressOptions{})
+		if err != nil || !bytes.Equal(got, headerData) {
+			t.Errorf("%s: DecompressAuto round trip failed (err %v)", p.Name(), err)
+		}
+		_, err = common.DecompressAuto(compressed, common.DecompressOptions{MaxOutputSize: 100})
+		if !errors.Is(err, common.ErrOutputTooLarge) {
+			t.Errorf("%s: expected ErrOutputTooLarge, got %v", p.Name(), err)
+		}
+	}
+
+	// 登録していない段は組み立てられない
+	compressed, err := NewCompressor(batchStage{&failingStage{after: 1 << 30}}).Compress(headerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := common.DecompressAuto(compressed, common.DecompressOptions{}); !errors.Is(err, ErrUnknownStage) {
+		t.Errorf("Expected ErrUnknownStage for an unregistered stage, got %v", err)
+	}
+	if _, err := common.DecompressAuto([]byte("not compressed"), common.DecompressOptions{}); !errors.Is(err, common.ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestCompressor_NestedPipeline(t *testing.T) {
+	flat := NewCompressor(rle.NewCompressor(), lz77.NewCompressor(), huffman.NewCompressor())
+	nested := NewCompressor(NewCompressor(rle.NewCompressor(), lz77.NewCompressor()), huffman.NewCompressor())
+	if nested.Name() != flat.Name() {
+		t.Errorf("Nested name = %q, want %q", nested.Name(), flat.Name())
+	}
+
+	want, err := flat.Compress(headerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := nested.Compress(headerData)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Expected the nested pipeline to produce the flat output (err %v)", err)
+	}
+	if restored, err := flat.Decompress(got); err != nil || !bytes.Equal(restored, headerData) {
+		t.Errorf("Flat pipeline could not decompress nested output (err %v)", err)
+	}
+}
+
+func TestNewCompressor_TooManyStages(t *testing.T) {
+	stages := make([]common.Compressor, maxStages+1)
+	for i := range stages {
+		stages[i] = rle.NewCompressor()
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for too many stages")
+		}
+	}()
+	NewCompressor(stages...)
+}
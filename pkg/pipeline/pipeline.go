@@ -0,0 +1,287 @@
+// Package pipeline chains compressors into a single multi-stage compressor.
+// 前の段の圧縮結果を次の段の入力にして、複数のアルゴリズムを順に適用します
+// （例: RLE でランをまとめてから LZ77 で繰り返しを参照にする）。展開は逆の順に行います。
+// common.StreamCompressor を実装した段どうしは io.Pipe でつなぎ、段の間のデータを
+// すべてメモリに保持せずに流します。実装していない段（静的なHuffmanなど）だけ、
+// その段の入力全体をメモリに読み込みます。
+//
+// 圧縮データの先頭には段の番号を圧縮の順に記録したヘッダーを置き、展開時にパイプラインの
+// 段と一致するかを確認します。DecompressAuto（common.DecompressAuto）はヘッダーから
+// パイプラインを組み立てて展開します。
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// pipeBufferSize は段の出力を次の段に渡すときのバッファサイズです
+// 小さな書き込みのたびにゴルーチンを切り替えないようにまとめます。
+const pipeBufferSize = 32 * 1024
+
+// ErrNoStages は段が1つもないパイプラインで圧縮・展開しようとしたことを表します
+var ErrNoStages = errors.New("pipeline: no stages")
+
+// StageError はパイプラインのいずれかの段で起きたエラーです
+// 1つの段が失敗すると他の段も止まりますが、返すのは最初に失敗した段のエラーです。
+type StageError struct {
+	Stage int    // 1から数えた段の番号（圧縮の順）
+	Name  string // 段のアルゴリズム名
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("pipeline: stage %d (%s): %v", e.Stage, e.Name, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Compressor は複数の段を順に適用する Compressor です
+// 段は構築後に変更しないため、段が複数のゴルーチンから同時に使えるなら
+// Compressor も同時に使用できます。
+type Compressor struct {
+	stages []common.Compressor
+	ids    []stageID // ヘッダーに記録する各段の番号
+}
+
+// NewCompressor は stages を圧縮の順に適用する Compressor を作成します
+// パイプラインを段にした場合は、その段を展開して1つのパイプラインにします（入れ子の
+// パイプラインと同じ結果で、ヘッダーは1つです）。段が maxStages を超える場合は panic します。
+func NewCompressor(stages ...common.Compressor) *Compressor {
+	p := &Compressor{}
+	for _, stage := range stages {
+		if inner, ok := stage.(*Compressor); ok {
+			p.stages = append(p.stages, inner.stages...)
+			p.ids = append(p.ids, inner.ids...)
+			continue
+		}
+		p.stages = append(p.stages, stage)
+		p.ids = append(p.ids, describe(stage))
+	}
+	if len(p.stages) > maxStages {
+		panic(fmt.Sprintf("pipeline: %d stages exceeds the limit of %d", len(p.stages), maxStages))
+	}
+	return p
+}
+
+// Name は段のアルゴリズム名を " + " でつないだものを返します
+func (p *Compressor) Name() string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name()
+	}
+	return strings.Join(names, " + ")
+}
+
+// Compress はデータを各段で順に圧縮します
+func (p *Compressor) Compress(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := p.CompressStream(bytes.NewReader(data), &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Decompress は各段で逆の順に展開します
+func (p *Compressor) Decompress(data []byte) ([]byte, error) {
+	return p.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 出力サイズの上限は最後に展開する段（圧縮の1段目）の出力に適用し、途中の段の出力は
+// 元のデータより大きいことがあるため制限しません。予算はすべての段で共有します。
+// ヘッダーの段が p の段と異なる場合は、段で展開する前に ErrStageMismatch を返します。
+func (p *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	src := bytes.NewReader(data)
+	if err := p.readStages(src); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	if opts.MaxOutputSize > 0 {
+		dst = &limitWriter{w: &out, limit: opts.MaxOutputSize}
+	}
+	err := p.run(src, dst, true, func(i int, stage common.Compressor, r io.Reader, w io.Writer) error {
+		if sc, ok := stage.(common.StreamCompressor); ok {
+			return sc.DecompressStream(r, w)
+		}
+		input, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		stageOpts := common.DecompressOptions{Budget: opts.Budget}
+		if i == 0 {
+			stageOpts.MaxOutputSize = opts.MaxOutputSize
+		}
+		output, err := common.DecompressWithOptions(stage, input, stageOpts)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// CompressStream は src を各段で順に圧縮して dst に書き込みます（common.StreamCompressor）
+// 段はそれぞれのゴルーチンで同時に動き、書き込み先の段が読み込むまで待つため、
+// ストリームの段どうしの間にたまるデータはバッファの大きさまでです。
+func (p *Compressor) CompressStream(src io.Reader, dst io.Writer) error {
+	if len(p.stages) == 0 {
+		return ErrNoStages
+	}
+	if _, err := dst.Write(appendHeader(nil, p.ids)); err != nil {
+		return err
+	}
+	return p.run(src, dst, false, func(_ int, stage common.Compressor, r io.Reader, w io.Writer) error {
+		if sc, ok := stage.(common.StreamCompressor); ok {
+			return sc.CompressStream(r, w)
+		}
+		input, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		output, err := stage.Compress(input)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	})
+}
+
+// DecompressStream は src を各段で逆の順に展開して dst に書き込みます（common.StreamCompressor）
+func (p *Compressor) DecompressStream(src io.Reader, dst io.Writer) error {
+	r := bufio.NewReader(src)
+	if err := p.readStages(r); err != nil {
+		return err
+	}
+	return p.run(r, dst, true, func(_ int, stage common.Compressor, r io.Reader, w io.Writer) error {
+		if sc, ok := stage.(common.StreamCompressor); ok {
+			return sc.DecompressStream(r, w)
+		}
+		input, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		output, err := stage.Decompress(input)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	})
+}
+
+// readStages は r からヘッダーを読み込み、記録された段が p の段と一致するかを確認します
+func (p *Compressor) readStages(r headerReader) error {
+	if len(p.stages) == 0 {
+		return ErrNoStages
+	}
+	recorded, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	return p.checkStages(recorded)
+}
+
+// stageFunc は1つの段で r を処理して w に書き込みます（i は段の添字）
+type stageFunc func(i int, stage common.Compressor, r io.Reader, w io.Writer) error
+
+// run は各段を io.Pipe でつないだゴルーチンで fn を実行し、すべての段が終わるまで待ちます
+// reverse の場合は最後の段から順に実行します（展開）。段が失敗すると、その段の入力と
+// 出力のパイプをそのエラーで閉じるため、前の段は書き込みで、後の段は読み込みで
+// エラーになって終了します。最初に失敗した段のエラーを StageError として返します。
+func (p *Compressor) run(src io.Reader, dst io.Writer, reverse bool, fn stageFunc) error {
+	if len(p.stages) == 0 {
+		return ErrNoStages
+	}
+	order := make([]int, len(p.stages))
+	for k := range order {
+		order[k] = k
+		if reverse {
+			order[k] = len(order) - 1 - k
+		}
+	}
+
+	var (
+		once  sync.Once
+		first error
+		wg    sync.WaitGroup
+	)
+	in := src
+	for k, i := range order {
+		stage := p.stages[i]
+		out := dst
+		var next *io.PipeReader
+		var pw *io.PipeWriter
+		if k < len(order)-1 {
+			next, pw = io.Pipe()
+			out = pw
+		}
+		r := in
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bw := bufio.NewWriterSize(out, pipeBufferSize)
+			err := fn(i, stage, r, bw)
+			if err == nil {
+				err = bw.Flush()
+			}
+			if err != nil {
+				// 他の段より先に記録してからパイプを閉じるため、最初に失敗した段が残る
+				err = &StageError{Stage: i + 1, Name: stage.Name(), Err: err}
+				once.Do(func() { first = err })
+			}
+			if pr, ok := r.(*io.PipeReader); ok {
+				if err == nil {
+					// 段が読み残した入力を読み捨て、前の段が書き込みで止まらないようにする
+					_, err = io.Copy(io.Discard, pr)
+				}
+				pr.CloseWithError(err)
+			}
+			if pw != nil {
+				pw.CloseWithError(err)
+			}
+		}()
+		in = next
+	}
+	wg.Wait()
+	return first
+}
+
+// limitWriter は limit バイトを超える書き込みを common.ErrOutputTooLarge で拒否します
+type limitWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.limit-l.n {
+		return 0, fmt.Errorf("%w: exceeds limit of %d bytes", common.ErrOutputTooLarge, l.limit)
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
+
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+	_ common.StreamCompressor    = (*Compressor)(nil)
+)
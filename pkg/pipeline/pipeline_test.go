@@ -0,0 +1,250 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+func TestCompressor_RoundTrip(t *testing.T) {
+	pipelines := []*Compressor{
+		NewCompressor(rle.NewCompressor(), lz77.NewStreamCompressor()),
+		NewCompressor(rle.NewCompressor(), huffman.NewCompressor()),
+		NewCompressor(lz77.NewCompressor(), huffman.NewCompressor(), rle.NewCompressor()),
+		NewCompressor(huffman.NewCompressor()),
+	}
+	for _, p := range pipelines {
+		for _, sample := range testcorpus.Samples() {
+			compressed, err := p.Compress(sample.Data)
+			if err != nil {
+				t.Fatalf("%s / %s: Compress failed: %v", p.Name(), sample.Name, err)
+			}
+			got, err := p.Decompress(compressed)
+			if err != nil || !bytes.Equal(got, sample.Data) {
+				t.Errorf("%s / %s: round trip failed (err %v)", p.Name(), sample.Name, err)
+			}
+
+			var streamed, restored bytes.Buffer
+			if err := p.CompressStream(bytes.NewReader(sample.Data), &streamed); err != nil {
+				t.Fatalf("%s / %s: CompressStream failed: %v", p.Name(), sample.Name, err)
+			}
+			if err := p.DecompressStream(&streamed, &restored); err != nil || !bytes.Equal(restored.Bytes(), sample.Data) {
+				t.Errorf("%s / %s: stream round trip failed (err %v)", p.Name(), sample.Name, err)
+			}
+		}
+	}
+}
+
+func TestCompressor_SameAsSequentialStages(t *testing.T) {
+	// バッチの段だけのパイプラインは、段を順に適用した結果と同じになる
+	data := bytes.Repeat([]byte("aaaabbbcc tinyzipzap "), 500)
+	first, _ := rle.NewCompressor().Compress(data)
+	want, _ := huffman.NewCompressor().Compress(first)
+
+	p := NewCompressor(rle.NewCompressor(), huffman.NewCompressor())
+	got, err := p.Compress(data)
+	header := appendHeader(nil, p.ids)
+	if err != nil || !bytes.HasPrefix(got, header) || !bytes.Equal(got[len(header):], want) {
+		t.Errorf("Expected the same output as applying the stages in order (err %v)", err)
+	}
+	if name := p.Name(); name != "Run-Length Encoding (RLE) + Huffman Coding" {
+		t.Errorf("Unexpected name %q", name)
+	}
+}
+
+func TestCompressor_Limits(t *testing.T) {
+	if _, err := NewCompressor().Compress([]byte("abc")); !errors.Is(err, ErrNoStages) {
+		t.Errorf("Expected ErrNoStages, got %v", err)
+	}
+
+	data := bytes.Repeat([]byte("abc"), 1000)
+	for _, p := range []*Compressor{
+		NewCompressor(lz77.NewStreamCompressor(), rle.NewCompressor()),
+		NewCompressor(huffman.NewCompressor(), lz77.NewCompressor()),
+	} {
+		compressed, _ := p.Compress(data)
+		_, err := p.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 100})
+		if !errors.Is(err, common.ErrOutputTooLarge) {
+			t.Errorf("%s: expected ErrOutputTooLarge, got %v", p.Name(), err)
+		}
+		var stageErr *StageError
+		if !errors.As(err, &stageErr) || stageErr.Stage != 1 {
+			t.Errorf("%s: expected the limit to apply to stage 1, got %v", p.Name(), err)
+		}
+	}
+}
+
+var errInjected = errors.New("injected failure")
+
+// failingStage は after バイトを処理した後で失敗する段です
+// batch の場合は StreamCompressor として振る舞わない（batchStage で包む）ために使います。
+type failingStage struct {
+	after int64
+}
+
+func (f *failingStage) Name() string { return "failing" }
+
+func (f *failingStage) Compress(data []byte) ([]byte, error) {
+	if int64(len(data)) > f.after {
+		return nil, errInjected
+	}
+	return data, nil
+}
+
+func (f *failingStage) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+func (f *failingStage) CompressStream(src io.Reader, dst io.Writer) error {
+	if _, err := io.CopyN(dst, src, f.after); err != nil {
+		return err
+	}
+	return errInjected
+}
+
+func (f *failingStage) DecompressStream(src io.Reader, dst io.Writer) error {
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// batchStage は StreamCompressor を隠し、バッチの段として使わせます
+type batchStage struct {
+	common.Compressor
+}
+
+// waitGoroutines はゴルーチンの数が before 以下に戻るまで待ちます
+func waitGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("Goroutines leaked: %d > %d\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCompressor_StageError(t *testing.T) {
+	stages := map[string]common.Compressor{
+		"stream": &failingStage{after: 64 << 10},
+		"batch":  batchStage{&failingStage{after: 64 << 10}},
+	}
+	for name, failing := range stages {
+		before := runtime.NumGoroutine()
+		p := NewCompressor(rle.NewCompressor(), failing, lz77.NewStreamCompressor())
+
+		// 段1の出力が段2の上限を超える大きさの入力
+		src := io.LimitReader(&patternReader{}, 8<<20)
+		err := p.CompressStream(src, io.Discard)
+		var stageErr *StageError
+		if !errors.As(err, &stageErr) || stageErr.Stage != 2 || stageErr.Name != "failing" || !errors.Is(err, errInjected) {
+			t.Errorf("%s: expected the injected error from stage 2, got %v", name, err)
+		}
+		if want := "pipeline: stage 2 (failing): injected failure"; err == nil || err.Error() != want {
+			t.Errorf("%s: expected %q, got %v", name, want, err)
+		}
+		waitGoroutines(t, before)
+	}
+
+	// 展開で壊れたデータを検出した段を報告する
+	before := runtime.NumGoroutine()
+	p := NewCompressor(rle.NewCompressor(), lz77.NewStreamCompressor())
+	compressed, _ := p.Compress(bytes.Repeat([]byte("abcd"), 1000))
+	compressed[len(compressed)/2] ^= 0xFF
+	_, err := p.Decompress(compressed[:len(compressed)-1])
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) {
+		t.Errorf("Expected a StageError for corrupt data, got %v", err)
+	}
+	waitGoroutines(t, before)
+}
+
+// patternReader は長いランと短いレコードが交互に続く合成データを無限に返します（メモリに保持しません）
+// RLE で小さくなってから LZ77 に渡るため、64MB でも短い時間で圧縮できます。
+type patternReader struct {
+	line []byte
+	pos  int
+	n    int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		if r.pos == len(r.line) {
+			r.line = fmt.Appendf(r.line[:0], "%s record=%03d\n", bytes.Repeat([]byte{'a' + byte(r.n%26)}, 1000+r.n%24), r.n%100)
+			r.pos = 0
+			r.n++
+		}
+		k := copy(p[written:], r.line[r.pos:])
+		r.pos += k
+		written += k
+	}
+	return written, nil
+}
+
+// heapProbe は読み込んだバイト数を数え、一定量ごとにGCの後のヒープの使用量を記録します
+type heapProbe struct {
+	r                 io.Reader
+	n, next, interval int64
+	peak              uint64
+}
+
+func (h *heapProbe) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.n += int64(n)
+	if h.n >= h.next {
+		h.next += h.interval
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		h.peak = max(h.peak, m.HeapAlloc)
+	}
+	return n, err
+}
+
+func TestCompressStream_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("64MBを圧縮するため -short では省略")
+	}
+	const size = 64 << 20
+	p := NewCompressor(rle.NewCompressor(), lz77.NewStreamCompressor())
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	probe := &heapProbe{r: io.LimitReader(&patternReader{}, size), interval: 4 << 20}
+	var compressed countingWriter
+	if err := p.CompressStream(probe, &compressed); err != nil {
+		t.Fatalf("CompressStream failed: %v", err)
+	}
+	if probe.n != size {
+		t.Fatalf("Read %d bytes, want %d", probe.n, size)
+	}
+
+	// 入力（64MB）や段の間のデータ全体ではなく、バッファの分だけ増える
+	growth := int64(probe.peak) - int64(before.HeapAlloc)
+	t.Logf("heap growth %s while compressing %s to %s", common.FormatBytes(growth), common.FormatBytes(size), common.FormatBytes(compressed.n))
+	if limit := int64(4 << 20); growth > limit {
+		t.Errorf("Heap grew by %d bytes, expected at most %d", growth, limit)
+	}
+}
+
+// countingWriter は書き込まれたバイト数だけを数えます
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,173 @@
+// Package report renders analysis and compression results through text/template.
+// 授業の配布資料などのために、データの分析結果（エントロピー、バイトの出現頻度）と
+// アルゴリズムごとの圧縮結果、トークンや符号の例を1つの構造体にまとめ、利用者が
+// 用意したテンプレート（既定はMarkdown）で出力します。CLIの出力をコピーする代わりに使います。
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/compare"
+)
+
+const (
+	// TopBytes は Histogram に含める出現回数の多いバイトの数です
+	TopBytes = 10
+
+	// SampleCount は各アルゴリズムの Samples の最大数です
+	SampleCount = 8
+)
+
+// Report はテンプレートに渡すデータです
+// フィールド名はテンプレートから参照されるため、変更しないでください（追加は可能です）。
+type Report struct {
+	Size       int         // 元のデータのサイズ (bytes)
+	Entropy    float64     // エントロピー (bits/byte)
+	MinSize    float64     // エントロピーから求めた理論的最小サイズ (bytes)
+	DataType   string      // 推定したデータの種類（common.DetectDataType）
+	Distinct   int         // 出現したバイトの種類数
+	Histogram  []ByteCount // 出現回数の多いバイト（多い順、同数はバイト値の順、最大 TopBytes 個）
+	Algorithms []Algorithm // アルゴリズムごとの結果（指定した順）
+}
+
+// ByteCount は1つのバイトの出現回数です
+type ByteCount struct {
+	Byte  byte
+	Char  string  // 表示用の文字（'a' や 0x0A）
+	Count int     // 出現回数
+	Share float64 // データ全体に占める割合 (0〜1)
+}
+
+// Algorithm は1つのアルゴリズムの圧縮結果です
+type Algorithm struct {
+	Name           string        // アルゴリズム名（Name() の値）
+	OriginalSize   int64         // 元のサイズ
+	CompressedSize int64         // 圧縮後のサイズ
+	Ratio          float64       // 圧縮率（圧縮後 / 元、0〜）
+	BitsPerByte    float64       // 元の1バイトあたりの圧縮後のビット数
+	CompressTime   time.Duration // 圧縮時間
+	DecompressTime time.Duration // 展開時間
+	Verified       bool          // 展開結果が元のデータと一致したか
+	Error          string        // 圧縮・展開のエラー（成功した場合は空）
+	SampleKind     string        // Samples の種類（"トークン"、"符号" など、Samples がなければ空）
+	Samples        []Sample      // トークンや符号の例（先頭から最大 SampleCount 個）
+}
+
+// Sample は入力の一部と、アルゴリズムがそれをどう表現したかの組です
+type Sample struct {
+	Input  string // 入力のバイト列（Go の引用符付き文字列）
+	Output string // トークンや符号の表示
+}
+
+//go:embed templates/default.md.tmpl
+var defaultTemplate string
+
+// Funcs はレポートのテンプレートで使える関数です
+// 独自のテンプレートも template.New(name).Funcs(report.Funcs()) で作成してから解析します。
+//
+//	bytes   int/int64 を "1.5 KB" のように表示する
+//	percent 0〜1 の値を "12.5%" のように表示する
+//	cell    Markdown の表のセルに入れられるよう "|" と改行をエスケープする
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"bytes": func(n any) string {
+			switch v := n.(type) {
+			case int:
+				return common.FormatBytes(int64(v))
+			case int64:
+				return common.FormatBytes(v)
+			default:
+				return fmt.Sprint(n)
+			}
+		},
+		"percent": func(x float64) string { return fmt.Sprintf("%.1f%%", x*100) },
+		"cell": func(s string) string {
+			return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+		},
+	}
+}
+
+// DefaultTemplate は既定のMarkdownのテンプレートを返します
+func DefaultTemplate() *template.Template {
+	return template.Must(template.New("default.md").Funcs(Funcs()).Parse(defaultTemplate))
+}
+
+// Build は data を分析し、各アルゴリズムで圧縮・展開・検証してレポートのデータを作成します
+func Build(data []byte, algos []common.Compressor) Report {
+	return BuildWithOptions(data, algos, compare.Options{})
+}
+
+// BuildWithOptions は opts の設定で圧縮・展開・検証して、Build と同じレポートのデータを作成します
+// 展開の制限は opts.Decompress で指定します（opts.NoVerify は無視し、常に検証します）。
+func BuildWithOptions(data []byte, algos []common.Compressor, opts compare.Options) Report {
+	r := Report{
+		Size:     len(data),
+		DataType: common.DetectDataType(data).Kind.String(),
+	}
+	if len(data) > 0 {
+		r.Entropy = common.CalculateEntropy(data)
+		r.MinSize = r.Entropy * float64(len(data)) / 8
+	}
+
+	counts := common.CountBytes(data)
+	r.Distinct = len(counts)
+	for b, n := range counts {
+		r.Histogram = append(r.Histogram, ByteCount{Byte: b, Char: charName(b), Count: n, Share: float64(n) / float64(len(data))})
+	}
+	sort.Slice(r.Histogram, func(i, j int) bool {
+		a, b := r.Histogram[i], r.Histogram[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Byte < b.Byte)
+	})
+	if len(r.Histogram) > TopBytes {
+		r.Histogram = r.Histogram[:TopBytes]
+	}
+
+	opts.NoVerify = false
+	results := compare.RunCompressors(data, algos, opts)
+	for i, result := range results.Results {
+		a := Algorithm{
+			Name:           result.Algorithm,
+			OriginalSize:   int64(len(data)),
+			CompressedSize: result.Stats.CompressedSize,
+			Ratio:          result.Stats.Ratio,
+			CompressTime:   result.CompressTime,
+			DecompressTime: result.DecompressTime,
+			Verified:       result.Verified,
+		}
+		if len(data) > 0 {
+			a.BitsPerByte = float64(a.CompressedSize) * 8 / float64(len(data))
+		}
+		if result.Err != nil {
+			a.Error = result.Err.Error()
+		} else if result.MismatchOffset >= 0 {
+			a.Error = fmt.Sprintf("decompressed data differs at offset %d", result.MismatchOffset)
+		}
+		a.SampleKind, a.Samples = samples(algos[i], data)
+		r.Algorithms = append(r.Algorithms, a)
+	}
+	return r
+}
+
+// Generate は data のレポートを tmpl で w に出力します
+// tmpl が nil の場合は DefaultTemplate を使います。
+func Generate(data []byte, algos []common.Compressor, tmpl *template.Template, w io.Writer) error {
+	if tmpl == nil {
+		tmpl = DefaultTemplate()
+	}
+	return tmpl.Execute(w, Build(data, algos))
+}
+
+// charName はバイトを表示用の文字にします（表示可能なASCIIは 'a'、それ以外は 0x0A）
+func charName(b byte) string {
+	if b >= 0x20 && b < 0x7F {
+		return fmt.Sprintf("'%c'", b)
+	}
+	return fmt.Sprintf("0x%02X", b)
+}
@@ -0,0 +1,131 @@
+package report
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// lessonInput は教科書のLZWの例の入力です
+var lessonInput = []byte("TOBEORNOTTOBEORTOBEORNOT")
+
+func lessonAlgorithms() []common.Compressor {
+	return []common.Compressor{rle.NewCompressor(), lz77.NewCompressor(), huffman.NewCompressor(), lzw.NewCompressor()}
+}
+
+func TestGenerate_DefaultTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Generate(lessonInput, lessonAlgorithms(), nil, &buf); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# 圧縮レポート\n",
+		"## データの概要\n",
+		"| サイズ | 24 B (24 bytes) |\n",
+		"| 種類 | テキスト |\n",
+		"| エントロピー | 2.424 bits/byte |\n",
+		"| 理論的最小サイズ | 7.3 bytes |\n",
+		"| バイトの種類 | 6 |\n",
+		"## バイトの出現頻度（上位6件）\n",
+		"| 'O' | 8 | 33.3% |\n",
+		"| 'N' | 2 | 8.3% |\n",
+		"## 圧縮結果\n",
+		"### Run-Length Encoding (RLE) のランの例\n",
+		"### LZ77 のトークンの例\n",
+		"### Huffman Coding の符号の例\n",
+		"### LZW のフレーズの例\n",
+		"| `\"TO\"` | `符号 256` |\n",
+		"| `\"O\"` | `リテラル 'O'` |\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected report to contain %q\n%s", want, out)
+		}
+	}
+
+	// 各アルゴリズムの行は実際の圧縮サイズと検証結果を含む
+	for _, c := range lessonAlgorithms() {
+		compressed, _ := c.Compress(lessonInput)
+		row := "| " + c.Name() + " | " + strconv.Itoa(len(compressed)) + " bytes | "
+		if !strings.Contains(out, row) || !strings.Contains(out[strings.Index(out, row):], "| ✓ |\n") {
+			t.Errorf("Expected a verified row starting with %q\n%s", row, out)
+		}
+	}
+}
+
+func TestBuild_Samples(t *testing.T) {
+	r := Build(lessonInput, lessonAlgorithms())
+	if len(r.Algorithms) != 4 {
+		t.Fatalf("Expected 4 algorithms, got %d", len(r.Algorithms))
+	}
+
+	lzwResult := r.Algorithms[3]
+	if lzwResult.SampleKind != "フレーズ" || len(lzwResult.Samples) != SampleCount {
+		t.Fatalf("Expected %d LZW phrases, got %+v", SampleCount, lzwResult)
+	}
+	for i, phrase := range []string{"TO", "OB", "BE", "EO"} {
+		if lzwResult.Samples[i].Input != `"`+phrase+`"` {
+			t.Errorf("phrase %d: expected %q, got %q", i, phrase, lzwResult.Samples[i].Input)
+		}
+	}
+
+	// Huffmanの符号は出現回数の多い順で、最も多い 'O' が最も短い
+	codes := r.Algorithms[2].Samples
+	if codes[0].Input != `"O"` || len(codes[0].Output) > len(codes[len(codes)-1].Output) {
+		t.Errorf("Expected the shortest code for 'O' first, got %+v", codes)
+	}
+
+	// LZ77のマッチは覆う入力（マッチ + 次の文字）を表示する（繰り返しは現在位置に重なる1つのマッチになる）
+	tokens := Build(bytes.Repeat([]byte("abc"), 4), []common.Compressor{lz77.NewCompressor()}).Algorithms[0].Samples
+	if len(tokens) < 4 || tokens[3] != (Sample{Input: `"abcabcabc"`, Output: "マッチ (距離 3, 長さ 8) + 'c'"}) {
+		t.Errorf("Expected a match token after three literals, got %+v", tokens)
+	}
+}
+
+func TestBuild_Empty(t *testing.T) {
+	r := Build(nil, lessonAlgorithms())
+	if r.Size != 0 || r.Entropy != 0 || len(r.Histogram) != 0 {
+		t.Errorf("Expected an empty analysis, got %+v", r)
+	}
+	for _, a := range r.Algorithms {
+		if a.Error != "" || !a.Verified {
+			t.Errorf("%s: expected a verified empty round trip, got %+v", a.Name, a)
+		}
+	}
+	if err := Generate(nil, lessonAlgorithms(), nil, &bytes.Buffer{}); err != nil {
+		t.Errorf("Generate failed for empty data: %v", err)
+	}
+}
+
+func TestGenerate_CustomTemplateFields(t *testing.T) {
+	// テンプレートから参照できるフィールド名は固定。名前を変えるとこのテンプレートの実行が失敗する
+	const text = `{{.Size}} {{.Entropy}} {{.MinSize}} {{.DataType}} {{.Distinct}}
+{{range .Histogram}}{{.Byte}} {{.Char}} {{.Count}} {{.Share}}
+{{end}}{{range .Algorithms}}{{.Name}} {{.OriginalSize}} {{.CompressedSize}} {{.Ratio}} {{.BitsPerByte}} {{.CompressTime}} {{.DecompressTime}} {{.Verified}} {{.Error}} {{.SampleKind}}
+{{range .Samples}}{{.Input}} => {{.Output}}
+{{end}}{{end}}{{bytes .Size}} {{percent 0.5}} {{cell "a|b"}}`
+	tmpl, err := template.New("custom").Funcs(Funcs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Generate(lessonInput, []common.Compressor{lzw.NewCompressor()}, tmpl, &buf); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"24 2.42", "\n79 'O' 8 0.333", "\nLZW 24 ", " true  フレーズ\n", "\"TO\" => 符号 256\n", "24 B 50.0% a\\|b"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q\n%s", want, out)
+		}
+	}
+}
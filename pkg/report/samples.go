@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	"github.com/sasakihasuto/tinyzipzap/pkg/lzw"
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// sampleInput はトークンやフレーズの例を作るときに使う入力の先頭部分のサイズです
+const sampleInput = 4096
+
+// samples は c がデータをどう表現するかの例を返します
+// 例を作れるのは RLE、LZ77、Huffman（8ビット単位）、LZW で、それ以外は空を返します。
+func samples(c common.Compressor, data []byte) (string, []Sample) {
+	head := data[:min(len(data), sampleInput)]
+	switch c := c.(type) {
+	case *rle.Compressor:
+		return "ラン", rleSamples(head)
+	case *lz77.Compressor:
+		return "トークン", lz77Samples(head)
+	case *huffman.Compressor:
+		if c.Width() != 1 {
+			return "", nil
+		}
+		return "符号", huffmanSamples(data)
+	case *lzw.Compressor:
+		return "フレーズ", lzwSamples(head)
+	}
+	return "", nil
+}
+
+// rleSamples は先頭のランを（文字, 回数）の組として返します
+func rleSamples(data []byte) []Sample {
+	var result []Sample
+	for i := 0; i < len(data) && len(result) < SampleCount; {
+		n := 1
+		for i+n < len(data) && data[i+n] == data[i] {
+			n++
+		}
+		result = append(result, Sample{
+			Input:  quote(data[i : i+n]),
+			Output: fmt.Sprintf("%s × %d", charName(data[i]), n),
+		})
+		i += n
+	}
+	return result
+}
+
+// lz77Samples は先頭のトークンと、それぞれが表す入力を返します
+func lz77Samples(data []byte) []Sample {
+	var result []Sample
+	pos := 0
+	for _, t := range lz77.EncodeTokens(data) {
+		if len(result) == SampleCount {
+			break
+		}
+		if t.IsLiteral() {
+			result = append(result, Sample{Input: quote(data[pos : pos+1]), Output: "リテラル " + charName(t.Literal)})
+			pos++
+			continue
+		}
+		end := min(pos+int(t.Length)+1, len(data))
+		result = append(result, Sample{
+			Input:  quote(data[pos:end]),
+			Output: fmt.Sprintf("マッチ (距離 %d, 長さ %d) + %s", t.Distance, t.Length, charName(t.Literal)),
+		})
+		pos = end
+	}
+	return result
+}
+
+// huffmanSamples は出現回数の多いバイトの符号を返します
+func huffmanSamples(data []byte) []Sample {
+	codes := huffman.CodeTable(data)
+	counts := common.CountBytes(data)
+	symbols := make([]byte, 0, len(codes))
+	for b := range codes {
+		symbols = append(symbols, b)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		return counts[a] > counts[b] || (counts[a] == counts[b] && a < b)
+	})
+
+	var result []Sample
+	for _, b := range symbols[:min(len(symbols), SampleCount)] {
+		result = append(result, Sample{Input: quote([]byte{b}), Output: codes[b]})
+	}
+	return result
+}
+
+// lzwSamples は辞書に最初に追加されたフレーズと、その符号を返します
+func lzwSamples(data []byte) []Sample {
+	var result []Sample
+	d := lzw.BuildDictionary(data)
+	for _, e := range d.Snapshot() {
+		if len(result) == SampleCount {
+			break
+		}
+		result = append(result, Sample{Input: quote(d.Phrase(e.Index)), Output: fmt.Sprintf("符号 %d", e.Index)})
+	}
+	return result
+}
+
+// quote はバイト列を Go の引用符付き文字列として表示します
+func quote(b []byte) string {
+	return strconv.Quote(string(b))
+}
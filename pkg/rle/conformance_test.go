@@ -0,0 +1,206 @@
+package rle
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/intcode"
+)
+
+// rleVariant はRLEの形式の適合性テストの対象です
+// 新しい形式を追加したら、ここに展開の経路と、形式が不正と定める圧縮データを追加します。
+type rleVariant struct {
+	name    string
+	c       common.Compressor
+	policy  countPolicy
+	invalid map[string][]byte // 形式が不正と定める圧縮データ
+}
+
+// gammaStream はラン数 runCount に続けて fields が書き込むフィールドで、gamma符号のRLEの圧縮データを組み立てます
+// 不正なデータも作れるよう、ラン数とランの数が一致しなくてもかまいません。
+func gammaStream(t *testing.T, runCount uint64, fields func(w *bitio.Writer)) []byte {
+	t.Helper()
+	w := bitio.NewWriter()
+	if err := intcode.Delta.Write(w, runCount); err != nil {
+		t.Fatal(err)
+	}
+	fields(w)
+	return w.Bytes()
+}
+
+func rleVariants(t *testing.T) []rleVariant {
+	gammaRun := func(value byte, length uint64) func(w *bitio.Writer) {
+		return func(w *bitio.Writer) {
+			w.WriteBits(uint64(value), 8)
+			intcode.Gamma.Write(w, length-1)
+		}
+	}
+	valid := gammaStream(t, 1, gammaRun('a', 3))
+
+	return []rleVariant{
+		{
+			name:   "rle",
+			c:      NewCompressor(),
+			policy: classicCounts,
+			invalid: map[string][]byte{
+				"empty":                 {},
+				"odd length":            {'a'},
+				"odd trailing byte":     {'a', 1, 'b'},
+				"zero count":            {'a', 0},
+				"zero count after runs": {'a', 3, 'b', 0},
+				"empty pair with runs":  {0, 0, 'a', 1},
+				"runs with empty pair":  {'a', 1, 0, 0},
+			},
+		},
+		{
+			name:   "rle-gamma",
+			c:      NewGammaCompressor(),
+			policy: gammaCounts,
+			invalid: map[string][]byte{
+				"empty":               {},
+				"missing run":         gammaStream(t, 1, func(*bitio.Writer) {}),
+				"missing length":      gammaStream(t, 1, func(w *bitio.Writer) { w.WriteBits('a', 8) }),
+				"too many runs":       gammaStream(t, 1000, gammaRun('a', 1)),
+				"length above max":    gammaStream(t, 1, gammaRun('a', math.MaxInt32+1)),
+				"trailing byte":       append(bytes.Clone(valid), 0),
+				"nonzero padding bit": append(valid[:len(valid)-1:len(valid)-1], valid[len(valid)-1]|1),
+			},
+		},
+	}
+}
+
+// decodePaths は圧縮データを c のすべての展開の経路で展開します
+func decodePaths(c common.Compressor) map[string]func([]byte) ([]byte, error) {
+	paths := map[string]func([]byte) ([]byte, error){
+		"Decompress": c.Decompress,
+	}
+	if od, ok := c.(common.OptionsDecompressor); ok {
+		paths["DecompressWithOptions"] = func(data []byte) ([]byte, error) {
+			return od.DecompressWithOptions(data, common.DecompressOptions{MaxOutputSize: 1 << 30})
+		}
+	}
+	if sc, ok := c.(common.StreamCompressor); ok {
+		paths["DecompressStream"] = func(data []byte) ([]byte, error) {
+			var out bytes.Buffer
+			err := sc.DecompressStream(bytes.NewReader(data), &out)
+			return out.Bytes(), err
+		}
+	}
+	if _, ok := c.(*Compressor); ok {
+		paths["DecompressToWriter"] = func(data []byte) ([]byte, error) {
+			var out bytes.Buffer
+			_, err := DecompressToWriter(data, &out)
+			return out.Bytes(), err
+		}
+	}
+	return paths
+}
+
+// conformanceInputs はすべての形式で往復を確認する入力です
+// 通常のRLEのカウントの境界（255、256、510、511）を含みます。
+func conformanceInputs() map[string][]byte {
+	alternating := make([]byte, 1000)
+	for i := range alternating {
+		alternating[i] = byte(i % 2)
+	}
+	return map[string][]byte{
+		"empty":       {},
+		"single":      {'a'},
+		"zero byte":   {0},
+		"zero pair":   {0, 0},
+		"run 255":     bytes.Repeat([]byte{'a'}, 255),
+		"run 256":     bytes.Repeat([]byte{'a'}, 256),
+		"run 510":     bytes.Repeat([]byte{'a'}, 510),
+		"run 511":     bytes.Repeat([]byte{'a'}, 511),
+		"run 64K":     bytes.Repeat([]byte{0xff}, 1<<16),
+		"alternating": alternating,
+		"mixed":       append(append(bytes.Repeat([]byte{'x'}, 300), "abc"...), bytes.Repeat([]byte{0}, 256)...),
+	}
+}
+
+func TestConformance_RoundTrip(t *testing.T) {
+	for _, v := range rleVariants(t) {
+		for name, input := range conformanceInputs() {
+			compressed, err := v.c.Compress(input)
+			if err != nil {
+				t.Fatalf("%s/%s: Compress failed: %v", v.name, name, err)
+			}
+			for path, decode := range decodePaths(v.c) {
+				got, err := decode(compressed)
+				if err != nil || !bytes.Equal(got, input) {
+					t.Errorf("%s/%s: %s round trip failed: %v", v.name, name, path, err)
+				}
+			}
+		}
+	}
+}
+
+func TestConformance_RejectsInvalid(t *testing.T) {
+	for _, v := range rleVariants(t) {
+		for name, data := range v.invalid {
+			for path, decode := range decodePaths(v.c) {
+				if _, err := decode(data); !errors.Is(err, common.ErrInvalidData) {
+					t.Errorf("%s/%s: %s: expected ErrInvalidData, got %v", v.name, name, path, err)
+				}
+			}
+		}
+	}
+}
+
+// TestConformance_ClassicPairs は通常のRLEの2バイトの圧縮データをすべて展開し、
+// 形式の定める不正なもの（00 00 以外のカウント0）だけが拒否されることを確認します
+func TestConformance_ClassicPairs(t *testing.T) {
+	c := NewCompressor()
+	for value := range 256 {
+		for count := range 256 {
+			data := []byte{byte(value), byte(count)}
+			valid := classicCounts.check(data, 1, uint64(count)) == nil || (value == 0 && count == 0)
+			for path, decode := range decodePaths(c) {
+				got, err := decode(data)
+				switch {
+				case valid && err != nil:
+					t.Fatalf("%x: %s: expected success, got %v", data, path, err)
+				case !valid && !errors.Is(err, common.ErrInvalidData):
+					t.Fatalf("%x: %s: expected ErrInvalidData, got %v", data, path, err)
+				case valid && len(got) != count:
+					t.Fatalf("%x: %s: expected %d bytes, got %d", data, path, count, len(got))
+				}
+			}
+		}
+	}
+}
+
+// TestConformance_BoundaryCounts は各形式の1つの組で表せる最小・最大のラン長が1つの組になり、
+// 最大を超えるランが分割されることを確認します
+func TestConformance_BoundaryCounts(t *testing.T) {
+	for _, v := range rleVariants(t) {
+		if err := v.policy.check(nil, 0, 0); err == nil {
+			t.Errorf("%s: expected count 0 to be rejected", v.name)
+		}
+		if err := v.policy.check(nil, 0, v.policy.min); err != nil {
+			t.Errorf("%s: expected the minimum count to be accepted, got %v", v.name, err)
+		}
+		if err := v.policy.check(nil, 0, v.policy.max); err != nil {
+			t.Errorf("%s: expected the maximum count to be accepted, got %v", v.name, err)
+		}
+		if err := v.policy.check(nil, 0, v.policy.max+1); err == nil {
+			t.Errorf("%s: expected the maximum count + 1 to be rejected", v.name)
+		}
+	}
+
+	// 通常のRLEは255で組を分ける
+	compressed, _ := NewCompressor().Compress(bytes.Repeat([]byte{'a'}, maxCount+1))
+	if !bytes.Equal(compressed, []byte{'a', maxCount, 'a', 1}) {
+		t.Errorf("Expected the 256-byte run to be split at 255, got %x", compressed)
+	}
+
+	// gamma符号のRLEは上限より短いランを1つの組にする
+	runs := splitRuns(bytes.Repeat([]byte{'a'}, 1<<20))
+	if len(runs) != 1 || runs[0].length != 1<<20 {
+		t.Errorf("Expected a single run, got %d runs", len(runs))
+	}
+}
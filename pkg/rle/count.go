@@ -0,0 +1,45 @@
+package rle
+
+import (
+	"math"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// countPolicy はRLEの形式ごとのカウント（1つの組のラン長）の規則です
+// 形式ごとに表せる範囲を1か所にまとめ、展開時の範囲の確認を共通にします。
+// 新しい形式を追加する場合は、ここに規則を定義し、conformance_test.go の表にも追加します。
+type countPolicy struct {
+	format string // エラーに表示する形式名
+	field  string // エラーに表示するカウントの名前
+	min    uint64 // 1つの組で表せる最小のラン長
+	max    uint64 // 1つの組で表せる最大のラン長
+}
+
+var (
+	// classicCounts は通常のRLE（"rle"）の規則です
+	// カウントは1バイトで1〜255を表し、255を超えるランは複数の組に分けます。
+	// カウント0は空のデータを表す組 00 00 が圧縮データ全体の場合だけ有効で、
+	// それ以外の位置のカウント0は不正です（0を256とみなすことはしません）。
+	classicCounts = countPolicy{format: "RLE", field: "カウント", min: 1, max: maxCount}
+
+	// gammaCounts はgamma符号のRLE（"rle-gamma"）の規則です
+	// ラン長-1 をgamma符号で表すため、どの符号も1以上のラン長になり、0は表せません。
+	// 上限は math.MaxInt32 で、それより長いランは圧縮時に分割し、展開時には不正とします。
+	// 空のデータはラン数0で表し、最後のランの後はバイトの境界までの0のビットだけが続きます。
+	gammaCounts = countPolicy{format: "RLE-gamma", field: "ラン長", min: 1, max: math.MaxInt32}
+)
+
+// check は data の pos にあるカウント n が規則の範囲内かを確認します
+// 範囲外の場合は common.ErrInvalidData に一致する *common.DecodeError を、範囲内なら nil を返します。
+func (p countPolicy) check(data []byte, pos int, n uint64) *common.DecodeError {
+	switch {
+	case n == 0 && p.min > 0:
+		return common.NewDecodeError(p.format, data, pos, "%sが0です", p.field)
+	case n < p.min:
+		return common.NewDecodeError(p.format, data, pos, "%sが小さすぎます: %d（最小 %d）", p.field, n, p.min)
+	case n > p.max:
+		return common.NewDecodeError(p.format, data, pos, "%sが大きすぎます: %d（最大 %d）", p.field, n, p.max)
+	}
+	return nil
+}
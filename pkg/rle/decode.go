@@ -0,0 +1,93 @@
+package rle
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// writeChunkSize は DecompressToWriter でランを書き込むときの1回の最大サイズです
+const writeChunkSize = 32 * 1024
+
+// DecompressToWriter はRLE圧縮された data を展開しながら w に書き込み、書き込んだバイト数を返します
+// 展開結果全体は確保せず、長いランも writeChunkSize ごとに同じバッファから書き込むため、
+// 数GBに展開されるデータでもメモリの使用量は一定です。壊れたデータは書き込みを
+// 始める前に検出し、DecompressWithOptions と同じ common.DecodeError を返します。
+func DecompressToWriter(data []byte, w io.Writer) (int64, error) {
+	total, err := outputSize(data)
+	if err != nil || total == 0 {
+		return 0, err
+	}
+
+	out := bufio.NewWriterSize(w, writeChunkSize)
+	chunk := make([]byte, min(total, writeChunkSize))
+	written := int64(0)
+	err = eachRun(data, func(b byte, n int64) error {
+		fillRun(chunk[:min(n, int64(len(chunk)))], b)
+		for n > 0 {
+			k, err := out.Write(chunk[:min(n, int64(len(chunk)))])
+			written += int64(k)
+			if err != nil {
+				return err
+			}
+			n -= int64(k)
+		}
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, out.Flush()
+}
+
+// outputSize は data を検証し、展開後のサイズをカウントの合計から求めます
+// 組の数に比例する時間で、展開結果を確保する前に壊れたデータを検出します。
+func outputSize(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, common.NewDecodeError("RLE", data, 0, "圧縮データが空です")
+	}
+	if bytes.Equal(data, emptyPair) {
+		return 0, nil
+	}
+	if len(data)%2 != 0 {
+		return 0, common.NewDecodeError("RLE", data, len(data)-1, "圧縮データのサイズが不正です（奇数バイト）")
+	}
+
+	total := int64(0)
+	for i := 0; i < len(data); i += 2 {
+		if err := classicCounts.check(data, i+1, uint64(data[i+1])); err != nil {
+			return 0, err
+		}
+		total += int64(data[i+1])
+	}
+	return total, nil
+}
+
+// eachRun は同じ文字が続く組を1つのランにまとめ、ランごとに fn を呼びます
+// 255を超えるために分割されたランも、まとめて1回で埋められます。
+func eachRun(data []byte, fn func(b byte, n int64) error) error {
+	for i := 0; i < len(data); {
+		b, n := data[i], int64(0)
+		for ; i < len(data) && data[i] == b; i += 2 {
+			n += int64(data[i+1])
+		}
+		if err := fn(b, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillRun は dst を b で埋めます
+// 最初の1バイトから、埋めた範囲を後ろにコピーして倍々に広げます（1バイトずつ書き込みません）。
+func fillRun(dst []byte, b byte) {
+	if len(dst) == 0 {
+		return
+	}
+	dst[0] = b
+	for filled := 1; filled < len(dst); filled *= 2 {
+		copy(dst[filled:], dst[:filled])
+	}
+}
@@ -4,12 +4,37 @@ package rle
 import (
 	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
+// maxCount は1つの組で表せる最大のラン長です
+const maxCount = 255
+
+// emptyPair は空のデータの圧縮結果です
+// カウント0の組は他の場所には現れないため、空の圧縮データ（欠落・破損）と区別できます
+var emptyPair = []byte{0x00, 0x00}
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "rle",
+		Extensions:   []string{".rle"},
+		Capabilities: common.CapStreaming | common.CapDeterministic,
+		Description:  "Run-Length Encoding（文字 + 出現回数の組）",
+		UseCase:      "同じバイトが長く続くデータ（単色の画像、0で埋めた領域）",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewCompressor() },
+	})
+}
+
 // Compressor はRun-Length Encoding圧縮を実装します
-type Compressor struct{}
+// 状態を持たないため、複数のゴルーチンから同時に使用できます
+type Compressor struct {
+	tracer  common.Tracer       // nil でなければ組を出力するごとに RunEvent を通知する
+	costMap common.CostMap      // nil でなければ Compress で組を出力するごとに16ビットを通知する
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
 
 // NewCompressor は新しいCompressorを作成します
 func NewCompressor() *Compressor {
@@ -21,12 +46,26 @@ func (r *Compressor) Name() string {
 	return "Run-Length Encoding (RLE)"
 }
 
+// formatVersion はRLEの圧縮形式のバージョンです
+const formatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (r *Compressor) FormatVersion() byte {
+	return formatVersion
+}
+
 // Compress はRLEアルゴリズムでデータを圧縮します
 // 形式: [文字][カウント][文字][カウント]...
 // カウントは1-255の範囲で、255を超える場合は分割します
+// 空のデータは [0x00][0x00] の1組になります
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+// 大きな入力は CompressStream で圧縮してください。
 func (r *Compressor) Compress(data []byte) ([]byte, error) {
+	if err := r.oneShot.Check(r.Name(), len(data)); err != nil {
+		return nil, err
+	}
 	if len(data) == 0 {
-		return []byte{}, nil
+		return bytes.Clone(emptyPair), nil
 	}
 
 	var compressed bytes.Buffer
@@ -35,12 +74,18 @@ func (r *Compressor) Compress(data []byte) ([]byte, error) {
 	count := 1
 
 	for i := 1; i < len(data); i++ {
-		if data[i] == currentByte && count < 255 {
+		if data[i] == currentByte && count < maxCount {
 			count++
 		} else {
 			// 現在の文字とカウントを出力
 			compressed.WriteByte(currentByte)
 			compressed.WriteByte(byte(count))
+			if r.tracer != nil {
+				r.traceRun(int64(i-count), currentByte, count)
+			}
+			if r.costMap != nil {
+				r.costMap(i-count, count, 16)
+			}
 
 			// 次の文字に移行
 			currentByte = data[i]
@@ -51,87 +96,153 @@ func (r *Compressor) Compress(data []byte) ([]byte, error) {
 	// 最後の文字とカウントを出力
 	compressed.WriteByte(currentByte)
 	compressed.WriteByte(byte(count))
+	if r.tracer != nil {
+		r.traceRun(int64(len(data)-count), currentByte, count)
+	}
+	if r.costMap != nil {
+		r.costMap(len(data)-count, count, 16)
+	}
 
 	return compressed.Bytes(), nil
 }
 
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (r *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	c := *r
+	c.oneShot = common.NewOneShotLimit(n)
+	return &c
+}
+
+// WithCostMap は Compress で「文字 + カウント」の組ごとに、そのランに16ビットを通知する
+// Compressor を返します（common.CostMapped）
+func (r *Compressor) WithCostMap(m common.CostMap) common.Compressor {
+	c := *r
+	c.costMap = m
+	return &c
+}
+
 // Decompress はRLE圧縮されたデータを展開します
 func (r *Compressor) Decompress(data []byte) ([]byte, error) {
-	if len(data)%2 != 0 {
-		return nil, fmt.Errorf("RLE: 圧縮データのサイズが不正です（奇数バイト）")
-	}
+	return r.DecompressWithOptions(data, common.DecompressOptions{})
+}
 
-	var decompressed bytes.Buffer
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 先にカウントを合計して出力サイズを求め、予算を確認してから一度だけ確保します。
+// 同じ文字が続く組は1つのランにまとめ、コピーする範囲を倍々に広げて埋めます。
+func (r *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	total, err := outputSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.ReserveOutput(total, total); err != nil {
+		return nil, fmt.Errorf("RLE: %w", err)
+	}
+	if total == 0 {
+		return []byte{}, nil
+	}
 
-	for i := 0; i < len(data); i += 2 {
-		if i+1 >= len(data) {
-			return nil, fmt.Errorf("RLE: データが不完全です")
-		}
+	decompressed := make([]byte, total)
+	pos := int64(0)
+	eachRun(data, func(b byte, n int64) error {
+		fillRun(decompressed[pos:pos+n], b)
+		pos += n
+		return nil
+	})
+	return decompressed, nil
+}
 
-		char := data[i]
-		count := int(data[i+1])
+// Analysis はRLE圧縮に適したデータかどうかの分析結果です
+// JSONでは RunLengths の代わりに、ラン長の順に並べた "run_lengths" を出力します（MarshalJSON）。
+type Analysis struct {
+	DataSize         int         `json:"data_size"`          // 元のデータサイズ
+	TotalRuns        int         `json:"total_runs"`         // 総ラン数（255で分割する前）
+	AverageRunLength float64     `json:"average_run_length"` // 平均ラン長
+	LongRuns         int         `json:"long_runs"`          // 長いラン（4文字以上）の数
+	SplitRuns        int         `json:"split_runs"`         // 255を超えるため複数の組に分割されるランの数
+	RunLengths       map[int]int `json:"-"`                  // 連続長 -> 出現回数
 
-		if count == 0 {
-			return nil, fmt.Errorf("RLE: カウントが0です")
-		}
+	// BreakEvenRunLength は損益分岐点のラン長です
+	// これより短いランは「文字 + カウント」の2バイトになるためデータを膨らませます
+	BreakEvenRunLength int `json:"break_even_run_length"`
 
-		// 指定された回数だけ文字を繰り返し
-		for j := 0; j < count; j++ {
-			decompressed.WriteByte(char)
-		}
-	}
+	EstimatedSize  int     `json:"estimated_size"`  // 予想圧縮サイズ（Compress の出力サイズと一致）
+	EstimatedRatio float64 `json:"estimated_ratio"` // 予想圧縮率
 
-	return decompressed.Bytes(), nil
+	// FloorSize はラン列の理論的下限（bytes）です
+	// 各ランのラン長と文字を、それぞれの出現頻度（ラン長の分布とランの文字の分布）から
+	// 理想的に符号化したときのサイズで、ランを単位とする符号化で到達できるサイズの目安です。
+	// 0次のエントロピーと違い、長いランが多いほど小さくなります。
+	FloorSize float64 `json:"floor_size"`
 }
 
 // Analyze はRLE圧縮に適したデータかどうかを分析します
-func Analyze(data []byte) {
-	if len(data) == 0 {
-		fmt.Println("データが空です")
-		return
+// 255を超えるランは Compress と同様に複数の組に分割して予想サイズを計算します
+func Analyze(data []byte) Analysis {
+	analysis := Analysis{
+		DataSize:           len(data),
+		RunLengths:         make(map[int]int),
+		BreakEvenRunLength: 2,
 	}
 
-	// 連続する文字の長さを分析
-	runs := make(map[int]int) // 連続長 -> 出現回数
-	currentChar := data[0]
-	currentLength := 1
-	totalRuns := 0
-
-	for i := 1; i < len(data); i++ {
-		if data[i] == currentChar {
-			currentLength++
-		} else {
-			runs[currentLength]++
-			totalRuns++
-			currentChar = data[i]
-			currentLength = 1
+	var symbols [256]int
+	for _, r := range splitRuns(data) {
+		analysis.TotalRuns++
+		analysis.RunLengths[r.length]++
+		symbols[r.value]++
+		if r.length > 3 {
+			analysis.LongRuns++
 		}
+		if r.length > maxCount {
+			analysis.SplitRuns++
+		}
+
+		// 各組は文字+カウントの2バイト
+		pairs := (r.length + maxCount - 1) / maxCount
+		analysis.EstimatedSize += pairs * 2
 	}
-	runs[currentLength]++
-	totalRuns++
 
-	fmt.Printf("=== RLE分析結果 ===\n")
-	fmt.Printf("総ラン数: %d\n", totalRuns)
-	fmt.Printf("平均ラン長: %.2f\n", float64(len(data))/float64(totalRuns))
+	if len(data) == 0 {
+		analysis.EstimatedSize = len(emptyPair)
+	}
+	if analysis.TotalRuns > 0 {
+		analysis.AverageRunLength = float64(len(data)) / float64(analysis.TotalRuns)
+	}
+	if len(data) > 0 {
+		analysis.EstimatedRatio = float64(analysis.EstimatedSize) / float64(len(data))
+	}
 
-	// 長いランの統計
-	longRuns := 0
-	for length, count := range runs {
-		if length > 3 {
-			longRuns += count
-		}
+	lengths := make([]int, 0, len(analysis.RunLengths))
+	for _, count := range analysis.RunLengths {
+		lengths = append(lengths, count)
 	}
+	analysis.FloorSize = (common.EntropyBits(lengths) + common.EntropyBits(symbols[:])) / 8
 
-	fmt.Printf("長いラン (4文字以上): %d (%.1f%%)\n",
-		longRuns, float64(longRuns)/float64(totalRuns)*100)
+	return analysis
+}
 
-	// RLE圧縮効果の予測
-	originalSize := len(data)
-	estimatedCompressed := totalRuns * 2 // 各ランは文字+カウントの2バイト
+// Floor は data のラン列の理論的下限（bytes）を返します（common.FloorEstimator、Analysis.FloorSize）
+func (r *Compressor) Floor(data []byte) float64 {
+	return Analyze(data).FloorSize
+}
 
-	fmt.Printf("予想圧縮サイズ: %d bytes\n", estimatedCompressed)
-	fmt.Printf("予想圧縮率: %.2f%%\n",
-		float64(estimatedCompressed)/float64(originalSize)*100)
+// FprintAnalysis は PrintAnalysis と同じ内容を w に書き込みます
+func FprintAnalysis(w io.Writer, a Analysis) {
+	if a.DataSize == 0 {
+		fmt.Fprintln(w, "データが空です")
+		return
+	}
+
+	fmt.Fprintf(w, "=== RLE分析結果 ===\n")
+	fmt.Fprintf(w, "総ラン数: %d\n", a.TotalRuns)
+	fmt.Fprintf(w, "平均ラン長: %.2f\n", a.AverageRunLength)
+	fmt.Fprintf(w, "長いラン (4文字以上): %d (%.1f%%)\n",
+		a.LongRuns, float64(a.LongRuns)/float64(a.TotalRuns)*100)
+	fmt.Fprintf(w, "分割されるラン (%d文字超): %d\n", maxCount, a.SplitRuns)
+	fmt.Fprintf(w, "損益分岐点: %d文字（これより短いランはデータを膨らませます）\n", a.BreakEvenRunLength)
+	fmt.Fprintf(w, "予想圧縮サイズ: %d bytes\n", a.EstimatedSize)
+	fmt.Fprintf(w, "予想圧縮率: %.2f%%\n", a.EstimatedRatio*100)
+	fmt.Fprintf(w, "ラン列の理論的下限: %.1f bytes（ラン長と文字を出現頻度で符号化した場合）\n", a.FloorSize)
 }
 
 // CompressWithStats は圧縮と統計計算を同時に行います
@@ -150,3 +261,11 @@ func (r *Compressor) CompressWithStats(data []byte) ([]byte, common.CompressionS
 
 	return compressed, stats, nil
 }
+
+var (
+	_ common.Compressor          = (*Compressor)(nil)
+	_ common.OptionsDecompressor = (*Compressor)(nil)
+	_ common.FloorEstimator      = (*Compressor)(nil)
+	_ common.OneShotLimited      = (*Compressor)(nil)
+	_ common.CostMapped          = (*Compressor)(nil)
+)
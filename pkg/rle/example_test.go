@@ -0,0 +1,33 @@
+package rle_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// 同じバイトが続くデータは (回数, バイト) の組になり、小さくなります
+func ExampleCompressor_Compress() {
+	data := []byte("WWWWWWWWWWWWBWWWWWWWWWWWWBBBWWWWWWWWWWWWWWWWWWWWWWWWBWWWWWWWWWWWWWW")
+
+	c := rle.NewCompressor()
+	compressed, err := c.Compress(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	decompressed, err := c.Decompress(compressed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(c.Name())
+	fmt.Printf("%d -> %d bytes\n", len(data), len(compressed))
+	fmt.Printf("% x\n", compressed)
+	fmt.Println(string(decompressed) == string(data))
+	// Output:
+	// Run-Length Encoding (RLE)
+	// 67 -> 14 bytes
+	// 57 0c 42 01 57 0c 42 03 57 18 42 01 57 0e
+	// true
+}
@@ -0,0 +1,46 @@
+package rle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// RunCount はあるラン長のランの出現回数です
+type RunCount struct {
+	Length int `json:"length"` // ラン長（255で分割する前）
+	Count  int `json:"count"`  // 出現回数
+}
+
+// Histogram はラン長の分布をラン長の順に返します（出現したラン長だけを含みます）
+func (a Analysis) Histogram() []RunCount {
+	hist := make([]RunCount, 0, len(a.RunLengths))
+	for length, count := range a.RunLengths {
+		hist = append(hist, RunCount{Length: length, Count: count})
+	}
+	sort.Slice(hist, func(i, j int) bool { return hist[i].Length < hist[j].Length })
+	return hist
+}
+
+// MarshalJSON は分析結果をラン長の分布 "run_lengths" を含めてJSONに変換します（json.Marshaler）
+func (a Analysis) MarshalJSON() ([]byte, error) {
+	// 別の型にして MarshalJSON の再帰呼び出しを避ける
+	type analysis Analysis
+	return json.Marshal(struct {
+		analysis
+		RunLengths []RunCount `json:"run_lengths"`
+	}{analysis(a), a.Histogram()})
+}
+
+// WriteCSV はラン長の分布を "run_length,count" の列のCSVとして w に書き込みます
+func (a Analysis) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"run_length", "count"})
+	for _, rc := range a.Histogram() {
+		cw.Write([]string{strconv.Itoa(rc.Length), strconv.Itoa(rc.Count)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
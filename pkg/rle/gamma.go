@@ -0,0 +1,168 @@
+package rle
+
+import (
+	"fmt"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/bitio"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/intcode"
+)
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "rle-gamma",
+		Extensions:   []string{".rleg"},
+		Capabilities: common.CapDeterministic,
+		Description:  "ラン長を Elias gamma 符号で表すRLE",
+		UseCase:      "長さがまちまちのランが多いデータ",
+		MaxVersion:   gammaFormatVersion,
+		NewFunc:      func() common.Compressor { return NewGammaCompressor() },
+	})
+}
+
+// GammaCompressor はラン長を Elias gamma 符号で表すRLEです
+// 通常のRLEはカウントが1バイトなので255で分割が必要ですが、gamma符号には
+// 上限がないため長いランも1つの組で表せます。短いランは少ないビット数で済みます。
+//
+// 形式（ビット列）: ラン数(delta符号) + [文字(8ビット) + ラン長-1(gamma符号)]...
+type GammaCompressor struct {
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
+
+// NewGammaCompressor は新しいGammaCompressorを作成します
+func NewGammaCompressor() *GammaCompressor {
+	return &GammaCompressor{}
+}
+
+// Name はアルゴリズム名を返します
+func (g *GammaCompressor) Name() string {
+	return "Run-Length Encoding (Elias gamma counts)"
+}
+
+// Floor は data のラン列の理論的下限（bytes）を返します（common.FloorEstimator）
+// 通常のRLEと同じラン列を符号化するため、下限も同じ Analysis.FloorSize です。
+func (g *GammaCompressor) Floor(data []byte) float64 {
+	return Analyze(data).FloorSize
+}
+
+// gammaFormatVersion はgamma符号のRLEの圧縮形式のバージョンです
+const gammaFormatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (g *GammaCompressor) FormatVersion() byte {
+	return gammaFormatVersion
+}
+
+// Compress はデータをgamma符号のラン長で圧縮します
+// 空のデータもラン数0として符号化するため、出力は1バイト以上になります
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+func (g *GammaCompressor) Compress(data []byte) ([]byte, error) {
+	if err := g.oneShot.Check(g.Name(), len(data)); err != nil {
+		return nil, err
+	}
+	runs := splitRuns(data)
+
+	w := bitio.NewWriter()
+	if err := intcode.Delta.Write(w, uint64(len(runs))); err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		w.WriteBits(uint64(run.value), 8)
+		// ラン長は1以上なので、1を引いてから符号化します
+		if err := intcode.Gamma.Write(w, uint64(run.length-1)); err != nil {
+			return nil, err
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (g *GammaCompressor) WithMaxOneShotSize(n int64) common.Compressor {
+	return &GammaCompressor{oneShot: common.NewOneShotLimit(n)}
+}
+
+// Decompress はgamma符号のラン長で圧縮されたデータを展開します
+func (g *GammaCompressor) Decompress(data []byte) ([]byte, error) {
+	return g.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// ラン長には上限がないため、各ランを展開する前に予算を確認します
+func (g *GammaCompressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, common.NewDecodeError("RLE-gamma", data, 0, "圧縮データが空です")
+	}
+
+	// ビット単位の形式なので、エラーの位置は読み込み中のフィールドを含むバイトの位置
+	r := bitio.NewReader(data)
+	runCount, err := intcode.Delta.Read(r)
+	if err != nil {
+		return nil, common.NewDecodeError("RLE-gamma", data, 0, "ラン数を読み込めません: %v", err)
+	}
+	// 1ランは最低9ビットなので、残りのビット数を超えるラン数は不正
+	if runCount > uint64(r.Remaining()/9) {
+		return nil, common.NewDecodeError("RLE-gamma", data, 0, "ラン数が不正です: %d", runCount)
+	}
+
+	var result []byte
+	for i := uint64(0); i < runCount; i++ {
+		value, err := r.ReadBits(8)
+		if err != nil {
+			return nil, common.NewDecodeError("RLE-gamma", data, r.Position()/8, "データが不完全です")
+		}
+		lengthPos := r.Position()
+		length, err := intcode.Gamma.Read(r)
+		if err != nil {
+			return nil, common.NewDecodeError("RLE-gamma", data, lengthPos/8, "ラン長を読み込めません: %v", err)
+		}
+		length++
+
+		if err := gammaCounts.check(data, lengthPos/8, length); err != nil {
+			return nil, err
+		}
+		if err := opts.ReserveOutput(int64(length), int64(len(result))+int64(length)); err != nil {
+			return nil, fmt.Errorf("RLE-gamma: %w", err)
+		}
+
+		for j := uint64(0); j < length; j++ {
+			result = append(result, byte(value))
+		}
+	}
+
+	// 最後のランの後はバイトの境界までの0のビット（Compress の余り）だけが続く
+	if rest := r.Remaining(); rest >= 8 {
+		return nil, common.NewDecodeError("RLE-gamma", data, r.Position()/8, "最後のランの後に %d バイトの余分なデータがあります", (rest+7)/8)
+	} else if padding, _ := r.ReadBits(rest); padding != 0 {
+		return nil, common.NewDecodeError("RLE-gamma", data, len(data)-1, "最後のバイトの余りのビットが0ではありません")
+	}
+	return result, nil
+}
+
+// run は同じバイトの連続を表します
+type run struct {
+	value  byte
+	length int
+}
+
+// splitRuns はデータを gammaCounts の上限までのランに分割します
+func splitRuns(data []byte) []run {
+	var runs []run
+	for i := 0; i < len(data); {
+		j := i + 1
+		for j < len(data) && data[j] == data[i] && uint64(j-i) < gammaCounts.max {
+			j++
+		}
+		runs = append(runs, run{value: data[i], length: j - i})
+		i = j
+	}
+	return runs
+}
+
+var (
+	_ common.Compressor          = (*GammaCompressor)(nil)
+	_ common.OptionsDecompressor = (*GammaCompressor)(nil)
+	_ common.FloorEstimator      = (*GammaCompressor)(nil)
+	_ common.OneShotLimited      = (*GammaCompressor)(nil)
+)
@@ -0,0 +1,10 @@
+package rle
+
+import "os"
+
+// PrintAnalysis は分析結果を表示します
+// os.Stdout に表示する互換用の関数です。パッケージで os を使うのはこのファイルだけのため、
+// WebAssembly（GOOS=js）向けのビルドでは FprintAnalysis を使ってください。
+func PrintAnalysis(a Analysis) {
+	FprintAnalysis(os.Stdout, a)
+}
@@ -2,7 +2,18 @@ package rle
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
 	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/golden"
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
 )
 
 func TestRLEBasic(t *testing.T) {
@@ -70,6 +81,13 @@ func TestRLEEdgeCases(t *testing.T) {
 		if err != nil {
 			t.Fatalf("空データの圧縮でエラー: %v", err)
 		}
+		// 空データはカウント0の1組になり、空の圧縮データとは区別される
+		if !bytes.Equal(compressed, []byte{0, 0}) {
+			t.Errorf("空データの圧縮結果が [0 0] ではありません: %v", compressed)
+		}
+		if _, err := compressor.Decompress([]byte{}); !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("空の圧縮データがエラーになりませんでした: %v", err)
+		}
 
 		decompressed, err := compressor.Decompress(compressed)
 		if err != nil {
@@ -112,6 +130,7 @@ func TestRLEEdgeCases(t *testing.T) {
 		if err == nil {
 			t.Error("不正データでエラーが発生しませんでした")
 		}
+		assertDecodeOffset(t, err, 0)
 
 		// カウントが0の圧縮データ（不正）
 		invalidData2 := []byte{0x41, 0x00} // 'A', count=0
@@ -120,6 +139,7 @@ func TestRLEEdgeCases(t *testing.T) {
 		if err == nil {
 			t.Error("カウント0でエラーが発生しませんでした")
 		}
+		assertDecodeOffset(t, err, 1)
 	})
 }
 
@@ -172,6 +192,127 @@ func TestRLEWithStats(t *testing.T) {
 	}
 }
 
+func TestGammaRoundTrip(t *testing.T) {
+	compressor := NewGammaCompressor()
+
+	for _, sample := range testcorpus.Samples() {
+		t.Run(sample.Name, func(t *testing.T) {
+			compressed, err := compressor.Compress(sample.Data)
+			if err != nil {
+				t.Fatalf("圧縮エラー: %v", err)
+			}
+
+			decompressed, err := compressor.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("展開エラー: %v", err)
+			}
+
+			if !bytes.Equal(sample.Data, decompressed) {
+				t.Errorf("展開結果が一致しません")
+			}
+		})
+	}
+}
+
+func TestGammaSizeComparison(t *testing.T) {
+	classic := NewCompressor()
+	gamma := NewGammaCompressor()
+
+	// 長いランは通常のRLEでは255ごとに分割されるが、gamma符号なら1組で済む
+	var longRuns []byte
+	for _, c := range []byte("abcdefgh") {
+		longRuns = append(longRuns, bytes.Repeat([]byte{c}, 1000)...)
+	}
+
+	classicOut, _ := classic.Compress(longRuns)
+	gammaOut, _ := gamma.Compress(longRuns)
+	t.Logf("長いラン: classic=%d bytes, gamma=%d bytes", len(classicOut), len(gammaOut))
+
+	if len(gammaOut) >= len(classicOut) {
+		t.Errorf("長いランでgamma版 (%d) が通常版 (%d) より小さくありません", len(gammaOut), len(classicOut))
+	}
+
+	// 長さ1のランはカウントが1ビットになるので、通常版の約半分になる
+	noRuns := []byte("abcdefghijklmnopqrstuvwxyz")
+	classicOut, _ = classic.Compress(noRuns)
+	gammaOut, _ = gamma.Compress(noRuns)
+	t.Logf("ランなし: classic=%d bytes, gamma=%d bytes", len(classicOut), len(gammaOut))
+
+	if len(gammaOut) >= len(classicOut) {
+		t.Errorf("ランなしでgamma版 (%d) が通常版 (%d) より小さくありません", len(gammaOut), len(classicOut))
+	}
+}
+
+func TestGammaInvalidData(t *testing.T) {
+	compressor := NewGammaCompressor()
+
+	compressed, err := compressor.Compress([]byte("aaaabbbbbbbbcc"))
+	if err != nil {
+		t.Fatalf("圧縮エラー: %v", err)
+	}
+
+	// 途中で切れたデータ（最後のランの途中）
+	truncated := compressed[:len(compressed)-2]
+	_, err = compressor.Decompress(truncated)
+	if err == nil {
+		t.Error("不完全なデータでエラーが発生しませんでした")
+	}
+	var decodeErr *common.DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Offset < 1 || decodeErr.Offset >= int64(len(truncated)) {
+		t.Errorf("不完全なデータのエラー位置が不正です: %v", err)
+	}
+
+	// 残りのビット数に対してラン数が多すぎるデータ
+	_, err = compressor.Decompress([]byte{0x00, 0x01, 0xFF})
+	if err == nil {
+		t.Error("不正なラン数でエラーが発生しませんでした")
+	}
+	assertDecodeOffset(t, err, 0)
+}
+
+// assertDecodeOffset はエラーが指定した位置の DecodeError であることを確認します
+func assertDecodeOffset(t *testing.T, err error, offset int64) {
+	t.Helper()
+	var decodeErr *common.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("DecodeError ではありません: %v", err)
+		return
+	}
+	if !errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("ErrInvalidData を含んでいません: %v", err)
+	}
+	if decodeErr.Offset != offset {
+		t.Errorf("エラー位置: 期待値 %d, 実際 %d (%v)", offset, decodeErr.Offset, err)
+	}
+}
+
+func TestRLEBudget(t *testing.T) {
+	// 255回繰り返しのペアを並べる（100ペアで25500バイト）
+	payload := bytes.Repeat([]byte{'x', 255}, 100)
+
+	for name, c := range map[string]common.OptionsDecompressor{
+		"classic": NewCompressor(),
+	} {
+		opts := common.DecompressOptions{Budget: common.NewBudget(1000)}
+		if _, err := c.DecompressWithOptions(payload, opts); !errors.Is(err, common.ErrBudgetExceeded) {
+			t.Errorf("%s: ErrBudgetExceeded になりませんでした: %v", name, err)
+		}
+	}
+
+	// gamma版: 巨大なラン長を宣言したデータは確保前に止まる
+	gamma := NewGammaCompressor()
+	compressed, _ := gamma.Compress(bytes.Repeat([]byte{'y'}, 1<<20))
+	opts := common.DecompressOptions{Budget: common.NewBudget(1 << 10)}
+	if _, err := gamma.DecompressWithOptions(compressed, opts); !errors.Is(err, common.ErrBudgetExceeded) {
+		t.Errorf("gamma: ErrBudgetExceeded になりませんでした: %v", err)
+	}
+
+	opts = common.DecompressOptions{MaxOutputSize: 1 << 10}
+	if _, err := gamma.DecompressWithOptions(compressed, opts); !errors.Is(err, common.ErrOutputTooLarge) {
+		t.Errorf("gamma: ErrOutputTooLarge になりませんでした: %v", err)
+	}
+}
+
 // ベンチマークテスト
 func BenchmarkRLECompress(b *testing.B) {
 	compressor := NewCompressor()
@@ -199,3 +340,338 @@ func BenchmarkRLEDecompress(b *testing.B) {
 		}
 	}
 }
+
+// referenceDecompress は1バイトずつ書き込む以前の展開の実装です（差分テストとベンチマークの比較用）
+func referenceDecompress(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%2 != 0 {
+		return nil, common.ErrInvalidData
+	}
+	if bytes.Equal(data, emptyPair) {
+		return []byte{}, nil
+	}
+	total := 0
+	for i := 0; i < len(data); i += 2 {
+		if data[i+1] == 0 {
+			return nil, common.ErrInvalidData
+		}
+		total += int(data[i+1])
+	}
+	decompressed := bytes.NewBuffer(make([]byte, 0, total))
+	for i := 0; i < len(data); i += 2 {
+		for j := 0; j < int(data[i+1]); j++ {
+			decompressed.WriteByte(data[i])
+		}
+	}
+	return decompressed.Bytes(), nil
+}
+
+// randomPairs は少ない種類の文字で、長さのばらばらな組を n 個作ります
+// 同じ文字の組が続く（分割された長いラン）場合や、カウント0の組も含めます。
+func randomPairs(rng *rand.Rand, n int) []byte {
+	data := make([]byte, 0, 2*n)
+	for range n {
+		count := byte(1 + rng.Intn(255))
+		if rng.Intn(50) == 0 {
+			count = 0
+		}
+		data = append(data, "ab\x00"[rng.Intn(3)], count)
+	}
+	return data
+}
+
+func TestDecompress_MatchesReference(t *testing.T) {
+	compressor := NewCompressor()
+	inputs := [][]byte{{}, {'a'}, {'a', 1, 'b'}, {0, 0}, {0, 0, 0, 0}, {'x', 0}}
+	for _, sample := range testcorpus.Samples() {
+		compressed, _ := compressor.Compress(sample.Data)
+		inputs = append(inputs, compressed)
+	}
+	inputs = append(inputs, bytes.Repeat([]byte{'z', 255}, 4000))
+	rng := rand.New(rand.NewSource(1))
+	for range 200 {
+		inputs = append(inputs, randomPairs(rng, 1+rng.Intn(300)))
+	}
+
+	for i, data := range inputs {
+		want, wantErr := referenceDecompress(data)
+		got, err := compressor.Decompress(data)
+		if (err != nil) != (wantErr != nil) || !bytes.Equal(got, want) {
+			t.Fatalf("入力 %d: 以前の実装と一致しません（エラー %v, 期待値 %v）", i, err, wantErr)
+		}
+		if err != nil && !errors.Is(err, common.ErrInvalidData) {
+			t.Errorf("入力 %d: ErrInvalidData ではありません: %v", i, err)
+		}
+
+		var streamed bytes.Buffer
+		n, err := DecompressToWriter(data, &streamed)
+		if (err != nil) != (wantErr != nil) || !bytes.Equal(streamed.Bytes(), want) || n != int64(len(want)) {
+			t.Fatalf("入力 %d: DecompressToWriter が以前の実装と一致しません（%d バイト, エラー %v）", i, n, err)
+		}
+		if err != nil && streamed.Len() != 0 {
+			t.Errorf("入力 %d: 壊れたデータで書き込みました", i)
+		}
+	}
+}
+
+// hugeRuns は長いラン（分割された組）と短いランが交互に続き、size バイトに展開される圧縮データを返します
+func hugeRuns(size int) []byte {
+	var data []byte
+	for total, n := 0, 0; total < size; n++ {
+		long := min(size-total, 4096+n%8192)
+		for rest := long; rest > 0; rest -= min(rest, maxCount) {
+			data = append(data, byte('a'+n%26), byte(min(rest, maxCount)))
+		}
+		total += long
+		for i := 0; i < 16 && total < size; i++ {
+			data = append(data, byte('0'+i%10), 1)
+			total++
+		}
+	}
+	return data
+}
+
+func TestDecompressToWriter_BoundedMemory(t *testing.T) {
+	data := hugeRuns(64 << 20)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, err := DecompressToWriter(data, io.Discard)
+	runtime.ReadMemStats(&after)
+	if err != nil || n != 64<<20 {
+		t.Fatalf("DecompressToWriter: %d バイト, エラー %v", n, err)
+	}
+	// 展開結果（64MB）ではなく、バッファの分だけ確保する
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 256<<10 {
+		t.Errorf("確保したメモリが多すぎます: %d バイト", allocated)
+	}
+
+	var got bytes.Buffer
+	if _, err := DecompressToWriter(hugeRuns(1<<20), &got); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := referenceDecompress(hugeRuns(1 << 20))
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error("展開結果が一致しません")
+	}
+}
+
+// BenchmarkRLEDecompress100MB は100MBに展開されるデータで、以前の1バイトずつの展開と比べます
+func BenchmarkRLEDecompress100MB(b *testing.B) {
+	data := hugeRuns(100 << 20)
+	b.Run("bytewise", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(100 << 20)
+		for range b.N {
+			if _, err := referenceDecompress(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("doubling", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(100 << 20)
+		compressor := NewCompressor()
+		for range b.N {
+			if _, err := compressor.Decompress(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("to-writer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(100 << 20)
+		for range b.N {
+			if _, err := DecompressToWriter(data, io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestAnalyzeSplitRuns(t *testing.T) {
+	data := bytes.Repeat([]byte{'a'}, 1000)
+
+	analysis := Analyze(data)
+	compressed, err := NewCompressor().Compress(data)
+	if err != nil {
+		t.Fatalf("圧縮エラー: %v", err)
+	}
+
+	if analysis.EstimatedSize != len(compressed) {
+		t.Errorf("予想サイズ %d が実際の圧縮サイズ %d と一致しません", analysis.EstimatedSize, len(compressed))
+	}
+	if analysis.TotalRuns != 1 || analysis.SplitRuns != 1 {
+		t.Errorf("ラン数が正しくありません: 総ラン数 %d, 分割 %d", analysis.TotalRuns, analysis.SplitRuns)
+	}
+	if analysis.BreakEvenRunLength != 2 {
+		t.Errorf("損益分岐点が正しくありません: %d", analysis.BreakEvenRunLength)
+	}
+}
+
+func TestAnalyze_Floor(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		floor float64
+	}{
+		// ラン長はすべて4（0ビット）、ランの文字は a と b が半分ずつ（1ビット）で16ラン
+		{"同じ長さのラン", bytes.Repeat([]byte("aaaabbbb"), 8), 2},
+		{"1つのラン", bytes.Repeat([]byte{'a'}, 1000), 0},
+		// ラン長はすべて1、4種類の文字（2ビット）で4ラン
+		{"ランなし", []byte("abcd"), 1},
+		{"空", nil, 0},
+	}
+	for _, tt := range tests {
+		a := Analyze(tt.data)
+		if math.Abs(a.FloorSize-tt.floor) > 1e-9 {
+			t.Errorf("%s: 理論的下限 %f, 期待値 %f", tt.name, a.FloorSize, tt.floor)
+		}
+		if got := NewCompressor().Floor(tt.data); got != a.FloorSize {
+			t.Errorf("%s: Floor %f が Analysis.FloorSize %f と一致しません", tt.name, got, a.FloorSize)
+		}
+	}
+
+	// ランの多いデータでは、0次のエントロピーより小さい
+	data := bytes.Repeat([]byte("aaaabbbb"), 8)
+	if floor, order0 := Analyze(data).FloorSize, common.OrderZeroFloor(data); floor >= order0 {
+		t.Errorf("ラン列の下限 %f が0次のエントロピーの下限 %f 以上です", floor, order0)
+	}
+	// 下限は実際の圧縮サイズを超えない
+	for _, sample := range testcorpus.Samples() {
+		if a := Analyze(sample.Data); a.FloorSize > float64(a.EstimatedSize) {
+			t.Errorf("%s: 下限 %f が圧縮サイズ %d を超えています", sample.Name, a.FloorSize, a.EstimatedSize)
+		}
+	}
+}
+
+func TestAnalyzeMatchesCompressCorpus(t *testing.T) {
+	compressor := NewCompressor()
+	for _, sample := range testcorpus.Samples() {
+		compressed, err := compressor.Compress(sample.Data)
+		if err != nil {
+			t.Fatalf("%s: 圧縮エラー: %v", sample.Name, err)
+		}
+		if got := Analyze(sample.Data).EstimatedSize; got != len(compressed) {
+			t.Errorf("%s: 予想サイズ %d が実際の圧縮サイズ %d と一致しません", sample.Name, got, len(compressed))
+		}
+	}
+}
+
+func TestStreamMatchesCompress(t *testing.T) {
+	compressor := NewCompressor()
+	for _, sample := range testcorpus.Samples() {
+		expected, _ := compressor.Compress(sample.Data)
+
+		var compressed bytes.Buffer
+		if err := compressor.CompressStream(bytes.NewReader(sample.Data), &compressed); err != nil {
+			t.Fatalf("%s: ストリーム圧縮エラー: %v", sample.Name, err)
+		}
+		if !bytes.Equal(compressed.Bytes(), expected) {
+			t.Errorf("%s: ストリーム圧縮の結果が Compress と一致しません", sample.Name)
+		}
+
+		var decompressed bytes.Buffer
+		if err := compressor.DecompressStream(&compressed, &decompressed); err != nil {
+			t.Fatalf("%s: ストリーム展開エラー: %v", sample.Name, err)
+		}
+		if !bytes.Equal(decompressed.Bytes(), sample.Data) {
+			t.Errorf("%s: ストリーム展開の結果が一致しません", sample.Name)
+		}
+	}
+
+	cases := map[string]struct {
+		data   []byte
+		offset int64
+	}{
+		"奇数バイト": {[]byte{'a', 1, 'b'}, 2},
+		"カウント0": {[]byte{'a', 1, 'b', 0}, 3},
+		"空":     {[]byte{}, 0},
+		"空の組の後": {[]byte{0, 0, 'a', 1}, 1},
+	}
+	for name, tc := range cases {
+		err := compressor.DecompressStream(bytes.NewReader(tc.data), io.Discard)
+		if err == nil {
+			t.Errorf("%s: エラーになりませんでした", name)
+		}
+		assertDecodeOffset(t, err, tc.offset)
+	}
+}
+
+func TestAnalysis_Export(t *testing.T) {
+	a := Analyze([]byte("aaabcccccb"))
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"data_size", "total_runs", "average_run_length", "long_runs", "split_runs",
+		"break_even_run_length", "estimated_size", "estimated_ratio", "floor_size", "run_lengths"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("Expected field %q in %s", key, data)
+		}
+	}
+
+	// ラン長 1 が2回（b, b）、3 と 5 が1回ずつ、ラン長の順に並ぶ
+	var decoded struct {
+		RunLengths []RunCount `json:"run_lengths"`
+	}
+	json.Unmarshal(data, &decoded)
+	want := []RunCount{{1, 2}, {3, 1}, {5, 1}}
+	if !slices.Equal(decoded.RunLengths, want) {
+		t.Errorf("Expected run_lengths %v, got %v", want, decoded.RunLengths)
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	if got := buf.String(); got != "run_length,count\n1,2\n3,1\n5,1\n" {
+		t.Errorf("Unexpected CSV:\n%s", got)
+	}
+
+	// 空のデータでも run_lengths は null ではなく空の配列
+	data, _ = json.Marshal(Analyze(nil))
+	if !bytes.Contains(data, []byte(`"run_lengths":[]`)) {
+		t.Errorf("Expected an empty run_lengths array, got %s", data)
+	}
+}
+
+func TestWithTracer(t *testing.T) {
+	var runs []RunEvent
+	traced := NewCompressor().WithTracer(common.TracerFunc(func(event any) { runs = append(runs, event.(RunEvent)) }))
+
+	data := append([]byte("aaabcc"), bytes.Repeat([]byte{'z'}, 300)...)
+	want := []RunEvent{
+		{Position: 0, Byte: 'a', Length: 3},
+		{Position: 3, Byte: 'b', Length: 1},
+		{Position: 4, Byte: 'c', Length: 2},
+		{Position: 6, Byte: 'z', Length: 255}, // 255で分割した組ごとに通知する
+		{Position: 261, Byte: 'z', Length: 45},
+	}
+
+	if _, err := traced.Compress(data); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(runs, want) {
+		t.Errorf("Compress: expected %v, got %v", want, runs)
+	}
+
+	runs = nil
+	if err := traced.(common.StreamCompressor).CompressStream(bytes.NewReader(data), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(runs, want) {
+		t.Errorf("CompressStream: expected %v, got %v", want, runs)
+	}
+}
+
+func TestFprintAnalysis_Golden(t *testing.T) {
+	var out bytes.Buffer
+	for _, data := range [][]byte{nil, []byte("aaaabbbcdddddddddd"), bytes.Repeat([]byte{0}, 600)} {
+		FprintAnalysis(&out, Analyze(data))
+	}
+	golden.Check(t, "analysis", out.Bytes())
+}
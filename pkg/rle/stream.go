@@ -0,0 +1,101 @@
+package rle
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// CompressStream は src を読みながらRLE圧縮して dst に書き込みます
+// 出力は Compress と同じ形式です。ランは1バイトずつ読みながら数えるため、
+// 入力全体をメモリに読み込む必要はありません。
+func (r *Compressor) CompressStream(src io.Reader, dst io.Writer) error {
+	in := bufio.NewReader(src)
+	out := bufio.NewWriter(dst)
+
+	current, err := in.ReadByte()
+	if err == io.EOF {
+		_, err := dst.Write(emptyPair)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	count := 1
+	pos := int64(1) // 読み込んだバイト数
+
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pos++
+
+		if b == current && count < maxCount {
+			count++
+			continue
+		}
+		if _, err := out.Write([]byte{current, byte(count)}); err != nil {
+			return err
+		}
+		if r.tracer != nil {
+			r.traceRun(pos-1-int64(count), current, count)
+		}
+		current = b
+		count = 1
+	}
+
+	if _, err := out.Write([]byte{current, byte(count)}); err != nil {
+		return err
+	}
+	if r.tracer != nil {
+		r.traceRun(pos-int64(count), current, count)
+	}
+	return out.Flush()
+}
+
+// DecompressStream はRLE圧縮された src を読みながら展開して dst に書き込みます
+func (r *Compressor) DecompressStream(src io.Reader, dst io.Writer) error {
+	in := bufio.NewReader(src)
+	out := bufio.NewWriter(dst)
+
+	pair := make([]byte, 2)
+	for offset := int64(0); ; offset += 2 {
+		if n, err := io.ReadFull(in, pair); err != nil {
+			if err == io.EOF {
+				if offset == 0 {
+					return common.NewDecodeError("RLE", nil, 0, "圧縮データが空です")
+				}
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return common.NewDecodeError("RLE", pair[:n], 0, "圧縮データのサイズが不正です（奇数バイト）").WithBase(offset)
+			}
+			return err
+		}
+		if err := classicCounts.check(pair, 1, uint64(pair[1])); err != nil {
+			// 空のデータを表す組は、それだけで圧縮データ全体になっている場合のみ有効
+			if offset == 0 && pair[0] == 0 && pair[1] == 0 {
+				if _, err := in.Peek(1); err == io.EOF {
+					return out.Flush()
+				}
+			}
+			return err.WithBase(offset)
+		}
+
+		for i := 0; i < int(pair[1]); i++ {
+			if err := out.WriteByte(pair[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return out.Flush()
+}
+
+var _ common.StreamCompressor = (*Compressor)(nil)
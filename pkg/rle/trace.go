@@ -0,0 +1,26 @@
+package rle
+
+import "github.com/sasakihasuto/tinyzipzap/pkg/common"
+
+// RunEvent は圧縮で「文字 + カウント」の組を1つ出力したイベントです（common.Tracer に通知します）
+// 255を超えるランは複数の組に分割されるため、組ごとに1つずつ通知します。
+type RunEvent struct {
+	Position int64 `json:"position"` // ランの先頭の位置
+	Byte     byte  `json:"byte"`     // 繰り返される文字
+	Length   int   `json:"length"`   // ラン長（1〜255）
+}
+
+// WithTracer は組を出力するごとに t に RunEvent を通知する Compressor を返します（common.Traced）
+// Compress と CompressStream の両方で通知します。
+func (r *Compressor) WithTracer(t common.Tracer) common.Compressor {
+	c := *r
+	c.tracer = t
+	return &c
+}
+
+// traceRun は data[pos:pos+length] の組を出力したことを通知します
+func (r *Compressor) traceRun(pos int64, b byte, length int) {
+	r.tracer.OnStep(RunEvent{Position: pos, Byte: b, Length: length})
+}
+
+var _ common.Traced = (*Compressor)(nil)
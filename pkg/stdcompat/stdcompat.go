@@ -0,0 +1,321 @@
+// Package stdcompat adapts the standard library's gzip and zlib to common.Compressor.
+// compress/gzip と compress/zlib を common.Compressor と common.StreamCompressor として
+// "gzip" と "zlib" の名前で登録します。自作のアルゴリズムと同じパイプライン（コンテナ、
+// アーカイブ、比較）で、実用的な圧縮との差を同じ条件で確かめるために使います。
+package stdcompat
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+func init() {
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "gzip",
+		Capabilities: common.CapStreaming | common.CapLevels | common.CapDeterministic,
+		Description:  "標準ライブラリの gzip（RFC 1952、比較用）",
+		UseCase:      "実用的な圧縮との比較、gzip で展開するデータ",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewGzip() },
+	})
+	common.RegisterDescriptor(common.Descriptor{
+		Name:         "zlib",
+		Capabilities: common.CapStreaming | common.CapLevels | common.CapDeterministic,
+		Description:  "標準ライブラリの zlib（RFC 1950、比較用）",
+		UseCase:      "実用的な圧縮との比較、zlib で展開するデータ",
+		MaxVersion:   formatVersion,
+		NewFunc:      func() common.Compressor { return NewZlib() },
+	})
+}
+
+// Format は圧縮データの形式です
+type Format int
+
+const (
+	// Gzip は RFC 1952 の gzip 形式です（ヘッダーのファイル名と更新日時は空）
+	Gzip Format = iota
+	// Zlib は RFC 1950 の zlib 形式です
+	Zlib
+)
+
+// String は形式の名前を返します（登録名と同じです）
+func (f Format) String() string {
+	switch f {
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// decoderMemSize はDEFLATEの展開器1つあたりのおおよそのメモリ量です（予算の計算に使用）
+// 32KBのスライディングウィンドウと符号表の分です。
+const decoderMemSize = 48 << 10
+
+// readChunkSize は DecompressWithOptions で一度に読み込む展開結果のバイト数です
+const readChunkSize = 32 << 10
+
+// Compressor は標準ライブラリの gzip または zlib で圧縮します
+// 設定は構築後に変更されず、Writer と Reader は呼び出しごとに作成するため、
+// 複数のゴルーチンから同時に使用できます
+type Compressor struct {
+	format  Format
+	level   int
+	oneShot common.OneShotLimit // Compress の入力の上限
+}
+
+// Option はCompressorの設定を変更します
+type Option func(*Compressor)
+
+// WithLevel は圧縮レベルを指定します
+// flate.HuffmanOnly（-2）から flate.BestCompression（9）までで、デフォルトは
+// flate.DefaultCompression（-1）です。範囲外のレベルは圧縮時にエラーになります。
+// レベルは出力の形式に影響しないため、どのレベルで圧縮したデータも同じように展開できます。
+func WithLevel(level int) Option {
+	return func(c *Compressor) {
+		c.level = level
+	}
+}
+
+// NewGzip は gzip 形式のCompressorを作成します
+func NewGzip(opts ...Option) *Compressor {
+	return newCompressor(Gzip, opts)
+}
+
+// NewZlib は zlib 形式のCompressorを作成します
+func NewZlib(opts ...Option) *Compressor {
+	return newCompressor(Zlib, opts)
+}
+
+func newCompressor(format Format, opts []Option) *Compressor {
+	c := &Compressor{format: format, level: flate.DefaultCompression}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Name はアルゴリズム名を返します
+func (c *Compressor) Name() string {
+	return c.format.String()
+}
+
+// Format は圧縮データの形式を返します
+func (c *Compressor) Format() Format {
+	return c.format
+}
+
+// Level は圧縮レベルを返します（WithLevel）
+func (c *Compressor) Level() int {
+	return c.level
+}
+
+// formatVersion は圧縮形式のバージョンです（形式は標準ライブラリと RFC で決まっています）
+const formatVersion = 0
+
+// FormatVersion は圧縮形式のバージョンを返します（common.Versioned）
+func (c *Compressor) FormatVersion() byte {
+	return formatVersion
+}
+
+// Writer は圧縮しながら書き込む Writer です
+// Flush はそれまでに書き込んだデータを、受け取った側がすぐに展開できるところまで
+// 出力します（DEFLATEの同期フラッシュ）。Close は残りのデータとフッター（チェックサム）を
+// 書き込みますが、下の Writer は閉じません。Close しなかった出力は完全なデータになりません。
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// NewWriter は w に圧縮データを書き込む Writer を作成します
+// レベルが範囲外の場合はエラーを返します
+func (c *Compressor) NewWriter(w io.Writer) (Writer, error) {
+	switch c.format {
+	case Gzip:
+		return gzip.NewWriterLevel(w, c.level)
+	case Zlib:
+		return zlib.NewWriterLevel(w, c.level)
+	default:
+		return nil, fmt.Errorf("stdcompat: unknown format %v", c.format)
+	}
+}
+
+// newReader は r から展開する Reader を作成します
+func (c *Compressor) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch c.format {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("stdcompat: unknown format %v", c.format)
+	}
+}
+
+// gzip と zlib のヘッダーとフッター（チェックサム）のバイト数です
+const (
+	gzipOverhead = 10 + 8
+	zlibOverhead = 2 + 4
+)
+
+// Overhead はヘッダー、フッターと最小のDEFLATEブロック（2バイト）のバイト数を返します（common.Overheader）
+func (c *Compressor) Overhead(data []byte) int {
+	if c.format == Gzip {
+		return gzipOverhead + 2
+	}
+	return zlibOverhead + 2
+}
+
+// Compress は data を圧縮します
+// 入力が上限（WithMaxOneShotSize）を超える場合は *common.InputTooLargeError を返します。
+// 大きな入力は NewWriter で圧縮してください。
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	if err := c.oneShot.Check(c.Name(), len(data)); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WithMaxOneShotSize は Compress の入力の上限を n バイト（0以下は上限なし）にした
+// Compressor を返します（common.OneShotLimited）
+func (c *Compressor) WithMaxOneShotSize(n int64) common.Compressor {
+	limited := *c
+	limited.oneShot = common.NewOneShotLimit(n)
+	return &limited
+}
+
+// Decompress は圧縮されたデータを展開します
+func (c *Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressWithOptions(data, common.DecompressOptions{})
+}
+
+// DecompressWithOptions は出力サイズとメモリ予算を確認しながら展開します
+// 形式は元のサイズを先頭に持たないため、展開結果を少しずつ読みながら確認します。
+// 圧縮データの後ろに余分なデータがある場合もエラーにします。
+func (c *Compressor) DecompressWithOptions(data []byte, opts common.DecompressOptions) ([]byte, error) {
+	if err := opts.Budget.Reserve(decoderMemSize); err != nil {
+		return nil, err
+	}
+	defer opts.Budget.Release(decoderMemSize)
+
+	// bytes.Reader は io.ByteReader なので、展開器は圧縮データの終わりまでしか読み込まない
+	src := bytes.NewReader(data)
+	r, err := c.newReader(src)
+	if err != nil {
+		return nil, c.decodeError(data, len(data)-src.Len(), err)
+	}
+
+	var out []byte
+	buf := make([]byte, readChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := opts.ReserveOutput(int64(n), int64(len(out)+n)); err != nil {
+				return nil, err
+			}
+			out = append(out, buf[:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, c.decodeError(data, len(data)-src.Len(), err)
+		}
+	}
+
+	if src.Len() > 0 {
+		offset := len(data) - src.Len()
+		return nil, common.NewDecodeError(c.Name(), data, offset, "圧縮データの後ろに %d バイトの余分なデータがあります", src.Len())
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
+
+// CompressStream は src を読みながら圧縮して dst に書き込みます
+// 出力は Compress と同じ形式です。src の読み込みに失敗した場合はフッターを書き込まない
+// ため、途中までの出力が完全なデータとして展開されることはありません。dst は閉じません。
+func (c *Compressor) CompressStream(src io.Reader, dst io.Writer) error {
+	w, err := c.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecompressStream は src を読みながら展開して dst に書き込みます
+// 壊れたデータのエラーの位置は、展開器がそこまでに読み込んだバイト数です
+// （展開器は内部でバッファリングするため、不正な箇所より後ろを指すことがあります）。
+// zlib ではストリームの終わりより後ろのデータは読まずに残します。
+func (c *Compressor) DecompressStream(src io.Reader, dst io.Writer) error {
+	in := &offsetReader{r: src}
+	r, err := c.newReader(in)
+	if err == nil {
+		defer r.Close()
+		_, err = io.Copy(dst, r)
+	}
+	if err == io.EOF || isFormatError(err) {
+		return c.decodeError(nil, 0, err).WithBase(in.n)
+	}
+	return err
+}
+
+// decodeError は標準ライブラリの展開エラーを *common.DecodeError にします
+func (c *Compressor) decodeError(data []byte, offset int, err error) *common.DecodeError {
+	reason := err.Error()
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		reason = "圧縮データが途中で終わっています"
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, zlib.ErrHeader):
+		reason = "ヘッダーが不正です"
+	case errors.Is(err, gzip.ErrChecksum), errors.Is(err, zlib.ErrChecksum):
+		reason = "チェックサムが一致しません"
+	}
+	return common.NewDecodeError(c.Name(), data, offset, "%s", reason)
+}
+
+// isFormatError は err が圧縮データの不正による展開エラーかを返します
+// src や dst のエラーはそのまま返すために区別します
+func isFormatError(err error) bool {
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, zlib.ErrHeader) || errors.Is(err, zlib.ErrChecksum) || errors.Is(err, zlib.ErrDictionary) ||
+		errors.As(err, &corrupt)
+}
+
+// offsetReader は読み込んだバイト数を数えます
+type offsetReader struct {
+	r io.Reader
+	n int64
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	o.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,273 @@
+package stdcompat
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/internal/testcorpus"
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+)
+
+// logText は圧縮レベルで結果が変わる程度に変化のある、約 n バイトのログ風のテキストを返します
+func logText(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < n; i++ {
+		fmt.Fprintf(&buf, "%05d level=info request=%d latency=%dms\n", i, i*7919%10007, i*i%997)
+	}
+	return buf.Bytes()
+}
+
+func compressors() []*Compressor {
+	return []*Compressor{NewGzip(), NewZlib()}
+}
+
+func TestRegistered(t *testing.T) {
+	for _, name := range []string{"gzip", "zlib"} {
+		c, err := common.New(name)
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", name, err)
+		}
+		if c.Name() != name {
+			t.Errorf("Expected name %q, got %q", name, c.Name())
+		}
+		if _, ok := c.(common.StreamCompressor); !ok {
+			t.Errorf("%s: expected a StreamCompressor", name)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range compressors() {
+		for _, sample := range testcorpus.Samples() {
+			t.Run(c.Name()+"/"+sample.Name, func(t *testing.T) {
+				compressed, err := c.Compress(sample.Data)
+				if err != nil {
+					t.Fatalf("Compress failed: %v", err)
+				}
+				decompressed, err := c.Decompress(compressed)
+				if err != nil {
+					t.Fatalf("Decompress failed: %v", err)
+				}
+				if !bytes.Equal(decompressed, sample.Data) {
+					t.Error("Round trip mismatch")
+				}
+
+				// ストリームの出力は Compress と同じで、どちらの展開でも元に戻る
+				var stream bytes.Buffer
+				if err := c.CompressStream(bytes.NewReader(sample.Data), &stream); err != nil {
+					t.Fatalf("CompressStream failed: %v", err)
+				}
+				if !bytes.Equal(stream.Bytes(), compressed) {
+					t.Error("CompressStream output differs from Compress")
+				}
+				var out bytes.Buffer
+				if err := c.DecompressStream(bytes.NewReader(stream.Bytes()), &out); err != nil {
+					t.Fatalf("DecompressStream failed: %v", err)
+				}
+				if !bytes.Equal(out.Bytes(), sample.Data) {
+					t.Error("Stream round trip mismatch")
+				}
+			})
+		}
+	}
+}
+
+// TestStandardLibraryInterop は標準ライブラリの Reader と Writer とそのまま相互に読めることを確認します
+func TestStandardLibraryInterop(t *testing.T) {
+	data := logText(4096)
+
+	compressed, _ := NewGzip().Compress(data)
+	gr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	if got, err := io.ReadAll(gr); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("gzip.Reader could not read the output: %v", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	if got, err := NewZlib().Decompress(buf.Bytes()); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Could not read zlib.Writer output: %v", err)
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	data := logText(16 << 10)
+	for _, format := range []Format{Gzip, Zlib} {
+		sizes := make(map[int]int)
+		for _, level := range []int{flate.HuffmanOnly, flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+			c := newCompressor(format, []Option{WithLevel(level)})
+			compressed, err := c.Compress(data)
+			if err != nil {
+				t.Fatalf("%v level %d: Compress failed: %v", format, level, err)
+			}
+			sizes[level] = len(compressed)
+
+			// レベルによらずデフォルトのCompressorで展開できる
+			decompressed, err := newCompressor(format, nil).Decompress(compressed)
+			if err != nil || !bytes.Equal(decompressed, data) {
+				t.Errorf("%v level %d: round trip failed: %v", format, level, err)
+			}
+		}
+		if sizes[flate.NoCompression] <= len(data) || sizes[flate.BestCompression] >= sizes[flate.BestSpeed] {
+			t.Errorf("%v: unexpected sizes per level: %v", format, sizes)
+		}
+
+		if _, err := newCompressor(format, []Option{WithLevel(10)}).Compress(data); err == nil {
+			t.Errorf("%v: expected an error for level 10", format)
+		}
+	}
+}
+
+// TestWriter_Flush は Flush までに書き込んだデータが、Close の前でも展開できることを確認します
+func TestWriter_Flush(t *testing.T) {
+	for _, c := range compressors() {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := c.NewWriter(&buf)
+			if err != nil {
+				t.Fatalf("NewWriter failed: %v", err)
+			}
+			w.Write([]byte("first line\n"))
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			// フッターがないので完全なデータではないが、書き込んだ分は読める
+			r, err := c.newReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("newReader failed: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if string(got) != "first line\n" || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("Expected the flushed line and ErrUnexpectedEOF, got %q, %v", got, err)
+			}
+			if _, err := c.Decompress(buf.Bytes()); !errors.Is(err, common.ErrInvalidData) {
+				t.Errorf("Expected ErrInvalidData before Close, got %v", err)
+			}
+
+			w.Write([]byte("second line\n"))
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			got, err = c.Decompress(buf.Bytes())
+			if err != nil || string(got) != "first line\nsecond line\n" {
+				t.Errorf("Expected both lines after Close, got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+// errReader は data を返した後に err を返します
+type errReader struct {
+	data []byte
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// TestCompressStream_SourceError は入力のエラーで止まった出力が、完全なデータとして展開されないことを確認します
+func TestCompressStream_SourceError(t *testing.T) {
+	readErr := errors.New("disk failure")
+	for _, c := range compressors() {
+		var buf bytes.Buffer
+		err := c.CompressStream(&errReader{data: []byte("partial data"), err: readErr}, &buf)
+		if !errors.Is(err, readErr) {
+			t.Errorf("%s: expected the read error, got %v", c.Name(), err)
+		}
+		if _, err := c.Decompress(buf.Bytes()); err == nil {
+			t.Errorf("%s: expected the incomplete output to fail to decompress", c.Name())
+		}
+	}
+}
+
+func TestDecompress_Invalid(t *testing.T) {
+	for _, c := range compressors() {
+		compressed, _ := c.Compress(logText(1024))
+		corrupted := append([]byte(nil), compressed...)
+		corrupted[len(corrupted)-1] ^= 0xFF // チェックサム
+
+		tests := map[string][]byte{
+			"empty":     {},
+			"header":    []byte("not compressed"),
+			"truncated": compressed[:len(compressed)/2],
+			"checksum":  corrupted,
+			"trailing":  append(append([]byte(nil), compressed...), 0x00, 0x01),
+		}
+		for name, data := range tests {
+			t.Run(c.Name()+"/"+name, func(t *testing.T) {
+				_, err := c.Decompress(data)
+				var decodeErr *common.DecodeError
+				if !errors.As(err, &decodeErr) || !errors.Is(err, common.ErrInvalidData) {
+					t.Fatalf("Expected a DecodeError, got %v", err)
+				}
+				if decodeErr.Algorithm != c.Name() {
+					t.Errorf("Expected algorithm %q, got %q", c.Name(), decodeErr.Algorithm)
+				}
+
+				// gzip はメンバーの連結を読むため、後ろの余分なデータはストリームでもヘッダーのエラーになる
+				if name == "trailing" && c.Format() == Zlib {
+					return
+				}
+				err = c.DecompressStream(bytes.NewReader(data), io.Discard)
+				if !errors.Is(err, common.ErrInvalidData) {
+					t.Errorf("DecompressStream: expected ErrInvalidData, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+// TestDecompressStream_WriteError は書き込み側のエラーを展開エラーにしないことを確認します
+func TestDecompressStream_WriteError(t *testing.T) {
+	compressed, _ := NewGzip().Compress(logText(1024))
+	writeErr := errors.New("disk full")
+	err := NewGzip().DecompressStream(bytes.NewReader(compressed), failingWriter{writeErr})
+	if !errors.Is(err, writeErr) || errors.Is(err, common.ErrInvalidData) {
+		t.Errorf("Expected the write error, got %v", err)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestDecompressWithOptions_Limits(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for _, c := range compressors() {
+		compressed, _ := c.Compress(data)
+
+		_, err := c.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: 1000})
+		if !errors.Is(err, common.ErrOutputTooLarge) {
+			t.Errorf("%s: expected ErrOutputTooLarge, got %v", c.Name(), err)
+		}
+
+		budget := common.NewBudget(256 << 10)
+		_, err = c.DecompressWithOptions(compressed, common.DecompressOptions{Budget: budget})
+		if !errors.Is(err, common.ErrBudgetExceeded) {
+			t.Errorf("%s: expected ErrBudgetExceeded, got %v", c.Name(), err)
+		}
+
+		// 上限ちょうどなら展開できる
+		got, err := c.DecompressWithOptions(compressed, common.DecompressOptions{MaxOutputSize: int64(len(data))})
+		if err != nil || len(got) != len(data) {
+			t.Errorf("%s: expected success at the exact limit, got %v", c.Name(), err)
+		}
+	}
+}
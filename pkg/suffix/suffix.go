@@ -0,0 +1,94 @@
+// Package suffix implements suffix array and LCP array construction.
+// 接尾辞配列は、データのすべての接尾辞を辞書順に並べたときの開始位置の配列です。
+// 辞書順で隣り合う接尾辞ほど長い共通接頭辞を持つため、LZ77の最長一致を
+// 正確に求めるために使用できます。
+package suffix
+
+import "sort"
+
+// Build は data の接尾辞配列を構築します
+// ダブリング法（順位の組をソートして比較する長さを倍にしていく）で O(n log² n) です。
+func Build(data []byte) []int32 {
+	n := len(data)
+	sa := make([]int32, n)
+	if n == 0 {
+		return sa
+	}
+
+	rank := make([]int32, n)
+	next := make([]int32, n)
+	for i := range sa {
+		sa[i] = int32(i)
+		rank[i] = int32(data[i])
+	}
+
+	for k := 1; ; k *= 2 {
+		// 先頭 2k バイトの順位は (先頭kバイトの順位, 続くkバイトの順位) の組で決まる
+		second := func(i int32) int32 {
+			if int(i)+k < n {
+				return rank[int(i)+k]
+			}
+			return -1
+		}
+		less := func(a, b int32) bool {
+			if rank[a] != rank[b] {
+				return rank[a] < rank[b]
+			}
+			return second(a) < second(b)
+		}
+		sort.Slice(sa, func(i, j int) bool { return less(sa[i], sa[j]) })
+
+		// 新しい順位を振り直す
+		next[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			next[sa[i]] = next[sa[i-1]]
+			if less(sa[i-1], sa[i]) {
+				next[sa[i]]++
+			}
+		}
+		copy(rank, next)
+
+		// すべての順位が異なれば完了
+		if int(rank[sa[n-1]]) == n-1 {
+			break
+		}
+	}
+
+	return sa
+}
+
+// Inverse は接尾辞配列の逆配列（位置 -> 接尾辞配列中の順位）を返します
+func Inverse(sa []int32) []int32 {
+	rank := make([]int32, len(sa))
+	for i, p := range sa {
+		rank[p] = int32(i)
+	}
+	return rank
+}
+
+// LCP は接尾辞配列で隣り合う接尾辞の最長共通接頭辞の長さを返します
+// lcp[i] は sa[i-1] と sa[i] の共通接頭辞の長さで、lcp[0] は0です。
+// Kasaiのアルゴリズムで O(n) です。
+func LCP(data []byte, sa []int32) []int32 {
+	n := len(sa)
+	lcp := make([]int32, n)
+	rank := Inverse(sa)
+
+	h := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			h = 0
+			continue
+		}
+		j := int(sa[rank[i]-1])
+		for i+h < n && j+h < n && data[i+h] == data[j+h] {
+			h++
+		}
+		lcp[rank[i]] = int32(h)
+		if h > 0 {
+			h--
+		}
+	}
+
+	return lcp
+}
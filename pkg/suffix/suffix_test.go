@@ -0,0 +1,86 @@
+package suffix
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteForce は接尾辞を直接比較してソートします
+func bruteForce(data []byte) []int32 {
+	sa := make([]int32, len(data))
+	for i := range sa {
+		sa[i] = int32(i)
+	}
+	sort.Slice(sa, func(i, j int) bool {
+		return bytes.Compare(data[sa[i]:], data[sa[j]:]) < 0
+	})
+	return sa
+}
+
+// randomInputs は長さとアルファベットの大きさが異なるランダムな入力を作成します
+// アルファベットが小さいほど長い共通接頭辞が現れます
+func randomInputs() [][]byte {
+	r := rand.New(rand.NewSource(1))
+	var inputs [][]byte
+	for _, n := range []int{0, 1, 2, 7, 100, 1000, 10 * 1024} {
+		for _, alphabet := range []int{1, 2, 4, 256} {
+			data := make([]byte, n)
+			for i := range data {
+				data[i] = byte(r.Intn(alphabet))
+			}
+			inputs = append(inputs, data)
+		}
+	}
+	return inputs
+}
+
+func TestBuild_MatchesBruteForce(t *testing.T) {
+	for _, data := range randomInputs() {
+		got := Build(data)
+		expected := bruteForce(data)
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("len=%d: mismatch at %d: got %d, expected %d", len(data), i, got[i], expected[i])
+			}
+		}
+	}
+}
+
+func TestBuild_Banana(t *testing.T) {
+	got := Build([]byte("banana"))
+	expected := []int32{5, 3, 1, 0, 4, 2}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Build(banana) = %v, expected %v", got, expected)
+		}
+	}
+}
+
+func TestLCP_MatchesBruteForce(t *testing.T) {
+	for _, data := range randomInputs() {
+		sa := Build(data)
+		lcp := LCP(data, sa)
+		for i := 1; i < len(sa); i++ {
+			a, b := data[sa[i-1]:], data[sa[i]:]
+			expected := 0
+			for expected < len(a) && expected < len(b) && a[expected] == b[expected] {
+				expected++
+			}
+			if int(lcp[i]) != expected {
+				t.Fatalf("len=%d: lcp[%d] = %d, expected %d", len(data), i, lcp[i], expected)
+			}
+		}
+	}
+}
+
+func TestInverse(t *testing.T) {
+	sa := Build([]byte("mississippi"))
+	rank := Inverse(sa)
+	for i, p := range sa {
+		if rank[p] != int32(i) {
+			t.Errorf("rank[%d] = %d, expected %d", p, rank[p], i)
+		}
+	}
+}
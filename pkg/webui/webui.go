@@ -0,0 +1,234 @@
+// Package webui serves the analysis and comparison results as a local web page.
+// 授業やワークショップで、ファイルをアップロードするかテキストを貼り付け、アルゴリズムを
+// 選んで、比較表・バイトの出現頻度・トークンや符号の例をブラウザで見られるようにします。
+// 結果は report.BuildWithOptions の構造化されたデータを html/template で表示するだけで、
+// 外部のライブラリやスクリプトは使いません。
+package webui
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	"github.com/sasakihasuto/tinyzipzap/pkg/compare"
+	"github.com/sasakihasuto/tinyzipzap/pkg/report"
+)
+
+const (
+	// DefaultMaxUpload は Options.MaxUpload が0以下の場合のアップロードの最大サイズです
+	DefaultMaxUpload = 1 << 20
+
+	// DefaultMaxDumpInput は Options.MaxDumpInput が0以下の場合に、トークンや符号の例を表示する入力の最大サイズです
+	DefaultMaxDumpInput = 4 << 10
+
+	// formOverhead はアップロードのサイズに加えて受け付ける、フォームの他のフィールドや区切りのバイト数です
+	formOverhead = 64 << 10
+)
+
+// Options はサーバーの設定です
+type Options struct {
+	// MaxUpload はアップロードまたは貼り付けるデータの最大サイズです（0以下は DefaultMaxUpload）
+	// リクエストの本文もこのサイズとフォームの分だけしか読み込みません。
+	MaxUpload int64
+
+	// MaxDumpInput はトークンや符号の例を表示する入力の最大サイズです（0以下は DefaultMaxDumpInput）
+	MaxDumpInput int
+}
+
+// page はテンプレートに渡すデータです
+type page struct {
+	Algorithms []choice       // 選べるアルゴリズム
+	MaxUpload  int64          // アップロードの最大サイズ
+	Text       string         // 貼り付けたテキスト（フォームに戻す）
+	Source     string         // 分析したデータの名前（ファイル名か「貼り付けたテキスト」）
+	Report     *report.Report // 分析結果（まだ分析していない場合は nil）
+	Dumps      bool           // トークンや符号の例を表示するか
+	DumpLimit  int            // トークンや符号の例を表示する入力の最大サイズ
+	Error      string         // 入力のエラー
+}
+
+// choice はフォームのアルゴリズムの選択肢です（common.Descriptor から作成します）
+type choice struct {
+	Name         string
+	Description  string // 説明（選択肢の title に表示）
+	UseCase      string // 向いているデータや用途
+	Capabilities string // 能力の名前（Capability.String）
+	Checked      bool
+}
+
+func init() {
+	common.RegisterFeature(common.Feature{
+		Name:        "webui",
+		Description: "serve のローカルのWeb UI",
+	})
+}
+
+//go:embed templates/index.html
+var indexTemplate string
+
+var tmpl = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"bytes":   report.Funcs()["bytes"],
+	"percent": report.Funcs()["percent"],
+	// width は出現頻度の棒の幅（最も多いバイトを100%とするCSSの値）を返します
+	"width": func(share float64, top []report.ByteCount) string {
+		if len(top) == 0 || top[0].Share == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%.1f%%", share/top[0].Share*100)
+	},
+}).Parse(indexTemplate))
+
+// handler は NewHandler が返す http.Handler です
+type handler struct {
+	opts Options
+}
+
+// NewHandler は分析のページを表示する http.Handler を返します
+// GET / でフォームを表示し、POST / で送信されたデータを分析して結果を同じページに表示します。
+// 圧縮は入力のサイズの上限を確認してから行い、検証の展開は元のデータのサイズを出力の上限とします。
+func NewHandler(opts Options) http.Handler {
+	if opts.MaxUpload <= 0 {
+		opts.MaxUpload = DefaultMaxUpload
+	}
+	if opts.MaxDumpInput <= 0 {
+		opts.MaxDumpInput = DefaultMaxDumpInput
+	}
+	return &handler{opts: opts}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.render(w, http.StatusOK, h.newPage(nil))
+	case http.MethodPost:
+		h.analyze(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// newPage は selected を選択したフォームのページを作成します（nil の場合はすべて選択）
+func (h *handler) newPage(selected []string) *page {
+	p := &page{MaxUpload: h.opts.MaxUpload, DumpLimit: h.opts.MaxDumpInput}
+	for _, d := range common.DescribeAll() {
+		checked := selected == nil
+		for _, s := range selected {
+			checked = checked || strings.EqualFold(s, d.Name)
+		}
+		p.Algorithms = append(p.Algorithms, choice{
+			Name:         d.Name,
+			Description:  d.Description,
+			UseCase:      d.UseCase,
+			Capabilities: d.Capabilities.String(),
+			Checked:      checked,
+		})
+	}
+	return p
+}
+
+// analyze は送信されたデータを選択したアルゴリズムで分析し、結果を表示します
+func (h *handler) analyze(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.opts.MaxUpload+formOverhead)
+	data, source, err := h.readInput(r)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		p := h.newPage(r.Form["algo"])
+		p.Error = fmt.Sprintf("アップロードできるのは %s までです", common.FormatBytes(h.opts.MaxUpload))
+		h.render(w, http.StatusRequestEntityTooLarge, p)
+		return
+	case err != nil:
+		p := h.newPage(r.Form["algo"])
+		p.Error = err.Error()
+		h.render(w, http.StatusBadRequest, p)
+		return
+	}
+
+	p := h.newPage(r.Form["algo"])
+	p.Text = r.FormValue("text")
+	var algos []common.Compressor
+	for _, name := range r.Form["algo"] {
+		c, err := common.New(name)
+		if err != nil {
+			p.Error = err.Error()
+			h.render(w, http.StatusBadRequest, p)
+			return
+		}
+		algos = append(algos, c)
+	}
+	if len(algos) == 0 {
+		p.Error = "アルゴリズムを1つ以上選択してください"
+		h.render(w, http.StatusBadRequest, p)
+		return
+	}
+
+	// 検証の展開は元のデータより大きな出力を確保しない
+	opts := compare.Options{Decompress: common.DecompressOptions{MaxOutputSize: max(int64(len(data)), 1)}}
+	rep := report.BuildWithOptions(data, algos, opts)
+	p.Report = &rep
+	p.Source = source
+	p.Dumps = len(data) <= h.opts.MaxDumpInput
+	h.render(w, http.StatusOK, p)
+}
+
+// readInput はアップロードされたファイル（"file"）か、貼り付けたテキスト（"text"）を読み込みます
+// ファイルがあればファイルを使います。どちらも MaxUpload を超える場合は *http.MaxBytesError を返します。
+func (h *handler) readInput(r *http.Request) ([]byte, string, error) {
+	if err := r.ParseMultipartForm(h.opts.MaxUpload + formOverhead); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, "", err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, "", err
+	}
+
+	tooLarge := &http.MaxBytesError{Limit: h.opts.MaxUpload}
+	file, header, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		if header.Size > h.opts.MaxUpload {
+			return nil, "", tooLarge
+		}
+		data, err := io.ReadAll(io.LimitReader(file, h.opts.MaxUpload+1))
+		if err != nil {
+			return nil, "", err
+		}
+		if int64(len(data)) > h.opts.MaxUpload {
+			return nil, "", tooLarge
+		}
+		return data, header.Filename, nil
+	case !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart):
+		return nil, "", err
+	}
+
+	text := r.FormValue("text")
+	if int64(len(text)) > h.opts.MaxUpload {
+		return nil, "", tooLarge
+	}
+	if text == "" {
+		return nil, "", errors.New("ファイルを選択するか、テキストを貼り付けてください")
+	}
+	return []byte(text), "貼り付けたテキスト", nil
+}
+
+// render はページを status で出力します
+func (h *handler) render(w http.ResponseWriter, status int, p *page) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, buf.String())
+}
@@ -0,0 +1,169 @@
+package webui
+
+import (
+	"bytes"
+	"html"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sasakihasuto/tinyzipzap/pkg/common"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/huffman"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/lz77"
+	_ "github.com/sasakihasuto/tinyzipzap/pkg/rle"
+)
+
+// lessonInput は教科書のLZWの例の入力です
+var lessonInput = []byte("TOBEORNOTTOBEORTOBEORNOT")
+
+// postFile は data を file フィールドとしてアップロードするリクエストを送ります
+func postFile(t *testing.T, h http.Handler, data []byte, algos ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, algo := range algos {
+		mw.WriteField("algo", algo)
+	}
+	fw, err := mw.CreateFormFile("file", "lesson.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// algorithmRow は比較表の c の行の先頭（アルゴリズム名と圧縮後のサイズ）を返します
+func algorithmRow(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	c, err := common.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := c.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return `<tr class="algorithm"><td>` + c.Name() + `</td><td class="num">` + strconv.Itoa(len(compressed)) + " bytes</td>"
+}
+
+func TestHandler_Form(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	out := rec.Body.String()
+	for _, d := range common.DescribeAll() {
+		if !strings.Contains(out, `value="`+d.Name+`" checked>`) {
+			t.Errorf("Expected a checked option for %s", d.Name)
+		}
+		// 選択肢の説明は登録した Descriptor から表示する
+		if !strings.Contains(html.UnescapeString(out), `title="`+d.Description) {
+			t.Errorf("Expected the description of %s in the form", d.Name)
+		}
+	}
+	if strings.Contains(out, "圧縮結果") {
+		t.Error("Expected no results before a submission")
+	}
+}
+
+func TestHandler_Upload(t *testing.T) {
+	rec := postFile(t, NewHandler(Options{}), lessonInput, "rle", "lz77", "huffman")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Expected an HTML response, got %q", ct)
+	}
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		"データの概要（lesson.txt）",
+		"24 B (24 bytes)",
+		"2.424 bits/byte",
+		"<td>&#39;O&#39;</td><td class=\"num\">8</td><td class=\"num\">33.3%</td>",
+		`style="width: 100.0%"`,
+		"LZ77 のトークンの例",
+		"<code>&#34;O&#34;</code></td><td><code>リテラル &#39;O&#39;</code>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+	for _, name := range []string{"rle", "lz77", "huffman"} {
+		row := algorithmRow(t, name, lessonInput)
+		i := strings.Index(out, row)
+		if i < 0 {
+			t.Errorf("Expected a row starting with %q", row)
+			continue
+		}
+		if end := strings.Index(out[i:], "</tr>"); !strings.Contains(out[i:i+end], "<td>✓</td>") {
+			t.Errorf("Expected the %s row to be verified: %s", name, out[i:i+end])
+		}
+	}
+	if strings.Contains(out, algorithmRow(t, "lzw", lessonInput)) {
+		t.Error("Expected no row for an algorithm that was not selected")
+	}
+}
+
+func TestHandler_PastedText(t *testing.T) {
+	text := strings.Repeat("abcabcabc\n", 1000)
+	form := url.Values{"text": {text}, "algo": {"lz77"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	NewHandler(Options{MaxDumpInput: 1024}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	out := rec.Body.String()
+	if !strings.Contains(out, algorithmRow(t, "lz77", []byte(text))) {
+		t.Error("Expected the lz77 row for the pasted text")
+	}
+	// 大きな入力ではトークンの例を表示しない
+	if strings.Contains(out, "トークンの例") || !strings.Contains(out, "1.0 KB を超えるため") {
+		t.Error("Expected the token dump to be omitted for a large input")
+	}
+}
+
+func TestHandler_Rejects(t *testing.T) {
+	h := NewHandler(Options{MaxUpload: 100})
+	tests := []struct {
+		name string
+		data []byte
+		algo []string
+		want int
+	}{
+		{"too large", bytes.Repeat([]byte{'a'}, 101), []string{"rle"}, http.StatusRequestEntityTooLarge},
+		{"far too large", bytes.Repeat([]byte{'a'}, 1<<20), []string{"rle"}, http.StatusRequestEntityTooLarge},
+		{"unknown algorithm", lessonInput, []string{"nope"}, http.StatusBadRequest},
+		{"no algorithm", lessonInput, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := postFile(t, h, tt.data, tt.algo...); rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for PUT, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}